@@ -266,11 +266,16 @@ func (b *SimulatedBackend) TransactionReceipt(ctx context.Context, txHash common
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	receipt, _, _, _ := rawdb.ReadReceipt(b.database, txHash, b.config)
-	if receipt == nil {
+	// The lookup entries of the accepted blocks may not be written yet
+	tx, blockHash, _, index := b.blockchain.GetTransaction(txHash)
+	if tx == nil {
 		return nil, interfaces.NotFound
 	}
-	return receipt, nil
+	receipts := b.blockchain.GetReceiptsByHash(blockHash)
+	if uint64(len(receipts)) <= index {
+		return nil, interfaces.NotFound
+	}
+	return receipts[index], nil
 }
 
 // TransactionByHash checks the pool of pending transactions in addition to the
@@ -285,7 +290,7 @@ func (b *SimulatedBackend) TransactionByHash(ctx context.Context, txHash common.
 	if tx != nil {
 		return tx, true, nil
 	}
-	tx, _, _, _ = rawdb.ReadTransaction(b.database, txHash)
+	tx, _, _, _ = b.blockchain.GetTransaction(txHash)
 	if tx != nil {
 		return tx, false, nil
 	}
@@ -872,6 +877,10 @@ func (fb *filterBackend) SubscribeAcceptedTransactionEvent(ch chan<- core.NewTxs
 	return fb.bc.SubscribeAcceptedTransactionEvent(ch)
 }
 
+func (fb *filterBackend) SubscribeIncludedTransactionEvent(ch chan<- core.IncludedTxsEvent) event.Subscription {
+	return fb.bc.SubscribeIncludedTransactionEvent(ch)
+}
+
 func (fb *filterBackend) GetVMConfig() *vm.Config {
 	return fb.bc.GetVMConfig()
 }
@@ -884,6 +893,26 @@ func (fb *filterBackend) GetMaxBlocksPerRequest() int64 {
 	return eth.DefaultSettings.MaxBlocksPerRequest
 }
 
+func (fb *filterBackend) GetMaxBlocksPerMultiRequest() int64 {
+	return eth.DefaultSettings.MaxBlocksPerMultiRequest
+}
+
+func (fb *filterBackend) GetMaxLogsPerMultiRequest() int64 {
+	return eth.DefaultSettings.MaxLogsPerMultiRequest
+}
+
+func (fb *filterBackend) GetMaxBlocksScannedPerRequest() int64 {
+	return eth.DefaultSettings.MaxBlocksScannedPerRequest
+}
+
+func (fb *filterBackend) GetMaxLogsPerRequest() int64 {
+	return eth.DefaultSettings.MaxLogsPerRequest
+}
+
+func (fb *filterBackend) GetMaxConcurrentLogsRequestsPerConn() int {
+	return eth.DefaultSettings.MaxConcurrentLogsRequestsPerConn
+}
+
 func (fb *filterBackend) ChainDb() ethdb.Database  { return fb.db }
 func (fb *filterBackend) EventMux() *event.TypeMux { panic("not supported") }
 
@@ -0,0 +1,109 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/eth/ethconfig"
+)
+
+// slotWriterAddr holds a contract writing the storage slots 0 to 31, so that
+// its calls run hot.
+var slotWriterAddr = common.HexToAddress("0x0300000000000000000000000000000000000000")
+
+// newAccessHintsChain returns a started chain building its blocks at a fixed
+// time, recording the accesses of up to [hints] senders.
+func newAccessHintsChain(t testing.TB, hints int) (*ETHChain, <-chan core.NewTxsEvent) {
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1000, 0))
+	chain, _, txSubmitCh := newConfiguredChain(t, clock, func(config *ethconfig.Config) {
+		config.Miner.AccessHintsSenders = hints
+		config.Genesis.Alloc[bob.Address] = core.GenesisAccount{Balance: initialBalance}
+		config.Genesis.Alloc[slotWriterAddr] = core.GenesisAccount{
+			Balance: common.Big0,
+			Code:    common.FromHex("0x60005b806001018155600101806020116002570000"),
+		}
+	})
+	chain.Start()
+	return chain, txSubmitCh
+}
+
+// addAccessHintsTxs adds to [chain] calls to the slot writer by the funded key
+// and transfers by bob.
+func addAccessHintsTxs(t testing.TB, chain *ETHChain, txSubmitCh <-chan core.NewTxsEvent) {
+	signer := types.NewEIP155Signer(chainID)
+	var txs []*types.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		call, err := types.SignTx(types.NewTransaction(nonce, slotWriterAddr, common.Big0, uint64(gasLimit), gasPrice, nil), signer, fundedKey.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transfer, err := types.SignTx(types.NewTransaction(nonce, alice.Address, value, uint64(basicTxGasLimit), gasPrice, nil), signer, bob.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, call, transfer)
+	}
+	for _, err := range chain.AddRemoteTxs(txs) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-txSubmitCh
+}
+
+func TestAccessHintsIdenticalBlocks(t *testing.T) {
+	var built []*types.Block
+	for _, hints := range []int{0, 16} {
+		chain, txSubmitCh := newAccessHintsChain(t, hints)
+		addAccessHintsTxs(t, chain, txSubmitCh)
+
+		// The first build records the accesses which the rebuild warms up
+		for i := 0; i < 2; i++ {
+			block, err := chain.GenerateBlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txs := len(block.Transactions()); txs != 6 {
+				t.Fatalf("Expected 6 txs, found %d", txs)
+			}
+			built = append(built, block)
+		}
+		insertAndAccept(t, chain, built[len(built)-1])
+		chain.Stop()
+	}
+	for i, block := range built[1:] {
+		if block.Hash() != built[0].Hash() {
+			t.Fatalf("Expected block %d to be %s, found %s", i+1, built[0].Hash(), block.Hash())
+		}
+	}
+}
+
+func BenchmarkAccessHintsRebuild(b *testing.B) {
+	for _, hints := range []int{0, 16} {
+		b.Run(fmt.Sprintf("hints=%d", hints), func(b *testing.B) {
+			chain, txSubmitCh := newAccessHintsChain(b, hints)
+			defer chain.Stop()
+			addAccessHintsTxs(b, chain, txSubmitCh)
+			if _, err := chain.GenerateBlock(); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := chain.GenerateBlock(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
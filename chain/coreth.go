@@ -4,6 +4,7 @@
 package chain
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -150,6 +151,13 @@ func (self *ETHChain) RemoveRejectedBlocks(start, end uint64) error {
 	return self.BlockChain().RemoveRejectedBlocks(start, end)
 }
 
+// ExportAcceptedRange passes the header, body and receipts of the accepted
+// blocks from [from] to [to] to [fn] in order, see
+// BlockChain.ExportAcceptedRange.
+func (self *ETHChain) ExportAcceptedRange(ctx context.Context, from, to uint64, fn func(header *types.Header, body *types.Body, receipts types.Receipts) error) error {
+	return self.BlockChain().ExportAcceptedRange(ctx, from, to, fn)
+}
+
 func (self *ETHChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	return self.backend.BlockChain().GetReceiptsByHash(hash)
 }
@@ -169,6 +177,14 @@ func (self *ETHChain) NewRPCHandler(maximumDuration time.Duration) *rpc.Server {
 // AttachEthService registers the backend RPC services provided by Ethereum
 // to the provided handler under their assigned namespaces.
 func (self *ETHChain) AttachEthService(handler *rpc.Server, names []string) error {
+	return self.AttachEthServiceMethods(handler, names, nil)
+}
+
+// AttachEthServiceMethods registers the backend RPC services named in [names]
+// to the provided handler in full. Additionally, each service named in
+// [methods] that is not already enabled in full is registered exposing only
+// the listed methods (e.g. "getLogs").
+func (self *ETHChain) AttachEthServiceMethods(handler *rpc.Server, names []string, methods map[string][]string) error {
 	enabledServicesSet := make(map[string]struct{})
 	for _, ns := range names {
 		enabledServicesSet[ns] = struct{}{}
@@ -192,6 +208,26 @@ func (self *ETHChain) AttachEthService(handler *rpc.Server, names []string) erro
 		}
 	}
 
+	for name, serviceMethods := range methods {
+		if _, enabled := enabledServicesSet[name]; enabled {
+			continue
+		}
+		api, exists := apiSet[name]
+		if !exists {
+			return fmt.Errorf("API service %s not found", name)
+		}
+		allowed := make(map[string]struct{}, len(serviceMethods))
+		for _, method := range serviceMethods {
+			allowed[method] = struct{}{}
+		}
+		if err := handler.RegisterNameWithFilter(api.Namespace, api.Service, func(method string) bool {
+			_, ok := allowed[method]
+			return ok
+		}); err != nil {
+			return fmt.Errorf("failed to register methods of API service %s: %w", name, err)
+		}
+	}
+
 	return nil
 }
 
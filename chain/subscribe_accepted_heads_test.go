@@ -94,6 +94,8 @@ func TestAcceptedHeadSubscriptions(t *testing.T) {
 	if err := chain.Accept(block); err != nil {
 		t.Fatal(err)
 	}
+	// The accepted events are delivered in the background
+	chain.BlockChain().WaitAcceptedIndices(block.NumberU64())
 
 	select {
 	case fb := <-acceptedChainCh:
@@ -2,16 +2,34 @@ package chain
 
 import (
 	"context"
+	"encoding/json"
 	"math/big"
 	"testing"
 	"time"
 
 	"github.com/zsmartex/coreth/eth/filters"
+	"github.com/zsmartex/coreth/rpc"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/zsmartex/coreth/core/types"
 )
 
+// getLogs returns the logs of the getLogs request [crit] to [api], encoding
+// its streamed result.
+func getLogs(ctx context.Context, api *filters.PublicFilterAPI, crit filters.FilterCriteria) ([]*types.Log, error) {
+	stream, err := api.GetLogs(ctx, crit)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := rpc.EncodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	err = json.Unmarshal(encoded, &logs)
+	return logs, err
+}
+
 func TestBlockLogsAllowUnfinalized(t *testing.T) {
 	chain, newTxPoolHeadChan, txSubmitCh := NewDefaultChain(t)
 
@@ -92,7 +110,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 	}
 
 	chain.BlockChain().GetVMConfig().AllowUnfinalizedQueries = true
-	logs, err := api.GetLogs(ctx, fc)
+	logs, err := getLogs(ctx, api, fc)
 	if err != nil {
 		t.Fatalf("GetLogs failed due to %s", err)
 	}
@@ -126,7 +144,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 		t.Fatalf("Failed to create NewFilter due to %s", err)
 	}
 
-	logs, err = api.GetLogs(ctx, fc2)
+	logs, err = getLogs(ctx, api, fc2)
 	if err == nil || err.Error() != "begin block 1 is greater than end block 0" {
 		t.Fatalf("Expected GetLogs to error about invalid range, but found error %s", err)
 	}
@@ -143,7 +161,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 	}
 
 	chain.BlockChain().GetVMConfig().AllowUnfinalizedQueries = false
-	logs, err = api.GetLogs(ctx, fc)
+	logs, err = getLogs(ctx, api, fc)
 	if logs != nil {
 		t.Fatalf("Expected logs to be empty, but found %d logs", len(logs))
 	}
@@ -159,7 +177,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 		t.Fatalf("Expected GetLogs to fail due to requesting block above last accepted block, but found error %s", err)
 	}
 
-	logs, err = api.GetLogs(ctx, fc2)
+	logs, err = getLogs(ctx, api, fc2)
 	if logs != nil {
 		t.Fatalf("Expected logs to be empty, but found %d logs", len(logs))
 	}
@@ -179,7 +197,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 		FromBlock: big.NewInt(0),
 		ToBlock:   big.NewInt(1),
 	}
-	logs, err = api.GetLogs(ctx, fc3)
+	logs, err = getLogs(ctx, api, fc3)
 	if logs != nil {
 		t.Fatalf("Expected GetLogs to return empty, but found %d logs", len(logs))
 	}
@@ -202,7 +220,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 	// Unless otherwise specified, getting the latest will still return the last
 	// accepted logs even when AllowUnfinalizedQueries = true.
 	fc4 := filters.FilterCriteria{}
-	logs, err = api.GetLogs(ctx, fc4)
+	logs, err = getLogs(ctx, api, fc4)
 	if err != nil {
 		t.Fatalf("Failed to GetLogs for FilterCriteria with empty from and to block due to %s", err)
 	}
@@ -230,9 +248,11 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 	if err := chain.Accept(block); err != nil {
 		t.Fatal(err)
 	}
+	// The accepted events are delivered in the background
+	chain.BlockChain().WaitAcceptedIndices(block.NumberU64())
 
 	chain.BlockChain().GetVMConfig().AllowUnfinalizedQueries = false
-	logs, err = api.GetLogs(ctx, fc)
+	logs, err = getLogs(ctx, api, fc)
 	if err != nil {
 		t.Fatalf("GetLogs failed due to %s", err)
 	}
@@ -254,7 +274,7 @@ func TestBlockLogsAllowUnfinalized(t *testing.T) {
 		t.Fatalf("Expected GetFilterLogs to return 1 log with BlocKNumber 1, but found BlockNumber %d", logs[0].BlockNumber)
 	}
 
-	logs, err = api.GetLogs(ctx, fc4)
+	logs, err = getLogs(ctx, api, fc4)
 	if err != nil {
 		t.Fatalf("Failed to GetLogs for FilterCriteria with empty from and to block due to %s", err)
 	}
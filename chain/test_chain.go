@@ -51,6 +51,12 @@ func init() {
 }
 
 func NewDefaultChain(t *testing.T) (*ETHChain, chan core.NewTxPoolHeadEvent, <-chan core.NewTxsEvent) {
+	return newConfiguredChain(t, &mockable.Clock{}, func(*ethconfig.Config) {})
+}
+
+// newConfiguredChain returns a chain with the default config and genesis, modified
+// by [configure], building its blocks at the time of [clock].
+func newConfiguredChain(t testing.TB, clock *mockable.Clock, configure func(*ethconfig.Config)) (*ETHChain, chan core.NewTxPoolHeadEvent, <-chan core.NewTxsEvent) {
 	// configure the chain
 	config := ethconfig.NewDefaultConfig()
 	chainConfig := &params.ChainConfig{
@@ -77,6 +83,7 @@ func NewDefaultChain(t *testing.T) (*ETHChain, chan core.NewTxPoolHeadEvent, <-c
 		Difficulty: big.NewInt(0),
 		Alloc:      core.GenesisAlloc{fundedKey.Address: {Balance: initialBalance}},
 	}
+	configure(&config)
 
 	var (
 		chain *ETHChain
@@ -89,7 +96,7 @@ func NewDefaultChain(t *testing.T) (*ETHChain, chan core.NewTxPoolHeadEvent, <-c
 		eth.DefaultSettings,
 		new(dummy.ConsensusCallbacks),
 		common.Hash{},
-		&mockable.Clock{},
+		clock,
 	)
 	if err != nil {
 		t.Fatal(err)
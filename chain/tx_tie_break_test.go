@@ -0,0 +1,138 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/eth/ethconfig"
+)
+
+// newTieBreakChain returns a started chain building its blocks at a fixed
+// time, funding [keys], ordering the txs paying the same tip by [tieBreak].
+func newTieBreakChain(t *testing.T, keys []*ecdsa.PrivateKey, tieBreak types.TxTieBreak) (*ETHChain, <-chan core.NewTxsEvent) {
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1000, 0))
+	chain, _, txSubmitCh := newConfiguredChain(t, clock, func(config *ethconfig.Config) {
+		config.Miner.TxTieBreak = tieBreak
+		for _, key := range keys {
+			config.Genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: initialBalance}
+		}
+	})
+	chain.Start()
+	return chain, txSubmitCh
+}
+
+// buildTieBreakBlock returns the txs of the block built by [chain] from [txs].
+func buildTieBreakBlock(t *testing.T, chain *ETHChain, txSubmitCh <-chan core.NewTxsEvent, txs []*types.Transaction) types.Transactions {
+	for _, err := range chain.AddRemoteTxs(txs) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-txSubmitCh
+	block, err := chain.GenerateBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions()) != len(txs) {
+		t.Fatalf("Expected %d txs, found %d", len(txs), len(block.Transactions()))
+	}
+	return block.Transactions()
+}
+
+// signedTieBreakTxs returns a transfer paying the same tip signed by each of
+// [keys], first seen at [times].
+func signedTieBreakTxs(t *testing.T, keys []*ecdsa.PrivateKey, times []time.Time) []*types.Transaction {
+	signer := types.NewEIP155Signer(chainID)
+	txs := make([]*types.Transaction, len(keys))
+	for i, key := range keys {
+		tx, err := types.SignTx(types.NewTransaction(0, alice.Address, value, uint64(basicTxGasLimit), gasPrice, nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.SetFirstSeen(times[i])
+		txs[i] = tx
+	}
+	return txs
+}
+
+// TestTxTieBreakReproducible builds a block twice from the same txs paying the
+// same tip, some of them first seen at the same time, and checks that the txs
+// are ordered identically.
+func TestTxTieBreakReproducible(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 16)
+	times := make([]time.Time, len(keys))
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		times[i] = time.Unix(100+int64(i%4), 0)
+	}
+	txs := signedTieBreakTxs(t, keys, times)
+
+	for _, tieBreak := range []types.TxTieBreak{types.TxTieBreakFIFO, types.TxTieBreakHash} {
+		var built [][]byte
+		for i := 0; i < 2; i++ {
+			chain, txSubmitCh := newTieBreakChain(t, keys, tieBreak)
+			ordered, err := rlp.EncodeToBytes(buildTieBreakBlock(t, chain, txSubmitCh, txs))
+			chain.Stop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			built = append(built, ordered)
+		}
+		if !bytes.Equal(built[0], built[1]) {
+			t.Fatalf("Expected the txs of the blocks built with the tie break %d to be ordered identically", tieBreak)
+		}
+	}
+}
+
+// TestTxTieBreakFIFO checks that the tx admitted to the pool earlier is
+// committed first with the FIFO tie break, even if it was first seen later and
+// its hash is greater, and that it is not by hash only.
+func TestTxTieBreakFIFO(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	// The tx of the first key is admitted first, while first seen later, and
+	// has the greater hash
+	txs := signedTieBreakTxs(t, keys, []time.Time{time.Unix(200, 0), time.Unix(100, 0)})
+	if hashes := []common.Hash{txs[0].Hash(), txs[1].Hash()}; bytes.Compare(hashes[0][:], hashes[1][:]) < 0 {
+		keys[0], keys[1] = keys[1], keys[0]
+		txs = signedTieBreakTxs(t, keys, []time.Time{time.Unix(200, 0), time.Unix(100, 0)})
+	}
+
+	for _, test := range []struct {
+		tieBreak types.TxTieBreak
+		first    *types.Transaction
+	}{
+		{tieBreak: types.TxTieBreakFIFO, first: txs[0]},
+		{tieBreak: types.TxTieBreakHash, first: txs[1]},
+	} {
+		chain, txSubmitCh := newTieBreakChain(t, keys, test.tieBreak)
+		ordered := buildTieBreakBlock(t, chain, txSubmitCh, txs)
+		chain.Stop()
+		if ordered[0].Hash() != test.first.Hash() {
+			t.Fatalf("Expected %s to be committed first with the tie break %d, found %s", test.first.Hash(), test.tieBreak, ordered[0].Hash())
+		}
+	}
+}
@@ -10,192 +10,156 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
 )
 
+// TestVerifyBlockFee checks that the block gas cost of the headers on both
+// sides of the fee fork activations, and of headers following the last one
+// after a full, a large and a negative time window, must be covered by the
+// tips of their txs and the extra state contribution.
 func TestVerifyBlockFee(t *testing.T) {
+	f := newFeeFixtures(t, feeForksConfig(*params.TestApricotPhase2Config, 10))
+	var headers []*types.Header
+	for _, b := range f.boundaries {
+		for _, header := range f.headers[b.index-1 : b.index+1] {
+			if header.BlockGasCost != nil {
+				headers = append(headers, header)
+			}
+		}
+	}
+	last := f.headers[len(f.headers)-1]
+	for _, timestamp := range []uint64{last.Time + 12, math.MaxUint64, last.Time - 1} {
+		header := types.CopyHeader(last)
+		header.Number = new(big.Int).Add(last.Number, common.Big1)
+		header.Time = timestamp
+		header.BlockGasCost = FeeConfigAt(f.config, last.Time).blockGasCost(last, timestamp)
+		headers = append(headers, header)
+	}
+	paying := 0
+	for _, header := range headers {
+		if header.BlockGasCost.Sign() > 0 {
+			paying++
+		}
+	}
+	if paying == 0 {
+		t.Fatal("Expected headers with a block gas cost")
+	}
+
+	// Each tx pays its tip over [gas]
+	const gas = 100_000
+	var (
+		always     = func(*big.Int) bool { return true }
+		never      = func(*big.Int) bool { return false }
+		ifPositive = func(fee *big.Int) bool { return fee.Sign() > 0 }
+	)
 	tests := map[string]struct {
-		baseFee                 *big.Int
-		parentBlockGasCost      *big.Int
-		parentTime, currentTime uint64
-		txs                     []*types.Transaction
-		receipts                []*types.Receipt
-		extraStateContribution  *big.Int
-		shouldErr               bool
+		// pay returns the tips of the txs and the extra state contribution
+		// paying towards the block fee [fee]
+		pay       func(fee *big.Int) (tips []*big.Int, extra *big.Int)
+		shouldErr func(fee *big.Int) bool
 	}{
 		"tx only base fee": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(0),
-			parentTime:         10,
-			currentTime:        10,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100, big.NewInt(100), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 1000},
-			},
-			extraStateContribution: nil,
-			shouldErr:              true,
+			pay:       func(*big.Int) ([]*big.Int, *big.Int) { return []*big.Int{common.Big0}, nil },
+			shouldErr: ifPositive,
 		},
-		"tx covers exactly block fee": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(0),
-			parentTime:         10,
-			currentTime:        10,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(200), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 100_000},
+		"tx covers block fee": {
+			pay:       func(fee *big.Int) ([]*big.Int, *big.Int) { return []*big.Int{ceilDiv(fee, gas)}, nil },
+			shouldErr: never,
+		},
+		"tx short of block fee": {
+			pay: func(fee *big.Int) ([]*big.Int, *big.Int) {
+				return []*big.Int{new(big.Int).Sub(ceilDiv(fee, gas), common.Big1)}, nil
 			},
-			extraStateContribution: nil,
-			shouldErr:              false,
+			shouldErr: always,
 		},
 		"txs share block fee": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(0),
-			parentTime:         10,
-			currentTime:        10,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(200), nil),
-				types.NewTransaction(1, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(100), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 100_000},
-				{GasUsed: 100_000},
-			},
-			extraStateContribution: nil,
-			shouldErr:              false,
+			pay:       func(fee *big.Int) ([]*big.Int, *big.Int) { return []*big.Int{ceilDiv(fee, gas), common.Big0}, nil },
+			shouldErr: never,
 		},
 		"txs split block fee": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(0),
-			parentTime:         10,
-			currentTime:        10,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(150), nil),
-				types.NewTransaction(1, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(150), nil),
+			pay: func(fee *big.Int) ([]*big.Int, *big.Int) {
+				tip := ceilDiv(fee, 2*gas)
+				return []*big.Int{tip, tip}, nil
 			},
-			receipts: []*types.Receipt{
-				{GasUsed: 100_000},
-				{GasUsed: 100_000},
-			},
-			extraStateContribution: nil,
-			shouldErr:              false,
+			shouldErr: never,
 		},
 		"split block fee with extra state contribution": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(0),
-			parentTime:         10,
-			currentTime:        10,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100_000, big.NewInt(150), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 100_000},
+			pay: func(fee *big.Int) ([]*big.Int, *big.Int) {
+				extra := new(big.Int).Div(fee, common.Big2)
+				return []*big.Int{ceilDiv(new(big.Int).Sub(fee, extra), gas)}, extra
 			},
-			extraStateContribution: big.NewInt(5_000_000),
-			shouldErr:              false,
+			shouldErr: never,
 		},
 		"extra state contribution insufficient": {
-			baseFee:                big.NewInt(100),
-			parentBlockGasCost:     big.NewInt(0),
-			parentTime:             10,
-			currentTime:            10,
-			txs:                    nil,
-			receipts:               nil,
-			extraStateContribution: big.NewInt(9_999_999),
-			shouldErr:              true,
+			pay:       func(fee *big.Int) ([]*big.Int, *big.Int) { return nil, new(big.Int).Sub(fee, common.Big1) },
+			shouldErr: always,
 		},
 		"negative extra state contribution": {
-			baseFee:                big.NewInt(100),
-			parentBlockGasCost:     big.NewInt(0),
-			parentTime:             10,
-			currentTime:            10,
-			txs:                    nil,
-			receipts:               nil,
-			extraStateContribution: big.NewInt(-1),
-			shouldErr:              true,
+			pay:       func(*big.Int) ([]*big.Int, *big.Int) { return nil, big.NewInt(-1) },
+			shouldErr: always,
 		},
 		"extra state contribution covers block fee": {
-			baseFee:                big.NewInt(100),
-			parentBlockGasCost:     big.NewInt(0),
-			parentTime:             10,
-			currentTime:            10,
-			txs:                    nil,
-			receipts:               nil,
-			extraStateContribution: big.NewInt(10_000_000),
-			shouldErr:              false,
+			pay:       func(fee *big.Int) ([]*big.Int, *big.Int) { return nil, new(big.Int).Set(fee) },
+			shouldErr: never,
 		},
 		"extra state contribution covers more than block fee": {
-			baseFee:                big.NewInt(100),
-			parentBlockGasCost:     big.NewInt(0),
-			parentTime:             10,
-			currentTime:            10,
-			txs:                    nil,
-			receipts:               nil,
-			extraStateContribution: big.NewInt(10_000_001),
-			shouldErr:              false,
-		},
-		"tx only base fee after full time window": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(500_000),
-			parentTime:         10,
-			currentTime:        22, // 2s target + 10
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100, big.NewInt(100), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 1000},
-			},
-			extraStateContribution: nil,
-			shouldErr:              false,
-		},
-		"tx only base fee after large time window": {
-			baseFee:            big.NewInt(100),
-			parentBlockGasCost: big.NewInt(100_000),
-			parentTime:         0,
-			currentTime:        math.MaxUint64,
-			txs: []*types.Transaction{
-				types.NewTransaction(0, common.HexToAddress("7ef5a6135f1fd6a02593eedc869c6d41d934aef8"), big.NewInt(0), 100, big.NewInt(100), nil),
-			},
-			receipts: []*types.Receipt{
-				{GasUsed: 1000},
-			},
-			extraStateContribution: nil,
-			shouldErr:              false,
-		},
-		"parent time > current time": {
-			baseFee:                big.NewInt(100),
-			parentBlockGasCost:     big.NewInt(0),
-			parentTime:             11,
-			currentTime:            10,
-			txs:                    nil,
-			receipts:               nil,
-			extraStateContribution: big.NewInt(10_000_000),
-			shouldErr:              false,
+			pay:       func(fee *big.Int) ([]*big.Int, *big.Int) { return nil, new(big.Int).Add(fee, common.Big1) },
+			shouldErr: never,
 		},
 	}
 
+	engine := NewFaker()
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			blockGasCost := calcBlockGasCost(
-				ApricotPhase4TargetBlockRate,
-				ApricotPhase4MinBlockGasCost,
-				ApricotPhase4MaxBlockGasCost,
-				ApricotPhase4BlockGasCostStep,
-				test.parentBlockGasCost,
-				test.parentTime, test.currentTime,
-			)
-			engine := NewFaker()
-			if err := engine.verifyBlockFee(test.baseFee, blockGasCost, test.txs, test.receipts, test.extraStateContribution); err != nil {
-				if !test.shouldErr {
-					t.Fatalf("Unexpected error: %s", err)
+			for _, header := range headers {
+				fee := new(big.Int).Mul(header.BlockGasCost, header.BaseFee)
+				tips, extra := test.pay(fee)
+				var (
+					txs      []*types.Transaction
+					receipts []*types.Receipt
+				)
+				for i, tip := range tips {
+					gasPrice := new(big.Int).Add(header.BaseFee, tip)
+					txs = append(txs, types.NewTransaction(uint64(i), common.Address{1}, common.Big0, gas, gasPrice, nil))
+					receipts = append(receipts, &types.Receipt{GasUsed: gas})
 				}
-			} else {
-				if test.shouldErr {
-					t.Fatal("Should have failed verification")
+				err := engine.verifyBlockFee(header.BaseFee, header.BlockGasCost, txs, receipts, extra)
+				if shouldErr := test.shouldErr(fee); shouldErr && err == nil {
+					t.Fatalf("Block %d at %d: expected a block fee of %d to be refused", header.Number, header.Time, fee)
+				} else if !shouldErr && err != nil {
+					t.Fatalf("Block %d at %d: unexpected error: %s", header.Number, header.Time, err)
 				}
 			}
 		})
 	}
 }
+
+// TestVerifyHeaderGasFields checks the gas limit, the base fee, the rollup
+// window and the block gas cost of the headers on both sides of the fee fork
+// activations, and refuses their invalid variants.
+func TestVerifyHeaderGasFields(t *testing.T) {
+	f := newFeeFixtures(t, feeForksConfig(*params.TestApricotPhase2Config, 10))
+	engine := NewFaker()
+	for i, header := range f.headers[1:] {
+		if err := engine.verifyHeaderGasFields(f.config, header, f.headers[i]); err != nil {
+			t.Fatalf("Block %d at %d: unexpected error: %s", header.Number, header.Time, err)
+		}
+	}
+	variants := f.invalidVariants()
+	if len(variants) == 0 {
+		t.Fatal("Expected invalid variants of the boundary headers")
+	}
+	for _, variant := range variants {
+		t.Run(variant.name, func(t *testing.T) {
+			if err := engine.verifyHeaderGasFields(f.config, variant.header, variant.parent); err == nil {
+				t.Fatalf("Expected block %d at %d to be refused", variant.header.Number, variant.header.Time)
+			}
+		})
+	}
+}
+
+// ceilDiv returns [x] divided by [y], rounded up.
+func ceilDiv(x *big.Int, y uint64) *big.Int {
+	d := new(big.Int).SetUint64(y)
+	return new(big.Int).Div(new(big.Int).Add(x, new(big.Int).Sub(d, common.Big1)), d)
+}
@@ -59,6 +59,7 @@ func CalcBaseFee(config *params.ChainConfig, parent *types.Header, timestamp uin
 		return nil, nil, fmt.Errorf("cannot calculate base fee for timestamp (%d) prior to parent timestamp (%d)", timestamp, parent.Time)
 	}
 	roll := timestamp - parent.Time
+	feeConfig := FeeConfigAt(config, parent.Time)
 
 	// roll the window over by the difference between the timestamps to generate
 	// the new rollup window.
@@ -67,18 +68,14 @@ func CalcBaseFee(config *params.ChainConfig, parent *types.Header, timestamp uin
 		return nil, nil, err
 	}
 
-	// If AP5, use a less responsive [BaseFeeChangeDenominator] and a higher gas
-	// block limit
+	// If AP5, [feeConfig] selects a less responsive [BaseFeeChangeDenominator]
+	// and a higher gas block limit
 	var (
 		baseFee                  = new(big.Int).Set(parent.BaseFee)
-		baseFeeChangeDenominator = ApricotPhase4BaseFeeChangeDenominator
-		parentGasTarget          = params.ApricotPhase3TargetGas
+		baseFeeChangeDenominator = feeConfig.BaseFeeChangeDenominator.Value
+		parentGasTarget          = feeConfig.TargetGas.Value.Uint64()
+		parentGasTargetBig       = feeConfig.TargetGas.Value
 	)
-	if isApricotPhase5 {
-		baseFeeChangeDenominator = ApricotPhase5BaseFeeChangeDenominator
-		parentGasTarget = params.ApricotPhase5TargetGas
-	}
-	parentGasTargetBig := new(big.Int).SetUint64(parentGasTarget)
 
 	// Add in the gas used by the parent block in the correct place
 	// If the parent consumed gas within the rollup window, add the consumed
@@ -97,14 +94,7 @@ func CalcBaseFee(config *params.ChainConfig, parent *types.Header, timestamp uin
 		case isApricotPhase4:
 			// The [blockGasCost] is paid by the effective tips in the block using
 			// the block's value of [baseFee].
-			blockGasCost = calcBlockGasCost(
-				ApricotPhase4TargetBlockRate,
-				ApricotPhase4MinBlockGasCost,
-				ApricotPhase4MaxBlockGasCost,
-				ApricotPhase4BlockGasCostStep,
-				parent.BlockGasCost,
-				parent.Time, timestamp,
-			).Uint64()
+			blockGasCost = feeConfig.blockGasCost(parent, timestamp).Uint64()
 
 			// On the boundary of AP3 and AP4 or at the start of a new network, the parent
 			// may not have a populated [ExtDataGasUsed].
@@ -112,7 +102,7 @@ func CalcBaseFee(config *params.ChainConfig, parent *types.Header, timestamp uin
 				parentExtraStateGasUsed = parent.ExtDataGasUsed.Uint64()
 			}
 		default:
-			blockGasCost = ApricotPhase3BlockGasFee
+			blockGasCost = feeConfig.BlockGasFee.Value.Uint64()
 		}
 
 		// Compute the new state of the gas rolling window.
@@ -174,14 +164,7 @@ func CalcBaseFee(config *params.ChainConfig, parent *types.Header, timestamp uin
 	}
 
 	// Ensure that the base fee does not increase/decrease outside of the bounds
-	switch {
-	case isApricotPhase5:
-		baseFee = selectBigWithinBounds(ApricotPhase4MinBaseFee, baseFee, nil)
-	case isApricotPhase4:
-		baseFee = selectBigWithinBounds(ApricotPhase4MinBaseFee, baseFee, ApricotPhase4MaxBaseFee)
-	default:
-		baseFee = selectBigWithinBounds(ApricotPhase3MinBaseFee, baseFee, ApricotPhase3MaxBaseFee)
-	}
+	baseFee = selectBigWithinBounds(feeConfig.MinBaseFee.Value, baseFee, feeConfig.MaxBaseFee.Value)
 
 	return newRollupWindow, baseFee, nil
 }
@@ -198,6 +181,16 @@ func EstimateNextBaseFee(config *params.ChainConfig, parent *types.Header, times
 	return CalcBaseFee(config, parent, timestamp)
 }
 
+// MinBaseFee returns the lower bound of the base fee of the blocks at
+// [timestamp], or nil if the base fee is not active at [timestamp].
+func MinBaseFee(config *params.ChainConfig, timestamp uint64) *big.Int {
+	minBaseFee := FeeConfigAt(config, timestamp).MinBaseFee.Value
+	if minBaseFee == nil {
+		return nil
+	}
+	return new(big.Int).Set(minBaseFee)
+}
+
 // selectBigWithinBounds returns [value] if it is within the bounds:
 // lowerBound <= value <= upperBound or the bound at either end if [value]
 // is outside of the defined boundaries.
@@ -0,0 +1,105 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package dummy
+
+import (
+	"math/big"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// Activations supplying the fee parameters.
+const (
+	FeeActivationApricotPhase3 = "apricotPhase3"
+	FeeActivationApricotPhase4 = "apricotPhase4"
+	FeeActivationApricotPhase5 = "apricotPhase5"
+)
+
+var (
+	apricotPhase3TargetGas = new(big.Int).SetUint64(params.ApricotPhase3TargetGas)
+	apricotPhase5TargetGas = new(big.Int).SetUint64(params.ApricotPhase5TargetGas)
+)
+
+// FeeParam is a fee parameter and the activation that supplied it. [Value] is
+// nil if the parameter does not apply, [Activation] being the activation that
+// removed it, if any.
+type FeeParam struct {
+	Value      *big.Int
+	Activation string
+}
+
+// FeeConfig is the set of fee parameters selected by the rules active at a
+// timestamp. The same selection is used by the consensus engine to compute
+// the block gas cost of a block at that timestamp, and the base fee of its
+// child.
+//
+// Callers must not modify the values of the parameters.
+type FeeConfig struct {
+	// TargetGas is the gas consumed within the rollup window at which the
+	// base fee is unchanged
+	TargetGas                FeeParam
+	BaseFeeChangeDenominator FeeParam
+	MinBaseFee               FeeParam
+	MaxBaseFee               FeeParam
+	// BlockGasFee is the fixed gas added to the rollup window for each block
+	// before Apricot Phase 4
+	BlockGasFee      FeeParam
+	TargetBlockRate  FeeParam
+	MinBlockGasCost  FeeParam
+	MaxBlockGasCost  FeeParam
+	BlockGasCostStep FeeParam
+}
+
+// FeeConfigAt returns the fee parameters selected by the rules of [config]
+// active at [timestamp]. All the parameters are nil before Apricot Phase 3.
+func FeeConfigAt(config *params.ChainConfig, timestamp uint64) FeeConfig {
+	var (
+		bigTimestamp    = new(big.Int).SetUint64(timestamp)
+		isApricotPhase3 = config.IsApricotPhase3(bigTimestamp)
+		isApricotPhase4 = config.IsApricotPhase4(bigTimestamp)
+		isApricotPhase5 = config.IsApricotPhase5(bigTimestamp)
+	)
+	if !isApricotPhase3 {
+		return FeeConfig{}
+	}
+	fc := FeeConfig{
+		TargetGas:                FeeParam{apricotPhase3TargetGas, FeeActivationApricotPhase3},
+		BaseFeeChangeDenominator: FeeParam{ApricotPhase4BaseFeeChangeDenominator, FeeActivationApricotPhase3},
+		MinBaseFee:               FeeParam{ApricotPhase3MinBaseFee, FeeActivationApricotPhase3},
+		MaxBaseFee:               FeeParam{ApricotPhase3MaxBaseFee, FeeActivationApricotPhase3},
+		BlockGasFee:              FeeParam{new(big.Int).SetUint64(ApricotPhase3BlockGasFee), FeeActivationApricotPhase3},
+	}
+	if isApricotPhase4 {
+		fc.MinBaseFee = FeeParam{ApricotPhase4MinBaseFee, FeeActivationApricotPhase4}
+		fc.MaxBaseFee = FeeParam{ApricotPhase4MaxBaseFee, FeeActivationApricotPhase4}
+		// The fixed block gas fee is replaced by the block gas cost
+		fc.BlockGasFee = FeeParam{nil, FeeActivationApricotPhase4}
+		fc.TargetBlockRate = FeeParam{new(big.Int).SetUint64(ApricotPhase4TargetBlockRate), FeeActivationApricotPhase4}
+		fc.MinBlockGasCost = FeeParam{ApricotPhase4MinBlockGasCost, FeeActivationApricotPhase4}
+		fc.MaxBlockGasCost = FeeParam{ApricotPhase4MaxBlockGasCost, FeeActivationApricotPhase4}
+		fc.BlockGasCostStep = FeeParam{ApricotPhase4BlockGasCostStep, FeeActivationApricotPhase4}
+	}
+	if isApricotPhase5 {
+		fc.TargetGas = FeeParam{apricotPhase5TargetGas, FeeActivationApricotPhase5}
+		fc.BaseFeeChangeDenominator = FeeParam{ApricotPhase5BaseFeeChangeDenominator, FeeActivationApricotPhase5}
+		fc.MaxBaseFee = FeeParam{nil, FeeActivationApricotPhase5}
+		fc.BlockGasCostStep = FeeParam{ApricotPhase5BlockGasCostStep, FeeActivationApricotPhase5}
+	}
+	return fc
+}
+
+// blockGasCost returns the block gas cost of a block at [timestamp] with
+// [parent], selected by [fc]. [fc] must be selected at or after Apricot
+// Phase 4.
+func (fc FeeConfig) blockGasCost(parent *types.Header, timestamp uint64) *big.Int {
+	return calcBlockGasCost(
+		fc.TargetBlockRate.Value.Uint64(),
+		fc.MinBlockGasCost.Value,
+		fc.MaxBlockGasCost.Value,
+		fc.BlockGasCostStep.Value,
+		parent.BlockGasCost,
+		parent.Time, timestamp,
+	)
+}
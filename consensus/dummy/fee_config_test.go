@@ -0,0 +1,155 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package dummy
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// TestFeeConfigAt checks the fee parameters selected on both sides of each
+// fork, and that the base fee and block gas cost computed by the engine at
+// these timestamps apply them.
+func TestFeeConfigAt(t *testing.T) {
+	config := *params.TestApricotPhase2Config
+	config.ApricotPhase3BlockTimestamp = big.NewInt(10)
+	config.ApricotPhase4BlockTimestamp = big.NewInt(20)
+	config.ApricotPhase5BlockTimestamp = big.NewInt(30)
+
+	tests := []struct {
+		timestamp        uint64
+		targetGas        FeeParam
+		denominator      FeeParam
+		minBaseFee       FeeParam
+		maxBaseFee       FeeParam
+		blockGasFee      FeeParam
+		blockGasCostStep FeeParam
+	}{
+		{timestamp: 9},
+		{
+			timestamp:   10,
+			targetGas:   FeeParam{new(big.Int).SetUint64(params.ApricotPhase3TargetGas), FeeActivationApricotPhase3},
+			denominator: FeeParam{ApricotPhase4BaseFeeChangeDenominator, FeeActivationApricotPhase3},
+			minBaseFee:  FeeParam{ApricotPhase3MinBaseFee, FeeActivationApricotPhase3},
+			maxBaseFee:  FeeParam{ApricotPhase3MaxBaseFee, FeeActivationApricotPhase3},
+			blockGasFee: FeeParam{new(big.Int).SetUint64(ApricotPhase3BlockGasFee), FeeActivationApricotPhase3},
+		},
+		{
+			timestamp:   19,
+			targetGas:   FeeParam{new(big.Int).SetUint64(params.ApricotPhase3TargetGas), FeeActivationApricotPhase3},
+			denominator: FeeParam{ApricotPhase4BaseFeeChangeDenominator, FeeActivationApricotPhase3},
+			minBaseFee:  FeeParam{ApricotPhase3MinBaseFee, FeeActivationApricotPhase3},
+			maxBaseFee:  FeeParam{ApricotPhase3MaxBaseFee, FeeActivationApricotPhase3},
+			blockGasFee: FeeParam{new(big.Int).SetUint64(ApricotPhase3BlockGasFee), FeeActivationApricotPhase3},
+		},
+		{
+			timestamp:        20,
+			targetGas:        FeeParam{new(big.Int).SetUint64(params.ApricotPhase3TargetGas), FeeActivationApricotPhase3},
+			denominator:      FeeParam{ApricotPhase4BaseFeeChangeDenominator, FeeActivationApricotPhase3},
+			minBaseFee:       FeeParam{ApricotPhase4MinBaseFee, FeeActivationApricotPhase4},
+			maxBaseFee:       FeeParam{ApricotPhase4MaxBaseFee, FeeActivationApricotPhase4},
+			blockGasFee:      FeeParam{nil, FeeActivationApricotPhase4},
+			blockGasCostStep: FeeParam{ApricotPhase4BlockGasCostStep, FeeActivationApricotPhase4},
+		},
+		{
+			timestamp:        29,
+			targetGas:        FeeParam{new(big.Int).SetUint64(params.ApricotPhase3TargetGas), FeeActivationApricotPhase3},
+			denominator:      FeeParam{ApricotPhase4BaseFeeChangeDenominator, FeeActivationApricotPhase3},
+			minBaseFee:       FeeParam{ApricotPhase4MinBaseFee, FeeActivationApricotPhase4},
+			maxBaseFee:       FeeParam{ApricotPhase4MaxBaseFee, FeeActivationApricotPhase4},
+			blockGasFee:      FeeParam{nil, FeeActivationApricotPhase4},
+			blockGasCostStep: FeeParam{ApricotPhase4BlockGasCostStep, FeeActivationApricotPhase4},
+		},
+		{
+			timestamp:        30,
+			targetGas:        FeeParam{new(big.Int).SetUint64(params.ApricotPhase5TargetGas), FeeActivationApricotPhase5},
+			denominator:      FeeParam{ApricotPhase5BaseFeeChangeDenominator, FeeActivationApricotPhase5},
+			minBaseFee:       FeeParam{ApricotPhase4MinBaseFee, FeeActivationApricotPhase4},
+			maxBaseFee:       FeeParam{nil, FeeActivationApricotPhase5},
+			blockGasFee:      FeeParam{nil, FeeActivationApricotPhase4},
+			blockGasCostStep: FeeParam{ApricotPhase5BlockGasCostStep, FeeActivationApricotPhase5},
+		},
+	}
+	for _, test := range tests {
+		fc := FeeConfigAt(&config, test.timestamp)
+		for _, param := range []struct {
+			name          string
+			got, expected FeeParam
+		}{
+			{"targetGas", fc.TargetGas, test.targetGas},
+			{"baseFeeChangeDenominator", fc.BaseFeeChangeDenominator, test.denominator},
+			{"minBaseFee", fc.MinBaseFee, test.minBaseFee},
+			{"maxBaseFee", fc.MaxBaseFee, test.maxBaseFee},
+			{"blockGasFee", fc.BlockGasFee, test.blockGasFee},
+			{"blockGasCostStep", fc.BlockGasCostStep, test.blockGasCostStep},
+		} {
+			if !equalFeeParams(param.got, param.expected) {
+				t.Fatalf("Expected %s at %d to be %v, found %v", param.name, test.timestamp, param.expected, param.got)
+			}
+		}
+
+		if minBaseFee := MinBaseFee(&config, test.timestamp); !equalBigs(minBaseFee, fc.MinBaseFee.Value) {
+			t.Fatalf("Expected the min base fee at %d to be %d, found %d", test.timestamp, fc.MinBaseFee.Value, minBaseFee)
+		}
+		if fc.TargetGas.Value == nil {
+			continue
+		}
+
+		// The base fee of the child of a block at [test.timestamp] decreases
+		// by the selected denominator, within the selected bounds
+		parent := &types.Header{
+			Number:  common.Big1,
+			Time:    test.timestamp,
+			Extra:   make([]byte, params.ApricotPhase3ExtraDataSize),
+			BaseFee: new(big.Int).Mul(ApricotPhase4MaxBaseFee, common.Big2),
+		}
+		if fc.BlockGasCostStep.Value != nil {
+			parent.BlockGasCost = common.Big0
+		}
+		addedGas := new(big.Int)
+		if fc.BlockGasFee.Value != nil {
+			addedGas.Set(fc.BlockGasFee.Value)
+		}
+		delta := new(big.Int).Mul(parent.BaseFee, new(big.Int).Sub(fc.TargetGas.Value, addedGas))
+		delta.Div(delta, fc.TargetGas.Value)
+		delta.Div(delta, fc.BaseFeeChangeDenominator.Value)
+		expected := selectBigWithinBounds(fc.MinBaseFee.Value, new(big.Int).Sub(parent.BaseFee, delta), fc.MaxBaseFee.Value)
+		if _, baseFee, err := CalcBaseFee(&config, parent, test.timestamp); err != nil {
+			t.Fatal(err)
+		} else if baseFee.Cmp(expected) != 0 {
+			t.Fatalf("Expected the base fee of the child of a block at %d to be %d, found %d", test.timestamp, expected, baseFee)
+		}
+		// Even if the child crosses a fork, its base fee is bounded by the
+		// parameters selected at the timestamp of its parent
+		parent.BaseFee = common.Big1
+		if _, baseFee, err := CalcBaseFee(&config, parent, test.timestamp+1_000); err != nil {
+			t.Fatal(err)
+		} else if baseFee.Cmp(fc.MinBaseFee.Value) != 0 {
+			t.Fatalf("Expected the base fee of the child of a block at %d to be bounded by %d, found %d", test.timestamp, fc.MinBaseFee.Value, baseFee)
+		}
+
+		if fc.BlockGasCostStep.Value == nil {
+			continue
+		}
+		expectedBlockGasCost := new(big.Int).Mul(test.blockGasCostStep.Value, new(big.Int).SetUint64(ApricotPhase4TargetBlockRate))
+		if blockGasCost := fc.blockGasCost(parent, test.timestamp); blockGasCost.Cmp(expectedBlockGasCost) != 0 {
+			t.Fatalf("Expected the block gas cost at %d to be %d, found %d", test.timestamp, expectedBlockGasCost, blockGasCost)
+		}
+	}
+}
+
+func equalFeeParams(a, b FeeParam) bool {
+	return a.Activation == b.Activation && equalBigs(a.Value, b.Value)
+}
+
+func equalBigs(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
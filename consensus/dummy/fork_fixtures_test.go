@@ -0,0 +1,252 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package dummy
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// scheduledGasLimit is the gas limit set by the gas limit schedule of the
+// fork fixtures.
+const scheduledGasLimit = 15_000_000
+
+// feeFork is a scheduled fork changing the fee rules of the headers.
+type feeFork struct {
+	name string
+	// activation returns the timestamp of the fork in [config], or nil if it
+	// is not scheduled
+	activation func(config *params.ChainConfig) *big.Int
+	// schedule schedules the fork in [config] at [timestamp]
+	schedule func(config *params.ChainConfig, timestamp *big.Int)
+}
+
+// timestampFork returns the fork activated at the timestamp [field] of the
+// chain config.
+func timestampFork(name string, field func(config *params.ChainConfig) **big.Int) feeFork {
+	return feeFork{
+		name:       name,
+		activation: func(config *params.ChainConfig) *big.Int { return *field(config) },
+		schedule:   func(config *params.ChainConfig, timestamp *big.Int) { *field(config) = timestamp },
+	}
+}
+
+// feeForks are the scheduled forks changing the fee rules of the headers.
+// Declaring a fork here is enough for the fork fixtures to cover its
+// activation.
+var feeForks = []feeFork{
+	timestampFork("ApricotPhase3", func(config *params.ChainConfig) **big.Int { return &config.ApricotPhase3BlockTimestamp }),
+	timestampFork("ApricotPhase4", func(config *params.ChainConfig) **big.Int { return &config.ApricotPhase4BlockTimestamp }),
+	timestampFork("ApricotPhase5", func(config *params.ChainConfig) **big.Int { return &config.ApricotPhase5BlockTimestamp }),
+	timestampFork("DynamicFeeOnly", func(config *params.ChainConfig) **big.Int { return &config.DynamicFeeOnlyBlockTimestamp }),
+	{
+		name: "GasLimitSchedule",
+		activation: func(config *params.ChainConfig) *big.Int {
+			if len(config.GasLimitSchedule) == 0 {
+				return nil
+			}
+			return config.GasLimitSchedule[0].Timestamp
+		},
+		schedule: func(config *params.ChainConfig, timestamp *big.Int) {
+			config.GasLimitSchedule = []params.GasLimitScheduleEntry{{Timestamp: timestamp, GasLimit: scheduledGasLimit}}
+		},
+	},
+}
+
+// feeForksConfig returns a copy of [config] with the fee forks scheduled
+// [spacing] seconds apart, from [spacing].
+func feeForksConfig(config params.ChainConfig, spacing uint64) *params.ChainConfig {
+	for i, fork := range feeForks {
+		fork.schedule(&config, new(big.Int).SetUint64(uint64(i+1)*spacing))
+	}
+	return &config
+}
+
+// feeBoundary is the activation of a fee fork in a fixture chain, between
+// [headers][index-1] and [headers][index].
+type feeBoundary struct {
+	fork  string
+	index int
+}
+
+// feeFixtures is a deterministic chain of headers crossing the activation of
+// each fee fork scheduled by [config], with their fee fields computed as the
+// engine does.
+type feeFixtures struct {
+	config *params.ChainConfig
+	// headers[0] is the genesis, each header is the parent of the next
+	headers    []*types.Header
+	boundaries []feeBoundary
+}
+
+// invalidFeeHeader is a header of a fixture chain with a fee field made
+// invalid, for negative tests.
+type invalidFeeHeader struct {
+	name           string
+	parent, header *types.Header
+}
+
+// newFeeFixtures returns the fixtures of the fee forks scheduled by [config],
+// with two headers on each side of each activation.
+func newFeeFixtures(t *testing.T, config *params.ChainConfig) *feeFixtures {
+	t.Helper()
+
+	type activation struct {
+		fork      string
+		timestamp uint64
+	}
+	var activations []activation
+	for _, fork := range feeForks {
+		if timestamp := fork.activation(config); timestamp != nil && timestamp.Sign() > 0 {
+			activations = append(activations, activation{fork.name, timestamp.Uint64()})
+		}
+	}
+	sort.SliceStable(activations, func(i, j int) bool { return activations[i].timestamp < activations[j].timestamp })
+
+	f := &feeFixtures{
+		config:  config,
+		headers: []*types.Header{{Number: new(big.Int), GasLimit: gasLimitAt(config, 0, params.ApricotPhase1GasLimit)}},
+	}
+	for _, activation := range activations {
+		for _, timestamp := range []uint64{activation.timestamp - 2, activation.timestamp - 1, activation.timestamp, activation.timestamp + 1} {
+			parent := f.headers[len(f.headers)-1]
+			if timestamp <= parent.Time {
+				continue
+			}
+			if timestamp == activation.timestamp {
+				f.boundaries = append(f.boundaries, feeBoundary{activation.fork, len(f.headers)})
+			}
+			f.headers = append(f.headers, f.nextHeader(t, parent, timestamp))
+		}
+	}
+	return f
+}
+
+// gasLimitAt returns the gas limit of a header at [timestamp] with a parent
+// gas limit of [parentGasLimit].
+func gasLimitAt(config *params.ChainConfig, timestamp uint64, parentGasLimit uint64) uint64 {
+	if gasLimit, ok := config.FixedGasLimit(new(big.Int).SetUint64(timestamp)); ok {
+		return gasLimit
+	}
+	return parentGasLimit
+}
+
+// nextHeader returns the child of [parent] at [timestamp], with the gas
+// limit, the base fee, the rollup window and the block gas cost required by
+// the rules active at [timestamp].
+func (f *feeFixtures) nextHeader(t *testing.T, parent *types.Header, timestamp uint64) *types.Header {
+	t.Helper()
+
+	number := new(big.Int).Add(parent.Number, big.NewInt(1))
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     number,
+		Time:       timestamp,
+		GasLimit:   gasLimitAt(f.config, timestamp, parent.GasLimit),
+	}
+	// A deterministic gas usage, varying from block to block
+	header.GasUsed = (number.Uint64() * 1_000_000) % header.GasLimit
+
+	bigTimestamp := new(big.Int).SetUint64(timestamp)
+	if f.config.IsApricotPhase3(bigTimestamp) {
+		extra, baseFee, err := CalcBaseFee(f.config, parent, timestamp)
+		if err != nil {
+			t.Fatalf("Failed to calculate the base fee of block %d: %s", number, err)
+		}
+		header.Extra, header.BaseFee = extra, baseFee
+	}
+	if f.config.IsApricotPhase4(bigTimestamp) {
+		header.BlockGasCost = FeeConfigAt(f.config, timestamp).blockGasCost(parent, timestamp)
+		header.ExtDataGasUsed = new(big.Int)
+	}
+	return header
+}
+
+// invalidVariants returns the headers on both sides of each activation with
+// a wrong base fee, a wrong block gas cost, a wrong gas limit, or a rollup
+// window or a gas limit of the other side of the boundary.
+func (f *feeFixtures) invalidVariants() []invalidFeeHeader {
+	var variants []invalidFeeHeader
+	for _, b := range f.boundaries {
+		// The last header before and the first header at the activation
+		for i, side := range []string{"before", "at"} {
+			index := b.index - 1 + i
+			if index == 0 {
+				continue
+			}
+			parent, header := f.headers[index-1], f.headers[index]
+			other := f.headers[b.index-i]
+			name := b.fork + " " + side + " activation: "
+
+			wrongBaseFee := types.CopyHeader(header)
+			if wrongBaseFee.BaseFee != nil {
+				wrongBaseFee.BaseFee = new(big.Int).Add(wrongBaseFee.BaseFee, big.NewInt(1))
+			} else {
+				wrongBaseFee.BaseFee = big.NewInt(1)
+			}
+			variants = append(variants, invalidFeeHeader{name + "wrong base fee", parent, wrongBaseFee})
+
+			wrongBlockGasCost := types.CopyHeader(header)
+			if wrongBlockGasCost.BlockGasCost != nil {
+				wrongBlockGasCost.BlockGasCost = new(big.Int).Add(wrongBlockGasCost.BlockGasCost, big.NewInt(1))
+			} else {
+				wrongBlockGasCost.BlockGasCost = new(big.Int)
+			}
+			variants = append(variants, invalidFeeHeader{name + "wrong block gas cost", parent, wrongBlockGasCost})
+
+			if _, ok := f.config.FixedGasLimit(new(big.Int).SetUint64(header.Time)); ok {
+				wrongGasLimit := types.CopyHeader(header)
+				wrongGasLimit.GasLimit++
+				variants = append(variants, invalidFeeHeader{name + "wrong gas limit", parent, wrongGasLimit})
+				if other.GasLimit != header.GasLimit {
+					otherGasLimit := types.CopyHeader(header)
+					otherGasLimit.GasLimit = other.GasLimit
+					variants = append(variants, invalidFeeHeader{name + "gas limit of the other side", parent, otherGasLimit})
+				}
+			}
+
+			if header.BaseFee != nil {
+				// The rollup window of the parent, not rolled to the header, or
+				// missing if the parent is before Apricot Phase 3
+				staleExtra := types.CopyHeader(header)
+				staleExtra.Extra = parent.Extra
+				if !bytes.Equal(staleExtra.Extra, header.Extra) {
+					variants = append(variants, invalidFeeHeader{name + "stale extra format", parent, staleExtra})
+				}
+			}
+		}
+	}
+	return variants
+}
+
+// TestFeeFixtures checks that the fixtures cross each scheduled activation
+// with headers on both sides of it, with the fee fields of their side.
+func TestFeeFixtures(t *testing.T) {
+	config := feeForksConfig(*params.TestApricotPhase2Config, 10)
+	f := newFeeFixtures(t, config)
+	if len(f.boundaries) != len(feeForks) {
+		t.Fatalf("Expected a boundary for each of the %d fee forks, found %d", len(feeForks), len(f.boundaries))
+	}
+	for i, b := range f.boundaries {
+		activation := feeForks[i].activation(config).Uint64()
+		before, at := f.headers[b.index-1], f.headers[b.index]
+		if b.fork != feeForks[i].name || before.Time >= activation || at.Time != activation {
+			t.Fatalf("Expected block %d to be the first at the %s activation at %d, found %s at %d after %d", b.index, feeForks[i].name, activation, b.fork, at.Time, before.Time)
+		}
+	}
+	for i, header := range f.headers[1:] {
+		if header.ParentHash != f.headers[i].Hash() {
+			t.Fatalf("Expected block %d to be the child of block %d", header.Number, i)
+		}
+	}
+	// The fixtures are deterministic
+	if again := newFeeFixtures(t, config); again.headers[len(again.headers)-1].Hash() != f.headers[len(f.headers)-1].Hash() {
+		t.Fatal("Expected the fixtures to be deterministic")
+	}
+}
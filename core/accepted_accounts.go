@@ -0,0 +1,23 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// acceptedAccountsCacheLimit is the number of recently accepted blocks whose
+// touched accounts are kept.
+const acceptedAccountsCacheLimit = 32
+
+// AcceptedAccounts returns the hashes of the accounts modified or deleted by
+// the accepted block [hash], or false if they are not known, as the snapshot
+// is disabled or the block was accepted too long ago.
+func (bc *BlockChain) AcceptedAccounts(hash common.Hash) ([]common.Hash, bool) {
+	accounts, ok := bc.acceptedAccounts.Get(hash)
+	if !ok {
+		return nil, false
+	}
+	return accounts.([]common.Hash), true
+}
@@ -0,0 +1,309 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+const (
+	// defaultAcceptedIndicesQueueLimit is the default number of accepted
+	// blocks whose indices may be queued before Accept waits for the writer.
+	defaultAcceptedIndicesQueueLimit = 64
+
+	// acceptedIndicesRetryLimit is the number of accepted blocks whose failed
+	// writes are retried with the next blocks. Beyond it, the indices of the
+	// accepted blocks are no longer staged or written until the restart.
+	acceptedIndicesRetryLimit = 1024
+)
+
+var (
+	// acceptedIndicesTipKey holds the hash of the last accepted block whose
+	// indices are written, the watermark of the writer.
+	acceptedIndicesTipKey = []byte("accepted_indices_tip")
+
+	errAcceptedIndicesDeferred = errors.New("indices of the accepted blocks deferred to the restart")
+
+	acceptedIndicesQueueGauge = metrics.NewRegisteredGauge("chain/accepted_indices/queue", nil)
+	acceptedIndicesRetryGauge = metrics.NewRegisteredGauge("chain/accepted_indices/retry", nil)
+)
+
+// stagedTx is a tx of an accepted block whose lookup entry is not written yet.
+type stagedTx struct {
+	tx     *types.Transaction
+	lookup *rawdb.LegacyTxLookupEntry
+}
+
+// acceptedIndices writes the tx lookup entries of the accepted blocks, and
+// delivers their accepted events, in the background and in the order the
+// blocks are accepted, so that Accept only waits for the writes required by
+// consensus. The txs of the queued blocks are staged in memory until their
+// lookup entries are written, so that they are served as soon as Accept
+// returns.
+//
+// The hash of the last block written is stored with its lookup entries as the
+// tip of the writer, so that the entries of the blocks queued at an unclean
+// shutdown are written again from the block data at startup. Failed writes are
+// retried with the next blocks, up to [acceptedIndicesRetryLimit] blocks, and
+// reported by AcceptedIndicesErr until a write succeeds.
+type acceptedIndices struct {
+	queue chan *types.Block
+	done  chan struct{}
+
+	// [closeLock] guards [closed], so that no block is queued once [queue] is
+	// closed, and [lock] the txs staged and the tip.
+	closeLock sync.Mutex
+	closed    bool
+	lock      sync.RWMutex
+	staged    map[common.Hash]stagedTx
+	tip       *types.Block
+	written   *sync.Cond
+	err       error // Error of the last write, nil once a write succeeds
+}
+
+// startAcceptedIndices starts the writer of the indices of the blocks accepted
+// after [lastAccepted], whose indices must be written.
+func (bc *BlockChain) startAcceptedIndices(lastAccepted *types.Block) {
+	idx := &acceptedIndices{
+		queue:  make(chan *types.Block, withDefault(bc.cacheConfig.AcceptedIndicesQueueLimit, defaultAcceptedIndicesQueueLimit)),
+		done:   make(chan struct{}),
+		staged: make(map[common.Hash]stagedTx),
+		tip:    lastAccepted,
+	}
+	idx.written = sync.NewCond(&idx.lock)
+	bc.acceptedIndices = idx
+	go bc.writeAcceptedIndices()
+}
+
+// queueAcceptedIndices stages the txs of the accepted [block] and queues the
+// write of its indices, waiting for the writer if the queue is full.
+func (bc *BlockChain) queueAcceptedIndices(block *types.Block) error {
+	idx := bc.acceptedIndices
+	idx.closeLock.Lock()
+	defer idx.closeLock.Unlock()
+	if idx.closed {
+		return fmt.Errorf("cannot queue the indices of block %s after the chain stopped", block.Hash())
+	}
+
+	// The txs are not staged once the indices are deferred to the restart
+	idx.lock.Lock()
+	if !errors.Is(idx.err, errAcceptedIndicesDeferred) {
+		for i, tx := range block.Transactions() {
+			idx.staged[tx.Hash()] = stagedTx{
+				tx:     tx,
+				lookup: &rawdb.LegacyTxLookupEntry{BlockHash: block.Hash(), BlockIndex: block.NumberU64(), Index: uint64(i)},
+			}
+		}
+	}
+	idx.lock.Unlock()
+
+	acceptedIndicesQueueGauge.Inc(1)
+	idx.queue <- block
+	return nil
+}
+
+// writeAcceptedIndices writes the indices of the queued blocks until the queue
+// is closed.
+func (bc *BlockChain) writeAcceptedIndices() {
+	idx := bc.acceptedIndices
+	defer close(idx.done)
+
+	// [retried] holds the blocks whose write failed, written again with the
+	// next block so that the stored tip never skips their indices
+	var (
+		retried  []*types.Block
+		deferred bool
+	)
+	for block := range idx.queue {
+		acceptedIndicesQueueGauge.Dec(1)
+
+		var err error
+		if !deferred {
+			retried = append(retried, block)
+			if err = bc.writeIndicesBatch(retried); err == nil {
+				idx.lock.Lock()
+				for _, written := range retried {
+					for _, tx := range written.Transactions() {
+						delete(idx.staged, tx.Hash())
+					}
+				}
+				idx.lock.Unlock()
+				retried = retried[:0]
+			} else if len(retried) >= acceptedIndicesRetryLimit {
+				// Stop staging the txs, which would grow without bound, and
+				// leave the indices to the repair at startup
+				log.Error("Failed to write the indices of the accepted blocks, deferring them to the restart", "blocks", len(retried), "number", block.Number(), "hash", block.Hash(), "err", err)
+				err = fmt.Errorf("%w: %v", errAcceptedIndicesDeferred, err)
+				deferred = true
+				retried = nil
+				idx.lock.Lock()
+				idx.staged = make(map[common.Hash]stagedTx)
+				idx.err = err
+				idx.lock.Unlock()
+			} else {
+				log.Error("Failed to write the indices of the accepted block, retrying with the next block", "number", block.Number(), "hash", block.Hash(), "pending", len(retried), "err", err)
+			}
+			acceptedIndicesRetryGauge.Update(int64(len(retried)))
+		}
+
+		// Fetch block logs
+		logs := bc.gatherBlockLogs(block.Hash(), block.NumberU64(), false)
+
+		// Update accepted feeds
+		bc.chainAcceptedFeed.Send(ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
+		if len(logs) > 0 {
+			bc.logsAcceptedFeed.Send(logs)
+		}
+		if len(block.Transactions()) != 0 {
+			bc.txAcceptedFeed.Send(NewTxsEvent{block.Transactions()})
+			bc.txIncludedFeed.Send(IncludedTxsEvent{Block: block, Phase: TxAccepted})
+		}
+
+		idx.lock.Lock()
+		idx.tip = block
+		if !deferred {
+			idx.err = err
+		}
+		idx.written.Broadcast()
+		idx.lock.Unlock()
+	}
+}
+
+// writeIndicesBatch writes the tx lookup entries of [blocks] and stores the
+// last one as the tip of the writer.
+func (bc *BlockChain) writeIndicesBatch(blocks []*types.Block) error {
+	batch := bc.db.NewBatch()
+	for _, block := range blocks {
+		rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	}
+	if err := batch.Put(acceptedIndicesTipKey, blocks[len(blocks)-1].Hash().Bytes()); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// StopAcceptedIndices writes the indices of the queued blocks and stops the
+// writer, after which no block can be accepted. It may be called before Stop,
+// which calls it again. Returns the error of the last write, if it failed, in
+// which case the indices not written are repaired at startup.
+func (bc *BlockChain) StopAcceptedIndices() error {
+	idx := bc.acceptedIndices
+	idx.closeLock.Lock()
+	if !idx.closed {
+		idx.closed = true
+		close(idx.queue)
+	}
+	idx.closeLock.Unlock()
+	<-idx.done
+	return bc.AcceptedIndicesErr()
+}
+
+// AcceptedIndicesErr returns the error of the last write of the indices of
+// the accepted blocks, or nil if it succeeded.
+func (bc *BlockChain) AcceptedIndicesErr() error {
+	idx := bc.acceptedIndices
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return idx.err
+}
+
+// stagedTransaction returns the tx [hash] of an accepted block whose lookup
+// entry is not written yet, if any.
+func (bc *BlockChain) stagedTransaction(hash common.Hash) (stagedTx, bool) {
+	idx := bc.acceptedIndices
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	staged, ok := idx.staged[hash]
+	return staged, ok
+}
+
+// AcceptedIndicesTip returns the last accepted block whose indices are
+// written and whose accepted events are delivered.
+func (bc *BlockChain) AcceptedIndicesTip() *types.Block {
+	idx := bc.acceptedIndices
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return idx.tip
+}
+
+// WaitAcceptedIndices waits until the indices of the accepted blocks up to
+// [number] are written and their accepted events delivered. [number] must be
+// accepted.
+func (bc *BlockChain) WaitAcceptedIndices(number uint64) {
+	idx := bc.acceptedIndices
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for idx.tip.NumberU64() < number {
+		idx.written.Wait()
+	}
+}
+
+// repairAcceptedIndices writes the indices of the blocks accepted up to
+// [lastAccepted] that were queued but not written before the last shutdown.
+func (bc *BlockChain) repairAcceptedIndices(lastAccepted *types.Block) error {
+	has, err := bc.db.Has(acceptedIndicesTipKey)
+	if err != nil {
+		return fmt.Errorf("unable to determine if the accepted indices tip is stored: %w", err)
+	}
+	if !has {
+		// The indices were written by Accept before the tip was stored, or no
+		// block was accepted yet
+		return bc.db.Put(acceptedIndicesTipKey, lastAccepted.Hash().Bytes())
+	}
+	tipHash, err := bc.db.Get(acceptedIndicesTipKey)
+	if err != nil {
+		return fmt.Errorf("failed to read the accepted indices tip: %w", err)
+	}
+	tip := common.BytesToHash(tipHash)
+	if tip == lastAccepted.Hash() {
+		return nil
+	}
+
+	// Walk back from [lastAccepted], as the canonical chain may be ahead of it.
+	// The tip is only moved once the last batch is written.
+	batch := bc.db.NewBatch()
+	block := lastAccepted
+	var repaired int
+	for block.Hash() != tip {
+		rawdb.WriteTxLookupEntriesByBlock(batch, block)
+		repaired++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return fmt.Errorf("failed to write the repaired accepted indices: %w", err)
+			}
+			batch.Reset()
+		}
+		// The tip is not an ancestor if the accepted blocks were replaced, as
+		// by a state snapshot restore, which leaves no block to repair below
+		// the ones held
+		parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		if block.NumberU64() == 0 || parent == nil {
+			log.Warn("Accepted indices tip is not an ancestor of the last accepted block", "tip", tip, "lastAccepted", lastAccepted.Hash(), "repairedFrom", block.NumberU64())
+			break
+		}
+		block = parent
+	}
+	if err := batch.Put(acceptedIndicesTipKey, lastAccepted.Hash().Bytes()); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write the repaired accepted indices: %w", err)
+	}
+	log.Info("Wrote the indices of the accepted blocks queued at shutdown", "blocks", repaired, "lastAccepted", lastAccepted.NumberU64())
+	return nil
+}
@@ -0,0 +1,270 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+)
+
+var (
+	acceptedIndicesTestKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	acceptedIndicesTestAddr    = crypto.PubkeyToAddress(acceptedIndicesTestKey.PublicKey)
+	acceptedIndicesTestGenesis = &Genesis{
+		Config: &params.ChainConfig{HomesteadBlock: new(big.Int)},
+		Alloc:  GenesisAlloc{acceptedIndicesTestAddr: {Balance: big.NewInt(1000000000)}},
+	}
+)
+
+// acceptedIndicesTestChain generates [numBlocks] blocks of [txs] transfers
+// each.
+func acceptedIndicesTestChain(t *testing.T, numBlocks, txs int) []*types.Block {
+	genDB := rawdb.NewMemoryDatabase()
+	genesis := acceptedIndicesTestGenesis.MustCommit(genDB)
+	chain, _, err := GenerateChain(acceptedIndicesTestGenesis.Config, genesis, dummy.NewFaker(), genDB, numBlocks, 10, func(i int, gen *BlockGen) {
+		for j := 0; j < txs; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(acceptedIndicesTestAddr), common.Address{1}, big.NewInt(1), params.TxGas, new(big.Int), nil), types.HomesteadSigner{}, acceptedIndicesTestKey)
+			gen.AddTx(tx)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// newAcceptedIndicesTestBlockChain returns a chain at the genesis of the tests
+// if [lastAccepted] is empty, or else restarted at [lastAccepted].
+func newAcceptedIndicesTestBlockChain(t *testing.T, db ethdb.Database, lastAccepted common.Hash) *BlockChain {
+	if lastAccepted == (common.Hash{}) {
+		acceptedIndicesTestGenesis.MustCommit(db)
+	}
+	blockchain, err := NewBlockChain(db, DefaultCacheConfig, acceptedIndicesTestGenesis.Config, dummy.NewFaker(), vm.Config{}, lastAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blockchain
+}
+
+// checkTransactions fails unless the txs of [blocks] are served by [blockchain]
+// at their position.
+func checkTransactions(t *testing.T, blockchain *BlockChain, blocks []*types.Block) {
+	for _, block := range blocks {
+		for i, tx := range block.Transactions() {
+			found, blockHash, number, index := blockchain.GetTransaction(tx.Hash())
+			if found == nil || found.Hash() != tx.Hash() || blockHash != block.Hash() || number != block.NumberU64() || index != uint64(i) {
+				t.Fatalf("Expected tx %s at index %d of block %d, found %v in block %d at index %d", tx.Hash(), i, block.NumberU64(), found, number, index)
+			}
+			if lookup := blockchain.GetTransactionLookup(tx.Hash()); lookup == nil || lookup.BlockHash != block.Hash() || lookup.Index != uint64(i) {
+				t.Fatalf("Expected the lookup of tx %s to be index %d of block %d, found %+v", tx.Hash(), i, block.NumberU64(), lookup)
+			}
+		}
+	}
+}
+
+func TestAcceptedIndicesCrashRecovery(t *testing.T) {
+	chain := acceptedIndicesTestChain(t, 6, 3)
+	db := rawdb.NewMemoryDatabase()
+	blockchain := newAcceptedIndicesTestBlockChain(t, db, common.Hash{})
+
+	// Stall the writer on the accepted event of the second block, so that
+	// the indices of the next blocks stay queued
+	stalled := make(chan ChainEvent)
+	sub := blockchain.SubscribeChainAcceptedEvent(stalled)
+	for _, block := range chain {
+		if err := blockchain.InsertBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockchain.Accept(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if event := <-stalled; event.Hash != chain[0].Hash() {
+		t.Fatalf("Expected the accepted event of block 1 first, found block %d", event.Block.NumberU64())
+	}
+	if tip := blockchain.AcceptedIndicesTip(); tip.NumberU64() > 1 {
+		t.Fatalf("Expected the writer to stall before block 2, found tip %d", tip.NumberU64())
+	}
+	// The txs of the queued blocks are served from memory
+	checkTransactions(t, blockchain, chain)
+	for _, block := range chain[2:] {
+		for _, tx := range block.Transactions() {
+			if rawdb.ReadTxLookupEntry(db, tx.Hash()) != nil {
+				t.Fatalf("Expected the lookup of tx %s not to be written", tx.Hash())
+			}
+		}
+	}
+
+	// Restart on the database left by the stalled chain, as after a crash
+	restarted := newAcceptedIndicesTestBlockChain(t, db, chain[len(chain)-1].Hash())
+	defer restarted.Stop()
+	if tip := restarted.AcceptedIndicesTip(); tip.Hash() != chain[len(chain)-1].Hash() {
+		t.Fatalf("Expected the restarted writer to start at the last accepted block, found tip %d", tip.NumberU64())
+	}
+	for _, block := range chain {
+		for _, tx := range block.Transactions() {
+			if number := rawdb.ReadTxLookupEntry(db, tx.Hash()); number == nil || *number != block.NumberU64() {
+				t.Fatalf("Expected the lookup of tx %s to be repaired as block %d, found %v", tx.Hash(), block.NumberU64(), number)
+			}
+		}
+	}
+	checkTransactions(t, restarted, chain)
+
+	sub.Unsubscribe()
+	blockchain.Stop()
+}
+
+func TestAcceptedIndicesConcurrentReads(t *testing.T) {
+	chain := acceptedIndicesTestChain(t, 32, 4)
+	cacheConfig := *DefaultCacheConfig
+	cacheConfig.AcceptedIndicesQueueLimit = 4
+	db := rawdb.NewMemoryDatabase()
+	acceptedIndicesTestGenesis.MustCommit(db)
+	blockchain, err := NewBlockChain(db, &cacheConfig, acceptedIndicesTestGenesis.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	// Readers look up the txs of the blocks accepted so far while the writer
+	// moves them from memory to the database
+	var (
+		accepted int32
+		stop     = make(chan struct{})
+		wg       sync.WaitGroup
+		errs     = make(chan string, 4)
+	)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, block := range chain[:atomic.LoadInt32(&accepted)] {
+					for i, tx := range block.Transactions() {
+						if found, blockHash, _, index := blockchain.GetTransaction(tx.Hash()); found == nil || blockHash != block.Hash() || index != uint64(i) {
+							errs <- "missing tx " + tx.Hash().Hex()
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+	for i, block := range chain {
+		if err := blockchain.InsertBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockchain.Accept(block); err != nil {
+			t.Fatal(err)
+		}
+		atomic.StoreInt32(&accepted, int32(i+1))
+	}
+	blockchain.WaitAcceptedIndices(chain[len(chain)-1].NumberU64())
+	close(stop)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+	checkTransactions(t, blockchain, chain)
+	if staged := len(blockchain.acceptedIndices.staged); staged != 0 {
+		t.Fatalf("Expected no tx to stay staged once written, found %d", staged)
+	}
+}
+
+// tipFailingDB fails the writes of the batches storing the accepted indices
+// tip while [fail] is set.
+type tipFailingDB struct {
+	ethdb.Database
+	fail int32
+}
+
+func (db *tipFailingDB) NewBatch() ethdb.Batch {
+	return &tipFailingBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+type tipFailingBatch struct {
+	ethdb.Batch
+	db  *tipFailingDB
+	tip bool
+}
+
+func (b *tipFailingBatch) Put(key []byte, value []byte) error {
+	if bytes.Equal(key, acceptedIndicesTipKey) {
+		b.tip = true
+	}
+	return b.Batch.Put(key, value)
+}
+
+func (b *tipFailingBatch) Write() error {
+	if b.tip && atomic.LoadInt32(&b.db.fail) == 1 {
+		return errors.New("injected write failure")
+	}
+	return b.Batch.Write()
+}
+
+func TestAcceptedIndicesWriteRetry(t *testing.T) {
+	chain := acceptedIndicesTestChain(t, 4, 2)
+	db := &tipFailingDB{Database: rawdb.NewMemoryDatabase(), fail: 1}
+	blockchain := newAcceptedIndicesTestBlockChain(t, db, common.Hash{})
+	defer blockchain.Stop()
+
+	// The failed writes are reported, and their txs served from memory
+	for _, block := range chain[:3] {
+		if err := blockchain.InsertBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockchain.Accept(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blockchain.WaitAcceptedIndices(3)
+	if err := blockchain.AcceptedIndicesErr(); err == nil {
+		t.Fatal("Expected the failed writes to be reported")
+	}
+	checkTransactions(t, blockchain, chain[:3])
+
+	// The next write retries the failed ones
+	atomic.StoreInt32(&db.fail, 0)
+	if err := blockchain.InsertBlock(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.Accept(chain[3]); err != nil {
+		t.Fatal(err)
+	}
+	blockchain.WaitAcceptedIndices(4)
+	if err := blockchain.AcceptedIndicesErr(); err != nil {
+		t.Fatalf("Expected the retried writes to succeed, found %v", err)
+	}
+	for _, block := range chain {
+		for _, tx := range block.Transactions() {
+			if number := rawdb.ReadTxLookupEntry(db, tx.Hash()); number == nil || *number != block.NumberU64() {
+				t.Fatalf("Expected the lookup of tx %s to be written as block %d, found %v", tx.Hash(), block.NumberU64(), number)
+			}
+			if _, ok := blockchain.stagedTransaction(tx.Hash()); ok {
+				t.Fatalf("Expected tx %s to be unstaged once written", tx.Hash())
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// cachedAccount is the balance and nonce of an account.
+type cachedAccount struct {
+	balance *big.Int
+	nonce   uint64
+}
+
+// accountCache caches the balance and nonce of accounts in the state of the
+// last accepted block, keyed by account hash. When a block is accepted, the
+// entries of the accounts it touched are dropped and the others are carried
+// over to the state root of the accepted block.
+type accountCache struct {
+	lock    sync.Mutex
+	root    common.Hash // State root the entries are valid at
+	entries *meteredCache
+}
+
+func newAccountCache(size int, root common.Hash) *accountCache {
+	return &accountCache{
+		root:    root,
+		entries: newMeteredCache(size, accountCacheMeters),
+	}
+}
+
+// get returns the cached account with [hash] at [root]. The returned boolean
+// is false if [root] is not the root the cache is valid at, in which case
+// nothing can be served from or added to the cache for [root].
+func (c *accountCache) get(root, hash common.Hash) (*cachedAccount, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if root != c.root {
+		return nil, false
+	}
+	account, ok := c.entries.Get(hash)
+	if !ok {
+		return nil, true
+	}
+	return account.(*cachedAccount), true
+}
+
+// add caches [account] as the account with [hash] at [root], unless the
+// cache moved past [root] in the meantime.
+func (c *accountCache) add(root, hash common.Hash, account *cachedAccount) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if root == c.root {
+		c.entries.Add(hash, account)
+	}
+}
+
+// accept moves the cache from [parentRoot] to [root], the state root of an
+// accepted block that touched the accounts with hashes [touched]. If
+// [touched] is unknown (nil), or the cache is not at [parentRoot], all the
+// entries are dropped.
+func (c *accountCache) accept(parentRoot, root common.Hash, touched []common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if touched == nil || c.root != parentRoot {
+		c.entries.Purge()
+	} else {
+		for _, hash := range touched {
+			c.entries.Remove(hash)
+		}
+	}
+	c.root = root
+}
@@ -0,0 +1,110 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestAccountCacheAcrossAccept(t *testing.T) {
+	var (
+		key1, _ = crypto.GenerateKey()
+		key2, _ = crypto.GenerateKey()
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2   = crypto.PubkeyToAddress(key2.PublicKey)
+		addr3   = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		funds   = big.NewInt(params.Ether)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{addr1: {Balance: funds}, addr2: {Balance: funds}},
+		}
+		signer = types.LatestSigner(params.TestChainConfig)
+		engine = dummy.NewETHFaker()
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+	// Block 1 sends from [addr1] to [addr3], block 2 from [addr2] to [addr3]
+	blocks, _, err := GenerateChain(gspec.Config, genesis, engine, gendb, 2, 10, func(i int, b *BlockGen) {
+		key := []*ecdsa.PrivateKey{key1, key2}[i]
+		tx, err := types.SignTx(types.NewTransaction(0, addr3, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	chain, err := NewBlockChain(db, &CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		Pruning:           true,
+		SnapshotLimit:     256,
+		AccountCacheLimit: 16,
+	}, gspec.Config, engine, vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkAccounts verifies that the cache serves the balances and nonces of
+	// the state of [block], and nothing for [stale].
+	checkAccounts := func(block *types.Block, stale common.Hash) {
+		t.Helper()
+		statedb, err := chain.StateAt(block.Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range []common.Address{addr1, addr2, addr3} {
+			balance, nonce, ok := chain.CachedAccount(block.Root(), addr)
+			if !ok {
+				t.Fatalf("expected account %s to be served at block %d", addr, block.NumberU64())
+			}
+			if balance.Cmp(statedb.GetBalance(addr)) != 0 || nonce != statedb.GetNonce(addr) {
+				t.Fatalf("account %s at block %d: expected balance %d nonce %d, found balance %d nonce %d", addr, block.NumberU64(), statedb.GetBalance(addr), statedb.GetNonce(addr), balance, nonce)
+			}
+		}
+		if _, _, ok := chain.CachedAccount(stale, addr1); ok {
+			t.Fatalf("expected nothing to be served at root %s", stale)
+		}
+	}
+	cached := func(addr common.Address) bool {
+		return chain.accountCache.entries.Contains(crypto.Keccak256Hash(addr.Bytes()))
+	}
+
+	// Only the state of the last accepted block is served
+	checkAccounts(chain.genesisBlock, blocks[0].Root())
+
+	if err := chain.Accept(blocks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if cached(addr1) || cached(addr3) || !cached(addr2) {
+		t.Fatal("expected only the accounts touched by block 1 to be evicted")
+	}
+	checkAccounts(blocks[0], genesis.Root())
+
+	if err := chain.Accept(blocks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if !cached(addr1) || cached(addr2) || cached(addr3) {
+		t.Fatal("expected only the accounts touched by block 2 to be evicted")
+	}
+	checkAccounts(blocks[1], blocks[0].Root())
+}
@@ -28,6 +28,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -38,6 +39,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	lru "github.com/hashicorp/golang-lru"
@@ -95,6 +97,10 @@ const (
 	// statsReportLimit is the time limit during import and export after which we
 	// always print out progress. This avoids the user wondering what's going on.
 	statsReportLimit = 8 * time.Second
+
+	// exportReadAhead is the number of blocks ExportAcceptedRange reads ahead
+	// of its callback.
+	exportReadAhead = 64
 )
 
 // CacheConfig contains the configuration values for the trie caching/pruning
@@ -107,6 +113,33 @@ type CacheConfig struct {
 	SnapshotAsync  bool // Generate snapshot tree async
 	SnapshotVerify bool // Verify generated snapshots
 	Preimages      bool // Whether to store preimage of trie key to the disk
+
+	HeaderCacheLimit   int // Number of recent headers to cache (0 uses the default)
+	BodyCacheLimit     int // Number of recent block bodies to cache (0 uses the default)
+	ReceiptsCacheLimit int // Number of recent block receipts to cache (0 uses the default)
+	BlockCacheLimit    int // Number of recent blocks to cache (0 uses the default)
+
+	AccountCacheLimit int // Number of accounts to cache at the last accepted root (0 disables the cache, requires snapshots)
+
+	ForensicDumpDir   string // Directory to write forensic dumps of blocks failing with a root mismatch to (empty disables the dumps)
+	ForensicDumpLimit int    // Number of forensic dumps to keep, removing the oldest ones first (0 keeps every dump)
+
+	StorageCommitWorkers int // Number of goroutines hashing and committing the modified storage tries of a block (0 uses GOMAXPROCS)
+
+	HotKeysLimit         int           // Number of state keys accessed the most by a block warmed up before processing its children (0 disables the warm-up)
+	HotKeysWarmupTimeout time.Duration // Maximum duration of the warm-up of the hot keys of a block (0 uses the default)
+
+	StorageGrowthTracking bool // Whether to record the storage slots and code added by each account in the processed blocks
+
+	AcceptedIndicesQueueLimit int // Number of accepted blocks whose tx lookup entries and accepted events may be queued before Accept waits (0 uses the default)
+}
+
+// withDefault returns [limit], or [def] if [limit] is not positive.
+func withDefault(limit, def int) int {
+	if limit <= 0 {
+		return def
+	}
+	return limit
 }
 
 var DefaultCacheConfig = &CacheConfig{
@@ -115,6 +148,13 @@ var DefaultCacheConfig = &CacheConfig{
 	SnapshotLimit:  256,
 }
 
+// ChainHeads is a snapshot of the heads of the chain, replaced as a whole so
+// that the blocks it holds are read together.
+type ChainHeads struct {
+	Preferred    *types.Block // Current head of the canonical chain
+	LastAccepted *types.Block // Prevents reorgs past this height
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -147,6 +187,7 @@ type BlockChain struct {
 	logsAcceptedFeed  event.Feed
 	blockProcFeed     event.Feed
 	txAcceptedFeed    event.Feed
+	txIncludedFeed    event.Feed
 	scope             event.SubscriptionScope
 	genesisBlock      *types.Block
 
@@ -154,15 +195,20 @@ type BlockChain struct {
 	// Readers don't need to take it, they can just read the database.
 	chainmu sync.RWMutex
 
-	currentBlock atomic.Value // Current head of the block chain
+	// Snapshot of the current head and the last accepted block, read without
+	// [chainmu] and replaced under it
+	heads atomic.Value // *ChainHeads
 
 	stateCache    state.Database // State database to reuse between imports (contains state cache)
 	stateManager  TrieWriter
-	bodyCache     *lru.Cache // Cache for the most recent block bodies
-	receiptsCache *lru.Cache // Cache for the most recent receipts per block
-	blockCache    *lru.Cache // Cache for the most recent entire blocks
+	bodyCache     chainCache // Cache for the most recent block bodies
+	receiptsCache chainCache // Cache for the most recent receipts per block
+	blockCache    chainCache // Cache for the most recent entire blocks
 	txLookupCache *lru.Cache // Cache for the most recent transaction lookup data.
 
+	// Cache for the balance and nonce of accounts at the last accepted root, nil if disabled
+	accountCache *accountCache
+
 	quit    chan struct{}  // blockchain quit channel
 	wg      sync.WaitGroup // chain processing wait group for shutting down
 	running int32          // 0 if chain is running, 1 when stopped
@@ -174,8 +220,14 @@ type BlockChain struct {
 	vmConfig   vm.Config
 
 	badBlocks *lru.Cache // Bad block cache
+	hotKeys   *lru.Cache // Hot state keys of the recently processed blocks, by block hash
+
+	storageGrowth *lru.Cache // Storage growth of the recently processed blocks, by block hash
 
-	lastAccepted *types.Block // Prevents reorgs past this height
+	acceptedAccounts *lru.Cache // Hashes of the accounts touched by the recently accepted blocks, by block hash
+
+	// Writer of the tx lookup entries of the accepted blocks
+	acceptedIndices *acceptedIndices
 
 	senderCacher *TxSenderCacher
 }
@@ -190,11 +242,14 @@ func NewBlockChain(
 	if cacheConfig == nil {
 		return nil, errCacheConfigNotSpecified
 	}
-	bodyCache, _ := lru.New(bodyCacheLimit)
-	receiptsCache, _ := lru.New(receiptsCacheLimit)
-	blockCache, _ := lru.New(blockCacheLimit)
+	bodyCache := newMeteredCache(withDefault(cacheConfig.BodyCacheLimit, bodyCacheLimit), bodyCacheMeters)
+	receiptsCache := newSecondChanceCache(withDefault(cacheConfig.ReceiptsCacheLimit, receiptsCacheLimit), receiptsCacheMeters)
+	blockCache := newMeteredCache(withDefault(cacheConfig.BlockCacheLimit, blockCacheLimit), blockCacheMeters)
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	badBlocks, _ := lru.New(badBlockLimit)
+	hotKeys, _ := lru.New(hotKeysCacheLimit)
+	storageGrowth, _ := lru.New(storageGrowthCacheLimit)
+	acceptedAccounts, _ := lru.New(acceptedAccountsCacheLimit)
 
 	bc := &BlockChain{
 		chainConfig: chainConfig,
@@ -212,14 +267,18 @@ func NewBlockChain(
 		engine:        engine,
 		vmConfig:      vmConfig,
 		badBlocks:     badBlocks,
+		hotKeys:       hotKeys,
+		storageGrowth: storageGrowth,
 		senderCacher:  newTxSenderCacher(runtime.NumCPU()),
+
+		acceptedAccounts: acceptedAccounts,
 	}
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
 	bc.prefetcher = newStatePrefetcher(chainConfig, bc, engine)
 	bc.processor = NewStateProcessor(chainConfig, bc, engine)
 
 	var err error
-	bc.hc, err = NewHeaderChain(db, chainConfig, engine)
+	bc.hc, err = NewHeaderChain(db, chainConfig, withDefault(cacheConfig.HeaderCacheLimit, headerCacheLimit), engine)
 	if err != nil {
 		return nil, err
 	}
@@ -228,8 +287,7 @@ func NewBlockChain(
 		return nil, ErrNoGenesis
 	}
 
-	var nilBlock *types.Block
-	bc.currentBlock.Store(nilBlock)
+	bc.heads.Store(&ChainHeads{})
 
 	// Create the state manager
 	bc.stateManager = NewTrieWriter(bc.stateCache.TrieDB(), cacheConfig)
@@ -237,6 +295,10 @@ func NewBlockChain(
 	if err := bc.loadLastState(lastAcceptedHash); err != nil {
 		return nil, err
 	}
+	if err := bc.repairAcceptedIndices(bc.LastAcceptedBlock()); err != nil {
+		return nil, err
+	}
+	bc.startAcceptedIndices(bc.LastAcceptedBlock())
 
 	// Make sure the state associated with the block is available
 	head := bc.CurrentBlock()
@@ -256,6 +318,9 @@ func NewBlockChain(
 			log.Error("failed to initialize snapshots", "headHash", head.Hash(), "headRoot", head.Root(), "err", err, "async", async)
 		}
 	}
+	if bc.snaps != nil && cacheConfig.AccountCacheLimit > 0 {
+		bc.accountCache = newAccountCache(cacheConfig.AccountCacheLimit, bc.LastAcceptedBlock().Root())
+	}
 
 	return bc, nil
 }
@@ -284,7 +349,7 @@ func (bc *BlockChain) loadLastState(lastAcceptedHash common.Hash) error {
 		return fmt.Errorf("could not load head block %s", head.Hex())
 	}
 	// Everything seems to be fine, set as the head block
-	bc.currentBlock.Store(currentBlock)
+	bc.setHeads(currentBlock, nil)
 
 	// Restore the last known head header
 	currentHeader := currentBlock.Header()
@@ -299,10 +364,11 @@ func (bc *BlockChain) loadLastState(lastAcceptedHash common.Hash) error {
 	log.Info("Loaded most recent local full block", "number", currentBlock.Number(), "hash", currentBlock.Hash(), "age", common.PrettyAge(time.Unix(int64(currentBlock.Time()), 0)))
 
 	// Otherwise, set the last accepted block and perform a re-org.
-	bc.lastAccepted = bc.GetBlockByHash(lastAcceptedHash)
-	if bc.lastAccepted == nil {
+	lastAccepted := bc.GetBlockByHash(lastAcceptedHash)
+	if lastAccepted == nil {
 		return fmt.Errorf("could not load last accepted block")
 	}
+	bc.setHeads(currentBlock, lastAccepted)
 
 	// Remove all processing transaction indices leftover from when we used to
 	// write transaction indices as soon as a block was verified.
@@ -311,25 +377,25 @@ func (bc *BlockChain) loadLastState(lastAcceptedHash common.Hash) error {
 		return fmt.Errorf("unable to determine if transaction indices removed: %w", err)
 	}
 	if !indicesRemoved {
-		indicesRemoved, err := bc.removeIndices(currentBlock.NumberU64(), bc.lastAccepted.NumberU64())
+		indicesRemoved, err := bc.removeIndices(currentBlock.NumberU64(), lastAccepted.NumberU64())
 		if err != nil {
 			return err
 		}
-		if err := bc.db.Put(removeTxIndicesKey, bc.lastAccepted.Number().Bytes()); err != nil {
+		if err := bc.db.Put(removeTxIndicesKey, lastAccepted.Number().Bytes()); err != nil {
 			return fmt.Errorf("unable to mark indices removed: %w", err)
 		}
-		log.Debug("removed processing transaction indices", "count", indicesRemoved, "currentBlock", currentBlock.NumberU64(), "lastAccepted", bc.lastAccepted.NumberU64())
+		log.Debug("removed processing transaction indices", "count", indicesRemoved, "currentBlock", currentBlock.NumberU64(), "lastAccepted", lastAccepted.NumberU64())
 	}
 
 	// This ensures that the head block is updated to the last accepted block on startup
-	if err := bc.setPreference(bc.lastAccepted); err != nil {
+	if err := bc.setPreference(lastAccepted); err != nil {
 		return fmt.Errorf("failed to set preference to last accepted block while loading last state: %w", err)
 	}
 
 	// reprocessState is necessary to ensure that the last accepted state is
 	// available. The state may not be available if it was not committed due
 	// to an unclean shutdown.
-	return bc.reprocessState(bc.lastAccepted, 2*commitInterval)
+	return bc.reprocessState(lastAccepted, 2*commitInterval)
 }
 
 // removeIndices removes all transaction lookup entries for the transactions contained in the canonical chain
@@ -363,8 +429,7 @@ func (bc *BlockChain) loadGenesisState() error {
 	bc.writeHeadBlock(bc.genesisBlock)
 
 	// Last update all in-memory chain markers
-	bc.lastAccepted = bc.genesisBlock
-	bc.currentBlock.Store(bc.genesisBlock)
+	bc.setHeads(bc.genesisBlock, bc.genesisBlock)
 	bc.hc.SetGenesis(bc.genesisBlock.Header())
 	bc.hc.SetCurrentHeader(bc.genesisBlock.Header())
 	return nil
@@ -402,6 +467,74 @@ func (bc *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
 	return nil
 }
 
+// exportedBlock is a block read by ExportAcceptedRange.
+type exportedBlock struct {
+	header   *types.Header
+	body     *types.Body
+	receipts types.Receipts
+	err      error
+}
+
+// ExportAcceptedRange passes the header, body and receipts of the accepted
+// blocks from [from] to [to], inclusive, to [fn] in order, reading up to
+// exportReadAhead blocks from the database ahead of [fn]. The export stops at
+// the first error of [fn], which is returned, or with ctx.Err() once [ctx] is
+// done. [to] cannot be above the last accepted block.
+func (bc *BlockChain) ExportAcceptedRange(ctx context.Context, from, to uint64, fn func(header *types.Header, body *types.Body, receipts types.Receipts) error) error {
+	if from > to {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", from, to)
+	}
+	if lastAccepted := bc.LastAcceptedBlock().NumberU64(); to > lastAccepted {
+		return fmt.Errorf("export failed: last (%d) is above the last accepted block (%d)", to, lastAccepted)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blocks := make(chan *exportedBlock, exportReadAhead)
+	go func() {
+		defer close(blocks)
+		for number := from; number <= to; number++ {
+			block := &exportedBlock{}
+			hash := rawdb.ReadCanonicalHash(bc.db, number)
+			block.header = rawdb.ReadHeader(bc.db, hash, number)
+			block.body = rawdb.ReadBody(bc.db, hash, number)
+			if block.header == nil || block.body == nil {
+				block.err = fmt.Errorf("export failed on #%d: not found", number)
+			} else {
+				block.receipts = rawdb.ReadReceipts(bc.db, hash, number, bc.chainConfig)
+			}
+			select {
+			case blocks <- block:
+			case <-ctx.Done():
+				return
+			}
+			if block.err != nil {
+				return
+			}
+		}
+	}()
+
+	start, reported, exported := time.Now(), time.Now(), 0
+	for block := range blocks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if block.err != nil {
+			return block.err
+		}
+		if err := fn(block.header, block.body, block.receipts); err != nil {
+			return err
+		}
+		exported++
+		if time.Since(reported) >= statsReportLimit {
+			log.Info("Exporting accepted blocks", "exported", exported, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	// The reader stops early only if [ctx] is done
+	return ctx.Err()
+}
+
 // writeHeadBlock injects a new head block into the current block chain. This method
 // assumes that the block is indeed a true head. It will also reset the head
 // header to this very same block if they are older or if they are on a different side chain.
@@ -422,7 +555,16 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	}
 	// Update all in-memory chain markers in the last step
 	bc.hc.SetCurrentHeader(block.Header())
-	bc.currentBlock.Store(block)
+	bc.setHeads(block, bc.LastAcceptedBlock())
+}
+
+// setHeads replaces the snapshot of the heads of the chain with [preferred]
+// and [lastAccepted].
+//
+// Assumes [bc.chainmu] is held by the caller, or that the chain is being
+// loaded.
+func (bc *BlockChain) setHeads(preferred, lastAccepted *types.Block) {
+	bc.heads.Store(&ChainHeads{Preferred: preferred, LastAccepted: lastAccepted})
 }
 
 // ValidateCanonicalChain confirms a canonical chain is well-formed.
@@ -467,7 +609,7 @@ func (bc *BlockChain) ValidateCanonicalChain() error {
 		// Transactions are only indexed beneath the last accepted block, so we only check
 		// that the transactions have been indexed, if we are checking below the last accepted
 		// block.
-		if current.NumberU64() <= bc.lastAccepted.NumberU64() {
+		if current.NumberU64() <= bc.LastAcceptedBlock().NumberU64() {
 			// Ensure that all of the transactions have been stored correctly in the canonical
 			// chain
 			for txIndex, tx := range txs {
@@ -532,6 +674,11 @@ func (bc *BlockChain) Stop() {
 	close(bc.quit)
 	bc.wg.Wait()
 
+	// Write the indices of the accepted blocks before the state is shut down
+	if err := bc.StopAcceptedIndices(); err != nil {
+		log.Error("Failed to write the indices of the accepted blocks, repairing them at startup", "err", err)
+	}
+
 	if err := bc.stateManager.Shutdown(); err != nil {
 		log.Error("Failed to Shutdown state manager", "err", err)
 	}
@@ -585,10 +732,15 @@ func (bc *BlockChain) setPreference(block *types.Block) error {
 
 // LastAcceptedBlock returns the last block to be marked as accepted.
 func (bc *BlockChain) LastAcceptedBlock() *types.Block {
-	bc.chainmu.Lock()
-	defer bc.chainmu.Unlock()
+	return bc.Heads().LastAccepted
+}
 
-	return bc.lastAccepted
+// Heads returns a consistent snapshot of the preferred and last accepted
+// blocks, without waiting for the blocks being inserted or accepted. It should
+// be used instead of separate calls to CurrentBlock and LastAcceptedBlock when
+// both are needed.
+func (bc *BlockChain) Heads() ChainHeads {
+	return *bc.heads.Load().(*ChainHeads)
 }
 
 // Accept sets a minimum height at which no reorg can pass. Additionally,
@@ -601,11 +753,12 @@ func (bc *BlockChain) Accept(block *types.Block) error {
 	defer bc.chainmu.Unlock()
 
 	// The parent of [block] must be the last accepted block.
-	if bc.lastAccepted.Hash() != block.ParentHash() {
+	lastAccepted := bc.LastAcceptedBlock()
+	if lastAccepted.Hash() != block.ParentHash() {
 		return fmt.Errorf(
 			"expected accepted block to have parent %s:%d but got %s:%d",
-			bc.lastAccepted.Hash().Hex(),
-			bc.lastAccepted.NumberU64(),
+			lastAccepted.Hash().Hex(),
+			lastAccepted.NumberU64(),
 			block.ParentHash().Hex(),
 			block.NumberU64()-1,
 		)
@@ -621,7 +774,7 @@ func (bc *BlockChain) Accept(block *types.Block) error {
 		}
 	}
 
-	bc.lastAccepted = block
+	parentRoot := lastAccepted.Root()
 
 	// Abort snapshot generation before pruning anything from trie database
 	// (could occur in AcceptTrie)
@@ -634,6 +787,19 @@ func (bc *BlockChain) Accept(block *types.Block) error {
 		return fmt.Errorf("unable to accept trie: %w", err)
 	}
 
+	// Move the account cache to the accepted root, using the accounts touched
+	// by the block as recorded in its snapshot diff layer.
+	var touched []common.Hash
+	if bc.snaps != nil {
+		var known bool
+		if touched, known = bc.snaps.AccountList(block.Hash()); known {
+			bc.acceptedAccounts.Add(block.Hash(), touched)
+		}
+	}
+	if bc.accountCache != nil {
+		bc.accountCache.accept(parentRoot, block.Root(), touched)
+	}
+
 	// Flatten the entire snap Trie to disk
 	if bc.snaps != nil {
 		if err := bc.snaps.Flatten(block.Hash()); err != nil {
@@ -641,26 +807,13 @@ func (bc *BlockChain) Accept(block *types.Block) error {
 		}
 	}
 
-	// Update transaction lookup index
-	batch := bc.db.NewBatch()
-	rawdb.WriteTxLookupEntriesByBlock(batch, block)
-	if err := batch.Write(); err != nil {
-		return fmt.Errorf("failed to write tx lookup entries batch: %w", err)
-	}
-
-	// Fetch block logs
-	logs := bc.gatherBlockLogs(block.Hash(), block.NumberU64(), false)
+	// Publish [block] as the last accepted block only once its state is
+	// accepted, so that readers of the heads never observe it before
+	bc.setHeads(bc.CurrentBlock(), block)
 
-	// Update accepted feeds
-	bc.chainAcceptedFeed.Send(ChainEvent{Block: block, Hash: block.Hash(), Logs: logs})
-	if len(logs) > 0 {
-		bc.logsAcceptedFeed.Send(logs)
-	}
-	if len(block.Transactions()) != 0 {
-		bc.txAcceptedFeed.Send(NewTxsEvent{block.Transactions()})
-	}
-
-	return nil
+	// Update the transaction lookup index and the accepted feeds in the
+	// background, as consensus does not depend on them
+	return bc.queueAcceptedIndices(block)
 }
 
 func (bc *BlockChain) Reject(block *types.Block) error {
@@ -685,6 +838,10 @@ func (bc *BlockChain) Reject(block *types.Block) error {
 		return fmt.Errorf("failed to write delete block batch: %w", err)
 	}
 
+	if len(block.Transactions()) != 0 {
+		bc.txIncludedFeed.Send(IncludedTxsEvent{Block: block, Phase: TxRejected})
+	}
+
 	return nil
 }
 
@@ -695,12 +852,20 @@ func (bc *BlockChain) writeKnownBlock(block *types.Block) error {
 	defer bc.wg.Done()
 
 	current := bc.CurrentBlock()
-	if block.ParentHash() != current.Hash() {
+	reorg := block.ParentHash() != current.Hash()
+	if reorg {
 		if err := bc.reorg(current, block); err != nil {
 			return err
 		}
 	}
 	bc.writeHeadBlock(block)
+	// The logs of a block processed while it did not extend the head were
+	// not fired, so they are fired once it does.
+	if !reorg {
+		if logs := bc.reorgLogs(types.Blocks{block}, false); len(logs) > 0 {
+			bc.logsFeed.Send(logs)
+		}
+	}
 	return nil
 }
 
@@ -936,12 +1101,21 @@ func (bc *BlockChain) insertBlock(block *types.Block, writes bool) error {
 
 	// Enable prefetching to pull in trie node paths while processing transactions
 	statedb.StartPrefetcher("chain")
+	statedb.SetStorageWorkers(withDefault(bc.cacheConfig.StorageCommitWorkers, runtime.GOMAXPROCS(0)))
 	activeState = statedb
 
+	// Warm up the state accessed the most by the parent block while the block
+	// is processed, as consecutive blocks access overlapping state
+	stopWarmup := bc.startHotKeysWarmup(block.ParentHash(), statedb)
+	if bc.cacheConfig.StorageGrowthTracking {
+		statedb.TrackStorageGrowth()
+	}
+
 	// If we have a followup block, run that against the current state to pre-cache
 	// transactions and probabilistically some of the account/storage trie nodes.
 	// Process block using the parent state as reference point
 	receipts, logs, usedGas, err := bc.processor.Process(block, parent, statedb, bc.vmConfig)
+	stopWarmup()
 	if err != nil {
 		bc.reportBlock(block, receipts, err)
 		return err
@@ -950,8 +1124,14 @@ func (bc *BlockChain) insertBlock(block *types.Block, writes bool) error {
 	// Validate the state using the default validator
 	if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
 		bc.reportBlock(block, receipts, err)
+		if bc.cacheConfig.ForensicDumpDir != "" && (errors.Is(err, ErrInvalidMerkleRoot) || errors.Is(err, ErrInvalidReceiptRoot)) {
+			if dumpErr := bc.writeForensicDump(block, parent, statedb, receipts, usedGas, err); dumpErr != nil {
+				log.Error("Failed to write forensic dump of bad block", "number", block.Number(), "hash", block.Hash(), "err", dumpErr)
+			}
+		}
 		return err
 	}
+	bc.recordHotKeys(block.Hash(), statedb)
 
 	// If [writes] are disabled, skip [writeBlockWithState] so that we do not write the block
 	// or the state trie to disk.
@@ -967,6 +1147,13 @@ func (bc *BlockChain) insertBlock(block *types.Block, writes bool) error {
 	if err := bc.writeBlockAndSetHead(block, receipts, logs, statedb); err != nil {
 		return err
 	}
+	// The growth is complete once the state is committed, which writes the code
+	if growth := statedb.StorageGrowth(); growth != nil {
+		bc.storageGrowth.Add(block.Hash(), growth)
+	}
+	if len(block.Transactions()) != 0 {
+		bc.txIncludedFeed.Send(IncludedTxsEvent{Block: block, Phase: TxVerified})
+	}
 	log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(),
 		"parentHash", block.ParentHash(),
 		"uncles", len(block.Uncles()), "txs", len(block.Transactions()), "gas", block.GasUsed(),
@@ -977,30 +1164,43 @@ func (bc *BlockChain) insertBlock(block *types.Block, writes bool) error {
 	return nil
 }
 
-// collectLogs collects the logs that were generated or removed during
-// the processing of the block that corresponds with the given hash.
-// These logs are later announced as deleted or reborn.
-func (bc *BlockChain) collectLogs(hash common.Hash, removed bool) []*types.Log {
-	number := bc.hc.GetBlockNumber(hash)
-	if number == nil {
-		return nil
-	}
-	return bc.gatherBlockLogs(hash, *number, removed)
+// logKey identifies a log in the reorg notifications.
+type logKey struct {
+	blockHash common.Hash
+	txIndex   uint
+	index     uint
 }
 
-// mergeLogs returns a merged log slice with specified sort order.
-func mergeLogs(logs [][]*types.Log, reverse bool) []*types.Log {
-	var ret []*types.Log
-	if reverse {
-		for i := len(logs) - 1; i >= 0; i-- {
-			ret = append(ret, logs[i]...)
+// reorgLogs returns the logs stored in the receipts of [blocks], ordered by
+// descending height, deduplicated by block hash, tx index and log index. If
+// [removed] is true, the logs are flagged as removed and returned in
+// descending order, the order in which they are undone. Otherwise, they are
+// returned in ascending order, the order in which they are applied.
+func (bc *BlockChain) reorgLogs(blocks types.Blocks, removed bool) []*types.Log {
+	var (
+		logs []*types.Log
+		seen = make(map[logKey]struct{})
+	)
+	for i := range blocks {
+		block := blocks[len(blocks)-1-i]
+		if removed {
+			block = blocks[i]
 		}
-	} else {
-		for i := 0; i < len(logs); i++ {
-			ret = append(ret, logs[i]...)
+		blockLogs := bc.gatherBlockLogs(block.Hash(), block.NumberU64(), removed)
+		for j := range blockLogs {
+			l := blockLogs[j]
+			if removed {
+				l = blockLogs[len(blockLogs)-1-j]
+			}
+			key := logKey{blockHash: l.BlockHash, txIndex: l.TxIndex, index: l.Index}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			logs = append(logs, l)
 		}
 	}
-	return ret
+	return logs
 }
 
 // reorg takes two blocks, an old chain and a new chain and will reconstruct the
@@ -1014,20 +1214,12 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		newChain    types.Blocks
 		oldChain    types.Blocks
 		commonBlock *types.Block
-
-		deletedLogs [][]*types.Log
-		rebirthLogs [][]*types.Log
 	)
 	// Reduce the longer chain to the same number as the shorter one
 	if oldBlock.NumberU64() > newBlock.NumberU64() {
-		// Old chain is longer, gather all transactions and logs as deleted ones
+		// Old chain is longer, gather all blocks as deleted ones
 		for ; oldBlock != nil && oldBlock.NumberU64() != newBlock.NumberU64(); oldBlock = bc.GetBlock(oldBlock.ParentHash(), oldBlock.NumberU64()-1) {
 			oldChain = append(oldChain, oldBlock)
-			// Collect deleted logs for notification
-			logs := bc.collectLogs(oldBlock.Hash(), true)
-			if len(logs) > 0 {
-				deletedLogs = append(deletedLogs, logs)
-			}
 		}
 	} else {
 		// New chain is longer, stash all blocks away for subsequent insertion
@@ -1051,12 +1243,6 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		}
 		// Remove an old block as well as stash away a new block
 		oldChain = append(oldChain, oldBlock)
-		// Collect deleted logs for notification
-		logs := bc.collectLogs(oldBlock.Hash(), true)
-		if len(logs) > 0 {
-			deletedLogs = append(deletedLogs, logs)
-		}
-
 		newChain = append(newChain, newBlock)
 
 		// Step back with both chains
@@ -1073,8 +1259,8 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	// If the commonBlock is less than the last accepted height, we return an error
 	// because performing a reorg would mean removing an accepted block from the
 	// canonical chain.
-	if commonBlock.NumberU64() < bc.lastAccepted.NumberU64() {
-		return fmt.Errorf("cannot orphan finalized block at height: %d to common block at height: %d", bc.lastAccepted.NumberU64(), commonBlock.NumberU64())
+	if lastAccepted := bc.LastAcceptedBlock(); commonBlock.NumberU64() < lastAccepted.NumberU64() {
+		return fmt.Errorf("cannot orphan finalized block at height: %d to common block at height: %d", lastAccepted.NumberU64(), commonBlock.NumberU64())
 	}
 
 	// Ensure the user sees large reorgs
@@ -1095,12 +1281,6 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	for i := len(newChain) - 1; i >= 1; i-- {
 		// Insert the block in the canonical way, re-writing history
 		bc.writeHeadBlock(newChain[i])
-
-		// Collect reborn logs due to chain reorg
-		logs := bc.collectLogs(newChain[i].Hash(), false)
-		if len(logs) > 0 {
-			rebirthLogs = append(rebirthLogs, logs)
-		}
 	}
 	// Delete any canonical number assignments above the new head
 	indexesBatch := bc.db.NewBatch()
@@ -1119,15 +1299,21 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	if err := indexesBatch.Write(); err != nil {
 		log.Crit("Failed to delete useless indexes", "err", err)
 	}
-	// If any logs need to be fired, do it now. In theory we could avoid creating
-	// this goroutine if there are no events to fire, but realistcally that only
-	// ever happens if we're reorging empty blocks, which will only happen on idle
-	// networks where performance is not an issue either way.
+	// Fire the logs of both branches from the common block, read from the
+	// stored receipts since the blocks of the new chain may never have been
+	// the head when processed. The logs feed receives all the removals of the
+	// old chain followed by the additions of the new chain, including its
+	// head written by the caller, in a single event so that their order is
+	// kept by its subscribers.
+	var (
+		deletedLogs = bc.reorgLogs(oldChain, true)
+		rebirthLogs = bc.reorgLogs(newChain, false)
+	)
 	if len(deletedLogs) > 0 {
-		bc.rmLogsFeed.Send(RemovedLogsEvent{mergeLogs(deletedLogs, true)})
+		bc.rmLogsFeed.Send(RemovedLogsEvent{deletedLogs})
 	}
-	if len(rebirthLogs) > 0 {
-		bc.logsFeed.Send(mergeLogs(rebirthLogs, false))
+	if logs := append(deletedLogs[:len(deletedLogs):len(deletedLogs)], rebirthLogs...); len(logs) > 0 {
+		bc.logsFeed.Send(logs)
 	}
 	if len(oldChain) > 0 {
 		for i := len(oldChain) - 1; i >= 0; i-- {
@@ -1203,6 +1389,47 @@ func (bc *BlockChain) RemoveRejectedBlocks(start, end uint64) error {
 	return nil
 }
 
+// CachedAccount returns the balance and nonce of [address] in the state with
+// [root] from the account cache, reading them from the snapshot on a miss.
+// The returned boolean is false if the account cannot be served this way, in
+// which case the caller must fall back to the state trie. Currently only the
+// state of the last accepted block is served.
+func (bc *BlockChain) CachedAccount(root common.Hash, address common.Address) (*big.Int, uint64, bool) {
+	if bc.accountCache == nil {
+		return nil, 0, false
+	}
+	hash := crypto.Keccak256Hash(address.Bytes())
+	account, current := bc.accountCache.get(root, hash)
+	if !current {
+		return nil, 0, false
+	}
+	if account == nil {
+		snap := bc.snaps.Snapshot(root)
+		if snap == nil {
+			return nil, 0, false
+		}
+		// Fails if the snapshot went stale or is still being generated
+		data, err := snap.Account(hash)
+		if err != nil {
+			return nil, 0, false
+		}
+		account = &cachedAccount{balance: new(big.Int)}
+		if data != nil {
+			account.balance.Set(data.Balance)
+			account.nonce = data.Nonce
+		}
+		bc.accountCache.add(root, hash, account)
+	}
+	return new(big.Int).Set(account.balance), account.nonce, true
+}
+
+// EvictReceipts removes the receipts of the block with [hash] from the
+// receipts cache, so that receipts rewritten to the database are served on
+// the next read.
+func (bc *BlockChain) EvictReceipts(hash common.Hash) {
+	bc.receiptsCache.Remove(hash)
+}
+
 // reprocessState reprocesses the state up to [block], iterating through its ancestors until
 // it reaches a block with a state committed to the database. reprocessState does not use
 // snapshots since the disk layer for snapshots will most likely be above the last committed
@@ -1345,7 +1572,7 @@ func (bc *BlockChain) CleanBlockRootsAboveLastAccepted() error {
 // may not find any blocks at this height and will not reach the previously processing blocks E and F.
 func (bc *BlockChain) gatherBlockRootsAboveLastAccepted() map[common.Hash]struct{} {
 	blockRoots := make(map[common.Hash]struct{})
-	for height := bc.lastAccepted.NumberU64() + 1; ; height++ {
+	for height := bc.LastAcceptedBlock().NumberU64() + 1; ; height++ {
 		blockHashes := rawdb.ReadAllHashes(bc.db, height)
 		// If there are no block hashes at [height], then there should be no further acceptable blocks
 		// past this point.
@@ -47,7 +47,7 @@ func (bc *BlockChain) CurrentHeader() *types.Header {
 // CurrentBlock retrieves the current head block of the canonical chain. The
 // block is retrieved from the blockchain's internal cache.
 func (bc *BlockChain) CurrentBlock() *types.Block {
-	return bc.currentBlock.Load().(*types.Block)
+	return bc.Heads().Preferred
 }
 
 // HasHeader checks if a block header is present in the database or not, caching
@@ -197,6 +197,9 @@ func (bc *BlockChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLook
 	if lookup, exist := bc.txLookupCache.Get(hash); exist {
 		return lookup.(*rawdb.LegacyTxLookupEntry)
 	}
+	if staged, ok := bc.stagedTransaction(hash); ok {
+		return staged.lookup
+	}
 	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(bc.db, hash)
 	if tx == nil {
 		return nil
@@ -206,6 +209,16 @@ func (bc *BlockChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLook
 	return lookup
 }
 
+// GetTransaction retrieves the accepted transaction [hash] with the hash, number
+// and index of its block, from the database or from the accepted blocks whose
+// lookup entries are not written yet.
+func (bc *BlockChain) GetTransaction(hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
+	if staged, ok := bc.stagedTransaction(hash); ok {
+		return staged.tx, staged.lookup.BlockHash, staged.lookup.BlockIndex, staged.lookup.Index
+	}
+	return rawdb.ReadTransaction(bc.db, hash)
+}
+
 // HasState checks if state trie is fully present in the database or not.
 func (bc *BlockChain) HasState(hash common.Hash) bool {
 	_, err := bc.stateCache.OpenTrie(hash)
@@ -278,6 +291,11 @@ func (bc *BlockChain) Processor() Processor {
 	return bc.processor
 }
 
+// Prefetcher returns the current state prefetcher.
+func (bc *BlockChain) Prefetcher() Prefetcher {
+	return bc.prefetcher
+}
+
 // StateCache returns the caching database underpinning the blockchain instance.
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
@@ -318,7 +336,9 @@ func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Su
 	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
 }
 
-// SubscribeLogsEvent registers a subscription of []*types.Log.
+// SubscribeLogsEvent registers a subscription of []*types.Log. On a reorg,
+// a single event holds the removed logs of the old chain, also sent as a
+// RemovedLogsEvent, followed by the logs of the new chain.
 func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
@@ -343,3 +363,10 @@ func (bc *BlockChain) SubscribeAcceptedLogsEvent(ch chan<- []*types.Log) event.S
 func (bc *BlockChain) SubscribeAcceptedTransactionEvent(ch chan<- NewTxsEvent) event.Subscription {
 	return bc.scope.Track(bc.txAcceptedFeed.Subscribe(ch))
 }
+
+// SubscribeIncludedTransactionEvent registers a subscription of IncludedTxsEvent,
+// which is posted as blocks containing transactions are verified, accepted, and
+// rejected.
+func (bc *BlockChain) SubscribeIncludedTransactionEvent(ch chan<- IncludedTxsEvent) event.Subscription {
+	return bc.scope.Track(bc.txIncludedFeed.Subscribe(ch))
+}
@@ -4,11 +4,15 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/zsmartex/coreth/consensus/dummy"
 	"github.com/zsmartex/coreth/core/rawdb"
 	"github.com/zsmartex/coreth/core/state"
@@ -406,3 +410,248 @@ func TestBlockChainOfflinePruningUngracefulShutdown(t *testing.T) {
 		})
 	}
 }
+
+// TestReorgLogNotifications flips the preference between two branches and
+// checks the exact sequence of logs notified, where the removals of the old
+// branch are sent in descending order before the additions of the new one.
+func TestReorgLogNotifications(t *testing.T) {
+	var (
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		genDB   = rawdb.NewMemoryDatabase()
+		chainDB = rawdb.NewMemoryDatabase()
+		// logCode emits an empty log when deployed
+		logCode = common.FromHex("0x60006000a000")
+	)
+	gspec := &Genesis{
+		Config: &params.ChainConfig{HomesteadBlock: new(big.Int)},
+		Alloc:  GenesisAlloc{addr1: {Balance: big.NewInt(1000000000)}},
+	}
+	genesis := gspec.MustCommit(genDB)
+	_ = gspec.MustCommit(chainDB)
+
+	blockchain, err := NewBlockChain(chainDB, DefaultCacheConfig, gspec.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	// Generate two branches of two blocks with two logs each, told apart by
+	// the gas limit of their txs
+	branch := func(gas uint64) []*types.Block {
+		chain, _, err := GenerateChain(gspec.Config, genesis, blockchain.engine, genDB, 2, 10, func(i int, gen *BlockGen) {
+			for j := 0; j < 2; j++ {
+				tx, _ := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), gas, new(big.Int), logCode), types.HomesteadSigner{}, key1)
+				gen.AddTx(tx)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chain
+	}
+	chainA, chainB := branch(100_000), branch(90_000)
+
+	type notification struct {
+		removed bool
+		block   common.Hash
+		txIndex uint
+		index   uint
+	}
+	// The events are buffered and read once the preference flips are done
+	logsCh := make(chan []*types.Log, 16)
+	logsSub := blockchain.SubscribeLogsEvent(logsCh)
+	defer logsSub.Unsubscribe()
+
+	var expected []notification
+	added := func(blocks ...*types.Block) {
+		for _, block := range blocks {
+			expected = append(expected, notification{false, block.Hash(), 0, 0}, notification{false, block.Hash(), 1, 1})
+		}
+	}
+	removed := func(blocks ...*types.Block) {
+		for _, block := range blocks {
+			expected = append(expected, notification{true, block.Hash(), 1, 1}, notification{true, block.Hash(), 0, 0})
+		}
+	}
+
+	// The first branch extends the head as it is inserted, the second one
+	// does not
+	for _, block := range append(chainA, chainB...) {
+		if err := blockchain.InsertBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	added(chainA...)
+
+	// Flip the preference three times, then extend the head of the last
+	// preferred block
+	steps := []struct {
+		preferred *types.Block
+		notify    func()
+	}{
+		{chainB[1], func() { removed(chainA[1], chainA[0]); added(chainB...) }},
+		{chainA[1], func() { removed(chainB[1], chainB[0]); added(chainA...) }},
+		{chainB[0], func() { removed(chainA[1], chainA[0]); added(chainB[0]) }},
+		{chainB[1], func() { added(chainB[1]) }},
+	}
+	for _, step := range steps {
+		if err := blockchain.SetPreference(step.preferred); err != nil {
+			t.Fatal(err)
+		}
+		step.notify()
+	}
+	var found []notification
+	for len(logsCh) > 0 {
+		for _, l := range <-logsCh {
+			found = append(found, notification{l.Removed, l.BlockHash, l.TxIndex, l.Index})
+		}
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d notifications, found %d: %+v", len(expected), len(found), found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Fatalf("Expected notification %d to be %+v, found %+v", i, expected[i], found[i])
+		}
+	}
+}
+
+// TestChainHeadsConcurrentReads hammers the getters of the heads of the chain
+// while blocks are inserted and accepted, and checks that each snapshot holds a
+// preferred block at or above the last accepted one, neither going backwards.
+func TestChainHeadsConcurrentReads(t *testing.T) {
+	var (
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		genDB   = rawdb.NewMemoryDatabase()
+		chainDB = rawdb.NewMemoryDatabase()
+	)
+	gspec := &Genesis{
+		Config: &params.ChainConfig{HomesteadBlock: new(big.Int)},
+		Alloc:  GenesisAlloc{addr1: {Balance: big.NewInt(1000000000)}},
+	}
+	genesis := gspec.MustCommit(genDB)
+	_ = gspec.MustCommit(chainDB)
+
+	blockchain, err := NewBlockChain(chainDB, DefaultCacheConfig, gspec.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	chain, _, err := GenerateChain(gspec.Config, genesis, blockchain.engine, genDB, 64, 10, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr1), common.Address{1}, big.NewInt(1), params.TxGas, nil, nil), types.HomesteadSigner{}, key1)
+		gen.AddTx(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		done   = make(chan struct{})
+		errs   = make(chan error, 8)
+		wg     sync.WaitGroup
+		reader = func() {
+			defer wg.Done()
+			var lastAccepted, preferred uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				heads := blockchain.Heads()
+				if heads.Preferred.NumberU64() < heads.LastAccepted.NumberU64() {
+					errs <- fmt.Errorf("preferred block %d below the last accepted block %d", heads.Preferred.NumberU64(), heads.LastAccepted.NumberU64())
+					return
+				}
+				if heads.LastAccepted.NumberU64() < lastAccepted || heads.Preferred.NumberU64() < preferred {
+					errs <- fmt.Errorf("heads went backwards from %d/%d to %d/%d", preferred, lastAccepted, heads.Preferred.NumberU64(), heads.LastAccepted.NumberU64())
+					return
+				}
+				lastAccepted, preferred = heads.LastAccepted.NumberU64(), heads.Preferred.NumberU64()
+				if blockchain.LastAcceptedBlock().NumberU64() < lastAccepted || blockchain.CurrentBlock().NumberU64() < preferred {
+					errs <- errors.New("getters went behind the snapshot")
+					return
+				}
+			}
+		}
+	)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go reader()
+	}
+	for _, block := range chain {
+		if err := blockchain.InsertBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockchain.Accept(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if heads := blockchain.Heads(); heads.LastAccepted.Hash() != chain[len(chain)-1].Hash() || heads.Preferred.Hash() != chain[len(chain)-1].Hash() {
+		t.Fatalf("Expected the heads to be the last block %s, found %s/%s", chain[len(chain)-1].Hash(), heads.Preferred.Hash(), heads.LastAccepted.Hash())
+	}
+}
+
+// BenchmarkLastAcceptedBlock reads the last accepted block in parallel while
+// [chainmu] is repeatedly held, as when blocks are inserted, without it and,
+// for comparison, under it as before the reads were lock-free.
+func BenchmarkLastAcceptedBlock(b *testing.B) {
+	gspec := &Genesis{Config: &params.ChainConfig{HomesteadBlock: new(big.Int)}}
+	chainDB := rawdb.NewMemoryDatabase()
+	_ = gspec.MustCommit(chainDB)
+	blockchain, err := NewBlockChain(chainDB, DefaultCacheConfig, gspec.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	for _, bench := range []struct {
+		name string
+		read func() *types.Block
+	}{
+		{"lock-free", blockchain.LastAcceptedBlock},
+		{"chainmu", func() *types.Block {
+			blockchain.chainmu.Lock()
+			defer blockchain.chainmu.Unlock()
+			return blockchain.Heads().LastAccepted
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			done := make(chan struct{})
+			writerDone := make(chan struct{})
+			go func() {
+				defer close(writerDone)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					blockchain.chainmu.Lock()
+					time.Sleep(50 * time.Microsecond)
+					blockchain.chainmu.Unlock()
+				}
+			}()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if bench.read() == nil {
+						b.Fatal("Expected the last accepted block")
+					}
+				}
+			})
+			b.StopTimer()
+			close(done)
+			<-writerDone
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// secondChanceGhostFactor is the number of keys, as a multiple of the cache
+// size, that a secondChanceCache remembers after a first miss.
+const secondChanceGhostFactor = 4
+
+var (
+	headerCacheMeters   = newCacheMeters("header")
+	bodyCacheMeters     = newCacheMeters("body")
+	receiptsCacheMeters = newCacheMeters("receipts")
+	blockCacheMeters    = newCacheMeters("block")
+	accountCacheMeters  = newCacheMeters("account")
+)
+
+// cacheMeters tracks the effectiveness of a single chain cache.
+type cacheMeters struct {
+	hit   metrics.Meter
+	miss  metrics.Meter
+	evict metrics.Meter
+}
+
+func newCacheMeters(name string) cacheMeters {
+	return cacheMeters{
+		hit:   metrics.NewRegisteredMeter("chain/cache/"+name+"/hit", nil),
+		miss:  metrics.NewRegisteredMeter("chain/cache/"+name+"/miss", nil),
+		evict: metrics.NewRegisteredMeter("chain/cache/"+name+"/evict", nil),
+	}
+}
+
+// chainCache is the subset of the LRU cache interface used by the
+// blockchain and header chain for headers, bodies, receipts and blocks.
+type chainCache interface {
+	Get(key interface{}) (interface{}, bool)
+	Add(key, value interface{})
+	Contains(key interface{}) bool
+	Remove(key interface{})
+	Len() int
+}
+
+// meteredCache is a plain LRU cache that reports hits, misses and
+// evictions to [meters].
+type meteredCache struct {
+	cache  *lru.Cache
+	meters cacheMeters
+}
+
+func newMeteredCache(size int, meters cacheMeters) *meteredCache {
+	cache, _ := lru.NewWithEvict(size, func(interface{}, interface{}) {
+		meters.evict.Mark(1)
+	})
+	return &meteredCache{
+		cache:  cache,
+		meters: meters,
+	}
+}
+
+func (c *meteredCache) Get(key interface{}) (interface{}, bool) {
+	value, ok := c.cache.Get(key)
+	if ok {
+		c.meters.hit.Mark(1)
+	} else {
+		c.meters.miss.Mark(1)
+	}
+	return value, ok
+}
+
+func (c *meteredCache) Add(key, value interface{}) { c.cache.Add(key, value) }
+
+func (c *meteredCache) Contains(key interface{}) bool { return c.cache.Contains(key) }
+
+func (c *meteredCache) Remove(key interface{}) { c.cache.Remove(key) }
+
+func (c *meteredCache) Len() int { return c.cache.Len() }
+
+func (c *meteredCache) Purge() { c.cache.Purge() }
+
+// secondChanceCache is an LRU cache with a second-chance admission policy.
+// Once the cache is full, a key is only admitted on its second insertion
+// while it is still remembered in the ghost list. Keys that are requested a
+// single time, such as those touched by a large range scan, therefore never
+// displace the entries that are read repeatedly.
+type secondChanceCache struct {
+	size  int
+	cache *meteredCache
+	ghost *lru.Cache // Keys that missed once and have not been admitted yet
+}
+
+func newSecondChanceCache(size int, meters cacheMeters) *secondChanceCache {
+	ghost, _ := lru.New(size * secondChanceGhostFactor)
+	return &secondChanceCache{
+		size:  size,
+		cache: newMeteredCache(size, meters),
+		ghost: ghost,
+	}
+}
+
+func (c *secondChanceCache) Get(key interface{}) (interface{}, bool) {
+	return c.cache.Get(key)
+}
+
+func (c *secondChanceCache) Add(key, value interface{}) {
+	switch {
+	case c.cache.Len() < c.size, c.cache.Contains(key):
+		// No entry is displaced, admit unconditionally.
+	case c.ghost.Contains(key):
+		c.ghost.Remove(key)
+	default:
+		c.ghost.Add(key, struct{}{})
+		return
+	}
+	c.cache.Add(key, value)
+}
+
+func (c *secondChanceCache) Contains(key interface{}) bool { return c.cache.Contains(key) }
+
+func (c *secondChanceCache) Remove(key interface{}) {
+	c.cache.Remove(key)
+	c.ghost.Remove(key)
+}
+
+func (c *secondChanceCache) Len() int { return c.cache.Len() }
@@ -0,0 +1,102 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"testing"
+)
+
+// readThrough reads [key] from [cache], inserting it on a miss as the
+// blockchain does after falling back to the database.
+func readThrough(cache chainCache, key int) bool {
+	if _, ok := cache.Get(key); ok {
+		return true
+	}
+	cache.Add(key, key)
+	return false
+}
+
+func TestChainCacheScanResistance(t *testing.T) {
+	const (
+		cacheSize = 32
+		hotSize   = 8
+		scanSize  = 1024
+	)
+	tests := []struct {
+		name       string
+		cache      chainCache
+		hotSurvive bool
+	}{
+		{
+			name:       "lru",
+			cache:      newMeteredCache(cacheSize, newCacheMeters("test/lru")),
+			hotSurvive: false,
+		},
+		{
+			name:       "second chance",
+			cache:      newSecondChanceCache(cacheSize, newCacheMeters("test/secondchance")),
+			hotSurvive: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Build up the working set used by live subscriptions
+			for round := 0; round < 2; round++ {
+				for key := 0; key < hotSize; key++ {
+					readThrough(test.cache, key)
+				}
+			}
+			// Run a single large range scan over keys that are never read again
+			for key := hotSize; key < hotSize+scanSize; key++ {
+				readThrough(test.cache, key)
+			}
+			if l := test.cache.Len(); l != cacheSize {
+				t.Fatalf("expected cache to be full (%d), found %d entries", cacheSize, l)
+			}
+			hits := 0
+			for key := 0; key < hotSize; key++ {
+				if readThrough(test.cache, key) {
+					hits++
+				}
+			}
+			switch {
+			case test.hotSurvive && hits != hotSize:
+				t.Fatalf("expected hot set to survive the scan, found %d/%d hits", hits, hotSize)
+			case !test.hotSurvive && hits != 0:
+				t.Fatalf("expected hot set to be evicted by the scan, found %d/%d hits", hits, hotSize)
+			}
+		})
+	}
+}
+
+func TestSecondChanceCacheAdmission(t *testing.T) {
+	const cacheSize = 4
+	cache := newSecondChanceCache(cacheSize, newCacheMeters("test/admission"))
+
+	// Entries are admitted directly until the cache is full
+	for key := 0; key < cacheSize; key++ {
+		cache.Add(key, key)
+	}
+	if l := cache.Len(); l != cacheSize {
+		t.Fatalf("expected %d entries, found %d", cacheSize, l)
+	}
+	// A new key is only remembered on its first insertion
+	cache.Add(cacheSize, cacheSize)
+	if cache.Contains(cacheSize) {
+		t.Fatal("expected key to be rejected on first insertion")
+	}
+	// and admitted on its second, displacing the least recently used entry
+	cache.Add(cacheSize, cacheSize)
+	if !cache.Contains(cacheSize) {
+		t.Fatal("expected key to be admitted on second insertion")
+	}
+	if cache.Contains(0) {
+		t.Fatal("expected least recently used entry to be evicted")
+	}
+	// Updating an admitted key does not require a second chance
+	cache.Add(cacheSize, -1)
+	if value, ok := cache.Get(cacheSize); !ok || value.(int) != -1 {
+		t.Fatalf("expected updated value -1, found %v", value)
+	}
+}
@@ -280,10 +280,8 @@ func makeHeader(chain consensus.ChainReader, config *params.ChainConfig, parent
 	}
 
 	timestamp := new(big.Int).SetUint64(time)
-	var gasLimit uint64
-	if config.IsApricotPhase1(timestamp) {
-		gasLimit = params.ApricotPhase1GasLimit
-	} else {
+	gasLimit, fixed := config.FixedGasLimit(timestamp)
+	if !fixed {
 		gasLimit = CalcGasLimit(parent.GasUsed(), parent.GasLimit(), parent.GasLimit(), parent.GasLimit())
 	}
 
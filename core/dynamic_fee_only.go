@@ -0,0 +1,39 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// DynamicFeeTxRequiredError is the ErrDynamicFeeTxRequired returned for a
+// transaction other than a dynamic fee transaction once the Dynamic Fee Only
+// upgrade is active.
+type DynamicFeeTxRequiredError struct {
+	Type       byte
+	Activation uint64 // timestamp of the Dynamic Fee Only upgrade
+}
+
+func (e *DynamicFeeTxRequiredError) Error() string {
+	return fmt.Sprintf("%s: type 0x%02x transactions are rejected since the Dynamic Fee Only upgrade at %s (timestamp %d), use type 0x%02x",
+		ErrDynamicFeeTxRequired, e.Type, time.Unix(int64(e.Activation), 0).UTC().Format(time.RFC3339), e.Activation, types.DynamicFeeTxType)
+}
+
+func (e *DynamicFeeTxRequiredError) Unwrap() error {
+	return ErrDynamicFeeTxRequired
+}
+
+// CheckTxType returns an error if the type of [tx] is not allowed in a block
+// at [blockTimestamp].
+func CheckTxType(config *params.ChainConfig, tx *types.Transaction, blockTimestamp uint64) error {
+	if tx.Type() == types.DynamicFeeTxType || !config.IsDynamicFeeOnly(new(big.Int).SetUint64(blockTimestamp)) {
+		return nil
+	}
+	return &DynamicFeeTxRequiredError{Type: tx.Type(), Activation: config.DynamicFeeOnlyBlockTimestamp.Uint64()}
+}
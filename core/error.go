@@ -99,6 +99,23 @@ var (
 	// the base fee of the block.
 	ErrFeeCapTooLow = errors.New("max fee per gas less than block base fee")
 
+	// ErrMaxInitCodeSizeExceeded is returned if creation transaction provides
+	// the init code bigger than the maximum init code size.
+	ErrMaxInitCodeSizeExceeded = errors.New("max initcode size exceeded")
+
+	// ErrDynamicFeeTxRequired is returned if a transaction other than a dynamic
+	// fee transaction is submitted, or included in a block, once the Dynamic
+	// Fee Only upgrade is active.
+	ErrDynamicFeeTxRequired = errors.New("dynamic fee transaction required")
+
+	// ErrInvalidReceiptRoot is returned if the root of the receipts derived by
+	// executing a block does not match the receipt root of its header.
+	ErrInvalidReceiptRoot = errors.New("invalid receipt root hash")
+
+	// ErrInvalidMerkleRoot is returned if the state root derived by executing a
+	// block does not match the state root of its header.
+	ErrInvalidMerkleRoot = errors.New("invalid merkle root")
+
 	// ErrSenderNoEOA is returned if the sender of a transaction is a contract.
 	ErrSenderNoEOA = errors.New("sender not an eoa")
 )
@@ -55,3 +55,37 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// TxInclusionPhase describes how far a block containing a set of transactions
+// has progressed through consensus.
+type TxInclusionPhase uint8
+
+const (
+	// TxVerified indicates the containing block passed verification but has
+	// not yet been decided.
+	TxVerified TxInclusionPhase = iota
+	// TxAccepted indicates the containing block was accepted.
+	TxAccepted
+	// TxRejected indicates the containing block was rejected.
+	TxRejected
+)
+
+func (p TxInclusionPhase) String() string {
+	switch p {
+	case TxVerified:
+		return "verified"
+	case TxAccepted:
+		return "accepted"
+	case TxRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// IncludedTxsEvent is posted when a block containing transactions is
+// verified, accepted, or rejected.
+type IncludedTxsEvent struct {
+	Block *types.Block
+	Phase TxInclusionPhase
+}
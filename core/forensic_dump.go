@@ -0,0 +1,203 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/trie"
+)
+
+const (
+	forensicDumpPrefix = "block-"
+	forensicDumpSuffix = ".json"
+)
+
+// ForensicDump is the bundle written for a block failing verification with a
+// state root or receipt root mismatch, holding everything needed to compare
+// its local execution against the network's.
+type ForensicDump struct {
+	Time         time.Time      `json:"time"`
+	Error        string         `json:"error"`
+	BlockHash    common.Hash    `json:"blockHash"`
+	BlockNumber  uint64         `json:"blockNumber"`
+	Block        hexutil.Bytes  `json:"block"` // RLP encoding of the block
+	ParentHeader *types.Header  `json:"parentHeader"`
+	Receipts     types.Receipts `json:"receipts"`
+
+	GasUsed      uint64      `json:"gasUsed"`
+	ReceiptsRoot common.Hash `json:"receiptsRoot"`
+	StateRoot    common.Hash `json:"stateRoot"`
+
+	// Accounts modified by the block, with their local post-values
+	Accounts map[common.Address]state.DumpAccount `json:"accounts"`
+	// Summary of the local execution of each transaction
+	Transactions []ForensicTxSummary `json:"transactions"`
+}
+
+// ForensicTxSummary summarizes the execution of a transaction of a
+// ForensicDump.
+type ForensicTxSummary struct {
+	Hash              common.Hash     `json:"hash"`
+	Type              uint8           `json:"type"`
+	To                *common.Address `json:"to"`
+	Gas               uint64          `json:"gas"`
+	Status            uint64          `json:"status"`
+	GasUsed           uint64          `json:"gasUsed"`
+	CumulativeGasUsed uint64          `json:"cumulativeGasUsed"`
+	ContractAddress   common.Address  `json:"contractAddress"`
+	Logs              int             `json:"logs"`
+}
+
+// ForensicDumpInfo describes a ForensicDump written to disk.
+type ForensicDumpInfo struct {
+	Path        string      `json:"path"`
+	Size        int64       `json:"size"`
+	Time        time.Time   `json:"time"`
+	Error       string      `json:"error"`
+	BlockHash   common.Hash `json:"blockHash"`
+	BlockNumber uint64      `json:"blockNumber"`
+}
+
+// writeForensicDump writes the forensic dump of [block], executed on top of
+// [parent] into [statedb] and [receipts], to the configured directory, and
+// removes the oldest dumps in excess of the configured limit.
+func (bc *BlockChain) writeForensicDump(block *types.Block, parent *types.Header, statedb *state.StateDB, receipts types.Receipts, usedGas uint64, verifyErr error) error {
+	dir := bc.cacheConfig.ForensicDumpDir
+	blockRLP, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	// Receipts without logs must encode an empty list of logs to be parseable
+	dumpReceipts := make(types.Receipts, len(receipts))
+	for i, receipt := range receipts {
+		cpy := *receipt
+		if cpy.Logs == nil {
+			cpy.Logs = []*types.Log{}
+		}
+		dumpReceipts[i] = &cpy
+	}
+	dump := &ForensicDump{
+		Time:         time.Now().UTC(),
+		Error:        verifyErr.Error(),
+		BlockHash:    block.Hash(),
+		BlockNumber:  block.NumberU64(),
+		Block:        blockRLP,
+		ParentHeader: parent,
+		Receipts:     dumpReceipts,
+		GasUsed:      usedGas,
+		ReceiptsRoot: types.DeriveSha(receipts, trie.NewStackTrie(nil)),
+		StateRoot:    statedb.IntermediateRoot(bc.chainConfig.IsEIP158(block.Number())),
+		Accounts:     statedb.DumpModified(),
+		Transactions: make([]ForensicTxSummary, len(receipts)),
+	}
+	txs := block.Transactions()
+	for i, receipt := range receipts {
+		summary := ForensicTxSummary{
+			Hash:              receipt.TxHash,
+			Type:              receipt.Type,
+			Status:            receipt.Status,
+			GasUsed:           receipt.GasUsed,
+			CumulativeGasUsed: receipt.CumulativeGasUsed,
+			ContractAddress:   receipt.ContractAddress,
+			Logs:              len(receipt.Logs),
+		}
+		if i < len(txs) {
+			summary.To, summary.Gas = txs[i].To(), txs[i].Gas()
+		}
+		dump.Transactions[i] = summary
+	}
+	blob, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// Names sort in the order the dumps were written
+	name := fmt.Sprintf("%s%019d-%d-%s%s", forensicDumpPrefix, dump.Time.UnixNano(), dump.BlockNumber, dump.BlockHash.Hex(), forensicDumpSuffix)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, blob, 0o644); err != nil {
+		return err
+	}
+	log.Warn("Wrote forensic dump of bad block", "number", dump.BlockNumber, "hash", dump.BlockHash, "path", path)
+
+	paths, err := forensicDumpPaths(dir)
+	if err != nil {
+		return err
+	}
+	for limit := bc.cacheConfig.ForensicDumpLimit; limit > 0 && len(paths) > limit; {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// forensicDumpPaths returns the paths of the forensic dumps in [dir], from
+// the oldest to the most recent.
+func forensicDumpPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, forensicDumpPrefix) && strings.HasSuffix(name, forensicDumpSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ForensicDumps returns the forensic dumps of bad blocks in the configured
+// directory, from the oldest to the most recent.
+func (bc *BlockChain) ForensicDumps() ([]ForensicDumpInfo, error) {
+	dir := bc.cacheConfig.ForensicDumpDir
+	if dir == "" {
+		return nil, nil
+	}
+	paths, err := forensicDumpPaths(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	infos := make([]ForensicDumpInfo, 0, len(paths))
+	for _, path := range paths {
+		blob, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var dump ForensicDump
+		if err := json.Unmarshal(blob, &dump); err != nil {
+			return nil, fmt.Errorf("failed to parse forensic dump %s: %w", path, err)
+		}
+		infos = append(infos, ForensicDumpInfo{
+			Path:        path,
+			Size:        int64(len(blob)),
+			Time:        dump.Time,
+			Error:       dump.Error,
+			BlockHash:   dump.BlockHash,
+			BlockNumber: dump.BlockNumber,
+		})
+	}
+	return infos, nil
+}
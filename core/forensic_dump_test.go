@@ -0,0 +1,162 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestForensicDump(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		addr1  = crypto.PubkeyToAddress(key.PublicKey)
+		addr2  = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		funds  = big.NewInt(params.Ether)
+		gspec  = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{addr1: {Balance: funds}},
+		}
+		signer = types.LatestSigner(params.TestChainConfig)
+		engine = dummy.NewETHFaker()
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _, err := GenerateChain(gspec.Config, genesis, engine, gendb, 2, 10, func(i int, b *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(addr1), addr2, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt returns [block] with its header modified by [modify]
+	corrupt := func(block *types.Block, modify func(*types.Header)) *types.Block {
+		header := block.Header()
+		modify(header)
+		extData := block.ExtData()
+		return types.NewBlockWithHeader(header).WithBody(block.Transactions(), block.Uncles(), block.Version(), &extData)
+	}
+	badRoot := corrupt(blocks[1], func(h *types.Header) { h.Root = common.Hash{0x01} })
+	badReceipts := corrupt(blocks[1], func(h *types.Header) { h.ReceiptHash = common.Hash{0x02} })
+	badReceipts2 := corrupt(blocks[1], func(h *types.Header) { h.ReceiptHash = common.Hash{0x03} })
+
+	dir := t.TempDir()
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	chain, err := NewBlockChain(db, &CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		Pruning:           true,
+		ForensicDumpDir:   dir,
+		ForensicDumpLimit: 2,
+	}, gspec.Config, engine, vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := chain.ForensicDumps(); err != nil || len(infos) != 0 {
+		t.Fatalf("expected no forensic dumps before a bad block, found %v (err: %v)", infos, err)
+	}
+	if _, err := chain.InsertChain([]*types.Block{badRoot}); !errors.Is(err, ErrInvalidMerkleRoot) {
+		t.Fatalf("expected %v, found %v", ErrInvalidMerkleRoot, err)
+	}
+
+	infos, err := chain.ForensicDumps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 forensic dump, found %d", len(infos))
+	}
+	if infos[0].BlockHash != badRoot.Hash() || infos[0].BlockNumber != 2 {
+		t.Fatalf("expected dump of block %s at height 2, found %s at height %d", badRoot.Hash(), infos[0].BlockHash, infos[0].BlockNumber)
+	}
+	blob, err := os.ReadFile(infos[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump ForensicDump
+	if err := json.Unmarshal(blob, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Error != infos[0].Error || dump.Error == "" {
+		t.Fatalf("unexpected error %q in dump listed with %q", dump.Error, infos[0].Error)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(dump.Block, block); err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash() != badRoot.Hash() || len(block.Transactions()) != 1 {
+		t.Fatalf("expected dumped block %s with 1 tx, found %s with %d txs", badRoot.Hash(), block.Hash(), len(block.Transactions()))
+	}
+	if dump.ParentHeader == nil || dump.ParentHeader.Hash() != blocks[0].Hash() {
+		t.Fatalf("expected parent header %s, found %v", blocks[0].Hash(), dump.ParentHeader)
+	}
+	// The local execution is correct, so it must match the uncorrupted block
+	if dump.StateRoot != blocks[1].Root() {
+		t.Fatalf("expected local state root %s, found %s", blocks[1].Root(), dump.StateRoot)
+	}
+	if dump.ReceiptsRoot != blocks[1].ReceiptHash() {
+		t.Fatalf("expected local receipts root %s, found %s", blocks[1].ReceiptHash(), dump.ReceiptsRoot)
+	}
+	if dump.GasUsed != blocks[1].GasUsed() {
+		t.Fatalf("expected gas used %d, found %d", blocks[1].GasUsed(), dump.GasUsed)
+	}
+	if len(dump.Receipts) != 1 || dump.Receipts[0].TxHash != blocks[1].Transactions()[0].Hash() {
+		t.Fatalf("expected the receipt of %s, found %v", blocks[1].Transactions()[0].Hash(), dump.Receipts)
+	}
+	if len(dump.Transactions) != 1 {
+		t.Fatalf("expected 1 tx summary, found %d", len(dump.Transactions))
+	}
+	summary := dump.Transactions[0]
+	if summary.Hash != blocks[1].Transactions()[0].Hash() || summary.To == nil || *summary.To != addr2 ||
+		summary.Status != types.ReceiptStatusSuccessful || summary.GasUsed != params.TxGas {
+		t.Fatalf("unexpected tx summary %+v", summary)
+	}
+	sender, ok := dump.Accounts[addr1]
+	if !ok || sender.Nonce != 2 {
+		t.Fatalf("expected sender with nonce 2 in dumped accounts, found %+v (ok: %t)", sender, ok)
+	}
+	recipient, ok := dump.Accounts[addr2]
+	if !ok || recipient.Balance != "2000" {
+		t.Fatalf("expected recipient with balance 2000 in dumped accounts, found %+v (ok: %t)", recipient, ok)
+	}
+
+	// Only the most recent dumps are kept
+	for _, bad := range []*types.Block{badReceipts, badReceipts2} {
+		if _, err := chain.InsertChain([]*types.Block{bad}); !errors.Is(err, ErrInvalidReceiptRoot) {
+			t.Fatalf("expected %v, found %v", ErrInvalidReceiptRoot, err)
+		}
+	}
+	infos, err = chain.ForensicDumps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 forensic dumps, found %d", len(infos))
+	}
+	if infos[0].BlockHash != badReceipts.Hash() || infos[1].BlockHash != badReceipts2.Hash() {
+		t.Fatalf("expected dumps of %s and %s, found %s and %s", badReceipts.Hash(), badReceipts2.Hash(), infos[0].BlockHash, infos[1].BlockHash)
+	}
+}
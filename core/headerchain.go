@@ -70,7 +70,7 @@ type HeaderChain struct {
 	currentHeader     atomic.Value // Current head of the header chain (may be above the block chain!)
 	currentHeaderHash common.Hash  // Hash of the current head of the header chain (prevent recomputing all the time)
 
-	headerCache *lru.Cache // Cache for the most recent block headers
+	headerCache chainCache // Cache for the most recent block headers
 	tdCache     *lru.Cache // Cache for the most recent block total difficulties
 	numberCache *lru.Cache // Cache for the most recent block numbers
 
@@ -78,10 +78,10 @@ type HeaderChain struct {
 	engine consensus.Engine
 }
 
-// NewHeaderChain creates a new HeaderChain structure. ProcInterrupt points
-// to the parent's interrupt semaphore.
-func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine) (*HeaderChain, error) {
-	headerCache, _ := lru.New(headerCacheLimit)
+// NewHeaderChain creates a new HeaderChain structure. [headerCacheSize] is the
+// number of recent headers kept in memory.
+func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, headerCacheSize int, engine consensus.Engine) (*HeaderChain, error) {
+	headerCache := newMeteredCache(headerCacheSize, headerCacheMeters)
 	tdCache, _ := lru.New(tdCacheLimit)
 	numberCache, _ := lru.New(numberCacheLimit)
 
@@ -0,0 +1,71 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/coreth/core/state"
+)
+
+const (
+	// hotKeysCacheLimit is the number of recently processed blocks whose hot
+	// keys are kept to warm up the processing of their children.
+	hotKeysCacheLimit = 32
+
+	// defaultHotKeysWarmupTimeout is the default maximum duration of the
+	// warm-up of the hot keys of the parent of a processed block.
+	defaultHotKeysWarmupTimeout = 100 * time.Millisecond
+)
+
+var (
+	hotKeysWarmedMeter      = metrics.NewRegisteredMeter("chain/hotkeys/warmed", nil)
+	hotKeysInterruptedMeter = metrics.NewRegisteredMeter("chain/hotkeys/interrupted", nil)
+)
+
+// startHotKeysWarmup warms up the state caches with the hot keys of the parent
+// [parentHash] of the block processed on [statedb], and counts the accesses of
+// [statedb] for the hot keys of the block. The warm-up reads a copy of
+// [statedb] in the background, so that it never delays the start of the
+// processing, until it is stopped by the returned function or its time is up.
+func (bc *BlockChain) startHotKeysWarmup(parentHash common.Hash, statedb *state.StateDB) func() {
+	if bc.cacheConfig.HotKeysLimit <= 0 {
+		return func() {}
+	}
+	statedb.TrackAccesses()
+	cached, ok := bc.hotKeys.Get(parentHash)
+	if !ok {
+		return func() {}
+	}
+	var (
+		keys      = cached.([]state.StateKey)
+		throwaway = statedb.Copy()
+		timeout   = bc.cacheConfig.HotKeysWarmupTimeout
+		interrupt uint32
+	)
+	if timeout <= 0 {
+		timeout = defaultHotKeysWarmupTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	go func() {
+		warmed := bc.prefetcher.PrefetchKeys(keys, throwaway, deadline, &interrupt)
+		hotKeysWarmedMeter.Mark(int64(warmed))
+		if warmed < len(keys) {
+			hotKeysInterruptedMeter.Mark(1)
+		}
+	}()
+	return func() { atomic.StoreUint32(&interrupt, 1) }
+}
+
+// recordHotKeys keeps the keys accessed the most by the processing of the
+// block [hash] on [statedb], to warm up the processing of its children.
+func (bc *BlockChain) recordHotKeys(hash common.Hash, statedb *state.StateDB) {
+	if keys := statedb.TopAccesses(bc.cacheConfig.HotKeysLimit); len(keys) > 0 {
+		bc.hotKeys.Add(hash, keys)
+	}
+}
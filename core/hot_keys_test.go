@@ -0,0 +1,154 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+)
+
+var (
+	hotKeysTestKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	hotKeysTestAddr    = crypto.PubkeyToAddress(hotKeysTestKey.PublicKey)
+	hotKeysTestPool    = common.HexToAddress("0x0100000000000000000000000000000000000001")
+	hotKeysTestGenesis = &Genesis{
+		Config:   &params.ChainConfig{HomesteadBlock: new(big.Int)},
+		GasLimit: 30_000_000,
+		Alloc: GenesisAlloc{
+			hotKeysTestAddr: {Balance: big.NewInt(1000000000)},
+			// Increments the first 64 storage slots on every call, as a
+			// popular pool would
+			hotKeysTestPool: {Code: common.FromHex("0x60005b805460010181556001018060401160025700"), Balance: new(big.Int)},
+		},
+	}
+)
+
+// hotKeysTestChain generates [numBlocks] blocks of [txs] calls to the hot
+// pool each.
+func hotKeysTestChain(t testing.TB, numBlocks, txs int) []*types.Block {
+	genDB := rawdb.NewMemoryDatabase()
+	genesis := hotKeysTestGenesis.MustCommit(genDB)
+	chain, _, err := GenerateChain(hotKeysTestGenesis.Config, genesis, dummy.NewFaker(), genDB, numBlocks, 10, func(i int, gen *BlockGen) {
+		for j := 0; j < txs; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(hotKeysTestAddr), hotKeysTestPool, new(big.Int), 2_000_000, new(big.Int), nil), types.HomesteadSigner{}, hotKeysTestKey)
+			gen.AddTx(tx)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// newHotKeysTestBlockChain returns a chain at the genesis of the hot pool,
+// warming up [hotKeys] keys of the parent of each processed block.
+func newHotKeysTestBlockChain(t testing.TB, db ethdb.Database, hotKeys int) *BlockChain {
+	hotKeysTestGenesis.MustCommit(db)
+	cacheConfig := *DefaultCacheConfig
+	cacheConfig.HotKeysLimit = hotKeys
+	cacheConfig.HotKeysWarmupTimeout = time.Second
+	blockchain, err := NewBlockChain(db, &cacheConfig, hotKeysTestGenesis.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blockchain
+}
+
+func TestHotKeysWarmup(t *testing.T) {
+	chain := hotKeysTestChain(t, 8, 4)
+
+	var roots [2][]common.Hash
+	for i, hotKeys := range []int{0, 16} {
+		blockchain := newHotKeysTestBlockChain(t, rawdb.NewMemoryDatabase(), hotKeys)
+		for _, block := range chain {
+			if err := blockchain.InsertBlock(block); err != nil {
+				t.Fatal(err)
+			}
+			if err := blockchain.Accept(block); err != nil {
+				t.Fatal(err)
+			}
+			roots[i] = append(roots[i], blockchain.CurrentBlock().Root())
+		}
+
+		// Only the keys accessed the most are kept with the warm-up enabled
+		cached, ok := blockchain.hotKeys.Get(chain[len(chain)-1].Hash())
+		if hotKeys == 0 {
+			if ok {
+				t.Fatal("Expected no hot keys with the warm-up disabled")
+			}
+			blockchain.Stop()
+			continue
+		}
+		keys := cached.([]state.StateKey)
+		if len(keys) != hotKeys {
+			t.Fatalf("Expected %d hot keys, found %d", hotKeys, len(keys))
+		}
+		slots := 0
+		for _, key := range keys {
+			if !key.IsSlot {
+				continue
+			}
+			if key.Address != hotKeysTestPool || key.Slot.Big().Uint64() >= 64 {
+				t.Fatalf("Expected the hot slots to be slots of the pool, found %+v", key)
+			}
+			slots++
+		}
+		// The few accounts of the txs are accessed the most
+		if slots < hotKeys-4 {
+			t.Fatalf("Expected the hot keys to be mostly slots of the pool, found %+v", keys)
+		}
+		blockchain.Stop()
+	}
+
+	// The warm-up does not change the state of the processed blocks
+	for i := range chain {
+		if roots[0][i] != roots[1][i] || roots[1][i] != chain[i].Root() {
+			t.Fatalf("Expected root %s of block %d with and without the warm-up, found %s and %s", chain[i].Root(), i, roots[0][i], roots[1][i])
+		}
+	}
+}
+
+func BenchmarkHotKeysWarmup(b *testing.B) {
+	chain := hotKeysTestChain(b, 32, 8)
+	for _, hotKeys := range []int{0, 10_000} {
+		name := "disabled"
+		if hotKeys != 0 {
+			name = "enabled"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				db, err := rawdb.NewLevelDBDatabase(b.TempDir(), 16, 16, "", false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				blockchain := newHotKeysTestBlockChain(b, db, hotKeys)
+				b.StartTimer()
+				for _, block := range chain {
+					if err := blockchain.InsertBlock(block); err != nil {
+						b.Fatal(err)
+					}
+					if err := blockchain.Accept(block); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				blockchain.Stop()
+				db.Close()
+			}
+		})
+	}
+}
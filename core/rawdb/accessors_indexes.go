@@ -103,6 +103,42 @@ func DeleteTxLookupEntries(db ethdb.KeyValueWriter, hashes []common.Hash) {
 	}
 }
 
+// MigrateLegacyTxLookupEntries rewrites the tx lookup entries stored in the
+// formats of database v3 to v5 to the block number of database v6, visiting
+// up to [limit] entries in key order from the tx hash [start]. The rewrites are
+// added to [batch]. It returns the tx hash to resume from, or nil once every
+// entry is visited, and the number of entries rewritten. Entries whose block
+// number cannot be resolved are left as they are.
+func MigrateLegacyTxLookupEntries(db ethdb.Database, batch ethdb.KeyValueWriter, start []byte, limit int) ([]byte, int, error) {
+	it := db.NewIterator(txLookupPrefix, start)
+	defer it.Release()
+
+	var visited, migrated int
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(txLookupPrefix)+common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key[len(txLookupPrefix):])
+		if visited == limit {
+			return hash.Bytes(), migrated, it.Error()
+		}
+		visited++
+		if len(it.Value()) < common.HashLength {
+			continue
+		}
+		number := ReadTxLookupEntry(db, hash)
+		if number == nil {
+			continue
+		}
+		if err := batch.Put(txLookupKey(hash), new(big.Int).SetUint64(*number).Bytes()); err != nil {
+			return nil, migrated, err
+		}
+		migrated++
+	}
+	return nil, migrated, it.Error()
+}
+
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db ethdb.Reader, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
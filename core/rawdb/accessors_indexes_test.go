@@ -179,3 +179,66 @@ func TestDeleteBloomBits(t *testing.T) {
 	check(1, 1, genesisHash0, true)
 	check(1, 1, genesisHash1, true)
 }
+
+// Tests that the lookup entries of older databases are rewritten to the block
+// number in batches, resuming from the returned hash.
+func TestMigrateLegacyTxLookupEntries(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	var blocks []*types.Block
+	for i := int64(1); i <= 3; i++ {
+		txs := []*types.Transaction{
+			types.NewTransaction(uint64(2*i), common.BytesToAddress([]byte{0x11}), big.NewInt(i), 1111, big.NewInt(11111), nil),
+			types.NewTransaction(uint64(2*i+1), common.BytesToAddress([]byte{0x22}), big.NewInt(i), 2222, big.NewInt(22222), nil),
+		}
+		block := types.NewBlock(&types.Header{Number: big.NewInt(i)}, txs, nil, nil, newHasher(), nil, true)
+		WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		WriteBlock(db, block)
+		blocks = append(blocks, block)
+	}
+	// Store the entries of the first block in the v3 format, of the second in
+	// the v4-v5 format and of the last in the v6 format
+	for index, tx := range blocks[0].Transactions() {
+		data, _ := rlp.EncodeToBytes(LegacyTxLookupEntry{BlockHash: blocks[0].Hash(), BlockIndex: 1, Index: uint64(index)})
+		db.Put(txLookupKey(tx.Hash()), data)
+	}
+	for _, tx := range blocks[1].Transactions() {
+		db.Put(txLookupKey(tx.Hash()), blocks[1].Hash().Bytes())
+	}
+	WriteTxLookupEntriesByBlock(db, blocks[2])
+
+	var (
+		cursor   []byte
+		steps    int
+		migrated int
+	)
+	for {
+		batch := db.NewBatch()
+		next, n, err := MigrateLegacyTxLookupEntries(db, batch, cursor, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatal(err)
+		}
+		steps++
+		migrated += n
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if steps != 2 || migrated != 4 {
+		t.Fatalf("Expected 4 entries rewritten in 2 steps, found %d in %d steps", migrated, steps)
+	}
+	for _, block := range blocks {
+		for i, tx := range block.Transactions() {
+			if data, _ := db.Get(txLookupKey(tx.Hash())); len(data) >= common.HashLength {
+				t.Fatalf("tx %x: expected a v6 lookup entry, found %x", tx.Hash(), data)
+			}
+			if _, hash, number, index := ReadTransaction(db, tx.Hash()); hash != block.Hash() || number != block.NumberU64() || index != uint64(i) {
+				t.Fatalf("tx %x: positional metadata mismatch: have %x/%d/%d, want %x/%d/%d", tx.Hash(), hash, number, index, block.Hash(), block.NumberU64(), i)
+			}
+		}
+	}
+}
@@ -27,6 +27,8 @@
 package rawdb
 
 import (
+	"encoding/binary"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/zsmartex/coreth/ethdb"
@@ -156,3 +158,52 @@ func DeleteSnapshotGenerator(db ethdb.KeyValueWriter) {
 		log.Crit("Failed to remove snapshot generator", "err", err)
 	}
 }
+
+// ReadSnapshotDiffJournalHead retrieves the sequence number of the last diff
+// layer flushed into the snapshot disk layer, if any.
+func ReadSnapshotDiffJournalHead(db ethdb.KeyValueReader) (uint64, bool) {
+	data, _ := db.Get(snapshotDiffJournalHeadKey)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteSnapshotDiffJournalHead stores the sequence number of the last diff
+// layer flushed into the snapshot disk layer.
+func WriteSnapshotDiffJournalHead(db ethdb.KeyValueWriter, seq uint64) {
+	if err := db.Put(snapshotDiffJournalHeadKey, encodeBlockNumber(seq)); err != nil {
+		log.Crit("Failed to store snapshot diff journal head", "err", err)
+	}
+}
+
+// DeleteSnapshotDiffJournalHead deletes the sequence number of the last diff
+// layer flushed into the snapshot disk layer, invalidating the diff journal.
+func DeleteSnapshotDiffJournalHead(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotDiffJournalHeadKey); err != nil {
+		log.Crit("Failed to remove snapshot diff journal head", "err", err)
+	}
+}
+
+// ReadSnapshotDiffJournal retrieves the serialized diff layer flushed into the
+// snapshot disk layer with sequence number [seq].
+func ReadSnapshotDiffJournal(db ethdb.KeyValueReader, seq uint64) []byte {
+	data, _ := db.Get(snapshotDiffJournalKey(seq))
+	return data
+}
+
+// WriteSnapshotDiffJournal stores the serialized diff layer flushed into the
+// snapshot disk layer with sequence number [seq].
+func WriteSnapshotDiffJournal(db ethdb.KeyValueWriter, seq uint64, diff []byte) {
+	if err := db.Put(snapshotDiffJournalKey(seq), diff); err != nil {
+		log.Crit("Failed to store snapshot diff journal", "err", err)
+	}
+}
+
+// DeleteSnapshotDiffJournal deletes the serialized diff layer flushed into the
+// snapshot disk layer with sequence number [seq].
+func DeleteSnapshotDiffJournal(db ethdb.KeyValueWriter, seq uint64) {
+	if err := db.Delete(snapshotDiffJournalKey(seq)); err != nil {
+		log.Crit("Failed to remove snapshot diff journal", "err", err)
+	}
+}
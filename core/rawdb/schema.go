@@ -55,6 +55,10 @@ var (
 	// snapshotGeneratorKey tracks the snapshot generation marker across restarts.
 	snapshotGeneratorKey = []byte("SnapshotGenerator")
 
+	// snapshotDiffJournalHeadKey tracks the sequence number of the last diff
+	// layer flushed into the snapshot disk layer.
+	snapshotDiffJournalHeadKey = []byte("SnapshotDiffJournalHead")
+
 	// uncleanShutdownKey tracks the list of local crashes
 	uncleanShutdownKey = []byte("unclean-shutdown") // config prefix for the db
 
@@ -75,6 +79,8 @@ var (
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
 
+	snapshotDiffJournalPrefix = []byte("SnapshotDiffJournal-") // snapshotDiffJournalPrefix + seq (uint64 big endian) -> flushed diff layer
+
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
@@ -150,6 +156,11 @@ func storageSnapshotsKey(accountHash common.Hash) []byte {
 	return append(SnapshotStoragePrefix, accountHash.Bytes()...)
 }
 
+// snapshotDiffJournalKey = snapshotDiffJournalPrefix + seq (uint64 big endian)
+func snapshotDiffJournalKey(seq uint64) []byte {
+	return append(append([]byte{}, snapshotDiffJournalPrefix...), encodeBlockNumber(seq)...)
+}
+
 // bloomBitsKey = bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash
 func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	key := append(append(bloomBitsPrefix, make([]byte, 10)...), hash.Bytes()...)
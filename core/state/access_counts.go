@@ -0,0 +1,69 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateKey is an account, or a storage slot of an account if IsSlot is set.
+type StateKey struct {
+	Address common.Address
+	Slot    common.Hash
+	IsSlot  bool
+}
+
+// TrackAccesses starts counting the accesses of each account and storage slot
+// of the state, returned by TopAccesses. The copies of the state do not count
+// their accesses.
+func (s *StateDB) TrackAccesses() {
+	s.accessCounts = make(map[StateKey]uint32)
+}
+
+// TopAccesses returns up to [limit] of the keys accessed since TrackAccesses
+// was called, most accessed first. Returns nil if the accesses are not
+// tracked.
+func (s *StateDB) TopAccesses(limit int) []StateKey {
+	if s.accessCounts == nil {
+		return nil
+	}
+	keys := make([]StateKey, 0, len(s.accessCounts))
+	for key := range s.accessCounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ci, cj := s.accessCounts[keys[i]], s.accessCounts[keys[j]]; ci != cj {
+			return ci > cj
+		}
+		if c := bytes.Compare(keys[i].Address[:], keys[j].Address[:]); c != 0 {
+			return c < 0
+		}
+		if keys[i].IsSlot != keys[j].IsSlot {
+			return !keys[i].IsSlot
+		}
+		return bytes.Compare(keys[i].Slot[:], keys[j].Slot[:]) < 0
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// countAccountAccess counts an access of the account [addr], if tracked.
+func (s *StateDB) countAccountAccess(addr common.Address) {
+	if s.accessCounts != nil {
+		s.accessCounts[StateKey{Address: addr}]++
+	}
+}
+
+// countSlotAccess counts an access of the storage slot [slot] of [addr], if
+// tracked.
+func (s *StateDB) countSlotAccess(addr common.Address, slot common.Hash) {
+	if s.accessCounts != nil {
+		s.accessCounts[StateKey{Address: addr, Slot: slot, IsSlot: true}]++
+	}
+}
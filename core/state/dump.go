@@ -35,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/coreth/core/state/snapshot"
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/trie"
 )
@@ -47,6 +48,33 @@ type DumpConfig struct {
 	OnlyWithAddresses bool
 	Start             []byte
 	Max               uint64
+
+	// StorageAddresses restricts the dumped storage to the listed accounts if
+	// non-nil. It has no effect if SkipStorage is set.
+	StorageAddresses []common.Address
+
+	// AssetIDs lists the native assets whose non-zero balances are dumped
+	// for the multicoin accounts.
+	AssetIDs []common.Hash
+}
+
+// storageFilter returns whether the storage of an account must be dumped
+// according to [conf].
+func (conf *DumpConfig) storageFilter() func(common.Address) bool {
+	if conf.SkipStorage {
+		return func(common.Address) bool { return false }
+	}
+	if conf.StorageAddresses == nil {
+		return func(common.Address) bool { return true }
+	}
+	addrs := make(map[common.Address]struct{}, len(conf.StorageAddresses))
+	for _, addr := range conf.StorageAddresses {
+		addrs[addr] = struct{}{}
+	}
+	return func(addr common.Address) bool {
+		_, ok := addrs[addr]
+		return ok
+	}
 }
 
 // DumpCollector interface which the state trie calls during iteration
@@ -69,6 +97,8 @@ type DumpAccount struct {
 	Address     *common.Address        `json:"address,omitempty"` // Address only present in iterative (line-by-line) mode
 	SecureKey   hexutil.Bytes          `json:"key,omitempty"`     // If we don't have address, we can output the key
 
+	AssetBalances map[common.Hash]string `json:"assetBalances,omitempty"` // Non-zero balances of DumpConfig.AssetIDs
+
 }
 
 // Dump represents the full dump in a collected format, as one large map.
@@ -121,6 +151,8 @@ func (d iterativeDump) OnAccount(addr common.Address, account DumpAccount) {
 		Storage:     account.Storage,
 		SecureKey:   account.SecureKey,
 		Address:     nil,
+
+		AssetBalances: account.AssetBalances,
 	}
 	if addr != (common.Address{}) {
 		dumpAccount.Address = &addr
@@ -135,6 +167,24 @@ func (d iterativeDump) OnRoot(root common.Hash) {
 	}{root})
 }
 
+// dumpAssetBalances returns the non-zero balances of [assetIDs] held by [obj],
+// or nil if there is none.
+func dumpAssetBalances(s *StateDB, obj *stateObject, assetIDs []common.Hash) map[common.Hash]string {
+	if !obj.data.IsMultiCoin {
+		return nil
+	}
+	var balances map[common.Hash]string
+	for _, assetID := range assetIDs {
+		if balance := obj.BalanceMultiCoin(assetID, s.db); balance.Sign() != 0 {
+			if balances == nil {
+				balances = make(map[common.Hash]string)
+			}
+			balances[assetID] = balance.String()
+		}
+	}
+	return balances
+}
+
 // DumpToCollector iterates the state according to the given options and inserts
 // the items into a collector for aggregation or serialization.
 func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []byte) {
@@ -150,6 +200,7 @@ func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []
 	)
 	log.Info("Trie dumping started", "root", s.trie.Hash())
 	c.OnRoot(s.trie.Hash())
+	dumpStorage := conf.storageFilter()
 
 	it := trie.NewIterator(s.trie.NodeIterator(conf.Start))
 	for it.Next() {
@@ -179,7 +230,10 @@ func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []
 		if !conf.SkipCode {
 			account.Code = obj.Code(s.db)
 		}
-		if !conf.SkipStorage {
+		if addrBytes != nil {
+			account.AssetBalances = dumpAssetBalances(s, obj, conf.AssetIDs)
+		}
+		if dumpStorage(addr) {
 			account.Storage = make(map[common.Hash]string)
 			storageIt := trie.NewIterator(obj.getTrie(s.db).NodeIterator(nil))
 			for storageIt.Next() {
@@ -214,6 +268,121 @@ func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []
 	return nextKey
 }
 
+// DumpSnapshotToCollector iterates the state according to the given options
+// and inserts the items into a collector like DumpToCollector, reading the
+// accounts and storage from [snaps] instead of the state trie. The accounts
+// are output in the same order and with the same contents as DumpToCollector.
+//
+// An error is returned if [snaps] does not hold the state or becomes stale
+// during the iteration, in which case the collector may hold a partial dump.
+func (s *StateDB) DumpSnapshotToCollector(snaps *snapshot.Tree, c DumpCollector, conf *DumpConfig) (nextKey []byte, err error) {
+	// Sanitize the input to allow nil configs
+	if conf == nil {
+		conf = new(DumpConfig)
+	}
+	var (
+		missingPreimages int
+		accounts         uint64
+		start            = time.Now()
+		logged           = time.Now()
+		root             = s.originalRoot
+		seek             common.Hash
+	)
+	// As for the trie, the start key is a prefix of the hash to seek to
+	copy(seek[:], conf.Start)
+	it, err := snaps.AccountIterator(root, seek, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Release()
+
+	log.Info("Snapshot dumping started", "root", root)
+	c.OnRoot(root)
+	dumpStorage := conf.storageFilter()
+
+	for it.Next() {
+		slim, err := snapshot.FullAccount(it.Account())
+		if err != nil {
+			return nil, err
+		}
+		data := types.StateAccount{
+			Nonce:       slim.Nonce,
+			Balance:     slim.Balance,
+			Root:        common.BytesToHash(slim.Root),
+			CodeHash:    slim.CodeHash,
+			IsMultiCoin: slim.IsMultiCoin,
+		}
+		accountHash := it.Hash()
+		account := DumpAccount{
+			Balance:     data.Balance.String(),
+			Nonce:       data.Nonce,
+			Root:        data.Root[:],
+			CodeHash:    data.CodeHash,
+			IsMultiCoin: data.IsMultiCoin,
+			SecureKey:   accountHash.Bytes(),
+		}
+		addrBytes := s.trie.GetKey(accountHash[:])
+		if addrBytes == nil {
+			// Preimage missing
+			missingPreimages++
+			if conf.OnlyWithAddresses {
+				continue
+			}
+		}
+		addr := common.BytesToAddress(addrBytes)
+		obj := newObject(s, addr, data)
+		if !conf.SkipCode {
+			account.Code = obj.Code(s.db)
+		}
+		if addrBytes != nil {
+			account.AssetBalances = dumpAssetBalances(s, obj, conf.AssetIDs)
+		}
+		if dumpStorage(addr) {
+			account.Storage = make(map[common.Hash]string)
+			storageIt, err := snaps.StorageIterator(root, accountHash, common.Hash{}, false)
+			if err != nil {
+				return nil, err
+			}
+			for storageIt.Next() {
+				_, content, _, err := rlp.Split(storageIt.Slot())
+				if err != nil {
+					log.Error("Failed to decode the value returned by iterator", "error", err)
+					continue
+				}
+				account.Storage[common.BytesToHash(s.trie.GetKey(storageIt.Hash().Bytes()))] = common.Bytes2Hex(content)
+			}
+			err = storageIt.Error()
+			storageIt.Release()
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.OnAccount(addr, account)
+		accounts++
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Snapshot dumping in progress", "at", accountHash, "accounts", accounts,
+				"elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		if conf.Max > 0 && accounts >= conf.Max {
+			if it.Next() {
+				nextKey = it.Hash().Bytes()
+			}
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if missingPreimages > 0 {
+		log.Warn("Dump incomplete due to missing preimages", "missing", missingPreimages)
+	}
+	log.Info("Snapshot dumping complete", "accounts", accounts,
+		"elapsed", common.PrettyDuration(time.Since(start)))
+
+	return nextKey, nil
+}
+
 // RawDump returns the entire state an a single large object
 func (s *StateDB) RawDump(opts *DumpConfig) Dump {
 	dump := &Dump{
@@ -246,3 +415,41 @@ func (s *StateDB) IteratorDump(opts *DumpConfig) IteratorDump {
 	iterator.Next = s.DumpToCollector(iterator, opts)
 	return *iterator
 }
+
+// DumpModified returns the accounts modified in the current execution, with
+// their current values and the storage slots accessed in them. Deleted
+// accounts are returned empty.
+func (s *StateDB) DumpModified() map[common.Address]DumpAccount {
+	accounts := make(map[common.Address]DumpAccount, len(s.journal.dirties)+len(s.stateObjectsDirty))
+	dump := func(addr common.Address) {
+		obj, exist := s.stateObjects[addr]
+		if !exist {
+			return
+		}
+		if obj.deleted || obj.suicided {
+			accounts[addr] = DumpAccount{Balance: "0", Root: emptyRoot[:], CodeHash: emptyCodeHash}
+			return
+		}
+		account := DumpAccount{
+			Balance:     obj.data.Balance.String(),
+			Nonce:       obj.data.Nonce,
+			Root:        obj.data.Root[:],
+			CodeHash:    obj.data.CodeHash,
+			IsMultiCoin: obj.data.IsMultiCoin,
+			Storage:     make(map[common.Hash]string),
+		}
+		for _, storage := range []Storage{obj.originStorage, obj.pendingStorage, obj.dirtyStorage} {
+			for key, value := range storage {
+				account.Storage[key] = common.Bytes2Hex(common.TrimLeftZeroes(value[:]))
+			}
+		}
+		accounts[addr] = account
+	}
+	for addr := range s.stateObjectsDirty {
+		dump(addr)
+	}
+	for addr := range s.journal.dirties {
+		dump(addr)
+	}
+	return accounts
+}
@@ -0,0 +1,322 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+// diffJournalLimit is the number of the last diff layers flushed into the disk
+// layer that are kept in the diff journal.
+const diffJournalLimit = 8
+
+var errMissingDiffJournal = errors.New("missing snapshot diff journal")
+
+// journalAccount is an account of a journalled diff layer. An empty Blob is a
+// missing account.
+type journalAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// journalStorage is the storage of an account of a journalled diff layer. An
+// empty value is a missing slot.
+type journalStorage struct {
+	Hash common.Hash
+	Keys []common.Hash
+	Vals [][]byte
+}
+
+// journalDiff is a diff layer flushed into the disk layer, recorded in the
+// diff journal before the flush starts. It holds the data written by the
+// flush, which is replayed to complete an interrupted flush, and the data it
+// overwrote, which is restored to revert the disk layer to the parent of the
+// diff layer.
+//
+// The diff journal allows recovering the disk layer after an unclean shutdown
+// without regenerating it from the state trie, when it is left in the middle
+// of a flush or at a block after the last accepted block.
+type journalDiff struct {
+	ParentHash common.Hash
+	ParentRoot common.Hash
+	BlockHash  common.Hash
+	Root       common.Hash
+
+	Destructs []common.Hash
+	Accounts  []journalAccount
+	Storage   []journalStorage
+
+	// Data of the disk layer overwritten by the flush
+	UndoAccounts []journalAccount
+	UndoStorage  []journalStorage
+}
+
+// journalDiffLayer records [bottom], about to be flushed into [base], in the
+// diff journal, keeping at most diffJournalLimit diff layers.
+//
+// Assumes the snapshot of [base] is fully generated.
+func journalDiffLayer(base *diskLayer, bottom *diffLayer) error {
+	diff := &journalDiff{
+		ParentHash: base.blockHash,
+		ParentRoot: base.root,
+		BlockHash:  bottom.blockHash,
+		Root:       bottom.root,
+	}
+	undoAccounts := make(map[common.Hash][]byte)
+	undoStorage := make(map[common.Hash]map[common.Hash][]byte)
+	undoSlot := func(accountHash, storageHash common.Hash, blob []byte) {
+		slots := undoStorage[accountHash]
+		if slots == nil {
+			slots = make(map[common.Hash][]byte)
+			undoStorage[accountHash] = slots
+		}
+		if _, ok := slots[storageHash]; !ok {
+			slots[storageHash] = blob
+		}
+	}
+	for hash := range bottom.destructSet {
+		diff.Destructs = append(diff.Destructs, hash)
+		undoAccounts[hash] = rawdb.ReadAccountSnapshot(base.diskdb, hash)
+
+		// The whole storage of destructed accounts is deleted
+		it := rawdb.IterateStorageSnapshots(base.diskdb, hash)
+		for it.Next() {
+			if key := it.Key(); len(key) == 65 {
+				undoSlot(hash, common.BytesToHash(key[33:]), common.CopyBytes(it.Value()))
+			}
+		}
+		it.Release()
+	}
+	for hash, blob := range bottom.accountData {
+		diff.Accounts = append(diff.Accounts, journalAccount{Hash: hash, Blob: blob})
+		if _, ok := undoAccounts[hash]; !ok {
+			undoAccounts[hash] = rawdb.ReadAccountSnapshot(base.diskdb, hash)
+		}
+	}
+	for accountHash, storage := range bottom.storageData {
+		entry := journalStorage{Hash: accountHash}
+		for storageHash, blob := range storage {
+			entry.Keys = append(entry.Keys, storageHash)
+			entry.Vals = append(entry.Vals, blob)
+			undoSlot(accountHash, storageHash, rawdb.ReadStorageSnapshot(base.diskdb, accountHash, storageHash))
+		}
+		diff.Storage = append(diff.Storage, entry)
+	}
+	for hash, blob := range undoAccounts {
+		diff.UndoAccounts = append(diff.UndoAccounts, journalAccount{Hash: hash, Blob: blob})
+	}
+	for accountHash, slots := range undoStorage {
+		entry := journalStorage{Hash: accountHash}
+		for storageHash, blob := range slots {
+			entry.Keys = append(entry.Keys, storageHash)
+			entry.Vals = append(entry.Vals, blob)
+		}
+		diff.UndoStorage = append(diff.UndoStorage, entry)
+	}
+
+	blob, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return err
+	}
+	var seq uint64
+	if head, ok := rawdb.ReadSnapshotDiffJournalHead(base.diskdb); ok {
+		seq = head + 1
+	}
+	batch := base.diskdb.NewBatch()
+	rawdb.WriteSnapshotDiffJournal(batch, seq, blob)
+	rawdb.WriteSnapshotDiffJournalHead(batch, seq)
+	if seq >= diffJournalLimit {
+		rawdb.DeleteSnapshotDiffJournal(batch, seq-diffJournalLimit)
+	}
+	return batch.Write()
+}
+
+// loadDiffJournal returns the diff layers of the diff journal, newest first,
+// with their sequence numbers. The diff layers returned form a chain, each
+// diff layer being flushed onto the previous one.
+func loadDiffJournal(diskdb ethdb.KeyValueReader) ([]*journalDiff, []uint64, error) {
+	head, ok := rawdb.ReadSnapshotDiffJournalHead(diskdb)
+	if !ok {
+		return nil, nil, errMissingDiffJournal
+	}
+	var (
+		diffs []*journalDiff
+		seqs  []uint64
+	)
+	for seq := head; len(diffs) < diffJournalLimit; seq-- {
+		blob := rawdb.ReadSnapshotDiffJournal(diskdb, seq)
+		if len(blob) == 0 {
+			break
+		}
+		diff := new(journalDiff)
+		if err := rlp.DecodeBytes(blob, diff); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode snapshot diff journal %d: %w", seq, err)
+		}
+		if len(diffs) > 0 && diffs[len(diffs)-1].ParentHash != diff.BlockHash {
+			break
+		}
+		diffs = append(diffs, diff)
+		seqs = append(seqs, seq)
+		if seq == 0 {
+			break
+		}
+	}
+	if len(diffs) == 0 {
+		return nil, nil, errMissingDiffJournal
+	}
+	return diffs, seqs, nil
+}
+
+// recoverDiskLayer moves the disk layer to the block [blockHash] with the diff
+// journal, if it is not at [blockHash] after an unclean shutdown.
+//
+// A disk layer without a block hash was left in the middle of the flush of the
+// newest diff layer of the journal, which is replayed first. The disk layer is
+// then reverted to [blockHash] if it is ahead of it, which happens if the node
+// stopped after a flush but before the block was marked as accepted, or moved
+// forward to [blockHash] if it is behind it.
+//
+// Only fully generated snapshots are recovered, as a generating snapshot does
+// not flush the data beyond its generation marker.
+func recoverDiskLayer(diskdb ethdb.KeyValueStore, blockHash common.Hash) error {
+	diskHash := rawdb.ReadSnapshotBlockHash(diskdb)
+	if diskHash == blockHash {
+		return nil
+	}
+	// Nothing to recover without a journal, e.g. without a snapshot
+	if _, ok := rawdb.ReadSnapshotDiffJournalHead(diskdb); !ok {
+		return nil
+	}
+	var generator journalGenerator
+	if err := rlp.DecodeBytes(rawdb.ReadSnapshotGenerator(diskdb), &generator); err != nil || !generator.Done {
+		return errors.New("snapshot generation not complete")
+	}
+	diffs, seqs, err := loadDiffJournal(diskdb)
+	if err != nil {
+		return err
+	}
+	if diskHash == (common.Hash{}) {
+		log.Info("Completing interrupted snapshot flush", "blockHash", diffs[0].BlockHash, "root", diffs[0].Root)
+		applyJournalDiff(diskdb, diffs[0], seqs[0], false)
+		diskHash = diffs[0].BlockHash
+	}
+
+	// states[i] is the block of the disk layer after the flush of diffs[i],
+	// and states[len(diffs)] the block before the flush of the oldest one
+	states := make([]common.Hash, 0, len(diffs)+1)
+	for _, diff := range diffs {
+		states = append(states, diff.BlockHash)
+	}
+	states = append(states, diffs[len(diffs)-1].ParentHash)
+	diskIndex, targetIndex := -1, -1
+	for i, state := range states {
+		if state == diskHash {
+			diskIndex = i
+		}
+		if state == blockHash {
+			targetIndex = i
+		}
+	}
+	if diskIndex < 0 || targetIndex < 0 {
+		return fmt.Errorf("snapshot diff journal does not link disk layer (%#x) to last accepted (%#x)", diskHash, blockHash)
+	}
+	for i := diskIndex; i < targetIndex; i++ {
+		log.Info("Reverting snapshot flush", "blockHash", diffs[i].BlockHash, "parentHash", diffs[i].ParentHash)
+		applyJournalDiff(diskdb, diffs[i], seqs[i], true)
+	}
+	for i := diskIndex - 1; i >= targetIndex; i-- {
+		log.Info("Replaying snapshot flush", "blockHash", diffs[i].BlockHash, "parentHash", diffs[i].ParentHash)
+		applyJournalDiff(diskdb, diffs[i], seqs[i], false)
+	}
+	return nil
+}
+
+// applyJournalDiff replays the flush of [diff], with sequence number [seq],
+// into the disk layer, or reverts it if [undo] is set. The block hash of the
+// disk layer is deleted until the end of the operation, and the journal head
+// is first set to [seq], so that an interrupted operation is completed by
+// replaying [diff] at the next startup.
+func applyJournalDiff(diskdb ethdb.KeyValueStore, diff *journalDiff, seq uint64, undo bool) {
+	batch := diskdb.NewBatch()
+	rawdb.DeleteSnapshotBlockHash(batch)
+	rawdb.DeleteSnapshotRoot(batch)
+	rawdb.WriteSnapshotDiffJournalHead(batch, seq)
+
+	flush := func() {
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write snapshot diff journal recovery", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	writeAccount := func(hash common.Hash, blob []byte) {
+		if len(blob) > 0 {
+			rawdb.WriteAccountSnapshot(batch, hash, blob)
+		} else {
+			rawdb.DeleteAccountSnapshot(batch, hash)
+		}
+		flush()
+	}
+	writeStorage := func(storage []journalStorage) {
+		for _, entry := range storage {
+			for i, storageHash := range entry.Keys {
+				if len(entry.Vals[i]) > 0 {
+					rawdb.WriteStorageSnapshot(batch, entry.Hash, storageHash, entry.Vals[i])
+				} else {
+					rawdb.DeleteStorageSnapshot(batch, entry.Hash, storageHash)
+				}
+				flush()
+			}
+		}
+	}
+
+	if undo {
+		for _, account := range diff.UndoAccounts {
+			writeAccount(account.Hash, account.Blob)
+		}
+		writeStorage(diff.UndoStorage)
+
+		rawdb.WriteSnapshotBlockHash(batch, diff.ParentHash)
+		rawdb.WriteSnapshotRoot(batch, diff.ParentRoot)
+		// The reverted diff layer is no longer flushed
+		rawdb.DeleteSnapshotDiffJournal(batch, seq)
+		if seq > 0 {
+			rawdb.WriteSnapshotDiffJournalHead(batch, seq-1)
+		} else {
+			rawdb.DeleteSnapshotDiffJournalHead(batch)
+		}
+	} else {
+		// Replay the flush as done by diffToDisk
+		for _, hash := range diff.Destructs {
+			rawdb.DeleteAccountSnapshot(batch, hash)
+			it := rawdb.IterateStorageSnapshots(diskdb, hash)
+			for it.Next() {
+				if key := it.Key(); len(key) == 65 {
+					batch.Delete(key)
+					flush()
+				}
+			}
+			it.Release()
+		}
+		for _, account := range diff.Accounts {
+			rawdb.WriteAccountSnapshot(batch, account.Hash, account.Blob)
+			flush()
+		}
+		writeStorage(diff.Storage)
+
+		rawdb.WriteSnapshotBlockHash(batch, diff.BlockHash)
+		rawdb.WriteSnapshotRoot(batch, diff.Root)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write snapshot diff journal recovery", "err", err)
+	}
+}
@@ -0,0 +1,182 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+// snapshotData returns the accounts and storage slots of the snapshot in [db].
+func snapshotData(db ethdb.Iteratee) map[string][]byte {
+	data := make(map[string][]byte)
+	for _, prefix := range [][]byte{rawdb.SnapshotAccountPrefix, rawdb.SnapshotStoragePrefix} {
+		it := db.NewIterator(prefix, nil)
+		for it.Next() {
+			if key := it.Key(); len(key) == 1+common.HashLength || len(key) == 1+2*common.HashLength {
+				data[string(key)] = common.CopyBytes(it.Value())
+			}
+		}
+		it.Release()
+	}
+	return data
+}
+
+// copyDatabase returns a memory database holding the data of [db].
+func copyDatabase(t *testing.T, db ethdb.Database) ethdb.Database {
+	cpy := rawdb.NewMemoryDatabase()
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if err := cpy.Put(it.Key(), it.Value()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cpy
+}
+
+func TestDiffJournalRecovery(t *testing.T) {
+	var (
+		blockHashes = []common.Hash{{0x01}, {0x02}, {0x03}}
+		roots       = []common.Hash{{0xff, 0x01}, {0xff, 0x02}, {0xff, 0x03}}
+		db          = rawdb.NewMemoryDatabase()
+	)
+	// Seed a fully generated disk layer at block 0
+	for hash, blob := range randomAccountSet("0xa1", "0xa2", "0xa3") {
+		rawdb.WriteAccountSnapshot(db, hash, blob)
+	}
+	for accountHash, storage := range randomStorageSet([]string{"0xa1", "0xa2"}, [][]string{{"0x01", "0x02"}, {"0x01"}}, nil) {
+		for storageHash, blob := range storage {
+			rawdb.WriteStorageSnapshot(db, accountHash, storageHash, blob)
+		}
+	}
+	rawdb.WriteSnapshotBlockHash(db, blockHashes[0])
+	rawdb.WriteSnapshotRoot(db, roots[0])
+	journalProgress(db, nil, nil)
+
+	// Flush block 1, destructing an account and updating and deleting slots,
+	// then block 2, destructing and recreating an account
+	snaps := NewTestTree(db, blockHashes[0], roots[0])
+	snaps.verified = true // the roots are not backed by tries
+	dumps := []map[string][]byte{snapshotData(db)}
+	updates := []struct {
+		destructs []string
+		accounts  []string
+		storage   map[common.Hash]map[common.Hash][]byte
+	}{
+		{
+			destructs: []string{"0xa2"},
+			accounts:  []string{"0xa1", "0xa4"},
+			storage:   randomStorageSet([]string{"0xa1"}, [][]string{{"0x01", "0x03"}}, [][]string{{"0x02"}}),
+		},
+		{
+			destructs: []string{"0xa1"},
+			accounts:  []string{"0xa1", "0xa3"},
+			storage:   randomStorageSet([]string{"0xa1"}, [][]string{{"0x05"}}, nil),
+		},
+	}
+	for i, update := range updates {
+		destructs := make(map[common.Hash]struct{})
+		for _, hash := range update.destructs {
+			destructs[common.HexToHash(hash)] = struct{}{}
+		}
+		if err := snaps.Update(blockHashes[i+1], roots[i+1], blockHashes[i], destructs, randomAccountSet(update.accounts...), update.storage); err != nil {
+			t.Fatal(err)
+		}
+		if err := snaps.Flatten(blockHashes[i+1]); err != nil {
+			t.Fatal(err)
+		}
+		dumps = append(dumps, snapshotData(db))
+	}
+
+	tests := map[string]struct {
+		// prepare sets up [db] as left by an unclean shutdown
+		prepare  func(db ethdb.Database)
+		accepted int
+		fails    bool
+	}{
+		"disk at accepted":             {prepare: func(ethdb.Database) {}, accepted: 2},
+		"disk one ahead":               {prepare: func(ethdb.Database) {}, accepted: 1},
+		"disk two ahead":               {prepare: func(ethdb.Database) {}, accepted: 0},
+		"interrupted flush":            {prepare: interruptFlush(dumps[1], dumps[2]), accepted: 2},
+		"interrupted flush, one ahead": {prepare: interruptFlush(dumps[1], dumps[2]), accepted: 1},
+		"interrupted flush, two ahead": {prepare: interruptFlush(dumps[1], dumps[2]), accepted: 0},
+		"no journal": {
+			prepare:  func(db ethdb.Database) { rawdb.DeleteSnapshotDiffJournalHead(db) },
+			accepted: 1,
+			fails:    true,
+		},
+		"generating": {
+			prepare:  func(db ethdb.Database) { journalProgress(db, common.HexToHash("0xa2").Bytes(), nil) },
+			accepted: 1,
+			fails:    true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := copyDatabase(t, db)
+			test.prepare(db)
+
+			_, _, err := loadSnapshot(db, nil, 16, blockHashes[test.accepted], roots[test.accepted])
+			if test.fails {
+				if err == nil {
+					t.Fatal("Expected the snapshot to require regeneration")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(snapshotData(db), dumps[test.accepted]) {
+				t.Fatalf("Expected the snapshot of block %d", test.accepted)
+			}
+
+			// The recovered snapshot is journalled from the accepted block on
+			// and recovered again after flushing blocks above it
+			if test.accepted == 0 {
+				return
+			}
+			if _, _, err := loadSnapshot(db, nil, 16, blockHashes[test.accepted-1], roots[test.accepted-1]); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(snapshotData(db), dumps[test.accepted-1]) {
+				t.Fatalf("Expected the snapshot of block %d", test.accepted-1)
+			}
+		})
+	}
+}
+
+// interruptFlush returns a function leaving a database in the middle of the
+// flush from the state of [before] to the state of [after], which it is in.
+func interruptFlush(before, after map[string][]byte) func(db ethdb.Database) {
+	return func(db ethdb.Database) {
+		rawdb.DeleteSnapshotBlockHash(db)
+		rawdb.DeleteSnapshotRoot(db)
+
+		// Revert every other key written by the flush
+		var i int
+		for key, blob := range after {
+			if reflect.DeepEqual(before[key], blob) {
+				continue
+			}
+			if i++; i%2 == 0 {
+				continue
+			}
+			if previous, ok := before[key]; ok {
+				db.Put([]byte(key), previous)
+			} else {
+				db.Delete([]byte(key))
+			}
+		}
+		for key, previous := range before {
+			if _, ok := after[key]; !ok {
+				db.Put([]byte(key), previous)
+			}
+		}
+	}
+}
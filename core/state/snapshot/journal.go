@@ -58,6 +58,12 @@ type journalGenerator struct {
 // store. If loading the snapshot from disk is successful, this function also
 // returns a boolean indicating whether or not the snapshot is fully generated.
 func loadSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int, blockHash, root common.Hash) (snapshot, bool, error) {
+	// Move the disk layer to the last accepted block with the diff journal if
+	// the node stopped mid-update or before accepting the last flushed block.
+	if err := recoverDiskLayer(diskdb, blockHash); err != nil {
+		snapshotRecoveryFailedMeter.Mark(1)
+		log.Warn("Failed to recover snapshot from diff journal, falling back to regeneration unless the disk layer is at the last accepted block", "err", err)
+	}
 	// Retrieve the block number and hash of the snapshot, failing if no snapshot
 	// is present in the database (or crashed mid-update).
 	baseBlockHash := rawdb.ReadSnapshotBlockHash(diskdb)
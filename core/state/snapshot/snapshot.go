@@ -56,6 +56,10 @@ const (
 )
 
 var (
+	// snapshotRecoveryFailedMeter counts the failures to recover the disk layer
+	// from the diff journal, after which the snapshot may be regenerated
+	snapshotRecoveryFailedMeter = metrics.NewRegisteredMeter("state/snapshot/recovery/failed", nil)
+
 	snapshotCleanAccountHitMeter   = metrics.NewRegisteredMeter("state/snapshot/clean/account/hit", nil)
 	snapshotCleanAccountMissMeter  = metrics.NewRegisteredMeter("state/snapshot/clean/account/miss", nil)
 	snapshotCleanAccountInexMeter  = metrics.NewRegisteredMeter("state/snapshot/clean/account/inex", nil)
@@ -502,6 +506,20 @@ func (t *Tree) NumBlockLayers() int {
 	return len(t.blockLayers)
 }
 
+// AccountList returns the hashes of the accounts modified or deleted by the
+// block with [blockHash], as recorded in its diff layer. The returned boolean
+// is false if the block has no diff layer.
+func (t *Tree) AccountList(blockHash common.Hash) ([]common.Hash, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	diff, ok := t.blockLayers[blockHash].(*diffLayer)
+	if !ok {
+		return nil, false
+	}
+	return diff.AccountList(), true
+}
+
 // Discard removes layers that we no longer need
 func (t *Tree) Discard(blockHash common.Hash) error {
 	t.lock.Lock()
@@ -604,6 +622,17 @@ func diffToDisk(bottom *diffLayer) (*diskLayer, bool, error) {
 	base.stale = true
 	base.lock.Unlock()
 
+	// Record the diff layer in the diff journal before flushing it, so that
+	// the flush can be completed or reverted after an unclean shutdown. The
+	// journal only covers fully generated snapshots.
+	if base.genMarker == nil {
+		if err := journalDiffLayer(base, bottom); err != nil {
+			return nil, false, err
+		}
+	} else {
+		rawdb.DeleteSnapshotDiffJournalHead(batch)
+	}
+
 	// Destroy all the destructed accounts from the database
 	for hash := range bottom.destructSet {
 		// Skip any account not covered yet by the snapshot
@@ -45,6 +45,7 @@ func wipeSnapshot(db ethdb.KeyValueStore, full bool) chan struct{} {
 	if full {
 		rawdb.DeleteSnapshotBlockHash(db)
 		rawdb.DeleteSnapshotRoot(db)
+		rawdb.DeleteSnapshotDiffJournalHead(db)
 	}
 	// Wipe everything else asynchronously
 	wiper := make(chan struct{}, 1)
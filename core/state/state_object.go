@@ -338,10 +338,12 @@ func (s *stateObject) updateTrie(db Database) Trie {
 	usedStorage := make([][]byte, 0, len(s.pendingStorage))
 	for key, value := range s.pendingStorage {
 		// Skip noop changes, persist actual changes
-		if value == s.originStorage[key] {
+		origin := s.originStorage[key]
+		if value == origin {
 			continue
 		}
 		s.originStorage[key] = value
+		s.db.countSlotGrowth(s.address, origin, value)
 
 		var v []byte
 		if (value == common.Hash{}) {
@@ -375,19 +377,6 @@ func (s *stateObject) updateTrie(db Database) Trie {
 	return tr
 }
 
-// UpdateRoot sets the trie root to the current root hash of
-func (s *stateObject) updateRoot(db Database) {
-	// If nothing changed, don't bother with hashing anything
-	if s.updateTrie(db) == nil {
-		return
-	}
-	// Track the amount of time wasted on hashing the storage trie
-	if metrics.EnabledExpensive {
-		defer func(start time.Time) { s.db.StorageHashes += time.Since(start) }(time.Now())
-	}
-	s.data.Root = s.trie.Hash()
-}
-
 // CommitTrie the storage trie of the object to db.
 // This updates the trie root.
 func (s *stateObject) CommitTrie(db Database) (int, error) {
@@ -402,6 +391,13 @@ func (s *stateObject) CommitTrie(db Database) (int, error) {
 	if metrics.EnabledExpensive {
 		defer func(start time.Time) { s.db.StorageCommits += time.Since(start) }(time.Now())
 	}
+	return s.commitTrie()
+}
+
+// commitTrie commits the storage trie of the object, which must hold all its
+// pending storage, and updates the trie root. It does not touch the StateDB,
+// so the storage tries of different objects can be committed concurrently.
+func (s *stateObject) commitTrie() (int, error) {
 	root, committed, err := s.trie.Commit(nil)
 	if err == nil {
 		s.data.Root = root
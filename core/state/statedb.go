@@ -32,6 +32,8 @@ import (
 	"fmt"
 	"math/big"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -78,6 +80,18 @@ type StateDB struct {
 	trie         Trie
 	hasher       crypto.KeccakState
 
+	// Number of goroutines hashing and committing the modified storage tries,
+	// which are processed sequentially if it is not above one
+	storageWorkers int
+
+	// Number of accesses of each account and storage slot, nil unless
+	// TrackAccesses was called
+	accessCounts map[StateKey]uint32
+
+	// Storage slots and code added by each account, nil unless
+	// TrackStorageGrowth was called
+	storageGrowth map[common.Address]*StorageGrowth
+
 	snap          snapshot.Snapshot
 	snapDestructs map[common.Hash]struct{}
 	snapAccounts  map[common.Hash][]byte
@@ -198,6 +212,13 @@ func (s *StateDB) StopPrefetcher() {
 	}
 }
 
+// SetStorageWorkers sets the number of goroutines hashing and committing the
+// modified storage tries before the account trie is updated with their roots.
+// The account trie is always hashed and committed by a single goroutine.
+func (s *StateDB) SetStorageWorkers(workers int) {
+	s.storageWorkers = workers
+}
+
 // setError remembers the first non-nil error it is called with.
 func (s *StateDB) setError(err error) {
 	if s.dbErr == nil {
@@ -342,6 +363,7 @@ func (s *StateDB) GetState(addr common.Address, hash common.Hash) common.Hash {
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		NormalizeStateKey(&hash)
+		s.countSlotAccess(addr, hash)
 		return stateObject.GetState(s.db, hash)
 	}
 	return common.Hash{}
@@ -374,6 +396,7 @@ func (s *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte,
 func (s *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
+		s.countSlotAccess(addr, hash)
 		return stateObject.GetCommittedState(s.db, hash)
 	}
 	return common.Hash{}
@@ -384,6 +407,7 @@ func (s *StateDB) GetCommittedStateAP1(addr common.Address, hash common.Hash) co
 	stateObject := s.getStateObject(addr)
 	if stateObject != nil {
 		NormalizeStateKey(&hash)
+		s.countSlotAccess(addr, hash)
 		return stateObject.GetCommittedState(s.db, hash)
 	}
 	return common.Hash{}
@@ -482,6 +506,7 @@ func (s *StateDB) SetState(addr common.Address, key, value common.Hash) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		NormalizeStateKey(&key)
+		s.countSlotAccess(addr, key)
 		stateObject.SetState(s.db, key, value)
 	}
 }
@@ -569,6 +594,7 @@ func (s *StateDB) getStateObject(addr common.Address) *stateObject {
 // flag set. This is needed by the state journal to revert to the correct s-
 // destructed object instead of wiping all knowledge about the state object.
 func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
+	s.countAccountAccess(addr)
 	// Prefer live objects if any is available
 	if obj := s.stateObjects[addr]; obj != nil {
 		return obj
@@ -717,6 +743,7 @@ func (s *StateDB) Copy() *StateDB {
 	state := &StateDB{
 		db:                  s.db,
 		trie:                s.db.CopyTrie(s.trie),
+		storageWorkers:      s.storageWorkers,
 		stateObjects:        make(map[common.Address]*stateObject, len(s.journal.dirties)),
 		stateObjectsPending: make(map[common.Address]struct{}, len(s.stateObjectsPending)),
 		stateObjectsDirty:   make(map[common.Address]struct{}, len(s.journal.dirties)),
@@ -910,11 +937,17 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	// the account prefetcher. Instead, let's process all the storage updates
 	// first, giving the account prefeches just a few more milliseconds of time
 	// to pull useful data from disk.
+	//
+	// The pending storage is written into the storage tries sequentially, as it
+	// updates the snapshot and the prefetcher, then the tries are hashed
+	// concurrently.
+	hashed := make([]*stateObject, 0, len(s.stateObjectsPending))
 	for addr := range s.stateObjectsPending {
-		if obj := s.stateObjects[addr]; !obj.deleted {
-			obj.updateRoot(s.db)
+		if obj := s.stateObjects[addr]; !obj.deleted && obj.updateTrie(s.db) != nil {
+			hashed = append(hashed, obj)
 		}
 	}
+	s.hashStorageTries(hashed)
 	// Now we're about to start to write changes to the trie. The trie is so far
 	// _untouched_. We can check with the prefetcher, if it can give us a trie
 	// which has the same root, but also has some content loaded into it.
@@ -947,6 +980,72 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	return s.trie.Hash()
 }
 
+// forEachStorageWorker calls [fn] for every index in [0, n), using up to
+// s.storageWorkers goroutines, and returns once every call returned.
+func (s *StateDB) forEachStorageWorker(n int, fn func(i int)) {
+	workers := s.storageWorkers
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var (
+		next int64 = -1
+		wg   sync.WaitGroup
+	)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := int(atomic.AddInt64(&next, 1)); i < n; i = int(atomic.AddInt64(&next, 1)) {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// hashStorageTries sets the storage root of [objs], whose storage tries hold
+// all their pending storage, to the hash of their storage tries.
+func (s *StateDB) hashStorageTries(objs []*stateObject) {
+	// Track the amount of time wasted on hashing the storage tries
+	if metrics.EnabledExpensive {
+		defer func(start time.Time) { s.StorageHashes += time.Since(start) }(time.Now())
+	}
+	s.forEachStorageWorker(len(objs), func(i int) {
+		objs[i].data.Root = objs[i].trie.Hash()
+	})
+}
+
+// commitStorageTries commits the storage tries of [objs], which hold all their
+// pending storage, to the trie database and returns the number of committed
+// nodes. The trie database synchronizes the insertion of the nodes.
+func (s *StateDB) commitStorageTries(objs []*stateObject) (int, error) {
+	// Track the amount of time wasted on committing the storage tries
+	if metrics.EnabledExpensive {
+		defer func(start time.Time) { s.StorageCommits += time.Since(start) }(time.Now())
+	}
+	var (
+		nodes = make([]int, len(objs))
+		errs  = make([]error, len(objs))
+	)
+	s.forEachStorageWorker(len(objs), func(i int) {
+		nodes[i], errs[i] = objs[i].commitTrie()
+	})
+	var committed int
+	for i := range objs {
+		if errs[i] != nil {
+			return 0, errs[i]
+		}
+		committed += nodes[i]
+	}
+	return committed, nil
+}
+
 // Prepare sets the current transaction hash and index which are
 // used when the EVM emits new state logs.
 func (s *StateDB) Prepare(thash common.Hash, ti int) {
@@ -983,23 +1082,30 @@ func (s *StateDB) commit(deleteEmptyObjects bool, snaps *snapshot.Tree, blockHas
 	s.IntermediateRoot(deleteEmptyObjects)
 
 	// Commit objects to the trie, measuring the elapsed time
-	var storageCommitted int
 	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	committed := make([]*stateObject, 0, len(s.stateObjectsDirty))
 	for addr := range s.stateObjectsDirty {
 		if obj := s.stateObjects[addr]; !obj.deleted {
 			// Write any contract code associated with the state object
 			if obj.code != nil && obj.dirtyCode {
 				rawdb.WriteCode(codeWriter, common.BytesToHash(obj.CodeHash()), obj.code)
 				obj.dirtyCode = false
+				s.countCodeGrowth(addr, len(obj.code))
 			}
 			// Write any storage changes in the state object to its storage trie
-			committed, err := obj.CommitTrie(s.db)
-			if err != nil {
-				return common.Hash{}, err
+			if obj.updateTrie(s.db) == nil {
+				continue
 			}
-			storageCommitted += committed
+			if obj.dbErr != nil {
+				return common.Hash{}, obj.dbErr
+			}
+			committed = append(committed, obj)
 		}
 	}
+	storageCommitted, err := s.commitStorageTries(committed)
+	if err != nil {
+		return common.Hash{}, err
+	}
 	if len(s.stateObjectsDirty) > 0 {
 		s.stateObjectsDirty = make(map[common.Address]struct{})
 	}
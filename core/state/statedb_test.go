@@ -1073,3 +1073,141 @@ func TestGenerateMultiCoinAccounts(t *testing.T) {
 		t.Fatalf("Expected asset balance: %v, found %v", assetBalance, actualAssetBalance)
 	}
 }
+
+// storageWorkersState writes [slots] storage slots into each of [contracts]
+// contracts on top of [root], deleting every fourth slot of existing contracts
+// and self-destructing the first one, and commits the result using [workers]
+// goroutines for the storage tries.
+func storageWorkersState(t testing.TB, db Database, root common.Hash, workers, contracts, slots int, round byte) (common.Hash, common.Hash) {
+	state, err := New(root, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.SetStorageWorkers(workers)
+	for i := 0; i < contracts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		state.SetNonce(addr, uint64(round))
+		for j := 0; j < slots; j++ {
+			key := common.BigToHash(big.NewInt(int64(j)))
+			if root != (common.Hash{}) && j%4 == 0 {
+				state.SetState(addr, key, common.Hash{})
+			} else {
+				state.SetState(addr, key, common.Hash{round, byte(i), byte(j)})
+			}
+		}
+	}
+	if root != (common.Hash{}) {
+		state.Suicide(common.BigToAddress(common.Big1))
+	}
+	intermediate := state.IntermediateRoot(true)
+	committed, err := state.Commit(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return intermediate, committed
+}
+
+// Tests that hashing and committing the storage tries concurrently results in
+// the same roots and trie nodes as doing it sequentially.
+func TestStorageWorkers(t *testing.T) {
+	const (
+		contracts = 200
+		slots     = 16
+	)
+	var roots [][4]common.Hash
+	for _, workers := range []int{1, 2, 8, 64} {
+		db := NewDatabase(rawdb.NewMemoryDatabase())
+		var res [4]common.Hash
+		res[0], res[1] = storageWorkersState(t, db, common.Hash{}, workers, contracts, slots, 1)
+		res[2], res[3] = storageWorkersState(t, db, res[1], workers, contracts, slots, 2)
+		if res[0] != res[1] || res[2] != res[3] {
+			t.Fatalf("workers %d: intermediate roots %x, %x differ from committed roots %x, %x", workers, res[0], res[2], res[1], res[3])
+		}
+		roots = append(roots, res)
+
+		// Every node of the committed storage tries must have been inserted
+		state, err := New(res[3], db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < contracts; i++ {
+			addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+			for j := 0; j < slots; j++ {
+				want := common.Hash{2, byte(i), byte(j)}
+				if j%4 == 0 {
+					want = common.Hash{}
+				}
+				if got := state.GetState(addr, common.BigToHash(big.NewInt(int64(j)))); got != want {
+					t.Fatalf("workers %d: contract %d slot %d: expected %x, found %x", workers, i, j, want, got)
+				}
+			}
+		}
+		if err := state.Error(); err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+	}
+	for i := 1; i < len(roots); i++ {
+		if roots[i] != roots[0] {
+			t.Fatalf("roots %x differ from sequential roots %x", roots[i], roots[0])
+		}
+	}
+}
+
+func BenchmarkStorageWorkers(b *testing.B) {
+	const (
+		contracts = 500
+		slots     = 32
+	)
+	for _, workers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			db := NewDatabase(rawdb.NewMemoryDatabase())
+			_, root := storageWorkersState(b, db, common.Hash{}, 1, contracts, slots, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				storageWorkersState(b, db, root, workers, contracts, slots, byte(i+2))
+			}
+		})
+	}
+}
+
+func TestStorageGrowth(t *testing.T) {
+	db := NewDatabase(rawdb.NewMemoryDatabase())
+	state, _ := New(common.Hash{}, db, nil)
+	state.TrackStorageGrowth()
+	var (
+		contract = common.Address{1}
+		other    = common.Address{2}
+		one      = common.Hash{31: 1}
+		two      = common.Hash{31: 2}
+	)
+	state.SetCode(contract, []byte{1, 2, 3})
+	state.SetState(contract, common.Hash{1}, one)
+	state.SetState(contract, common.Hash{2}, one)
+	state.SetState(other, common.Hash{1}, one)
+	state.IntermediateRoot(false)
+	// A slot created and cleared before the commit is counted as created and
+	// deleted, the rewrite of a slot not at all
+	state.SetState(contract, common.Hash{1}, common.Hash{})
+	state.SetState(contract, common.Hash{2}, two)
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[common.Address]StorageGrowth{
+		contract: {SlotsCreated: 2, SlotsDeleted: 1, CodeBytes: 3},
+		other:    {SlotsCreated: 1},
+	}
+	if growth := state.StorageGrowth(); !reflect.DeepEqual(growth, expected) {
+		t.Fatalf("Expected a growth of %+v, found %+v", expected, growth)
+	}
+
+	// The growth is not tracked unless requested
+	state, _ = New(root, db, nil)
+	state.SetState(contract, common.Hash{3}, one)
+	if _, err := state.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+	if growth := state.StorageGrowth(); growth != nil {
+		t.Fatalf("Expected no growth to be tracked, found %+v", growth)
+	}
+}
@@ -0,0 +1,72 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StorageGrowth is the state added and removed by an account.
+type StorageGrowth struct {
+	SlotsCreated uint64 // Storage slots set from zero
+	SlotsDeleted uint64 // Storage slots set to zero
+	CodeBytes    uint64 // Size of the code deployed
+}
+
+// TrackStorageGrowth starts recording the storage slots created and deleted,
+// and the code deployed, by each account as the changes of the state are
+// written to its tries, returned by StorageGrowth. The storage of destructed
+// accounts is not counted, as it is dropped without walking their tries.
+func (s *StateDB) TrackStorageGrowth() {
+	s.storageGrowth = make(map[common.Address]*StorageGrowth)
+}
+
+// StorageGrowth returns the growth of the accounts whose storage or code was
+// written since TrackStorageGrowth was called. Returns nil if the growth is not
+// tracked.
+func (s *StateDB) StorageGrowth() map[common.Address]StorageGrowth {
+	if s.storageGrowth == nil {
+		return nil
+	}
+	growth := make(map[common.Address]StorageGrowth, len(s.storageGrowth))
+	for addr, g := range s.storageGrowth {
+		growth[addr] = *g
+	}
+	return growth
+}
+
+// growthOf returns the growth of [addr], if tracked.
+func (s *StateDB) growthOf(addr common.Address) *StorageGrowth {
+	if s.storageGrowth == nil {
+		return nil
+	}
+	g := s.storageGrowth[addr]
+	if g == nil {
+		g = &StorageGrowth{}
+		s.storageGrowth[addr] = g
+	}
+	return g
+}
+
+// countSlotGrowth counts the write of [value] over [origin] in a storage slot
+// of [addr], if tracked.
+func (s *StateDB) countSlotGrowth(addr common.Address, origin, value common.Hash) {
+	if s.storageGrowth == nil {
+		return
+	}
+	switch {
+	case origin == (common.Hash{}):
+		s.growthOf(addr).SlotsCreated++
+	case value == (common.Hash{}):
+		s.growthOf(addr).SlotsDeleted++
+	}
+}
+
+// countCodeGrowth counts the write of [size] bytes of code of [addr], if
+// tracked.
+func (s *StateDB) countCodeGrowth(addr common.Address, size int) {
+	if g := s.growthOf(addr); g != nil {
+		g.CodeBytes += uint64(size)
+	}
+}
@@ -29,6 +29,7 @@ package core
 import (
 	"math/big"
 	"sync/atomic"
+	"time"
 
 	"github.com/zsmartex/coreth/consensus"
 	"github.com/zsmartex/coreth/core/state"
@@ -93,6 +94,24 @@ func (p *statePrefetcher) Prefetch(block *types.Block, statedb *state.StateDB, c
 	}
 }
 
+// PrefetchKeys reads the accounts and storage slots of [keys] from [statedb],
+// to pull their state into the caches before the main block processor reads
+// them. It stops at [deadline] or once [interrupt] is set, and returns the
+// number of keys read.
+func (p *statePrefetcher) PrefetchKeys(keys []state.StateKey, statedb *state.StateDB, deadline time.Time, interrupt *uint32) int {
+	for i, key := range keys {
+		if atomic.LoadUint32(interrupt) == 1 || !time.Now().Before(deadline) {
+			return i
+		}
+		if key.IsSlot {
+			statedb.GetCommittedState(key.Address, key.Slot)
+		} else {
+			statedb.Exist(key.Address)
+		}
+	}
+	return len(keys)
+}
+
 // precacheTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment. The goal is not to execute
 // the transaction successfully, rather to warm up touched data slots.
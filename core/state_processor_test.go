@@ -27,6 +27,7 @@
 package core
 
 import (
+	"errors"
 	"math/big"
 	"testing"
 
@@ -36,6 +37,7 @@ import (
 	"github.com/zsmartex/coreth/consensus"
 	"github.com/zsmartex/coreth/consensus/dummy"
 	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/core/vm"
 	"github.com/zsmartex/coreth/params"
@@ -349,3 +351,143 @@ func GenerateBadBlock(parent *types.Block, engine consensus.Engine, txs types.Tr
 	// Assemble and return the final block for sealing
 	return types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil), nil, true)
 }
+
+// TestInitCodeLimit tests that the init code limits of the chain config are
+// applied to contract creations from the Init Code Limit upgrade.
+func TestInitCodeLimit(t *testing.T) {
+	var (
+		maxInitCodeSize = uint64(60000) // above the EIP-3860 default
+		initCodeWordGas = uint64(4)
+		config          = *params.TestChainConfig
+		key, _          = crypto.GenerateKey()
+		signer          = types.LatestSigner(params.TestChainConfig)
+		gasPrice        = big.NewInt(params.ApricotPhase3InitialBaseFee)
+		db              = rawdb.NewMemoryDatabase()
+		gspec           = &Genesis{
+			Config: &config,
+			Alloc: GenesisAlloc{
+				crypto.PubkeyToAddress(key.PublicKey): {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))},
+			},
+		}
+	)
+	config.InitCodeLimitBlockTimestamp = big.NewInt(20)
+	config.MaxInitCodeSize = &maxInitCodeSize
+	config.InitCodeWordGas = &initCodeWordGas
+	genesis := gspec.MustCommit(db)
+
+	for _, tt := range []struct {
+		time    uint64
+		size    uint64
+		gasUsed uint64
+		err     error
+	}{
+		{time: 10, size: maxInitCodeSize, gasUsed: params.TxGasContractCreation + 4*maxInitCodeSize},
+		{time: 10, size: maxInitCodeSize + 1, gasUsed: params.TxGasContractCreation + 4*(maxInitCodeSize+1)},
+		{time: 20, size: maxInitCodeSize, gasUsed: params.TxGasContractCreation + 4*maxInitCodeSize + initCodeWordGas*maxInitCodeSize/32},
+		{time: 20, size: maxInitCodeSize + 1, err: ErrMaxInitCodeSizeExceeded},
+	} {
+		statedb, err := state.New(genesis.Root(), state.NewDatabase(db), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := types.SignTx(types.NewContractCreation(0, common.Big0, 1_000_000, gasPrice, make([]byte, tt.size)), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := &types.Header{
+			Number:     common.Big1,
+			Difficulty: common.Big1,
+			Time:       tt.time,
+			GasLimit:   params.ApricotPhase1GasLimit,
+			BaseFee:    gasPrice,
+		}
+		var usedGas uint64
+		receipt, err := ApplyTransaction(&config, nil, &common.Address{}, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, &usedGas, vm.Config{})
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("time %d, size %d: expected error %v, found %v", tt.time, tt.size, tt.err, err)
+		}
+		if err == nil && receipt.GasUsed != tt.gasUsed {
+			t.Fatalf("time %d, size %d: expected gas used %d, found %d", tt.time, tt.size, tt.gasUsed, receipt.GasUsed)
+		}
+	}
+}
+
+// TestDynamicFeeOnly tests that the transactions other than dynamic fee
+// transactions are rejected from the first block after the Dynamic Fee Only
+// upgrade, while they are valid in its parent.
+func TestDynamicFeeOnly(t *testing.T) {
+	var (
+		config   = *params.TestChainConfig
+		key, _   = crypto.GenerateKey()
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		signer   = types.LatestSigner(params.TestChainConfig)
+		gasPrice = big.NewInt(225000000000)
+		db       = rawdb.NewMemoryDatabase()
+		gspec    = &Genesis{
+			Config:   &config,
+			Alloc:    GenesisAlloc{addr: {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))}},
+			GasLimit: params.ApricotPhase1GasLimit,
+		}
+	)
+	// Blocks are generated 10 seconds apart, so the second block is the
+	// first one after the upgrade
+	config.DynamicFeeOnlyBlockTimestamp = big.NewInt(20)
+	genesis := gspec.MustCommit(db)
+	blockchain, err := NewBlockChain(db, DefaultCacheConfig, gspec.Config, dummy.NewFaker(), vm.Config{}, common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+
+	legacyTx := func(nonce uint64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: nonce, To: &common.Address{}, Gas: params.TxGas, GasPrice: gasPrice})
+	}
+	accessListTx := func(nonce uint64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.AccessListTx{ChainID: config.ChainID, Nonce: nonce, To: &common.Address{}, Gas: params.TxGas, GasPrice: gasPrice})
+	}
+	dynamicFeeTx := func(nonce uint64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.DynamicFeeTx{ChainID: config.ChainID, Nonce: nonce, To: &common.Address{}, Gas: params.TxGas, GasFeeCap: gasPrice, GasTipCap: common.Big0})
+	}
+
+	// The legacy transaction is valid in the last block before the upgrade
+	blocks, _, err := GenerateChain(&config, genesis, dummy.NewFaker(), db, 1, 10, func(i int, gen *BlockGen) {
+		gen.AddTx(legacyTx(0))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+	parent := blocks[0]
+
+	// The same kind of transaction is invalid in its child, both when
+	// verifying and building the block
+	for _, tx := range []*types.Transaction{legacyTx(1), accessListTx(1)} {
+		block := GenerateBadBlock(parent, dummy.NewFaker(), types.Transactions{tx}, &config)
+		if _, err := blockchain.InsertChain(types.Blocks{block}); !errors.Is(err, ErrDynamicFeeTxRequired) {
+			t.Fatalf("expected block with tx of type %d to be rejected with %v, found %v", tx.Type(), ErrDynamicFeeTxRequired, err)
+		}
+
+		statedb, err := blockchain.StateAt(parent.Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var usedGas uint64
+		header := block.Header()
+		if _, err := ApplyTransaction(&config, blockchain, &common.Address{}, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, &usedGas, vm.Config{}); !errors.Is(err, ErrDynamicFeeTxRequired) {
+			t.Fatalf("expected tx of type %d to be rejected with %v, found %v", tx.Type(), ErrDynamicFeeTxRequired, err)
+		}
+	}
+
+	// Dynamic fee transactions are still valid
+	blocks, _, err = GenerateChain(&config, parent, dummy.NewFaker(), db, 1, 10, func(i int, gen *BlockGen) {
+		gen.AddTx(dynamicFeeTx(1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -125,7 +125,8 @@ func (result *ExecutionResult) Revert() []byte {
 }
 
 // IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
-func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation bool, isHomestead, isEIP2028 bool) (uint64, error) {
+// [initCodeWordGas] is charged per word of the init code of contract creations.
+func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation bool, isHomestead, isEIP2028 bool, initCodeWordGas uint64) (uint64, error) {
 	// Set the starting gas for the raw transaction
 	var gas uint64
 	if isContractCreation && isHomestead {
@@ -157,6 +158,14 @@ func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation b
 			return 0, ErrGasUintOverflow
 		}
 		gas += z * params.TxDataZeroGas
+
+		if isContractCreation && initCodeWordGas > 0 {
+			words := (uint64(len(data)) + 31) / 32
+			if (math.MaxUint64-gas)/initCodeWordGas < words {
+				return 0, ErrGasUintOverflow
+			}
+			gas += words * initCodeWordGas
+		}
 	}
 	if accessList != nil {
 		gas += uint64(len(accessList)) * params.TxAccessListAddressGas
@@ -306,10 +315,12 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	istanbul := st.evm.ChainConfig().IsIstanbul(st.evm.Context.BlockNumber)
 	apricotPhase1 := st.evm.ChainConfig().IsApricotPhase1(st.evm.Context.Time)
 
+	maxInitCodeSize, initCodeWordGas := st.evm.ChainConfig().InitCodeLimits(st.evm.Context.Time)
+
 	contractCreation := msg.To() == nil
 
 	// Check clauses 4-5, subtract intrinsic gas if everything is correct
-	gas, err := IntrinsicGas(st.data, st.msg.AccessList(), contractCreation, homestead, istanbul)
+	gas, err := IntrinsicGas(st.data, st.msg.AccessList(), contractCreation, homestead, istanbul, initCodeWordGas)
 	if err != nil {
 		return nil, err
 	}
@@ -318,6 +329,11 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	}
 	st.gas -= gas
 
+	// Check whether the init code size has been exceeded.
+	if contractCreation && maxInitCodeSize > 0 && uint64(len(st.data)) > maxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %v limit %v", ErrMaxInitCodeSizeExceeded, len(st.data), maxInitCodeSize)
+	}
+
 	// Check clause 6
 	if msg.Value().Sign() > 0 && !st.evm.Context.CanTransfer(st.state, msg.From(), msg.Value()) {
 		return nil, fmt.Errorf("%w: address %v", ErrInsufficientFundsForTransfer, msg.From().Hex())
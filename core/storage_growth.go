@@ -0,0 +1,25 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/zsmartex/coreth/core/state"
+)
+
+// storageGrowthCacheLimit is the number of recently processed blocks whose
+// storage growth is kept until they are accepted.
+const storageGrowthCacheLimit = 256
+
+// StorageGrowth returns the storage slots and code added by each account in
+// the processed block [hash], or false if the growth of the block is not
+// known, as it is not tracked or the block was processed too long ago.
+func (bc *BlockChain) StorageGrowth(hash common.Hash) (map[common.Address]state.StorageGrowth, bool) {
+	growth, ok := bc.storageGrowth.Get(hash)
+	if !ok {
+		return nil, false
+	}
+	return growth.(map[common.Address]state.StorageGrowth), true
+}
@@ -0,0 +1,41 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// CheckConditional returns an error wrapping ErrConditionNotMet if [cond]
+// does not hold for a transaction included in the block with [header], on top
+// of [statedb].
+func CheckConditional(cond *types.TransactionConditional, header *types.Header, statedb *state.StateDB) error {
+	if !cond.CheckBlockNumber(header.Number) {
+		return fmt.Errorf("%w: block number %d out of bounds", ErrConditionNotMet, header.Number)
+	}
+	if !cond.CheckTimestamp(header.Time) {
+		return fmt.Errorf("%w: timestamp %d out of bounds", ErrConditionNotMet, header.Time)
+	}
+	for addr, account := range cond.KnownAccounts {
+		if account.StorageRoot != nil {
+			root := types.EmptyRootHash
+			if trie := statedb.StorageTrie(addr); trie != nil {
+				root = trie.Hash()
+			}
+			if root != *account.StorageRoot {
+				return fmt.Errorf("%w: storage root of %s is %s, expected %s", ErrConditionNotMet, addr, root, account.StorageRoot)
+			}
+			continue
+		}
+		for slot, expected := range account.StorageSlots {
+			if value := statedb.GetState(addr, slot); value != expected {
+				return fmt.Errorf("%w: slot %s of %s is %s, expected %s", ErrConditionNotMet, slot, addr, value, expected)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// feeLevelDigits is the number of significant digits the fees of the
+// histogram are resolved to, bounding the number of distinct fee levels it
+// aggregates the transactions by.
+const (
+	feeLevelDigits    = 3
+	feeLevelMantissas = 1000 // 10^[feeLevelDigits]
+)
+
+// feeLevel is a fee rounded down to [feeLevelDigits] significant digits,
+// [mantissa] * 10^[exp]. The mantissa of a level of a positive exponent has
+// exactly [feeLevelDigits] digits, so the levels are ordered by exponent
+// first.
+type feeLevel struct {
+	mantissa uint64
+	exp      int
+}
+
+func newFeeLevel(fee *big.Int) feeLevel {
+	if fee.IsUint64() && fee.Uint64() < feeLevelMantissas {
+		return feeLevel{mantissa: fee.Uint64()}
+	}
+	digits := fee.String()
+	mantissa, _ := strconv.ParseUint(digits[:feeLevelDigits], 10, 64)
+	return feeLevel{mantissa: mantissa, exp: len(digits) - feeLevelDigits}
+}
+
+func (l feeLevel) value() *big.Int {
+	v := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(l.exp)), nil)
+	return v.Mul(v, new(big.Int).SetUint64(l.mantissa))
+}
+
+func (l feeLevel) less(o feeLevel) bool {
+	if l.exp != o.exp {
+		return l.exp < o.exp
+	}
+	return l.mantissa < o.mantissa
+}
+
+// feeCell is the tip cap and fee cap levels of transactions.
+type feeCell struct {
+	tip, maxFee feeLevel
+}
+
+// effectiveTip returns the level of the tip paid at [baseFee] by the
+// transactions of [c], or false if their fee cap is below [baseFee].
+func (c feeCell) effectiveTip(baseFee *big.Int) (feeLevel, bool) {
+	if baseFee == nil {
+		return c.tip, true
+	}
+	headroom := new(big.Int).Sub(c.maxFee.value(), baseFee)
+	if headroom.Sign() < 0 {
+		return feeLevel{}, false
+	}
+	if l := newFeeLevel(headroom); l.less(c.tip) {
+		return l, true
+	}
+	return c.tip, true
+}
+
+// feeTotals is the number of transactions and their total gas.
+type feeTotals struct {
+	count int
+	gas   uint64
+}
+
+// update returns the totals with [delta] added, or subtracted if [remove].
+func (t feeTotals) update(delta feeTotals, remove bool) feeTotals {
+	if remove {
+		return feeTotals{count: t.count - delta.count, gas: t.gas - delta.gas}
+	}
+	return feeTotals{count: t.count + delta.count, gas: t.gas + delta.gas}
+}
+
+// updateLevel updates the totals of [l] in [levels] with [delta], deleting it
+// once it has no transactions.
+func updateLevel(levels map[feeLevel]feeTotals, l feeLevel, delta feeTotals, remove bool) {
+	if totals := levels[l].update(delta, remove); totals.count == 0 {
+		delete(levels, l)
+	} else {
+		levels[l] = totals
+	}
+}
+
+// txFeeSet aggregates the fees of a set of transactions by level, updated in
+// constant time as transactions join and leave the set.
+type txFeeSet struct {
+	total        feeTotals
+	cells        map[feeCell]feeTotals
+	maxFees      map[feeLevel]feeTotals
+	tips         map[feeLevel]feeTotals // Effective tips at the base fee
+	belowBaseFee feeTotals              // Transactions of a fee cap below the base fee
+}
+
+func newTxFeeSet() *txFeeSet {
+	return &txFeeSet{
+		cells:   make(map[feeCell]feeTotals),
+		maxFees: make(map[feeLevel]feeTotals),
+		tips:    make(map[feeLevel]feeTotals),
+	}
+}
+
+func (s *txFeeSet) update(tx *types.Transaction, baseFee *big.Int, remove bool) {
+	cell := feeCell{tip: newFeeLevel(tx.GasTipCap()), maxFee: newFeeLevel(tx.GasFeeCap())}
+	delta := feeTotals{count: 1, gas: tx.Gas()}
+	s.total = s.total.update(delta, remove)
+	if totals := s.cells[cell].update(delta, remove); totals.count == 0 {
+		delete(s.cells, cell)
+	} else {
+		s.cells[cell] = totals
+	}
+	updateLevel(s.maxFees, cell.maxFee, delta, remove)
+	if tip, ok := cell.effectiveTip(baseFee); ok {
+		updateLevel(s.tips, tip, delta, remove)
+	} else {
+		s.belowBaseFee = s.belowBaseFee.update(delta, remove)
+	}
+}
+
+// setBaseFee recomputes the effective tips at [baseFee], in the number of
+// distinct levels of the set rather than of its transactions.
+func (s *txFeeSet) setBaseFee(baseFee *big.Int) {
+	s.tips = make(map[feeLevel]feeTotals, len(s.tips))
+	s.belowBaseFee = feeTotals{}
+	for cell, totals := range s.cells {
+		if tip, ok := cell.effectiveTip(baseFee); ok {
+			updateLevel(s.tips, tip, totals, false)
+		} else {
+			s.belowBaseFee = s.belowBaseFee.update(totals, false)
+		}
+	}
+}
+
+// TxFeeBucket is the number of transactions of a fee in [From, To) and their
+// total gas. [To] is nil for the last bucket.
+type TxFeeBucket struct {
+	From, To *big.Int
+	Count    int
+	Gas      uint64
+}
+
+// TxFeeDistribution is the distribution of the fees of a set of transactions
+// of the pool.
+type TxFeeDistribution struct {
+	EffectiveTips []TxFeeBucket // Tips paid at the base fee
+	MaxFees       []TxFeeBucket
+	BelowBaseFee  TxFeeBucket // Transactions of a fee cap below the base fee
+
+	// Tips and fee caps at the requested percentiles, weighted by gas, nil if
+	// there are no transactions. The transactions of a fee cap below the base
+	// fee are not part of the tip percentiles.
+	EffectiveTipPercentiles []*big.Int
+	MaxFeePercentiles       []*big.Int
+}
+
+// TxFeeHistogram is the distribution of the fees of the pending and queued
+// transactions of the pool at its base fee.
+type TxFeeHistogram struct {
+	BaseFee *big.Int // nil before the base fee is active
+	Pending TxFeeDistribution
+	Queued  TxFeeDistribution
+}
+
+func (s *txFeeSet) distribution(bounds []*big.Int, percentiles []float64) TxFeeDistribution {
+	return TxFeeDistribution{
+		EffectiveTips:           feeBuckets(s.tips, bounds),
+		MaxFees:                 feeBuckets(s.maxFees, bounds),
+		BelowBaseFee:            TxFeeBucket{Count: s.belowBaseFee.count, Gas: s.belowBaseFee.gas},
+		EffectiveTipPercentiles: feePercentiles(s.tips, percentiles),
+		MaxFeePercentiles:       feePercentiles(s.maxFees, percentiles),
+	}
+}
+
+// feeBuckets returns the totals of [levels] in the buckets delimited by the
+// ascending [bounds], from 0 to the first bound and from the last bound on.
+func feeBuckets(levels map[feeLevel]feeTotals, bounds []*big.Int) []TxFeeBucket {
+	buckets := make([]TxFeeBucket, len(bounds)+1)
+	buckets[0].From = new(big.Int)
+	for i, bound := range bounds {
+		buckets[i].To = bound
+		buckets[i+1].From = bound
+	}
+	for l, totals := range levels {
+		fee := l.value()
+		i := sort.Search(len(bounds), func(i int) bool { return bounds[i].Cmp(fee) > 0 })
+		buckets[i].Count += totals.count
+		buckets[i].Gas += totals.gas
+	}
+	return buckets
+}
+
+// feePercentiles returns the levels of [levels] at the ascending
+// [percentiles], weighted by gas.
+func feePercentiles(levels map[feeLevel]feeTotals, percentiles []float64) []*big.Int {
+	if len(levels) == 0 {
+		return nil
+	}
+	sorted := make([]feeLevel, 0, len(levels))
+	var totalGas uint64
+	for l, totals := range levels {
+		sorted = append(sorted, l)
+		totalGas += totals.gas
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].less(sorted[j]) })
+
+	results := make([]*big.Int, len(percentiles))
+	var (
+		i      int
+		sumGas = levels[sorted[0]].gas
+	)
+	for j, p := range percentiles {
+		thresholdGas := uint64(float64(totalGas) * p / 100)
+		for sumGas < thresholdGas && i < len(sorted)-1 {
+			i++
+			sumGas += levels[sorted[i]].gas
+		}
+		results[j] = sorted[i].value()
+	}
+	return results
+}
+
+// txFeeHistogram aggregates the fees of the pending and queued transactions
+// of the pool, updated as they join and leave each set and as the base fee
+// changes, so that reading it does not scan the pool.
+type txFeeHistogram struct {
+	baseFee *big.Int
+	pending *txFeeSet
+	queued  *txFeeSet
+}
+
+func newTxFeeHistogram() *txFeeHistogram {
+	return &txFeeHistogram{pending: newTxFeeSet(), queued: newTxFeeSet()}
+}
+
+func (h *txFeeHistogram) addPending(txs ...*types.Transaction) {
+	for _, tx := range txs {
+		h.pending.update(tx, h.baseFee, false)
+	}
+}
+
+func (h *txFeeHistogram) removePending(txs ...*types.Transaction) {
+	for _, tx := range txs {
+		h.pending.update(tx, h.baseFee, true)
+	}
+}
+
+func (h *txFeeHistogram) addQueued(txs ...*types.Transaction) {
+	for _, tx := range txs {
+		h.queued.update(tx, h.baseFee, false)
+	}
+}
+
+func (h *txFeeHistogram) removeQueued(txs ...*types.Transaction) {
+	for _, tx := range txs {
+		h.queued.update(tx, h.baseFee, true)
+	}
+}
+
+func (h *txFeeHistogram) setBaseFee(baseFee *big.Int) {
+	if baseFee == nil || (h.baseFee != nil && h.baseFee.Cmp(baseFee) == 0) {
+		return
+	}
+	h.baseFee = new(big.Int).Set(baseFee)
+	h.pending.setBaseFee(h.baseFee)
+	h.queued.setBaseFee(h.baseFee)
+}
+
+// histogram returns the distributions of the fees in the buckets delimited by
+// the ascending [bounds], with the fees at the ascending [percentiles].
+func (h *txFeeHistogram) histogram(bounds []*big.Int, percentiles []float64) *TxFeeHistogram {
+	histogram := &TxFeeHistogram{
+		Pending: h.pending.distribution(bounds, percentiles),
+		Queued:  h.queued.distribution(bounds, percentiles),
+	}
+	if h.baseFee != nil {
+		histogram.BaseFee = new(big.Int).Set(h.baseFee)
+	}
+	return histogram
+}
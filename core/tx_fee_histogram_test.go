@@ -0,0 +1,161 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// validateTxFeeSet checks that [set] aggregates the fees of the transactions
+// of [lists].
+func validateTxFeeSet(set *txFeeSet, lists map[common.Address]*txList) error {
+	var expected feeTotals
+	for _, list := range lists {
+		for _, tx := range list.Flatten() {
+			expected = expected.update(feeTotals{count: 1, gas: tx.Gas()}, false)
+		}
+	}
+	if set.total != expected {
+		return fmt.Errorf("total %+v != %+v", set.total, expected)
+	}
+	sum := func(levels map[feeLevel]feeTotals) (totals feeTotals) {
+		for _, level := range levels {
+			totals = totals.update(level, false)
+		}
+		return totals
+	}
+	var cells feeTotals
+	for _, cell := range set.cells {
+		cells = cells.update(cell, false)
+	}
+	if cells != expected || sum(set.maxFees) != expected || sum(set.tips).update(set.belowBaseFee, false) != expected {
+		return fmt.Errorf("levels do not add up to %+v", expected)
+	}
+	return nil
+}
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.GWei))
+}
+
+func TestFeeLevel(t *testing.T) {
+	for _, test := range []struct {
+		fee, level *big.Int
+	}{
+		{big.NewInt(0), big.NewInt(0)},
+		{big.NewInt(999), big.NewInt(999)},
+		{big.NewInt(1234), big.NewInt(1230)},
+		{gwei(25), gwei(25)},
+		{new(big.Int).Add(gwei(225), big.NewInt(1)), gwei(225)},
+		{new(big.Int).Lsh(big.NewInt(1), 256), new(big.Int).Mul(big.NewInt(115), new(big.Int).Exp(big.NewInt(10), big.NewInt(75), nil))},
+	} {
+		if level := newFeeLevel(test.fee).value(); level.Cmp(test.level) != 0 {
+			t.Fatalf("Expected the level of %d to be %d, found %d", test.fee, test.level, level)
+		}
+	}
+	if !newFeeLevel(big.NewInt(999)).less(newFeeLevel(big.NewInt(1000))) || newFeeLevel(gwei(2)).less(newFeeLevel(gwei(1))) {
+		t.Fatal("Expected the levels to be ordered by fee")
+	}
+}
+
+func TestTxPoolFeeHistogram(t *testing.T) {
+	t.Parallel()
+
+	pool, _ := setupTxPoolWithConfig(eip1559Config)
+	defer pool.Stop()
+
+	pool.mu.Lock()
+	pool.setBaseFee(gwei(200))
+	pool.mu.Unlock()
+
+	// Pending transactions at nonce 0 and queued ones at nonce 1
+	add := func(nonce uint64, gas uint64, feeCap, tip *big.Int) {
+		t.Helper()
+		key, _ := crypto.GenerateKey()
+		testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+		if err := pool.addRemoteSync(dynamicFeeTx(nonce, gas, feeCap, tip, key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(0, 21000, gwei(300), gwei(1))
+	add(0, 50000, gwei(300), gwei(2))
+	add(0, 100000, gwei(205), gwei(5))
+	add(0, 30000, gwei(230), gwei(10))
+	add(1, 21000, gwei(201), gwei(3))
+	add(1, 40000, gwei(260), gwei(20))
+	if pending, queued := pool.Stats(); pending != 4 || queued != 2 {
+		t.Fatalf("Expected 4 pending and 2 queued transactions, found %d and %d", pending, queued)
+	}
+
+	bounds := []*big.Int{gwei(2), gwei(10), gwei(250)}
+	percentiles := []float64{10, 25, 50, 75, 90}
+	checkBuckets := func(name string, buckets []TxFeeBucket, counts []int, gas []uint64) {
+		t.Helper()
+		if len(buckets) != len(counts) {
+			t.Fatalf("Expected %d %s buckets, found %d", len(counts), name, len(buckets))
+		}
+		for i, bucket := range buckets {
+			if bucket.Count != counts[i] || bucket.Gas != gas[i] {
+				t.Fatalf("Expected %d txs and %d gas in %s bucket %d, found %d and %d", counts[i], gas[i], name, i, bucket.Count, bucket.Gas)
+			}
+		}
+	}
+	checkPercentiles := func(name string, found []*big.Int, expected ...*big.Int) {
+		t.Helper()
+		if len(found) != len(expected) {
+			t.Fatalf("Expected %d %s percentiles, found %d", len(expected), name, len(found))
+		}
+		for i := range found {
+			if found[i].Cmp(expected[i]) != 0 {
+				t.Fatalf("Expected %s percentile %v to be %d, found %d", name, percentiles[i], expected[i], found[i])
+			}
+		}
+	}
+
+	histogram := pool.FeeHistogram(bounds, percentiles)
+	if histogram.BaseFee.Cmp(gwei(200)) != 0 {
+		t.Fatalf("Expected a base fee of 200 gwei, found %d", histogram.BaseFee)
+	}
+	if from, to := histogram.Pending.EffectiveTips[1].From, histogram.Pending.EffectiveTips[1].To; from.Cmp(gwei(2)) != 0 || to.Cmp(gwei(10)) != 0 {
+		t.Fatalf("Expected the second bucket to span [2, 10) gwei, found [%d, %d)", from, to)
+	}
+	checkBuckets("pending tip", histogram.Pending.EffectiveTips, []int{1, 2, 1, 0}, []uint64{21000, 150000, 30000, 0})
+	checkBuckets("pending max fee", histogram.Pending.MaxFees, []int{0, 0, 2, 2}, []uint64{0, 0, 130000, 71000})
+	checkBuckets("queued tip", histogram.Queued.EffectiveTips, []int{1, 0, 1, 0}, []uint64{21000, 0, 40000, 0})
+	checkBuckets("queued max fee", histogram.Queued.MaxFees, []int{0, 0, 1, 1}, []uint64{0, 0, 21000, 40000})
+	if histogram.Pending.BelowBaseFee.Count != 0 || histogram.Queued.BelowBaseFee.Count != 0 {
+		t.Fatal("Expected all the txs to pay the base fee")
+	}
+	checkPercentiles("pending tip", histogram.Pending.EffectiveTipPercentiles, gwei(1), gwei(2), gwei(5), gwei(5), gwei(10))
+	checkPercentiles("pending max fee", histogram.Pending.MaxFeePercentiles, gwei(205), gwei(205), gwei(230), gwei(300), gwei(300))
+
+	// Accepting the block moves the base fee to the initial base fee of 225
+	// gwei, below the fee cap of two txs and paying less tip for another
+	<-pool.requestReset(nil, &types.Header{Number: common.Big0, GasLimit: 10000000})
+	histogram = pool.FeeHistogram(bounds, percentiles)
+	if histogram.BaseFee.Cmp(gwei(225)) != 0 {
+		t.Fatalf("Expected a base fee of 225 gwei, found %d", histogram.BaseFee)
+	}
+	checkBuckets("pending tip", histogram.Pending.EffectiveTips, []int{1, 2, 0, 0}, []uint64{21000, 80000, 0, 0})
+	checkBuckets("pending max fee", histogram.Pending.MaxFees, []int{0, 0, 2, 2}, []uint64{0, 0, 130000, 71000})
+	checkBuckets("queued tip", histogram.Queued.EffectiveTips, []int{0, 0, 1, 0}, []uint64{0, 0, 40000, 0})
+	if below := histogram.Pending.BelowBaseFee; below.Count != 1 || below.Gas != 100000 {
+		t.Fatalf("Expected 1 pending tx of 100000 gas below the base fee, found %d of %d gas", below.Count, below.Gas)
+	}
+	if below := histogram.Queued.BelowBaseFee; below.Count != 1 || below.Gas != 21000 {
+		t.Fatalf("Expected 1 queued tx of 21000 gas below the base fee, found %d of %d gas", below.Count, below.Gas)
+	}
+	checkPercentiles("pending tip", histogram.Pending.EffectiveTipPercentiles, gwei(1), gwei(2), gwei(2), gwei(5), gwei(5))
+
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
@@ -571,9 +571,11 @@ func (l *txPricedList) underpricedFor(h *priceHeap, tx *types.Transaction) bool
 // Discard finds a number of most underpriced transactions, removes them from the
 // priced list and returns them for further removal from the entire pool.
 //
-// Note local transaction won't be considered for eviction.
-func (l *txPricedList) Discard(slots int, force bool) (types.Transactions, bool) {
+// Note local transaction won't be considered for eviction, nor the remote ones
+// [kept] reports true for if it is not nil.
+func (l *txPricedList) Discard(slots int, force bool, kept func(tx *types.Transaction) bool) (types.Transactions, bool) {
 	drop := make(types.Transactions, 0, slots) // Remote underpriced transactions to drop
+	var skipped types.Transactions             // Remote transactions that cannot be dropped
 	for slots > 0 {
 		if len(l.urgent.list)*floatingRatio > len(l.floating.list)*urgentRatio || floatingRatio == 0 {
 			// Discard stale transactions if found during cleanup
@@ -595,11 +597,18 @@ func (l *txPricedList) Discard(slots int, force bool) (types.Transactions, bool)
 				atomic.AddInt64(&l.stales, -1)
 				continue
 			}
-			// Non stale transaction found, discard it
+			// Non stale transaction found, discard it unless it must be kept
+			if kept != nil && kept(tx) {
+				skipped = append(skipped, tx)
+				continue
+			}
 			drop = append(drop, tx)
 			slots -= numSlots(tx)
 		}
 	}
+	for _, tx := range skipped {
+		heap.Push(&l.urgent, tx)
+	}
 	// If we still can't make enough room for the new transaction
 	if slots > 0 && !force {
 		for _, tx := range drop {
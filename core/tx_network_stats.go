@@ -0,0 +1,215 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// TxOrigin is the path by which a transaction first reached the node.
+type TxOrigin uint8
+
+const (
+	TxOriginRPC TxOrigin = iota
+	TxOriginGossip
+)
+
+// txStatsBuckets is the number of buckets of each window of a tracker.
+const txStatsBuckets = 60
+
+// TxNetworkWindow holds the statistics of the transactions seen and included
+// in the blocks accepted during a time window.
+type TxNetworkWindow struct {
+	RPC      uint64 // Transactions first seen via RPC
+	Gossip   uint64 // Transactions first seen via gossip
+	Included uint64 // Tracked transactions included in accepted blocks
+
+	// Total time from first seen to acceptance of the included transactions
+	InclusionLatency time.Duration
+}
+
+// AvgInclusionLatency returns the average time from first seen to acceptance
+// of the transactions included during the window.
+func (w TxNetworkWindow) AvgInclusionLatency() time.Duration {
+	if w.Included == 0 {
+		return 0
+	}
+	return w.InclusionLatency / time.Duration(w.Included)
+}
+
+func (w *TxNetworkWindow) add(o TxNetworkWindow) {
+	w.RPC += o.RPC
+	w.Gossip += o.Gossip
+	w.Included += o.Included
+	w.InclusionLatency += o.InclusionLatency
+}
+
+// TxNetworkStats holds the propagation statistics of a node.
+type TxNetworkStats struct {
+	LastMinute    TxNetworkWindow
+	LastHour      TxNetworkWindow
+	RegossipQueue int // Transactions waiting to be gossiped
+}
+
+// txStatsWindow aggregates statistics over the last [txStatsBuckets] periods
+// of [period], in a ring of buckets.
+type txStatsWindow struct {
+	period  time.Duration
+	buckets [txStatsBuckets]TxNetworkWindow
+	epochs  [txStatsBuckets]int64 // Period of the data of each bucket
+}
+
+// bucket returns the bucket of the period of [now], reset if it holds the
+// data of an older period.
+func (w *txStatsWindow) bucket(now time.Time) *TxNetworkWindow {
+	epoch := now.UnixNano() / int64(w.period)
+	i := epoch % txStatsBuckets
+	if w.epochs[i] != epoch {
+		w.epochs[i] = epoch
+		w.buckets[i] = TxNetworkWindow{}
+	}
+	return &w.buckets[i]
+}
+
+// sum returns the statistics of the last [txStatsBuckets] periods up to [now].
+func (w *txStatsWindow) sum(now time.Time) TxNetworkWindow {
+	epoch := now.UnixNano() / int64(w.period)
+	var total TxNetworkWindow
+	for i := range w.buckets {
+		if epoch-w.epochs[i] < txStatsBuckets {
+			total.add(w.buckets[i])
+		}
+	}
+	return total
+}
+
+// seenTx is a transaction tracked until its inclusion.
+type seenTx struct {
+	hash      common.Hash
+	firstSeen time.Time
+}
+
+// TxNetworkTracker tracks the origin of the transactions reaching the node and
+// their time to inclusion in accepted blocks, over rolling one-minute and
+// one-hour windows. It tracks at most a fixed number of transactions waiting
+// for inclusion, overwriting the oldest ones first, so its memory is bounded.
+//
+// A nil TxNetworkTracker tracks nothing.
+type TxNetworkTracker struct {
+	lock sync.Mutex
+
+	// Transactions waiting for inclusion, indexing the ring [seen]
+	pending map[common.Hash]int
+	seen    []seenTx
+	next    int
+
+	minute, hour  txStatsWindow
+	regossipQueue int
+
+	clock func() time.Time
+}
+
+// NewTxNetworkTracker returns a tracker waiting for the inclusion of at most
+// [capacity] transactions.
+func NewTxNetworkTracker(capacity int) *TxNetworkTracker {
+	return &TxNetworkTracker{
+		pending: make(map[common.Hash]int, capacity),
+		seen:    make([]seenTx, capacity),
+		minute:  txStatsWindow{period: time.Second},
+		hour:    txStatsWindow{period: time.Minute},
+		clock:   time.Now,
+	}
+}
+
+// MarkSeen records [txs] as first reaching the node via [origin]. Transactions
+// already waiting for inclusion are ignored.
+func (t *TxNetworkTracker) MarkSeen(origin TxOrigin, txs ...*types.Transaction) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	minute, hour := t.minute.bucket(now), t.hour.bucket(now)
+	for _, tx := range txs {
+		hash := tx.Hash()
+		if _, ok := t.pending[hash]; ok {
+			continue
+		}
+		if evicted := t.seen[t.next]; evicted.hash != (common.Hash{}) {
+			delete(t.pending, evicted.hash)
+		}
+		t.seen[t.next] = seenTx{hash: hash, firstSeen: now}
+		t.pending[hash] = t.next
+		t.next = (t.next + 1) % len(t.seen)
+
+		switch origin {
+		case TxOriginRPC:
+			minute.RPC++
+			hour.RPC++
+		case TxOriginGossip:
+			minute.Gossip++
+			hour.Gossip++
+		}
+	}
+}
+
+// MarkAccepted records the inclusion of the tracked transactions of [block],
+// which was just accepted.
+func (t *TxNetworkTracker) MarkAccepted(block *types.Block) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	minute, hour := t.minute.bucket(now), t.hour.bucket(now)
+	for _, tx := range block.Transactions() {
+		i, ok := t.pending[tx.Hash()]
+		if !ok {
+			continue
+		}
+		latency := now.Sub(t.seen[i].firstSeen)
+		delete(t.pending, tx.Hash())
+		t.seen[i] = seenTx{}
+
+		minute.Included++
+		minute.InclusionLatency += latency
+		hour.Included++
+		hour.InclusionLatency += latency
+	}
+}
+
+// SetRegossipQueue records the number of transactions waiting to be gossiped.
+func (t *TxNetworkTracker) SetRegossipQueue(size int) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.regossipQueue = size
+}
+
+// Stats returns the current statistics, or nil if [t] is nil.
+func (t *TxNetworkTracker) Stats() *TxNetworkStats {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	return &TxNetworkStats{
+		LastMinute:    t.minute.sum(now),
+		LastHour:      t.hour.sum(now),
+		RegossipQueue: t.regossipQueue,
+	}
+}
@@ -0,0 +1,74 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+func TestTxNetworkTracker(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	tracker := NewTxNetworkTracker(3)
+	tracker.clock = func() time.Time { return now }
+
+	txs := make([]*types.Transaction, 6)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	}
+	acceptedBlock := func(txs ...*types.Transaction) *types.Block {
+		return types.NewBlockWithHeader(&types.Header{}).WithBody(txs, nil, 0, nil)
+	}
+	tracker.MarkSeen(TxOriginRPC, txs[0])
+	tracker.MarkSeen(TxOriginGossip, txs[1], txs[2], txs[0])
+
+	// Accepting [txs[0]] and [txs[1]] 2 and 4 seconds after they were seen
+	now = now.Add(2 * time.Second)
+	tracker.MarkAccepted(acceptedBlock(txs[0]))
+	now = now.Add(2 * time.Second)
+	tracker.MarkAccepted(acceptedBlock(txs[1], txs[0]))
+
+	expected := TxNetworkWindow{RPC: 1, Gossip: 2, Included: 2, InclusionLatency: 6 * time.Second}
+	stats := tracker.Stats()
+	if stats.LastMinute != expected || stats.LastHour != expected {
+		t.Fatalf("Expected %+v over both windows, found %+v and %+v", expected, stats.LastMinute, stats.LastHour)
+	}
+	if latency := stats.LastMinute.AvgInclusionLatency(); latency != 3*time.Second {
+		t.Fatalf("Expected an average inclusion latency of 3s, found %s", latency)
+	}
+
+	// The minute window no longer holds the data after a minute
+	now = now.Add(time.Minute)
+	stats = tracker.Stats()
+	if stats.LastMinute != (TxNetworkWindow{}) || stats.LastHour != expected {
+		t.Fatalf("Expected only the hour window to hold the data, found %+v and %+v", stats.LastMinute, stats.LastHour)
+	}
+
+	// Tracking more txs than the capacity overwrites the oldest ones, so
+	// [txs[2]] is no longer included
+	tracker.MarkSeen(TxOriginGossip, txs[3], txs[4], txs[5])
+	tracker.MarkAccepted(acceptedBlock(txs[2:]...))
+	if stats = tracker.Stats(); stats.LastMinute.Included != 3 {
+		t.Fatalf("Expected the 3 txs within the capacity to be included, found %d", stats.LastMinute.Included)
+	}
+	if len(tracker.pending) != 0 {
+		t.Fatalf("Expected no tx waiting for inclusion, found %d", len(tracker.pending))
+	}
+
+	// The hour window no longer holds the data after an hour
+	now = now.Add(time.Hour)
+	if stats = tracker.Stats(); stats.LastHour != (TxNetworkWindow{}) {
+		t.Fatalf("Expected no data in the hour window, found %+v", stats.LastHour)
+	}
+
+	var nilTracker *TxNetworkTracker
+	nilTracker.MarkSeen(TxOriginRPC, txs[0])
+	if nilTracker.Stats() != nil {
+		t.Fatal("Expected no stats from a nil tracker")
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"math/rand"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -96,8 +97,50 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrTxPoolPressure is returned if a transaction is rejected before being
+	// added to the pool because the node is overloaded. It is not an error of
+	// the transaction, which can be submitted again after a backoff.
+	ErrTxPoolPressure = errors.New("txpool under pressure")
+
+	// ErrConditionNotMet is returned if a transaction submitted with conditions
+	// is rejected because they do not hold.
+	ErrConditionNotMet = errors.New("transaction conditions not met")
 )
 
+// TxPoolPressureError is the ErrTxPoolPressure returned when the pressure on
+// the node exceeds the threshold above which transactions are rejected,
+// suggesting when to submit the transaction again.
+type TxPoolPressureError struct {
+	Pressure   float64
+	Threshold  float64
+	RetryAfter time.Duration
+}
+
+func (e *TxPoolPressureError) Error() string {
+	return fmt.Sprintf("%s: pressure %.4f above threshold %.4f, retry after %s", ErrTxPoolPressure, e.Pressure, e.Threshold, e.RetryAfter)
+}
+
+func (e *TxPoolPressureError) Unwrap() error {
+	return ErrTxPoolPressure
+}
+
+// TxTipFloorError is the ErrUnderpriced returned when the gas tip cap of a
+// remote transaction is below the minimum tip required for its weight.
+type TxTipFloorError struct {
+	Weight    uint64 // bytes of calldata and access list
+	Required  *big.Int
+	GasTipCap *big.Int
+}
+
+func (e *TxTipFloorError) Error() string {
+	return fmt.Sprintf("%s: gas tip cap (%d) < required tip (%d) for a tx weight of %d bytes", ErrUnderpriced, e.GasTipCap, e.Required, e.Weight)
+}
+
+func (e *TxTipFloorError) Unwrap() error {
+	return ErrUnderpriced
+}
+
 var (
 	evictionInterval      = time.Minute      // Time interval to check for evictable transactions
 	statsReportInterval   = 8 * time.Second  // Time interval to report transaction pool stats
@@ -172,12 +215,30 @@ type TxPoolConfig struct {
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
+	// Minimum gas tip cap of remote transactions, growing with their weight:
+	// TipFloorBase + TipFloorPerByte x bytes of calldata and access list. It
+	// never lowers the flat floor of the pool.
+	TipFloorBase    uint64
+	TipFloorPerByte uint64
+
+	// Senders whose transactions are kept in PrivilegedSlots slots reserved
+	// for them, which the transactions of other senders cannot evict. The
+	// transactions of the privileged senders exceeding the reservation are
+	// treated as any other.
+	Privileged      []common.Address
+	PrivilegedSlots uint64
+
 	AccountSlots uint64 // Number of executable transaction slots guaranteed per account
 	GlobalSlots  uint64 // Maximum number of executable transaction slots for all accounts
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	// Fraction of the admitted transactions also checked against the
+	// consensus rules, to detect the fee rules of the pool drifting from
+	// those of block verification. 0 disables the checks.
+	InvariantCheckRate float64
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -233,6 +294,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.InvariantCheckRate < 0 || conf.InvariantCheckRate > 1 {
+		log.Warn("Sanitizing invalid txpool invariant check rate", "provided", conf.InvariantCheckRate, "updated", DefaultTxPoolConfig.InvariantCheckRate)
+		conf.InvariantCheckRate = DefaultTxPoolConfig.InvariantCheckRate
+	}
 	return conf
 }
 
@@ -260,6 +325,11 @@ type TxPool struct {
 	eip2718  bool // Fork indicator whether we are using EIP-2718 type transactions.
 	eip1559  bool // Fork indicator whether we are using EIP-1559 type transactions.
 
+	dynamicFeeOnly bool // Fork indicator whether only dynamic fee transactions are allowed.
+
+	maxInitCodeSize uint64 // Maximum init code size of creation transactions, 0 if unlimited.
+	initCodeWordGas uint64 // Gas charged per word of the init code of creation transactions.
+
 	currentHead *types.Header
 	// [currentState] is the state of the blockchain head. It is reset whenever
 	// head changes.
@@ -270,9 +340,20 @@ type TxPool struct {
 
 	pendingNonces *txNoncer // Pending state tracking virtual nonces
 	currentMaxGas uint64    // Current gas limit for transaction caps
+	skipFeeChecks bool      // Whether the transactions being added are exempt from the fee checks, set under [mu]
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	invariantHook func(tx *types.Transaction, err error) // Called with the outcome of each consensus check in tests
+
+	locals     *accountSet // Set of local transaction to exempt from eviction rules
+	privileged *accountSet // Set of senders given the reserved slots of the pool
+	journal    *txJournal  // Journal of local transaction to back up to disk
+
+	networkStats *TxNetworkTracker     // Propagation statistics, nil if not tracked
+	propagation  *TxPropagationTracker // Propagation of the local transactions, nil if not tracked
+
+	// Conditions of the transactions submitted with conditions, which may
+	// include removed transactions until the next reorg
+	conditionals map[common.Hash]*types.TransactionConditional
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
@@ -280,6 +361,8 @@ type TxPool struct {
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
 
+	feeHistogram *txFeeHistogram // Fees of the pending and queued transactions
+
 	chainHeadCh         chan ChainHeadEvent
 	chainHeadSub        event.Subscription
 	reqResetCh          chan *txpoolResetRequest
@@ -315,6 +398,8 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:               make(map[common.Address]*txList),
 		beats:               make(map[common.Address]time.Time),
 		all:                 newTxLookup(),
+		feeHistogram:        newTxFeeHistogram(),
+		conditionals:        make(map[common.Hash]*types.TransactionConditional),
 		chainHeadCh:         make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:          make(chan *txpoolResetRequest),
 		reqPromoteCh:        make(chan *accountSet),
@@ -330,6 +415,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
 	}
+	pool.privileged = newAccountSet(pool.signer, config.Privileged...)
 	pool.priced = newTxPricedList(pool.all)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
@@ -481,6 +567,12 @@ func (pool *TxPool) GasPrice() *big.Int {
 	return new(big.Int).Set(pool.gasPrice)
 }
 
+// PriceBump returns the minimum price bump percentage required to replace an
+// already existing transaction with the same nonce.
+func (pool *TxPool) PriceBump() uint64 {
+	return pool.config.PriceBump
+}
+
 // SetGasPrice updates the minimum price required by the transaction pool for a
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
@@ -518,6 +610,11 @@ func (pool *TxPool) Nonce(addr common.Address) uint64 {
 	return pool.pendingNonces.get(addr)
 }
 
+// MaxTxSize returns the maximum size of the transactions accepted by the pool.
+func (pool *TxPool) MaxTxSize() uint64 {
+	return txMaxSize
+}
+
 // Stats retrieves the current pool stats, namely the number of pending and the
 // number of queued (non-executable) transactions.
 func (pool *TxPool) Stats() (int, int) {
@@ -541,6 +638,66 @@ func (pool *TxPool) stats() (int, int) {
 	return pending, queued
 }
 
+// Occupancy returns the fraction of the capacity of the pool used by its
+// transaction slots, and the fraction of the executable slots used by the
+// pending transactions awaiting inclusion in a block.
+func (pool *TxPool) Occupancy() (slots float64, pending float64) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pendingTxs, _ := pool.stats()
+	slots = float64(pool.all.Slots()) / float64(pool.config.GlobalSlots+pool.config.GlobalQueue)
+	pending = float64(pendingTxs) / float64(pool.config.GlobalSlots)
+	return slots, pending
+}
+
+// SetNetworkStats sets the tracker of the propagation statistics of the
+// transactions of the pool.
+func (pool *TxPool) SetNetworkStats(tracker *TxNetworkTracker) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.networkStats = tracker
+}
+
+// NetworkStats returns the tracker of the propagation statistics of the
+// transactions of the pool, or nil if they are not tracked.
+func (pool *TxPool) NetworkStats() *TxNetworkTracker {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.networkStats
+}
+
+// SetPropagation sets the tracker of the propagation of the locally submitted
+// transactions of the pool.
+func (pool *TxPool) SetPropagation(tracker *TxPropagationTracker) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.propagation = tracker
+}
+
+// Propagation returns the tracker of the propagation of the locally submitted
+// transactions of the pool, or nil if it is not tracked.
+func (pool *TxPool) Propagation() *TxPropagationTracker {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.propagation
+}
+
+// FeeHistogram returns the distribution of the fees of the pending and queued
+// transactions at the current base fee, in the buckets delimited by the
+// ascending [bounds] with the fees at the ascending [percentiles]. The fees are
+// rounded down to 3 significant digits.
+func (pool *TxPool) FeeHistogram(bounds []*big.Int, percentiles []float64) *TxFeeHistogram {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.feeHistogram.histogram(bounds, percentiles)
+}
+
 // Content retrieves the data content of the transaction pool, returning all the
 // pending as well as queued transactions, grouped by account and sorted by nonce.
 func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
@@ -586,6 +743,11 @@ func (pool *TxPool) Pending(enforceTips bool) map[common.Address]types.Transacti
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
+	return pool.pendingTxs(enforceTips)
+}
+
+// pendingTxs is Pending, assuming the pool lock is held.
+func (pool *TxPool) pendingTxs(enforceTips bool) map[common.Address]types.Transactions {
 	pending := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.pending {
 		txs := list.Flatten()
@@ -606,6 +768,37 @@ func (pool *TxPool) Pending(enforceTips bool) map[common.Address]types.Transacti
 	return pending
 }
 
+// PendingSnapshot is a consistent view of the transactions of the pool, along
+// with the senders the block builder commits first.
+type PendingSnapshot struct {
+	// Executable holds the pending transactions the block builder considers,
+	// as returned by Pending(true), and Pending all of them.
+	Executable map[common.Address]types.Transactions
+	Pending    map[common.Address]types.Transactions
+	Queued     map[common.Address]types.Transactions
+	Locals     []common.Address
+	Privileged []common.Address
+}
+
+// Snapshot returns the transactions of the pool and its local and privileged
+// senders, all taken under the same lock.
+func (pool *TxPool) Snapshot() *PendingSnapshot {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	snapshot := &PendingSnapshot{
+		Executable: pool.pendingTxs(true),
+		Pending:    pool.pendingTxs(false),
+		Queued:     make(map[common.Address]types.Transactions),
+		Locals:     pool.locals.flatten(),
+		Privileged: pool.privileged.flatten(),
+	}
+	for addr, list := range pool.queue {
+		snapshot.Queued[addr] = list.Flatten()
+	}
+	return snapshot
+}
+
 // Locals retrieves the accounts currently considered local by the pool.
 func (pool *TxPool) Locals() []common.Address {
 	pool.mu.Lock()
@@ -617,6 +810,9 @@ func (pool *TxPool) Locals() []common.Address {
 // local retrieves all currently known local transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
+//
+// The transactions submitted with conditions are left out, as they are not
+// journaled: their conditions would not be restored with them.
 func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
@@ -626,6 +822,15 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 		if queued := pool.queue[addr]; queued != nil {
 			txs[addr] = append(txs[addr], queued.Flatten()...)
 		}
+		if len(pool.conditionals) > 0 {
+			unconditional := txs[addr][:0]
+			for _, tx := range txs[addr] {
+				if pool.conditionals[tx.Hash()] == nil {
+					unconditional = append(unconditional, tx)
+				}
+			}
+			txs[addr] = unconditional
+		}
 	}
 	return txs
 }
@@ -647,11 +852,15 @@ func (pool *TxPool) CheckNonceOrdering(from common.Address, txNonce uint64) erro
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	// Accept only legacy transactions until EIP-2718/2930 activates.
 	if !pool.eip2718 && tx.Type() != types.LegacyTxType {
-		return ErrTxTypeNotSupported
+		return types.NewUnsupportedTxTypeError(tx.Type(), txTypeForks[tx.Type()])
 	}
 	// Reject dynamic fee transactions until EIP-1559 activates.
 	if !pool.eip1559 && tx.Type() == types.DynamicFeeTxType {
-		return ErrTxTypeNotSupported
+		return types.NewUnsupportedTxTypeError(tx.Type(), txTypeForks[tx.Type()])
+	}
+	// Reject the other transactions once the Dynamic Fee Only upgrade activates.
+	if pool.dynamicFeeOnly && tx.Type() != types.DynamicFeeTxType {
+		return &DynamicFeeTxRequiredError{Type: tx.Type(), Activation: pool.chainconfig.DynamicFeeOnlyBlockTimestamp.Uint64()}
 	}
 	// Reject transactions over defined size to prevent DOS attacks
 	if uint64(tx.Size()) > txMaxSize {
@@ -680,14 +889,20 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	// Make sure the transaction is signed properly.
 	from, err := types.Sender(pool.signer, tx)
 	if err != nil {
-		return ErrInvalidSender
+		return pool.senderError(tx, err)
 	}
 	// Drop non-local transactions under our own minimal accepted gas price or tip
-	if !local && tx.GasTipCapIntCmp(pool.gasPrice) < 0 {
+	if !local && !pool.skipFeeChecks && tx.GasTipCapIntCmp(pool.gasPrice) < 0 {
 		return fmt.Errorf("%w: address %s have gas tip cap (%d) < pool gas tip cap (%d)", ErrUnderpriced, from.Hex(), tx.GasTipCap(), pool.gasPrice)
 	}
+	// Drop non-local transactions under the minimum tip required for their weight
+	if !local && !pool.skipFeeChecks {
+		if weight, required := pool.requiredTip(tx); tx.GasTipCapIntCmp(required) < 0 {
+			return &TxTipFloorError{Weight: weight, Required: required, GasTipCap: tx.GasTipCap()}
+		}
+	}
 	// Drop the transaction if the gas fee cap is below the pool's minimum fee
-	if pool.minimumFee != nil && tx.GasFeeCapIntCmp(pool.minimumFee) < 0 {
+	if pool.minimumFee != nil && !pool.skipFeeChecks && tx.GasFeeCapIntCmp(pool.minimumFee) < 0 {
 		return fmt.Errorf("%w: address %s have gas fee cap (%d) < pool minimum fee cap (%d)", ErrUnderpriced, from.Hex(), tx.GasFeeCap(), pool.minimumFee)
 	}
 	// Ensure the transaction adheres to nonce ordering
@@ -703,16 +918,55 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	}
 	pool.currentStateLock.Unlock()
 	// Ensure the transaction has more gas than the basic tx fee.
-	intrGas, err := IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, true, pool.istanbul)
+	intrGas, err := IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, true, pool.istanbul, pool.initCodeWordGas)
 	if err != nil {
 		return err
 	}
 	if txGas := tx.Gas(); txGas < intrGas {
 		return fmt.Errorf("%w: address %v tx gas (%v) < intrinsic gas (%v)", ErrIntrinsicGas, from.Hex(), tx.Gas(), intrGas)
 	}
+	// Ensure the init code of a creation transaction is within the limit.
+	if tx.To() == nil && pool.maxInitCodeSize > 0 && uint64(len(tx.Data())) > pool.maxInitCodeSize {
+		return fmt.Errorf("%w: code size %v limit %v", ErrMaxInitCodeSizeExceeded, len(tx.Data()), pool.maxInitCodeSize)
+	}
 	return nil
 }
 
+// requiredTip returns the weight of [tx], in bytes of calldata and access
+// list, and the minimum tip required for it by the tip floor policy.
+func (pool *TxPool) requiredTip(tx *types.Transaction) (uint64, *big.Int) {
+	weight := uint64(len(tx.Data()))
+	for _, tuple := range tx.AccessList() {
+		weight += common.AddressLength + uint64(len(tuple.StorageKeys))*common.HashLength
+	}
+	required := new(big.Int).SetUint64(pool.config.TipFloorPerByte)
+	required.Mul(required, new(big.Int).SetUint64(weight))
+	required.Add(required, new(big.Int).SetUint64(pool.config.TipFloorBase))
+	return weight, required
+}
+
+// txTypeForks names the upgrades activating the typed transactions supported by
+// the pool.
+var txTypeForks = map[uint8]string{
+	types.AccessListTxType: "ApricotPhase2",
+	types.DynamicFeeTxType: "ApricotPhase3",
+}
+
+// senderError returns the error rejecting [tx], whose sender could not be
+// recovered due to [err]. Transactions signed for another chain, or of a type
+// that is not active yet, are told apart from transactions with an invalid
+// signature.
+func (pool *TxPool) senderError(tx *types.Transaction, err error) error {
+	switch {
+	case errors.Is(err, types.ErrInvalidChainId):
+		return fmt.Errorf("%w: have %d, want %d", types.ErrInvalidChainId, tx.ChainId(), pool.chainconfig.ChainID)
+	case errors.Is(err, types.ErrTxTypeNotSupported):
+		return types.NewUnsupportedTxTypeError(tx.Type(), txTypeForks[tx.Type()])
+	default:
+		return ErrInvalidSender
+	}
+}
+
 // add validates a transaction and inserts it into the non-executable queue for later
 // pending promotion and execution. If the transaction is a replacement for an already
 // pending or queued one, it overwrites the previous transaction if its price is higher.
@@ -738,10 +992,17 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		invalidTxMeter.Mark(1)
 		return false, err
 	}
+	if pool.config.InvariantCheckRate > 0 && !pool.skipFeeChecks && rand.Float64() < pool.config.InvariantCheckRate {
+		pool.checkConsensusRules(tx)
+	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(pool.all.Slots()+numSlots(tx)) > pool.config.GlobalSlots+pool.config.GlobalQueue {
+		// The transactions of the privileged senders fitting in their
+		// reservation make room for themselves like the local ones
+		reserved := pool.privileged.containsTx(tx) && pool.withinReservation(numSlots(tx))
+
 		// If the new transaction is underpriced, don't accept it
-		if !isLocal && pool.priced.Underpriced(tx) {
+		if !isLocal && !reserved && !pool.skipFeeChecks && pool.priced.Underpriced(tx) {
 			log.Trace("Discarding underpriced transaction", "hash", hash, "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
 			return false, ErrUnderpriced
@@ -758,10 +1019,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		// New transaction is better than our worse ones, make room for it.
 		// If it's a local transaction, forcibly discard all available transactions.
 		// Otherwise if we can't make enough room for new one, abort the operation.
-		drop, success := pool.priced.Discard(pool.all.Slots()-int(pool.config.GlobalSlots+pool.config.GlobalQueue)+numSlots(tx), isLocal)
+		drop, success := pool.priced.Discard(pool.all.Slots()-int(pool.config.GlobalSlots+pool.config.GlobalQueue)+numSlots(tx), isLocal || reserved, pool.reservedTx())
 
 		// Special case, we still can't make the room for the new remote one.
-		if !isLocal && !success {
+		if !isLocal && !reserved && !success {
 			log.Trace("Discarding overflown transaction", "hash", hash)
 			overflowedTxMeter.Mark(1)
 			return false, ErrTxPoolOverflow
@@ -784,12 +1045,15 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pendingDiscardMeter.Mark(1)
 			return false, ErrReplaceUnderpriced
 		}
+		tx.SetAdmitted(time.Now())
 		// New transaction is better, replace old one
 		if old != nil {
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
+			pool.feeHistogram.removePending(old)
 			pendingReplaceMeter.Mark(1)
 		}
+		pool.feeHistogram.addPending(tx)
 		pool.all.Add(tx, isLocal)
 		pool.priced.Put(tx, isLocal)
 		pool.journalTx(from, tx)
@@ -805,6 +1069,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	if err != nil {
 		return false, err
 	}
+	tx.SetAdmitted(time.Now())
 	// Mark local addresses and journal local transactions
 	if local && !pool.locals.contains(from) {
 		log.Info("Setting new local account", "address", from)
@@ -839,11 +1104,13 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	if old != nil {
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
+		pool.feeHistogram.removeQueued(old)
 		queuedReplaceMeter.Mark(1)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
 	}
+	pool.feeHistogram.addQueued(tx)
 	// If the transaction isn't in lookup set but it's expected to be there,
 	// show the error log.
 	if pool.all.Get(hash) == nil && !addAll {
@@ -867,6 +1134,10 @@ func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
 	if pool.journal == nil || !pool.locals.contains(from) {
 		return
 	}
+	// Transactions submitted with conditions are not journaled
+	if pool.conditionals[tx.Hash()] != nil {
+		return
+	}
 	if err := pool.journal.insert(tx); err != nil {
 		log.Warn("Failed to journal local transaction", "err", err)
 	}
@@ -895,11 +1166,13 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	if old != nil {
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
+		pool.feeHistogram.removePending(old)
 		pendingReplaceMeter.Mark(1)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
 	}
+	pool.feeHistogram.addPending(tx)
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.pendingNonces.set(addr, tx.Nonce()+1)
 
@@ -914,7 +1187,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 // This method is used to add transactions from the RPC API and performs synchronous pool
 // reorganization and event propagation.
 func (pool *TxPool) AddLocals(txs []*types.Transaction) []error {
-	return pool.addTxs(txs, !pool.config.NoLocals, true)
+	return pool.addTxs(txs, !pool.config.NoLocals, true, false)
 }
 
 // AddLocal enqueues a single local transaction into the pool if it is valid. This is
@@ -930,12 +1203,73 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 // This method is used to add transactions from the p2p network and does not wait for pool
 // reorganization and internal event propagation.
 func (pool *TxPool) AddRemotes(txs []*types.Transaction) []error {
-	return pool.addTxs(txs, false, false)
+	return pool.addTxs(txs, false, false, false)
 }
 
 // This is like AddRemotes, but waits for pool reorganization. Tests use this method.
 func (pool *TxPool) AddRemotesSync(txs []*types.Transaction) []error {
-	return pool.addTxs(txs, false, true)
+	return pool.addTxs(txs, false, true, false)
+}
+
+// AddRestored enqueues a batch of transactions restored from a snapshot of a
+// pool, marked as local if [local], and waits for pool reorganization. If
+// [skipFeeChecks], the transactions are exempt from the pricing constraints of
+// the pool so that its state can be reproduced exactly, while the other
+// validation rules still apply.
+//
+// The time the transactions were first seen is preserved.
+func (pool *TxPool) AddRestored(txs []*types.Transaction, local, skipFeeChecks bool) []error {
+	return pool.addTxs(txs, local && !pool.config.NoLocals, true, skipFeeChecks)
+}
+
+// AddConditional enqueues a single transaction submitted with [cond] as a
+// remote transaction, and waits for pool reorganization. The conditions are
+// kept with the transaction for the block builder to check, see
+// Conditionals. The transaction is not journaled.
+func (pool *TxPool) AddConditional(tx *types.Transaction, cond *types.TransactionConditional) error {
+	hash := tx.Hash()
+	pool.mu.Lock()
+	if pool.all.Get(hash) != nil {
+		pool.mu.Unlock()
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	// The conditions are set first, so that the transaction is never pending
+	// without them
+	pool.conditionals[hash] = cond
+	pool.mu.Unlock()
+
+	if err := pool.addRemoteSync(tx); err != nil {
+		pool.mu.Lock()
+		if pool.conditionals[hash] == cond {
+			delete(pool.conditionals, hash)
+		}
+		pool.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Conditionals returns the conditions of the transactions submitted with
+// conditions, by hash. The returned map is a copy.
+func (pool *TxPool) Conditionals() map[common.Hash]*types.TransactionConditional {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	conditionals := make(map[common.Hash]*types.TransactionConditional, len(pool.conditionals))
+	for hash, cond := range pool.conditionals {
+		conditionals[hash] = cond
+	}
+	return conditionals
+}
+
+// Conditional returns the conditions [hash] was submitted with, or nil if it
+// was submitted without conditions.
+func (pool *TxPool) Conditional(hash common.Hash) *types.TransactionConditional {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.conditionals[hash]
 }
 
 // This is like AddRemotes with a single transaction, but waits for pool reorganization. Tests use this method.
@@ -954,7 +1288,7 @@ func (pool *TxPool) AddRemote(tx *types.Transaction) error {
 }
 
 // addTxs attempts to queue a batch of transactions if they are valid.
-func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
+func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync, skipFeeChecks bool) []error {
 	// Filter out known ones without obtaining the pool lock or recovering signatures
 	var (
 		errs = make([]error, len(txs))
@@ -972,7 +1306,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		// obtaining lock
 		_, err := types.Sender(pool.signer, tx)
 		if err != nil {
-			errs[i] = ErrInvalidSender
+			errs[i] = pool.senderError(tx, err)
 			invalidTxMeter.Mark(1)
 			continue
 		}
@@ -985,7 +1319,9 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
+	pool.skipFeeChecks = skipFeeChecks
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	pool.skipFeeChecks = false
 	pool.mu.Unlock()
 
 	var nilSlot = 0
@@ -1094,6 +1430,8 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 			pool.pendingNonces.setIfLower(addr, tx.Nonce())
 			// Reduce the pending counter
 			pendingGauge.Dec(int64(1 + len(invalids)))
+			pool.feeHistogram.removePending(tx)
+			pool.feeHistogram.removePending(invalids...)
 			return
 		}
 	}
@@ -1102,6 +1440,7 @@ func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
 		if removed, _ := future.Remove(tx); removed {
 			// Reduce the queued counter
 			queuedGauge.Dec(1)
+			pool.feeHistogram.removeQueued(tx)
 		}
 		if future.Empty() {
 			delete(pool.queue, addr)
@@ -1255,7 +1594,7 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		if reset.newHead != nil && pool.chainconfig.IsApricotPhase3(new(big.Int).SetUint64(reset.newHead.Time)) {
 			_, baseFeeEstimate, err := dummy.EstimateNextBaseFee(pool.chainconfig, reset.newHead, uint64(time.Now().Unix()))
 			if err == nil {
-				pool.priced.SetBaseFee(baseFeeEstimate)
+				pool.setBaseFee(baseFeeEstimate)
 			}
 		}
 
@@ -1271,6 +1610,13 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	pool.truncatePending()
 	pool.truncateQueue()
 
+	// Forget the conditions of the transactions that left the pool
+	for hash := range pool.conditionals {
+		if pool.all.Get(hash) == nil {
+			delete(pool.conditionals, hash)
+		}
+	}
+
 	dropBetweenReorgHistogram.Update(int64(pool.changesSinceReorg))
 	pool.changesSinceReorg = 0 // Reset change counter
 	pool.mu.Unlock()
@@ -1390,6 +1736,27 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	timestamp := new(big.Int).SetUint64(newHead.Time)
 	pool.eip2718 = pool.chainconfig.IsApricotPhase2(timestamp)
 	pool.eip1559 = pool.chainconfig.IsApricotPhase3(timestamp)
+	pool.maxInitCodeSize, pool.initCodeWordGas = pool.chainconfig.InitCodeLimits(timestamp)
+
+	// Evict the transactions no longer allowed once the Dynamic Fee Only
+	// upgrade activates.
+	dynamicFeeOnly := pool.chainconfig.IsDynamicFeeOnly(timestamp)
+	if dynamicFeeOnly && !pool.dynamicFeeOnly {
+		var evicted []common.Hash
+		pool.all.Range(func(hash common.Hash, tx *types.Transaction, local bool) bool {
+			if tx.Type() != types.DynamicFeeTxType {
+				evicted = append(evicted, hash)
+			}
+			return true
+		}, true, true)
+		for _, hash := range evicted {
+			pool.removeTx(hash, true)
+		}
+		if len(evicted) > 0 {
+			log.Info("Evicted transactions other than dynamic fee transactions", "count", len(evicted))
+		}
+	}
+	pool.dynamicFeeOnly = dynamicFeeOnly
 }
 
 // promoteExecutables moves transactions that have become processable from the
@@ -1434,6 +1801,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		}
 		log.Trace("Promoted queued transactions", "count", len(promoted))
 		queuedGauge.Dec(int64(len(readies)))
+		pool.feeHistogram.removeQueued(readies...)
 
 		// Drop all transactions over the allowed limit
 		var caps types.Transactions
@@ -1449,6 +1817,9 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		// Mark all the items dropped as removed
 		pool.priced.Removed(len(forwards) + len(drops) + len(caps))
 		queuedGauge.Dec(int64(len(forwards) + len(drops) + len(caps)))
+		pool.feeHistogram.removeQueued(forwards...)
+		pool.feeHistogram.removeQueued(drops...)
+		pool.feeHistogram.removeQueued(caps...)
 		if pool.locals.contains(addr) {
 			localGauge.Dec(int64(len(forwards) + len(drops) + len(caps)))
 		}
@@ -1461,6 +1832,67 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 	return promoted
 }
 
+// SetPrivileged replaces the senders whose transactions are kept in the slots
+// reserved for them, logging the changes.
+func (pool *TxPool) SetPrivileged(addrs []common.Address) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	privileged := newAccountSet(pool.signer, addrs...)
+	for addr := range privileged.accounts {
+		if !pool.privileged.contains(addr) {
+			log.Info("Setting new privileged sender", "address", addr)
+		}
+	}
+	for addr := range pool.privileged.accounts {
+		if !privileged.contains(addr) {
+			log.Info("Removing privileged sender", "address", addr)
+		}
+	}
+	pool.privileged = privileged
+}
+
+// Privileged returns the senders whose transactions are kept in the slots
+// reserved for them.
+func (pool *TxPool) Privileged() []common.Address {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.privileged.flatten()
+}
+
+// withinReservation returns true if the transactions of the privileged
+// senders fit in the slots reserved for them with [slots] more.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) withinReservation(slots int) bool {
+	if pool.config.PrivilegedSlots == 0 || pool.privileged.empty() {
+		return false
+	}
+	for addr := range pool.privileged.accounts {
+		for _, list := range []*txList{pool.pending[addr], pool.queue[addr]} {
+			if list == nil {
+				continue
+			}
+			for _, tx := range list.Flatten() {
+				slots += numSlots(tx)
+			}
+		}
+	}
+	return uint64(slots) <= pool.config.PrivilegedSlots
+}
+
+// reservedTx returns a function reporting whether a transaction is kept in
+// the slots reserved for the privileged senders, or nil if none is.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) reservedTx() func(tx *types.Transaction) bool {
+	if !pool.withinReservation(0) {
+		return nil
+	}
+	return pool.privileged.containsTx
+}
+
 // truncatePending removes transactions from the pending queue if the pool is above the
 // pending limit. The algorithm tries to reduce transaction counts by an approximately
 // equal number for all for accounts with many pending transactions.
@@ -1476,9 +1908,10 @@ func (pool *TxPool) truncatePending() {
 	pendingBeforeCap := pending
 	// Assemble a spam order to penalize large transactors first
 	spammers := prque.New(nil)
+	reserved := pool.withinReservation(0)
 	for addr, list := range pool.pending {
 		// Only evict transactions from high rollers
-		if !pool.locals.contains(addr) && uint64(list.Len()) > pool.config.AccountSlots {
+		if !pool.locals.contains(addr) && !(reserved && pool.privileged.contains(addr)) && uint64(list.Len()) > pool.config.AccountSlots {
 			spammers.Push(addr, int64(list.Len()))
 		}
 	}
@@ -1511,6 +1944,7 @@ func (pool *TxPool) truncatePending() {
 					}
 					pool.priced.Removed(len(caps))
 					pendingGauge.Dec(int64(len(caps)))
+					pool.feeHistogram.removePending(caps...)
 					if pool.locals.contains(offenders[i]) {
 						localGauge.Dec(int64(len(caps)))
 					}
@@ -1538,6 +1972,7 @@ func (pool *TxPool) truncatePending() {
 				}
 				pool.priced.Removed(len(caps))
 				pendingGauge.Dec(int64(len(caps)))
+				pool.feeHistogram.removePending(caps...)
 				if pool.locals.contains(addr) {
 					localGauge.Dec(int64(len(caps)))
 				}
@@ -1560,8 +1995,9 @@ func (pool *TxPool) truncateQueue() {
 
 	// Sort all accounts with queued transactions by heartbeat
 	addresses := make(addressesByHeartbeat, 0, len(pool.queue))
+	reserved := pool.withinReservation(0)
 	for addr := range pool.queue {
-		if !pool.locals.contains(addr) { // don't drop locals
+		if !pool.locals.contains(addr) && !(reserved && pool.privileged.contains(addr)) { // don't drop locals or reserved slots
 			addresses = append(addresses, addressByHeartbeat{addr, pool.beats[addr]})
 		}
 	}
@@ -1623,6 +2059,9 @@ func (pool *TxPool) demoteUnexecutables() {
 			pool.all.Remove(hash)
 		}
 		pendingNofundsMeter.Mark(int64(len(drops)))
+		pool.feeHistogram.removePending(olds...)
+		pool.feeHistogram.removePending(drops...)
+		pool.feeHistogram.removePending(invalids...)
 
 		for _, tx := range invalids {
 			hash := tx.Hash()
@@ -1638,6 +2077,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		// If there's a gap in front, alert (should never happen) and postpone all transactions
 		if list.Len() > 0 && list.txs.Get(nonce) == nil {
 			gapped := list.Cap(0)
+			pool.feeHistogram.removePending(gapped...)
 			for _, tx := range gapped {
 				hash := tx.Hash()
 				log.Error("Demoting invalidated transaction", "hash", hash)
@@ -1692,13 +2132,22 @@ func (pool *TxPool) periodicBaseFeeUpdate() {
 	}
 }
 
+// setBaseFee sets the base fee the transactions are priced and their fees
+// aggregated at.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) setBaseFee(baseFee *big.Int) {
+	pool.priced.SetBaseFee(baseFee)
+	pool.feeHistogram.setBaseFee(baseFee)
+}
+
 func (pool *TxPool) updateBaseFee() {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
 	_, baseFeeEstimate, err := dummy.EstimateNextBaseFee(pool.chainconfig, pool.currentHead, uint64(time.Now().Unix()))
 	if err == nil {
-		pool.priced.SetBaseFee(baseFeeEstimate)
+		pool.setBaseFee(baseFeeEstimate)
 	} else {
 		log.Error("failed to update base fee", "currentHead", pool.currentHead.Hash(), "err", err)
 	}
@@ -0,0 +1,98 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/coreth/consensus"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+)
+
+var (
+	invariantCheckedMeter   = metrics.NewRegisteredMeter("txpool/invariant/checked", nil)
+	invariantDivergentMeter = metrics.NewRegisteredMeter("txpool/invariant/divergent", nil)
+)
+
+// poolChainContext serves the headers of the chain of the pool to the EVM of
+// the consensus checks.
+type poolChainContext struct{ chain blockChain }
+
+func (c poolChainContext) Engine() consensus.Engine { return nil }
+
+func (c poolChainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if block := c.chain.GetBlock(hash, number); block != nil {
+		return block.Header()
+	}
+	return nil
+}
+
+// checkConsensusRules applies [tx], admitted to the pool, on a copy of the
+// current state in a block built on the current head, as block verification
+// would. The base fee of the block is the lowest allowed by the rules at its
+// time, as the pool keeps the transactions that become executable once the
+// base fee falls. A divergence is reported if block verification rejects
+// [tx].
+//
+// Only the transactions executable on the current state are checked, as the
+// others depend on the transactions they follow. Assumes [pool.mu] is held.
+func (pool *TxPool) checkConsensusRules(tx *types.Transaction) {
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	pool.currentStateLock.Lock()
+	if pool.currentState.GetNonce(from) != tx.Nonce() {
+		pool.currentStateLock.Unlock()
+		return
+	}
+	statedb := pool.currentState.Copy()
+	pool.currentStateLock.Unlock()
+
+	head := pool.currentHead
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Coinbase:   head.Coinbase,
+		Number:     new(big.Int).Add(head.Number, common.Big1),
+		GasLimit:   head.GasLimit,
+		Time:       uint64(time.Now().Unix()),
+		Difficulty: common.Big1,
+	}
+	if header.Time < head.Time {
+		header.Time = head.Time
+	}
+	header.BaseFee = dummy.MinBaseFee(pool.chainconfig, header.Time)
+
+	invariantCheckedMeter.Mark(1)
+	err := pool.applyConsensusRules(tx, header, statedb)
+	if pool.invariantHook != nil {
+		pool.invariantHook(tx, err)
+	}
+	if err != nil {
+		invariantDivergentMeter.Mark(1)
+		log.Error("Transaction pool admitted a transaction rejected by the consensus rules",
+			"hash", tx.Hash(), "from", from, "nonce", tx.Nonce(), "type", tx.Type(),
+			"gas", tx.Gas(), "gasFeeCap", tx.GasFeeCap(), "gasTipCap", tx.GasTipCap(), "value", tx.Value(),
+			"number", header.Number, "time", header.Time, "baseFee", header.BaseFee, "err", err)
+	}
+}
+
+// applyConsensusRules returns the error rejecting [tx] in the block with
+// [header] on top of [statedb], which is modified.
+func (pool *TxPool) applyConsensusRules(tx *types.Transaction, header *types.Header, statedb *state.StateDB) error {
+	signer := types.MakeSigner(pool.chainconfig, header.Number, new(big.Int).SetUint64(header.Time))
+	msg, err := tx.AsMessage(signer, header.BaseFee)
+	if err != nil {
+		return err
+	}
+	blockContext := NewEVMBlockContext(header, poolChainContext{pool.chain}, &header.Coinbase)
+	evm := vm.NewEVM(blockContext, NewEVMTxContext(msg), statedb, pool.chainconfig, vm.Config{})
+	_, err = ApplyMessage(evm, msg, new(GasPool).AddGas(header.GasLimit))
+	return err
+}
@@ -42,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/zsmartex/coreth/consensus/dummy"
 	"github.com/zsmartex/coreth/core/rawdb"
 	"github.com/zsmartex/coreth/core/state"
 	"github.com/zsmartex/coreth/core/types"
@@ -186,6 +187,13 @@ func validateTxPoolInternals(pool *TxPool) error {
 	if priced != remote {
 		return fmt.Errorf("total priced transaction count %d != %d", priced, remote)
 	}
+	// Ensure the fee histogram aggregates the pending and queued transactions
+	if err := validateTxFeeSet(pool.feeHistogram.pending, pool.pending); err != nil {
+		return fmt.Errorf("pending fee histogram: %w", err)
+	}
+	if err := validateTxFeeSet(pool.feeHistogram.queued, pool.queue); err != nil {
+		return fmt.Errorf("queued fee histogram: %w", err)
+	}
 	// Ensure the next nonce to assign is the correct one
 	for addr, txs := range pool.pending {
 		// Find the last transaction
@@ -1281,6 +1289,294 @@ func TestTransactionAllowedTxSize(t *testing.T) {
 	}
 }
 
+// Tests that the init code of contract creations is limited, and charged for,
+// only once the Init Code Limit upgrade is active at the head of the chain.
+func TestTransactionInitCodeLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		maxInitCodeSize = uint64(60000) // above the EIP-3860 default
+		initCodeWordGas = uint64(4)
+		// Intrinsic gas of a creation with [maxInitCodeSize] zero bytes of init code
+		intrinsicGas = params.TxGasContractCreation + params.TxDataZeroGas*maxInitCodeSize
+		wordGas      = initCodeWordGas * maxInitCodeSize / 32
+	)
+	creation := func(nonce uint64, gasLimit uint64, size uint64, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignTx(types.NewContractCreation(nonce, common.Big0, gasLimit, big.NewInt(1), make([]byte, size)), types.HomesteadSigner{}, key)
+		return tx
+	}
+	for _, tt := range []struct {
+		name     string
+		upgrade  *big.Int
+		gasLimit uint64
+		size     uint64
+		err      error
+	}{
+		{name: "before upgrade at limit", upgrade: big.NewInt(1), gasLimit: intrinsicGas, size: maxInitCodeSize},
+		{name: "before upgrade above limit", upgrade: big.NewInt(1), gasLimit: intrinsicGas + params.TxDataZeroGas, size: maxInitCodeSize + 1},
+		{name: "after upgrade at limit", upgrade: big.NewInt(0), gasLimit: intrinsicGas + wordGas, size: maxInitCodeSize},
+		{name: "after upgrade without word gas", upgrade: big.NewInt(0), gasLimit: intrinsicGas + wordGas - 1, size: maxInitCodeSize, err: ErrIntrinsicGas},
+		{name: "after upgrade above limit", upgrade: big.NewInt(0), gasLimit: 1_000_000, size: maxInitCodeSize + 1, err: ErrMaxInitCodeSizeExceeded},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *params.TestChainConfig
+			config.InitCodeLimitBlockTimestamp = tt.upgrade
+			config.MaxInitCodeSize = &maxInitCodeSize
+			config.InitCodeWordGas = &initCodeWordGas
+
+			pool, key := setupTxPoolWithConfig(&config)
+			defer pool.Stop()
+			testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+			if err := pool.addRemoteSync(creation(0, tt.gasLimit, tt.size, key)); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, found %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// Tests that the minimum tip of remote transactions grows with their weight,
+// while light transactions and local transactions only need the flat floor.
+func TestTransactionTipFloor(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := newTestBlockchain(statedb, 10000000, new(event.Feed))
+
+	config := testTxPoolConfig
+	config.TipFloorBase = 1
+	config.TipFloorPerByte = 10
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	<-pool.initDoneCh
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+	// A small transfer is admitted at the flat floor
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add a small transfer at the flat floor: %v", err)
+	}
+
+	// A 100KB calldata transaction is rejected until its tip meets the
+	// requirement for its weight
+	var (
+		dataSize = uint64(100 * 1024)
+		gasLimit = params.TxGas + params.TxDataNonZeroGasEIP2028*dataSize
+		required = big.NewInt(int64(config.TipFloorBase + config.TipFloorPerByte*dataSize))
+	)
+	for _, tip := range []*big.Int{big.NewInt(1), new(big.Int).Sub(required, common.Big1)} {
+		err := pool.addRemoteSync(pricedDataTransaction(1, gasLimit, tip, key, dataSize))
+		var floorErr *TxTipFloorError
+		if !errors.As(err, &floorErr) || !errors.Is(err, ErrUnderpriced) {
+			t.Fatalf("expected a tip floor error for tip %d, found %v", tip, err)
+		}
+		if floorErr.Weight != dataSize || floorErr.Required.Cmp(required) != 0 || floorErr.GasTipCap.Cmp(tip) != 0 {
+			t.Fatalf("unexpected tip floor error %v", floorErr)
+		}
+	}
+	if err := pool.addRemoteSync(pricedDataTransaction(1, gasLimit, required, key, dataSize)); err != nil {
+		t.Fatalf("failed to add a heavy transaction at the required tip: %v", err)
+	}
+
+	// The access list counts towards the weight
+	accessList := types.AccessList{{Address: common.Address{1}, StorageKeys: []common.Hash{{1}, {2}}}}
+	accessListTx := func(tip *big.Int) *types.Transaction {
+		tx, _ := types.SignNewTx(key, types.LatestSignerForChainID(params.TestChainConfig.ChainID), &types.AccessListTx{
+			ChainID:    params.TestChainConfig.ChainID,
+			Nonce:      2,
+			GasPrice:   tip,
+			Gas:        100000,
+			To:         &common.Address{},
+			AccessList: accessList,
+		})
+		return tx
+	}
+	accessListRequired := big.NewInt(int64(config.TipFloorBase + config.TipFloorPerByte*(common.AddressLength+2*common.HashLength)))
+	if err := pool.addRemoteSync(accessListTx(new(big.Int).Sub(accessListRequired, common.Big1))); !errors.Is(err, ErrUnderpriced) {
+		t.Fatalf("expected an access list transaction below the required tip to be underpriced, found %v", err)
+	}
+	if err := pool.addRemoteSync(accessListTx(accessListRequired)); err != nil {
+		t.Fatalf("failed to add an access list transaction at the required tip: %v", err)
+	}
+
+	// Local transactions are not subject to the tip floor
+	if err := pool.AddLocal(pricedDataTransaction(3, gasLimit, big.NewInt(1), key, dataSize)); err != nil {
+		t.Fatalf("failed to add a heavy local transaction at the flat floor: %v", err)
+	}
+}
+
+// Tests that restored transactions keep their origin and first seen time, and
+// are exempt from the pricing constraints only if requested.
+func TestTransactionAddRestored(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+	pool.SetGasPrice(big.NewInt(2))
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+	firstSeen := time.Unix(1_600_000_000, 0)
+	tx := pricedTransaction(0, 100000, big.NewInt(1), key)
+	tx.SetFirstSeen(firstSeen)
+	if err := pool.AddRestored([]*types.Transaction{tx}, false, false)[0]; !errors.Is(err, ErrUnderpriced) {
+		t.Fatalf("expected an underpriced restored transaction to be rejected, found %v", err)
+	}
+	if err := pool.AddRestored([]*types.Transaction{tx}, false, true)[0]; err != nil {
+		t.Fatalf("failed to restore an underpriced transaction skipping the fee checks: %v", err)
+	}
+	if pool.HasLocal(tx.Hash()) {
+		t.Fatal("expected the restored transaction to remain remote")
+	}
+	if seen := pool.Get(tx.Hash()).FirstSeen(); !seen.Equal(firstSeen) {
+		t.Fatalf("expected the first seen time %v to be preserved, found %v", firstSeen, seen)
+	}
+
+	// The fee checks are only skipped for the restored transactions
+	if err := pool.addRemoteSync(pricedTransaction(1, 100000, big.NewInt(1), key)); !errors.Is(err, ErrUnderpriced) {
+		t.Fatalf("expected an underpriced remote transaction to be rejected, found %v", err)
+	}
+	// The other validation rules still apply
+	if err := pool.AddRestored([]*types.Transaction{pricedTransaction(1, 100000, big.NewInt(params.Ether), key)}, false, true)[0]; !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("expected a restored transaction exceeding the balance to be rejected, found %v", err)
+	}
+	local := pricedTransaction(1, 100000, big.NewInt(1), key)
+	if err := pool.AddRestored([]*types.Transaction{local}, true, false)[0]; err != nil {
+		t.Fatalf("failed to restore a local transaction: %v", err)
+	}
+	if !pool.HasLocal(local.Hash()) {
+		t.Fatal("expected the restored transaction to be local")
+	}
+	if pending, queued := pool.Stats(); pending != 2 || queued != 0 {
+		t.Fatalf("expected 2 pending and 0 queued transactions, found %d and %d", pending, queued)
+	}
+}
+
+// Tests that the transactions are stamped with the time they are admitted to
+// the pool, pending or queued, and that the rejected ones are not.
+func TestTransactionAdmissionTime(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+	before := time.Now()
+	pending, queued := transaction(0, 100000, key), transaction(2, 100000, key)
+	for _, tx := range []*types.Transaction{pending, queued} {
+		tx.SetFirstSeen(time.Unix(1_600_000_000, 0))
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+		if admitted := pool.Get(tx.Hash()).Admitted(); admitted.Before(before) {
+			t.Fatalf("expected the transaction to be admitted after %v, found %v", before, admitted)
+		}
+	}
+	underpriced := pricedTransaction(0, 90000, big.NewInt(1), key)
+	if err := pool.addRemoteSync(underpriced); !errors.Is(err, ErrReplaceUnderpriced) {
+		t.Fatalf("expected the replacement to be underpriced, found %v", err)
+	}
+	if !underpriced.Admitted().IsZero() {
+		t.Fatalf("expected the rejected transaction not to be admitted, found %v", underpriced.Admitted())
+	}
+}
+
+// Tests that transactions signed for another chain and transactions of a type
+// not active yet are rejected with errors naming the cause.
+func TestTransactionChainIDAndTypeErrors(t *testing.T) {
+	t.Parallel()
+
+	config := *params.TestApricotPhase1Config
+	config.ChainID = big.NewInt(43112)
+	pool, key := setupTxPoolWithConfig(&config)
+	defer pool.Stop()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+	wrongChain, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), 100000, big.NewInt(params.GWei*300), nil), types.NewEIP155Signer(big.NewInt(1)), key)
+	err := pool.addRemoteSync(wrongChain)
+	if !errors.Is(err, types.ErrInvalidChainId) {
+		t.Fatalf("expected %v, found %v", types.ErrInvalidChainId, err)
+	}
+	if want := "invalid chain id for signer: have 1, want 43112"; err.Error() != want {
+		t.Fatalf("expected error %q, found %q", want, err)
+	}
+
+	accessList, _ := types.SignNewTx(key, types.LatestSignerForChainID(config.ChainID), &types.AccessListTx{
+		ChainID:  config.ChainID,
+		Gas:      100000,
+		GasPrice: big.NewInt(params.GWei * 300),
+		To:       &common.Address{},
+	})
+	err = pool.addRemoteSync(accessList)
+	var typeErr *types.UnsupportedTxTypeError
+	if !errors.As(err, &typeErr) || typeErr.Type != types.AccessListTxType || typeErr.Fork != "ApricotPhase2" {
+		t.Fatalf("expected access list tx to require ApricotPhase2, found %v", err)
+	}
+	if !errors.Is(err, ErrTxTypeNotSupported) {
+		t.Fatalf("expected %v, found %v", ErrTxTypeNotSupported, err)
+	}
+}
+
+// Tests that the transactions other than dynamic fee transactions are rejected,
+// and evicted, once the Dynamic Fee Only upgrade is active at the head of the
+// chain.
+func TestTransactionDynamicFeeOnly(t *testing.T) {
+	t.Parallel()
+
+	config := *params.TestChainConfig
+	config.DynamicFeeOnlyBlockTimestamp = big.NewInt(20)
+	pool, key := setupTxPoolWithConfig(&config)
+	defer pool.Stop()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+
+	accessListTx, _ := types.SignNewTx(key, types.LatestSignerForChainID(config.ChainID), &types.AccessListTx{
+		ChainID:  config.ChainID,
+		Nonce:    1,
+		To:       &common.Address{},
+		Gas:      100000,
+		GasPrice: big.NewInt(1),
+	})
+	txs := []*types.Transaction{
+		pricedTransaction(0, 100000, big.NewInt(1), key),
+		accessListTx,
+		dynamicFeeTx(2, 100000, big.NewInt(1), big.NewInt(1), key),
+	}
+	for i, err := range pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("tx %d: failed to add transaction before the upgrade: %v", i, err)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 0 {
+		t.Fatalf("pending/queued transactions mismatched: have %d/%d, want %d/%d", pending, queued, 3, 0)
+	}
+
+	// Once the head of the chain is at the upgrade, the legacy and access list
+	// transactions are evicted, leaving the dynamic fee transaction queued
+	<-pool.requestReset(nil, &types.Header{Number: common.Big1, GasLimit: 10000000, Time: 20})
+	if pending, queued := pool.Stats(); pending != 0 || queued != 1 {
+		t.Fatalf("pending/queued transactions mismatched: have %d/%d, want %d/%d", pending, queued, 0, 1)
+	}
+	if pool.Get(txs[2].Hash()) == nil {
+		t.Fatal("dynamic fee transaction evicted")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+
+	// They are rejected, reporting the upgrade
+	err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), key))
+	var requiredErr *DynamicFeeTxRequiredError
+	if !errors.As(err, &requiredErr) || !errors.Is(err, ErrDynamicFeeTxRequired) {
+		t.Fatalf("expected error %v, found %v", ErrDynamicFeeTxRequired, err)
+	}
+	if requiredErr.Type != types.LegacyTxType || requiredErr.Activation != 20 {
+		t.Fatalf("expected the rejection of a legacy tx at the upgrade at 20, found type %d at %d", requiredErr.Type, requiredErr.Activation)
+	}
+	if err := pool.addRemoteSync(dynamicFeeTx(0, 100000, big.NewInt(1), big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add dynamic fee transaction after the upgrade: %v", err)
+	}
+}
+
 // Tests that if transactions start being capped, transactions are also removed from 'all'
 func TestTransactionCapClearsFromAll(t *testing.T) {
 	t.Parallel()
@@ -1791,6 +2087,75 @@ func TestTransactionPoolUnderpricing(t *testing.T) {
 // Tests that more expensive transactions push out cheap ones from the pool, but
 // without producing instability by creating gaps that start jumping transactions
 // back and forth between queued/pending.
+// Tests that the transactions of the privileged senders are admitted to a full
+// pool and kept in it within their reserved slots, regardless of their price.
+func TestTransactionPoolPrivilegedSlots(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := newTestBlockchain(statedb, 1000000, new(event.Feed))
+
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	privileged := crypto.PubkeyToAddress(keys[0].PublicKey)
+
+	config := testTxPoolConfig
+	config.GlobalSlots = 2
+	config.GlobalQueue = 2
+	config.Privileged = []common.Address{privileged}
+	config.PrivilegedSlots = 1
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	for _, key := range keys {
+		testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	// Fill the pool with expensive spam
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		if err := pool.addRemoteSync(pricedTransaction(nonce, 100000, big.NewInt(10), keys[1])); err != nil {
+			t.Fatalf("failed to add spam transaction %d: %v", nonce, err)
+		}
+	}
+	// A cheap transaction is refused, unless it is privileged
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), keys[2])); err != ErrUnderpriced {
+		t.Fatalf("adding underpriced transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	tx := pricedTransaction(0, 100000, big.NewInt(1), keys[0])
+	if err := pool.addRemoteSync(tx); err != nil {
+		t.Fatalf("failed to add privileged transaction: %v", err)
+	}
+	// More expensive spam does not evict it
+	for nonce := uint64(0); nonce < 4; nonce++ {
+		if err := pool.addRemoteSync(pricedTransaction(nonce, 100000, big.NewInt(20), keys[3])); err != nil {
+			t.Fatalf("failed to add spam transaction %d: %v", nonce, err)
+		}
+	}
+	if pool.Get(tx.Hash()) == nil {
+		t.Fatal("privileged transaction evicted")
+	}
+	// The privileged transactions beyond the reservation are treated as any other
+	if err := pool.addRemoteSync(pricedTransaction(1, 100000, big.NewInt(1), keys[0])); err != ErrUnderpriced {
+		t.Fatalf("adding underpriced transaction beyond the reservation error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Once the sender is no longer privileged, its transaction can be evicted
+	pool.SetPrivileged(nil)
+	if err := pool.addRemoteSync(pricedTransaction(4, 100000, big.NewInt(30), keys[3])); err != nil {
+		t.Fatalf("failed to add spam transaction: %v", err)
+	}
+	if pool.Get(tx.Hash()) != nil {
+		t.Fatal("formerly privileged transaction not evicted")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 func TestTransactionPoolStableUnderpricing(t *testing.T) {
 	t.Parallel()
 
@@ -2466,6 +2831,73 @@ func TestTransactionSlotCount(t *testing.T) {
 	}
 }
 
+// Tests that the transactions admitted by a pool whose minimum fee drifts below
+// the minimum base fee of the consensus rules are reported by the invariant
+// checks, while those of a pool agreeing with the consensus rules are not.
+func TestTransactionInvariantChecks(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := newTestBlockchain(statedb, 10000000, new(event.Feed))
+	config := testTxPoolConfig
+	config.InvariantCheckRate = 1
+	pool := NewTxPool(config, eip1559Config, blockchain)
+	defer pool.Stop()
+	<-pool.initDoneCh
+
+	var (
+		checked    []common.Hash
+		divergence error
+	)
+	pool.invariantHook = func(tx *types.Transaction, err error) {
+		checked = append(checked, tx.Hash())
+		if err != nil {
+			divergence = err
+		}
+	}
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		testAddBalance(pool, crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000000000000))
+	}
+	minBaseFee := dummy.MinBaseFee(eip1559Config, uint64(time.Now().Unix()))
+
+	// The transactions paying the minimum base fee pass the checks, and the
+	// transactions following another one are not checked
+	pool.SetMinFee(minBaseFee)
+	txs := []*types.Transaction{
+		dynamicFeeTx(0, 100000, minBaseFee, common.Big1, keys[0]),
+		dynamicFeeTx(1, 100000, minBaseFee, common.Big1, keys[0]),
+	}
+	for i, err := range pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("Failed to add tx %d: %v", i, err)
+		}
+	}
+	if len(checked) != 1 || checked[0] != txs[0].Hash() || divergence != nil {
+		t.Fatalf("Expected only the first tx to be checked without divergence, found %d checks and %v", len(checked), divergence)
+	}
+
+	// A pool rule admitting the transactions under the minimum base fee is a
+	// divergence
+	pool.SetMinFee(new(big.Int).Div(minBaseFee, common.Big2))
+	underpriced := dynamicFeeTx(0, 100000, new(big.Int).Sub(minBaseFee, common.Big1), common.Big1, keys[1])
+	if err := pool.AddRemotesSync([]*types.Transaction{underpriced})[0]; err != nil {
+		t.Fatal(err)
+	}
+	if len(checked) != 2 || checked[1] != underpriced.Hash() || !errors.Is(divergence, ErrFeeCapTooLow) {
+		t.Fatalf("Expected the underpriced tx to be reported, found %d checks and %v", len(checked), divergence)
+	}
+
+	// The checks run on a copy of the state
+	pool.currentStateLock.Lock()
+	stateNonce := pool.currentState.GetNonce(crypto.PubkeyToAddress(keys[0].PublicKey))
+	pool.currentStateLock.Unlock()
+	if stateNonce != 0 {
+		t.Fatalf("Expected the checks to leave the state of the pool unchanged, found nonce %d", stateNonce)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
@@ -0,0 +1,194 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// TxPropagationStatus is the propagation receipt of a locally submitted
+// transaction: the gossip of it by the node, and the gossip of it back by its
+// peers, evidence that it propagated through the network.
+type TxPropagationStatus struct {
+	// Times the transaction was gossiped, and the most peers a gossip of it
+	// was sent to
+	Gossips       uint64
+	PeersGossiped uint32
+	FirstGossiped time.Time
+	LastGossiped  time.Time
+
+	// Distinct peers that gossiped the transaction back, zero times if none
+	// did
+	PeersSeenBack uint64
+	FirstSeenBack time.Time
+	LastSeenBack  time.Time
+}
+
+// trackedPropagation is a transaction tracked until its inclusion.
+type trackedPropagation struct {
+	hash     common.Hash
+	since    time.Time
+	status   TxPropagationStatus
+	seenBack map[string]struct{}
+}
+
+// TxPropagationTracker tracks the propagation of the locally submitted
+// transactions until their inclusion in an accepted block, or for at most
+// [ttl]. It tracks at most a fixed number of transactions, overwriting the
+// oldest ones first, so its memory is bounded.
+//
+// A nil TxPropagationTracker tracks nothing.
+type TxPropagationTracker struct {
+	lock sync.Mutex
+
+	// Tracked transactions, indexing the ring [tracked]
+	index   map[common.Hash]int
+	tracked []*trackedPropagation
+	next    int
+
+	ttl   time.Duration
+	clock func() time.Time
+}
+
+// NewTxPropagationTracker returns a tracker of the propagation of at most
+// [capacity] transactions, each for at most [ttl].
+func NewTxPropagationTracker(capacity int, ttl time.Duration) *TxPropagationTracker {
+	return &TxPropagationTracker{
+		index:   make(map[common.Hash]int, capacity),
+		tracked: make([]*trackedPropagation, capacity),
+		ttl:     ttl,
+		clock:   time.Now,
+	}
+}
+
+// Track starts tracking the propagation of [txs], submitted to the node.
+// Transactions already tracked are ignored.
+func (t *TxPropagationTracker) Track(txs ...*types.Transaction) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	for _, tx := range txs {
+		hash := tx.Hash()
+		if _, ok := t.get(hash, now); ok {
+			continue
+		}
+		if evicted := t.tracked[t.next]; evicted != nil {
+			delete(t.index, evicted.hash)
+		}
+		t.tracked[t.next] = &trackedPropagation{hash: hash, since: now, seenBack: make(map[string]struct{})}
+		t.index[hash] = t.next
+		t.next = (t.next + 1) % len(t.tracked)
+	}
+}
+
+// get returns the tracked transaction [hash], dropping it if it was tracked
+// for more than [ttl] at [now].
+func (t *TxPropagationTracker) get(hash common.Hash, now time.Time) (*trackedPropagation, bool) {
+	i, ok := t.index[hash]
+	if !ok {
+		return nil, false
+	}
+	tracked := t.tracked[i]
+	if now.Sub(tracked.since) > t.ttl {
+		delete(t.index, hash)
+		t.tracked[i] = nil
+		return nil, false
+	}
+	return tracked, true
+}
+
+// MarkGossiped records the gossip of [txs] sent to [peers] peers.
+// The transactions not tracked are ignored.
+func (t *TxPropagationTracker) MarkGossiped(peers uint32, txs ...*types.Transaction) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	for _, tx := range txs {
+		tracked, ok := t.get(tx.Hash(), now)
+		if !ok {
+			continue
+		}
+		status := &tracked.status
+		if status.Gossips == 0 {
+			status.FirstGossiped = now
+		}
+		status.Gossips++
+		status.LastGossiped = now
+		if peers > status.PeersGossiped {
+			status.PeersGossiped = peers
+		}
+	}
+}
+
+// MarkSeenBack records the gossip of [tx] back by [peerID]. A transaction
+// that was not gossiped yet, or is not tracked, is ignored.
+func (t *TxPropagationTracker) MarkSeenBack(peerID string, tx *types.Transaction) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock()
+	tracked, ok := t.get(tx.Hash(), now)
+	if !ok || tracked.status.Gossips == 0 {
+		return
+	}
+	if _, seen := tracked.seenBack[peerID]; seen {
+		return
+	}
+	tracked.seenBack[peerID] = struct{}{}
+	status := &tracked.status
+	if status.PeersSeenBack == 0 {
+		status.FirstSeenBack = now
+	}
+	status.PeersSeenBack++
+	status.LastSeenBack = now
+}
+
+// MarkAccepted stops tracking the transactions of [block], which was just
+// accepted.
+func (t *TxPropagationTracker) MarkAccepted(block *types.Block) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, tx := range block.Transactions() {
+		if i, ok := t.index[tx.Hash()]; ok {
+			delete(t.index, tx.Hash())
+			t.tracked[i] = nil
+		}
+	}
+}
+
+// Status returns the propagation receipt of the transaction [hash], or nil if
+// it is not tracked.
+func (t *TxPropagationTracker) Status(hash common.Hash) *TxPropagationStatus {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tracked, ok := t.get(hash, t.clock())
+	if !ok {
+		return nil
+	}
+	status := tracked.status
+	return &status
+}
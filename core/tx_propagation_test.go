@@ -0,0 +1,81 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+func TestTxPropagationTracker(t *testing.T) {
+	start := time.Unix(1000000, 0)
+	now := start
+	tracker := NewTxPropagationTracker(2, time.Minute)
+	tracker.clock = func() time.Time { return now }
+
+	txs := make([]*types.Transaction, 3)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	}
+	// [txs[1]] is not tracked, so neither its gossip nor its gossip back are
+	tracker.Track(txs[0])
+	tracker.MarkSeenBack("peer0", txs[0])
+	tracker.MarkGossiped(3, txs[0], txs[1])
+	now = now.Add(time.Second)
+	tracker.MarkGossiped(2, txs[0])
+	for _, peerID := range []string{"peer0", "peer1", "peer0"} {
+		now = now.Add(time.Second)
+		tracker.MarkSeenBack(peerID, txs[0])
+		tracker.MarkSeenBack(peerID, txs[1])
+	}
+
+	expected := TxPropagationStatus{
+		Gossips:       2,
+		PeersGossiped: 3,
+		FirstGossiped: start,
+		LastGossiped:  start.Add(time.Second),
+		PeersSeenBack: 2,
+		FirstSeenBack: start.Add(2 * time.Second),
+		LastSeenBack:  start.Add(3 * time.Second),
+	}
+	if status := tracker.Status(txs[0].Hash()); status == nil || *status != expected {
+		t.Fatalf("Expected the status %+v, found %+v", expected, status)
+	}
+	if status := tracker.Status(txs[1].Hash()); status != nil {
+		t.Fatalf("Expected the untracked tx to have no status, found %+v", status)
+	}
+
+	// The included txs are dropped
+	tracker.Track(txs[1])
+	tracker.MarkAccepted(types.NewBlockWithHeader(&types.Header{}).WithBody(txs[:1], nil, 0, nil))
+	if status := tracker.Status(txs[0].Hash()); status != nil {
+		t.Fatalf("Expected the included tx to be dropped, found %+v", status)
+	}
+	// Tracking more txs than the capacity overwrites the oldest ones
+	tracker.Track(txs[2], txs[0])
+	if tracker.Status(txs[1].Hash()) != nil || tracker.Status(txs[2].Hash()) == nil || tracker.Status(txs[0].Hash()) == nil {
+		t.Fatal("Expected the 2 most recently tracked txs to be tracked")
+	}
+	// The txs are dropped after the TTL
+	now = now.Add(time.Minute + time.Second)
+	if status := tracker.Status(txs[2].Hash()); status != nil {
+		t.Fatalf("Expected the tx to be dropped after the TTL, found %+v", status)
+	}
+	if len(tracker.index) != 1 {
+		t.Fatalf("Expected a single tracked tx, found %d", len(tracker.index))
+	}
+
+	// A nil tracker tracks nothing
+	var disabled *TxPropagationTracker
+	disabled.Track(txs[0])
+	disabled.MarkGossiped(1, txs[0])
+	disabled.MarkSeenBack("peer0", txs[0])
+	if status := disabled.Status(txs[0].Hash()); status != nil {
+		t.Fatalf("Expected no status from a nil tracker, found %+v", status)
+	}
+}
@@ -27,6 +27,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/zsmartex/coreth/core/state"
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/core/vm"
@@ -50,6 +52,11 @@ type Prefetcher interface {
 	// the transaction messages using the statedb, but any changes are discarded. The
 	// only goal is to pre-cache transaction signatures and state trie nodes.
 	Prefetch(block *types.Block, statedb *state.StateDB, cfg vm.Config, interrupt *uint32)
+
+	// PrefetchKeys reads the accounts and storage slots of [keys] using the
+	// statedb, until [deadline] or [interrupt] is set, to pre-cache their state.
+	// Returns the number of keys read.
+	PrefetchKeys(keys []state.StateKey, statedb *state.StateDB, deadline time.Time, interrupt *uint32) int
 }
 
 // Processor is an interface for processing blocks using a given initial state.
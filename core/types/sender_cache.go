@@ -0,0 +1,101 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package types
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// senderCacheLimit is the number of recovered senders kept by [senderCache].
+const senderCacheLimit = 32768
+
+// senderCache keeps the senders recovered by [Sender] across the copies of a
+// transaction, so that a sender recovered while verifying a block is not
+// recovered again when the transaction is decoded anew to be served over RPC
+// or replayed by a tracer. It is nil if the senders are not shared.
+var senderCache = newSenderCache(senderCacheLimit)
+
+// Kinds of the signers whose senders are shared
+const (
+	frontierSignerKind uint8 = iota + 1
+	homesteadSignerKind
+	eip155SignerKind
+	eip2930SignerKind
+	londonSignerKind
+)
+
+// senderCacheKey identifies the sender of a transaction recovered by a signer.
+// A sender recovered by a signer is not served to another, as the signer of a
+// chain changes at its fork boundaries and they recover different senders, or
+// none, from the same transaction.
+type senderCacheKey struct {
+	tx      common.Hash
+	kind    uint8
+	chainID common.Hash
+}
+
+// newSenderCache returns a cache of [limit] senders.
+func newSenderCache(limit int) *lru.Cache {
+	cache, _ := lru.New(limit)
+	return cache
+}
+
+// newSenderCacheKey returns the key of the sender of [tx] recovered by
+// [signer], and false if the senders of [signer] are not shared.
+func newSenderCacheKey(signer Signer, tx *Transaction) (senderCacheKey, bool) {
+	var key senderCacheKey
+	switch signer.(type) {
+	case londonSigner:
+		key.kind = londonSignerKind
+	case eip2930Signer:
+		key.kind = eip2930SignerKind
+	case EIP155Signer:
+		key.kind = eip155SignerKind
+	case HomesteadSigner:
+		key.kind = homesteadSignerKind
+	case FrontierSigner:
+		key.kind = frontierSignerKind
+	default:
+		return senderCacheKey{}, false
+	}
+	if chainID := signer.ChainID(); chainID != nil {
+		if chainID.Sign() < 0 || chainID.BitLen() > 8*common.HashLength {
+			return senderCacheKey{}, false
+		}
+		key.chainID = common.BigToHash(chainID)
+	}
+	key.tx = tx.Hash()
+	return key, true
+}
+
+// cachedSender returns the sender of [tx] recovered by [signer] from
+// [senderCache], if any.
+func cachedSender(signer Signer, tx *Transaction) (common.Address, bool) {
+	cache := senderCache
+	if cache == nil {
+		return common.Address{}, false
+	}
+	key, ok := newSenderCacheKey(signer, tx)
+	if !ok {
+		return common.Address{}, false
+	}
+	from, ok := cache.Get(key)
+	if !ok {
+		return common.Address{}, false
+	}
+	return from.(common.Address), true
+}
+
+// cacheSender adds [from], the sender of [tx] recovered by [signer], to
+// [senderCache].
+func cacheSender(signer Signer, tx *Transaction, from common.Address) {
+	cache := senderCache
+	if cache == nil {
+		return
+	}
+	if key, ok := newSenderCacheKey(signer, tx); ok {
+		cache.Add(key, from)
+	}
+}
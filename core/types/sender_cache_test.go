@@ -0,0 +1,147 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package types
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// decodeCopy returns a copy of [tx] decoded anew, which does not share the
+// sender cached in [tx].
+func decodeCopy(t testing.TB, tx *Transaction) *Transaction {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpy := new(Transaction)
+	if err := cpy.UnmarshalBinary(raw); err != nil {
+		t.Fatal(err)
+	}
+	return cpy
+}
+
+func TestSenderCacheSigners(t *testing.T) {
+	cache := senderCache
+	defer func() { senderCache = cache }()
+	senderCache = newSenderCache(senderCacheLimit)
+
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(43112)
+	london := NewLondonSigner(chainID)
+
+	dynamicFeeTx := MustSignNewTx(key, london, &DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     0,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &common.Address{},
+	})
+	legacyTx := MustSignNewTx(key, london, &LegacyTx{
+		Nonce:    1,
+		GasPrice: big.NewInt(1),
+		Gas:      21000,
+		To:       &common.Address{},
+	})
+
+	// The senders recovered after the fork are shared with the copies of the
+	// transactions recovered by the same signer
+	for _, tx := range []*Transaction{dynamicFeeTx, legacyTx} {
+		if from, err := Sender(london, tx); err != nil || from != addr {
+			t.Fatalf("Expected sender %s, found %s (%v)", addr, from, err)
+		}
+		if _, ok := cachedSender(london, decodeCopy(t, tx)); !ok {
+			t.Fatalf("Expected the sender of %s to be shared", tx.Hash())
+		}
+	}
+
+	// Before the fork, the signers of the chain do not accept the dynamic fee
+	// transaction, or the replay protected transaction, even if their
+	// senders were recovered after it
+	if _, err := Sender(NewEIP2930Signer(chainID), decodeCopy(t, dynamicFeeTx)); !errors.Is(err, ErrTxTypeNotSupported) {
+		t.Fatalf("Expected the dynamic fee tx to be rejected before the fork, found %v", err)
+	}
+	if _, err := Sender(HomesteadSigner{}, decodeCopy(t, legacyTx)); !errors.Is(err, ErrInvalidSig) {
+		t.Fatalf("Expected the replay protected tx to be rejected before the fork, found %v", err)
+	}
+	if _, err := Sender(NewLondonSigner(big.NewInt(1)), decodeCopy(t, legacyTx)); !errors.Is(err, ErrInvalidChainId) {
+		t.Fatalf("Expected the tx to be rejected on another chain, found %v", err)
+	}
+
+	// A failed recovery is not shared either
+	tx := MustSignNewTx(key, london, &DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     2,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &common.Address{},
+	})
+	if _, err := Sender(NewEIP155Signer(chainID), tx); !errors.Is(err, ErrTxTypeNotSupported) {
+		t.Fatalf("Expected the dynamic fee tx to be rejected before the fork, found %v", err)
+	}
+	if from, err := Sender(london, decodeCopy(t, tx)); err != nil || from != addr {
+		t.Fatalf("Expected sender %s after the fork, found %s (%v)", addr, from, err)
+	}
+}
+
+// BenchmarkSenderTraceVerifiedBlock recovers the senders of the transactions
+// of a verified block decoded anew, as a tracer replaying the block does.
+func BenchmarkSenderTraceVerifiedBlock(b *testing.B) {
+	key, _ := crypto.GenerateKey()
+	signer := NewLondonSigner(big.NewInt(43112))
+	txs := make([]*Transaction, 200)
+	for i := range txs {
+		txs[i] = MustSignNewTx(key, signer, &DynamicFeeTx{
+			ChainID:   big.NewInt(43112),
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &common.Address{},
+		})
+	}
+	raw, err := rlp.EncodeToBytes(txs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	trace := func(b *testing.B) {
+		var decoded []*Transaction
+		if err := rlp.DecodeBytes(raw, &decoded); err != nil {
+			b.Fatal(err)
+		}
+		for _, tx := range decoded {
+			if _, err := Sender(signer, tx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	cache := senderCache
+	defer func() { senderCache = cache }()
+	for _, shared := range []bool{false, true} {
+		name := "unshared"
+		if shared {
+			name = "shared"
+		}
+		b.Run(name, func(b *testing.B) {
+			senderCache = nil
+			if shared {
+				senderCache = newSenderCache(senderCacheLimit)
+			}
+			// Verify the block
+			trace(b)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				trace(b)
+			}
+		})
+	}
+}
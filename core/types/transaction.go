@@ -30,6 +30,7 @@ import (
 	"bytes"
 	"container/heap"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
 	"sync/atomic"
@@ -57,10 +58,48 @@ const (
 	DynamicFeeTxType
 )
 
+// futureTxTypeForks names the Ethereum upgrades introducing the transaction
+// types that are not supported by coreth yet.
+var futureTxTypeForks = map[byte]string{
+	0x03: "Cancun (EIP-4844 blob transactions)",
+	0x04: "Prague (EIP-7702 set code transactions)",
+}
+
+// UnsupportedTxTypeError is returned for a well-formed transaction whose type is
+// not supported, either by coreth or by the rules active on the chain.
+type UnsupportedTxTypeError struct {
+	Type byte
+	Fork string // Upgrade that introduces the type, empty if unknown
+}
+
+// NewUnsupportedTxTypeError returns the error for a transaction of type
+// [txType] submitted before the [fork] that introduces it.
+func NewUnsupportedTxTypeError(txType byte, fork string) *UnsupportedTxTypeError {
+	return &UnsupportedTxTypeError{Type: txType, Fork: fork}
+}
+
+// newFutureTxTypeError returns the error for a transaction of type [txType],
+// which is unknown to coreth.
+func newFutureTxTypeError(txType byte) *UnsupportedTxTypeError {
+	return &UnsupportedTxTypeError{Type: txType, Fork: futureTxTypeForks[txType]}
+}
+
+func (e *UnsupportedTxTypeError) Error() string {
+	if e.Fork == "" {
+		return fmt.Sprintf("%v: type 0x%02x", ErrTxTypeNotSupported, e.Type)
+	}
+	return fmt.Sprintf("%v: type 0x%02x requires %s", ErrTxTypeNotSupported, e.Type, e.Fork)
+}
+
+func (e *UnsupportedTxTypeError) Unwrap() error {
+	return ErrTxTypeNotSupported
+}
+
 // Transaction is an Ethereum transaction.
 type Transaction struct {
-	inner TxData    // Consensus contents of a transaction
-	time  time.Time // Time first seen locally (spam avoidance)
+	inner    TxData    // Consensus contents of a transaction
+	time     time.Time // Time first seen locally (spam avoidance)
+	admitted time.Time // Time admitted to the tx pool, zero if it was not
 
 	// caches
 	hash atomic.Value
@@ -197,7 +236,7 @@ func (tx *Transaction) decodeTyped(b []byte) (TxData, error) {
 		err := rlp.DecodeBytes(b[1:], &inner)
 		return &inner, err
 	default:
-		return nil, ErrTxTypeNotSupported
+		return nil, newFutureTxTypeError(b[0])
 	}
 }
 
@@ -418,6 +457,26 @@ func (tx *Transaction) SetFirstSeen(t time.Time) {
 	tx.time = t
 }
 
+// Admitted is the time a transaction is admitted to the tx pool, zero if it
+// was not.
+func (tx *Transaction) Admitted() time.Time {
+	return tx.admitted
+}
+
+// SetAdmitted sets the time a transaction is admitted to the tx pool.
+func (tx *Transaction) SetAdmitted(t time.Time) {
+	tx.admitted = t
+}
+
+// arrival is the time a transaction is admitted to the tx pool, or first seen
+// if it was not admitted to one.
+func (tx *Transaction) arrival() time.Time {
+	if tx.admitted.IsZero() {
+		return tx.time
+	}
+	return tx.admitted
+}
+
 // Transactions implements DerivableList for transactions.
 type Transactions []*Transaction
 
@@ -483,17 +542,43 @@ func NewTxWithMinerFee(tx *Transaction, baseFee *big.Int) (*TxWithMinerFee, erro
 	}, nil
 }
 
+// TxTieBreak is the policy ordering the transactions paying the same
+// effective miner tip. Given the same transactions with the same admission
+// times, each policy always yields the same order, whatever the order of the
+// transactions given to it.
+type TxTieBreak uint8
+
+const (
+	// TxTieBreakFIFO orders the transactions admitted to the tx pool earlier
+	// first, and the transactions admitted at the same time by hash. The
+	// transactions not admitted to a tx pool are ordered by the time they
+	// were first seen instead.
+	TxTieBreakFIFO TxTieBreak = iota
+	// TxTieBreakHash orders the transactions by hash only, so that the order
+	// does not depend on when a node received them.
+	TxTieBreakHash
+)
+
+// less returns whether [a] is ordered before [b], both paying the same tip.
+func (p TxTieBreak) less(a, b *Transaction) bool {
+	if ta, tb := a.arrival(), b.arrival(); p == TxTieBreakFIFO && !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	ha, hb := a.Hash(), b.Hash()
+	return bytes.Compare(ha[:], hb[:]) < 0
+}
+
 // TxByPriceAndTime implements both the sort and the heap interface, making it useful
 // for all at once sorting as well as individually adding and removing elements.
 type TxByPriceAndTime []*TxWithMinerFee
 
 func (s TxByPriceAndTime) Len() int { return len(s) }
 func (s TxByPriceAndTime) Less(i, j int) bool {
-	// If the prices are equal, use the time the transaction was first seen for
-	// deterministic sorting
+	// If the prices are equal, use the time the transaction was admitted, then
+	// the hash, for deterministic sorting
 	cmp := s[i].minerFee.Cmp(s[j].minerFee)
 	if cmp == 0 {
-		return s[i].Tx.time.Before(s[j].Tx.time)
+		return TxTieBreakFIFO.less(s[i].Tx, s[j].Tx)
 	}
 	return cmp > 0
 }
@@ -511,12 +596,27 @@ func (s *TxByPriceAndTime) Pop() interface{} {
 	return x
 }
 
+// txPriceHeap is the price heap of the head transactions of the accounts,
+// ordering the transactions paying the same tip by [tieBreak].
+type txPriceHeap struct {
+	TxByPriceAndTime
+	tieBreak TxTieBreak
+}
+
+func (h *txPriceHeap) Less(i, j int) bool {
+	s := h.TxByPriceAndTime
+	if cmp := s[i].minerFee.Cmp(s[j].minerFee); cmp != 0 {
+		return cmp > 0
+	}
+	return h.tieBreak.less(s[i].Tx, s[j].Tx)
+}
+
 // TransactionsByPriceAndNonce represents a set of transactions that can return
 // transactions in a profit-maximizing sorted order, while supporting removing
 // entire batches of transactions for non-executable accounts.
 type TransactionsByPriceAndNonce struct {
 	txs     map[common.Address]Transactions // Per account nonce-sorted list of transactions
-	heads   TxByPriceAndTime                // Next transaction for each unique account (price heap)
+	heads   txPriceHeap                     // Next transaction for each unique account (price heap)
 	signer  Signer                          // Signer for the set of transactions
 	baseFee *big.Int                        // Current base fee
 }
@@ -527,8 +627,14 @@ type TransactionsByPriceAndNonce struct {
 // Note, the input map is reowned so the caller should not interact any more with
 // if after providing it to the constructor.
 func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transactions, baseFee *big.Int) *TransactionsByPriceAndNonce {
+	return NewTransactionsByPriceAndNonceWithTieBreak(signer, txs, baseFee, TxTieBreakFIFO)
+}
+
+// NewTransactionsByPriceAndNonceWithTieBreak is NewTransactionsByPriceAndNonce
+// ordering the transactions paying the same tip by [tieBreak].
+func NewTransactionsByPriceAndNonceWithTieBreak(signer Signer, txs map[common.Address]Transactions, baseFee *big.Int, tieBreak TxTieBreak) *TransactionsByPriceAndNonce {
 	// Initialize a price and received time based heap with the head transactions
-	heads := make(TxByPriceAndTime, 0, len(txs))
+	heads := txPriceHeap{TxByPriceAndTime: make(TxByPriceAndTime, 0, len(txs)), tieBreak: tieBreak}
 	for from, accTxs := range txs {
 		acc, _ := Sender(signer, accTxs[0])
 		wrapped, err := NewTxWithMinerFee(accTxs[0], baseFee)
@@ -537,7 +643,7 @@ func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transa
 			delete(txs, from)
 			continue
 		}
-		heads = append(heads, wrapped)
+		heads.TxByPriceAndTime = append(heads.TxByPriceAndTime, wrapped)
 		txs[from] = accTxs[1:]
 	}
 	heap.Init(&heads)
@@ -553,18 +659,18 @@ func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transa
 
 // Peek returns the next transaction by price.
 func (t *TransactionsByPriceAndNonce) Peek() *Transaction {
-	if len(t.heads) == 0 {
+	if t.heads.Len() == 0 {
 		return nil
 	}
-	return t.heads[0].Tx
+	return t.heads.TxByPriceAndTime[0].Tx
 }
 
 // Shift replaces the current best head with the next one from the same account.
 func (t *TransactionsByPriceAndNonce) Shift() {
-	acc, _ := Sender(t.signer, t.heads[0].Tx)
+	acc, _ := Sender(t.signer, t.heads.TxByPriceAndTime[0].Tx)
 	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
 		if wrapped, err := NewTxWithMinerFee(txs[0], t.baseFee); err == nil {
-			t.heads[0], t.txs[acc] = wrapped, txs[1:]
+			t.heads.TxByPriceAndTime[0], t.txs[acc] = wrapped, txs[1:]
 			heap.Fix(&t.heads, 0)
 			return
 		}
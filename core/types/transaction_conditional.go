@@ -0,0 +1,84 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// KnownAccount is the expected storage of an account, either its storage root
+// or the values of some of its slots.
+type KnownAccount struct {
+	StorageRoot  *common.Hash
+	StorageSlots map[common.Hash]common.Hash
+}
+
+// MarshalJSON encodes the storage root as a hash, or the slots as an object
+// mapping each slot to its value.
+func (a KnownAccount) MarshalJSON() ([]byte, error) {
+	if a.StorageRoot != nil {
+		return json.Marshal(a.StorageRoot)
+	}
+	return json.Marshal(a.StorageSlots)
+}
+
+// UnmarshalJSON decodes either a storage root or an object of slots.
+func (a *KnownAccount) UnmarshalJSON(input []byte) error {
+	if input = bytes.TrimSpace(input); len(input) > 0 && input[0] == '"' {
+		a.StorageRoot, a.StorageSlots = new(common.Hash), nil
+		return json.Unmarshal(input, a.StorageRoot)
+	}
+	a.StorageRoot = nil
+	return json.Unmarshal(input, &a.StorageSlots)
+}
+
+// TransactionConditional is the set of conditions a transaction is submitted
+// with, checked by the node against the block including it and its state
+// before the transaction. The conditions are kept by the node receiving the
+// transaction and are not part of its encoding, so they never affect the
+// validity of a block.
+type TransactionConditional struct {
+	KnownAccounts  map[common.Address]KnownAccount `json:"knownAccounts"`
+	BlockNumberMin *hexutil.Big                    `json:"blockNumberMin,omitempty"`
+	BlockNumberMax *hexutil.Big                    `json:"blockNumberMax,omitempty"`
+	TimestampMin   *hexutil.Uint64                 `json:"timestampMin,omitempty"`
+	TimestampMax   *hexutil.Uint64                 `json:"timestampMax,omitempty"`
+}
+
+// Cost returns the number of storage roots and slots to read to check the
+// conditions.
+func (c *TransactionConditional) Cost() int {
+	cost := 0
+	for _, account := range c.KnownAccounts {
+		if account.StorageRoot != nil {
+			cost++
+		} else {
+			cost += len(account.StorageSlots)
+		}
+	}
+	return cost
+}
+
+// CheckBlockNumber returns true if [number] is within the bounds of the
+// conditions.
+func (c *TransactionConditional) CheckBlockNumber(number *big.Int) bool {
+	if c.BlockNumberMin != nil && number.Cmp(c.BlockNumberMin.ToInt()) < 0 {
+		return false
+	}
+	return c.BlockNumberMax == nil || number.Cmp(c.BlockNumberMax.ToInt()) <= 0
+}
+
+// CheckTimestamp returns true if [timestamp] is within the bounds of the
+// conditions.
+func (c *TransactionConditional) CheckTimestamp(timestamp uint64) bool {
+	if c.TimestampMin != nil && timestamp < uint64(*c.TimestampMin) {
+		return false
+	}
+	return c.TimestampMax == nil || timestamp <= uint64(*c.TimestampMax)
+}
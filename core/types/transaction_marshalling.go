@@ -274,7 +274,10 @@ func (t *Transaction) UnmarshalJSON(input []byte) error {
 		}
 
 	default:
-		return ErrTxTypeNotSupported
+		if dec.Type > 0xff {
+			return ErrTxTypeNotSupported
+		}
+		return newFutureTxTypeError(byte(dec.Type))
 	}
 
 	// Now set the inner transaction.
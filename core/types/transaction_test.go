@@ -537,3 +537,71 @@ func assertEqual(orig *Transaction, cpy *Transaction) error {
 	}
 	return nil
 }
+
+// Tests that the transactions with the same price and first seen time are
+// ordered by hash, whatever the order they are given in, and that the hash
+// tie break ignores the first seen times.
+func TestTransactionTieBreak(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 8)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	signer := HomesteadSigner{}
+
+	var txs Transactions
+	for i, key := range keys {
+		tx, _ := SignTx(NewTransaction(0, common.Address{}, big.NewInt(100), 100, big.NewInt(1), nil), signer, key)
+		tx.time = time.Unix(int64(i%2), 0)
+		txs = append(txs, tx)
+	}
+	for _, tieBreak := range []TxTieBreak{TxTieBreakFIFO, TxTieBreakHash} {
+		groups := map[common.Address]Transactions{}
+		for _, tx := range txs {
+			from, _ := Sender(signer, tx)
+			groups[from] = Transactions{tx}
+		}
+		txset := NewTransactionsByPriceAndNonceWithTieBreak(signer, groups, nil, tieBreak)
+		var sorted Transactions
+		for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+			sorted = append(sorted, tx)
+			txset.Shift()
+		}
+		for i := 1; i < len(sorted); i++ {
+			prev, next := sorted[i-1], sorted[i]
+			if tieBreak == TxTieBreakFIFO && !prev.time.Equal(next.time) {
+				if prev.time.After(next.time) {
+					t.Errorf("invalid received time ordering: tx #%d (T=%v) > tx #%d (T=%v)", i-1, prev.time, i, next.time)
+				}
+				continue
+			}
+			if prevHash, nextHash := prev.Hash(), next.Hash(); bytes.Compare(prevHash[:], nextHash[:]) > 0 {
+				t.Errorf("invalid hash ordering with tie break %d: tx #%d (H=%x) > tx #%d (H=%x)", tieBreak, i-1, prevHash[:4], i, nextHash[:4])
+			}
+		}
+	}
+}
+
+// Tests that the FIFO tie break orders the transactions by admission to the tx
+// pool, the first seen time only ordering those not admitted to one.
+func TestTransactionTieBreakAdmission(t *testing.T) {
+	signer := HomesteadSigner{}
+	var txs []*Transaction
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		tx, _ := SignTx(NewTransaction(0, common.Address{}, big.NewInt(100), 100, big.NewInt(1), nil), signer, key)
+		txs = append(txs, tx)
+	}
+	// Seen in reverse order, but admitted in order
+	txs[0].SetFirstSeen(time.Unix(300, 0))
+	txs[0].SetAdmitted(time.Unix(400, 0))
+	txs[1].SetFirstSeen(time.Unix(200, 0))
+	txs[1].SetAdmitted(time.Unix(500, 0))
+	if !TxTieBreakFIFO.less(txs[0], txs[1]) || TxTieBreakFIFO.less(txs[1], txs[0]) {
+		t.Fatal("Expected the tx admitted first to be ordered first")
+	}
+	// Not admitted, the tx is ordered by the time it was first seen
+	txs[2].SetFirstSeen(time.Unix(450, 0))
+	if !TxTieBreakFIFO.less(txs[0], txs[2]) || !TxTieBreakFIFO.less(txs[2], txs[1]) {
+		t.Fatal("Expected the tx not admitted to be ordered by its first seen time")
+	}
+}
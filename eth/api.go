@@ -192,26 +192,197 @@ func NewPublicDebugAPI(eth *Ethereum) *PublicDebugAPI {
 	return &PublicDebugAPI{eth: eth}
 }
 
-// DumpBlock retrieves the entire state of the database at a given block.
-func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
-	opts := &state.DumpConfig{
-		OnlyWithAddresses: true,
-		Max:               AccountRangeMaxResults, // Sanity limit over RPC
+// DumpBlockOptions are the options of a debug_dumpBlock request.
+type DumpBlockOptions struct {
+	// Start is the hashed key of the account to start the dump at, as returned
+	// by the Next field of a previous result
+	Start hexutil.Bytes `json:"start"`
+	// MaxResults is the maximum number of accounts to return, capped by
+	// AccountRangeMaxResults
+	MaxResults  int  `json:"maxResults"`
+	NoCode      bool `json:"noCode"`
+	Incompletes bool `json:"incompletes"`
+	// Storage lists the accounts whose storage is dumped. The storage of
+	// other accounts is not dumped.
+	Storage []common.Address `json:"storage"`
+	// AssetIDs lists the native assets whose non-zero balances are dumped.
+	AssetIDs []common.Hash `json:"assetIDs"`
+}
+
+// DumpBlockResult is a page of the state of an accepted block.
+type DumpBlockResult struct {
+	Root        common.Hash         `json:"root"`
+	BlockNumber hexutil.Uint64      `json:"blockNumber"`
+	BlockHash   common.Hash         `json:"blockHash"`
+	Accounts    []state.DumpAccount `json:"accounts"`       // Ordered by hashed key
+	Next        hexutil.Bytes       `json:"next,omitempty"` // nil if no more accounts
+}
+
+// OnRoot implements state.DumpCollector interface
+func (r *DumpBlockResult) OnRoot(root common.Hash) {
+	r.Root = root
+}
+
+// OnAccount implements state.DumpCollector interface
+func (r *DumpBlockResult) OnAccount(addr common.Address, account state.DumpAccount) {
+	if account.Address == nil && addr != (common.Address{}) {
+		account.Address = &addr
 	}
-	var block *types.Block
-	if blockNr.IsAccepted() {
-		block = api.eth.LastAcceptedBlock()
-	} else {
-		block = api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
+	r.Accounts = append(r.Accounts, account)
+}
+
+// dumpBlockStream implements state.DumpCollector, encoding the accounts of a
+// DumpBlockResult as they are dumped.
+type dumpBlockStream struct {
+	enc      *rpc.StreamEncoder
+	accounts int
+	err      error // First error of the encoding
+}
+
+// OnRoot implements state.DumpCollector interface
+func (d *dumpBlockStream) OnRoot(common.Hash) {}
+
+// OnAccount implements state.DumpCollector interface
+func (d *dumpBlockStream) OnAccount(addr common.Address, account state.DumpAccount) {
+	if d.err != nil {
+		return
 	}
-	if block == nil {
-		return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
+	if account.Address == nil && addr != (common.Address{}) {
+		account.Address = &addr
+	}
+	d.err = d.enc.Value(account)
+	d.accounts++
+}
+
+// DumpBlock returns a page of the state of an accepted block, with the
+// accounts in the order of their hashed keys so that the dumps of nodes with
+// the same state are identical. The dump is read from the snapshot if it
+// holds the state of the block, and from the state trie otherwise. The
+// accounts are streamed into the response as a DumpBlockResult while they are
+// dumped.
+func (api *PublicDebugAPI) DumpBlock(blockNrOrHash rpc.BlockNumberOrHash, opts *DumpBlockOptions) (rpc.StreamedResult, error) {
+	block, err := api.eth.acceptedBlock(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = new(DumpBlockOptions)
+	}
+	conf := &state.DumpConfig{
+		SkipCode:          opts.NoCode,
+		OnlyWithAddresses: !opts.Incompletes,
+		Start:             opts.Start,
+		Max:               uint64(opts.MaxResults),
+		StorageAddresses:  opts.Storage,
+		AssetIDs:          opts.AssetIDs,
+	}
+	if conf.StorageAddresses == nil {
+		conf.SkipStorage = true
+	}
+	if opts.MaxResults > AccountRangeMaxResults || opts.MaxResults <= 0 {
+		conf.Max = AccountRangeMaxResults
 	}
 	stateDb, err := api.eth.BlockChain().StateAt(block.Root())
 	if err != nil {
-		return state.Dump{}, err
+		return nil, err
+	}
+
+	return func(enc *rpc.StreamEncoder) error {
+		if err := enc.BeginObject(); err != nil {
+			return err
+		}
+		fields := []struct {
+			key   string
+			value interface{}
+		}{
+			{"root", block.Root()},
+			{"blockNumber", hexutil.Uint64(block.NumberU64())},
+			{"blockHash", block.Hash()},
+		}
+		for _, field := range fields {
+			if err := enc.Key(field.key); err != nil {
+				return err
+			}
+			if err := enc.Value(field.value); err != nil {
+				return err
+			}
+		}
+		if err := enc.Key("accounts"); err != nil {
+			return err
+		}
+		if err := enc.BeginArray(); err != nil {
+			return err
+		}
+
+		var (
+			dump   = &dumpBlockStream{enc: enc}
+			next   []byte
+			dumped bool
+		)
+		if snaps := api.eth.BlockChain().Snapshots(); snaps != nil {
+			var err error
+			next, err = stateDb.DumpSnapshotToCollector(snaps, dump, conf)
+			switch {
+			case err == nil:
+				dumped = true
+			case dump.err != nil:
+				return dump.err
+			case dump.accounts > 0:
+				// The accounts already streamed cannot be dumped again from
+				// the state trie
+				return err
+			default:
+				log.Debug("Falling back to the state trie to dump block", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+			}
+		}
+		if !dumped {
+			next = stateDb.DumpToCollector(dump, conf)
+		}
+		if dump.err != nil {
+			return dump.err
+		}
+		if err := enc.EndArray(); err != nil {
+			return err
+		}
+		if next != nil {
+			if err := enc.Key("next"); err != nil {
+				return err
+			}
+			if err := enc.Value(hexutil.Bytes(next)); err != nil {
+				return err
+			}
+		}
+		return enc.EndObject()
+	}, nil
+}
+
+// acceptedBlock returns the accepted block identified by [blockNrOrHash].
+func (eth *Ethereum) acceptedBlock(blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
+	lastAccepted := eth.LastAcceptedBlock()
+	if number, ok := blockNrOrHash.Number(); ok {
+		if number.IsAccepted() {
+			return lastAccepted, nil
+		}
+		if number < 0 || uint64(number) > lastAccepted.NumberU64() {
+			return nil, fmt.Errorf("block #%d is not accepted", number)
+		}
+		block := eth.blockchain.GetBlockByNumber(uint64(number))
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		return block, nil
+	}
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		block := eth.blockchain.GetBlockByHash(hash)
+		if block == nil {
+			return nil, fmt.Errorf("block %s not found", hash.Hex())
+		}
+		if block.NumberU64() > lastAccepted.NumberU64() || eth.blockchain.GetCanonicalHash(block.NumberU64()) != hash {
+			return nil, fmt.Errorf("block %s is not accepted", hash.Hex())
+		}
+		return block, nil
 	}
-	return stateDb.RawDump(opts), nil
+	return nil, errors.New("either block number or block hash must be specified")
 }
 
 // PrivateDebugAPI is the collection of Ethereum full node APIs exposed over
@@ -274,8 +445,9 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs,
 // AccountRangeMaxResults is the maximum number of results to be returned per call
 const AccountRangeMaxResults = 256
 
-// AccountRange enumerates all accounts in the given block and start point in paging request
-func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, start []byte, maxResults int, nocode, nostorage, incompletes bool) (state.IteratorDump, error) {
+// AccountRange enumerates all accounts in the given block and start point in paging request.
+// The non-zero balances of the native assets of [assetIDs], if any, are included in the accounts.
+func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, start []byte, maxResults int, nocode, nostorage, incompletes bool, assetIDs []common.Hash) (state.IteratorDump, error) {
 	var stateDb *state.StateDB
 	var err error
 
@@ -312,6 +484,7 @@ func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, sta
 		OnlyWithAddresses: !incompletes,
 		Start:             start,
 		Max:               uint64(maxResults),
+		AssetIDs:          assetIDs,
 	}
 	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
 		opts.Max = AccountRangeMaxResults
@@ -339,7 +512,7 @@ func (api *PrivateDebugAPI) StorageRangeAt(blockHash common.Hash, txIndex int, c
 	if block == nil {
 		return StorageRangeResult{}, fmt.Errorf("block %#x not found", blockHash)
 	}
-	_, _, statedb, err := api.eth.stateAtTransaction(block, txIndex, 0)
+	_, _, statedb, err := api.eth.stateAtTransaction(context.Background(), block, txIndex, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -44,7 +44,9 @@ import (
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/core/vm"
 	"github.com/zsmartex/coreth/eth/gasprice"
+	"github.com/zsmartex/coreth/eth/tracers"
 	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/internal/ethapi"
 	"github.com/zsmartex/coreth/params"
 	"github.com/zsmartex/coreth/rpc"
 )
@@ -60,6 +62,19 @@ type EthAPIBackend struct {
 	allowUnprotectedTxs bool
 	eth                 *Ethereum
 	gpo                 *gasprice.Oracle
+	tracePool           *tracers.WorkPool
+	submissionAuditor   *ethapi.SubmissionAuditor
+
+	// admitTx, if set, is checked before adding the transactions submitted
+	// over RPC to the pool
+	admitTx func(tx *types.Transaction) error
+}
+
+// SetTxAdmission sets the check of the transactions submitted over RPC
+// before they are added to the pool. It must be called before the backend
+// serves any request.
+func (b *EthAPIBackend) SetTxAdmission(admitTx func(tx *types.Transaction) error) {
+	b.admitTx = admitTx
 }
 
 // ChainConfig returns the active chain configuration.
@@ -178,8 +193,22 @@ func (b *EthAPIBackend) BadBlocks() []*types.Block {
 	return b.eth.blockchain.BadBlocks()
 }
 
+// PendingBlockAndReceipts returns the last block built on the current head
+// and its receipts, or nil if there is none. The block was not accepted yet.
 func (b *EthAPIBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
-	return nil, nil
+	block, receipts := b.eth.miner.PendingBlockAndReceipts()
+	if block == nil {
+		return nil, nil
+	}
+	// Read both heads from one snapshot, as the head may be accepted or
+	// replaced in between
+	heads := b.eth.blockchain.Heads()
+	if parent := block.ParentHash(); parent != heads.Preferred.Hash() || parent != heads.LastAccepted.Hash() {
+		// The block was built on a former head, or on a head that is still
+		// processing, it does not follow the accepted blocks
+		return nil, nil
+	}
+	return block, receipts
 }
 
 func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
@@ -219,6 +248,16 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// CachedAccount returns the balance and nonce of [address] at [blockNrOrHash]
+// if they can be served by the account cache of the blockchain.
+func (b *EthAPIBackend) CachedAccount(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, address common.Address) (*big.Int, uint64, bool) {
+	header, err := b.HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil || header == nil {
+		return nil, 0, false
+	}
+	return b.eth.blockchain.CachedAccount(header.Root, address)
+}
+
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
 	if deadline, exists := ctx.Deadline(); exists && time.Until(deadline) < 0 {
 		return nil, errExpired
@@ -288,11 +327,47 @@ func (b *EthAPIBackend) SubscribeAcceptedTransactionEvent(ch chan<- core.NewTxsE
 	return b.eth.BlockChain().SubscribeAcceptedTransactionEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeIncludedTransactionEvent(ch chan<- core.IncludedTxsEvent) event.Subscription {
+	return b.eth.BlockChain().SubscribeIncludedTransactionEvent(ch)
+}
+
 func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
 	if deadline, exists := ctx.Deadline(); exists && time.Until(deadline) < 0 {
 		return errExpired
 	}
-	return b.eth.txPool.AddLocal(signedTx)
+	if b.admitTx != nil {
+		if err := b.admitTx(signedTx); err != nil {
+			return err
+		}
+	}
+	if err := b.eth.txPool.AddLocal(signedTx); err != nil {
+		return err
+	}
+	b.eth.txPool.NetworkStats().MarkSeen(core.TxOriginRPC, signedTx)
+	// The txs with conditions are not gossiped, so their propagation is not
+	// tracked
+	b.eth.txPool.Propagation().Track(signedTx)
+	return nil
+}
+
+func (b *EthAPIBackend) SendConditionalTx(ctx context.Context, signedTx *types.Transaction, cond *types.TransactionConditional) error {
+	if deadline, exists := ctx.Deadline(); exists && time.Until(deadline) < 0 {
+		return errExpired
+	}
+	if b.admitTx != nil {
+		if err := b.admitTx(signedTx); err != nil {
+			return err
+		}
+	}
+	if err := b.eth.txPool.AddConditional(signedTx, cond); err != nil {
+		return err
+	}
+	b.eth.txPool.NetworkStats().MarkSeen(core.TxOriginRPC, signedTx)
+	return nil
+}
+
+func (b *EthAPIBackend) TxPoolPriceBump() uint64 {
+	return b.eth.txPool.PriceBump()
 }
 
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
@@ -309,7 +384,7 @@ func (b *EthAPIBackend) GetPoolTransaction(hash common.Hash) *types.Transaction
 }
 
 func (b *EthAPIBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
-	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.eth.ChainDb(), txHash)
+	tx, blockHash, blockNumber, index := b.eth.blockchain.GetTransaction(txHash)
 
 	// Respond as if the transaction does not exist if it is not yet in an
 	// accepted block. We explicitly choose not to error here to avoid breaking
@@ -333,6 +408,22 @@ func (b *EthAPIBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats()
 }
 
+func (b *EthAPIBackend) TxNetworkStats() *core.TxNetworkStats {
+	return b.eth.txPool.NetworkStats().Stats()
+}
+
+func (b *EthAPIBackend) TxPropagationEnabled() bool {
+	return b.eth.txPool.Propagation() != nil
+}
+
+func (b *EthAPIBackend) TxPropagationStatus(hash common.Hash) *core.TxPropagationStatus {
+	return b.eth.txPool.Propagation().Status(hash)
+}
+
+func (b *EthAPIBackend) TxPoolFeeHistogram(bounds []*big.Int, percentiles []float64) *core.TxFeeHistogram {
+	return b.eth.txPool.FeeHistogram(bounds, percentiles)
+}
+
 func (b *EthAPIBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	return b.eth.TxPool().Content()
 }
@@ -341,6 +432,18 @@ func (b *EthAPIBackend) TxPoolContentFrom(addr common.Address) (types.Transactio
 	return b.eth.TxPool().ContentFrom(addr)
 }
 
+func (b *EthAPIBackend) TxPoolSnapshot() *core.PendingSnapshot {
+	return b.eth.TxPool().Snapshot()
+}
+
+func (b *EthAPIBackend) CommitOrder(snapshot *core.PendingSnapshot, baseFee *big.Int) types.Transactions {
+	return b.eth.miner.CommitOrder(snapshot, baseFee)
+}
+
+func (b *EthAPIBackend) LastBuiltBlock() *types.Block {
+	return b.eth.miner.LastBuiltBlock()
+}
+
 func (b *EthAPIBackend) TxPool() *core.TxPool {
 	return b.eth.TxPool()
 }
@@ -361,10 +464,26 @@ func (b *EthAPIBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error)
 	return b.gpo.SuggestTipCap(ctx)
 }
 
-func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (firstBlock *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsedRatio []float64, err error) {
+func (b *EthAPIBackend) SuggestGasFees(ctx context.Context) (tipCap *big.Int, baseFee *big.Int, source string, sampledBlocks int, err error) {
+	fees, err := b.gpo.SuggestGasFees(ctx)
+	if err != nil {
+		return nil, nil, "", 0, err
+	}
+	return fees.TipCap, fees.BaseFee, string(fees.Source), fees.SampledBlocks, nil
+}
+
+func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumberOrHash, rewardPercentiles []float64) (firstBlock *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsedRatio []float64, err error) {
 	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
 }
 
+func (b *EthAPIBackend) FeeHistoryAggregate(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (oldestBlock *big.Int, blocks int, reward []*big.Int, nextBaseFee *big.Int, err error) {
+	aggregate, err := b.gpo.FeeHistoryAggregate(ctx, blockCount, lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	return aggregate.OldestBlock, aggregate.Blocks, aggregate.Reward, aggregate.NextBaseFee, nil
+}
+
 func (b *EthAPIBackend) ChainDb() ethdb.Database {
 	return b.eth.ChainDb()
 }
@@ -393,10 +512,42 @@ func (b *EthAPIBackend) RPCEVMTimeout() time.Duration {
 	return b.eth.config.RPCEVMTimeout
 }
 
+func (b *EthAPIBackend) TraceBlockWorkers() int {
+	return b.eth.config.TraceBlockWorkers
+}
+
+// TracePool returns the pool bounding the trace requests, or nil if they are
+// not bounded.
+func (b *EthAPIBackend) TracePool() *tracers.WorkPool {
+	return b.tracePool
+}
+
 func (b *EthAPIBackend) RPCTxFeeCap() float64 {
 	return b.eth.config.RPCTxFeeCap
 }
 
+func (b *EthAPIBackend) RPCFeeCapMultiple() float64 {
+	return b.eth.config.RPCFeeCapMultiple
+}
+
+func (b *EthAPIBackend) RPCFeeGuardrailCap() float64 {
+	return b.eth.config.RPCFeeGuardrailCap
+}
+
+// SubmissionAuditor returns the audit log of the raw transaction submissions,
+// or nil if it is disabled.
+func (b *EthAPIBackend) SubmissionAuditor() *ethapi.SubmissionAuditor {
+	return b.submissionAuditor
+}
+
+func (b *EthAPIBackend) RPCFullBlockTxLimit() int {
+	return b.eth.config.RPCFullBlockTxLimit
+}
+
+func (b *EthAPIBackend) RPCFullBlockSizeLimit() uint64 {
+	return b.eth.config.RPCFullBlockSizeLimit
+}
+
 func (b *EthAPIBackend) BloomStatus() (uint64, uint64) {
 	sections, _, _ := b.eth.bloomIndexer.Sections()
 	return params.BloomBitsBlocks, sections
@@ -420,12 +571,32 @@ func (b *EthAPIBackend) GetMaxBlocksPerRequest() int64 {
 	return b.eth.settings.MaxBlocksPerRequest
 }
 
+func (b *EthAPIBackend) GetMaxBlocksPerMultiRequest() int64 {
+	return b.eth.settings.MaxBlocksPerMultiRequest
+}
+
+func (b *EthAPIBackend) GetMaxLogsPerMultiRequest() int64 {
+	return b.eth.settings.MaxLogsPerMultiRequest
+}
+
+func (b *EthAPIBackend) GetMaxBlocksScannedPerRequest() int64 {
+	return b.eth.settings.MaxBlocksScannedPerRequest
+}
+
+func (b *EthAPIBackend) GetMaxLogsPerRequest() int64 {
+	return b.eth.settings.MaxLogsPerRequest
+}
+
+func (b *EthAPIBackend) GetMaxConcurrentLogsRequestsPerConn() int {
+	return b.eth.settings.MaxConcurrentLogsRequestsPerConn
+}
+
 func (b *EthAPIBackend) StateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, checkLive bool, preferDisk bool) (*state.StateDB, error) {
 	return b.eth.StateAtBlock(block, reexec, base, checkLive, preferDisk)
 }
 
 func (b *EthAPIBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (core.Message, vm.BlockContext, *state.StateDB, error) {
-	return b.eth.stateAtTransaction(block, txIndex, reexec)
+	return b.eth.stateAtTransaction(ctx, block, txIndex, reexec)
 }
 
 func (b *EthAPIBackend) MinRequiredTip(ctx context.Context, header *types.Header) (*big.Int, error) {
@@ -0,0 +1,94 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/internal/ethapi"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// CallAtBlock identifies a block of a CallAtResult.
+type CallAtBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// CallAtResult is the result of a call executed by debug_callAt, along with
+// the block whose state it was executed on.
+type CallAtResult struct {
+	ReturnData hexutil.Bytes `json:"returnData"`
+	Error      string        `json:"error,omitempty"`
+	Requested  CallAtBlock   `json:"requestedBlock"`
+	Block      CallAtBlock   `json:"block"`
+	// Stale is set if the call was executed on the state of [Block], older
+	// than the [Requested] block whose state is not retained.
+	Stale bool `json:"stale"`
+}
+
+// CallAt executes a call as eth_call does at the accepted block identified by
+// [blockNrOrHash]. If the state of the block is not retained, the call may be
+// executed on the state of the nearest older block within [tolerance] blocks,
+// capped by the configured maximum, flagging the result as stale. The call
+// fails if no state is retained within [tolerance] blocks.
+func (api *PrivateDebugAPI) CallAt(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, tolerance *hexutil.Uint64) (*CallAtResult, error) {
+	requested, err := api.eth.acceptedBlock(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	var maxStaleness uint64
+	if tolerance != nil {
+		maxStaleness = uint64(*tolerance)
+	}
+	if limit := api.eth.config.CallAtMaxStaleness; maxStaleness > limit {
+		maxStaleness = limit
+	}
+	block, err := api.eth.retainedBlock(requested, maxStaleness)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := api.eth.APIBackend
+	result, err := ethapi.DoCall(ctx, backend, args, rpc.BlockNumberOrHashWithHash(block.Hash(), false), nil, backend.RPCEVMTimeout(), backend.RPCGasCap())
+	if err != nil {
+		return nil, err
+	}
+	reply := &CallAtResult{
+		ReturnData: result.Return(),
+		Requested:  CallAtBlock{Number: hexutil.Uint64(requested.NumberU64()), Hash: requested.Hash()},
+		Block:      CallAtBlock{Number: hexutil.Uint64(block.NumberU64()), Hash: block.Hash()},
+		Stale:      block.Hash() != requested.Hash(),
+	}
+	if len(result.Revert()) > 0 {
+		reply.ReturnData = result.Revert()
+	}
+	if result.Err != nil {
+		reply.Error = result.Err.Error()
+	}
+	return reply, nil
+}
+
+// retainedBlock returns [block] if its state is retained, or else the nearest
+// older block within [maxStaleness] blocks whose state is retained.
+func (eth *Ethereum) retainedBlock(block *types.Block, maxStaleness uint64) (*types.Block, error) {
+	for current := block; ; {
+		if eth.blockchain.HasState(current.Root()) {
+			return current, nil
+		}
+		if current.NumberU64() == 0 || block.NumberU64()-current.NumberU64() >= maxStaleness {
+			break
+		}
+		current = eth.blockchain.GetBlock(current.ParentHash(), current.NumberU64()-1)
+		if current == nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("required historical state unavailable (block #%d, tolerance=%d)", block.NumberU64(), maxStaleness)
+}
@@ -0,0 +1,158 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package eth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+	"github.com/zsmartex/coreth/trie"
+)
+
+const (
+	// VerifyBlockOK and VerifyBlockMismatch are the statuses of a block whose
+	// replay matches, or does not match, its stored data.
+	VerifyBlockOK       = "ok"
+	VerifyBlockMismatch = "mismatch"
+)
+
+// VerifyBlockResult is the outcome of the replay of an accepted block.
+type VerifyBlockResult struct {
+	Number   hexutil.Uint64 `json:"number"`
+	Hash     common.Hash    `json:"hash"`
+	Status   string         `json:"status"`
+	Mismatch *BlockMismatch `json:"mismatch,omitempty"`
+}
+
+// BlockMismatch names the first field of a replayed block, or of the receipt
+// of one of its txs if [TxIndex] is set, that differs from the stored one.
+type BlockMismatch struct {
+	TxIndex  *hexutil.Uint64 `json:"txIndex,omitempty"`
+	TxHash   *common.Hash    `json:"txHash,omitempty"`
+	Field    string          `json:"field"`
+	Replayed interface{}     `json:"replayed"`
+	Stored   interface{}     `json:"stored"`
+}
+
+// VerifyBlock replays the accepted block identified by [blockNrOrHash] on the
+// state of its parent, without writing anything, and checks that its receipts,
+// logs bloom, gas used and state root match the stored ones. The parent state
+// is not regenerated, so blocks whose parent state was pruned are refused.
+func (api *PrivateDebugAPI) VerifyBlock(blockNrOrHash rpc.BlockNumberOrHash) (*VerifyBlockResult, error) {
+	block, err := api.eth.acceptedBlock(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not replayable")
+	}
+	bc := api.eth.blockchain
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x of block #%d not found", block.ParentHash(), block.NumberU64())
+	}
+	statedb, err := api.eth.StateAtBlock(parent, 0, nil, true, false)
+	if err != nil {
+		return nil, err
+	}
+	receipts, _, usedGas, err := bc.Processor().Process(block, parent.Header(), statedb, *bc.GetVMConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay block #%d: %w", block.NumberU64(), err)
+	}
+	root := statedb.IntermediateRoot(bc.Config().IsEIP158(block.Number()))
+	stored := rawdb.ReadReceipts(api.eth.chainDb, block.Hash(), block.NumberU64(), bc.Config())
+
+	result := &VerifyBlockResult{
+		Number:   hexutil.Uint64(block.NumberU64()),
+		Hash:     block.Hash(),
+		Status:   VerifyBlockOK,
+		Mismatch: diffReplayedBlock(block, receipts, usedGas, root, stored),
+	}
+	if result.Mismatch != nil {
+		result.Status = VerifyBlockMismatch
+	}
+	return result, nil
+}
+
+// diffReplayedBlock returns the first difference between the [replayed]
+// receipts, gas used and state root of [block] and its [stored] receipts and
+// header, or nil if they match.
+func diffReplayedBlock(block *types.Block, replayed types.Receipts, usedGas uint64, root common.Hash, stored types.Receipts) *BlockMismatch {
+	for i, receipt := range replayed {
+		if i >= len(stored) {
+			return &BlockMismatch{Field: "receipts", Replayed: len(replayed), Stored: len(stored)}
+		}
+		if mismatch := diffReceipt(receipt, stored[i]); mismatch != nil {
+			index, hash := hexutil.Uint64(i), block.Transactions()[i].Hash()
+			mismatch.TxIndex, mismatch.TxHash = &index, &hash
+			return mismatch
+		}
+	}
+	header := block.Header()
+	switch {
+	case len(stored) != len(replayed):
+		return &BlockMismatch{Field: "receipts", Replayed: len(replayed), Stored: len(stored)}
+	case usedGas != header.GasUsed:
+		return &BlockMismatch{Field: "gasUsed", Replayed: hexutil.Uint64(usedGas), Stored: hexutil.Uint64(header.GasUsed)}
+	}
+	if bloom := types.CreateBloom(replayed); bloom != header.Bloom {
+		return &BlockMismatch{Field: "logsBloom", Replayed: bloom, Stored: header.Bloom}
+	}
+	if hash := types.DeriveSha(replayed, trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return &BlockMismatch{Field: "receiptsRoot", Replayed: hash, Stored: header.ReceiptHash}
+	}
+	if root != header.Root {
+		return &BlockMismatch{Field: "stateRoot", Replayed: root, Stored: header.Root}
+	}
+	return nil
+}
+
+// diffReceipt returns the first consensus field of the [replayed] receipt
+// that differs from the [stored] one, or nil if they match.
+func diffReceipt(replayed, stored *types.Receipt) *BlockMismatch {
+	switch {
+	case replayed.Status != stored.Status:
+		return &BlockMismatch{Field: "status", Replayed: hexutil.Uint64(replayed.Status), Stored: hexutil.Uint64(stored.Status)}
+	case !bytes.Equal(replayed.PostState, stored.PostState):
+		return &BlockMismatch{Field: "root", Replayed: hexutil.Bytes(replayed.PostState), Stored: hexutil.Bytes(stored.PostState)}
+	case replayed.CumulativeGasUsed != stored.CumulativeGasUsed:
+		return &BlockMismatch{Field: "cumulativeGasUsed", Replayed: hexutil.Uint64(replayed.CumulativeGasUsed), Stored: hexutil.Uint64(stored.CumulativeGasUsed)}
+	case len(replayed.Logs) != len(stored.Logs):
+		return &BlockMismatch{Field: "logs", Replayed: len(replayed.Logs), Stored: len(stored.Logs)}
+	}
+	for i, log := range replayed.Logs {
+		storedLog := stored.Logs[i]
+		switch {
+		case log.Address != storedLog.Address:
+			return &BlockMismatch{Field: fmt.Sprintf("logs[%d].address", i), Replayed: log.Address, Stored: storedLog.Address}
+		case !equalTopics(log.Topics, storedLog.Topics):
+			return &BlockMismatch{Field: fmt.Sprintf("logs[%d].topics", i), Replayed: log.Topics, Stored: storedLog.Topics}
+		case !bytes.Equal(log.Data, storedLog.Data):
+			return &BlockMismatch{Field: fmt.Sprintf("logs[%d].data", i), Replayed: hexutil.Bytes(log.Data), Stored: hexutil.Bytes(storedLog.Data)}
+		}
+	}
+	if replayed.Bloom != stored.Bloom {
+		return &BlockMismatch{Field: "logsBloom", Replayed: replayed.Bloom, Stored: stored.Bloom}
+	}
+	return nil
+}
+
+func equalTopics(a, b []common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
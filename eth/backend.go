@@ -64,11 +64,21 @@ import (
 type Config = ethconfig.Config
 
 var (
-	DefaultSettings Settings = Settings{MaxBlocksPerRequest: 2000}
+	DefaultSettings Settings = Settings{
+		MaxBlocksPerRequest:      2000,
+		MaxBlocksPerMultiRequest: 20000,
+		MaxLogsPerMultiRequest:   100000,
+	}
 )
 
 type Settings struct {
-	MaxBlocksPerRequest int64 // Maximum number of blocks to serve per getLogs request
+	MaxBlocksPerRequest      int64 // Maximum number of blocks to serve per getLogs request
+	MaxBlocksPerMultiRequest int64 // Maximum number of distinct blocks to serve per getLogsMulti request
+	MaxLogsPerMultiRequest   int64 // Maximum number of logs to serve per getLogsMulti request
+
+	MaxBlocksScannedPerRequest       int64 // Maximum number of block reads per getLogs request, counting headers and the logs of bloom-matched blocks
+	MaxLogsPerRequest                int64 // Maximum number of logs to serve per getLogs request
+	MaxConcurrentLogsRequestsPerConn int   // Maximum number of getLogs requests served concurrently per connection
 }
 
 // Ethereum implements the Ethereum full node service.
@@ -193,6 +203,25 @@ func New(
 			SnapshotAsync:  config.SnapshotAsync,
 			SnapshotVerify: config.SnapshotVerify,
 			Preimages:      config.Preimages,
+
+			HeaderCacheLimit:   config.HeaderCache,
+			BodyCacheLimit:     config.BodyCache,
+			ReceiptsCacheLimit: config.ReceiptsCache,
+			BlockCacheLimit:    config.BlockCache,
+
+			AccountCacheLimit: config.AccountCache,
+
+			StorageCommitWorkers: config.StorageCommitWorkers,
+
+			HotKeysLimit:         config.HotKeysWarmup,
+			HotKeysWarmupTimeout: config.HotKeysWarmupTimeout,
+
+			StorageGrowthTracking: config.StorageGrowthTracking,
+
+			AcceptedIndicesQueueLimit: config.AcceptedIndicesQueueLimit,
+
+			ForensicDumpDir:   config.ForensicDumpDir,
+			ForensicDumpLimit: config.ForensicDumpMaxFiles,
 		}
 	)
 	var err error
@@ -216,10 +245,21 @@ func New(
 		extRPCEnabled:       stack.Config().ExtRPCEnabled(),
 		allowUnprotectedTxs: config.AllowUnprotectedTxs,
 		eth:                 eth,
+		tracePool:           tracers.NewWorkPool(config.TraceConcurrency, config.TraceThrottledConcurrency, config.TraceQueueLimit),
 	}
 	if config.AllowUnprotectedTxs {
 		log.Info("Unprotected transactions allowed")
 	}
+	if config.SubmissionAuditEnabled {
+		if eth.APIBackend.submissionAuditor, err = ethapi.NewSubmissionAuditor(ethapi.SubmissionAuditConfig{
+			File:        config.SubmissionAuditFile,
+			MaxFileSize: config.SubmissionAuditMaxFileSize,
+			MaxFiles:    config.SubmissionAuditMaxFiles,
+			SampleRate:  config.SubmissionAuditSampleRate,
+		}); err != nil {
+			return nil, err
+		}
+	}
 	gpoParams := config.GPO
 	eth.APIBackend.gpo = gasprice.NewOracle(eth.APIBackend, gpoParams)
 
@@ -353,6 +393,9 @@ func (s *Ethereum) Stop() error {
 	s.txPool.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
+	if err := s.APIBackend.submissionAuditor.Close(); err != nil {
+		log.Error("Failed to close the submission audit log", "err", err)
+	}
 
 	// Clean shutdown marker as the last thing before closing db
 	s.shutdownTracker.Stop()
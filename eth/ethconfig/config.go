@@ -44,6 +44,9 @@ var DefaultFullGPOConfig = gasprice.Config{
 	MinPrice:            gasprice.DefaultMinPrice,
 	MaxPrice:            gasprice.DefaultMaxPrice,
 	MinGasUsed:          gasprice.DefaultMinGasUsed,
+	MinSampleBlocks:     5,
+	FallbackTip:         gasprice.DefaultFallbackTip,
+	FeeHistoryCacheSize: gasprice.DefaultFeeHistoryCacheSize,
 }
 
 // DefaultConfig contains default settings for use on the Avalanche main net.
@@ -62,6 +65,7 @@ func NewDefaultConfig() Config {
 		TxPool:             core.DefaultTxPoolConfig,
 		RPCGasCap:          25000000,
 		RPCEVMTimeout:      5 * time.Second,
+		CallAtMaxStaleness: 32,
 		GPO:                DefaultFullGPOConfig,
 		RPCTxFeeCap:        1, // 1 AVAX
 	}
@@ -112,6 +116,42 @@ type Config struct {
 	SnapshotCache  int
 	Preimages      bool
 
+	// Sizes (in number of items) of the blockchain's recent header, body,
+	// receipt and block caches. Zero values use the core defaults.
+	HeaderCache   int
+	BodyCache     int
+	ReceiptsCache int
+	BlockCache    int
+
+	// AccountCache is the number of accounts whose balance and nonce at the
+	// last accepted block are cached for the API. Zero disables the cache.
+	AccountCache int
+
+	// StorageCommitWorkers is the number of goroutines hashing and committing
+	// the modified storage tries of a block. Zero uses GOMAXPROCS.
+	StorageCommitWorkers int
+
+	// HotKeysWarmup is the number of state keys accessed the most by a block
+	// that are warmed up while its children are processed, for at most
+	// HotKeysWarmupTimeout. Zero disables the warm-up.
+	HotKeysWarmup        int
+	HotKeysWarmupTimeout time.Duration
+
+	// StorageGrowthTracking records the storage slots and code added by each
+	// account in the processed blocks, returned by BlockChain.StorageGrowth.
+	StorageGrowthTracking bool
+
+	// AcceptedIndicesQueueLimit is the number of accepted blocks whose tx
+	// lookup entries and accepted events may be written in the background
+	// before Accept waits for them. Zero uses the default.
+	AcceptedIndicesQueueLimit int
+
+	// ForensicDumpDir is the directory to write forensic dumps of blocks
+	// failing with a state or receipt root mismatch to, keeping at most
+	// ForensicDumpMaxFiles of them. An empty directory disables the dumps.
+	ForensicDumpDir      string
+	ForensicDumpMaxFiles int
+
 	// Mining options
 	Miner miner.Config
 
@@ -137,6 +177,53 @@ type Config struct {
 	// send-transction variants. The unit is ether.
 	RPCTxFeeCap float64 `toml:",omitempty"`
 
+	// RPCFeeCapMultiple is the maximum multiple of the estimated base fee
+	// allowed as the max fee per gas of locally submitted transactions. Zero
+	// disables the check.
+	RPCFeeCapMultiple float64 `toml:",omitempty"`
+
+	// RPCFeeGuardrailCap is the maximum potential fee (max fee per gas * gas
+	// limit) of locally submitted transactions. Unlike RPCTxFeeCap it can be
+	// bypassed for a single submission. The unit is ether, zero disables the check.
+	RPCFeeGuardrailCap float64 `toml:",omitempty"`
+
+	// SubmissionAuditEnabled records the raw transaction submissions served by
+	// the API to SubmissionAuditFile, or to the structured logger if empty,
+	// rotating the file above SubmissionAuditMaxFileSize bytes and keeping
+	// SubmissionAuditMaxFiles rotated files. SubmissionAuditSampleRate is the
+	// fraction of the submissions recorded.
+	SubmissionAuditEnabled     bool    `toml:",omitempty"`
+	SubmissionAuditFile        string  `toml:",omitempty"`
+	SubmissionAuditMaxFileSize int64   `toml:",omitempty"`
+	SubmissionAuditMaxFiles    int     `toml:",omitempty"`
+	SubmissionAuditSampleRate  float64 `toml:",omitempty"`
+
+	// RPCFullBlockTxLimit is the maximum number of transactions of the blocks
+	// returned with full transactions, unless a request allows large
+	// responses. Zero disables the check.
+	RPCFullBlockTxLimit int `toml:",omitempty"`
+
+	// RPCFullBlockSizeLimit is the maximum size of the transactions of the
+	// blocks returned with full transactions, unless a request allows large
+	// responses. The unit is bytes, zero disables the check.
+	RPCFullBlockSizeLimit uint64 `toml:",omitempty"`
+
+	// TraceBlockWorkers is the number of transactions traced in parallel when
+	// tracing a block. Zero uses the number of CPUs.
+	TraceBlockWorkers int
+
+	// TraceConcurrency is the number of trace requests executed concurrently,
+	// TraceThrottledConcurrency while a block is processed, queueing up to
+	// TraceQueueLimit requests. Zero TraceConcurrency does not bound them.
+	TraceConcurrency          int
+	TraceThrottledConcurrency int
+	TraceQueueLimit           int
+
+	// CallAtMaxStaleness is the maximum number of blocks below the requested
+	// block whose state debug_callAt may execute a call on, if the state of
+	// the requested block is not retained.
+	CallAtMaxStaleness uint64
+
 	// AllowUnfinalizedQueries allow unfinalized queries
 	AllowUnfinalizedQueries bool
 
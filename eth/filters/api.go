@@ -64,6 +64,8 @@ type PublicFilterAPI struct {
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
 	timeout   time.Duration
+
+	logsRequests logsRequests // getLogs requests in flight on each connection
 }
 
 // NewPublicFilterAPI returns a new PublicFilterAPI instance.
@@ -214,6 +216,83 @@ func (api *PublicFilterAPI) NewAcceptedTransactions(ctx context.Context) (*rpc.S
 	return rpcSub, nil
 }
 
+// IncludedTxsCriteria selects the transactions an includedTransactions
+// subscription reports on. A transaction matches if its hash is listed in
+// [Hashes] or if its sender or recipient is listed in [Addresses]. Empty
+// criteria match every transaction.
+type IncludedTxsCriteria struct {
+	Hashes    []common.Hash    `json:"hashes"`
+	Addresses []common.Address `json:"addresses"`
+}
+
+func (c IncludedTxsCriteria) matches(tx *types.Transaction) bool {
+	if len(c.Hashes) == 0 && len(c.Addresses) == 0 {
+		return true
+	}
+	txHash := tx.Hash()
+	for _, h := range c.Hashes {
+		if h == txHash {
+			return true
+		}
+	}
+	if len(c.Addresses) == 0 {
+		return false
+	}
+	to := tx.To()
+	// The sender is typically recovered and cached during block verification,
+	// so this does not usually perform an additional ecrecover.
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	for _, addr := range c.Addresses {
+		if (err == nil && addr == from) || (to != nil && addr == *to) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludedTx is the notification sent to includedTransactions subscribers when
+// a block containing a matching transaction changes phase.
+type IncludedTx struct {
+	TxHash    common.Hash    `json:"txHash"`
+	BlockHash common.Hash    `json:"blockHash"`
+	Height    hexutil.Uint64 `json:"height"`
+	Phase     string         `json:"phase"`
+}
+
+// IncludedTransactions creates a subscription that is triggered each time a
+// block containing a transaction matching [crit] is verified, accepted or
+// rejected. To change the criteria, unsubscribe and subscribe again.
+func (api *PublicFilterAPI) IncludedTransactions(ctx context.Context, crit IncludedTxsCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		included := make(chan []*IncludedTx, 128)
+		includedSub := api.events.SubscribeIncludedTxs(crit, included)
+
+		for {
+			select {
+			case events := <-included:
+				for _, ev := range events {
+					notifier.Notify(rpcSub.ID, ev)
+				}
+			case <-rpcSub.Err():
+				includedSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				includedSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
@@ -401,9 +480,13 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 }
 
 // GetLogs returns logs matching the given argument that are stored within the state.
+// Unless the requests have an execution budget, the logs are streamed into the
+// response as the blocks are scanned. A range exhausting the execution budget
+// of a request fails with a PartialLogsError, holding the logs up to the block
+// to resume from.
 //
 // https://eth.wiki/json-rpc/API#eth_getlogs
-func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
+func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) (rpc.StreamedResult, error) {
 	var filter *Filter
 	if crit.BlockHash != nil {
 		// Block filter requested, construct a single-shot filter
@@ -427,12 +510,39 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 			return nil, err
 		}
 	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), err
+	return func(enc *rpc.StreamEncoder) error {
+		max := api.backend.GetMaxConcurrentLogsRequestsPerConn()
+		conn, ok := api.logsRequests.acquire(ctx, max)
+		if !ok {
+			return fmt.Errorf("too many concurrent getLogs requests on this connection, maximum is set to %d", max)
+		}
+		defer api.logsRequests.release(conn)
+
+		// The logs of a budget are collected to be returned by the error
+		// exhausting it, and bounded by it
+		if newLogsBudget(api.backend) != nil {
+			logs, err := filter.Logs(ctx)
+			if err != nil {
+				return err
+			}
+			return enc.Value(returnLogs(logs))
+		}
+		if err := enc.BeginArray(); err != nil {
+			return err
+		}
+		err := filter.StreamLogs(ctx, func(logs []*types.Log) error {
+			for _, log := range logs {
+				if err := enc.Value(log); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return enc.EndArray()
+	}, nil
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -60,6 +60,7 @@ type Backend interface {
 	SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription
 
 	SubscribeAcceptedTransactionEvent(ch chan<- core.NewTxsEvent) event.Subscription
+	SubscribeIncludedTransactionEvent(ch chan<- core.IncludedTxsEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
@@ -68,6 +69,11 @@ type Backend interface {
 	GetVMConfig() *vm.Config
 	LastAcceptedBlock() *types.Block
 	GetMaxBlocksPerRequest() int64
+	GetMaxBlocksPerMultiRequest() int64
+	GetMaxLogsPerMultiRequest() int64
+	GetMaxBlocksScannedPerRequest() int64
+	GetMaxLogsPerRequest() int64
+	GetMaxConcurrentLogsRequestsPerConn() int
 }
 
 // Filter can be used to retrieve and filter logs.
@@ -82,6 +88,7 @@ type Filter struct {
 	begin, end int64       // Range interval if filtering multiple blocks
 
 	matcher *bloombits.Matcher
+	budget  *logsBudget // Budget of the scans of the filter, if limited
 }
 
 // NewRangeFilter creates a new filter which uses a bloom filter on blocks to
@@ -153,26 +160,46 @@ func newFilter(backend Backend, addresses []common.Address, topics [][]common.Ha
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
+	var logs []*types.Log
+	err := f.StreamLogs(ctx, func(found []*types.Log) error {
+		logs = append(logs, found...)
+		return nil
+	})
+	if errors.Is(err, errLogsBudgetExhausted) {
+		return nil, &PartialLogsError{LastBlock: uint64(f.begin) - 1, Logs: logs}
+	}
+	return logs, err
+}
+
+// StreamLogs searches the blockchain for matching log entries like Logs, but
+// passes the logs of each matching block to [fn] as they are found instead of
+// returning them. The search stops at the first error of [fn], which is
+// returned.
+func (f *Filter) StreamLogs(ctx context.Context, fn func([]*types.Log) error) error {
 	// If we're doing singleton block filtering, execute and return
 	if f.block != (common.Hash{}) {
 		header, err := f.backend.HeaderByHash(ctx, f.block)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if header == nil {
-			return nil, errors.New("unknown block")
+			return errors.New("unknown block")
+		}
+		logs, err := f.blockLogs(ctx, header)
+		if err != nil || len(logs) == 0 {
+			return err
 		}
-		return f.blockLogs(ctx, header)
+		return fn(logs)
 	}
 	// Figure out the limits of the filter range
 	// LatestBlockNumber is transformed into the last accepted block in HeaderByNumber
 	// so it is left in place here.
 	header, err := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if header == nil {
-		return nil, nil
+		return nil
 	}
 	head := header.Number.Uint64()
 
@@ -191,49 +218,63 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	// are no logs from the specified beginning to end (when in reality there may
 	// be some).
 	if end < uint64(f.begin) {
-		return nil, fmt.Errorf("begin block %d is greater than end block %d", f.begin, end)
+		return fmt.Errorf("begin block %d is greater than end block %d", f.begin, end)
 	}
 
 	// If the requested range of blocks exceeds the maximum number of blocks allowed by the backend
 	// return an error instead of searching for the logs.
 	if maxBlocks := f.backend.GetMaxBlocksPerRequest(); int64(end)-f.begin > maxBlocks && maxBlocks > 0 {
-		return nil, fmt.Errorf("requested too many blocks from %d to %d, maximum is set to %d", f.begin, int64(end), maxBlocks)
+		return fmt.Errorf("requested too many blocks from %d to %d, maximum is set to %d", f.begin, int64(end), maxBlocks)
 	}
-	// Gather all indexed logs, and finish with non indexed ones
+	f.budget = newLogsBudget(f.backend)
+	return f.scanLogs(ctx, end, fn)
+}
+
+// rangeLogs returns the logs matching the filter criteria from the start of
+// the filter up to [end], without checking the range is allowed.
+func (f *Filter) rangeLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
 	var logs []*types.Log
+	err := f.scanLogs(ctx, end, func(found []*types.Log) error {
+		logs = append(logs, found...)
+		return nil
+	})
+	return logs, err
+}
+
+// scanLogs passes the logs matching the filter criteria from the start of the
+// filter up to [end] to [fn], block by block.
+func (f *Filter) scanLogs(ctx context.Context, end uint64, fn func([]*types.Log) error) error {
+	// Gather all indexed logs, and finish with non indexed ones
 	size, sections := f.backend.BloomStatus()
 	if indexed := sections * size; indexed > uint64(f.begin) {
+		var err error
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			err = f.indexedLogs(ctx, end, fn)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			err = f.indexedLogs(ctx, indexed-1, fn)
 		}
 		if err != nil {
-			return logs, err
+			return err
 		}
 	}
-	rest, err := f.unindexedLogs(ctx, end)
-	logs = append(logs, rest...)
-	return logs, err
+	return f.unindexedLogs(ctx, end, fn)
 }
 
-// indexedLogs returns the logs matching the filter criteria based on the bloom
-// bits indexed available locally or via the network.
-func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+// indexedLogs passes the logs matching the filter criteria based on the bloom
+// bits indexed available locally or via the network to [fn].
+func (f *Filter) indexedLogs(ctx context.Context, end uint64, fn func([]*types.Log) error) error {
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
 	session, err := f.matcher.Start(ctx, uint64(f.begin), end, matches)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer session.Close()
 
 	f.backend.ServiceFilter(ctx, session)
 
 	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
-
 	for {
 		select {
 		case number, ok := <-matches:
@@ -243,44 +284,65 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				if err == nil {
 					f.begin = int64(end) + 1
 				}
-				return logs, err
+				return err
 			}
-			f.begin = int64(number) + 1
+			f.begin = int64(number)
 
 			// Retrieve the suggested block and pull any truly matching logs
 			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
 			if header == nil || err != nil {
-				return logs, err
+				return err
 			}
 			found, err := f.checkMatches(ctx, header)
 			if err != nil {
-				return logs, err
+				return err
+			}
+			if !f.budget.spend(2, int64(len(found))) {
+				return errLogsBudgetExhausted
+			}
+			f.begin = int64(number) + 1
+			if len(found) > 0 {
+				if err := fn(found); err != nil {
+					return err
+				}
 			}
-			logs = append(logs, found...)
 
 		case <-ctx.Done():
-			return logs, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
 
-// unindexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
-	var logs []*types.Log
-
+// unindexedLogs passes the logs matching the filter criteria based on raw
+// block iteration and bloom matching to [fn].
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, fn func([]*types.Log) error) error {
 	for ; f.begin <= int64(end); f.begin++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
-			return logs, err
+			return err
 		}
 		found, err := f.blockLogs(ctx, header)
 		if err != nil {
-			return logs, err
+			return err
+		}
+		// The logs of the block are only fetched if its bloom matches
+		reads := int64(1)
+		if bloomFilter(header.Bloom, f.addresses, f.topics) {
+			reads++
+		}
+		if !f.budget.spend(reads, int64(len(found))) {
+			return errLogsBudgetExhausted
+		}
+		if len(found) > 0 {
+			if err := fn(found); err != nil {
+				return err
+			}
 		}
-		logs = append(logs, found...)
 	}
-	return logs, nil
+	return nil
 }
 
 // blockLogs returns the logs matching the filter criteria within a single block.
@@ -35,6 +35,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/zsmartex/coreth/core"
@@ -68,6 +69,9 @@ const (
 	BlocksSubscription
 	// AcceptedBlocksSubscription queries hashes for blocks that are accepted
 	AcceptedBlocksSubscription
+	// IncludedTransactionsSubscription queries inclusion events for matching
+	// transactions as their containing blocks are verified, accepted or rejected
+	IncludedTransactionsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -76,8 +80,6 @@ const (
 	// txChanSize is the size of channel listening to NewTxsEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
-	// rmLogsChanSize is the size of channel listening to RemovedLogsEvent.
-	rmLogsChanSize = 10
 	// logsChanSize is the size of channel listening to LogsEvent.
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
@@ -85,15 +87,17 @@ const (
 )
 
 type subscription struct {
-	id        rpc.ID
-	typ       Type
-	created   time.Time
-	logsCrit  interfaces.FilterQuery
-	logs      chan []*types.Log
-	hashes    chan []common.Hash
-	headers   chan *types.Header
-	installed chan struct{} // closed when the filter is installed
-	err       chan error    // closed when the filter is uninstalled
+	id           rpc.ID
+	typ          Type
+	created      time.Time
+	logsCrit     interfaces.FilterQuery
+	logs         chan []*types.Log
+	hashes       chan []common.Hash
+	headers      chan *types.Header
+	includedCrit IncludedTxsCriteria
+	included     chan []*IncludedTx
+	installed    chan struct{} // closed when the filter is installed
+	err          chan error    // closed when the filter is uninstalled
 }
 
 // EventSystem creates subscriptions, processes events and broadcasts them to the
@@ -107,11 +111,11 @@ type EventSystem struct {
 	txsSub           event.Subscription // Subscription for new transaction event
 	logsSub          event.Subscription // Subscription for new log event
 	logsAcceptedSub  event.Subscription // Subscription for new accepted log event
-	rmLogsSub        event.Subscription // Subscription for removed log event
 	pendingLogsSub   event.Subscription // Subscription for pending log event
 	chainSub         event.Subscription // Subscription for new chain event
 	chainAcceptedSub event.Subscription // Subscription for new chain accepted event
 	txsAcceptedSub   event.Subscription // Subscription for new accepted txs
+	txsIncludedSub   event.Subscription // Subscription for tx inclusion events
 
 	// Channels
 	install         chan *subscription         // install filter for event notification
@@ -120,10 +124,10 @@ type EventSystem struct {
 	logsCh          chan []*types.Log          // Channel to receive new log event
 	logsAcceptedCh  chan []*types.Log          // Channel to receive new accepted log event
 	pendingLogsCh   chan []*types.Log          // Channel to receive new log event
-	rmLogsCh        chan core.RemovedLogsEvent // Channel to receive removed log event
 	chainCh         chan core.ChainEvent       // Channel to receive new chain event
 	chainAcceptedCh chan core.ChainEvent       // Channel to receive new chain accepted event
 	txsAcceptedCh   chan core.NewTxsEvent      // Channel to receive new accepted txs
+	txsIncludedCh   chan core.IncludedTxsEvent // Channel to receive tx inclusion events
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -141,25 +145,25 @@ func NewEventSystem(backend Backend, lightMode bool) *EventSystem {
 		txsCh:           make(chan core.NewTxsEvent, txChanSize),
 		logsCh:          make(chan []*types.Log, logsChanSize),
 		logsAcceptedCh:  make(chan []*types.Log, logsChanSize),
-		rmLogsCh:        make(chan core.RemovedLogsEvent, rmLogsChanSize),
 		pendingLogsCh:   make(chan []*types.Log, logsChanSize),
 		chainCh:         make(chan core.ChainEvent, chainEvChanSize),
 		chainAcceptedCh: make(chan core.ChainEvent, chainEvChanSize),
 		txsAcceptedCh:   make(chan core.NewTxsEvent, txChanSize),
+		txsIncludedCh:   make(chan core.IncludedTxsEvent, chainEvChanSize),
 	}
 
 	// Subscribe events
 	m.txsSub = m.backend.SubscribeNewTxsEvent(m.txsCh)
 	m.logsSub = m.backend.SubscribeLogsEvent(m.logsCh)
 	m.logsAcceptedSub = m.backend.SubscribeAcceptedLogsEvent(m.logsAcceptedCh)
-	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
 	m.chainAcceptedSub = m.backend.SubscribeChainAcceptedEvent(m.chainAcceptedCh)
 	m.pendingLogsSub = m.backend.SubscribePendingLogsEvent(m.pendingLogsCh)
 	m.txsAcceptedSub = m.backend.SubscribeAcceptedTransactionEvent(m.txsAcceptedCh)
+	m.txsIncludedSub = m.backend.SubscribeIncludedTransactionEvent(m.txsIncludedCh)
 
 	// Make sure none of the subscriptions are empty
-	if m.txsSub == nil || m.logsSub == nil || m.logsAcceptedSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.chainAcceptedSub == nil || m.pendingLogsSub == nil || m.txsAcceptedSub == nil {
+	if m.txsSub == nil || m.logsSub == nil || m.logsAcceptedSub == nil || m.chainSub == nil || m.chainAcceptedSub == nil || m.pendingLogsSub == nil || m.txsAcceptedSub == nil || m.txsIncludedSub == nil {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -195,6 +199,7 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.included:
 			}
 		}
 
@@ -406,8 +411,30 @@ func (es *EventSystem) SubscribeAcceptedTxs(hashes chan []common.Hash) *Subscrip
 	return es.subscribe(sub)
 }
 
+// SubscribeIncludedTxs creates a subscription that writes inclusion events for
+// transactions matching [crit] as their containing blocks are verified, accepted
+// or rejected. The criteria of an installed subscription are fixed, so callers
+// change them by unsubscribing and subscribing again with the new criteria.
+func (es *EventSystem) SubscribeIncludedTxs(crit IncludedTxsCriteria, included chan []*IncludedTx) *Subscription {
+	sub := &subscription{
+		id:           rpc.NewID(),
+		typ:          IncludedTransactionsSubscription,
+		created:      time.Now(),
+		logs:         make(chan []*types.Log),
+		hashes:       make(chan []common.Hash),
+		headers:      make(chan *types.Header),
+		includedCrit: crit,
+		included:     included,
+		installed:    make(chan struct{}),
+		err:          make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 type filterIndex map[Type]map[rpc.ID]*subscription
 
+// handleLogs notifies the logs of the preferred chain. On a reorg, [ev] holds
+// the removed logs of the old chain followed by the logs of the new chain.
 func (es *EventSystem) handleLogs(filters filterIndex, ev []*types.Log) {
 	if len(ev) == 0 {
 		return
@@ -444,15 +471,6 @@ func (es *EventSystem) handlePendingLogs(filters filterIndex, ev []*types.Log) {
 	}
 }
 
-func (es *EventSystem) handleRemovedLogs(filters filterIndex, ev core.RemovedLogsEvent) {
-	for _, f := range filters[LogsSubscription] {
-		matchedLogs := filterLogs(ev.Logs, f.logsCrit.FromBlock, f.logsCrit.ToBlock, f.logsCrit.Addresses, f.logsCrit.Topics)
-		if len(matchedLogs) > 0 {
-			f.logs <- matchedLogs
-		}
-	}
-}
-
 func (es *EventSystem) handleTxsEvent(filters filterIndex, ev core.NewTxsEvent, accepted bool) {
 	hashes := make([]common.Hash, 0, len(ev.Txs))
 	for _, tx := range ev.Txs {
@@ -468,6 +486,34 @@ func (es *EventSystem) handleTxsEvent(filters filterIndex, ev core.NewTxsEvent,
 	}
 }
 
+func (es *EventSystem) handleIncludedTxsEvent(filters filterIndex, ev core.IncludedTxsEvent) {
+	if len(filters[IncludedTransactionsSubscription]) == 0 {
+		return
+	}
+	var (
+		blockHash = ev.Block.Hash()
+		height    = hexutil.Uint64(ev.Block.NumberU64())
+		phase     = ev.Phase.String()
+	)
+	for _, f := range filters[IncludedTransactionsSubscription] {
+		var matched []*IncludedTx
+		for _, tx := range ev.Block.Transactions() {
+			if !f.includedCrit.matches(tx) {
+				continue
+			}
+			matched = append(matched, &IncludedTx{
+				TxHash:    tx.Hash(),
+				BlockHash: blockHash,
+				Height:    height,
+				Phase:     phase,
+			})
+		}
+		if len(matched) > 0 {
+			f.included <- matched
+		}
+	}
+}
+
 func (es *EventSystem) handleChainEvent(filters filterIndex, ev core.ChainEvent) {
 	for _, f := range filters[BlocksSubscription] {
 		f.headers <- ev.Block.Header()
@@ -578,11 +624,11 @@ func (es *EventSystem) eventLoop() {
 		es.txsSub.Unsubscribe()
 		es.logsSub.Unsubscribe()
 		es.logsAcceptedSub.Unsubscribe()
-		es.rmLogsSub.Unsubscribe()
 		es.pendingLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
 		es.chainAcceptedSub.Unsubscribe()
 		es.txsAcceptedSub.Unsubscribe()
+		es.txsIncludedSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -598,8 +644,6 @@ func (es *EventSystem) eventLoop() {
 			es.handleLogs(index, ev)
 		case ev := <-es.logsAcceptedCh:
 			es.handleAcceptedLogs(index, ev)
-		case ev := <-es.rmLogsCh:
-			es.handleRemovedLogs(index, ev)
 		case ev := <-es.pendingLogsCh:
 			es.handlePendingLogs(index, ev)
 		case ev := <-es.chainCh:
@@ -608,6 +652,8 @@ func (es *EventSystem) eventLoop() {
 			es.handleChainAcceptedEvent(index, ev)
 		case ev := <-es.txsAcceptedCh:
 			es.handleTxsEvent(index, ev, true)
+		case ev := <-es.txsIncludedCh:
+			es.handleIncludedTxsEvent(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
@@ -636,14 +682,14 @@ func (es *EventSystem) eventLoop() {
 			return
 		case <-es.logsAcceptedSub.Err():
 			return
-		case <-es.rmLogsSub.Err():
-			return
 		case <-es.chainSub.Err():
 			return
 		case <-es.chainAcceptedSub.Err():
 			return
 		case <-es.txsAcceptedSub.Err():
 			return
+		case <-es.txsIncludedSub.Err():
+			return
 		}
 	}
 }
@@ -0,0 +1,62 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// cancellingLogsBackend cancels the request once [after] headers of the range
+// are read.
+type cancellingLogsBackend struct {
+	*syntheticLogsBackend
+	cancel context.CancelFunc
+	after  int
+	reads  int
+}
+
+func (b *cancellingLogsBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number >= 0 {
+		b.reads++
+		if b.reads == b.after {
+			b.cancel()
+		}
+	}
+	return b.syntheticLogsBackend.HeaderByNumber(ctx, number)
+}
+
+func TestFilterLogsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := &cancellingLogsBackend{
+		syntheticLogsBackend: &syntheticLogsBackend{
+			multiLogsBackend: &multiLogsBackend{},
+			blocks:           1000,
+			logsPerBlock:     1,
+		},
+		cancel: cancel,
+		after:  10,
+	}
+	filter, err := NewRangeFilter(backend, 0, 999, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := 0
+	err = filter.StreamLogs(ctx, func([]*types.Log) error {
+		blocks++
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the scan to be cancelled, found %v", err)
+	}
+	// The scan stops at the block following the cancellation
+	if backend.reads != backend.after || blocks != backend.after {
+		t.Fatalf("Expected the scan to stop after %d blocks, found %d headers read and %d blocks of logs", backend.after, backend.reads, blocks)
+	}
+}
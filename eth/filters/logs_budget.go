@@ -0,0 +1,116 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// errLogsBudgetExhausted is returned by the scans of a filter stopping at the
+// first block that does not fit in its budget.
+var errLogsBudgetExhausted = errors.New("getLogs execution budget exhausted")
+
+// logsBudget bounds the work of a getLogs request by the number of blocks it
+// scans and the number of logs it returns. A block counts once for reading
+// its header and once more for fetching its logs, which is done for every
+// block matching the bloom filter whether it is indexed or not.
+//
+// Blocks are scanned as a whole, and the first block of a request is always
+// scanned so that every request makes progress.
+type logsBudget struct {
+	maxBlocks, maxLogs int64 // 0 is no maximum
+	blocks, logs       int64
+	scanned            bool
+}
+
+// newLogsBudget returns the budget of a getLogs request served by [backend],
+// or nil if it has no maximum.
+func newLogsBudget(backend Backend) *logsBudget {
+	maxBlocks, maxLogs := backend.GetMaxBlocksScannedPerRequest(), backend.GetMaxLogsPerRequest()
+	if maxBlocks <= 0 && maxLogs <= 0 {
+		return nil
+	}
+	return &logsBudget{maxBlocks: maxBlocks, maxLogs: maxLogs}
+}
+
+// spend charges the budget with a block whose scan took [blocks] reads and
+// returned [logs] logs. It returns false without charging the budget if the
+// block does not fit in it.
+func (b *logsBudget) spend(blocks, logs int64) bool {
+	if b == nil {
+		return true
+	}
+	if b.scanned && ((b.maxBlocks > 0 && b.blocks+blocks > b.maxBlocks) || (b.maxLogs > 0 && b.logs+logs > b.maxLogs)) {
+		return false
+	}
+	b.blocks += blocks
+	b.logs += logs
+	b.scanned = true
+	return true
+}
+
+// PartialLogsError is returned by a getLogs request exhausting its budget. It
+// holds the logs of the blocks up to LastBlock included, so that the request
+// can be resumed from the block after it without missing any log.
+type PartialLogsError struct {
+	LastBlock uint64
+	Logs      []*types.Log
+}
+
+func (e *PartialLogsError) Error() string {
+	return fmt.Sprintf("%s, returning the logs up to block %d", errLogsBudgetExhausted, e.LastBlock)
+}
+
+// ErrorCode returns the code of an exceeded limit, as defined by EIP-1474.
+func (e *PartialLogsError) ErrorCode() int { return -32005 }
+
+// ErrorData returns the last scanned block and the logs found up to it.
+func (e *PartialLogsError) ErrorData() interface{} {
+	return map[string]interface{}{
+		"lastBlock": hexutil.Uint64(e.LastBlock),
+		"logs":      returnLogs(e.Logs),
+	}
+}
+
+// logsRequests tracks the getLogs requests being served on each connection.
+type logsRequests struct {
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+// acquire registers a request on the connection of [ctx], returning false if
+// it already has [max] requests in flight. 0 is no maximum.
+func (l *logsRequests) acquire(ctx context.Context, max int) (string, bool) {
+	info := rpc.PeerInfoFromContext(ctx)
+	conn := info.Transport + "://" + info.RemoteAddr
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if max > 0 && l.requests[conn] >= max {
+		return conn, false
+	}
+	if l.requests == nil {
+		l.requests = make(map[string]int)
+	}
+	l.requests[conn]++
+	return conn, true
+}
+
+// release unregisters a request on [conn].
+func (l *logsRequests) release(conn string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.requests[conn]--; l.requests[conn] <= 0 {
+		delete(l.requests, conn)
+	}
+}
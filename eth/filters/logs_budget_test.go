@@ -0,0 +1,154 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// resumeLogs runs the range filter from [begin] to [end] of [addresses] until
+// it completes, resuming each request from the block after the last one of the
+// partial result of the previous request.
+func resumeLogs(t *testing.T, backend *multiLogsBackend, begin, end int64, addresses []common.Address) ([]*types.Log, int) {
+	var (
+		logs     []*types.Log
+		requests int
+	)
+	for {
+		requests++
+		filter, err := NewRangeFilter(backend, begin, end, addresses, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := filter.Logs(context.Background())
+		if err == nil {
+			return append(logs, found...), requests
+		}
+		var partial *PartialLogsError
+		if !errors.As(err, &partial) {
+			t.Fatalf("expected a partial result, found %v", err)
+		}
+		if partial.LastBlock < uint64(begin) || partial.LastBlock >= uint64(end) {
+			t.Fatalf("expected a continuation point in [%d, %d), found %d", begin, end, partial.LastBlock)
+		}
+		if found != nil {
+			t.Fatalf("expected the logs to be returned by the partial result only, found %d", len(found))
+		}
+		for _, log := range partial.Logs {
+			if log.BlockNumber < uint64(begin) || log.BlockNumber > partial.LastBlock {
+				t.Fatalf("expected logs from block %d to %d, found a log in block %d", begin, partial.LastBlock, log.BlockNumber)
+			}
+		}
+		logs = append(logs, partial.Logs...)
+		begin = int64(partial.LastBlock) + 1
+	}
+}
+
+func TestLogsBudget(t *testing.T) {
+	tests := map[string]struct {
+		addresses        []common.Address
+		maxBlocksScanned int64
+		maxLogs          int64
+		requests         int
+	}{
+		// Every block matches, so each costs a header and a logs read
+		"blocks scanned, every block matched": {maxBlocksScanned: 10, requests: 4},
+		// Blocks 5, 10, 15 and 20 match: 20 header reads and 4 logs reads
+		"blocks scanned, bloom-matched blocks": {addresses: []common.Address{multiLogsAddr2}, maxBlocksScanned: 10, requests: 3},
+		// Every fifth block has 2 logs, the others 1
+		"logs": {maxLogs: 5, requests: 5},
+		// A block with more logs than the budget is still returned whole
+		"logs, smaller than a block": {maxLogs: 1, requests: 20},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := newMultiLogsBackend(t)
+			filter, err := NewRangeFilter(backend, 1, 20, test.addresses, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := filter.Logs(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend.maxBlocksScanned, backend.maxRequestLogs = test.maxBlocksScanned, test.maxLogs
+			logs, requests := resumeLogs(t, backend, 1, 20, test.addresses)
+			if requests != test.requests {
+				t.Fatalf("expected %d requests, found %d", test.requests, requests)
+			}
+			if !reflect.DeepEqual(logs, expected) {
+				t.Fatalf("expected the resumed requests to return the %d logs of a single request, found %d", len(expected), len(logs))
+			}
+		})
+	}
+}
+
+func TestLogsBudgetErrorData(t *testing.T) {
+	backend := newMultiLogsBackend(t)
+	backend.maxBlocksScanned = 4
+	filter, err := NewRangeFilter(backend, 1, 20, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = filter.Logs(context.Background())
+	var rpcErr rpc.DataError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected an error with data, found %v", err)
+	}
+	if code := err.(rpc.Error).ErrorCode(); code != -32005 {
+		t.Fatalf("expected error code -32005, found %d", code)
+	}
+	data := rpcErr.ErrorData().(map[string]interface{})
+	if last := data["lastBlock"]; last != interface{}(hexutil.Uint64(2)) {
+		t.Fatalf("expected last block 2, found %v", last)
+	}
+	if logs := data["logs"].([]*types.Log); len(logs) != 2 {
+		t.Fatalf("expected the 2 logs of blocks 1 and 2, found %d", len(logs))
+	}
+}
+
+func TestLogsConcurrentRequestsPerConn(t *testing.T) {
+	backend := newMultiLogsBackend(t)
+	backend.maxConcurrent = 1
+	backend.headerGate = make(chan struct{})
+	api := &PublicFilterAPI{backend: backend}
+	crit := FilterCriteria{FromBlock: blockNumber(1), ToBlock: blockNumber(20)}
+
+	done := make(chan error)
+	go func() {
+		_, err := getLogs(context.Background(), api, crit)
+		done <- err
+	}()
+	// Wait for the first request to be in flight
+	for {
+		api.logsRequests.lock.Lock()
+		inFlight := len(api.logsRequests.requests)
+		api.logsRequests.lock.Unlock()
+		if inFlight > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := getLogs(context.Background(), api, crit); err == nil {
+		t.Fatal("expected a second concurrent request on the connection to fail")
+	}
+
+	close(backend.headerGate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getLogs(context.Background(), api, crit); err != nil {
+		t.Fatalf("expected a request after the first one completed to succeed, found %v", err)
+	}
+}
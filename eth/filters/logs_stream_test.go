@@ -0,0 +1,169 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// getLogs returns the logs of the getLogs request [crit] to [api], encoding
+// its streamed result.
+func getLogs(ctx context.Context, api *PublicFilterAPI, crit FilterCriteria) ([]*types.Log, error) {
+	stream, err := api.GetLogs(ctx, crit)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := rpc.EncodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	err = json.Unmarshal(encoded, &logs)
+	return logs, err
+}
+
+// syntheticLogsBackend serves [blocks] blocks of [logsPerBlock] logs holding
+// [data], generated when they are read.
+type syntheticLogsBackend struct {
+	*multiLogsBackend
+	blocks, logsPerBlock int
+	data                 []byte
+}
+
+func (b *syntheticLogsBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number < 0 {
+		number = rpc.BlockNumber(b.blocks - 1)
+	}
+	return &types.Header{Number: big.NewInt(number.Int64())}, nil
+}
+
+func (b *syntheticLogsBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	logs := make([]*types.Log, b.logsPerBlock)
+	for i := range logs {
+		logs[i] = &types.Log{Address: multiLogsAddr1, Data: b.data, TxHash: common.Hash{0x01}, Index: uint(i)}
+	}
+	return [][]*types.Log{logs}, nil
+}
+
+func (b *syntheticLogsBackend) LastAcceptedBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(b.blocks - 1))})
+}
+
+func TestGetLogsStreamed(t *testing.T) {
+	// About 300 MB of logs
+	backend := &syntheticLogsBackend{
+		multiLogsBackend: &multiLogsBackend{},
+		blocks:           100,
+		logsPerBlock:     24,
+		data:             make([]byte, 64*1024),
+	}
+	server := rpc.NewServer(0)
+	defer server.Stop()
+	if err := server.RegisterName("eth", &PublicFilterAPI{backend: backend}); err != nil {
+		t.Fatal(err)
+	}
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	// Sample the heap while the response is read
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	var (
+		baseline = stats.HeapAlloc
+		maxHeap  uint64
+		done     = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > maxHeap {
+					maxHeap = stats.HeapAlloc
+				}
+			}
+		}
+	}()
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{"fromBlock":"0x0","toBlock":"0x63"}]}`
+	resp, err := http.Post(httpsrv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	counter := &countingReader{r: resp.Body}
+	dec := json.NewDecoder(counter)
+	for _, expected := range []interface{}{json.Delim('{'), "jsonrpc", "2.0", "id", 1.0, "result", json.Delim('[')} {
+		if token, err := dec.Token(); err != nil || token != expected {
+			t.Fatalf("Expected token %v, found %v (%v)", expected, token, err)
+		}
+	}
+	logs := 0
+	for dec.More() {
+		var log struct {
+			Data string `json:"data"`
+		}
+		if err := dec.Decode(&log); err != nil {
+			t.Fatal(err)
+		}
+		if len(log.Data) != 2+2*len(backend.data) {
+			t.Fatalf("Expected %d bytes of data, found %d", len(backend.data), (len(log.Data)-2)/2)
+		}
+		logs++
+	}
+	for _, expected := range []json.Delim{']', '}'} {
+		if token, err := dec.Token(); err != nil || token != expected {
+			t.Fatalf("Expected token %v, found %v (%v)", expected, token, err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if expected := backend.blocks * backend.logsPerBlock; logs != expected {
+		t.Fatalf("Expected %d logs, found %d", expected, logs)
+	}
+	if counter.n < 256*1024*1024 {
+		t.Fatalf("Expected a response of more than 256 MiB, found %d bytes", counter.n)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("Expected a chunked response, found transfer encoding %v", resp.TransferEncoding)
+	}
+	if growth := int64(maxHeap) - int64(baseline); growth > 64*1024*1024 {
+		t.Fatalf("Expected the heap to grow by less than 64 MiB, found %d bytes", growth)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,211 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/core/bloombits"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+var errMultiLogsBlockHash = errors.New("block hash filters are not supported by getLogsMulti")
+
+// MultiLogsResult is the outcome of a single sub-query of eth_getLogsMulti.
+// Exactly one of Logs and Error is set.
+type MultiLogsResult struct {
+	Logs  []*types.Log `json:"logs,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// multiLogsQuery is a valid sub-query of eth_getLogsMulti, resolved against
+// the head of the chain.
+type multiLogsQuery struct {
+	index      int
+	begin, end uint64
+	addresses  []common.Address
+	topics     [][]common.Hash
+}
+
+// multiLogsSpan is a range of blocks covered by one or more sub-queries. The
+// blocks of each span are scanned once for all of its queries.
+type multiLogsSpan struct {
+	begin, end uint64
+	queries    []*multiLogsQuery
+}
+
+// GetLogsMulti returns the logs matching each of the given filter criteria,
+// in the same order. Overlapping block ranges are only scanned once. The
+// failure of a sub-query is reported in its result, while exceeding the
+// combined limits on the number of blocks or logs fails the whole call.
+func (api *PublicFilterAPI) GetLogsMulti(ctx context.Context, crits []FilterCriteria) ([]*MultiLogsResult, error) {
+	return getLogsMulti(ctx, api.backend, crits)
+}
+
+func getLogsMulti(ctx context.Context, backend Backend, crits []FilterCriteria) ([]*MultiLogsResult, error) {
+	results := make([]*MultiLogsResult, len(crits))
+	for i := range results {
+		results[i] = &MultiLogsResult{}
+	}
+	// LatestBlockNumber is transformed into the last accepted block in
+	// HeaderByNumber.
+	header, err := backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return results, nil
+	}
+	head := header.Number.Uint64()
+
+	queries := make([]*multiLogsQuery, 0, len(crits))
+	for i, crit := range crits {
+		query, err := newMultiLogsQuery(backend, i, crit, head)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		queries = append(queries, query)
+	}
+	spans := mergeMultiLogsQueries(queries)
+
+	var blocks uint64
+	for _, span := range spans {
+		blocks += span.end - span.begin + 1
+	}
+	if maxBlocks := backend.GetMaxBlocksPerMultiRequest(); maxBlocks > 0 && blocks > uint64(maxBlocks) {
+		return nil, fmt.Errorf("requested too many blocks (%d) across all ranges, maximum is set to %d", blocks, maxBlocks)
+	}
+
+	var (
+		size, _ = backend.BloomStatus()
+		found   int64
+		maxLogs = backend.GetMaxLogsPerMultiRequest()
+	)
+	for _, span := range spans {
+		// Scan the span for the logs of any of its queries, and split them
+		// between the queries afterwards.
+		addresses := span.addresses()
+		var filters [][][]byte
+		if len(addresses) > 0 {
+			filter := make([][]byte, len(addresses))
+			for i, address := range addresses {
+				filter[i] = address.Bytes()
+			}
+			filters = append(filters, filter)
+		}
+		f := newFilter(backend, addresses, nil)
+		f.matcher = bloombits.NewMatcher(size, filters)
+		f.begin = int64(span.begin)
+
+		logs, err := f.rangeLogs(ctx, span.end)
+		if err != nil {
+			for _, query := range span.queries {
+				results[query.index].Error = err.Error()
+			}
+			continue
+		}
+		for _, query := range span.queries {
+			matched := filterLogs(logs, new(big.Int).SetUint64(query.begin), new(big.Int).SetUint64(query.end), query.addresses, query.topics)
+			found += int64(len(matched))
+			if maxLogs > 0 && found > maxLogs {
+				return nil, fmt.Errorf("requested ranges contain too many logs, maximum is set to %d", maxLogs)
+			}
+			results[query.index].Logs = returnLogs(matched)
+		}
+	}
+	return results, nil
+}
+
+// newMultiLogsQuery validates [crit], the sub-query at [index], and resolves
+// its range against [head].
+func newMultiLogsQuery(backend Backend, index int, crit FilterCriteria, head uint64) (*multiLogsQuery, error) {
+	if crit.BlockHash != nil {
+		return nil, errMultiLogsBlockHash
+	}
+	begin, end := int64(head), int64(head)
+	if crit.FromBlock != nil && crit.FromBlock.Int64() >= 0 {
+		begin = crit.FromBlock.Int64()
+	}
+	if crit.ToBlock != nil && crit.ToBlock.Int64() >= 0 {
+		end = crit.ToBlock.Int64()
+	}
+	if !backend.GetVMConfig().AllowUnfinalizedQueries {
+		if lastAccepted := backend.LastAcceptedBlock(); lastAccepted != nil {
+			if number := lastAccepted.Number().Int64(); begin > number {
+				return nil, fmt.Errorf("requested from block %d after last accepted block %d", begin, number)
+			} else if end > number {
+				return nil, fmt.Errorf("requested to block %d after last accepted block %d", end, number)
+			}
+		}
+	}
+	if end < begin {
+		return nil, fmt.Errorf("begin block %d is greater than end block %d", begin, end)
+	}
+	if maxBlocks := backend.GetMaxBlocksPerRequest(); end-begin > maxBlocks && maxBlocks > 0 {
+		return nil, fmt.Errorf("requested too many blocks from %d to %d, maximum is set to %d", begin, end, maxBlocks)
+	}
+	return &multiLogsQuery{
+		index:     index,
+		begin:     uint64(begin),
+		end:       uint64(end),
+		addresses: crit.Addresses,
+		topics:    crit.Topics,
+	}, nil
+}
+
+// mergeMultiLogsQueries groups [queries] into disjoint spans of blocks, each
+// made of overlapping or adjacent ranges. The spans are sorted by their first
+// block.
+func mergeMultiLogsQueries(queries []*multiLogsQuery) []*multiLogsSpan {
+	sorted := make([]*multiLogsQuery, len(queries))
+	copy(sorted, queries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].begin < sorted[j].begin })
+
+	var spans []*multiLogsSpan
+	for _, query := range sorted {
+		if len(spans) > 0 {
+			if last := spans[len(spans)-1]; query.begin <= last.end+1 {
+				if query.end > last.end {
+					last.end = query.end
+				}
+				last.queries = append(last.queries, query)
+				continue
+			}
+		}
+		spans = append(spans, &multiLogsSpan{
+			begin:   query.begin,
+			end:     query.end,
+			queries: []*multiLogsQuery{query},
+		})
+	}
+	return spans
+}
+
+// addresses returns the union of the addresses of the queries of the span,
+// or nil if any of the queries matches all addresses.
+func (s *multiLogsSpan) addresses() []common.Address {
+	var (
+		union []common.Address
+		seen  = make(map[common.Address]struct{})
+	)
+	for _, query := range s.queries {
+		if len(query.addresses) == 0 {
+			return nil
+		}
+		for _, address := range query.addresses {
+			if _, ok := seen[address]; !ok {
+				seen[address] = struct{}{}
+				union = append(union, address)
+			}
+		}
+	}
+	return union
+}
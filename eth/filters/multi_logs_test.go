@@ -0,0 +1,252 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/bloombits"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// multiLogsBackend serves a chain out of a database, counting the headers
+// and logs read for each block.
+type multiLogsBackend struct {
+	db        ethdb.Database
+	head      *types.Block
+	maxBlocks int64
+	maxLogs   int64
+
+	// Limits of getLogs requests
+	maxBlocksScanned int64
+	maxRequestLogs   int64
+	maxConcurrent    int
+	// If set, header reads wait for it to be closed
+	headerGate chan struct{}
+
+	lock        sync.Mutex
+	headerReads map[uint64]int
+	logReads    map[common.Hash]int
+}
+
+func (b *multiLogsBackend) ChainDb() ethdb.Database { return b.db }
+
+func (b *multiLogsBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number < 0 {
+		return b.head.Header(), nil
+	}
+	if b.headerGate != nil {
+		<-b.headerGate
+	}
+	b.lock.Lock()
+	b.headerReads[uint64(number)]++
+	b.lock.Unlock()
+	return rawdb.ReadHeader(b.db, rawdb.ReadCanonicalHash(b.db, uint64(number)), uint64(number)), nil
+}
+
+func (b *multiLogsBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	number := rawdb.ReadHeaderNumber(b.db, hash)
+	if number == nil {
+		return nil, nil
+	}
+	return rawdb.ReadHeader(b.db, hash, *number), nil
+}
+
+func (b *multiLogsBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	number := rawdb.ReadHeaderNumber(b.db, hash)
+	if number == nil {
+		return nil, nil
+	}
+	return rawdb.ReadReceipts(b.db, hash, *number, params.TestChainConfig), nil
+}
+
+func (b *multiLogsBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	b.lock.Lock()
+	b.logReads[hash]++
+	b.lock.Unlock()
+	receipts, _ := b.GetReceipts(ctx, hash)
+	logs := make([][]*types.Log, len(receipts))
+	for i, receipt := range receipts {
+		logs[i] = receipt.Logs
+	}
+	return logs, nil
+}
+
+func (b *multiLogsBackend) SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribeChainEvent(chan<- core.ChainEvent) event.Subscription { return nil }
+func (b *multiLogsBackend) SubscribeChainAcceptedEvent(chan<- core.ChainEvent) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribeRemovedLogsEvent(chan<- core.RemovedLogsEvent) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribeLogsEvent(chan<- []*types.Log) event.Subscription { return nil }
+func (b *multiLogsBackend) SubscribeAcceptedLogsEvent(chan<- []*types.Log) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribePendingLogsEvent(chan<- []*types.Log) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribeAcceptedTransactionEvent(chan<- core.NewTxsEvent) event.Subscription {
+	return nil
+}
+func (b *multiLogsBackend) SubscribeIncludedTransactionEvent(chan<- core.IncludedTxsEvent) event.Subscription {
+	return nil
+}
+
+func (b *multiLogsBackend) BloomStatus() (uint64, uint64)                                        { return params.BloomBitsBlocks, 0 }
+func (b *multiLogsBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {}
+
+func (b *multiLogsBackend) GetVMConfig() *vm.Config            { return &vm.Config{} }
+func (b *multiLogsBackend) LastAcceptedBlock() *types.Block    { return b.head }
+func (b *multiLogsBackend) GetMaxBlocksPerRequest() int64      { return 0 }
+func (b *multiLogsBackend) GetMaxBlocksPerMultiRequest() int64 { return b.maxBlocks }
+func (b *multiLogsBackend) GetMaxLogsPerMultiRequest() int64   { return b.maxLogs }
+func (b *multiLogsBackend) GetMaxBlocksScannedPerRequest() int64 {
+	return b.maxBlocksScanned
+}
+func (b *multiLogsBackend) GetMaxLogsPerRequest() int64              { return b.maxRequestLogs }
+func (b *multiLogsBackend) GetMaxConcurrentLogsRequestsPerConn() int { return b.maxConcurrent }
+
+var (
+	multiLogsAddr1 = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	multiLogsAddr2 = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	multiLogsTopic = common.HexToHash("0x01")
+)
+
+// newMultiLogsBackend returns a backend serving 20 blocks, where every block
+// has a log of [multiLogsAddr1] and every fifth block a log of
+// [multiLogsAddr2] with [multiLogsTopic].
+func newMultiLogsBackend(t *testing.T) *multiLogsBackend {
+	db := rawdb.NewMemoryDatabase()
+	genesis := (&core.Genesis{Config: params.TestChainConfig}).MustCommit(db)
+	blocks, receipts, err := core.GenerateChain(params.TestChainConfig, genesis, dummy.NewFaker(), db, 20, 10, func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: multiLogsAddr1}}
+		if (i+1)%5 == 0 {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: multiLogsAddr2, Topics: []common.Hash{multiLogsTopic}})
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, common.Big0, 0, gen.BaseFee(), nil))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	return &multiLogsBackend{
+		db:          db,
+		head:        blocks[len(blocks)-1],
+		headerReads: make(map[uint64]int),
+		logReads:    make(map[common.Hash]int),
+	}
+}
+
+func blockNumber(n int64) *big.Int { return big.NewInt(n) }
+
+func TestGetLogsMulti(t *testing.T) {
+	backend := newMultiLogsBackend(t)
+	results, err := getLogsMulti(context.Background(), backend, []FilterCriteria{
+		{FromBlock: blockNumber(1), ToBlock: blockNumber(10), Addresses: []common.Address{multiLogsAddr1}},
+		{FromBlock: blockNumber(5), ToBlock: blockNumber(15), Addresses: []common.Address{multiLogsAddr2}, Topics: [][]common.Hash{{multiLogsTopic}}},
+		{FromBlock: blockNumber(8), ToBlock: blockNumber(3)},
+		{BlockHash: &common.Hash{}},
+		{FromBlock: blockNumber(18), Addresses: []common.Address{multiLogsAddr1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		blocks []uint64
+		failed bool
+	}{
+		{blocks: []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{blocks: []uint64{5, 10, 15}},
+		{failed: true},
+		{failed: true},
+		{blocks: []uint64{18, 19, 20}},
+	}
+	for i, result := range results {
+		if expected[i].failed {
+			if result.Error == "" || result.Logs != nil {
+				t.Fatalf("sub-query %d: expected an error, found %+v", i, result)
+			}
+			continue
+		}
+		if result.Error != "" {
+			t.Fatalf("sub-query %d: unexpected error %s", i, result.Error)
+		}
+		if len(result.Logs) != len(expected[i].blocks) {
+			t.Fatalf("sub-query %d: expected %d logs, found %d", i, len(expected[i].blocks), len(result.Logs))
+		}
+		for j, log := range result.Logs {
+			if log.BlockNumber != expected[i].blocks[j] {
+				t.Fatalf("sub-query %d: expected log %d in block %d, found block %d", i, j, expected[i].blocks[j], log.BlockNumber)
+			}
+		}
+	}
+
+	// The overlapping ranges are scanned once, and blocks 16 and 17 never
+	for number := uint64(1); number <= 20; number++ {
+		expected := 1
+		if number == 16 || number == 17 {
+			expected = 0
+		}
+		if reads := backend.headerReads[number]; reads != expected {
+			t.Fatalf("expected header %d to be read %d times, found %d", number, expected, reads)
+		}
+	}
+	for hash, reads := range backend.logReads {
+		if reads != 1 {
+			t.Fatalf("expected logs of block %s to be read once, found %d", hash, reads)
+		}
+	}
+}
+
+func TestGetLogsMultiLimits(t *testing.T) {
+	backend := newMultiLogsBackend(t)
+	crits := []FilterCriteria{
+		{FromBlock: blockNumber(1), ToBlock: blockNumber(10)},
+		{FromBlock: blockNumber(5), ToBlock: blockNumber(12)},
+	}
+
+	// Overlapping blocks only count once towards the range cap
+	backend.maxBlocks = 12
+	if _, err := getLogsMulti(context.Background(), backend, crits); err != nil {
+		t.Fatalf("expected 12 distinct blocks to be allowed, found %v", err)
+	}
+	backend.maxBlocks = 11
+	if _, err := getLogsMulti(context.Background(), backend, crits); err == nil {
+		t.Fatal("expected 12 distinct blocks to exceed the range cap")
+	}
+
+	// Logs count towards the result cap once per sub-query
+	backend.maxBlocks = 0
+	backend.maxLogs = 20
+	if _, err := getLogsMulti(context.Background(), backend, crits); err == nil {
+		t.Fatal("expected 22 logs to exceed the result cap")
+	}
+	backend.maxLogs = 22
+	if _, err := getLogsMulti(context.Background(), backend, crits); err != nil {
+		t.Fatalf("expected 22 logs to be allowed, found %v", err)
+	}
+}
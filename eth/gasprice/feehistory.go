@@ -32,10 +32,14 @@ import (
 	"fmt"
 	"math/big"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/coreth/consensus/dummy"
 	_ "github.com/zsmartex/coreth/consensus/misc"
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/rpc"
@@ -45,8 +49,31 @@ var (
 	errInvalidPercentile     = errors.New("invalid reward percentile")
 	errRequestBeyondHead     = errors.New("request beyond head block")
 	errBeyondHistoricalLimit = errors.New("request beyond historical limit")
+	errMissingAnchor         = errors.New("neither block number nor hash specified")
+	errAnchorUnknown         = errors.New("unknown block")
+	errAnchorNotAccepted     = errors.New("block not accepted")
+	errMissingBlock          = errors.New("missing block")
 )
 
+// anchorErrorCode is the code of the errors of the requests anchored at the
+// hash of a block that is unknown or not accepted.
+const anchorErrorCode = -32001
+
+// anchorError is returned for a request anchored at the hash of a block that
+// is unknown or not accepted.
+type anchorError struct {
+	hash common.Hash
+	err  error
+}
+
+func (e *anchorError) Error() string {
+	return fmt.Sprintf("last block %s: %s", e.hash.Hex(), e.err)
+}
+
+func (e *anchorError) ErrorCode() int { return anchorErrorCode }
+
+func (e *anchorError) Unwrap() error { return e.err }
+
 const (
 	// maxBlockFetchers is the max number of goroutines to spin up to pull blocks
 	// for the fee history calculation (mostly relevant for LES).
@@ -69,6 +96,44 @@ type processedFees struct {
 	gasUsedRatio float64
 }
 
+// copy returns a deep copy of [f], so that the cached results are never
+// handed out to be mutated by the callers.
+func (f processedFees) copy() processedFees {
+	cpy := f
+	if f.reward != nil {
+		cpy.reward = make([]*big.Int, len(f.reward))
+		for i, reward := range f.reward {
+			cpy.reward[i] = new(big.Int).Set(reward)
+		}
+	}
+	if f.baseFee != nil {
+		cpy.baseFee = new(big.Int).Set(f.baseFee)
+	}
+	return cpy
+}
+
+// percentilesKey is the key of the [processedFees] of a block cached for a
+// list of reward percentiles.
+type percentilesKey struct {
+	blockNumber uint64
+	percentiles string
+}
+
+// percentilesFingerprint returns the fingerprint of [percentiles], shared by
+// the lists of the same percentiles. Each percentile is formatted to the
+// shortest decimal that parses back to it, so that the lists sharing a
+// fingerprint share their results.
+func percentilesFingerprint(percentiles []float64) string {
+	var sb strings.Builder
+	for i, p := range percentiles {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	return sb.String()
+}
+
 // txGasAndReward is sorted in ascending order based on reward
 type (
 	txGasAndReward struct {
@@ -111,68 +176,163 @@ func processBlock(block *types.Block, receipts types.Receipts) *slimBlock {
 	return &sb
 }
 
+// zeroRewards returns [n] zero rewards.
+func zeroRewards(n int) []*big.Int {
+	rewards := make([]*big.Int, n)
+	for i := range rewards {
+		rewards[i] = new(big.Int)
+	}
+	return rewards
+}
+
 // processPercentiles returns a [processedFees] object with a populated
 // baseFee, gasUsedRatio, and optionally reward percentiles (if any are
-// requested)
+// requested). The values are copies, [sb] may be cached.
 func (sb *slimBlock) processPercentiles(percentiles []float64) processedFees {
 	var results processedFees
-	results.baseFee = sb.BaseFee // already set to be non-nil
+	results.baseFee = new(big.Int).Set(sb.BaseFee) // already set to be non-nil
 	results.gasUsedRatio = float64(sb.GasUsed) / float64(sb.GasLimit)
 	if len(percentiles) == 0 {
 		// rewards were not requested
 		return results
 	}
 
-	txLen := len(sb.Txs)
-	results.reward = make([]*big.Int, len(percentiles))
-	if txLen == 0 {
+	if len(sb.Txs) == 0 {
 		// return an all zero row if there are no transactions to gather data from
-		for i := range results.reward {
-			results.reward[i] = new(big.Int)
-		}
+		results.reward = zeroRewards(len(percentiles))
 		return results
 	}
 
 	// sb transactions are already sorted by tip, so we don't need to re-sort
+	results.reward = gasWeightedRewards(sb.Txs, sb.GasUsed, percentiles)
+	return results
+}
+
+// gasWeightedRewards returns copies of the rewards of [txs], sorted by reward,
+// at the ascending [percentiles] of [gasUsed].
+func gasWeightedRewards(txs []txGasAndReward, gasUsed uint64, percentiles []float64) []*big.Int {
+	rewards := make([]*big.Int, len(percentiles))
 	var txIndex int
-	sumGasUsed := sb.Txs[0].gasUsed
+	sumGasUsed := txs[0].gasUsed
 	for i, p := range percentiles {
-		thresholdGasUsed := uint64(float64(sb.GasUsed) * p / 100)
-		for sumGasUsed < thresholdGasUsed && txIndex < txLen-1 {
+		thresholdGasUsed := uint64(float64(gasUsed) * p / 100)
+		for sumGasUsed < thresholdGasUsed && txIndex < len(txs)-1 {
 			txIndex++
-			sumGasUsed += sb.Txs[txIndex].gasUsed
+			sumGasUsed += txs[txIndex].gasUsed
 		}
-		results.reward[i] = sb.Txs[txIndex].reward
+		rewards[i] = new(big.Int).Set(txs[txIndex].reward)
 	}
-	return results
+	return rewards
+}
+
+// presentBlocks returns the range [first, last) of the indices of the blocks
+// of a range from [oldestBlock] that are not [missing]. The missing blocks at
+// the oldest end of the range, such as pruned ones, and at the newest end,
+// requested into the future after a reorg, are left out of the range, which
+// must be contiguous.
+func presentBlocks(missing []bool, oldestBlock uint64) (int, int, error) {
+	first, last := 0, len(missing)
+	for first < last && missing[first] {
+		first++
+	}
+	for last > first && missing[last-1] {
+		last--
+	}
+	for i := first; i < last; i++ {
+		if missing[i] {
+			return 0, 0, fmt.Errorf("%w: %d", errMissingBlock, oldestBlock+uint64(i))
+		}
+	}
+	if first > 0 && first < last {
+		log.Debug("Skipping missing blocks of fee history", "from", oldestBlock, "to", oldestBlock+uint64(first)-1)
+	}
+	return first, last, nil
+}
+
+// fetchSlimBlock returns the [slimBlock] of the accepted block [number], from
+// the cache if possible, or nil if the block or its receipts are missing, as
+// if pruned.
+func (oracle *Oracle) fetchSlimBlock(ctx context.Context, number uint64) (*slimBlock, error) {
+	if cached, ok := oracle.historyCache.Get(number); ok {
+		return cached, nil
+	}
+	block, err := oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil || block == nil {
+		return nil, err
+	}
+	receipts, err := oracle.backend.GetReceipts(ctx, block.Hash())
+	if err != nil || len(receipts) != len(block.Transactions()) {
+		return nil, err
+	}
+	sb := processBlock(block, receipts)
+	oracle.historyCache.Add(number, sb)
+	return sb, nil
+}
+
+// checkPercentiles returns an error if [percentiles] are not ascending
+// percentiles.
+func checkPercentiles(percentiles []float64) error {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("%w: %f", errInvalidPercentile, p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return fmt.Errorf("%w: #%d:%f > #%d:%f", errInvalidPercentile, i-1, percentiles[i-1], i, p)
+		}
+	}
+	return nil
 }
 
 // resolveBlockRange resolves the specified block range to absolute block numbers while also
-// enforcing backend specific limitations.
+// enforcing backend specific limitations. The range ending with the pending block includes it
+// if the backend has one built on the last accepted block, which is then returned with its
+// receipts, otherwise the range is processed until the latest block. The safe and finalized
+// blocks are the last accepted block, and the earliest block is the oldest retrievable block.
 // Note: an error is only returned if retrieving the head header has failed. If there are no
 // retrievable blocks in the specified range then zero block count is returned with no error.
-func (oracle *Oracle) resolveBlockRange(ctx context.Context, lastBlock rpc.BlockNumber, blocks int) (uint64, int, error) {
+func (oracle *Oracle) resolveBlockRange(ctx context.Context, lastBlock rpc.BlockNumber, blocks int) (*types.Block, types.Receipts, uint64, int, error) {
+	var (
+		pendingBlock    *types.Block
+		pendingReceipts types.Receipts
+	)
 	// Query either pending block or head header and set headBlock
 	if lastBlock == rpc.PendingBlockNumber {
-		// Pending block not supported by backend, process until latest block
+		pendingBlock, pendingReceipts = oracle.backend.PendingBlockAndReceipts()
+		if pendingBlock != nil && (pendingBlock.ParentHash() != oracle.backend.LastAcceptedBlock().Hash() || len(pendingReceipts) != len(pendingBlock.Transactions())) {
+			// The pending block does not extend the accepted blocks
+			pendingBlock, pendingReceipts = nil, nil
+		}
+		// Process until latest block, followed by the pending block if
+		// supported by backend
 		lastBlock = rpc.LatestBlockNumber
 		blocks--
 	}
 	if blocks == 0 {
-		return 0, 0, nil
+		if pendingBlock != nil {
+			return pendingBlock, pendingReceipts, pendingBlock.NumberU64(), 1, nil
+		}
+		return nil, nil, 0, 0, nil
 	}
 
 	lastAcceptedBlock := rpc.BlockNumber(oracle.backend.LastAcceptedBlock().NumberU64())
 	maxQueryDepth := rpc.BlockNumber(oracle.maxBlockHistory) - 1
 	if lastBlock.IsAccepted() {
+		// Accepted blocks are final, so the safe and finalized blocks are the
+		// last accepted block
 		lastBlock = lastAcceptedBlock
+	} else if lastBlock == rpc.EarliestBlockNumber {
+		// The earliest block is the oldest block within [oracle.maxBlockHistory]
+		// of the last accepted block, which is genesis unless it is past the limit
+		if lastAcceptedBlock > maxQueryDepth {
+			lastBlock = lastAcceptedBlock - maxQueryDepth
+		}
 	} else if lastAcceptedBlock > maxQueryDepth && lastAcceptedBlock-maxQueryDepth > lastBlock {
 		// If the requested last block reaches further back than [oracle.maxBlockHistory] past the last accepted block return an error
 		// Note: this allows some blocks past this point to be fetched since it will start fetching [blocks] from this point.
-		return 0, 0, fmt.Errorf("%w: requested %d, head %d", errBeyondHistoricalLimit, lastBlock, lastAcceptedBlock)
+		return nil, nil, 0, 0, fmt.Errorf("%w: requested %d, head %d", errBeyondHistoricalLimit, lastBlock, lastAcceptedBlock)
 	} else if lastBlock > lastAcceptedBlock {
 		// If the requested block is above the accepted block return an error
-		return 0, 0, fmt.Errorf("%w: requested %d, head %d", errRequestBeyondHead, lastBlock, lastAcceptedBlock)
+		return nil, nil, 0, 0, fmt.Errorf("%w: requested %d, head %d", errRequestBeyondHead, lastBlock, lastAcceptedBlock)
 	}
 	// Ensure not trying to retrieve before genesis
 	if rpc.BlockNumber(blocks) > lastBlock+1 {
@@ -187,23 +347,61 @@ func (oracle *Oracle) resolveBlockRange(ctx context.Context, lastBlock rpc.Block
 	// It is not possible that [blocks] could be <= 0 after
 	// truncation as the [lastBlock] requested will at least by fetchable.
 	// Otherwise, we would've returned an error earlier.
-	return uint64(lastBlock), blocks, nil
+	if pendingBlock != nil {
+		return pendingBlock, pendingReceipts, uint64(lastBlock) + 1, blocks + 1, nil
+	}
+	return nil, nil, uint64(lastBlock), blocks, nil
+}
+
+// resolveAnchor returns the number of the last block [lastBlock] of a range,
+// which must be a canonical accepted block if it is given by hash.
+func (oracle *Oracle) resolveAnchor(ctx context.Context, lastBlock rpc.BlockNumberOrHash) (rpc.BlockNumber, error) {
+	if number, ok := lastBlock.Number(); ok {
+		return number, nil
+	}
+	hash, ok := lastBlock.Hash()
+	if !ok {
+		return 0, errMissingAnchor
+	}
+	header, err := oracle.backend.HeaderByHash(ctx, hash)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, &anchorError{hash: hash, err: errAnchorUnknown}
+	}
+	number := header.Number.Uint64()
+	if number > oracle.backend.LastAcceptedBlock().NumberU64() {
+		return 0, &anchorError{hash: hash, err: errAnchorNotAccepted}
+	}
+	canonical, err := oracle.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if err != nil {
+		return 0, err
+	}
+	if canonical == nil || canonical.Hash() != hash {
+		return 0, &anchorError{hash: hash, err: errAnchorNotAccepted}
+	}
+	return rpc.BlockNumber(number), nil
 }
 
 // FeeHistory returns data relevant for fee estimation based on the specified range of blocks.
 // The range can be specified either with absolute block numbers or ending with the latest
-// or pending block. Backends may or may not support gathering data from the pending block
-// or blocks older than a certain age (specified in maxHistory). The first block of the
+// or pending block, or with the hash of an accepted block. Backends may or may not support gathering data from the pending block
+// or blocks older than a certain age (specified in maxHistory). The pending block is the newest
+// entry of the range if the backend has one, otherwise the range ends with the latest block. The first block of the
 // actually processed range is returned to avoid ambiguity when parts of the requested range
-// are not available or when the head has changed during processing this request.
+// are not available or when the head has changed during processing this request. The blocks
+// missing at either end of the range, such as pruned blocks, are left out of the returned range,
+// while a block missing within it fails the request.
 // Three arrays are returned based on the processed blocks:
-// - reward: the requested percentiles of effective priority fees per gas of transactions in each
-//   block, sorted in ascending order and weighted by gas used.
-// - baseFee: base fee per gas in the given block
-// - gasUsedRatio: gasUsed/gasLimit in the given block
+//   - reward: the requested percentiles of effective priority fees per gas of transactions in each
+//     block, sorted in ascending order and weighted by gas used.
+//   - baseFee: base fee per gas in the given block
+//   - gasUsedRatio: gasUsed/gasLimit in the given block
+//
 // Note: baseFee includes the next block after the newest of the returned range, because this
 // value can be derived from the newest block.
-func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error) {
+func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, anchor rpc.BlockNumberOrHash, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error) {
 	if blocks < 1 {
 		return common.Big0, nil, nil, nil, nil // returning with no data and no error means there are no retrievable blocks
 	}
@@ -211,23 +409,31 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		log.Warn("Sanitizing fee history length", "requested", blocks, "truncated", oracle.maxCallBlockHistory)
 		blocks = oracle.maxCallBlockHistory
 	}
-	for i, p := range rewardPercentiles {
-		if p < 0 || p > 100 {
-			return common.Big0, nil, nil, nil, fmt.Errorf("%w: %f", errInvalidPercentile, p)
-		}
-		if i > 0 && p < rewardPercentiles[i-1] {
-			return common.Big0, nil, nil, nil, fmt.Errorf("%w: #%d:%f > #%d:%f", errInvalidPercentile, i-1, rewardPercentiles[i-1], i, p)
-		}
+	if err := checkPercentiles(rewardPercentiles); err != nil {
+		return common.Big0, nil, nil, nil, err
+	}
+	unresolvedLastBlock, err := oracle.resolveAnchor(ctx, anchor)
+	if err != nil {
+		return common.Big0, nil, nil, nil, err
 	}
-	lastBlock, blocks, err := oracle.resolveBlockRange(ctx, unresolvedLastBlock, blocks)
+	pendingBlock, pendingReceipts, lastBlock, blocks, err := oracle.resolveBlockRange(ctx, unresolvedLastBlock, blocks)
 	if err != nil || blocks == 0 {
 		return common.Big0, nil, nil, nil, err
 	}
 	oldestBlock := lastBlock + 1 - uint64(blocks)
 
+	// The fetchers are stopped once the results are returned, including on
+	// the first error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var (
 		next    = oldestBlock
 		results = make(chan *blockFees, blocks)
+		// The results are only cached if rewards are requested, the
+		// other fields are read from the cached blocks as cheaply
+		cachePercentiles = len(rewardPercentiles) != 0
+		fingerprint      = percentilesFingerprint(rewardPercentiles)
 	)
 	for i := 0; i < maxBlockFetchers && i < blocks; i++ {
 		go func() {
@@ -239,26 +445,42 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 				}
 
 				fees := &blockFees{blockNumber: blockNumber}
-				var sb *slimBlock
-				if sbRaw, ok := oracle.historyCache.Get(blockNumber); ok {
-					sb = sbRaw.(*slimBlock)
-				} else {
-					block, err := oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNumber))
-					if block == nil || err != nil {
-						fees.err = err
-						results <- fees
-						return
-					}
-					receipts, err := oracle.backend.GetReceipts(ctx, block.Hash())
-					if err != nil {
-						fees.err = err
+				// Stop fetching once the request is cancelled
+				if err := ctx.Err(); err != nil {
+					fees.err = err
+					results <- fees
+					return
+				}
+				if pendingBlock != nil && blockNumber == pendingBlock.NumberU64() {
+					// The pending block is not cached, as it may never be
+					// accepted
+					fees.results = processBlock(pendingBlock, pendingReceipts).processPercentiles(rewardPercentiles)
+					results <- fees
+					continue
+				}
+				key := percentilesKey{blockNumber: blockNumber, percentiles: fingerprint}
+				if cachePercentiles {
+					if cached, ok := oracle.historyCache.GetPercentiles(key); ok {
+						fees.results = cached.copy()
 						results <- fees
-						return
+						continue
 					}
-					sb = processBlock(block, receipts)
-					oracle.historyCache.Add(blockNumber, sb)
+				}
+				sb, err := oracle.fetchSlimBlock(ctx, blockNumber)
+				if err != nil {
+					fees.err = err
+					results <- fees
+					return
+				}
+				if sb == nil {
+					// The block is missing, reported by its empty results
+					results <- fees
+					continue
 				}
 				fees.results = sb.processPercentiles(rewardPercentiles)
+				if cachePercentiles {
+					oracle.historyCache.AddPercentiles(key, fees.results.copy())
+				}
 				results <- fees
 			}
 		}()
@@ -267,10 +489,17 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		reward       = make([][]*big.Int, blocks)
 		baseFee      = make([]*big.Int, blocks)
 		gasUsedRatio = make([]float64, blocks)
-		firstMissing = blocks
+		missing      = make([]bool, blocks)
 	)
 	for ; blocks > 0; blocks-- {
-		fees := <-results
+		// The fetchers in flight complete in the background if the request is
+		// cancelled, as [results] holds a result for each block
+		var fees *blockFees
+		select {
+		case fees = <-results:
+		case <-ctx.Done():
+			return common.Big0, nil, nil, nil, ctx.Err()
+		}
 		if fees.err != nil {
 			return common.Big0, nil, nil, nil, fees.err
 		}
@@ -278,20 +507,154 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 		if fees.results.baseFee != nil {
 			reward[i], baseFee[i], gasUsedRatio[i] = fees.results.reward, fees.results.baseFee, fees.results.gasUsedRatio
 		} else {
-			// getting no block and no error means we are requesting into the future (might happen because of a reorg)
-			if i < firstMissing {
-				firstMissing = i
-			}
+			missing[i] = true
 		}
 	}
-	if firstMissing == 0 {
-		return common.Big0, nil, nil, nil, nil
+	first, last, err := presentBlocks(missing, oldestBlock)
+	if err != nil || first == last {
+		return common.Big0, nil, nil, nil, err
 	}
+	oldestBlock += uint64(first)
 	if len(rewardPercentiles) != 0 {
-		reward = reward[:firstMissing]
+		reward = reward[first:last]
 	} else {
 		reward = nil
 	}
-	baseFee, gasUsedRatio = baseFee[:firstMissing], gasUsedRatio[:firstMissing]
+	baseFee, gasUsedRatio = baseFee[first:last], gasUsedRatio[first:last]
 	return new(big.Int).SetUint64(oldestBlock), reward, baseFee, gasUsedRatio, nil
 }
+
+// FeeAggregate is the distribution of the tips of the transactions of a range
+// of blocks, merged across the blocks.
+type FeeAggregate struct {
+	OldestBlock *big.Int
+	Blocks      int
+	// Reward is the effective tip of the transactions of the range at each
+	// requested percentile, weighted by gas used, zero if they have no
+	// transactions.
+	Reward []*big.Int
+	// NextBaseFee is the base fee of a block built on the newest block of the
+	// range at the current time, nil if base fees have not been enabled.
+	NextBaseFee *big.Int
+}
+
+// FeeHistoryAggregate returns the distribution of the tips of the transactions
+// of the range of [blocks] ending with [lastBlock], resolved as by
+// [FeeHistory], at the ascending [percentiles]. The transactions of the whole
+// range are merged into a single distribution weighted by gas used, each with
+// its effective tip at the base fee of its block.
+func (oracle *Oracle) FeeHistoryAggregate(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, percentiles []float64) (*FeeAggregate, error) {
+	if err := checkPercentiles(percentiles); err != nil {
+		return nil, err
+	}
+	aggregate := &FeeAggregate{OldestBlock: new(big.Int), Reward: zeroRewards(len(percentiles))}
+	if blocks < 1 {
+		return aggregate, nil
+	}
+	if blocks > oracle.maxCallBlockHistory {
+		log.Warn("Sanitizing fee history length", "requested", blocks, "truncated", oracle.maxCallBlockHistory)
+		blocks = oracle.maxCallBlockHistory
+	}
+	pendingBlock, pendingReceipts, newestBlock, blocks, err := oracle.resolveBlockRange(ctx, lastBlock, blocks)
+	if err != nil || blocks == 0 {
+		return aggregate, err
+	}
+	oldestBlock := newestBlock + 1 - uint64(blocks)
+
+	// The fetchers are stopped on the first error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		next     = oldestBlock
+		sbs      = make([]*slimBlock, blocks)
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		fetchErr error
+		fail     = func(err error) {
+			errOnce.Do(func() {
+				fetchErr = err
+				cancel()
+			})
+		}
+	)
+	for i := 0; i < maxBlockFetchers && i < blocks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				blockNumber := atomic.AddUint64(&next, 1) - 1
+				if blockNumber > newestBlock {
+					return
+				}
+				if pendingBlock != nil && blockNumber == pendingBlock.NumberU64() {
+					sbs[blockNumber-oldestBlock] = processBlock(pendingBlock, pendingReceipts)
+					continue
+				}
+				// Stop fetching once the request is cancelled
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+				sb, err := oracle.fetchSlimBlock(ctx, blockNumber)
+				if err != nil {
+					fail(err)
+					return
+				}
+				sbs[blockNumber-oldestBlock] = sb
+			}
+		}()
+	}
+	wg.Wait()
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	missing := make([]bool, blocks)
+	for i, sb := range sbs {
+		missing[i] = sb == nil
+	}
+	first, last, err := presentBlocks(missing, oldestBlock)
+	if err != nil || first == last {
+		return aggregate, err
+	}
+	aggregate.OldestBlock.SetUint64(oldestBlock + uint64(first))
+	aggregate.Blocks = last - first
+
+	// The rewards are weighted by the gas used by the transactions rather
+	// than by the blocks, which also counts the gas of the atomic txs
+	var (
+		txs     sortGasAndReward
+		gasUsed uint64
+	)
+	for _, sb := range sbs[first:last] {
+		txs = append(txs, sb.Txs...)
+		for _, tx := range sb.Txs {
+			gasUsed += tx.gasUsed
+		}
+	}
+	if len(txs) != 0 {
+		sort.Sort(txs)
+		aggregate.Reward = gasWeightedRewards(txs, gasUsed, percentiles)
+	}
+
+	// The newest block of the range is the pending block if it is included
+	var (
+		newestNumber = oldestBlock + uint64(last-1)
+		newest       *types.Header
+	)
+	if pendingBlock != nil && pendingBlock.NumberU64() == newestNumber {
+		newest = pendingBlock.Header()
+	} else if newest, err = oracle.backend.HeaderByNumber(ctx, rpc.BlockNumber(newestNumber)); err != nil {
+		return nil, err
+	} else if newest == nil {
+		return nil, fmt.Errorf("%w: %d", errMissingBlock, newestNumber)
+	}
+	if newest.BaseFee != nil {
+		_, aggregate.NextBaseFee, err = dummy.EstimateNextBaseFee(oracle.backend.ChainConfig(), newest, oracle.clock.Unix())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggregate, nil
+}
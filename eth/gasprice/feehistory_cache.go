@@ -0,0 +1,175 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package gasprice
+
+import (
+	"math"
+	"math/big"
+	"sync"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// feeHistoryCacheSizeMetric is the gauge of the total size in bytes of the
+// blocks and rewards cached to serve eth_feeHistory.
+const feeHistoryCacheSizeMetric = "gasprice/feehistory/cache/size"
+
+// Size returns the approximate memory used by [sb] in bytes, its header fields
+// plus its per-tx entries.
+func (sb *slimBlock) Size() uint64 {
+	size := uint64(unsafe.Sizeof(*sb)) + bigIntSize(sb.BaseFee)
+	size += uint64(len(sb.Txs)) * uint64(unsafe.Sizeof(txGasAndReward{}))
+	for _, tx := range sb.Txs {
+		size += bigIntSize(tx.reward)
+	}
+	return size
+}
+
+// Size returns the approximate memory used by [f] in bytes, its fields plus
+// its rewards.
+func (f processedFees) Size() uint64 {
+	size := uint64(unsafe.Sizeof(f)) + bigIntSize(f.baseFee)
+	size += uint64(len(f.reward)) * uint64(unsafe.Sizeof((*big.Int)(nil)))
+	for _, reward := range f.reward {
+		size += bigIntSize(reward)
+	}
+	return size
+}
+
+// bigIntSize returns the approximate memory used by [x] in bytes.
+func bigIntSize(x *big.Int) uint64 {
+	if x == nil {
+		return 0
+	}
+	return uint64(unsafe.Sizeof(*x)) + uint64(len(x.Bits()))*uint64(unsafe.Sizeof(big.Word(0)))
+}
+
+// cacheEntry is a value of the [feeHistoryCache], accounted by its size.
+type cacheEntry interface {
+	Size() uint64
+}
+
+// feeHistoryCache is an LRU cache of the [slimBlock]s by block number and of
+// their [processedFees] by [percentilesKey], evicting the least recently used
+// entries of either once their total size exceeds a limit in bytes.
+type feeHistoryCache struct {
+	lock  sync.Mutex
+	lru   *simplelru.LRU
+	size  uint64 // total size of the cached entries, reported by [gauge]
+	limit uint64
+	gauge metrics.Gauge
+}
+
+// newFeeHistoryCache returns a cache of at most [limit] bytes of blocks and
+// rewards, reporting its size to [gauge].
+func newFeeHistoryCache(limit uint64, gauge metrics.Gauge) *feeHistoryCache {
+	c := &feeHistoryCache{limit: limit, gauge: gauge}
+	// The entries are only evicted by size
+	c.lru, _ = simplelru.NewLRU(math.MaxInt32, func(_, value interface{}) {
+		c.size -= value.(cacheEntry).Size()
+	})
+	return c
+}
+
+// Get returns the cached block [number].
+func (c *feeHistoryCache) Get(number uint64) (*slimBlock, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	sb, ok := c.lru.Get(number)
+	if !ok {
+		return nil, false
+	}
+	return sb.(*slimBlock), true
+}
+
+// GetPercentiles returns the rewards cached for [key]. The result must not be
+// mutated.
+func (c *feeHistoryCache) GetPercentiles(key percentilesKey) (processedFees, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	fees, ok := c.lru.Get(key)
+	if !ok {
+		return processedFees{}, false
+	}
+	return fees.(processedFees), true
+}
+
+// Contains returns whether block [number] is cached, without updating its
+// recency.
+func (c *feeHistoryCache) Contains(number uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Contains(number)
+}
+
+// ContainsPercentiles returns whether the rewards of [key] are cached,
+// without updating their recency.
+func (c *feeHistoryCache) ContainsPercentiles(key percentilesKey) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Contains(key)
+}
+
+// Add caches [sb] as block [number], evicting the least recently used entries
+// until the cache fits in its limit. A block larger than the limit is not
+// cached.
+func (c *feeHistoryCache) Add(number uint64, sb *slimBlock) {
+	c.add(number, sb)
+}
+
+// AddPercentiles caches [fees] as the rewards of [key], sharing the limit of
+// the blocks. [fees] must not be mutated once cached.
+func (c *feeHistoryCache) AddPercentiles(key percentilesKey, fees processedFees) {
+	c.add(key, fees)
+}
+
+// add caches [entry] as [key], evicting the least recently used entries until
+// the cache fits in its limit.
+func (c *feeHistoryCache) add(key interface{}, entry cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.updateGauge()
+
+	size := entry.Size()
+	if size > c.limit {
+		return
+	}
+	// Replacing an entry does not call the eviction callback
+	if old, ok := c.lru.Peek(key); ok {
+		c.size -= old.(cacheEntry).Size()
+	}
+	c.lru.Add(key, entry)
+	c.size += size
+	for c.size > c.limit {
+		c.lru.RemoveOldest()
+	}
+}
+
+// Purge removes all the blocks and rewards cached.
+func (c *feeHistoryCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.updateGauge()
+
+	c.lru.Purge()
+}
+
+// Size returns the total size of the blocks and rewards cached in bytes.
+func (c *feeHistoryCache) Size() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.size
+}
+
+// updateGauge reports the size of the cache. Assumes [lock] is held.
+func (c *feeHistoryCache) updateGauge() {
+	c.gauge.Update(int64(c.size))
+}
@@ -0,0 +1,124 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package gasprice
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/zsmartex/coreth/params"
+)
+
+// testSlimBlock returns a block of [txs] txs paying tips of at most 100 gwei.
+func testSlimBlock(txs int) *slimBlock {
+	sb := &slimBlock{GasUsed: uint64(txs) * params.TxGas, GasLimit: 8_000_000, BaseFee: big.NewInt(25 * params.GWei)}
+	for i := 0; i < txs; i++ {
+		sb.Txs = append(sb.Txs, txGasAndReward{gasUsed: params.TxGas, reward: big.NewInt(int64(i%100) * params.GWei)})
+	}
+	return sb
+}
+
+func TestSlimBlockSize(t *testing.T) {
+	empty, typical, full := testSlimBlock(0).Size(), testSlimBlock(40).Size(), testSlimBlock(700).Size()
+	if empty == 0 || typical <= empty || full <= typical {
+		t.Fatalf("Expected the size to grow with the txs, found %d, %d and %d bytes", empty, typical, full)
+	}
+	// The default holds the blocks of the default history of typical blocks
+	if blocks := DefaultFeeHistoryCacheSize / typical; blocks < uint64(DefaultMaxBlockHistory) {
+		t.Fatalf("Expected the default cache to hold at least %d blocks of 40 txs, found %d", DefaultMaxBlockHistory, blocks)
+	}
+}
+
+func TestFeeHistoryCacheEvictsBySize(t *testing.T) {
+	blockSize := testSlimBlock(10).Size()
+	gauge := new(metrics.StandardGauge)
+	cache := newFeeHistoryCache(3*blockSize, gauge)
+	checkSize := func(cached ...uint64) {
+		t.Helper()
+		var size uint64
+		for _, number := range cached {
+			sb, ok := cache.Get(number)
+			if !ok {
+				t.Fatalf("Expected block %d to be cached", number)
+			}
+			size += sb.Size()
+		}
+		if cache.Size() != size || gauge.Value() != int64(size) {
+			t.Fatalf("Expected a cache size of %d bytes, found %d and a gauge of %d", size, cache.Size(), gauge.Value())
+		}
+	}
+
+	for number := uint64(1); number <= 3; number++ {
+		cache.Add(number, testSlimBlock(10))
+	}
+	checkSize(1, 2, 3)
+
+	// The least recently used block is evicted first
+	cache.Get(1)
+	cache.Add(4, testSlimBlock(10))
+	if cache.Contains(2) {
+		t.Fatal("Expected the least recently used block to be evicted")
+	}
+	checkSize(3, 1, 4)
+
+	// A large block evicts as many blocks as needed to fit
+	cache.Add(5, testSlimBlock(20))
+	if cache.Contains(3) || cache.Contains(1) {
+		t.Fatal("Expected two blocks to be evicted for the large block")
+	}
+	checkSize(4, 5)
+
+	// Replacing a block replaces its size
+	cache.Add(4, testSlimBlock(1))
+	checkSize(4, 5)
+
+	// A block larger than the cache is not cached
+	cache.Add(6, testSlimBlock(40))
+	if cache.Contains(6) {
+		t.Fatal("Expected the block larger than the cache not to be cached")
+	}
+	checkSize(4, 5)
+
+	cache.Purge()
+	checkSize()
+}
+
+func TestFeeHistoryCacheSharesLimitWithRewards(t *testing.T) {
+	blockSize := testSlimBlock(10).Size()
+	gauge := new(metrics.StandardGauge)
+	cache := newFeeHistoryCache(3*blockSize, gauge)
+	cache.Add(1, testSlimBlock(10))
+	cache.Add(2, testSlimBlock(10))
+
+	fees := testSlimBlock(10).processPercentiles([]float64{10, 50, 90})
+	if fees.Size() <= bigIntSize(fees.baseFee) {
+		t.Fatalf("Expected the size of the fees to include their rewards, found %d bytes", fees.Size())
+	}
+	key := percentilesKey{blockNumber: 2, percentiles: "10,50,90"}
+	cache.AddPercentiles(key, fees)
+	if !cache.ContainsPercentiles(key) {
+		t.Fatal("Expected the rewards to be cached")
+	}
+	if size := 2*blockSize + fees.Size(); cache.Size() != size || gauge.Value() != int64(size) {
+		t.Fatalf("Expected a cache size of %d bytes, found %d and a gauge of %d", size, cache.Size(), gauge.Value())
+	}
+
+	// The rewards are evicted with the blocks, least recently used first
+	cache.Add(3, testSlimBlock(10))
+	if cache.Contains(1) {
+		t.Fatal("Expected the least recently used block to be evicted for the rewards")
+	}
+	cache.Add(4, testSlimBlock(10))
+	if cache.Contains(2) || !cache.ContainsPercentiles(key) {
+		t.Fatal("Expected the block to be evicted before the more recent rewards")
+	}
+	cache.Add(5, testSlimBlock(10))
+	if cache.ContainsPercentiles(key) {
+		t.Fatal("Expected the least recently used rewards to be evicted")
+	}
+	if size := 3 * blockSize; cache.Size() != size {
+		t.Fatalf("Expected a cache size of %d bytes, found %d", size, cache.Size())
+	}
+}
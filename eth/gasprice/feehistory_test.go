@@ -28,9 +28,17 @@ package gasprice
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/zsmartex/coreth/core"
 	"github.com/zsmartex/coreth/core/types"
@@ -64,8 +72,9 @@ func TestFeeHistory(t *testing.T) {
 		{false, 0, 2, 100, 32, []float64{0, 10}, 31, 2, nil},
 		{false, 0, 1000, 1, rpc.PendingBlockNumber, nil, 0, 0, nil},
 		{false, 0, 1000, 2, rpc.PendingBlockNumber, nil, 32, 1, nil},
-		{true, 0, 1000, 2, rpc.PendingBlockNumber, nil, 32, 1, nil},
-		{true, 0, 1000, 2, rpc.PendingBlockNumber, []float64{0, 10}, 32, 1, nil},
+		{true, 0, 1000, 1, rpc.PendingBlockNumber, nil, 33, 1, nil},
+		{true, 0, 1000, 2, rpc.PendingBlockNumber, nil, 32, 2, nil},
+		{true, 0, 1000, 2, rpc.PendingBlockNumber, []float64{0, 10}, 32, 2, nil},
 
 		// Modified tests
 		{false, 0, 2, 100, rpc.LatestBlockNumber, nil, 31, 2, nil},    // apply block lookback limits even if only headers required
@@ -106,9 +115,10 @@ func TestFeeHistory(t *testing.T) {
 			}
 			b.AddTx(tx)
 		})
+		backend.pending = c.pending
 		oracle := NewOracle(backend, config)
 
-		first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), c.count, c.last, c.percent)
+		first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), c.count, rpc.BlockNumberOrHashWithNumber(c.last), c.percent)
 
 		expReward := c.expCount
 		if len(c.percent) == 0 {
@@ -133,3 +143,670 @@ func TestFeeHistory(t *testing.T) {
 		}
 	}
 }
+
+// TestFeeHistoryBlockTags checks that the safe and finalized blocks resolve to
+// the last accepted block, and the earliest block to the oldest block within
+// the historical limit.
+func TestFeeHistoryBlockTags(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {})
+	for _, test := range []struct {
+		tag          string
+		maxBlock     int
+		count        int
+		lastAccepted uint64 // the current block if 0
+		expFirst     uint64
+		expCount     int
+	}{
+		{tag: "safe", maxBlock: 1000, count: 10, expFirst: 23, expCount: 10},
+		{tag: "finalized", maxBlock: 1000, count: 10, expFirst: 23, expCount: 10},
+		{tag: "accepted", maxBlock: 1000, count: 10, expFirst: 23, expCount: 10},
+		{tag: "safe", maxBlock: 2, count: 10, expFirst: 31, expCount: 2},
+		{tag: "finalized", maxBlock: 1000, count: 100, expFirst: 0, expCount: 33},
+		{tag: "safe", maxBlock: 1000, count: 10, lastAccepted: 30, expFirst: 21, expCount: 10},
+		{tag: "finalized", maxBlock: 5, count: 10, lastAccepted: 30, expFirst: 26, expCount: 5},
+		{tag: "earliest", maxBlock: 1000, count: 10, expFirst: 0, expCount: 1},
+		{tag: "earliest", maxBlock: 33, count: 10, expFirst: 0, expCount: 1},
+		{tag: "earliest", maxBlock: 10, count: 10, expFirst: 23, expCount: 1},
+		{tag: "earliest", maxBlock: 1, count: 10, expFirst: 32, expCount: 1},
+		{tag: "earliest", maxBlock: 10, count: 10, lastAccepted: 30, expFirst: 21, expCount: 1},
+	} {
+		t.Run(fmt.Sprintf("%s/maxBlock=%d/lastAccepted=%d", test.tag, test.maxBlock, test.lastAccepted), func(t *testing.T) {
+			backend.lastAccepted = nil
+			if test.lastAccepted != 0 {
+				backend.lastAccepted = backend.chain.GetBlockByNumber(test.lastAccepted)
+			}
+			var anchor rpc.BlockNumberOrHash
+			if err := json.Unmarshal([]byte(strconv.Quote(test.tag)), &anchor); err != nil {
+				t.Fatal(err)
+			}
+			oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: test.maxBlock})
+			first, _, baseFee, _, err := oracle.FeeHistory(context.Background(), test.count, anchor, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Uint64() != test.expFirst || len(baseFee) != test.expCount {
+				t.Fatalf("Expected the fees of %d blocks from %d, found %d from %d", test.expCount, test.expFirst, len(baseFee), first)
+			}
+		})
+	}
+}
+
+func TestFeeHistoryAnchoredAtHash(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {
+		signer := types.LatestSigner(params.TestChainConfig)
+		tip := big.NewInt(int64(i+1) * params.GWei)
+		tx, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+			ChainID:   params.TestChainConfig.ChainID,
+			Nonce:     b.TxNonce(addr),
+			To:        &common.Address{},
+			Gas:       params.TxGas,
+			GasFeeCap: new(big.Int).Add(b.BaseFee(), tip),
+			GasTipCap: tip,
+		}), signer, key)
+		if err != nil {
+			t.Fatalf("failed to create tx: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	// Blocks 31 and 32 are processing
+	backend.lastAccepted = backend.chain.GetBlockByNumber(30)
+	oracle := NewOracle(backend, Config{MaxBlockHistory: 1000})
+	percentiles := []float64{0, 50}
+
+	// Anchoring at the hash of an accepted block is the same as at its number
+	type feeHistory struct {
+		first        *big.Int
+		reward       [][]*big.Int
+		baseFee      []*big.Int
+		gasUsedRatio []float64
+	}
+	var byNumber, byHash feeHistory
+	var err error
+	byNumber.first, byNumber.reward, byNumber.baseFee, byNumber.gasUsedRatio, err = oracle.FeeHistory(context.Background(), 10, rpc.BlockNumberOrHashWithNumber(25), percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor := rpc.BlockNumberOrHashWithHash(backend.chain.GetBlockByNumber(25).Hash(), false)
+	byHash.first, byHash.reward, byHash.baseFee, byHash.gasUsedRatio, err = oracle.FeeHistory(context.Background(), 10, anchor, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byHash.first.Uint64() != 16 || len(byHash.baseFee) != 10 {
+		t.Fatalf("Expected the 10 blocks up to 25, found %d from %d", len(byHash.baseFee), byHash.first)
+	}
+	if !reflect.DeepEqual(byNumber, byHash) {
+		t.Fatalf("Expected the fee history anchored at the hash of block 25 to be %+v, found %+v", byNumber, byHash)
+	}
+
+	// Anchoring at a processing or unknown hash fails with the anchor error code
+	for _, test := range []struct {
+		hash   common.Hash
+		expErr error
+	}{
+		{backend.chain.GetBlockByNumber(32).Hash(), errAnchorNotAccepted},
+		{common.Hash{1}, errAnchorUnknown},
+	} {
+		_, _, _, _, err := oracle.FeeHistory(context.Background(), 10, rpc.BlockNumberOrHashWithHash(test.hash, false), percentiles)
+		if !errors.Is(err, test.expErr) {
+			t.Fatalf("Anchor %s: error mismatch, want %v, got %v", test.hash, test.expErr, err)
+		}
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != anchorErrorCode {
+			t.Fatalf("Anchor %s: expected error code %d, got %v", test.hash, anchorErrorCode, err)
+		}
+	}
+}
+
+// cancellingBackend cancels the request once [after] blocks are read, and
+// delays each read to let the request observe the cancellation.
+type cancellingBackend struct {
+	*testBackend
+	cancel context.CancelFunc
+	after  int32
+	reads  int32
+}
+
+func (b *cancellingBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if atomic.AddInt32(&b.reads, 1) == b.after {
+		b.cancel()
+	}
+	time.Sleep(time.Millisecond)
+	return b.testBackend.BlockByNumber(ctx, number)
+}
+
+func TestFeeHistoryPendingBlock(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {
+		signer := types.LatestSigner(params.TestChainConfig)
+		tip := big.NewInt(int64(i+1) * params.GWei)
+		tx, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+			ChainID:   params.TestChainConfig.ChainID,
+			Nonce:     b.TxNonce(addr),
+			To:        &common.Address{},
+			Gas:       params.TxGas,
+			GasFeeCap: new(big.Int).Add(b.BaseFee(), tip),
+			GasTipCap: tip,
+		}), signer, key)
+		if err != nil {
+			t.Fatalf("failed to create tx: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	backend.pending = true
+	oracle := NewOracle(backend, Config{MaxBlockHistory: 1000})
+	percentiles := []float64{0, 50}
+	pending := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+
+	// The pending block is the newest entry, with the rewards of its txs
+	first, reward, baseFee, _, err := oracle.FeeHistory(context.Background(), 3, pending, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Uint64() != 31 || len(reward) != 3 || len(baseFee) != 3 {
+		t.Fatalf("Expected the fees of blocks 31 to 33, found %d from %d", len(reward), first)
+	}
+	if tip := big.NewInt(33 * params.GWei); reward[2][0].Cmp(tip) != 0 || reward[2][1].Cmp(tip) != 0 {
+		t.Fatalf("Expected the rewards of the pending block to be %d, found %v", tip, reward[2])
+	}
+	if baseFee[2].Cmp(backend.pendingBlock.BaseFee()) != 0 {
+		t.Fatalf("Expected the base fee of the pending block %d, found %d", backend.pendingBlock.BaseFee(), baseFee[2])
+	}
+	// The pending block may never be accepted, it is not cached
+	if oracle.historyCache.Contains(uint64(33)) || oracle.historyCache.ContainsPercentiles(percentilesKey{blockNumber: 33, percentiles: percentilesFingerprint(percentiles)}) {
+		t.Fatal("Expected the pending block not to be cached")
+	}
+	// The pending block alone
+	first, reward, _, _, err = oracle.FeeHistory(context.Background(), 1, pending, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Uint64() != 33 || len(reward) != 1 {
+		t.Fatalf("Expected the fees of block 33, found %d from %d", len(reward), first)
+	}
+
+	// A pending block built on a block not accepted falls back to the latest
+	// block, as without a pending block
+	for name, lastAccepted := range map[string]*types.Block{"not accepted parent": backend.chain.GetBlockByNumber(30), "no pending block": nil} {
+		t.Run(name, func(t *testing.T) {
+			backend.lastAccepted = lastAccepted
+			backend.pending = lastAccepted != nil
+			expFirst := uint64(31)
+			if lastAccepted != nil {
+				expFirst = lastAccepted.NumberU64() - 1
+			}
+			first, reward, _, _, err := oracle.FeeHistory(context.Background(), 3, pending, percentiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Uint64() != expFirst || len(reward) != 2 {
+				t.Fatalf("Expected the fees of 2 blocks from %d, found %d from %d", expFirst, len(reward), first)
+			}
+		})
+	}
+}
+
+func TestFeeHistoryCancelled(t *testing.T) {
+	backend := &cancellingBackend{
+		testBackend: newTestBackendFakerEngine(t, params.TestChainConfig, 200, common.Big0, func(i int, b *core.BlockGen) {}),
+		after:       10,
+	}
+	oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend.cancel = cancel
+	_, _, _, _, err := oracle.FeeHistory(ctx, 200, rpc.BlockNumberOrHashWithNumber(200), []float64{50})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the fee history to be cancelled, found %v", err)
+	}
+	// The fetchers stop once the blocks they are reading are fetched
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+		t.Fatalf("Expected the fetchers to stop, found %d goroutines left", leaked)
+	}
+	if reads := atomic.LoadInt32(&backend.reads); reads > backend.after+maxBlockFetchers {
+		t.Fatalf("Expected at most %d blocks to be read, found %d", backend.after+maxBlockFetchers, reads)
+	}
+}
+
+// blockingBackend fails the read of [failing] once [fail] is closed, and
+// blocks the reads of the other blocks until their context is done, counting
+// the reads in flight.
+type blockingBackend struct {
+	*testBackend
+	failing  uint64
+	fail     chan struct{}
+	inFlight int32
+	started  chan struct{}
+}
+
+var errBlockUnavailable = errors.New("block unavailable")
+
+func (b *blockingBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if uint64(number) == b.failing {
+		<-b.fail
+		return nil, errBlockUnavailable
+	}
+	atomic.AddInt32(&b.inFlight, 1)
+	defer atomic.AddInt32(&b.inFlight, -1)
+	select {
+	case b.started <- struct{}{}:
+	case <-ctx.Done():
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestFeeHistoryStopsFetchers checks that the fetchers blocked on a read are
+// stopped as soon as the request is cancelled, or fails with the error of
+// another read, without leaking goroutines.
+func TestFeeHistoryStopsFetchers(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		cancel  bool
+		failing uint64
+		expErr  error
+	}{
+		{name: "cancelled", cancel: true, expErr: context.Canceled},
+		{name: "failed read", failing: 101, expErr: errBlockUnavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &blockingBackend{
+				testBackend: newTestBackendFakerEngine(t, params.TestChainConfig, 200, common.Big0, func(i int, b *core.BlockGen) {}),
+				failing:     test.failing,
+				fail:        make(chan struct{}),
+				started:     make(chan struct{}),
+			}
+			oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+			goroutines := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				_, _, _, _, err := oracle.FeeHistory(ctx, 100, rpc.BlockNumberOrHashWithNumber(200), []float64{50})
+				errCh <- err
+			}()
+			// Wait for the fetchers other than the failing one to block
+			blocked := maxBlockFetchers
+			if test.failing != 0 {
+				blocked--
+			}
+			for i := 0; i < blocked; i++ {
+				select {
+				case <-backend.started:
+				case err := <-errCh:
+					t.Fatalf("Expected the fee history to block, found %v", err)
+				}
+			}
+			if test.cancel {
+				cancel()
+			} else {
+				close(backend.fail)
+			}
+
+			select {
+			case err := <-errCh:
+				if !errors.Is(err, test.expErr) {
+					t.Fatalf("Expected the fee history to fail with %v, found %v", test.expErr, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected the fee history to return promptly")
+			}
+			deadline := time.Now().Add(time.Second)
+			for (runtime.NumGoroutine() > goroutines || atomic.LoadInt32(&backend.inFlight) > 0) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+				t.Fatalf("Expected the fetchers to stop, found %d goroutines left", leaked)
+			}
+			if inFlight := atomic.LoadInt32(&backend.inFlight); inFlight > 0 {
+				t.Fatalf("Expected no reads in flight, found %d", inFlight)
+			}
+		})
+	}
+}
+
+// missingBackend reports the blocks of [missing] and the receipts of the
+// blocks of [missingReceipts] as not found, as if pruned.
+type missingBackend struct {
+	*testBackend
+	missing         map[uint64]bool
+	missingReceipts map[uint64]bool
+}
+
+func (b *missingBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number >= 0 && b.missing[uint64(number)] {
+		return nil, nil
+	}
+	return b.testBackend.BlockByNumber(ctx, number)
+}
+
+func (b *missingBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	if header := b.chain.GetHeaderByHash(hash); header != nil && b.missingReceipts[header.Number.Uint64()] {
+		return nil, nil
+	}
+	return b.testBackend.GetReceipts(ctx, hash)
+}
+
+// TestFeeHistoryMissingBlocks checks that the blocks missing at the ends of
+// the range are left out of the results, and that a block missing within it
+// fails the request.
+func TestFeeHistoryMissingBlocks(t *testing.T) {
+	chain := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {
+		signer := types.LatestSigner(params.TestChainConfig)
+		tip := big.NewInt(int64(i+1) * params.GWei)
+		tx, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+			ChainID:   params.TestChainConfig.ChainID,
+			Nonce:     b.TxNonce(addr),
+			To:        &common.Address{},
+			Gas:       params.TxGas,
+			GasFeeCap: new(big.Int).Add(b.BaseFee(), tip),
+			GasTipCap: tip,
+		}), signer, key)
+		if err != nil {
+			t.Fatalf("failed to create tx: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	for _, test := range []struct {
+		name            string
+		missing         []uint64
+		missingReceipts []uint64
+		expFirst        uint64
+		expBlocks       int
+		expErr          error
+	}{
+		{name: "oldest blocks", missing: []uint64{23, 24}, expFirst: 25, expBlocks: 8},
+		{name: "oldest receipts", missingReceipts: []uint64{23}, expFirst: 24, expBlocks: 9},
+		{name: "oldest and newest blocks", missing: []uint64{23, 32}, expFirst: 24, expBlocks: 8},
+		{name: "all blocks", missing: []uint64{23, 24, 25, 26, 27, 28, 29, 30, 31, 32}},
+		{name: "block within the range", missing: []uint64{23, 27}, expErr: errMissingBlock},
+		{name: "receipts within the range", missingReceipts: []uint64{30}, expErr: errMissingBlock},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &missingBackend{
+				testBackend:     chain,
+				missing:         make(map[uint64]bool),
+				missingReceipts: make(map[uint64]bool),
+			}
+			for _, number := range test.missing {
+				backend.missing[number] = true
+			}
+			for _, number := range test.missingReceipts {
+				backend.missingReceipts[number] = true
+			}
+			oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+
+			first, reward, baseFee, gasUsedRatio, err := oracle.FeeHistory(context.Background(), 10, rpc.BlockNumberOrHashWithNumber(32), []float64{50})
+			if !errors.Is(err, test.expErr) {
+				t.Fatalf("Expected error %v, found %v", test.expErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if first.Uint64() != test.expFirst {
+				t.Fatalf("Expected the fees from block %d, found from %d", test.expFirst, first)
+			}
+			for name, length := range map[string]int{
+				"reward":       len(reward),
+				"baseFee":      len(baseFee),
+				"gasUsedRatio": len(gasUsedRatio),
+			} {
+				if length != test.expBlocks {
+					t.Fatalf("Expected %d entries of %s, found %d", test.expBlocks, name, length)
+				}
+			}
+			// The results are the fees of the blocks from [first], whose tip
+			// is their number
+			for i := range reward {
+				if tip := big.NewInt(int64(test.expFirst+uint64(i)) * params.GWei); reward[i][0].Cmp(tip) != 0 {
+					t.Fatalf("Expected the reward of block %d to be %d, found %d", test.expFirst+uint64(i), tip, reward[i][0])
+				}
+			}
+		})
+	}
+}
+
+// TestFeeHistoryPercentilesCache checks that the rewards are cached for each
+// list of percentiles, and purged with the blocks.
+func TestFeeHistoryPercentilesCache(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestApricotPhase3Config, 8, common.Big0, genFullBlocks(t, 8, big.NewInt(params.GWei)))
+	oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+
+	var cold [][]*big.Int
+	for _, percentiles := range [][]float64{{10, 50, 90}, {10, 50, 90}, {0, 100}} {
+		_, reward, _, _, err := oracle.FeeHistory(context.Background(), 8, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reward) != 8 || len(reward[0]) != len(percentiles) {
+			t.Fatalf("Expected the %d rewards of 8 blocks, found %v", len(percentiles), reward)
+		}
+		if cold == nil {
+			cold = reward
+		} else if len(percentiles) == 3 && !reflect.DeepEqual(reward, cold) {
+			t.Fatalf("Expected the cached rewards %v, found %v", cold, reward)
+		}
+	}
+	for blockNumber := uint64(1); blockNumber <= 8; blockNumber++ {
+		for _, fingerprint := range []string{"10,50,90", "0,100"} {
+			if !oracle.historyCache.ContainsPercentiles(percentilesKey{blockNumber: blockNumber, percentiles: fingerprint}) {
+				t.Fatalf("Expected the rewards of block %d for %s to be cached", blockNumber, fingerprint)
+			}
+		}
+	}
+	if fingerprint := percentilesFingerprint([]float64{0.5, 10, 99.99}); fingerprint != "0.5,10,99.99" {
+		t.Fatalf("Unexpected fingerprint %s", fingerprint)
+	}
+}
+
+// BenchmarkFeeHistoryWarmCache measures a 1024 block request for the usual
+// percentiles with the cached blocks, with and without the cached rewards.
+func TestFeeHistoryNotAliasingCache(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestApricotPhase3Config, 8, common.Big0, genFullBlocks(t, 8, big.NewInt(params.GWei)))
+	oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+
+	// Both with the rewards, read from the cached results of the percentiles,
+	// and without, read from the cached blocks
+	for _, percentiles := range [][]float64{{10, 50, 90}, nil} {
+		_, reward, baseFee, _, err := oracle.FeeHistory(context.Background(), 8, latest, percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			mutated  []*big.Int
+			expected []*big.Int
+		)
+		for _, rewards := range reward {
+			mutated = append(mutated, rewards...)
+		}
+		mutated = append(mutated, baseFee...)
+		for _, v := range mutated {
+			expected = append(expected, new(big.Int).Set(v))
+			v.SetInt64(-1)
+		}
+
+		_, reward, baseFee, _, err = oracle.FeeHistory(context.Background(), 8, latest, percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again []*big.Int
+		for _, rewards := range reward {
+			again = append(again, rewards...)
+		}
+		again = append(again, baseFee...)
+		if !reflect.DeepEqual(again, expected) {
+			t.Fatalf("Expected the fees %v to be unchanged by the previous caller, found %v", expected, again)
+		}
+	}
+}
+
+func BenchmarkFeeHistoryWarmCache(b *testing.B) {
+	backend := newTestBackendFakerEngine(b, params.TestApricotPhase3Config, 1024, common.Big0, genFullBlocks(b, 1024, big.NewInt(params.GWei)))
+	percentiles := []float64{10, 50, 90}
+	for _, test := range []struct {
+		name             string
+		cachePercentiles bool
+	}{
+		{name: "blocks cached"},
+		{name: "rewards cached", cachePercentiles: true},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1024, MaxBlockHistory: 1024})
+			if _, _, _, _, err := oracle.FeeHistory(context.Background(), 1024, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), percentiles); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !test.cachePercentiles {
+					b.StopTimer()
+					fingerprint := percentilesFingerprint(percentiles)
+					for number := uint64(0); number <= 1024; number++ {
+						oracle.historyCache.lru.Remove(percentilesKey{blockNumber: number, percentiles: fingerprint})
+					}
+					b.StartTimer()
+				}
+				if _, _, _, _, err := oracle.FeeHistory(context.Background(), 1024, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), percentiles); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestFeeHistoryAggregate checks that the tips of the transactions of a range
+// are merged into a single distribution weighted by gas used, each at the base
+// fee of its block.
+func TestFeeHistoryAggregate(t *testing.T) {
+	// Each block has one to three txs of a fixed gas price, so that their tips
+	// vary with the base fee of their block
+	gasPrice := big.NewInt(500 * params.GWei)
+	backend := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {
+		signer := types.LatestSigner(params.TestChainConfig)
+		for j := 0; j <= i%3; j++ {
+			tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+				Nonce:    b.TxNonce(addr),
+				To:       &common.Address{},
+				Gas:      params.TxGas,
+				GasPrice: gasPrice,
+			}), signer, key)
+			if err != nil {
+				t.Fatalf("failed to create tx: %v", err)
+			}
+			b.AddTx(tx)
+		}
+	})
+	oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+	percentiles := []float64{0, 10, 25, 50, 75, 90, 100}
+
+	// The expected rewards of the txs of blocks 23 to 32
+	var (
+		txs      sortGasAndReward
+		gasUsed  uint64
+		baseFees = make(map[string]struct{})
+	)
+	for number := uint64(23); number <= 32; number++ {
+		block := backend.chain.GetBlockByNumber(number)
+		baseFees[block.BaseFee().String()] = struct{}{}
+		for _, receipt := range backend.chain.GetReceiptsByHash(block.Hash()) {
+			txs = append(txs, txGasAndReward{gasUsed: receipt.GasUsed, reward: new(big.Int).Sub(gasPrice, block.BaseFee())})
+			gasUsed += receipt.GasUsed
+		}
+	}
+	if len(baseFees) < 2 {
+		t.Fatal("Expected the range to straddle a base fee change")
+	}
+	sort.Sort(txs)
+	expReward := make([]*big.Int, len(percentiles))
+	for i, p := range percentiles {
+		var sum uint64
+		for _, tx := range txs {
+			sum += tx.gasUsed
+			expReward[i] = tx.reward
+			if float64(sum) >= float64(gasUsed)*p/100 {
+				break
+			}
+		}
+	}
+
+	aggregate, err := oracle.FeeHistoryAggregate(context.Background(), 10, rpc.LatestBlockNumber, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.OldestBlock.Uint64() != 23 || aggregate.Blocks != 10 {
+		t.Fatalf("Expected the fees of 10 blocks from 23, found %d from %d", aggregate.Blocks, aggregate.OldestBlock)
+	}
+	if !reflect.DeepEqual(aggregate.Reward, expReward) {
+		t.Fatalf("Expected rewards %v, found %v", expReward, aggregate.Reward)
+	}
+	nextBaseFee, err := oracle.estimateNextBaseFee(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.NextBaseFee == nil || aggregate.NextBaseFee.Cmp(nextBaseFee) != 0 {
+		t.Fatalf("Expected the next base fee %d, found %d", nextBaseFee, aggregate.NextBaseFee)
+	}
+	// The cached txs are not reordered by the merge
+	for number := uint64(23); number <= 32; number++ {
+		sb, ok := oracle.historyCache.Get(number)
+		if !ok {
+			t.Fatalf("Expected block %d to be cached", number)
+		}
+		if !sort.IsSorted(sortGasAndReward(sb.Txs)) {
+			t.Fatalf("Expected the txs of block %d to remain sorted", number)
+		}
+	}
+
+	// The oldest blocks missing, the range starts after them
+	missing := &missingBackend{testBackend: backend, missing: map[uint64]bool{23: true, 24: true}}
+	aggregate, err = NewOracle(missing, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000}).FeeHistoryAggregate(context.Background(), 10, 32, percentiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aggregate.OldestBlock.Uint64() != 25 || aggregate.Blocks != 8 || len(aggregate.Reward) != len(percentiles) {
+		t.Fatalf("Expected the fees of 8 blocks from 25, found %d from %d", aggregate.Blocks, aggregate.OldestBlock)
+	}
+
+	if _, err := oracle.FeeHistoryAggregate(context.Background(), 10, rpc.LatestBlockNumber, []float64{50, 10}); !errors.Is(err, errInvalidPercentile) {
+		t.Fatalf("Expected %v, found %v", errInvalidPercentile, err)
+	}
+}
+
+// TestFeeHistoryAggregateEmpty checks that the rewards of a range without
+// transactions are zero.
+func TestFeeHistoryAggregateEmpty(t *testing.T) {
+	backend := newTestBackendFakerEngine(t, params.TestChainConfig, 32, common.Big0, func(i int, b *core.BlockGen) {})
+	oracle := NewOracle(backend, Config{MaxCallBlockHistory: 1000, MaxBlockHistory: 1000})
+	percentiles := []float64{10, 50, 90}
+	for _, test := range []struct {
+		name      string
+		count     int
+		expBlocks int
+	}{
+		{name: "empty blocks", count: 10, expBlocks: 10},
+		{name: "no blocks", count: 0, expBlocks: 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			aggregate, err := oracle.FeeHistoryAggregate(context.Background(), test.count, rpc.LatestBlockNumber, percentiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aggregate.Blocks != test.expBlocks {
+				t.Fatalf("Expected the fees of %d blocks, found %d", test.expBlocks, aggregate.Blocks)
+			}
+			if len(aggregate.Reward) != len(percentiles) {
+				t.Fatalf("Expected %d rewards, found %d", len(percentiles), len(aggregate.Reward))
+			}
+			for i, reward := range aggregate.Reward {
+				if reward.Sign() != 0 {
+					t.Fatalf("Expected a zero reward at percentile %v, found %d", percentiles[i], reward)
+				}
+			}
+		})
+	}
+}
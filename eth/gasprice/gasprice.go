@@ -36,8 +36,9 @@ import (
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+	"github.com/zsmartex/avalanchego/utils/units"
 	"github.com/zsmartex/coreth/consensus/dummy"
 	"github.com/zsmartex/coreth/core"
 	"github.com/zsmartex/coreth/core/types"
@@ -55,10 +56,12 @@ const (
 	// DefaultMaxBlockHistory is chosen to be a value larger than the required
 	// fee lookback window that MetaMask uses (20k blocks).
 	DefaultMaxBlockHistory int = 25_000
-	// DefaultFeeHistoryCacheSize is chosen to be some value larger than
-	// [DefaultMaxBlockHistory] to ensure all block lookups can be cached when
-	// serving a fee history query.
-	DefaultFeeHistoryCacheSize int = 30_000
+	// DefaultFeeHistoryCacheSize is the size in bytes of the blocks and rewards
+	// cached to serve fee history queries. It is chosen to hold about 28,000
+	// blocks of 40 txs, some value larger than [DefaultMaxBlockHistory] to
+	// ensure all block lookups of typical blocks can be cached when serving a
+	// fee history query.
+	DefaultFeeHistoryCacheSize uint64 = 64 * units.MiB
 )
 
 var (
@@ -66,8 +69,36 @@ var (
 	DefaultMinPrice   = big.NewInt(0 * params.GWei)
 	DefaultMinBaseFee = big.NewInt(params.ApricotPhase3InitialBaseFee)
 	DefaultMinGasUsed = big.NewInt(6_000_000) // block gas limit is 8,000,000
+	// DefaultFallbackTip is chosen to be high enough for transactions to be
+	// included in blocks that are not full despite the lack of history.
+	DefaultFallbackTip = big.NewInt(5 * params.GWei)
 )
 
+// FeeSource is the origin of the sample a fee suggestion is based on.
+type FeeSource string
+
+const (
+	// FeeSourceRecent suggestions are sampled from the most recent blocks.
+	FeeSourceRecent FeeSource = "recent"
+	// FeeSourceHistory suggestions are sampled from older blocks as well, too
+	// few of the most recent ones being non-empty.
+	FeeSourceHistory FeeSource = "history"
+	// FeeSourceFallback suggestions are the configured fallback tip, the
+	// history needed for a sufficient sample being unavailable.
+	FeeSourceFallback FeeSource = "fallback"
+)
+
+// GasFees is a suggestion of the fees of a dynamic fee transaction.
+type GasFees struct {
+	TipCap *big.Int
+	// BaseFee is nil if base fees have not been enabled.
+	BaseFee *big.Int
+	Source  FeeSource
+	// SampledBlocks is the number of non-empty blocks sampled. When [Source]
+	// is FeeSourceRecent, the empty blocks of the sample are not counted.
+	SampledBlocks int
+}
+
 type Config struct {
 	// Blocks specifies the number of blocks to fetch during gas price estimation.
 	Blocks     int
@@ -81,11 +112,24 @@ type Config struct {
 	MaxPrice        *big.Int `toml:",omitempty"`
 	MinPrice        *big.Int `toml:",omitempty"`
 	MinGasUsed      *big.Int `toml:",omitempty"`
+	// MinSampleBlocks specifies the minimum number of non-empty blocks to base
+	// a suggestion on. If fewer of the [Blocks] most recent blocks are
+	// non-empty, older blocks are fetched up to [MaxBlockHistory] behind the
+	// last accepted block. Zero disables this fallback.
+	MinSampleBlocks int
+	// FallbackTip is suggested when the blocks needed for [MinSampleBlocks]
+	// are unavailable, such as on a node that started from a synced height.
+	FallbackTip *big.Int `toml:",omitempty"`
+	// FeeHistoryCacheSize specifies the maximum size in bytes of the blocks
+	// cached to serve eth_feeHistory, the least recently used ones being
+	// evicted first.
+	FeeHistoryCacheSize uint64
 }
 
 // OracleBackend includes all necessary background APIs for oracle.
 type OracleBackend interface {
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
 	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	PendingBlockAndReceipts() (*types.Block, types.Receipts)
@@ -120,7 +164,16 @@ type Oracle struct {
 	checkBlocks, percentile int
 	maxCallBlockHistory     int
 	maxBlockHistory         int
-	historyCache            *lru.Cache
+	// [historyCache] holds the blocks fetched for eth_feeHistory and their
+	// [processedFees] for the requested reward percentiles
+	historyCache *feeHistoryCache
+
+	// [minSampleBlocks] non-empty blocks are required for a suggestion not to
+	// fall back to older blocks, and to [fallbackTip] without them.
+	minSampleBlocks int
+	fallbackTip     *big.Int
+	lastSource      FeeSource
+	lastSampled     int
 }
 
 // NewOracle returns a new gasprice oracle which can recommend suitable
@@ -164,8 +217,24 @@ func NewOracle(backend OracleBackend, config Config) *Oracle {
 		maxBlockHistory = DefaultMaxBlockHistory
 		log.Warn("Sanitizing invalid gasprice oracle max block history", "provided", config.MaxBlockHistory, "updated", maxBlockHistory)
 	}
+	minSampleBlocks := config.MinSampleBlocks
+	if minSampleBlocks < 0 {
+		minSampleBlocks = 0
+		log.Warn("Sanitizing invalid gasprice oracle min sample blocks", "provided", config.MinSampleBlocks, "updated", minSampleBlocks)
+	}
+	fallbackTip := config.FallbackTip
+	if minSampleBlocks > 0 && (fallbackTip == nil || fallbackTip.Sign() < 0) {
+		fallbackTip = DefaultFallbackTip
+		log.Warn("Sanitizing invalid gasprice oracle fallback tip", "provided", config.FallbackTip, "updated", fallbackTip)
+	}
+
+	feeHistoryCacheSize := config.FeeHistoryCacheSize
+	if feeHistoryCacheSize == 0 {
+		// An unset size is not invalid, the default applies
+		feeHistoryCacheSize = DefaultFeeHistoryCacheSize
+	}
 
-	cache, _ := lru.New(DefaultFeeHistoryCacheSize)
+	cache := newFeeHistoryCache(feeHistoryCacheSize, metrics.GetOrRegisterGauge(feeHistoryCacheSizeMetric, nil))
 	headEvent := make(chan core.ChainHeadEvent, 1)
 	backend.SubscribeChainHeadEvent(headEvent)
 	go func() {
@@ -190,6 +259,9 @@ func NewOracle(backend OracleBackend, config Config) *Oracle {
 		maxCallBlockHistory: maxCallBlockHistory,
 		maxBlockHistory:     maxBlockHistory,
 		historyCache:        cache,
+		minSampleBlocks:     minSampleBlocks,
+		fallbackTip:         fallbackTip,
+		lastSource:          FeeSourceRecent,
 	}
 }
 
@@ -197,10 +269,11 @@ func NewOracle(backend OracleBackend, config Config) *Oracle {
 // produced at the current time. If ApricotPhase3 has not been activated, it may
 // return a nil value and a nil error.
 func (oracle *Oracle) EstimateBaseFee(ctx context.Context) (*big.Int, error) {
-	_, baseFee, err := oracle.suggestDynamicFees(ctx)
+	fees, err := oracle.suggestDynamicFees(ctx)
 	if err != nil {
 		return nil, err
 	}
+	baseFee := fees.BaseFee
 
 	// We calculate the [nextBaseFee] if a block were to be produced immediately.
 	// If [nextBaseFee] is lower than the estimate from sampling, then we return it
@@ -245,10 +318,11 @@ func (oracle *Oracle) estimateNextBaseFee(ctx context.Context) (*big.Int, error)
 // SuggestPrice returns an estimated price for legacy transactions.
 func (oracle *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	// Estimate the effective tip based on recent blocks.
-	tip, baseFee, err := oracle.suggestDynamicFees(ctx)
+	fees, err := oracle.suggestDynamicFees(ctx)
 	if err != nil {
 		return nil, err
 	}
+	tip, baseFee := fees.TipCap, fees.BaseFee
 
 	// We calculate the [nextBaseFee] if a block were to be produced immediately.
 	// If [nextBaseFee] is lower than the estimate from sampling, then we return it
@@ -273,67 +347,80 @@ func (oracle *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 // necessary to add the basefee to the returned number to fall back to the legacy
 // behavior.
 func (oracle *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
-	tip, _, err := oracle.suggestDynamicFees(ctx)
-	return tip, err
+	fees, err := oracle.suggestDynamicFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fees.TipCap, nil
+}
+
+// SuggestGasFees returns a tip cap as in SuggestTipCap and an estimate of the
+// base fee as in EstimateBaseFee, along with the origin of the sample of the
+// tip cap.
+func (oracle *Oracle) SuggestGasFees(ctx context.Context) (*GasFees, error) {
+	fees, err := oracle.suggestDynamicFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nextBaseFee, err := oracle.estimateNextBaseFee(ctx)
+	if err != nil {
+		log.Warn("failed to estimate next base fee", "err", err)
+		return fees, nil
+	}
+	// If base fees have not been enabled, there is no base fee to suggest.
+	if nextBaseFee == nil {
+		fees.BaseFee = nil
+		return fees, nil
+	}
+	fees.BaseFee = math.BigMin(fees.BaseFee, nextBaseFee)
+	return fees, nil
 }
 
 // suggestDynamicFees estimates the gas tip and base fee based on a simple sampling method
-func (oracle *Oracle) suggestDynamicFees(ctx context.Context) (*big.Int, *big.Int, error) {
+func (oracle *Oracle) suggestDynamicFees(ctx context.Context) (*GasFees, error) {
 	head, err := oracle.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	headHash := head.Hash()
 
 	// If the latest gasprice is still available, return it.
-	oracle.cacheLock.RLock()
-	lastHead, lastPrice, lastBaseFee := oracle.lastHead, oracle.lastPrice, oracle.lastBaseFee
-	oracle.cacheLock.RUnlock()
-	if headHash == lastHead {
-		return new(big.Int).Set(lastPrice), new(big.Int).Set(lastBaseFee), nil
+	if fees := oracle.cachedFees(headHash); fees != nil {
+		return fees, nil
 	}
 	oracle.fetchLock.Lock()
 	defer oracle.fetchLock.Unlock()
 
 	// Try checking the cache again, maybe the last fetch fetched what we need
+	if fees := oracle.cachedFees(headHash); fees != nil {
+		return fees, nil
+	}
 	oracle.cacheLock.RLock()
-	lastHead, lastPrice, lastBaseFee = oracle.lastHead, oracle.lastPrice, oracle.lastBaseFee
+	lastPrice, lastBaseFee := oracle.lastPrice, oracle.lastBaseFee
 	oracle.cacheLock.RUnlock()
-	if headHash == lastHead {
-		return new(big.Int).Set(lastPrice), new(big.Int).Set(lastBaseFee), nil
+
+	window, err := oracle.sampleBlocks(ctx, head.Number.Uint64(), oracle.checkBlocks)
+	if err != nil {
+		return nil, err
 	}
 	var (
-		sent, exp      int
-		number         = head.Number.Uint64()
-		result         = make(chan results, oracle.checkBlocks)
-		quit           = make(chan struct{})
-		tipResults     []*big.Int
-		baseFeeResults []*big.Int
+		tipResults     = window.tips
+		baseFeeResults = window.baseFees
+		sampled        = len(window.nonEmptyTips)
+		source         = FeeSourceRecent
 	)
-	for sent < oracle.checkBlocks && number > 0 {
-		go oracle.getBlockTips(ctx, number, result, quit)
-		sent++
-		exp++
-		number--
-	}
-	for exp > 0 {
-		res := <-result
-		if res.err != nil {
-			close(quit)
-			return new(big.Int).Set(lastPrice), new(big.Int).Set(lastBaseFee), res.err
+	if sampled < oracle.minSampleBlocks {
+		// Too few of the recent blocks are non-empty, as on a node that just
+		// started from a synced height, so older blocks are sampled as well.
+		tipResults, source, err = oracle.sampleHistory(ctx, head.Number.Uint64(), window)
+		if err != nil {
+			return nil, err
 		}
-		exp--
-		if res.tip != nil {
-			tipResults = append(tipResults, res.tip)
-		} else {
-			tipResults = append(tipResults, new(big.Int).Set(common.Big0))
-		}
-
-		if res.baseFee != nil {
-			baseFeeResults = append(baseFeeResults, res.baseFee)
-		} else {
-			baseFeeResults = append(baseFeeResults, new(big.Int).Set(common.Big0))
+		sampled = len(tipResults)
+		if source == FeeSourceFallback {
+			tipResults = []*big.Int{new(big.Int).Set(oracle.fallbackTip)}
 		}
 	}
 	price := lastPrice
@@ -357,15 +444,135 @@ func (oracle *Oracle) suggestDynamicFees(ctx context.Context) (*big.Int, *big.In
 	oracle.lastHead = headHash
 	oracle.lastPrice = price
 	oracle.lastBaseFee = baseFee
+	oracle.lastSource = source
+	oracle.lastSampled = sampled
 	oracle.cacheLock.Unlock()
 
-	return new(big.Int).Set(price), new(big.Int).Set(baseFee), nil
+	return &GasFees{
+		TipCap:        new(big.Int).Set(price),
+		BaseFee:       new(big.Int).Set(baseFee),
+		Source:        source,
+		SampledBlocks: sampled,
+	}, nil
+}
+
+// cachedFees returns the fees suggested at [head], or nil if the last
+// suggestion was made at another head.
+func (oracle *Oracle) cachedFees(head common.Hash) *GasFees {
+	oracle.cacheLock.RLock()
+	defer oracle.cacheLock.RUnlock()
+
+	if head != oracle.lastHead {
+		return nil
+	}
+	return &GasFees{
+		TipCap:        new(big.Int).Set(oracle.lastPrice),
+		BaseFee:       new(big.Int).Set(oracle.lastBaseFee),
+		Source:        oracle.lastSource,
+		SampledBlocks: oracle.lastSampled,
+	}
+}
+
+// blockSample holds the tips and base fees of a range of blocks.
+type blockSample struct {
+	tips, baseFees []*big.Int
+	// nonEmptyTips holds the tips of the blocks of the range using gas
+	nonEmptyTips []*big.Int
+	// missing is set if the header of some block of the range is unavailable
+	missing bool
+}
+
+// sampleBlocks returns the sample of the [count] blocks ending at [number],
+// excluding the genesis block.
+func (oracle *Oracle) sampleBlocks(ctx context.Context, number uint64, count int) (*blockSample, error) {
+	var (
+		sent, exp int
+		result    = make(chan results, count)
+		quit      = make(chan struct{})
+		sample    = &blockSample{}
+	)
+	for sent < count && number > 0 {
+		go oracle.getBlockTips(ctx, number, result, quit)
+		sent++
+		exp++
+		number--
+	}
+	for exp > 0 {
+		res := <-result
+		if res.err != nil {
+			close(quit)
+			return nil, res.err
+		}
+		exp--
+		if res.missing {
+			sample.missing = true
+			continue
+		}
+		tip := res.tip
+		if tip == nil {
+			tip = new(big.Int).Set(common.Big0)
+		}
+		sample.tips = append(sample.tips, tip)
+		if !res.empty {
+			sample.nonEmptyTips = append(sample.nonEmptyTips, tip)
+		}
+
+		if res.baseFee != nil {
+			sample.baseFees = append(sample.baseFees, res.baseFee)
+		} else {
+			sample.baseFees = append(sample.baseFees, new(big.Int).Set(common.Big0))
+		}
+	}
+	return sample, nil
+}
+
+// sampleHistory returns the tips of the non-empty blocks of [window], the
+// sample of the most recent blocks ending at [head], and of the blocks before
+// it, fetched until [minSampleBlocks] non-empty blocks are found or
+// [maxBlockHistory] blocks behind [head] are reached.
+//
+// If the history misses blocks before enough non-empty blocks are found, the
+// tips found are returned along with FeeSourceFallback.
+func (oracle *Oracle) sampleHistory(ctx context.Context, head uint64, window *blockSample) ([]*big.Int, FeeSource, error) {
+	var (
+		tips    = window.nonEmptyTips
+		missing = window.missing
+		next    uint64 // Most recent block not sampled yet
+		oldest  uint64 = 1
+	)
+	if head > uint64(oracle.checkBlocks) {
+		next = head - uint64(oracle.checkBlocks)
+	}
+	if head > uint64(oracle.maxBlockHistory) {
+		oldest = head - uint64(oracle.maxBlockHistory)
+	}
+	for len(tips) < oracle.minSampleBlocks && !missing && next >= oldest && next > 0 {
+		count := oracle.checkBlocks
+		if remaining := next - oldest + 1; remaining < uint64(count) {
+			count = int(remaining)
+		}
+		sample, err := oracle.sampleBlocks(ctx, next, count)
+		if err != nil {
+			return nil, "", err
+		}
+		tips = append(tips, sample.nonEmptyTips...)
+		missing = sample.missing
+		next -= uint64(count)
+	}
+	if len(tips) < oracle.minSampleBlocks && missing {
+		return tips, FeeSourceFallback, nil
+	}
+	return tips, FeeSourceHistory, nil
 }
 
 type results struct {
 	tip     *big.Int
 	baseFee *big.Int
-	err     error
+	// missing is set if the header of the block is unavailable
+	missing bool
+	// empty is set if the block uses no gas
+	empty bool
+	err   error
 }
 
 // getBlockTips calculates the minimum required tip to be included in a given
@@ -374,7 +581,7 @@ func (oracle *Oracle) getBlockTips(ctx context.Context, blockNum uint64, result
 	header, err := oracle.backend.HeaderByNumber(ctx, rpc.BlockNumber(blockNum))
 	if header == nil {
 		select {
-		case result <- results{nil, nil, err}:
+		case result <- results{missing: true, err: err}:
 		case <-quit:
 		}
 		return
@@ -384,7 +591,7 @@ func (oracle *Oracle) getBlockTips(ctx context.Context, blockNum uint64, result
 	// expedite block production.
 	if header.GasUsed < oracle.minGasUsed.Uint64() {
 		select {
-		case result <- results{nil, header.BaseFee, nil}:
+		case result <- results{baseFee: header.BaseFee, empty: header.GasUsed == 0}:
 		case <-quit:
 		}
 		return
@@ -400,7 +607,7 @@ func (oracle *Oracle) getBlockTips(ctx context.Context, blockNum uint64, result
 	// delay in transaction inclusion.
 	minTip, err := oracle.backend.MinRequiredTip(ctx, header)
 	select {
-	case result <- results{minTip, header.BaseFee, err}:
+	case result <- results{tip: minTip, baseFee: header.BaseFee, err: err}:
 	case <-quit:
 	}
 }
@@ -53,17 +53,28 @@ var (
 )
 
 type testBackend struct {
-	chain   *core.BlockChain
-	pending bool // pending block available
+	chain           *core.BlockChain
+	pending         bool           // pending block available
+	pendingBlock    *types.Block   // block built on the head, not inserted
+	pendingReceipts types.Receipts // receipts of [pendingBlock]
+	lastAccepted    *types.Block   // last accepted block, the current block if nil
+	syncedHeight    uint64         // headers below it are unavailable, as on a node synced from there
 }
 
 func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
 	if number == rpc.LatestBlockNumber {
 		return b.chain.CurrentBlock().Header(), nil
 	}
+	if number > 0 && uint64(number) < b.syncedHeight {
+		return nil, nil
+	}
 	return b.chain.GetHeaderByNumber(uint64(number)), nil
 }
 
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
 func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
 	if number == rpc.LatestBlockNumber {
 		return b.chain.CurrentBlock(), nil
@@ -77,8 +88,7 @@ func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.
 
 func (b *testBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
 	if b.pending {
-		block := b.chain.GetBlockByNumber(testHead + 1)
-		return block, b.chain.GetReceiptsByHash(block.Hash())
+		return b.pendingBlock, b.pendingReceipts
 	}
 	return nil, nil
 }
@@ -91,7 +101,7 @@ func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) eve
 	return nil
 }
 
-func newTestBackendFakerEngine(t *testing.T, config *params.ChainConfig, numBlocks int, extDataGasUsage *big.Int, genBlocks func(i int, b *core.BlockGen)) *testBackend {
+func newTestBackendFakerEngine(t testing.TB, config *params.ChainConfig, numBlocks int, extDataGasUsage *big.Int, genBlocks func(i int, b *core.BlockGen)) *testBackend {
 	var gspec = &core.Genesis{
 		Config: config,
 		Alloc:  core.GenesisAlloc{addr: core.GenesisAccount{Balance: bal}},
@@ -101,8 +111,8 @@ func newTestBackendFakerEngine(t *testing.T, config *params.ChainConfig, numBloc
 	db := rawdb.NewMemoryDatabase()
 	genesis := gspec.MustCommit(db)
 
-	// Generate testing blocks
-	blocks, _, err := core.GenerateChain(gspec.Config, genesis, engine, db, numBlocks, 0, genBlocks)
+	// Generate testing blocks, the last one is the pending block
+	blocks, receipts, err := core.GenerateChain(gspec.Config, genesis, engine, db, numBlocks+1, 0, genBlocks)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,10 +123,10 @@ func newTestBackendFakerEngine(t *testing.T, config *params.ChainConfig, numBloc
 	if err != nil {
 		t.Fatalf("Failed to create local chain, %v", err)
 	}
-	if _, err := chain.InsertChain(blocks); err != nil {
+	if _, err := chain.InsertChain(blocks[:numBlocks]); err != nil {
 		t.Fatalf("Failed to insert chain, %v", err)
 	}
-	return &testBackend{chain: chain}
+	return &testBackend{chain: chain, pendingBlock: blocks[numBlocks], pendingReceipts: receipts[numBlocks]}
 }
 
 func newTestBackend(t *testing.T, config *params.ChainConfig, numBlocks int, extDataGasUsage *big.Int, genBlocks func(i int, b *core.BlockGen)) *testBackend {
@@ -163,6 +173,9 @@ func (b *testBackend) CurrentHeader() *types.Header {
 }
 
 func (b *testBackend) LastAcceptedBlock() *types.Block {
+	if b.lastAccepted != nil {
+		return b.lastAccepted
+	}
 	return b.chain.CurrentBlock()
 }
 
@@ -448,3 +461,110 @@ func TestSuggestGasPricePreAP3(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// genFullBlocks returns a block generator filling the first [full] blocks with
+// enough txs paying [tip] to be sampled, leaving the others empty.
+func genFullBlocks(t testing.TB, full int, tip *big.Int) func(i int, b *core.BlockGen) {
+	return func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{1})
+		if i >= full {
+			return
+		}
+
+		signer := types.LatestSigner(params.TestApricotPhase3Config)
+		feeCap := new(big.Int).Add(b.BaseFee(), tip)
+		for j := 0; j < 370; j++ {
+			tx := types.NewTx(&types.DynamicFeeTx{
+				ChainID:   params.TestApricotPhase3Config.ChainID,
+				Nonce:     b.TxNonce(addr),
+				To:        &common.Address{},
+				Gas:       params.TxGas,
+				GasFeeCap: feeCap,
+				GasTipCap: tip,
+				Data:      []byte{},
+			})
+			tx, err := types.SignTx(tx, signer, key)
+			if err != nil {
+				t.Fatalf("failed to create tx: %s", err)
+			}
+			b.AddTx(tx)
+		}
+	}
+}
+
+func TestSuggestGasFeesColdStart(t *testing.T) {
+	fallbackTip := big.NewInt(7 * params.GWei)
+	tests := map[string]struct {
+		fullBlocks      int
+		syncedHeight    uint64
+		maxBlockHistory int
+		expectedSource  FeeSource
+		expectedSampled int
+	}{
+		"recent blocks": {
+			fullBlocks:      testHead,
+			expectedSource:  FeeSourceRecent,
+			expectedSampled: 5,
+		},
+		"synced with recent blocks": {
+			fullBlocks:      testHead,
+			syncedHeight:    testHead - 3,
+			expectedSource:  FeeSourceRecent,
+			expectedSampled: 4,
+		},
+		"history": {
+			fullBlocks:      8,
+			expectedSource:  FeeSourceHistory,
+			expectedSampled: 6,
+		},
+		"history beyond max block history": {
+			fullBlocks:      8,
+			maxBlockHistory: 20,
+			expectedSource:  FeeSourceHistory,
+			expectedSampled: 0,
+		},
+		"synced without history": {
+			fullBlocks:      8,
+			syncedHeight:    testHead - 3,
+			expectedSource:  FeeSourceFallback,
+			expectedSampled: 0,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := newTestBackend(t, params.TestApricotPhase3Config, testHead, common.Big0, genFullBlocks(t, test.fullBlocks, big.NewInt(55*params.GWei)))
+			backend.syncedHeight = test.syncedHeight
+			oracle := NewOracle(backend, Config{
+				Blocks:          5,
+				Percentile:      60,
+				MaxBlockHistory: test.maxBlockHistory,
+				MinSampleBlocks: 3,
+				FallbackTip:     fallbackTip,
+			})
+
+			// The first call on the node makes a sensible suggestion
+			fees, err := oracle.SuggestGasFees(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fees.Source != test.expectedSource || fees.SampledBlocks != test.expectedSampled {
+				t.Fatalf("Expected %d blocks sampled from %s, found %d from %s", test.expectedSampled, test.expectedSource, fees.SampledBlocks, fees.Source)
+			}
+			if (test.expectedSource == FeeSourceFallback) != (fees.TipCap.Cmp(fallbackTip) == 0) {
+				t.Fatalf("Unexpected tip (%d) with fallback tip (%d)", fees.TipCap, fallbackTip)
+			}
+			if fees.BaseFee == nil || fees.BaseFee.Sign() <= 0 {
+				t.Fatalf("Expected a positive base fee, found %v", fees.BaseFee)
+			}
+
+			// The suggestion is cached for the head
+			tip, err := oracle.SuggestTipCap(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tip.Cmp(fees.TipCap) != 0 {
+				t.Fatalf("Expected tip (%d), got tip (%d)", fees.TipCap, tip)
+			}
+		})
+	}
+}
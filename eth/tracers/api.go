@@ -80,6 +80,8 @@ type Backend interface {
 	BadBlocks() []*types.Block
 	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
 	RPCGasCap() uint64
+	TraceBlockWorkers() int
+	TracePool() *WorkPool
 	ChainConfig() *params.ChainConfig
 	Engine() consensus.Engine
 	ChainDb() ethdb.Database
@@ -438,6 +440,12 @@ func (api *API) traceChain(ctx context.Context, start, end *types.Block, config
 // TraceBlockByNumber returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
 func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]*txTraceResult, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	block, err := api.blockByNumber(ctx, number)
 	if err != nil {
 		return nil, err
@@ -448,6 +456,12 @@ func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber,
 // TraceBlockByHash returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
 func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	block, err := api.blockByHash(ctx, hash)
 	if err != nil {
 		return nil, err
@@ -458,6 +472,12 @@ func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash, config *
 // TraceBlock returns the structured logs created during the execution of EVM
 // and returns them as a JSON object.
 func (api *API) TraceBlock(ctx context.Context, blob []byte, config *TraceConfig) ([]*txTraceResult, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	block := new(types.Block)
 	if err := rlp.Decode(bytes.NewReader(blob), block); err != nil {
 		return nil, fmt.Errorf("could not decode block: %v", err)
@@ -469,6 +489,12 @@ func (api *API) TraceBlock(ctx context.Context, blob []byte, config *TraceConfig
 // EVM against a block pulled from the pool of bad ones and returns them as a JSON
 // object.
 func (api *API) TraceBadBlock(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Search for the bad block corresponding to [hash].
 	var (
 		badBlocks = api.backend.BadBlocks()
@@ -489,6 +515,12 @@ func (api *API) TraceBadBlock(ctx context.Context, hash common.Hash, config *Tra
 // IntermediateRoots executes a block (bad- or canon- or side-), and returns a list
 // of intermediate roots: the stateroot after each transaction.
 func (api *API) IntermediateRoots(ctx context.Context, hash common.Hash, config *TraceConfig) ([]common.Hash, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	block, _ := api.blockByHash(ctx, hash)
 	if block == nil {
 		return nil, fmt.Errorf("block %#x not found", hash)
@@ -516,6 +548,9 @@ func (api *API) IntermediateRoots(ctx context.Context, hash common.Hash, config
 		deleteEmptyObjects = chainConfig.IsEIP158(block.Number())
 	)
 	for i, tx := range block.Transactions() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		var (
 			msg, _    = tx.AsMessage(signer, block.BaseFee())
 			txContext = core.NewEVMTxContext(msg)
@@ -563,14 +598,13 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 		signer  = types.MakeSigner(api.backend.ChainConfig(), block.Number(), new(big.Int).SetUint64(block.Time()))
 		txs     = block.Transactions()
 		results = make([]*txTraceResult, len(txs))
+		threads = api.blockTraceWorkers(config, len(txs))
 
+		// Each pending task holds a copy of the state, so the number of
+		// queued tasks is bounded by the number of workers.
 		pend = new(sync.WaitGroup)
-		jobs = make(chan *txTraceTask, len(txs))
+		jobs = make(chan *txTraceTask, threads)
 	)
-	threads := runtime.NumCPU()
-	if threads > len(txs) {
-		threads = len(txs)
-	}
 	blockHash := block.Hash()
 	for th := 0; th < threads; th++ {
 		pend.Add(1)
@@ -599,6 +633,10 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 	var failed error
 	blockCtx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
 	for i, tx := range txs {
+		if err := ctx.Err(); err != nil {
+			failed = err
+			break
+		}
 		// Send the trace task over for execution
 		jobs <- &txTraceTask{statedb: statedb.Copy(), index: i}
 
@@ -624,9 +662,32 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 	return results, nil
 }
 
+// blockTraceWorkers returns the number of workers to use to trace [txs]
+// transactions with [config]. Tracers that are not safe for concurrent use are
+// executed sequentially.
+func (api *API) blockTraceWorkers(config *TraceConfig, txs int) int {
+	threads := api.backend.TraceBlockWorkers()
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	if config != nil && config.Tracer != nil && !SupportsConcurrency(*config.Tracer) {
+		threads = 1
+	}
+	if threads > txs {
+		threads = txs
+	}
+	return threads
+}
+
 // TraceTransaction returns the structured logs created during the execution of EVM
 // and returns them as a JSON object.
 func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *TraceConfig) (interface{}, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	_, blockHash, blockNumber, index, err := api.backend.GetTransaction(ctx, hash)
 	if err != nil {
 		return nil, err
@@ -660,11 +721,14 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
 // top of the provided block and returns them as a JSON object.
 // You can provide -2 as a block number to trace on top of the pending block.
 func (api *API) TraceCall(ctx context.Context, args ethapi.TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
+	release, err := api.backend.TracePool().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Try to retrieve the specified block
-	var (
-		err   error
-		block *types.Block
-	)
+	var block *types.Block
 	if hash, ok := blockNrOrHash.Hash(); ok {
 		block, err = api.blockByHash(ctx, hash)
 	} else if number, ok := blockNrOrHash.Number(); ok {
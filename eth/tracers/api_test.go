@@ -34,6 +34,7 @@ import (
 	"fmt"
 	"math/big"
 	"reflect"
+	"runtime"
 	"sort"
 	"testing"
 
@@ -64,6 +65,7 @@ type testBackend struct {
 	engine      consensus.Engine
 	chaindb     ethdb.Database
 	chain       *core.BlockChain
+	pool        *WorkPool
 }
 
 func newTestBackend(t *testing.T, n int, gspec *core.Genesis, generator func(i int, b *core.BlockGen)) *testBackend {
@@ -132,7 +134,7 @@ func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber)
 func (b *testBackend) BadBlocks() []*types.Block { return nil }
 
 func (b *testBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
-	tx, hash, blockNumber, index := rawdb.ReadTransaction(b.chaindb, txHash)
+	tx, hash, blockNumber, index := b.chain.GetTransaction(txHash)
 	if tx == nil {
 		return nil, common.Hash{}, 0, 0, errTransactionNotFound
 	}
@@ -143,6 +145,14 @@ func (b *testBackend) RPCGasCap() uint64 {
 	return 25000000
 }
 
+func (b *testBackend) TraceBlockWorkers() int {
+	return 0
+}
+
+func (b *testBackend) TracePool() *WorkPool {
+	return b.pool
+}
+
 func (b *testBackend) ChainConfig() *params.ChainConfig {
 	return b.chainConfig
 }
@@ -178,6 +188,9 @@ func (b *testBackend) StateAtTransaction(ctx context.Context, block *types.Block
 	// Recompute transactions up to the target index.
 	signer := types.MakeSigner(b.chainConfig, block.Number(), new(big.Int).SetUint64(block.Time()))
 	for idx, tx := range block.Transactions() {
+		if err := ctx.Err(); err != nil {
+			return nil, vm.BlockContext{}, nil, err
+		}
 		msg, _ := tx.AsMessage(signer, block.BaseFee())
 		txContext := core.NewEVMTxContext(msg)
 		context := core.NewEVMBlockContext(block.Header(), b.chain, nil)
@@ -467,6 +480,49 @@ func TestTraceBlock(t *testing.T) {
 	}
 }
 
+// cancellingBackend cancels the request once the state the block is traced on
+// is retrieved, before its txs are executed.
+type cancellingBackend struct {
+	*testBackend
+	cancel context.CancelFunc
+}
+
+func (b *cancellingBackend) StateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, checkLive bool, preferDisk bool) (*state.StateDB, error) {
+	b.cancel()
+	return b.testBackend.StateAtBlock(ctx, block, reexec, base, checkLive, preferDisk)
+}
+
+func TestTraceBlockCancelled(t *testing.T) {
+	accounts := newAccounts(2)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+	}}
+	signer := types.HomesteadSigner{}
+	backend := &cancellingBackend{testBackend: newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		for nonce := uint64(0); nonce < 10; nonce++ {
+			tx, _ := types.SignTx(types.NewTransaction(nonce, accounts[1].addr, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, accounts[0].key)
+			b.AddTx(tx)
+		}
+	})}
+	api := NewAPI(backend)
+	block := backend.chain.GetBlockByNumber(1)
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend.cancel = cancel
+	if _, err := api.TraceBlockByNumber(ctx, rpc.BlockNumber(1), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the block trace to be cancelled, found %v", err)
+	}
+	if _, err := api.IntermediateRoots(ctx, block.Hash(), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the intermediate roots to be cancelled, found %v", err)
+	}
+	// The trace workers are stopped before the trace returns
+	if leaked := runtime.NumGoroutine() - goroutines; leaked > 0 {
+		t.Fatalf("Expected the trace workers to stop, found %d goroutines left", leaked)
+	}
+}
+
 type Account struct {
 	key  *ecdsa.PrivateKey
 	addr common.Address
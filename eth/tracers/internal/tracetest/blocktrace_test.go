@@ -0,0 +1,228 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package tracetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/coreth/consensus"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/eth/tracers"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// loopCode counts down from 512 before returning, giving every transaction
+// in the traced block some execution to trace.
+var loopCode = common.FromHex("6102005b600190038060035700")
+
+// blockTraceBackend is a minimal tracers.Backend serving a single chain of
+// accepted blocks out of an archive blockchain.
+type blockTraceBackend struct {
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	chaindb     ethdb.Database
+	chain       *core.BlockChain
+	workers     int
+}
+
+// newBlockTraceBackend returns a backend whose head block contains [txs]
+// transactions, each calling a contract running [loopCode].
+func newBlockTraceBackend(tb testing.TB, txs int) *blockTraceBackend {
+	var (
+		key, _   = crypto.GenerateKey()
+		from     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		funds    = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+		backend  = &blockTraceBackend{
+			chainConfig: params.TestChainConfig,
+			engine:      dummy.NewETHFaker(),
+			chaindb:     rawdb.NewMemoryDatabase(),
+		}
+		signer = types.LatestSigner(backend.chainConfig)
+	)
+	gspec := &core.Genesis{
+		Config: backend.chainConfig,
+		Alloc: core.GenesisAlloc{
+			from:     {Balance: funds},
+			contract: {Balance: common.Big0, Code: loopCode},
+		},
+	}
+	gendb := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _, err := core.GenerateChain(backend.chainConfig, genesis, backend.engine, gendb, 1, 10, func(i int, b *core.BlockGen) {
+		gasPrice := new(big.Int).Add(b.BaseFee(), big.NewInt(int64(500*params.GWei)))
+		for nonce := 0; nonce < txs; nonce++ {
+			tx, err := types.SignTx(types.NewTransaction(uint64(nonce), contract, common.Big1, 50_000, gasPrice, nil), signer, key)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			b.AddTx(tx)
+		}
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	gspec.MustCommit(backend.chaindb)
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit: 256,
+		TrieDirtyLimit: 256,
+		SnapshotLimit:  128,
+		Pruning:        false, // Archive mode
+	}
+	chain, err := core.NewBlockChain(backend.chaindb, cacheConfig, backend.chainConfig, backend.engine, vm.Config{}, common.Hash{})
+	if err != nil {
+		tb.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		tb.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	for _, block := range blocks {
+		if err := chain.Accept(block); err != nil {
+			tb.Fatalf("failed to accept block %d: %v", block.NumberU64(), err)
+		}
+	}
+	if got := len(chain.CurrentBlock().Transactions()); got != txs {
+		tb.Fatalf("expected %d transactions in head block, found %d", txs, got)
+	}
+	backend.chain = chain
+	return backend
+}
+
+func (b *blockTraceBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *blockTraceBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.PendingBlockNumber || number == rpc.LatestBlockNumber {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *blockTraceBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *blockTraceBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.PendingBlockNumber || number == rpc.LatestBlockNumber {
+		return b.chain.CurrentBlock(), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *blockTraceBackend) BadBlocks() []*types.Block { return nil }
+
+func (b *blockTraceBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	tx, hash, blockNumber, index := rawdb.ReadTransaction(b.chaindb, txHash)
+	return tx, hash, blockNumber, index, nil
+}
+
+func (b *blockTraceBackend) RPCGasCap() uint64 { return 25000000 }
+
+func (b *blockTraceBackend) TraceBlockWorkers() int { return b.workers }
+
+func (b *blockTraceBackend) TracePool() *tracers.WorkPool { return nil }
+
+func (b *blockTraceBackend) ChainConfig() *params.ChainConfig { return b.chainConfig }
+
+func (b *blockTraceBackend) Engine() consensus.Engine { return b.engine }
+
+func (b *blockTraceBackend) ChainDb() ethdb.Database { return b.chaindb }
+
+func (b *blockTraceBackend) StateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, checkLive bool, preferDisk bool) (*state.StateDB, error) {
+	return b.chain.StateAt(block.Root())
+}
+
+func (b *blockTraceBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (core.Message, vm.BlockContext, *state.StateDB, error) {
+	return nil, vm.BlockContext{}, nil, errors.New("not supported")
+}
+
+// traceHead traces the head block of [backend] with [workers] workers and
+// returns the JSON encoded results.
+func traceHead(tb testing.TB, backend *blockTraceBackend, workers int, config *tracers.TraceConfig) []byte {
+	backend.workers = workers
+	results, err := tracers.NewAPI(backend).TraceBlockByNumber(context.Background(), rpc.LatestBlockNumber, config)
+	if err != nil {
+		tb.Fatalf("failed to trace block: %v", err)
+	}
+	blob, err := json.Marshal(results)
+	if err != nil {
+		tb.Fatalf("failed to marshal results: %v", err)
+	}
+	return blob
+}
+
+func TestTraceBlockParallel(t *testing.T) {
+	var (
+		backend = newBlockTraceBackend(t, 200)
+		tracer  = "callTracer"
+		config  = &tracers.TraceConfig{Tracer: &tracer}
+	)
+	sequential := traceHead(t, backend, 1, config)
+	parallel := traceHead(t, backend, 8, config)
+	if !bytes.Equal(sequential, parallel) {
+		t.Fatalf("parallel trace mismatch\nsequential: %s\nparallel:   %s", sequential, parallel)
+	}
+
+	var results []struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := json.Unmarshal(parallel, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 200 {
+		t.Fatalf("expected 200 results, found %d", len(results))
+	}
+	for i, res := range results {
+		if res.Error != "" || len(res.Result) == 0 {
+			t.Fatalf("unexpected result for tx %d: %+v", i, res)
+		}
+	}
+}
+
+func TestTracerSupportsConcurrency(t *testing.T) {
+	tests := map[string]bool{
+		"callTracer":     true,
+		"prestateTracer": true,
+		"{step: function() {}, fault: function() {}, result: function() { return null; }}": false,
+		"callTracerLegacy": false,
+	}
+	for code, expected := range tests {
+		if got := tracers.SupportsConcurrency(code); got != expected {
+			t.Errorf("tracer %q: expected concurrency support %v, got %v", code, expected, got)
+		}
+	}
+}
+
+func BenchmarkTraceBlock(b *testing.B) {
+	var (
+		backend = newBlockTraceBackend(b, 200)
+		tracer  = "callTracer"
+		config  = &tracers.TraceConfig{Tracer: &tracer}
+	)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				traceHead(b, backend, workers, config)
+			}
+		})
+	}
+}
@@ -76,7 +76,8 @@ func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to commo
 	// Compute intrinsic gas
 	isHomestead := env.ChainConfig().IsHomestead(env.Context.BlockNumber)
 	isIstanbul := env.ChainConfig().IsIstanbul(env.Context.BlockNumber)
-	intrinsicGas, err := core.IntrinsicGas(input, nil, create, isHomestead, isIstanbul)
+	_, initCodeWordGas := env.ChainConfig().InitCodeLimits(env.Context.Time)
+	intrinsicGas, err := core.IntrinsicGas(input, nil, create, isHomestead, isIstanbul, initCodeWordGas)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,180 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package tracers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// tracerBusyErrorCode is the "limit exceeded" code of EIP-1474, signalling
+// that the request may be retried later.
+const tracerBusyErrorCode = -32005
+
+var (
+	tracePoolWaitTimer     = metrics.NewRegisteredTimer("tracers/pool/wait", nil)
+	tracePoolRejectedMeter = metrics.NewRegisteredMeter("tracers/pool/rejected", nil)
+)
+
+// TracerBusyError is returned by the trace requests refused because the queue
+// of the pool is full.
+type TracerBusyError struct {
+	Queued, QueueLimit int
+}
+
+func (e *TracerBusyError) Error() string {
+	return fmt.Sprintf("tracer busy: %d requests queued (limit %d), retry later", e.Queued, e.QueueLimit)
+}
+
+// ErrorCode returns the code of an exceeded limit, as defined by EIP-1474.
+func (e *TracerBusyError) ErrorCode() int { return tracerBusyErrorCode }
+
+// ErrorData returns the depth of the queue the request was refused from.
+func (e *TracerBusyError) ErrorData() interface{} {
+	return map[string]interface{}{
+		"queued":     e.Queued,
+		"queueLimit": e.QueueLimit,
+	}
+}
+
+// WorkPool bounds the trace requests executed concurrently, queueing up to a
+// limit the requests waiting for a slot in the order they arrived. While the
+// chain is processing a block, the pool lowers its concurrency so that traces
+// yield the CPU to verification and acceptance: no queued request starts
+// until the traces in flight fall below the throttled concurrency, the traces
+// in flight are not interrupted.
+//
+// A nil *WorkPool does not bound the trace requests.
+type WorkPool struct {
+	concurrency, throttledConcurrency, queueLimit int
+
+	lock      sync.Mutex
+	active    int
+	throttles int
+	waiters   []chan struct{}
+}
+
+// NewWorkPool returns a pool executing up to [concurrency] trace requests,
+// [throttledConcurrency] while a block is processed, and queueing up to
+// [queueLimit] requests. It returns nil if [concurrency] is not positive.
+func NewWorkPool(concurrency, throttledConcurrency, queueLimit int) *WorkPool {
+	if concurrency <= 0 {
+		return nil
+	}
+	if throttledConcurrency <= 0 || throttledConcurrency > concurrency {
+		throttledConcurrency = concurrency
+	}
+	return &WorkPool{
+		concurrency:          concurrency,
+		throttledConcurrency: throttledConcurrency,
+		queueLimit:           queueLimit,
+	}
+}
+
+// limit returns the number of trace requests that may be in flight.
+// Assumes [p.lock] is held.
+func (p *WorkPool) limit() int {
+	if p.throttles > 0 {
+		return p.throttledConcurrency
+	}
+	return p.concurrency
+}
+
+// dispatch starts the queued requests fitting under the limit.
+// Assumes [p.lock] is held.
+func (p *WorkPool) dispatch() {
+	for len(p.waiters) > 0 && p.active < p.limit() {
+		close(p.waiters[0])
+		p.waiters = p.waiters[1:]
+		p.active++
+	}
+}
+
+// Acquire waits for a slot to execute a trace request, returning a function to
+// release it once the request completed. It returns a *TracerBusyError if the
+// queue is full, or the error of [ctx] if it is done before a slot frees up.
+func (p *WorkPool) Acquire(ctx context.Context) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	p.lock.Lock()
+	if len(p.waiters) == 0 && p.active < p.limit() {
+		p.active++
+		p.lock.Unlock()
+		tracePoolWaitTimer.Update(0)
+		return p.release, nil
+	}
+	if len(p.waiters) >= p.queueLimit {
+		queued := len(p.waiters)
+		p.lock.Unlock()
+		tracePoolRejectedMeter.Mark(1)
+		return nil, &TracerBusyError{Queued: queued, QueueLimit: p.queueLimit}
+	}
+	ready := make(chan struct{})
+	p.waiters = append(p.waiters, ready)
+	p.lock.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ready:
+		tracePoolWaitTimer.UpdateSince(start)
+		return p.release, nil
+	case <-ctx.Done():
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, waiter := range p.waiters {
+		if waiter == ready {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return nil, ctx.Err()
+		}
+	}
+	// The slot was granted as [ctx] was done, hand it over to the next request
+	p.active--
+	p.dispatch()
+	return nil, ctx.Err()
+}
+
+// release frees the slot of a trace request.
+func (p *WorkPool) release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.active--
+	p.dispatch()
+}
+
+// Throttle lowers the concurrency of the pool until the returned function is
+// called, and is called when the chain starts processing a block.
+func (p *WorkPool) Throttle() func() {
+	if p == nil {
+		return func() {}
+	}
+	p.lock.Lock()
+	p.throttles++
+	p.lock.Unlock()
+
+	return func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		p.throttles--
+		p.dispatch()
+	}
+}
+
+// Stats returns the number of trace requests in flight and queued.
+func (p *WorkPool) Stats() (active int, queued int) {
+	if p == nil {
+		return 0, 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.active, len(p.waiters)
+}
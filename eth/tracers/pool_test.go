@@ -0,0 +1,125 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package tracers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquireAsync acquires a slot of [pool] in a goroutine, sending the release
+// function once the slot is granted.
+func acquireAsync(t *testing.T, pool *WorkPool) <-chan func() {
+	granted := make(chan func(), 1)
+	go func() {
+		release, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		granted <- release
+	}()
+	return granted
+}
+
+// expectQueued waits for [pool] to have [active] requests in flight and
+// [queued] waiting.
+func expectQueued(t *testing.T, pool *WorkPool, active, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gotActive, gotQueued := pool.Stats()
+		if gotActive == active && gotQueued == queued {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d requests in flight and %d queued, found %d and %d", active, queued, gotActive, gotQueued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkPoolRejectsWhenFull(t *testing.T) {
+	pool := NewWorkPool(2, 1, 1)
+
+	releaseA, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseB, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted := acquireAsync(t, pool)
+	expectQueued(t, pool, 2, 1)
+
+	// The queue being full, the next request is refused with its depth
+	_, err = pool.Acquire(context.Background())
+	var busy *TracerBusyError
+	if !errors.As(err, &busy) || busy.Queued != 1 || busy.QueueLimit != 1 || busy.ErrorCode() != tracerBusyErrorCode {
+		t.Fatalf("Expected a tracer busy error with 1 queued request, found %v", err)
+	}
+
+	// A freed slot goes to the queued request
+	releaseA()
+	releaseC := <-granted
+	expectQueued(t, pool, 2, 0)
+	releaseB()
+	releaseC()
+	expectQueued(t, pool, 0, 0)
+}
+
+func TestWorkPoolThrottle(t *testing.T) {
+	pool := NewWorkPool(2, 1, 4)
+
+	releaseA, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While a block is accepted, a single trace request is in flight
+	done := pool.Throttle()
+	granted := acquireAsync(t, pool)
+	expectQueued(t, pool, 1, 1)
+
+	// Releasing the slot while throttled hands it over to the queued request,
+	// up to the throttled concurrency only
+	releaseA()
+	releaseB := <-granted
+	granted = acquireAsync(t, pool)
+	expectQueued(t, pool, 1, 1)
+
+	// Once the block is accepted, the full concurrency is restored
+	done()
+	releaseC := <-granted
+	expectQueued(t, pool, 2, 0)
+	releaseB()
+	releaseC()
+	expectQueued(t, pool, 0, 0)
+}
+
+func TestWorkPoolCancelledWait(t *testing.T) {
+	pool := NewWorkPool(1, 1, 1)
+
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := pool.Acquire(ctx)
+		cancelled <- err
+	}()
+	expectQueued(t, pool, 1, 1)
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the queued request to be cancelled, found %v", err)
+	}
+	expectQueued(t, pool, 1, 0)
+	release()
+	expectQueued(t, pool, 0, 0)
+}
@@ -46,17 +46,23 @@ type lookupFunc func(string, *Context) (Tracer, error)
 
 var (
 	lookups []lookupFunc
+
+	// concurrentLookups are the lookups registered without 'wildcard', whose
+	// tracers are safe to run concurrently with other instances.
+	concurrentLookups []lookupFunc
 )
 
 // RegisterLookup registers a method as a lookup for tracers, meaning that
 // users can invoke a named tracer through that lookup. If 'wildcard' is true,
 // then the lookup will be placed last. This is typically meant for interpreted
-// engines (js) which can evaluate dynamic user-supplied code.
+// engines (js) which can evaluate dynamic user-supplied code. Such tracers are
+// never run concurrently.
 func RegisterLookup(wildcard bool, lookup lookupFunc) {
 	if wildcard {
 		lookups = append(lookups, lookup)
 	} else {
 		lookups = append([]lookupFunc{lookup}, lookups...)
+		concurrentLookups = append(concurrentLookups, lookup)
 	}
 }
 
@@ -70,3 +76,14 @@ func New(code string, ctx *Context) (Tracer, error) {
 	}
 	return nil, errors.New("tracer not found")
 }
+
+// SupportsConcurrency returns whether separate instances of the tracer [code]
+// can be executed in parallel.
+func SupportsConcurrency(code string) bool {
+	for _, lookup := range concurrentLookups {
+		if _, err := lookup(code, new(Context)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+//go:build examples
+// +build examples
+
+// Embed runs a single C-Chain VM in memory with the embedding API, funding a
+// development key in its genesis, and serves its RPC APIs over HTTP. It builds
+// and accepts a block whenever the VM has txs to include, and sends a transfer
+// at startup to show one.
+//
+//	go run -tags examples ./examples/embed -http 127.0.0.1:9650
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/database/memdb"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm/embed"
+)
+
+// devKey is the funded development key, which must never hold real funds.
+const devKey = "56289e99c94b6912bfc12adc093c9b51124f0dc54ac7a766b2bc5ccf558d8027"
+
+func main() {
+	httpAddr := flag.String("http", "127.0.0.1:9650", "address to serve the RPC APIs on")
+	flag.Parse()
+
+	if err := run(*httpAddr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(httpAddr string) error {
+	key, err := ethcrypto.HexToECDSA(devKey)
+	if err != nil {
+		return err
+	}
+	addr := ethcrypto.PubkeyToAddress(key.PublicKey)
+	genesis, err := json.Marshal(&core.Genesis{
+		Config:     params.TestChainConfig,
+		GasLimit:   params.ApricotPhase1GasLimit,
+		Difficulty: common.Big0,
+		Alloc:      core.GenesisAlloc{addr: {Balance: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(1000))}},
+	})
+	if err != nil {
+		return err
+	}
+
+	chain, err := embed.New(embed.Config{Database: memdb.New(), Genesis: genesis})
+	if err != nil {
+		return err
+	}
+	defer chain.Shutdown()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	server := &http.Server{Addr: httpAddr, Handler: chain.Mux()}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			fmt.Fprintln(os.Stderr, err)
+			cancel()
+		}
+	}()
+	fmt.Printf("Serving the eth API of %s at http://%s%s\n", addr.Hex(), httpAddr, embed.EthRPCEndpoint)
+
+	signer := types.LatestSignerForChainID(params.TestChainConfig.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(0, common.HexToAddress("0x0123456789abcdef0123456789abcdef01234567"), big.NewInt(params.Ether), params.TxGas, big.NewInt(params.ApricotPhase4MaxBaseFee), nil), signer, key)
+	if err != nil {
+		return err
+	}
+	if err := chain.SubmitTx(ctx, tx); err != nil {
+		return err
+	}
+
+	for {
+		blk, err := chain.BuildAndAccept(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Accepted block %d %s\n", blk.Height(), blk.ID())
+	}
+}
@@ -47,6 +47,7 @@ import (
 	"github.com/zsmartex/coreth/accounts"
 	"github.com/zsmartex/coreth/accounts/keystore"
 	"github.com/zsmartex/coreth/accounts/scwallet"
+	"github.com/zsmartex/coreth/consensus/dummy"
 	"github.com/zsmartex/coreth/core"
 	"github.com/zsmartex/coreth/core/state"
 	"github.com/zsmartex/coreth/core/types"
@@ -95,6 +96,31 @@ func (s *PublicEthereumAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.
 	return (*hexutil.Big)(tipcap), err
 }
 
+type gasFeesResult struct {
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
+	BaseFee              *hexutil.Big `json:"baseFeePerGas,omitempty"`
+	// Source is "recent" or "history" if the tip is sampled from blocks, and
+	// "fallback" if it is the configured default, the blocks being unavailable.
+	Source        string         `json:"source"`
+	SampledBlocks hexutil.Uint64 `json:"sampledBlocks"`
+}
+
+// SuggestGasFees returns a suggestion for a gas tip cap and an estimate of the
+// base fee for dynamic fee transactions, along with the origin of the
+// suggestion.
+func (s *PublicEthereumAPI) SuggestGasFees(ctx context.Context) (*gasFeesResult, error) {
+	tipCap, baseFee, source, sampled, err := s.b.SuggestGasFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gasFeesResult{
+		MaxPriorityFeePerGas: (*hexutil.Big)(tipCap),
+		BaseFee:              (*hexutil.Big)(baseFee),
+		Source:               source,
+		SampledBlocks:        hexutil.Uint64(sampled),
+	}, nil
+}
+
 type feeHistoryResult struct {
 	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
 	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
@@ -102,7 +128,7 @@ type feeHistoryResult struct {
 	GasUsedRatio []float64        `json:"gasUsedRatio"`
 }
 
-func (s *PublicEthereumAPI) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryResult, error) {
+func (s *PublicEthereumAPI) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumberOrHash, rewardPercentiles []float64) (*feeHistoryResult, error) {
 	oldest, reward, baseFee, gasUsed, err := s.b.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
 	if err != nil {
 		return nil, err
@@ -129,6 +155,35 @@ func (s *PublicEthereumAPI) FeeHistory(ctx context.Context, blockCount rpc.Decim
 	return results, nil
 }
 
+type feeHistoryAggregateResult struct {
+	OldestBlock *hexutil.Big   `json:"oldestBlock"`
+	BlockCount  hexutil.Uint64 `json:"blockCount"`
+	Reward      []*hexutil.Big `json:"reward"`
+	NextBaseFee *hexutil.Big   `json:"nextBaseFeePerGas,omitempty"`
+}
+
+// FeeHistoryAggregate returns the effective tips of the transactions of the
+// range of blocks ending with [lastBlock] at each of [rewardPercentiles],
+// weighted by gas used across the whole range, instead of per block as
+// FeeHistory, along with the base fee of a block built on the newest block of
+// the range at the current time.
+func (s *PublicEthereumAPI) FeeHistoryAggregate(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryAggregateResult, error) {
+	oldest, blocks, reward, nextBaseFee, err := s.b.FeeHistoryAggregate(ctx, int(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	results := &feeHistoryAggregateResult{
+		OldestBlock: (*hexutil.Big)(oldest),
+		BlockCount:  hexutil.Uint64(blocks),
+		Reward:      make([]*hexutil.Big, len(reward)),
+		NextBaseFee: (*hexutil.Big)(nextBaseFee),
+	}
+	for i, v := range reward {
+		results.Reward[i] = (*hexutil.Big)(v)
+	}
+	return results, nil
+}
+
 // PublicTxPoolAPI offers and API for the transaction pool. It only operates on data that is non confidential.
 type PublicTxPoolAPI struct {
 	b Backend
@@ -200,6 +255,138 @@ func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	}
 }
 
+// NetworkStats returns the propagation statistics of the transactions reaching
+// the node over the last minute and the last hour: the number of transactions
+// first seen via RPC and via gossip, and the number of them included in
+// accepted blocks with their average time from first seen to acceptance, in
+// milliseconds. It also returns the number of transactions waiting to be
+// gossiped.
+func (s *PublicTxPoolAPI) NetworkStats() (map[string]interface{}, error) {
+	stats := s.b.TxNetworkStats()
+	if stats == nil {
+		return nil, errors.New("transaction network stats are not enabled")
+	}
+	window := func(w core.TxNetworkWindow) map[string]hexutil.Uint64 {
+		return map[string]hexutil.Uint64{
+			"rpc":                   hexutil.Uint64(w.RPC),
+			"gossip":                hexutil.Uint64(w.Gossip),
+			"included":              hexutil.Uint64(w.Included),
+			"avgInclusionLatencyMs": hexutil.Uint64(w.AvgInclusionLatency().Milliseconds()),
+		}
+	}
+	return map[string]interface{}{
+		"lastMinute":         window(stats.LastMinute),
+		"lastHour":           window(stats.LastHour),
+		"regossipQueueDepth": hexutil.Uint(stats.RegossipQueue),
+	}, nil
+}
+
+// PropagationStatus returns the propagation receipt of the locally submitted
+// transaction [hash]: the number of times it was gossiped and the most peers
+// connected when it was, and the number of distinct peers that gossiped it
+// back, with the first and last times of each in Unix milliseconds. It
+// returns nil if the transaction is not tracked, as it was not submitted to
+// this node, was included in an accepted block or was tracked for too long.
+func (s *PublicTxPoolAPI) PropagationStatus(hash common.Hash) (map[string]interface{}, error) {
+	if !s.b.TxPropagationEnabled() {
+		return nil, errors.New("transaction propagation receipts are not enabled")
+	}
+	status := s.b.TxPropagationStatus(hash)
+	if status == nil {
+		return nil, nil
+	}
+	unixMilli := func(t time.Time) *hexutil.Uint64 {
+		if t.IsZero() {
+			return nil
+		}
+		ms := hexutil.Uint64(t.UnixNano() / int64(time.Millisecond))
+		return &ms
+	}
+	return map[string]interface{}{
+		"gossips":         hexutil.Uint64(status.Gossips),
+		"peersGossiped":   hexutil.Uint(status.PeersGossiped),
+		"firstGossipedMs": unixMilli(status.FirstGossiped),
+		"lastGossipedMs":  unixMilli(status.LastGossiped),
+		"peersSeenBack":   hexutil.Uint64(status.PeersSeenBack),
+		"firstSeenBackMs": unixMilli(status.FirstSeenBack),
+		"lastSeenBackMs":  unixMilli(status.LastSeenBack),
+	}, nil
+}
+
+// maxFeeHistogramBuckets is the maximum number of bucket bounds of a
+// txpool_feeHistogram request.
+const maxFeeHistogramBuckets = 128
+
+// feeHistogramPercentiles are the percentiles of the fees returned by
+// txpool_feeHistogram.
+var feeHistogramPercentiles = []float64{10, 25, 50, 75, 90}
+
+// FeeHistogram returns the distribution of the fees of the pending and queued
+// transactions in the buckets delimited by the ascending [buckets] bounds,
+// from 0 to the first bound and from the last bound on: the number of
+// transactions and their total gas by effective tip at the current base fee
+// and by fee cap, as well as the transactions of a fee cap below the base fee.
+// It also returns the tips and fee caps at the 10th, 25th, 50th, 75th and 90th
+// percentiles weighted by gas. The fees are rounded down to 3 significant
+// digits.
+func (s *PublicTxPoolAPI) FeeHistogram(buckets []*hexutil.Big) (map[string]interface{}, error) {
+	if len(buckets) > maxFeeHistogramBuckets {
+		return nil, fmt.Errorf("too many buckets: %d > %d", len(buckets), maxFeeHistogramBuckets)
+	}
+	bounds := make([]*big.Int, len(buckets))
+	for i, bound := range buckets {
+		bounds[i] = bound.ToInt()
+		if bounds[i].Sign() <= 0 || (i > 0 && bounds[i].Cmp(bounds[i-1]) <= 0) {
+			return nil, fmt.Errorf("invalid bucket bound #%d: %d, the bounds must be positive and increasing", i, bounds[i])
+		}
+	}
+	histogram := s.b.TxPoolFeeHistogram(bounds, feeHistogramPercentiles)
+
+	marshalBucket := func(bucket core.TxFeeBucket) map[string]interface{} {
+		fields := map[string]interface{}{
+			"count": hexutil.Uint(bucket.Count),
+			"gas":   hexutil.Uint64(bucket.Gas),
+		}
+		if bucket.From != nil {
+			fields["from"] = (*hexutil.Big)(bucket.From)
+			fields["to"] = (*hexutil.Big)(bucket.To)
+		}
+		return fields
+	}
+	marshalBuckets := func(buckets []core.TxFeeBucket) []map[string]interface{} {
+		fields := make([]map[string]interface{}, len(buckets))
+		for i, bucket := range buckets {
+			fields[i] = marshalBucket(bucket)
+		}
+		return fields
+	}
+	marshalFees := func(fees []*big.Int) []*hexutil.Big {
+		if fees == nil {
+			return nil
+		}
+		fields := make([]*hexutil.Big, len(fees))
+		for i, fee := range fees {
+			fields[i] = (*hexutil.Big)(fee)
+		}
+		return fields
+	}
+	marshalDistribution := func(d core.TxFeeDistribution) map[string]interface{} {
+		return map[string]interface{}{
+			"effectiveTip":            marshalBuckets(d.EffectiveTips),
+			"maxFee":                  marshalBuckets(d.MaxFees),
+			"belowBaseFee":            marshalBucket(d.BelowBaseFee),
+			"effectiveTipPercentiles": marshalFees(d.EffectiveTipPercentiles),
+			"maxFeePercentiles":       marshalFees(d.MaxFeePercentiles),
+		}
+	}
+	return map[string]interface{}{
+		"baseFee":     (*hexutil.Big)(histogram.BaseFee),
+		"percentiles": feeHistogramPercentiles,
+		"pending":     marshalDistribution(histogram.Pending),
+		"queued":      marshalDistribution(histogram.Queued),
+	}, nil
+}
+
 // Inspect retrieves the content of the transaction pool and flattens it into an
 // easily inspectable list.
 func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
@@ -618,6 +805,9 @@ func (s *PublicBlockChainAPI) BlockNumber() hexutil.Uint64 {
 // given block number. The rpc.LatestBlockNumber and rpc.PendingBlockNumber meta
 // block numbers are also allowed.
 func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	if balance, _, ok := s.b.CachedAccount(ctx, blockNrOrHash, address); ok {
+		return (*hexutil.Big)(balance), nil
+	}
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if state == nil || err != nil {
 		return nil, err
@@ -626,9 +816,13 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 }
 
 // GetAssetBalance returns the amount of [assetID] for the given address in the state of the
-// given block number. The rpc.LatestBlockNumber, rpc.PendingBlockNumber, and
+// given block number, as returned by the native asset balance precompile. The balance of an
+// asset never held is zero. The rpc.LatestBlockNumber, rpc.PendingBlockNumber, and
 // rpc.AcceptedBlockNumber meta block numbers are also allowed.
 func (s *PublicBlockChainAPI) GetAssetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash, assetID ids.ID) (*hexutil.Big, error) {
+	if assetID == ids.Empty {
+		return nil, errors.New("invalid asset ID")
+	}
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if state == nil || err != nil {
 		return nil, err
@@ -736,10 +930,10 @@ func (s *PublicBlockChainAPI) GetHeaderByHash(ctx context.Context, hash common.H
 // * When blockNr is -2 the pending chain head is returned.
 // * When fullTx is true all transactions in the block are returned, otherwise
 //   only the transaction hash is returned.
-func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool, opts *BlockOptions) (map[string]interface{}, error) {
 	block, err := s.b.BlockByNumber(ctx, number)
 	if block != nil && err == nil {
-		response, err := s.rpcMarshalBlock(ctx, block, true, fullTx)
+		response, err := s.rpcMarshalBlock(ctx, block, true, fullTx, opts != nil && opts.AllowLarge)
 		// coreth has no notion of a pending block
 		// if err == nil && number == rpc.PendingBlockNumber {
 		// 	// Pending blocks need to nil out a few fields
@@ -754,14 +948,21 @@ func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, number rpc.B
 
 // GetBlockByHash returns the requested block. When fullTx is true all transactions in the block are returned in full
 // detail, otherwise only the transaction hash is returned.
-func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool, opts *BlockOptions) (map[string]interface{}, error) {
 	block, err := s.b.BlockByHash(ctx, hash)
 	if block != nil {
-		return s.rpcMarshalBlock(ctx, block, true, fullTx)
+		return s.rpcMarshalBlock(ctx, block, true, fullTx, opts != nil && opts.AllowLarge)
 	}
 	return nil, err
 }
 
+// BlockOptions are the optional settings of a block request.
+type BlockOptions struct {
+	// AllowLarge returns the block with full transactions even if they exceed
+	// the configured limits of the response.
+	AllowLarge bool `json:"allowLarge"`
+}
+
 // GetUncleByBlockNumberAndIndex returns the uncle block for the given block number and index.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error) {
 	block, err := s.b.BlockByNumber(ctx, blockNr)
@@ -772,7 +973,7 @@ func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context,
 			return nil, nil
 		}
 		block = types.NewBlockWithHeader(uncles[index])
-		return s.rpcMarshalBlock(ctx, block, false, false)
+		return s.rpcMarshalBlock(ctx, block, false, false, false)
 	}
 	return nil, err
 }
@@ -787,7 +988,7 @@ func (s *PublicBlockChainAPI) GetUncleByBlockHashAndIndex(ctx context.Context, b
 			return nil, nil
 		}
 		block = types.NewBlockWithHeader(uncles[index])
-		return s.rpcMarshalBlock(ctx, block, false, false)
+		return s.rpcMarshalBlock(ctx, block, false, false, false)
 	}
 	return nil, err
 }
@@ -887,12 +1088,35 @@ func (diff *StateOverride) Apply(state *state.StateDB) error {
 func DoCall(ctx context.Context, b Backend, args TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
 	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
-	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	state, header, err := callStateAndHeader(ctx, b, blockNrOrHash, overrides)
 	if state == nil || err != nil {
 		return nil, err
 	}
+
+	// Setup context so it may be cancelled the call has completed
+	// or, in case of unmetered gas, setup a context with a timeout.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// Make sure the context is cancelled when the call has completed
+	// this makes sure resources are cleaned up.
+	defer cancel()
+
+	return applyCall(ctx, b, args, state, header, timeout, globalGasCap)
+}
+
+// callStateAndHeader returns the state and header to execute calls on at
+// [blockNrOrHash], with [overrides] applied to the state.
+func callStateAndHeader(ctx context.Context, b Backend, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride) (*state.StateDB, *types.Header, error) {
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, nil, err
+	}
 	if err := overrides.Apply(state); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// If the request is for the pending block, override the block timestamp, number, and estimated
 	// base fee, so that the check runs as if it were run on a newly generated block.
@@ -907,23 +1131,16 @@ func DoCall(ctx context.Context, b Backend, args TransactionArgs, blockNrOrHash
 		header.Number = new(big.Int).Add(header.Number, big.NewInt(1))
 		estimatedBaseFee, err := b.EstimateBaseFee(ctx)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		header.BaseFee = estimatedBaseFee
 	}
+	return state, header, nil
+}
 
-	// Setup context so it may be cancelled the call has completed
-	// or, in case of unmetered gas, setup a context with a timeout.
-	var cancel context.CancelFunc
-	if timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, timeout)
-	} else {
-		ctx, cancel = context.WithCancel(ctx)
-	}
-	// Make sure the context is cancelled when the call has completed
-	// this makes sure resources are cleaned up.
-	defer cancel()
-
+// applyCall executes [args] on [state] in the context of [header]. The EVM is
+// cancelled when [ctx] is done.
+func applyCall(ctx context.Context, b Backend, args TransactionArgs, state *state.StateDB, header *types.Header, timeout time.Duration, globalGasCap uint64) (*core.ExecutionResult, error) {
 	// Get a new instance of the EVM.
 	msg, err := args.ToMessage(globalGasCap, header.BaseFee)
 	if err != nil {
@@ -1005,6 +1222,82 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args TransactionArgs, bl
 	return result.Return(), result.Err
 }
 
+// multicallMaxCalls is the maximum number of calls of a multicall.
+const multicallMaxCalls = 256
+
+// MulticallResult is the result of a call of a multicall.
+type MulticallResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Multicall executes each of the given calls independently on the state for
+// the given block number, as done by Call. The state is resolved once, and
+// each call is executed on its own copy of it, so that the state changes of a
+// call are not seen by the other calls. All calls are executed in the same
+// block context.
+//
+// The calls share the global gas cap, which bounds the sum of the gas used by
+// the calls, and the global timeout. A failing call does not fail the others,
+// its error is returned in its result.
+func (s *PublicBlockChainAPI) Multicall(ctx context.Context, calls []TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride) ([]MulticallResult, error) {
+	defer func(start time.Time) {
+		log.Debug("Executing EVM multicall finished", "calls", len(calls), "runtime", time.Since(start))
+	}(time.Now())
+
+	if len(calls) > multicallMaxCalls {
+		return nil, fmt.Errorf("too many calls: %d > %d", len(calls), multicallMaxCalls)
+	}
+	state, header, err := callStateAndHeader(ctx, s.b, blockNrOrHash, overrides)
+	if state == nil || err != nil {
+		return nil, err
+	}
+
+	timeout := s.b.RPCEVMTimeout()
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		gasCap  = s.b.RPCGasCap()
+		gasLeft = gasCap
+		results = make([]MulticallResult, len(calls))
+	)
+	for i, args := range calls {
+		if gasCap != 0 && gasLeft == 0 {
+			results[i].Error = fmt.Sprintf("gas cap exhausted (cap = %d)", gasCap)
+			continue
+		}
+		result, err := applyCall(ctx, s.b, args, state.Copy(), header, timeout, gasLeft)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if result != nil {
+			results[i].GasUsed = hexutil.Uint64(result.UsedGas)
+			if gasCap != 0 {
+				gasLeft -= result.UsedGas
+			}
+		}
+		switch {
+		case err != nil:
+			results[i].Error = err.Error()
+		case len(result.Revert()) > 0:
+			results[i].ReturnData = result.Revert()
+			results[i].Error = newRevertError(result).Error()
+		case result.Err != nil:
+			results[i].Error = result.Err.Error()
+		default:
+			results[i].ReturnData = result.Return()
+		}
+	}
+	return results, nil
+}
+
 func DoEstimateGas(ctx context.Context, b Backend, args TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
@@ -1281,7 +1574,14 @@ func (s *PublicBlockChainAPI) rpcMarshalHeader(ctx context.Context, header *type
 
 // rpcMarshalBlock uses the generalized output filler, then adds the total difficulty field, which requires
 // a `PublicBlockchainAPI`.
-func (s *PublicBlockChainAPI) rpcMarshalBlock(ctx context.Context, b *types.Block, inclTx bool, fullTx bool) (map[string]interface{}, error) {
+// If [fullTx] is set, the block is refused with a blockTooLargeError if its
+// transactions exceed the configured limits, unless [allowLarge] is set.
+func (s *PublicBlockChainAPI) rpcMarshalBlock(ctx context.Context, b *types.Block, inclTx bool, fullTx bool, allowLarge bool) (map[string]interface{}, error) {
+	if inclTx && fullTx && !allowLarge {
+		if err := checkFullBlockLimits(b, s.b.RPCFullBlockTxLimit(), s.b.RPCFullBlockSizeLimit()); err != nil {
+			return nil, err
+		}
+	}
 	fields, err := RPCMarshalBlock(b, inclTx, fullTx, s.b.ChainConfig())
 	if err != nil {
 		return nil, err
@@ -1294,6 +1594,27 @@ func (s *PublicBlockChainAPI) rpcMarshalBlock(ctx context.Context, b *types.Bloc
 	return fields, err
 }
 
+// checkFullBlockLimits returns a blockTooLargeError if [block] has more than
+// [txLimit] transactions or if their encoded size exceeds [sizeLimit], which
+// approximates the size of the response with full transactions without
+// marshaling it. Zero limits are not checked.
+func checkFullBlockLimits(block *types.Block, txLimit int, sizeLimit uint64) error {
+	txs := block.Transactions()
+	var size uint64
+	for _, tx := range txs {
+		size += uint64(tx.Size())
+	}
+	if (txLimit > 0 && len(txs) > txLimit) || (sizeLimit > 0 && size > sizeLimit) {
+		return &blockTooLargeError{
+			txs:       len(txs),
+			size:      size,
+			txLimit:   txLimit,
+			sizeLimit: sizeLimit,
+		}
+	}
+	return nil
+}
+
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
 	BlockHash        *common.Hash      `json:"blockHash"`
@@ -1315,6 +1636,7 @@ type RPCTransaction struct {
 	V                *hexutil.Big      `json:"v"`
 	R                *hexutil.Big      `json:"r"`
 	S                *hexutil.Big      `json:"s"`
+	YParity          *hexutil.Uint64   `json:"yParity,omitempty"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
@@ -1351,15 +1673,20 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
 		result.TransactionIndex = (*hexutil.Uint64)(&index)
 	}
-	switch tx.Type() {
-	case types.AccessListTxType:
+	if tx.Type() != types.LegacyTxType {
+		// Typed transactions always report their access list, even if empty,
+		// and the parity of their signature, which is their v value
 		al := tx.AccessList()
+		if al == nil {
+			al = types.AccessList{}
+		}
 		result.Accesses = &al
 		result.ChainID = (*hexutil.Big)(tx.ChainId())
+		yParity := hexutil.Uint64(v.Uint64())
+		result.YParity = &yParity
+	}
+	switch tx.Type() {
 	case types.DynamicFeeTxType:
-		al := tx.AccessList()
-		result.Accesses = &al
-		result.ChainID = (*hexutil.Big)(tx.ChainId())
 		result.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
 		result.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
 		// if the transaction has been mined, compute the effective gas price
@@ -1587,6 +1914,9 @@ func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, addr
 		}
 		return (*hexutil.Uint64)(&nonce), nil
 	}
+	if _, nonce, ok := s.b.CachedAccount(ctx, blockNrOrHash, address); ok {
+		return (*hexutil.Uint64)(&nonce), nil
+	}
 	// Resolve block number and use its state to ask for the nonce
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
 	if state == nil || err != nil {
@@ -1637,6 +1967,122 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByHash(ctx context.Context,
 	return tx.MarshalBinary()
 }
 
+// PendingTransactionOutlook tells how likely a pool transaction is to be
+// included soon.
+type PendingTransactionOutlook struct {
+	From  common.Address `json:"from"`
+	Nonce hexutil.Uint64 `json:"nonce"`
+	// NoncePosition is the number of pool transactions of the sender with a
+	// lower nonce. The transaction is not executable if a nonce gap blocks it.
+	NoncePosition hexutil.Uint `json:"noncePosition"`
+	Executable    bool         `json:"executable"`
+	// BaseFee is the estimated base fee of a block built now, and
+	// ForecastBaseFee the one of the block after the tentative block, both
+	// nil before Apricot Phase 3.
+	BaseFee               *hexutil.Big `json:"baseFee"`
+	ForecastBaseFee       *hexutil.Big `json:"forecastBaseFee"`
+	CoversBaseFee         bool         `json:"coversBaseFee"`
+	CoversForecastBaseFee bool         `json:"coversForecastBaseFee"`
+	// TipPercentile is the percentage of the other pending transactions with
+	// a lower effective tip at [BaseFee].
+	TipPercentile float64 `json:"tipPercentile"`
+	// Ahead is the number of transactions the block builder considers before
+	// this one, nil if it does not consider it for a block built now.
+	Ahead *hexutil.Uint `json:"ahead"`
+	// InTentativeBlock is set if the last block built by this node, not yet
+	// accepted, includes the transaction.
+	InTentativeBlock     bool         `json:"inTentativeBlock"`
+	TentativeBlockNumber *hexutil.Big `json:"tentativeBlockNumber"`
+}
+
+// GetPendingTransactionOutlook returns the position of a pool transaction in
+// the nonce queue of its sender and in the ordering of the block builder,
+// whether it pays the current and forecast base fees and whether the last
+// block built includes it. The pool is read in a single snapshot. Returns nil
+// if the transaction is not in the pool.
+func (s *PublicTransactionPoolAPI) GetPendingTransactionOutlook(ctx context.Context, hash common.Hash) (*PendingTransactionOutlook, error) {
+	snapshot := s.b.TxPoolSnapshot()
+	outlook, tx := findPendingOutlook(snapshot, hash)
+	if outlook == nil {
+		return nil, nil
+	}
+	baseFee, err := s.b.EstimateBaseFee(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head := s.b.CurrentHeader()
+	forecast := baseFee
+	tentative := s.b.LastBuiltBlock()
+	if tentative != nil && tentative.ParentHash() != head.Hash() {
+		// The block was built on a former head, it will not be accepted
+		tentative = nil
+	}
+	if tentative != nil {
+		outlook.TentativeBlockNumber = (*hexutil.Big)(tentative.Number())
+		outlook.InTentativeBlock = tentative.Transaction(hash) != nil
+		if tentative.BaseFee() != nil {
+			_, forecast, err = dummy.CalcBaseFee(s.b.ChainConfig(), tentative.Header(), tentative.Time())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	outlook.BaseFee = (*hexutil.Big)(baseFee)
+	outlook.ForecastBaseFee = (*hexutil.Big)(forecast)
+	outlook.CoversBaseFee = baseFee == nil || tx.GasFeeCapIntCmp(baseFee) >= 0
+	outlook.CoversForecastBaseFee = forecast == nil || tx.GasFeeCapIntCmp(forecast) >= 0
+
+	var (
+		tip           = tx.EffectiveGasTipValue(baseFee)
+		others, lower int
+	)
+	for _, txs := range snapshot.Pending {
+		for _, other := range txs {
+			if other.Hash() == hash {
+				continue
+			}
+			others++
+			if other.EffectiveGasTipValue(baseFee).Cmp(tip) < 0 {
+				lower++
+			}
+		}
+	}
+	outlook.TipPercentile = 100
+	if others > 0 {
+		outlook.TipPercentile = 100 * float64(lower) / float64(others)
+	}
+	for i, ordered := range s.b.CommitOrder(snapshot, baseFee) {
+		if ordered.Hash() == hash {
+			ahead := hexutil.Uint(i)
+			outlook.Ahead = &ahead
+			break
+		}
+	}
+	return outlook, nil
+}
+
+// findPendingOutlook returns the outlook of the nonce queue position of the
+// transaction [hash] of [snapshot], and the transaction, or nil if it is not
+// in the pool.
+func findPendingOutlook(snapshot *core.PendingSnapshot, hash common.Hash) (*PendingTransactionOutlook, *types.Transaction) {
+	for from, pending := range snapshot.Pending {
+		for i, tx := range pending {
+			if tx.Hash() == hash {
+				return &PendingTransactionOutlook{From: from, Nonce: hexutil.Uint64(tx.Nonce()), NoncePosition: hexutil.Uint(i), Executable: true}, tx
+			}
+		}
+	}
+	for from, queued := range snapshot.Queued {
+		for i, tx := range queued {
+			if tx.Hash() == hash {
+				position := len(snapshot.Pending[from]) + i
+				return &PendingTransactionOutlook{From: from, Nonce: hexutil.Uint64(tx.Nonce()), NoncePosition: hexutil.Uint(position)}, tx
+			}
+		}
+	}
+	return nil, nil
+}
+
 // GetTransactionReceipt returns the transaction receipt for the given transaction hash.
 func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
 	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
@@ -1718,26 +2164,42 @@ func (s *PublicTransactionPoolAPI) sign(addr common.Address, tx *types.Transacti
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
 func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, false, nil)
+}
+
+// submitTransaction is SubmitTransaction, skipping the fee guardrail if
+// [bypassGuardrail] is set. If [cond] is not nil, the transaction is
+// submitted with these conditions.
+func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction, bypassGuardrail bool, cond *types.TransactionConditional) (common.Hash, error) {
+	// Recover the sender first, so that transactions signed for another chain
+	// or with an invalid signature are not reported as fee failures.
+	from, err := checkTxSender(ctx, b, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
 	// If the transaction fee cap is already specified, ensure the
 	// fee of the given transaction is _reasonable_.
 	if err := checkTxFee(tx.GasPrice(), tx.Gas(), b.RPCTxFeeCap()); err != nil {
 		return common.Hash{}, err
 	}
+	if !bypassGuardrail {
+		if err := checkFeeGuardrail(ctx, b, tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
 	if !b.UnprotectedAllowed() && !tx.Protected() {
 		// Ensure only eip155 signed transactions are submitted if EIP155Required is set.
 		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
 	}
-	if err := b.SendTx(ctx, tx); err != nil {
-		return common.Hash{}, err
+	if cond != nil {
+		err = b.SendConditionalTx(ctx, tx, cond)
+	} else {
+		err = b.SendTx(ctx, tx)
 	}
-	// Print a log with full tx details for manual investigations and interventions
-	currentBlock := b.CurrentBlock()
-	signer := types.MakeSigner(b.ChainConfig(), currentBlock.Number(), new(big.Int).SetUint64(currentBlock.Time()))
-	from, err := types.Sender(signer, tx)
 	if err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, newTxPoolError(ctx, b, tx, err)
 	}
-
+	// Print a log with full tx details for manual investigations and interventions
 	if tx.To() == nil {
 		addr := crypto.CreateAddress(from, tx.Nonce())
 		log.Info("Submitted contract creation", "hash", tx.Hash().Hex(), "from", from, "nonce", tx.Nonce(), "contract", addr.Hex(), "value", tx.Value(), "type", tx.Type(), "gasFeeCap", tx.GasFeeCap(), "gasTipCap", tx.GasTipCap(), "gasPrice", tx.GasPrice())
@@ -1798,12 +2260,53 @@ func (s *PublicTransactionPoolAPI) FillTransaction(ctx context.Context, args Tra
 
 // SendRawTransaction will add the signed transaction to the transaction pool.
 // The sender is responsible for signing the transaction and using the correct nonce.
-func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input hexutil.Bytes) (common.Hash, error) {
+func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input hexutil.Bytes, opts *SendRawTransactionOptions) (hash common.Hash, err error) {
 	tx := new(types.Transaction)
+	defer func() { s.b.SubmissionAuditor().record(ctx, "eth_sendRawTransaction", input, tx, err) }()
 	if err := tx.UnmarshalBinary(input); err != nil {
+		tx = nil
+		return common.Hash{}, newTxDecodeError(ctx, s.b, err)
+	}
+	return submitTransaction(ctx, s.b, tx, opts != nil && opts.BypassFeeGuardrail, nil)
+}
+
+// maxConditionalCost is the maximum number of storage roots and slots the
+// conditions of a transaction can check.
+const maxConditionalCost = 1000
+
+// SendRawTransactionConditional adds the signed transaction to the
+// transaction pool if [cond] holds for the last accepted block and its state.
+// The conditions are checked again against each block the transaction is
+// considered for, and the transaction is left out of the blocks they do not
+// hold for. The transaction is not gossiped, so it is only included in the
+// blocks built by this node.
+func (s *PublicTransactionPoolAPI) SendRawTransactionConditional(ctx context.Context, input hexutil.Bytes, cond types.TransactionConditional) (hash common.Hash, err error) {
+	tx := new(types.Transaction)
+	defer func() { s.b.SubmissionAuditor().record(ctx, "eth_sendRawTransactionConditional", input, tx, err) }()
+	if err := tx.UnmarshalBinary(input); err != nil {
+		tx = nil
+		return common.Hash{}, newTxDecodeError(ctx, s.b, err)
+	}
+	if cost := cond.Cost(); cost > maxConditionalCost {
+		return common.Hash{}, newTxPoolError(ctx, s.b, tx, fmt.Errorf("%w: cost %d, maximum %d", errConditionalTooCostly, cost, maxConditionalCost))
+	}
+	block := s.b.LastAcceptedBlock()
+	statedb, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+	if err != nil {
 		return common.Hash{}, err
 	}
-	return SubmitTransaction(ctx, s.b, tx)
+	if err := core.CheckConditional(&cond, header, statedb); err != nil {
+		return common.Hash{}, newTxPoolError(ctx, s.b, tx, err)
+	}
+	return submitTransaction(ctx, s.b, tx, false, &cond)
+}
+
+// SendRawTransactionOptions are the optional settings of a single raw
+// transaction submission.
+type SendRawTransactionOptions struct {
+	// BypassFeeGuardrail skips the configured fee guardrail for this
+	// transaction. The global tx fee cap still applies.
+	BypassFeeGuardrail bool `json:"bypassFeeGuardrail"`
 }
 
 // Sign calculates an ECDSA signature for:
@@ -0,0 +1,295 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+	"github.com/zsmartex/coreth/trie"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the RPC encodings")
+
+// rpcTestTransactions returns a signed transaction of each supported type,
+// with their names.
+func rpcTestTransactions(t *testing.T) ([]string, []*types.Transaction) {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		chainID   = big.NewInt(43112)
+		to        = common.HexToAddress("0x0100000000000000000000000000000000000001")
+		assetID   = common.HexToHash("0x2f8e4b9b5ffb3ae3ec2bd1a2ddf2bd3166bd89ed5b48dbdc3374a2dc7ad2b4d6")
+		gasPrice  = big.NewInt(225_000_000_000)
+		assetCall = vm.PackNativeAssetCallInput(to, assetID, big.NewInt(1000), []byte{0xde, 0xad})
+	)
+	names := []string{"legacy-unprotected", "legacy-eip155", "access-list-native-asset-call", "access-list-empty", "dynamic-fee"}
+	unsigned := []struct {
+		signer types.Signer
+		data   types.TxData
+	}{
+		{types.HomesteadSigner{}, &types.LegacyTx{Nonce: 0, GasPrice: gasPrice, Gas: 21000, To: &to, Value: big.NewInt(1)}},
+		{types.NewEIP155Signer(chainID), &types.LegacyTx{Nonce: 1, GasPrice: gasPrice, Gas: 21000, To: &to, Value: big.NewInt(1)}},
+		{types.NewEIP2930Signer(chainID), &types.AccessListTx{
+			ChainID:  chainID,
+			Nonce:    2,
+			GasPrice: gasPrice,
+			Gas:      100000,
+			To:       &vm.NativeAssetCallAddr,
+			Data:     assetCall,
+			AccessList: types.AccessList{
+				{Address: vm.NativeAssetCallAddr, StorageKeys: []common.Hash{}},
+				{Address: to, StorageKeys: []common.Hash{common.HexToHash("0x01")}},
+			},
+		}},
+		{types.NewEIP2930Signer(chainID), &types.AccessListTx{ChainID: chainID, Nonce: 3, GasPrice: gasPrice, Gas: 21000, To: &to}},
+		{types.NewLondonSigner(chainID), &types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      4,
+			GasTipCap:  big.NewInt(2_000_000_000),
+			GasFeeCap:  gasPrice,
+			Gas:        21000,
+			To:         &to,
+			Value:      big.NewInt(1),
+			AccessList: types.AccessList{{Address: to, StorageKeys: []common.Hash{}}},
+		}},
+	}
+	txs := make([]*types.Transaction, len(unsigned))
+	for i, u := range unsigned {
+		txs[i], err = types.SignNewTx(key, u.signer, u.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return names, txs
+}
+
+// checkGolden compares the indented JSON encoding of [v] to the golden file
+// [name] in testdata, which is rewritten instead with -update.
+func checkGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	encoded, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded = append(encoded, '\n')
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, encoded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, golden) {
+		t.Fatalf("Encoding does not match %s:\n%s", path, encoded)
+	}
+}
+
+func TestRPCTransactionMarshaling(t *testing.T) {
+	names, txs := rpcTestTransactions(t)
+	config := params.TestChainConfig
+	header := &types.Header{
+		Number:     big.NewInt(10),
+		Difficulty: big.NewInt(1),
+		GasLimit:   8_000_000,
+		Time:       1_600_000_000,
+		BaseFee:    big.NewInt(25_000_000_000),
+	}
+	block := types.NewBlock(header, txs, nil, nil, trie.NewStackTrie(nil), nil, false)
+
+	mined := make(map[string]*RPCTransaction, len(txs))
+	pending := make(map[string]*RPCTransaction, len(txs))
+	for i, tx := range txs {
+		mined[names[i]] = newRPCTransactionFromBlockIndex(block, uint64(i), config)
+		pending[names[i]] = newRPCPendingTransaction(tx, block.Header(), block.BaseFee(), config)
+	}
+	checkGolden(t, "rpc_transactions_mined.json", mined)
+	checkGolden(t, "rpc_transactions_pending.json", pending)
+
+	fields, err := RPCMarshalBlock(block, true, true, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "rpc_block_full_txs.json", fields)
+
+	// The typed transactions expose their type, access list, chain ID and
+	// signature parity in every response
+	for i, tx := range txs {
+		for _, rpcTx := range []*RPCTransaction{mined[names[i]], pending[names[i]], fields["transactions"].([]interface{})[i].(*RPCTransaction)} {
+			encoded, err := json.Marshal(rpcTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded["type"] != hexutil.Uint64(tx.Type()).String() {
+				t.Fatalf("%s: expected type %d, found %v", names[i], tx.Type(), decoded["type"])
+			}
+			for _, field := range []string{"accessList", "chainId", "yParity"} {
+				if _, ok := decoded[field]; ok != (tx.Type() != types.LegacyTxType) {
+					t.Fatalf("%s: unexpected presence of %s: %t", names[i], field, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestTransactionArgsAccessList(t *testing.T) {
+	accessList := types.AccessList{
+		{Address: vm.NativeAssetCallAddr, StorageKeys: []common.Hash{}},
+		{Address: common.HexToAddress("0x0100000000000000000000000000000000000001"), StorageKeys: []common.Hash{common.HexToHash("0x01")}},
+	}
+	tests := []struct {
+		name    string
+		args    string
+		baseFee *big.Int
+	}{
+		{
+			name: "legacy gas price",
+			args: `{"from":"0x71562b71999873db5b286df957af199ec94617f7","to":"0x0100000000000000000000000000000000000002","gasPrice":"0x1","data":"0x0100000000000000000000000000000000000001","accessList":[{"address":"0x0100000000000000000000000000000000000002","storageKeys":[]},{"address":"0x0100000000000000000000000000000000000001","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000001"]}]}`,
+		},
+		{
+			name:    "dynamic fees",
+			args:    `{"to":"0x0100000000000000000000000000000000000002","maxFeePerGas":"0x2","maxPriorityFeePerGas":"0x1","input":"0x0100000000000000000000000000000000000001","accessList":[{"address":"0x0100000000000000000000000000000000000002","storageKeys":[]},{"address":"0x0100000000000000000000000000000000000001","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000001"]}]}`,
+			baseFee: big.NewInt(1),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var args TransactionArgs
+			if err := json.Unmarshal([]byte(test.args), &args); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := args.ToMessage(0, test.baseFee)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(msg.AccessList(), accessList) {
+				t.Fatalf("Expected access list %v, found %v", accessList, msg.AccessList())
+			}
+			if *msg.To() != vm.NativeAssetCallAddr {
+				t.Fatalf("Expected a call to %s, found %s", vm.NativeAssetCallAddr, msg.To())
+			}
+		})
+	}
+}
+
+// blockBackend serves [block] at any number or hash, with the limits of the
+// blocks returned with full transactions.
+type blockBackend struct {
+	Backend
+	block     *types.Block
+	txLimit   int
+	sizeLimit uint64
+}
+
+func (b *blockBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.block, nil
+}
+
+func (b *blockBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.block, nil
+}
+
+func (b *blockBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+func (b *blockBackend) RPCFullBlockTxLimit() int         { return b.txLimit }
+func (b *blockBackend) RPCFullBlockSizeLimit() uint64    { return b.sizeLimit }
+
+func TestGetBlockFullTxLimits(t *testing.T) {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainID)
+	txs := make([]*types.Transaction, 1000)
+	var size uint64
+	for i := range txs {
+		tx := types.NewTransaction(uint64(i), common.Address{0x01}, big.NewInt(1), 50_000, big.NewInt(225_000_000_000), make([]byte, 100))
+		if txs[i], err = types.SignTx(tx, signer, key); err != nil {
+			t.Fatal(err)
+		}
+		size += uint64(txs[i].Size())
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), GasLimit: 100_000_000}
+	block := types.NewBlock(header, txs, nil, nil, trie.NewStackTrie(nil), nil, false)
+
+	tests := map[string]struct {
+		txLimit   int
+		sizeLimit uint64
+		refused   bool
+	}{
+		"no limits":        {},
+		"within limits":    {txLimit: len(txs), sizeLimit: size},
+		"above tx limit":   {txLimit: len(txs) - 1, refused: true},
+		"above size limit": {sizeLimit: size - 1, refused: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := rpc.NewServer(0)
+			defer server.Stop()
+			backend := &blockBackend{block: block, txLimit: test.txLimit, sizeLimit: test.sizeLimit}
+			if err := server.RegisterName("eth", NewPublicBlockChainAPI(backend)); err != nil {
+				t.Fatal(err)
+			}
+			client := rpc.DialInProc(server)
+			defer client.Close()
+
+			// countTxs returns the number of transactions of the block returned
+			// by [method] with [args]
+			countTxs := func(method string, args ...interface{}) (int, error) {
+				var result struct {
+					Transactions []json.RawMessage `json:"transactions"`
+				}
+				err := client.Call(&result, method, args...)
+				return len(result.Transactions), err
+			}
+			for method, id := range map[string]interface{}{"eth_getBlockByNumber": "0x1", "eth_getBlockByHash": block.Hash()} {
+				n, err := countTxs(method, id, true)
+				var rpcErr rpc.Error
+				if test.refused != errors.As(err, &rpcErr) {
+					t.Fatalf("%s: expected refusal %t, found %v", method, test.refused, err)
+				}
+				if test.refused && rpcErr.ErrorCode() != blockTooLargeErrorCode {
+					t.Fatalf("%s: expected error code %d, found %d", method, blockTooLargeErrorCode, rpcErr.ErrorCode())
+				}
+				if !test.refused && n != len(txs) {
+					t.Fatalf("%s: expected %d txs, found %d", method, len(txs), n)
+				}
+
+				// Large responses can be allowed per request, and hash-only
+				// responses are unaffected
+				if n, err := countTxs(method, id, true, &BlockOptions{AllowLarge: true}); err != nil || n != len(txs) {
+					t.Fatalf("%s: expected %d txs with large responses allowed, found %d (%v)", method, len(txs), n, err)
+				}
+				if n, err := countTxs(method, id, false); err != nil || n != len(txs) {
+					t.Fatalf("%s: expected %d tx hashes, found %d (%v)", method, len(txs), n, err)
+				}
+			}
+		})
+	}
+}
@@ -53,14 +53,21 @@ type Backend interface {
 	EstimateBaseFee(ctx context.Context) (*big.Int, error)
 	SuggestPrice(ctx context.Context) (*big.Int, error)
 	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
-	FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error)
+	SuggestGasFees(ctx context.Context) (tipCap *big.Int, baseFee *big.Int, source string, sampledBlocks int, err error)
+	FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumberOrHash, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error)
+	FeeHistoryAggregate(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (oldestBlock *big.Int, blocks int, reward []*big.Int, nextBaseFee *big.Int, err error)
 	ChainDb() ethdb.Database
 	AccountManager() *accounts.Manager
 	ExtRPCEnabled() bool
-	RPCGasCap() uint64            // global gas cap for eth_call over rpc: DoS protection
-	RPCEVMTimeout() time.Duration // global timeout for eth_call over rpc: DoS protection
-	RPCTxFeeCap() float64         // global tx fee cap for all transaction related APIs
-	UnprotectedAllowed() bool     // allows only for EIP155 transactions.
+	RPCGasCap() uint64                     // global gas cap for eth_call over rpc: DoS protection
+	RPCEVMTimeout() time.Duration          // global timeout for eth_call over rpc: DoS protection
+	RPCTxFeeCap() float64                  // global tx fee cap for all transaction related APIs
+	RPCFeeCapMultiple() float64            // max fee per gas cap as a multiple of the base fee for local submissions
+	RPCFeeGuardrailCap() float64           // bypassable potential fee cap for local submissions
+	SubmissionAuditor() *SubmissionAuditor // audit log of the raw transaction submissions, nil if disabled
+	RPCFullBlockTxLimit() int              // bypassable tx count cap for blocks returned with full txs
+	RPCFullBlockSizeLimit() uint64         // bypassable tx size cap for blocks returned with full txs
+	UnprotectedAllowed() bool              // allows only for EIP155 transactions.
 
 	// Blockchain API
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
@@ -73,6 +80,7 @@ type Backend interface {
 	BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error)
 	StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error)
 	StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error)
+	CachedAccount(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, address common.Address) (*big.Int, uint64, bool)
 	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error)
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
@@ -81,13 +89,22 @@ type Backend interface {
 
 	// Transaction pool API
 	SendTx(ctx context.Context, signedTx *types.Transaction) error
+	SendConditionalTx(ctx context.Context, signedTx *types.Transaction, cond *types.TransactionConditional) error // conditions checked by the block builder
+	TxPoolPriceBump() uint64                                                                                      // minimum price bump percentage to replace a pool transaction
 	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
 	GetPoolTransactions() (types.Transactions, error)
 	GetPoolTransaction(txHash common.Hash) *types.Transaction
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
+	TxNetworkStats() *core.TxNetworkStats // nil if the propagation statistics are not tracked
+	TxPropagationEnabled() bool
+	TxPropagationStatus(hash common.Hash) *core.TxPropagationStatus // nil if the transaction is not tracked
+	TxPoolFeeHistogram(bounds []*big.Int, percentiles []float64) *core.TxFeeHistogram
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
 	TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions)
+	TxPoolSnapshot() *core.PendingSnapshot
+	CommitOrder(snapshot *core.PendingSnapshot, baseFee *big.Int) types.Transactions // block builder ordering of the executable transactions
+	LastBuiltBlock() *types.Block                                                    // nil if no block was built
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 
 	// Filter API
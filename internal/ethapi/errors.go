@@ -0,0 +1,323 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// Stable codes identifying why a transaction was rejected by the transaction
+// pool. They are returned in the data field of the JSON-RPC error, and must
+// never be renumbered.
+const (
+	txErrCodeAlreadyKnown            = 1
+	txErrCodeNonceTooLow             = 2
+	txErrCodeReplaceUnderpriced      = 3
+	txErrCodeUnderpriced             = 4
+	txErrCodeFeeCapTooLow            = 5
+	txErrCodeInsufficientFunds       = 6
+	txErrCodeIntrinsicGas            = 7
+	txErrCodeGasLimit                = 8
+	txErrCodeTxPoolOverflow          = 9
+	txErrCodeOversizedData           = 10
+	txErrCodeTxTypeNotSupported      = 11
+	txErrCodeTipAboveFeeCap          = 12
+	txErrCodeInvalidSender           = 13
+	txErrCodeNegativeValue           = 14
+	txErrCodeFeeCapVeryHigh          = 15
+	txErrCodeTipVeryHigh             = 16
+	txErrCodeNonceMax                = 17
+	txErrCodeInsufficientForTransfer = 18
+	txErrCodeFeeCapAboveGuardrail    = 19
+	txErrCodeFeeAboveGuardrail       = 20
+	txErrCodeMaxInitCodeSize         = 21
+	txErrCodeInvalidChainID          = 22
+	txErrCodeInvalidEncoding         = 23
+	txErrCodeTxPoolPressure          = 24
+	txErrCodeConditionNotMet         = 25
+	txErrCodeConditionalTooCostly    = 26
+	txErrCodeDynamicFeeTxRequired    = 27
+)
+
+var (
+	errFeeCapAboveGuardrail = errors.New("max fee per gas exceeds the fee guardrail")
+	errFeeAboveGuardrail    = errors.New("tx fee exceeds the fee guardrail")
+	errInvalidTxEncoding    = errors.New("invalid transaction encoding")
+	errConditionalTooCostly = errors.New("transaction conditions check too many storage slots")
+)
+
+// blockTooLargeErrorCode is the JSON-RPC error code of the blocks refused
+// with full transactions, the "limit exceeded" code of EIP-1474.
+const blockTooLargeErrorCode = -32005
+
+// blockTooLargeError is the error of the requests of blocks with full
+// transactions exceeding the configured limits of the response.
+type blockTooLargeError struct {
+	txs       int
+	size      uint64
+	txLimit   int
+	sizeLimit uint64
+}
+
+func (e *blockTooLargeError) Error() string {
+	return fmt.Sprintf("block too large to return with full transactions (%d txs of %d bytes), fetch its transactions separately or set allowLarge", e.txs, e.size)
+}
+
+func (e *blockTooLargeError) ErrorCode() int { return blockTooLargeErrorCode }
+
+// blockTooLargeErrorData describes the transactions of the refused block and
+// the limits they exceed, zero limits being disabled.
+type blockTooLargeErrorData struct {
+	Transactions hexutil.Uint64 `json:"transactions"`
+	Size         hexutil.Uint64 `json:"size"`
+	TxLimit      hexutil.Uint64 `json:"txLimit"`
+	SizeLimit    hexutil.Uint64 `json:"sizeLimit"`
+}
+
+func (e *blockTooLargeError) ErrorData() interface{} {
+	return &blockTooLargeErrorData{
+		Transactions: hexutil.Uint64(e.txs),
+		Size:         hexutil.Uint64(e.size),
+		TxLimit:      hexutil.Uint64(e.txLimit),
+		SizeLimit:    hexutil.Uint64(e.sizeLimit),
+	}
+}
+
+// txPoolErrorReasons maps the errors of the transaction pool to their code
+// and a machine readable reason.
+var txPoolErrorReasons = []struct {
+	err    error
+	code   int
+	reason string
+}{
+	{core.ErrAlreadyKnown, txErrCodeAlreadyKnown, "alreadyKnown"},
+	{core.ErrNonceTooLow, txErrCodeNonceTooLow, "nonceTooLow"},
+	{core.ErrReplaceUnderpriced, txErrCodeReplaceUnderpriced, "replacementUnderpriced"},
+	{core.ErrFeeCapTooLow, txErrCodeFeeCapTooLow, "feeCapTooLow"},
+	{core.ErrUnderpriced, txErrCodeUnderpriced, "underpriced"},
+	{core.ErrInsufficientFunds, txErrCodeInsufficientFunds, "insufficientFunds"},
+	{core.ErrInsufficientFundsForTransfer, txErrCodeInsufficientForTransfer, "insufficientFundsForTransfer"},
+	{core.ErrIntrinsicGas, txErrCodeIntrinsicGas, "intrinsicGas"},
+	{core.ErrGasLimit, txErrCodeGasLimit, "gasLimit"},
+	{core.ErrTxPoolOverflow, txErrCodeTxPoolOverflow, "txPoolOverflow"},
+	{core.ErrOversizedData, txErrCodeOversizedData, "oversizedData"},
+	{core.ErrTxTypeNotSupported, txErrCodeTxTypeNotSupported, "txTypeNotSupported"},
+	{core.ErrTipAboveFeeCap, txErrCodeTipAboveFeeCap, "tipAboveFeeCap"},
+	{types.ErrInvalidChainId, txErrCodeInvalidChainID, "invalidChainId"},
+	{core.ErrInvalidSender, txErrCodeInvalidSender, "invalidSender"},
+	{core.ErrNegativeValue, txErrCodeNegativeValue, "negativeValue"},
+	{core.ErrFeeCapVeryHigh, txErrCodeFeeCapVeryHigh, "feeCapVeryHigh"},
+	{core.ErrTipVeryHigh, txErrCodeTipVeryHigh, "tipVeryHigh"},
+	{core.ErrNonceMax, txErrCodeNonceMax, "nonceMax"},
+	{core.ErrMaxInitCodeSizeExceeded, txErrCodeMaxInitCodeSize, "maxInitCodeSizeExceeded"},
+	{core.ErrTxPoolPressure, txErrCodeTxPoolPressure, "txPoolPressure"},
+	{errFeeCapAboveGuardrail, txErrCodeFeeCapAboveGuardrail, "feeCapAboveGuardrail"},
+	{errFeeAboveGuardrail, txErrCodeFeeAboveGuardrail, "feeAboveGuardrail"},
+	{core.ErrConditionNotMet, txErrCodeConditionNotMet, "conditionNotMet"},
+	{errConditionalTooCostly, txErrCodeConditionalTooCostly, "conditionalTooCostly"},
+	{core.ErrDynamicFeeTxRequired, txErrCodeDynamicFeeTxRequired, "dynamicFeeTxRequired"},
+}
+
+// txPoolErrorData is the machine readable description of a transaction pool
+// rejection. Only the fields relevant to the rejection are set.
+type txPoolErrorData struct {
+	Code              int             `json:"code"`
+	Reason            string          `json:"reason"`
+	RequiredPriceBump *uint64         `json:"requiredPriceBump,omitempty"` // percentage
+	BaseFee           *hexutil.Big    `json:"baseFee,omitempty"`
+	GasFeeCap         *hexutil.Big    `json:"gasFeeCap,omitempty"`
+	RequiredGasTipCap *hexutil.Big    `json:"requiredGasTipCap,omitempty"` // minimum tip for the weight of the tx
+	Weight            *hexutil.Uint64 `json:"weight,omitempty"`            // bytes of calldata and access list
+	AccountNonce      *hexutil.Uint64 `json:"accountNonce,omitempty"`
+	TxNonce           *hexutil.Uint64 `json:"txNonce,omitempty"`
+	Balance           *hexutil.Big    `json:"balance,omitempty"`
+	Cost              *hexutil.Big    `json:"cost,omitempty"`
+	Fee               *hexutil.Big    `json:"fee,omitempty"`
+	Ceiling           *hexutil.Big    `json:"ceiling,omitempty"` // highest value allowed by the fee guardrail
+	ChainID           *hexutil.Big    `json:"chainId,omitempty"`
+	ExpectedChainID   *hexutil.Big    `json:"expectedChainId,omitempty"`
+	TxType            *hexutil.Uint64 `json:"txType,omitempty"`
+	RequiredFork      string          `json:"requiredFork,omitempty"`
+	ActivationTime    *hexutil.Uint64 `json:"activationTime,omitempty"` // timestamp of the upgrade rejecting the tx
+	RetryAfter        *hexutil.Uint64 `json:"retryAfter,omitempty"`     // seconds
+}
+
+// txPoolError is an API error that encompasses a transaction pool rejection,
+// or a rejection by the fee guardrail applied before the transaction pool.
+// The message of the underlying error is returned unchanged, while the
+// structured description is returned in the data field of the JSON-RPC error.
+type txPoolError struct {
+	error
+	data *txPoolErrorData
+}
+
+func (e *txPoolError) Unwrap() error {
+	return e.error
+}
+
+// ErrorData returns the code and the fields describing the rejection.
+func (e *txPoolError) ErrorData() interface{} {
+	return e.data
+}
+
+// newTxPoolError wraps [err], returned by the transaction pool when adding
+// [tx], into a txPoolError. Errors that do not originate from the
+// transaction pool are returned as is. [tx] is nil if it could not be decoded.
+func newTxPoolError(ctx context.Context, b Backend, tx *types.Transaction, err error) error {
+	var data *txPoolErrorData
+	for _, r := range txPoolErrorReasons {
+		if errors.Is(err, r.err) {
+			data = &txPoolErrorData{Code: r.code, Reason: r.reason}
+			break
+		}
+	}
+	if data == nil {
+		return err
+	}
+
+	switch data.Code {
+	case txErrCodeInvalidChainID:
+		data.ChainID = (*hexutil.Big)(tx.ChainId())
+		data.ExpectedChainID = (*hexutil.Big)(b.ChainConfig().ChainID)
+	case txErrCodeTxTypeNotSupported:
+		var typeErr *types.UnsupportedTxTypeError
+		if errors.As(err, &typeErr) {
+			txType := hexutil.Uint64(typeErr.Type)
+			data.TxType, data.RequiredFork = &txType, typeErr.Fork
+		}
+	case txErrCodeDynamicFeeTxRequired:
+		var requiredErr *core.DynamicFeeTxRequiredError
+		if errors.As(err, &requiredErr) {
+			txType, activation := hexutil.Uint64(requiredErr.Type), hexutil.Uint64(requiredErr.Activation)
+			data.TxType, data.ActivationTime = &txType, &activation
+		}
+	case txErrCodeTxPoolPressure:
+		var pressureErr *core.TxPoolPressureError
+		if errors.As(err, &pressureErr) {
+			retryAfter := hexutil.Uint64((pressureErr.RetryAfter + time.Second - 1) / time.Second)
+			data.RetryAfter = &retryAfter
+		}
+	case txErrCodeReplaceUnderpriced:
+		bump := b.TxPoolPriceBump()
+		data.RequiredPriceBump = &bump
+	case txErrCodeUnderpriced, txErrCodeFeeCapTooLow:
+		var floorErr *core.TxTipFloorError
+		if errors.As(err, &floorErr) {
+			weight := hexutil.Uint64(floorErr.Weight)
+			data.RequiredGasTipCap, data.Weight = (*hexutil.Big)(floorErr.Required), &weight
+		}
+		baseFee, estimateErr := b.EstimateBaseFee(ctx)
+		if estimateErr != nil || baseFee == nil {
+			break
+		}
+		data.BaseFee = (*hexutil.Big)(baseFee)
+		data.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		// The pool reports fee caps below its minimum fee as underpriced, but
+		// integrators need to tell apart a fee cap below the base fee.
+		if tx.GasFeeCapIntCmp(baseFee) < 0 {
+			data.Code, data.Reason = txErrCodeFeeCapTooLow, "feeCapTooLow"
+		}
+	case txErrCodeNonceTooLow, txErrCodeInsufficientFunds, txErrCodeInsufficientForTransfer:
+		from, senderErr := types.Sender(types.LatestSigner(b.ChainConfig()), tx)
+		if senderErr != nil {
+			break
+		}
+		statedb, _, stateErr := b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if stateErr != nil || statedb == nil {
+			break
+		}
+		if data.Code == txErrCodeNonceTooLow {
+			accountNonce, txNonce := hexutil.Uint64(statedb.GetNonce(from)), hexutil.Uint64(tx.Nonce())
+			data.AccountNonce, data.TxNonce = &accountNonce, &txNonce
+		} else {
+			data.Balance = (*hexutil.Big)(new(big.Int).Set(statedb.GetBalance(from)))
+			data.Cost = (*hexutil.Big)(tx.Cost())
+		}
+	}
+	return &txPoolError{error: err, data: data}
+}
+
+// newTxDecodeError wraps [err], returned when decoding a raw transaction, into
+// a txPoolError, telling apart well-formed transactions of an unsupported type
+// from malformed encodings.
+func newTxDecodeError(ctx context.Context, b Backend, err error) error {
+	if errors.Is(err, types.ErrTxTypeNotSupported) {
+		return newTxPoolError(ctx, b, nil, err)
+	}
+	return &txPoolError{
+		error: fmt.Errorf("%w: %v", errInvalidTxEncoding, err),
+		data:  &txPoolErrorData{Code: txErrCodeInvalidEncoding, Reason: "invalidEncoding"},
+	}
+}
+
+// checkTxSender recovers the sender of [tx], returning a txPoolError telling
+// apart transactions signed for another chain from invalid signatures.
+func checkTxSender(ctx context.Context, b Backend, tx *types.Transaction) (common.Address, error) {
+	chainID := b.ChainConfig().ChainID
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if errors.Is(err, types.ErrInvalidChainId) {
+		err = fmt.Errorf("%w: have %d, want %d", types.ErrInvalidChainId, tx.ChainId(), chainID)
+	} else if err != nil {
+		err = fmt.Errorf("%w: %v", core.ErrInvalidSender, err)
+	}
+	if err != nil {
+		return common.Address{}, newTxPoolError(ctx, b, tx, err)
+	}
+	return from, nil
+}
+
+// checkFeeGuardrail rejects [tx] if its max fee per gas exceeds the base fee
+// estimated by the gas price oracle by more than the configured multiple, or if
+// its potential fee exceeds the configured cap.
+func checkFeeGuardrail(ctx context.Context, b Backend, tx *types.Transaction) error {
+	if multiple := b.RPCFeeCapMultiple(); multiple > 0 {
+		baseFee, err := b.EstimateBaseFee(ctx)
+		if err != nil {
+			return err
+		}
+		// Before the base fee is enabled there is nothing to compare to.
+		if baseFee != nil {
+			ceiling, _ := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(multiple)).Int(nil)
+			if tx.GasFeeCapIntCmp(ceiling) > 0 {
+				return &txPoolError{
+					error: fmt.Errorf("%w: max fee per gas (%d) > %g x estimated base fee (%d)", errFeeCapAboveGuardrail, tx.GasFeeCap(), multiple, baseFee),
+					data: &txPoolErrorData{
+						Code:      txErrCodeFeeCapAboveGuardrail,
+						Reason:    "feeCapAboveGuardrail",
+						BaseFee:   (*hexutil.Big)(baseFee),
+						GasFeeCap: (*hexutil.Big)(tx.GasFeeCap()),
+						Ceiling:   (*hexutil.Big)(ceiling),
+					},
+				}
+			}
+		}
+	}
+	if feeCap := b.RPCFeeGuardrailCap(); feeCap > 0 {
+		fee := new(big.Int).Mul(tx.GasFeeCap(), new(big.Int).SetUint64(tx.Gas()))
+		ceiling, _ := new(big.Float).Mul(big.NewFloat(feeCap), new(big.Float).SetInt64(params.Ether)).Int(nil)
+		if fee.Cmp(ceiling) > 0 {
+			return &txPoolError{
+				error: fmt.Errorf("%w: tx fee (%d) > configured cap (%g ether)", errFeeAboveGuardrail, fee, feeCap),
+				data: &txPoolErrorData{
+					Code:    txErrCodeFeeAboveGuardrail,
+					Reason:  "feeAboveGuardrail",
+					Fee:     (*hexutil.Big)(fee),
+					Ceiling: (*hexutil.Big)(ceiling),
+				},
+			}
+		}
+	}
+	return nil
+}
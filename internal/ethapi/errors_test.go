@@ -0,0 +1,482 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// txErrorBackend implements the parts of Backend used to submit a
+// transaction, rejecting every transaction with [sendErr].
+type txErrorBackend struct {
+	Backend
+
+	sendErr     error
+	chainConfig *params.ChainConfig
+	baseFee     *big.Int
+	statedb     *state.StateDB
+	feeMultiple float64
+	feeCap      float64
+	auditor     *SubmissionAuditor
+}
+
+func (b *txErrorBackend) RPCTxFeeCap() float64        { return 0 }
+func (b *txErrorBackend) UnprotectedAllowed() bool    { return false }
+func (b *txErrorBackend) TxPoolPriceBump() uint64     { return 10 }
+func (b *txErrorBackend) RPCFeeCapMultiple() float64  { return b.feeMultiple }
+func (b *txErrorBackend) RPCFeeGuardrailCap() float64 { return b.feeCap }
+
+func (b *txErrorBackend) SubmissionAuditor() *SubmissionAuditor { return b.auditor }
+
+func (b *txErrorBackend) ChainConfig() *params.ChainConfig {
+	if b.chainConfig != nil {
+		return b.chainConfig
+	}
+	return params.TestChainConfig
+}
+
+func (b *txErrorBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{Number: common.Big1})
+}
+
+func (b *txErrorBackend) SendTx(ctx context.Context, tx *types.Transaction) error { return b.sendErr }
+
+func (b *txErrorBackend) EstimateBaseFee(ctx context.Context) (*big.Int, error) {
+	return b.baseFee, nil
+}
+
+func (b *txErrorBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	return b.statedb, &types.Header{Number: common.Big1}, nil
+}
+
+func TestSendRawTransactionErrorData(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.SetNonce(from, 5)
+	statedb.SetBalance(from, big.NewInt(1000))
+
+	signer := types.LatestSigner(params.TestChainConfig)
+	tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		Nonce:     3,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: big.NewInt(20 * params.GWei),
+		Gas:       21000,
+		To:        &common.Address{},
+		Value:     common.Big1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost := (*hexutil.Big)(tx.Cost()).String()
+
+	tests := []struct {
+		name    string
+		sendErr error
+		baseFee *big.Int
+		data    map[string]interface{}
+	}{
+		{
+			name:    "replacement underpriced",
+			sendErr: core.ErrReplaceUnderpriced,
+			data: map[string]interface{}{
+				"code":              float64(txErrCodeReplaceUnderpriced),
+				"reason":            "replacementUnderpriced",
+				"requiredPriceBump": float64(10),
+			},
+		},
+		{
+			name:    "dynamic fee tx required",
+			sendErr: &core.DynamicFeeTxRequiredError{Type: types.LegacyTxType, Activation: 1700000000},
+			data: map[string]interface{}{
+				"code":           float64(txErrCodeDynamicFeeTxRequired),
+				"reason":         "dynamicFeeTxRequired",
+				"txType":         "0x0",
+				"activationTime": "0x6553f100",
+			},
+		},
+		{
+			name:    "nonce too low",
+			sendErr: fmt.Errorf("%w: address %s current nonce (%d) > tx nonce (%d)", core.ErrNonceTooLow, from.Hex(), 5, 3),
+			data: map[string]interface{}{
+				"code":         float64(txErrCodeNonceTooLow),
+				"reason":       "nonceTooLow",
+				"accountNonce": "0x5",
+				"txNonce":      "0x3",
+			},
+		},
+		{
+			name:    "insufficient funds",
+			sendErr: fmt.Errorf("%w: address %s have (%d) want (%d)", core.ErrInsufficientFunds, from.Hex(), 1000, tx.Cost()),
+			data: map[string]interface{}{
+				"code":    float64(txErrCodeInsufficientFunds),
+				"reason":  "insufficientFunds",
+				"balance": "0x3e8",
+				"cost":    cost,
+			},
+		},
+		{
+			name:    "fee cap below base fee",
+			sendErr: fmt.Errorf("%w: address %s have gas fee cap (%d) < pool minimum fee cap (%d)", core.ErrUnderpriced, from.Hex(), tx.GasFeeCap(), big.NewInt(25*params.GWei)),
+			baseFee: big.NewInt(25 * params.GWei),
+			data: map[string]interface{}{
+				"code":      float64(txErrCodeFeeCapTooLow),
+				"reason":    "feeCapTooLow",
+				"baseFee":   "0x5d21dba00",
+				"gasFeeCap": "0x4a817c800",
+			},
+		},
+		{
+			name:    "underpriced above base fee",
+			sendErr: core.ErrUnderpriced,
+			baseFee: big.NewInt(10 * params.GWei),
+			data: map[string]interface{}{
+				"code":      float64(txErrCodeUnderpriced),
+				"reason":    "underpriced",
+				"baseFee":   "0x2540be400",
+				"gasFeeCap": "0x4a817c800",
+			},
+		},
+		{
+			name:    "tip below floor",
+			sendErr: &core.TxTipFloorError{Weight: 100000, Required: big.NewInt(2 * params.GWei), GasTipCap: tx.GasTipCap()},
+			baseFee: big.NewInt(10 * params.GWei),
+			data: map[string]interface{}{
+				"code":              float64(txErrCodeUnderpriced),
+				"reason":            "underpriced",
+				"baseFee":           "0x2540be400",
+				"gasFeeCap":         "0x4a817c800",
+				"requiredGasTipCap": "0x77359400",
+				"weight":            "0x186a0",
+			},
+		},
+		{
+			name:    "txpool pressure",
+			sendErr: &core.TxPoolPressureError{Pressure: 0.95, Threshold: 0.9, RetryAfter: 2500 * time.Millisecond},
+			data: map[string]interface{}{
+				"code":       float64(txErrCodeTxPoolPressure),
+				"reason":     "txPoolPressure",
+				"retryAfter": "0x3",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &txErrorBackend{sendErr: test.sendErr, baseFee: test.baseFee, statedb: statedb}
+			server := rpc.NewServer(0)
+			defer server.Stop()
+			if err := server.RegisterName("eth", NewPublicTransactionPoolAPI(b, new(AddrLocker))); err != nil {
+				t.Fatal(err)
+			}
+			client := rpc.DialInProc(server)
+			defer client.Close()
+
+			err := client.Call(nil, "eth_sendRawTransaction", hexutil.Bytes(input))
+			if err == nil {
+				t.Fatal("expected transaction to be rejected")
+			}
+			// The message must be unchanged for compatibility
+			if err.Error() != test.sendErr.Error() {
+				t.Fatalf("expected error message %q, found %q", test.sendErr.Error(), err.Error())
+			}
+			dataErr, ok := err.(rpc.DataError)
+			if !ok {
+				t.Fatalf("expected rpc.DataError, found %T", err)
+			}
+			data, ok := dataErr.ErrorData().(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected error data object, found %#v", dataErr.ErrorData())
+			}
+			if len(data) != len(test.data) {
+				t.Fatalf("expected error data %v, found %v", test.data, data)
+			}
+			for field, expected := range test.data {
+				if data[field] != expected {
+					t.Fatalf("expected %s to be %v, found %v", field, expected, data[field])
+				}
+			}
+		})
+	}
+}
+
+func TestSendRawTransactionUnknownError(t *testing.T) {
+	sendErr := errors.New("unexpected failure")
+	b := &txErrorBackend{sendErr: sendErr}
+	key, _ := crypto.GenerateKey()
+	tx, err := types.SignNewTx(key, types.LatestSigner(params.TestChainConfig), &types.LegacyTx{
+		Gas:      21000,
+		GasPrice: big.NewInt(params.GWei),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitTransaction(context.Background(), b, tx); err != sendErr {
+		t.Fatalf("expected %v to be returned unchanged, found %#v", sendErr, err)
+	}
+}
+
+func TestSendRawTransactionFeeGuardrail(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.LatestSigner(params.TestChainConfig)
+	signTx := func(gasFeeCap *big.Int) hexutil.Bytes {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   params.TestChainConfig.ChainID,
+			GasTipCap: common.Big1,
+			GasFeeCap: gasFeeCap,
+			Gas:       21000,
+			To:        &common.Address{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return input
+	}
+	ceiling := big.NewInt(50 * params.GWei)
+
+	tests := []struct {
+		name        string
+		gasFeeCap   *big.Int
+		feeMultiple float64
+		feeCap      float64
+		bypass      bool
+		data        map[string]interface{}
+	}{
+		{
+			name:        "disabled",
+			gasFeeCap:   big.NewInt(1000 * params.GWei),
+			feeMultiple: 0,
+		},
+		{
+			name:        "at multiple",
+			gasFeeCap:   ceiling,
+			feeMultiple: 2,
+		},
+		{
+			name:        "above multiple",
+			gasFeeCap:   new(big.Int).Add(ceiling, common.Big1),
+			feeMultiple: 2,
+			data: map[string]interface{}{
+				"code":      float64(txErrCodeFeeCapAboveGuardrail),
+				"reason":    "feeCapAboveGuardrail",
+				"baseFee":   "0x5d21dba00",
+				"gasFeeCap": "0xba43b7401",
+				"ceiling":   "0xba43b7400",
+			},
+		},
+		{
+			name:        "above multiple bypassed",
+			gasFeeCap:   new(big.Int).Add(ceiling, common.Big1),
+			feeMultiple: 2,
+			bypass:      true,
+		},
+		{
+			// 21000 gas at 50 gwei is 0.00105 AVAX
+			name:      "above fee cap",
+			gasFeeCap: ceiling,
+			feeCap:    0.001,
+			data: map[string]interface{}{
+				"code":    float64(txErrCodeFeeAboveGuardrail),
+				"reason":  "feeAboveGuardrail",
+				"fee":     "0x3baf82d03a000",
+				"ceiling": "0x38d7ea4c68000",
+			},
+		},
+		{
+			name:      "above fee cap bypassed",
+			gasFeeCap: ceiling,
+			feeCap:    0.001,
+			bypass:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &txErrorBackend{
+				baseFee:     big.NewInt(25 * params.GWei),
+				feeMultiple: test.feeMultiple,
+				feeCap:      test.feeCap,
+			}
+			server := rpc.NewServer(0)
+			defer server.Stop()
+			if err := server.RegisterName("eth", NewPublicTransactionPoolAPI(b, new(AddrLocker))); err != nil {
+				t.Fatal(err)
+			}
+			client := rpc.DialInProc(server)
+			defer client.Close()
+
+			var hash common.Hash
+			err := client.Call(&hash, "eth_sendRawTransaction", signTx(test.gasFeeCap), &SendRawTransactionOptions{BypassFeeGuardrail: test.bypass})
+			if test.data == nil {
+				if err != nil {
+					t.Fatalf("expected transaction to be accepted, found %v", err)
+				}
+				return
+			}
+			dataErr, ok := err.(rpc.DataError)
+			if !ok {
+				t.Fatalf("expected rpc.DataError, found %T (%v)", err, err)
+			}
+			data, ok := dataErr.ErrorData().(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected error data object, found %#v", dataErr.ErrorData())
+			}
+			if len(data) != len(test.data) {
+				t.Fatalf("expected error data %v, found %v", test.data, data)
+			}
+			for field, expected := range test.data {
+				if data[field] != expected {
+					t.Fatalf("expected %s to be %v, found %v", field, expected, data[field])
+				}
+			}
+		})
+	}
+}
+
+func TestSendRawTransactionValidationErrors(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	config := *params.TestChainConfig
+	config.ChainID = big.NewInt(43112)
+	signTx := func(chainID *big.Int) *types.Transaction {
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+			ChainID:   chainID,
+			GasTipCap: common.Big1,
+			GasFeeCap: big.NewInt(1000 * params.GWei),
+			Gas:       21000,
+			To:        &common.Address{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	encode := func(tx *types.Transaction) hexutil.Bytes {
+		input, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return input
+	}
+	// A signature with an invalid recovery id, on a tx whose fee is also
+	// above the guardrail
+	badSig := make([]byte, crypto.SignatureLength)
+	badSig[0], badSig[32], badSig[64] = 1, 1, 5
+	invalidSig, err := signTx(config.ChainID).WithSignature(types.LatestSignerForChainID(config.ChainID), badSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   hexutil.Bytes
+		message string
+		data    map[string]interface{}
+	}{
+		{
+			name:    "wrong chain id",
+			input:   encode(signTx(big.NewInt(1))),
+			message: "invalid chain id for signer: have 1, want 43112",
+			data: map[string]interface{}{
+				"code":            float64(txErrCodeInvalidChainID),
+				"reason":          "invalidChainId",
+				"chainId":         "0x1",
+				"expectedChainId": "0xa868",
+			},
+		},
+		{
+			name:    "blob tx",
+			input:   hexutil.Bytes{0x03, 0xc0},
+			message: "transaction type not supported: type 0x03 requires Cancun (EIP-4844 blob transactions)",
+			data: map[string]interface{}{
+				"code":         float64(txErrCodeTxTypeNotSupported),
+				"reason":       "txTypeNotSupported",
+				"txType":       "0x3",
+				"requiredFork": "Cancun (EIP-4844 blob transactions)",
+			},
+		},
+		{
+			name:    "malformed rlp",
+			input:   hexutil.Bytes{0xf8, 0x01},
+			message: "invalid transaction encoding: rlp: non-canonical size information for types.LegacyTx",
+			data: map[string]interface{}{
+				"code":   float64(txErrCodeInvalidEncoding),
+				"reason": "invalidEncoding",
+			},
+		},
+		{
+			name:    "invalid signature",
+			input:   encode(invalidSig),
+			message: "invalid sender: invalid transaction v, r, s values",
+			data: map[string]interface{}{
+				"code":   float64(txErrCodeInvalidSender),
+				"reason": "invalidSender",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &txErrorBackend{
+				chainConfig: &config,
+				baseFee:     big.NewInt(25 * params.GWei),
+				feeMultiple: 2,
+			}
+			server := rpc.NewServer(0)
+			defer server.Stop()
+			if err := server.RegisterName("eth", NewPublicTransactionPoolAPI(b, new(AddrLocker))); err != nil {
+				t.Fatal(err)
+			}
+			client := rpc.DialInProc(server)
+			defer client.Close()
+
+			err := client.Call(nil, "eth_sendRawTransaction", test.input)
+			if err == nil {
+				t.Fatal("expected transaction to be rejected")
+			}
+			if err.Error() != test.message {
+				t.Fatalf("expected error message %q, found %q", test.message, err.Error())
+			}
+			dataErr, ok := err.(rpc.DataError)
+			if !ok {
+				t.Fatalf("expected rpc.DataError, found %T", err)
+			}
+			data, ok := dataErr.ErrorData().(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected error data object, found %#v", dataErr.ErrorData())
+			}
+			if len(data) != len(test.data) {
+				t.Fatalf("expected error data %v, found %v", test.data, data)
+			}
+			for field, expected := range test.data {
+				if data[field] != expected {
+					t.Fatalf("expected %s to be %v, found %v", field, expected, data[field])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ethapi
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+const (
+	submissionAccepted = "accepted"
+	submissionRejected = "rejected"
+)
+
+// SubmissionAuditConfig configures the audit log of the raw transaction
+// submissions.
+type SubmissionAuditConfig struct {
+	// File is the path of the audit log, written as JSON lines. If empty, the
+	// records are written to the structured logger "submission-audit".
+	File string
+	// MaxFileSize is the size in bytes above which [File] is rotated, keeping
+	// the last [MaxFiles] rotated files. Zero disables the rotation.
+	MaxFileSize int64
+	MaxFiles    int
+	// SampleRate is the fraction of the submissions recorded, in (0, 1]. The
+	// sampling is decided by the hash of the submission, so that a
+	// transaction submitted again is sampled the same.
+	SampleRate float64
+}
+
+// SubmissionRecord is the audit record of a raw transaction submission. The
+// payload of the transaction is redacted, only its size is recorded.
+type SubmissionRecord struct {
+	Time         time.Time       `json:"time"`
+	Method       string          `json:"method"`
+	Transport    string          `json:"transport,omitempty"`
+	RemoteAddr   string          `json:"remoteAddr,omitempty"`
+	ForwardedFor string          `json:"forwardedFor,omitempty"`
+	Hash         common.Hash     `json:"hash"`
+	From         *common.Address `json:"from,omitempty"`
+	To           *common.Address `json:"to,omitempty"`
+	Nonce        *hexutil.Uint64 `json:"nonce,omitempty"`
+	Type         *hexutil.Uint64 `json:"type,omitempty"`
+	Gas          *hexutil.Uint64 `json:"gas,omitempty"`
+	GasPrice     *hexutil.Big    `json:"gasPrice,omitempty"`
+	GasFeeCap    *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	GasTipCap    *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	DataSize     hexutil.Uint64  `json:"dataSize"`
+	Outcome      string          `json:"outcome"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// SubmissionAuditor records the raw transaction submissions served by the
+// API, with the client that submitted them. Transactions received by gossip
+// are not recorded.
+type SubmissionAuditor struct {
+	config SubmissionAuditConfig
+	logger log.Logger
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewSubmissionAuditor returns an auditor writing the records as set by
+// [config].
+func NewSubmissionAuditor(config SubmissionAuditConfig) (*SubmissionAuditor, error) {
+	a := &SubmissionAuditor{
+		config: config,
+		logger: log.New("logger", "submission-audit"),
+	}
+	if config.File == "" {
+		return a, nil
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// open opens the audit log for appending.
+func (a *SubmissionAuditor) open() error {
+	file, err := os.OpenFile(a.config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open the submission audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// Close closes the audit log.
+func (a *SubmissionAuditor) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.file.Close()
+}
+
+// record records the submission of [input] with [method] by the client of
+// [ctx], decoded as [tx], if it is sampled. [tx] is nil if [input] failed to
+// decode, and [err] is the error the submission failed with.
+func (a *SubmissionAuditor) record(ctx context.Context, method string, input hexutil.Bytes, tx *types.Transaction, err error) {
+	if a == nil {
+		return
+	}
+	hash := crypto.Keccak256Hash(input)
+	if !a.sampled(hash) {
+		return
+	}
+	info := rpc.PeerInfoFromContext(ctx)
+	record := &SubmissionRecord{
+		Time:         time.Now().UTC(),
+		Method:       method,
+		Transport:    info.Transport,
+		RemoteAddr:   info.RemoteAddr,
+		ForwardedFor: info.HTTP.ForwardedFor,
+		Hash:         hash,
+		Outcome:      submissionAccepted,
+	}
+	if err != nil {
+		record.Outcome, record.Error = submissionRejected, err.Error()
+	}
+	if tx != nil {
+		nonce, txType, gas := hexutil.Uint64(tx.Nonce()), hexutil.Uint64(tx.Type()), hexutil.Uint64(tx.Gas())
+		record.To, record.Nonce, record.Type, record.Gas = tx.To(), &nonce, &txType, &gas
+		record.DataSize = hexutil.Uint64(len(tx.Data()))
+		if tx.Type() == types.LegacyTxType || tx.Type() == types.AccessListTxType {
+			record.GasPrice = (*hexutil.Big)(tx.GasPrice())
+		} else {
+			record.GasFeeCap, record.GasTipCap = (*hexutil.Big)(tx.GasFeeCap()), (*hexutil.Big)(tx.GasTipCap())
+		}
+		if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+			record.From = &from
+		}
+	}
+	if err := a.write(record); err != nil {
+		log.Warn("Failed to write the submission audit record", "hash", hash, "err", err)
+	}
+}
+
+// sampled returns whether the submission with [hash] is recorded.
+func (a *SubmissionAuditor) sampled(hash common.Hash) bool {
+	if a.config.SampleRate >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(hash[:8])) < a.config.SampleRate*math.MaxUint64
+}
+
+// write writes [record] to the audit log, rotating it if it is too large.
+func (a *SubmissionAuditor) write(record *SubmissionRecord) error {
+	if a.file == nil {
+		a.logger.Info("Transaction submission", "method", record.Method, "transport", record.Transport, "remoteAddr", record.RemoteAddr, "forwardedFor", record.ForwardedFor,
+			"hash", record.Hash, "from", record.From, "to", record.To, "nonce", record.Nonce, "type", record.Type, "gas", record.Gas,
+			"gasPrice", record.GasPrice, "gasFeeCap", record.GasFeeCap, "gasTipCap", record.GasTipCap, "dataSize", record.DataSize,
+			"outcome", record.Outcome, "err", record.Error)
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.config.MaxFileSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.config.MaxFileSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// rotate renames the audit log to [File].1, shifting the rotated files and
+// removing the oldest in excess of [MaxFiles], and opens a new audit log.
+func (a *SubmissionAuditor) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	path := a.config.File
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, a.config.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := a.config.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if a.config.MaxFiles > 0 {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(path); err != nil {
+		return err
+	}
+	return a.open()
+}
@@ -0,0 +1,184 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package ethapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// readSubmissionRecords returns the records written to the audit log [path].
+func readSubmissionRecords(t *testing.T, path string) []*SubmissionRecord {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []*SubmissionRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := new(SubmissionRecord)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// TestSubmissionAudit submits an accepted, a rejected and an undecodable raw
+// transaction over HTTP and checks their records, without their payload.
+func TestSubmissionAudit(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	payload := bytes.Repeat([]byte{0xab}, 64)
+	signer := types.LatestSigner(params.TestChainConfig)
+	tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+		ChainID:   params.TestChainConfig.ChainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: big.NewInt(20 * params.GWei),
+		Gas:       50000,
+		To:        &common.Address{1},
+		Data:      payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "submissions.log")
+	auditor, err := NewSubmissionAuditor(SubmissionAuditConfig{File: path, SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditor.Close()
+	b := &txErrorBackend{auditor: auditor}
+	server := rpc.NewServer(0)
+	defer server.Stop()
+	if err := server.RegisterName("eth", NewPublicTransactionPoolAPI(b, new(AddrLocker))); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, err := rpc.DialHTTP(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetHeader("X-Forwarded-For", "203.0.113.7")
+
+	if err := client.Call(nil, "eth_sendRawTransaction", hexutil.Bytes(input)); err != nil {
+		t.Fatal(err)
+	}
+	b.sendErr = core.ErrNonceTooLow
+	if err := client.Call(nil, "eth_sendRawTransaction", hexutil.Bytes(input)); err == nil {
+		t.Fatal("Expected the transaction to be rejected")
+	}
+	if err := client.Call(nil, "eth_sendRawTransaction", hexutil.Bytes{0x01, 0x02}); err == nil {
+		t.Fatal("Expected the undecodable transaction to be rejected")
+	}
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob, []byte(fmt.Sprintf("%x", payload))) {
+		t.Fatal("Expected the payload of the transactions to be redacted")
+	}
+	records := readSubmissionRecords(t, path)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, found %d", len(records))
+	}
+	for i, outcome := range []string{submissionAccepted, submissionRejected} {
+		record := records[i]
+		if record.Outcome != outcome || record.Method != "eth_sendRawTransaction" || record.Hash != tx.Hash() {
+			t.Fatalf("Expected the %s submission of %s, found %+v", outcome, tx.Hash(), record)
+		}
+		if record.Transport != "http" || record.RemoteAddr == "" || record.ForwardedFor != "203.0.113.7" {
+			t.Fatalf("Expected the HTTP client forwarded for 203.0.113.7, found %+v", record)
+		}
+		if record.From == nil || *record.From != from || record.Nonce == nil || uint64(*record.Nonce) != 7 {
+			t.Fatalf("Expected the sender %s and the nonce 7, found %+v", from.Hex(), record)
+		}
+		if record.GasFeeCap.ToInt().Cmp(tx.GasFeeCap()) != 0 || record.GasTipCap.ToInt().Cmp(tx.GasTipCap()) != 0 || uint64(record.DataSize) != uint64(len(payload)) {
+			t.Fatalf("Expected the fee fields and the data size of %s, found %+v", tx.Hash(), record)
+		}
+	}
+	if records[1].Error == "" {
+		t.Fatalf("Expected the error of the rejected submission, found %+v", records[1])
+	}
+	if undecodable := records[2]; undecodable.Outcome != submissionRejected || undecodable.From != nil || undecodable.Hash != crypto.Keccak256Hash([]byte{0x01, 0x02}) {
+		t.Fatalf("Expected the rejected undecodable submission, found %+v", undecodable)
+	}
+}
+
+// TestSubmissionAuditRotation checks that the audit log is rotated above its
+// maximum size, keeping the configured number of rotated files.
+func TestSubmissionAuditRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.log")
+	auditor, err := NewSubmissionAuditor(SubmissionAuditConfig{File: path, MaxFileSize: 1, MaxFiles: 2, SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditor.Close()
+
+	for i := byte(0); i < 4; i++ {
+		auditor.record(context.Background(), "eth_sendRawTransaction", hexutil.Bytes{i}, nil, nil)
+	}
+	// Each record is written to a new file
+	for i, suffix := range []string{"", ".1", ".2"} {
+		records := readSubmissionRecords(t, path+suffix)
+		if expected := crypto.Keccak256Hash([]byte{byte(3 - i)}); len(records) != 1 || records[0].Hash != expected {
+			t.Fatalf("Expected %s to hold the record of %s, found %+v", path+suffix, expected, records)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the oldest rotated file to be removed, found %v", err)
+	}
+}
+
+// TestSubmissionAuditSampling checks that the sampling of a submission is
+// decided by its hash.
+func TestSubmissionAuditSampling(t *testing.T) {
+	auditor := &SubmissionAuditor{config: SubmissionAuditConfig{SampleRate: 0.5}}
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		hash := crypto.Keccak256Hash([]byte{byte(i), byte(i >> 8)})
+		if auditor.sampled(hash) != auditor.sampled(hash) {
+			t.Fatal("Expected the sampling of a submission to be deterministic")
+		}
+		if auditor.sampled(hash) {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Fatalf("Expected about half of the submissions to be sampled, found %d", sampled)
+	}
+}
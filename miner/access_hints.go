@@ -0,0 +1,221 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package miner
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+const (
+	// accessHintsHotKeys is the number of distinct accounts and storage slots
+	// above which the execution of a tx is hot, and its accesses recorded.
+	accessHintsHotKeys = 16
+
+	// accessHintsKeyLimit is the maximum number of keys recorded for a tx,
+	// the ones it accessed the most.
+	accessHintsKeyLimit = 256
+
+	// accessHintsTxLimit is the maximum number of txs of a sender whose
+	// accesses are recorded.
+	accessHintsTxLimit = 16
+
+	// accessHintsWarmupTimeout is the maximum duration of the warm-up of the
+	// keys of the txs of a block being built.
+	accessHintsWarmupTimeout = 100 * time.Millisecond
+)
+
+var (
+	accessHintsRecordedMeter    = metrics.NewRegisteredMeter("miner/accesshints/recorded", nil)
+	accessHintsInvalidatedMeter = metrics.NewRegisteredMeter("miner/accesshints/invalidated", nil)
+	accessHintsWarmedMeter      = metrics.NewRegisteredMeter("miner/accesshints/warmed", nil)
+)
+
+// accessHint is the state accessed by the execution of a tx.
+type accessHint struct {
+	keys []state.StateKey
+	// accounts are the hashes of the accounts of [keys], whose modification
+	// by an accepted block invalidates the hint
+	accounts map[common.Hash]struct{}
+}
+
+// accessHints records the state accessed by the txs failing or running hot
+// when a block is built, so that the next blocks built with them warm it up
+// before executing them. The hints never change the txs, and are dropped once
+// an accepted block modifies one of the accounts they access.
+type accessHints struct {
+	lock sync.Mutex
+	// [senders] holds the hints of each sender, by tx hash
+	senders *lru.Cache
+	// [synced] is the last accepted block whose modifications invalidated
+	// the hints
+	synced common.Hash
+}
+
+// newAccessHints returns the hints of the txs of up to [limit] senders, or
+// nil if [limit] is zero.
+func newAccessHints(limit int) *accessHints {
+	if limit <= 0 {
+		return nil
+	}
+	senders, _ := lru.New(limit)
+	return &accessHints{senders: senders}
+}
+
+// record keeps the [keys] accessed by the tx [hash] of [sender].
+func (h *accessHints) record(sender common.Address, hash common.Hash, keys []state.StateKey) {
+	hint := &accessHint{keys: keys, accounts: make(map[common.Hash]struct{})}
+	for _, key := range keys {
+		hint.accounts[crypto.Keccak256Hash(key.Address[:])] = struct{}{}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var txs map[common.Hash]*accessHint
+	if cached, ok := h.senders.Get(sender); ok {
+		txs = cached.(map[common.Hash]*accessHint)
+	} else {
+		txs = make(map[common.Hash]*accessHint)
+		h.senders.Add(sender, txs)
+	}
+	if _, ok := txs[hash]; !ok && len(txs) >= accessHintsTxLimit {
+		return
+	}
+	txs[hash] = hint
+	accessHintsRecordedMeter.Mark(1)
+}
+
+// keys returns the keys accessed by the hinted txs of [groups], each once.
+func (h *accessHints) keys(groups ...map[common.Address]types.Transactions) []state.StateKey {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var (
+		keys []state.StateKey
+		seen = make(map[state.StateKey]struct{})
+	)
+	for _, group := range groups {
+		for sender, txs := range group {
+			cached, ok := h.senders.Peek(sender)
+			if !ok {
+				continue
+			}
+			hints := cached.(map[common.Hash]*accessHint)
+			for _, tx := range txs {
+				hint, ok := hints[tx.Hash()]
+				if !ok {
+					continue
+				}
+				for _, key := range hint.keys {
+					if _, ok := seen[key]; !ok {
+						seen[key] = struct{}{}
+						keys = append(keys, key)
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// invalidate drops the hints accessing one of the [touched] accounts, by
+// hash. Assumes [lock] is held.
+func (h *accessHints) invalidate(touched []common.Hash) {
+	for _, sender := range h.senders.Keys() {
+		cached, ok := h.senders.Peek(sender)
+		if !ok {
+			continue
+		}
+		hints := cached.(map[common.Hash]*accessHint)
+		for hash, hint := range hints {
+			for _, account := range touched {
+				if _, ok := hint.accounts[account]; ok {
+					delete(hints, hash)
+					accessHintsInvalidatedMeter.Mark(1)
+					break
+				}
+			}
+		}
+		if len(hints) == 0 {
+			h.senders.Remove(sender)
+		}
+	}
+}
+
+// sync invalidates the hints accessing the accounts modified by the blocks
+// accepted by [chain] since the last call. All the hints are dropped if these
+// accounts are not known.
+func (h *accessHints) sync(chain *core.BlockChain) {
+	lastAccepted := chain.CurrentHeader()
+	if block := chain.LastAcceptedBlock(); block != nil {
+		lastAccepted = block.Header()
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	defer func() { h.synced = lastAccepted.Hash() }()
+	if h.synced == lastAccepted.Hash() || h.senders.Len() == 0 {
+		return
+	}
+	var touched []common.Hash
+	for header := lastAccepted; header.Hash() != h.synced; {
+		accounts, ok := chain.AcceptedAccounts(header.Hash())
+		if !ok || header.Number.Uint64() == 0 {
+			header = nil
+		} else {
+			header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		}
+		if header == nil {
+			accessHintsInvalidatedMeter.Mark(int64(h.senders.Len()))
+			h.senders.Purge()
+			return
+		}
+		touched = append(touched, accounts...)
+	}
+	h.invalidate(touched)
+}
+
+// startWarmup warms up the state caches with the keys accessed by the hinted
+// txs of [groups], reading a copy of [statedb] in the background until the
+// returned function is called or the warm-up times out.
+func (w *worker) startWarmup(statedb *state.StateDB, groups ...map[common.Address]types.Transactions) func() {
+	if w.accessHints == nil {
+		return func() {}
+	}
+	w.accessHints.sync(w.chain)
+	keys := w.accessHints.keys(groups...)
+	if len(keys) == 0 {
+		return func() {}
+	}
+	var (
+		throwaway = statedb.Copy()
+		deadline  = time.Now().Add(accessHintsWarmupTimeout)
+		interrupt uint32
+	)
+	go func() {
+		accessHintsWarmedMeter.Mark(int64(w.chain.Prefetcher().PrefetchKeys(keys, throwaway, deadline, &interrupt)))
+	}()
+	return func() { atomic.StoreUint32(&interrupt, 1) }
+}
+
+// recordAccesses records the accesses of the execution of [tx] by [from] on
+// [statedb], tracked since it started, if it failed or ran hot.
+func (w *worker) recordAccesses(statedb *state.StateDB, from common.Address, tx *types.Transaction, receipt *types.Receipt) {
+	keys := statedb.TopAccesses(accessHintsKeyLimit)
+	if receipt.Status == types.ReceiptStatusFailed || len(keys) >= accessHintsHotKeys {
+		w.accessHints.record(from, tx.Hash(), keys)
+	}
+}
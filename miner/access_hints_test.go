@@ -0,0 +1,47 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+func TestAccessHintsInvalidate(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x01")
+		contract = common.HexToAddress("0x02")
+		other    = common.HexToAddress("0x03")
+		txA      = types.NewTransaction(0, contract, common.Big0, 100000, big.NewInt(1), nil)
+		txB      = types.NewTransaction(1, other, common.Big0, 100000, big.NewInt(1), nil)
+		group    = map[common.Address]types.Transactions{sender: {txA, txB}}
+		slot     = state.StateKey{Address: contract, Slot: common.HexToHash("0x01"), IsSlot: true}
+	)
+	hints := newAccessHints(1)
+	hints.record(sender, txA.Hash(), []state.StateKey{{Address: contract}, slot})
+	hints.record(sender, txB.Hash(), []state.StateKey{{Address: other}, slot})
+
+	// The keys shared by the txs are warmed once
+	if keys := hints.keys(group); len(keys) != 3 {
+		t.Fatalf("Expected 3 keys, found %v", keys)
+	}
+
+	// The accepted modification of [other] only drops the hint of [txB]
+	hints.invalidate([]common.Hash{crypto.Keccak256Hash(other[:])})
+	if keys := hints.keys(group); len(keys) != 2 || keys[0] != (state.StateKey{Address: contract}) || keys[1] != slot {
+		t.Fatalf("Expected the keys of the first tx, found %v", keys)
+	}
+
+	// The sender is dropped with its last hint
+	hints.invalidate([]common.Hash{crypto.Keccak256Hash(contract[:])})
+	if keys := hints.keys(group); len(keys) != 0 || hints.senders.Len() != 0 {
+		t.Fatalf("Expected no hints left, found %v", keys)
+	}
+}
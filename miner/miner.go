@@ -28,6 +28,8 @@
 package miner
 
 import (
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/zsmartex/avalanchego/utils/timer/mockable"
@@ -46,6 +48,20 @@ type Backend interface {
 // Config is the configuration parameters of mining.
 type Config struct {
 	Etherbase common.Address `toml:",omitempty"` // Public address for block mining rewards (default = first account)
+
+	// Gas of each block reserved for the transactions of the privileged
+	// senders of the tx pool, which are committed first. It is a building
+	// policy only, the blocks of other nodes are not required to follow it.
+	PrivilegedGas uint64 `toml:",omitempty"`
+
+	// Number of senders whose transactions failing or running hot when a
+	// block is built have their accesses recorded, so that the next blocks
+	// built with them warm these accesses up first (0 disables the hints).
+	AccessHintsSenders int `toml:",omitempty"`
+
+	// Order of the transactions paying the same tip. Given the same pending
+	// transactions, the blocks built are always the same.
+	TxTieBreak types.TxTieBreak `toml:",omitempty"`
 }
 
 type Miner struct {
@@ -66,6 +82,31 @@ func (miner *Miner) GenerateBlock() (*types.Block, error) {
 	return miner.worker.commitNewWork()
 }
 
+// LastBuiltBlock returns the last block built, which may not have been
+// verified or accepted, or nil if no block was built.
+func (miner *Miner) LastBuiltBlock() *types.Block {
+	block, _ := miner.PendingBlockAndReceipts()
+	return block
+}
+
+// PendingBlockAndReceipts returns the last block built and the receipts of its
+// transactions, or nil if no block was built. The block may not have been
+// verified or accepted.
+func (miner *Miner) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	built, _ := miner.worker.lastBuilt.Load().(*builtBlock)
+	if built == nil {
+		return nil, nil
+	}
+	return built.block, built.receipts
+}
+
+// CommitOrder returns the transactions of [snapshot] the block builder would
+// consider for a block with [baseFee], in the order it would commit them. The
+// gas limits of the block are not accounted for.
+func (miner *Miner) CommitOrder(snapshot *core.PendingSnapshot, baseFee *big.Int) types.Transactions {
+	return miner.worker.commitOrder(snapshot, baseFee)
+}
+
 // SubscribePendingLogs starts delivering logs from pending transactions
 // to the given channel.
 func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscription {
@@ -32,8 +32,10 @@ package miner
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -62,6 +64,9 @@ type environment struct {
 	txs      []*types.Transaction
 	receipts []*types.Receipt
 
+	// Conditions of the transactions submitted with conditions, by hash
+	conditionals map[common.Hash]*types.TransactionConditional
+
 	start time.Time // Time that block building began
 }
 
@@ -83,6 +88,10 @@ type worker struct {
 	mu       sync.RWMutex   // The lock used to protect the coinbase and extra fields
 	coinbase common.Address
 	clock    *mockable.Clock // Allows us mock the clock for testing
+
+	lastBuilt atomic.Value // *builtBlock, the last block built
+
+	accessHints *accessHints // Accesses of the txs failing or running hot, nil if disabled
 }
 
 func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, clock *mockable.Clock) *worker {
@@ -94,11 +103,19 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		mux:         mux,
 		chain:       eth.BlockChain(),
 		clock:       clock,
+		accessHints: newAccessHints(config.AccessHintsSenders),
 	}
 
 	return worker
 }
 
+// builtBlock is a block built by the worker, with the receipts of its
+// transactions.
+type builtBlock struct {
+	block    *types.Block
+	receipts types.Receipts
+}
+
 // setEtherbase sets the etherbase used to initialize the block coinbase field.
 func (w *worker) setEtherbase(addr common.Address) {
 	w.mu.Lock()
@@ -121,10 +138,8 @@ func (w *worker) commitNewWork() (*types.Block, error) {
 		timestamp = int64(parent.Time())
 	}
 
-	var gasLimit uint64
-	if w.chainConfig.IsApricotPhase1(big.NewInt(timestamp)) {
-		gasLimit = params.ApricotPhase1GasLimit
-	} else {
+	gasLimit, fixed := w.chainConfig.FixedGasLimit(big.NewInt(timestamp))
+	if !fixed {
 		// The gas limit is set in phase1 to ApricotPhase1GasLimit because the ceiling and floor were set to the same value
 		// such that the gas limit converged to it. Since this is hardbaked now, we remove the ability to configure it.
 		gasLimit = core.CalcGasLimit(parent.GasUsed(), parent.GasLimit(), params.ApricotPhase1GasLimit, params.ApricotPhase1GasLimit)
@@ -163,29 +178,101 @@ func (w *worker) commitNewWork() (*types.Block, error) {
 	}
 
 	// Fill the block with all available pending transactions.
-	pending := w.eth.TxPool().Pending(true)
-
-	// Split the pending transactions into locals and remotes
-	localTxs := make(map[common.Address]types.Transactions)
-	remoteTxs := pending
-	for _, account := range w.eth.TxPool().Locals() {
-		if txs := remoteTxs[account]; len(txs) > 0 {
-			delete(remoteTxs, account)
-			localTxs[account] = txs
-		}
+	env.conditionals = w.eth.TxPool().Conditionals()
+	privilegedTxs, localTxs, remoteTxs := w.commitGroups(w.eth.TxPool().Snapshot())
+	stopWarmup := w.startWarmup(env.state, privilegedTxs, localTxs, remoteTxs)
+	defer stopWarmup()
+
+	// Fill the gas reserved for the privileged senders first. Their remaining
+	// transactions are committed with the others.
+	if len(privilegedTxs) > 0 {
+		txs := types.NewTransactionsByPriceAndNonceWithTieBreak(env.signer, privilegedTxs, header.BaseFee, w.config.TxTieBreak)
+		w.commitReservedTransactions(env, txs, w.coinbase, w.config.PrivilegedGas)
+		dropCommitted(env.state.GetNonce, privilegedTxs, localTxs, remoteTxs)
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(env.signer, localTxs, header.BaseFee)
+		txs := types.NewTransactionsByPriceAndNonceWithTieBreak(env.signer, localTxs, header.BaseFee, w.config.TxTieBreak)
 		w.commitTransactions(env, txs, w.coinbase)
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(env.signer, remoteTxs, header.BaseFee)
+		txs := types.NewTransactionsByPriceAndNonceWithTieBreak(env.signer, remoteTxs, header.BaseFee, w.config.TxTieBreak)
 		w.commitTransactions(env, txs, w.coinbase)
 	}
 
 	return w.commit(env)
 }
 
+// commitGroups splits the executable transactions of [snapshot] into the
+// groups committed in turn: the transactions of the privileged senders, if gas
+// is reserved for them, then the ones of the local and remote senders.
+func (w *worker) commitGroups(snapshot *core.PendingSnapshot) (privileged, locals, remotes map[common.Address]types.Transactions) {
+	privileged = make(map[common.Address]types.Transactions)
+	if w.config.PrivilegedGas > 0 {
+		for _, account := range snapshot.Privileged {
+			if txs := snapshot.Executable[account]; len(txs) > 0 {
+				privileged[account] = txs
+			}
+		}
+	}
+	locals = make(map[common.Address]types.Transactions)
+	remotes = make(map[common.Address]types.Transactions, len(snapshot.Executable))
+	for account, txs := range snapshot.Executable {
+		remotes[account] = txs
+	}
+	for _, account := range snapshot.Locals {
+		if txs := remotes[account]; len(txs) > 0 {
+			delete(remotes, account)
+			locals[account] = txs
+		}
+	}
+	return privileged, locals, remotes
+}
+
+// dropCommitted removes from [groups] the transactions of the senders of
+// [privileged] with a nonce below their [nonce], which were committed in the
+// gas reserved for them.
+func dropCommitted(nonce func(common.Address) uint64, privileged map[common.Address]types.Transactions, groups ...map[common.Address]types.Transactions) {
+	for account := range privileged {
+		next := nonce(account)
+		for _, group := range groups {
+			txs := group[account]
+			for len(txs) > 0 && txs[0].Nonce() < next {
+				txs = txs[1:]
+			}
+			if len(txs) == 0 {
+				delete(group, account)
+			} else {
+				group[account] = txs
+			}
+		}
+	}
+}
+
+// commitOrder returns the executable transactions of [snapshot] in the order
+// they are considered for a block with [baseFee], ignoring the gas limits of
+// the block and of the privileged senders. The transactions paying less than
+// [baseFee] are left out.
+func (w *worker) commitOrder(snapshot *core.PendingSnapshot, baseFee *big.Int) types.Transactions {
+	var (
+		signer  = types.LatestSigner(w.chainConfig)
+		ordered types.Transactions
+	)
+	privileged, locals, remotes := w.commitGroups(snapshot)
+	// All the transactions of the privileged senders are considered first
+	dropCommitted(func(common.Address) uint64 { return math.MaxUint64 }, privileged, locals, remotes)
+	for _, group := range []map[common.Address]types.Transactions{privileged, locals, remotes} {
+		if len(group) == 0 {
+			continue
+		}
+		txs := types.NewTransactionsByPriceAndNonceWithTieBreak(signer, group, baseFee, w.config.TxTieBreak)
+		for tx := txs.Peek(); tx != nil; tx = txs.Peek() {
+			ordered = append(ordered, tx)
+			txs.Shift()
+		}
+	}
+	return ordered
+}
+
 func (w *worker) createCurrentEnvironment(parent *types.Block, header *types.Header, tstart time.Time) (*environment, error) {
 	state, err := w.chain.StateAt(parent.Root())
 	if err != nil {
@@ -204,12 +291,19 @@ func (w *worker) createCurrentEnvironment(parent *types.Block, header *types.Hea
 
 func (w *worker) commitTransaction(env *environment, tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
 	snap := env.state.Snapshot()
+	if w.accessHints != nil {
+		env.state.TrackAccesses()
+	}
 
 	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, env.gasPool, env.state, env.header, tx, &env.header.GasUsed, *w.chain.GetVMConfig())
 	if err != nil {
 		env.state.RevertToSnapshot(snap)
 		return nil, err
 	}
+	if w.accessHints != nil {
+		from, _ := types.Sender(env.signer, tx)
+		w.recordAccesses(env.state, from, tx, receipt)
+	}
 	env.txs = append(env.txs, tx)
 	env.receipts = append(env.receipts, receipt)
 
@@ -241,6 +335,15 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 			txs.Pop()
 			continue
 		}
+		// Skip the transactions whose conditions no longer hold, along with
+		// the following transactions of the sender
+		if cond := env.conditionals[tx.Hash()]; cond != nil {
+			if err := core.CheckConditional(cond, env.header, env.state); err != nil {
+				log.Debug("Skipping transaction with conditions not met", "hash", tx.Hash(), "sender", from, "err", err)
+				txs.Pop()
+				continue
+			}
+		}
 		// Start executing the transaction
 		env.state.Prepare(tx.Hash(), env.tcount)
 
@@ -265,7 +368,7 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 			env.tcount++
 			txs.Shift()
 
-		case errors.Is(err, core.ErrTxTypeNotSupported):
+		case errors.Is(err, core.ErrTxTypeNotSupported), errors.Is(err, core.ErrDynamicFeeTxRequired):
 			// Pop the unsupported transaction without shifting in the next from the account
 			log.Trace("Skipping unsupported transaction type", "sender", from, "type", tx.Type())
 			txs.Pop()
@@ -279,6 +382,19 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 	}
 }
 
+// commitReservedTransactions commits [txs] within [gas] of the block, or the
+// gas left in the block if it is lower.
+func (w *worker) commitReservedTransactions(env *environment, txs *types.TransactionsByPriceAndNonce, coinbase common.Address, gas uint64) {
+	available := env.gasPool.Gas()
+	if gas > available {
+		gas = available
+	}
+	env.gasPool = new(core.GasPool).AddGas(gas)
+	w.commitTransactions(env, txs, coinbase)
+	used := gas - env.gasPool.Gas()
+	env.gasPool = new(core.GasPool).AddGas(available - used)
+}
+
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(env *environment) (*types.Block, error) {
@@ -328,6 +444,8 @@ func (w *worker) handleResult(env *environment, block *types.Block, createdAt ti
 	log.Info("Commit new mining work", "number", block.Number(), "hash", hash, "uncles", 0, "txs", env.tcount,
 		"gas", block.GasUsed(), "fees", totalFees(block, receipts), "elapsed", common.PrettyDuration(time.Since(env.start)))
 
+	w.lastBuilt.Store(&builtBlock{block: block, receipts: receipts})
+
 	// Note: the miner no longer emits a NewMinedBlock event. Instead the caller
 	// is responsible for running any additional verification and then inserting
 	// the block with InsertChain, which will also emit a new head event.
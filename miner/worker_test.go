@@ -0,0 +1,48 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/zsmartex/coreth/core/types"
+)
+
+func TestDropCommitted(t *testing.T) {
+	var (
+		privileged = common.HexToAddress("0x01")
+		committed  = common.HexToAddress("0x02")
+		other      = common.HexToAddress("0x03")
+		to         = common.HexToAddress("0x04")
+	)
+	newTxs := func(nonces ...uint64) types.Transactions {
+		var txs types.Transactions
+		for _, nonce := range nonces {
+			txs = append(txs, types.NewTransaction(nonce, to, common.Big0, 21000, big.NewInt(1), nil))
+		}
+		return txs
+	}
+	privilegedTxs := map[common.Address]types.Transactions{
+		privileged: newTxs(3, 4, 5),
+		committed:  newTxs(0),
+	}
+	locals := map[common.Address]types.Transactions{privileged: newTxs(3, 4, 5)}
+	remotes := map[common.Address]types.Transactions{committed: newTxs(0), other: newTxs(7)}
+	nonces := map[common.Address]uint64{privileged: 5, committed: 1, other: 7}
+	dropCommitted(func(account common.Address) uint64 { return nonces[account] }, privilegedTxs, locals, remotes)
+
+	// Only the transaction beyond the reserved gas is left to the others
+	if txs := locals[privileged]; len(txs) != 1 || txs[0].Nonce() != 5 {
+		t.Fatalf("Expected the last tx of the privileged sender to be left, found %v", txs)
+	}
+	if _, ok := remotes[committed]; ok {
+		t.Fatal("Expected the privileged sender with all its txs committed to be dropped")
+	}
+	if txs := remotes[other]; len(txs) != 1 {
+		t.Fatalf("Expected the txs of the other sender to be left, found %v", txs)
+	}
+}
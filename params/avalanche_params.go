@@ -33,6 +33,10 @@ const (
 
 	// The base cost to charge per atomic transaction. Added in Apricot Phase 5.
 	AtomicTxBaseCost uint64 = 10_000
+
+	// The maximum number of shared memory operations, puts and removes, that the atomic
+	// transactions of a block can apply. Enforced as of the Atomic Ops Limit upgrade.
+	MaxAtomicOpsPerBlock uint64 = 1024
 )
 
 var (
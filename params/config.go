@@ -114,13 +114,13 @@ var (
 		ApricotPhase5BlockTimestamp: big.NewInt(0),
 	}
 
-	TestChainConfig         = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0)}
-	TestLaunchConfig        = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil}
-	TestApricotPhase1Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil}
-	TestApricotPhase2Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil}
-	TestApricotPhase3Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil}
-	TestApricotPhase4Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil}
-	TestApricotPhase5Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0)}
+	TestChainConfig         = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil}
+	TestLaunchConfig        = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	TestApricotPhase1Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	TestApricotPhase2Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	TestApricotPhase3Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	TestApricotPhase4Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil, nil}
+	TestApricotPhase5Config = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, nil, nil}
 	TestRules               = TestChainConfig.AvalancheRules(new(big.Int), new(big.Int))
 )
 
@@ -161,11 +161,41 @@ type ChainConfig struct {
 	ApricotPhase4BlockTimestamp *big.Int `json:"apricotPhase4BlockTimestamp,omitempty"`
 	// Apricot Phase 5 introduces a batch of atomic transactions with a maximum atomic gas limit per block. (nil = no fork, 0 = already activated)
 	ApricotPhase5BlockTimestamp *big.Int `json:"apricotPhase5BlockTimestamp,omitempty"`
+
+	// Init Code Limit caps the init code of contract creation transactions and charges gas per word of it,
+	// as specified by EIP-3860 (nil = no fork, 0 = already activated)
+	InitCodeLimitBlockTimestamp *big.Int `json:"initCodeLimitBlockTimestamp,omitempty"`
+	// Overrides of the EIP-3860 init code size cap and per word gas applied from the Init Code Limit
+	// upgrade (nil = EIP-3860 value)
+	MaxInitCodeSize *uint64 `json:"maxInitCodeSize,omitempty"`
+	InitCodeWordGas *uint64 `json:"initCodeWordGas,omitempty"`
+
+	// Atomic Ops Limit caps the number of shared memory operations applied by the atomic transactions
+	// of a block (nil = no fork, 0 = already activated)
+	AtomicOpsLimitBlockTimestamp *big.Int `json:"atomicOpsLimitBlockTimestamp,omitempty"`
+	// Override of the maximum number of shared memory operations per block applied from the Atomic
+	// Ops Limit upgrade (nil = MaxAtomicOpsPerBlock)
+	MaxAtomicOpsPerBlock *uint64 `json:"maxAtomicOpsPerBlock,omitempty"`
+
+	// Dynamic Fee Only rejects the legacy and access list transactions, only allowing dynamic fee
+	// transactions (nil = no fork, 0 = already activated)
+	DynamicFeeOnlyBlockTimestamp *big.Int `json:"dynamicFeeOnlyBlockTimestamp,omitempty"`
+
+	// Gas Limit Schedule fixes the gas limit of the blocks from the timestamp of each of its entries,
+	// which are in increasing order of timestamp (nil = the gas limit of the upgrades)
+	GasLimitSchedule []GasLimitScheduleEntry `json:"gasLimitSchedule,omitempty"`
+}
+
+// GasLimitScheduleEntry sets the gas limit of the blocks from [Timestamp]
+// until the timestamp of the next entry of a gas limit schedule.
+type GasLimitScheduleEntry struct {
+	Timestamp *big.Int `json:"timestamp"`
+	GasLimit  uint64   `json:"gasLimit"`
 }
 
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Apricot Phase 1: %v, Apricot Phase 2: %v, Apricot Phase 3: %v, Apricot Phase 4: %v, Apricot Phase 5: %v, Engine: Dummy Consensus Engine}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Apricot Phase 1: %v, Apricot Phase 2: %v, Apricot Phase 3: %v, Apricot Phase 4: %v, Apricot Phase 5: %v, Init Code Limit: %v, Atomic Ops Limit: %v, Dynamic Fee Only: %v, Engine: Dummy Consensus Engine}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -183,6 +213,9 @@ func (c *ChainConfig) String() string {
 		c.ApricotPhase3BlockTimestamp,
 		c.ApricotPhase4BlockTimestamp,
 		c.ApricotPhase5BlockTimestamp,
+		c.InitCodeLimitBlockTimestamp,
+		c.AtomicOpsLimitBlockTimestamp,
+		c.DynamicFeeOnlyBlockTimestamp,
 	)
 }
 
@@ -270,6 +303,106 @@ func (c *ChainConfig) IsApricotPhase5(blockTimestamp *big.Int) bool {
 	return isForked(c.ApricotPhase5BlockTimestamp, blockTimestamp)
 }
 
+// IsInitCodeLimit returns whether [blockTimestamp] represents a block
+// with a timestamp after the Init Code Limit upgrade time.
+func (c *ChainConfig) IsInitCodeLimit(blockTimestamp *big.Int) bool {
+	return isForked(c.InitCodeLimitBlockTimestamp, blockTimestamp)
+}
+
+// GetMaxInitCodeSize returns the maximum init code size of contract creation
+// transactions once the Init Code Limit upgrade is active.
+func (c *ChainConfig) GetMaxInitCodeSize() uint64 {
+	if c.MaxInitCodeSize == nil {
+		return MaxInitCodeSize
+	}
+	return *c.MaxInitCodeSize
+}
+
+// GetInitCodeWordGas returns the gas charged per word of the init code of
+// contract creation transactions once the Init Code Limit upgrade is active.
+func (c *ChainConfig) GetInitCodeWordGas() uint64 {
+	if c.InitCodeWordGas == nil {
+		return InitCodeWordGas
+	}
+	return *c.InitCodeWordGas
+}
+
+// InitCodeLimits returns the maximum init code size of contract creation
+// transactions and the gas charged per word of it at [blockTimestamp]. Both are
+// zero, that is unlimited and free, before the Init Code Limit upgrade.
+func (c *ChainConfig) InitCodeLimits(blockTimestamp *big.Int) (uint64, uint64) {
+	if !c.IsInitCodeLimit(blockTimestamp) {
+		return 0, 0
+	}
+	return c.GetMaxInitCodeSize(), c.GetInitCodeWordGas()
+}
+
+// IsAtomicOpsLimit returns whether [blockTimestamp] represents a block
+// with a timestamp after the Atomic Ops Limit upgrade time.
+func (c *ChainConfig) IsAtomicOpsLimit(blockTimestamp *big.Int) bool {
+	return isForked(c.AtomicOpsLimitBlockTimestamp, blockTimestamp)
+}
+
+// GetMaxAtomicOpsPerBlock returns the maximum number of shared memory
+// operations per block applied from the Atomic Ops Limit upgrade.
+func (c *ChainConfig) GetMaxAtomicOpsPerBlock() uint64 {
+	if c.MaxAtomicOpsPerBlock == nil {
+		return MaxAtomicOpsPerBlock
+	}
+	return *c.MaxAtomicOpsPerBlock
+}
+
+// AtomicOpsLimit returns the maximum number of shared memory operations of
+// the atomic transactions of a block at [blockTimestamp], or 0 if it is not
+// limited.
+func (c *ChainConfig) AtomicOpsLimit(blockTimestamp *big.Int) uint64 {
+	if !c.IsAtomicOpsLimit(blockTimestamp) {
+		return 0
+	}
+	return c.GetMaxAtomicOpsPerBlock()
+}
+
+// IsDynamicFeeOnly returns whether [blockTimestamp] represents a block
+// with a timestamp after the Dynamic Fee Only upgrade time.
+func (c *ChainConfig) IsDynamicFeeOnly(blockTimestamp *big.Int) bool {
+	return isForked(c.DynamicFeeOnlyBlockTimestamp, blockTimestamp)
+}
+
+// ScheduledGasLimit returns the gas limit of the blocks at [blockTimestamp] set
+// by the gas limit schedule, and false if no entry of the schedule is active.
+func (c *ChainConfig) ScheduledGasLimit(blockTimestamp *big.Int) (uint64, bool) {
+	for i := len(c.GasLimitSchedule) - 1; i >= 0; i-- {
+		if entry := c.GasLimitSchedule[i]; isForked(entry.Timestamp, blockTimestamp) {
+			return entry.GasLimit, true
+		}
+	}
+	return 0, false
+}
+
+// FixedGasLimit returns the gas limit of the blocks at [blockTimestamp], set
+// by the gas limit schedule or else by Apricot Phase 1, and false if the gas
+// limit is not fixed.
+func (c *ChainConfig) FixedGasLimit(blockTimestamp *big.Int) (uint64, bool) {
+	if gasLimit, ok := c.ScheduledGasLimit(blockTimestamp); ok {
+		return gasLimit, true
+	}
+	if c.IsApricotPhase1(blockTimestamp) {
+		return ApricotPhase1GasLimit, true
+	}
+	return 0, false
+}
+
+// activeGasLimitSchedule returns the entries of the gas limit schedule active
+// at [headTimestamp].
+func (c *ChainConfig) activeGasLimitSchedule(headTimestamp *big.Int) []GasLimitScheduleEntry {
+	for i, entry := range c.GasLimitSchedule {
+		if !isForked(entry.Timestamp, headTimestamp) {
+			return c.GasLimitSchedule[:i]
+		}
+	}
+	return c.GasLimitSchedule
+}
+
 // CheckCompatible checks whether scheduled fork transitions have been imported
 // with a mismatching chain configuration.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64, timestamp uint64) *ConfigCompatError {
@@ -363,6 +496,26 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	// Dynamic fee transactions are introduced by Apricot Phase 3, so they
+	// cannot be required before it.
+	if c.DynamicFeeOnlyBlockTimestamp != nil && (c.ApricotPhase3BlockTimestamp == nil || c.ApricotPhase3BlockTimestamp.Cmp(c.DynamicFeeOnlyBlockTimestamp) > 0) {
+		return fmt.Errorf("unsupported fork ordering: dynamicFeeOnlyBlockTimestamp enabled at %v, but apricotPhase3BlockTimestamp enabled at %v",
+			c.DynamicFeeOnlyBlockTimestamp, c.ApricotPhase3BlockTimestamp)
+	}
+	var lastEntry *GasLimitScheduleEntry
+	for i := range c.GasLimitSchedule {
+		entry := &c.GasLimitSchedule[i]
+		if entry.Timestamp == nil {
+			return fmt.Errorf("gas limit schedule entry %d has no timestamp", i)
+		}
+		if entry.GasLimit < MinGasLimit || entry.GasLimit > MaxGasLimit {
+			return fmt.Errorf("gas limit schedule entry %d has gas limit %d, outside of [%d, %d]", i, entry.GasLimit, MinGasLimit, MaxGasLimit)
+		}
+		if lastEntry != nil && lastEntry.Timestamp.Cmp(entry.Timestamp) >= 0 {
+			return fmt.Errorf("unsupported gas limit schedule ordering: entry %d at %v, but entry %d at %v", i-1, lastEntry.Timestamp, i, entry.Timestamp)
+		}
+		lastEntry = entry
+	}
 	// TODO(aaronbuchwald) check that avalanche block timestamps are at least possible with the other rule set changes
 	// additional change: require that block number hard forks are either 0 or nil since they should not
 	// be enabled at a specific block number.
@@ -426,6 +579,39 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, headHeight *big.Int,
 	if isForkIncompatible(c.ApricotPhase5BlockTimestamp, newcfg.ApricotPhase5BlockTimestamp, headTimestamp) {
 		return newCompatError("ApricotPhase5 fork block timestamp", c.ApricotPhase5BlockTimestamp, newcfg.ApricotPhase5BlockTimestamp)
 	}
+	if isForkIncompatible(c.InitCodeLimitBlockTimestamp, newcfg.InitCodeLimitBlockTimestamp, headTimestamp) {
+		return newCompatError("InitCodeLimit fork block timestamp", c.InitCodeLimitBlockTimestamp, newcfg.InitCodeLimitBlockTimestamp)
+	}
+	// The limits cannot change once they are in effect, as that would alter
+	// the validity of accepted blocks.
+	if isForked(c.InitCodeLimitBlockTimestamp, headTimestamp) &&
+		(c.GetMaxInitCodeSize() != newcfg.GetMaxInitCodeSize() || c.GetInitCodeWordGas() != newcfg.GetInitCodeWordGas()) {
+		return newCompatError("InitCodeLimit parameters", c.InitCodeLimitBlockTimestamp, newcfg.InitCodeLimitBlockTimestamp)
+	}
+	if isForkIncompatible(c.AtomicOpsLimitBlockTimestamp, newcfg.AtomicOpsLimitBlockTimestamp, headTimestamp) {
+		return newCompatError("AtomicOpsLimit fork block timestamp", c.AtomicOpsLimitBlockTimestamp, newcfg.AtomicOpsLimitBlockTimestamp)
+	}
+	if isForked(c.AtomicOpsLimitBlockTimestamp, headTimestamp) && c.GetMaxAtomicOpsPerBlock() != newcfg.GetMaxAtomicOpsPerBlock() {
+		return newCompatError("AtomicOpsLimit parameters", c.AtomicOpsLimitBlockTimestamp, newcfg.AtomicOpsLimitBlockTimestamp)
+	}
+	if isForkIncompatible(c.DynamicFeeOnlyBlockTimestamp, newcfg.DynamicFeeOnlyBlockTimestamp, headTimestamp) {
+		return newCompatError("DynamicFeeOnly fork block timestamp", c.DynamicFeeOnlyBlockTimestamp, newcfg.DynamicFeeOnlyBlockTimestamp)
+	}
+	// The entries of the gas limit schedule in effect cannot be edited, and no
+	// entry can be added before the head.
+	stored, scheduled := c.activeGasLimitSchedule(headTimestamp), newcfg.activeGasLimitSchedule(headTimestamp)
+	for i := 0; i < len(stored) || i < len(scheduled); i++ {
+		var storedEntry, newEntry GasLimitScheduleEntry
+		if i < len(stored) {
+			storedEntry = stored[i]
+		}
+		if i < len(scheduled) {
+			newEntry = scheduled[i]
+		}
+		if !configNumEqual(storedEntry.Timestamp, newEntry.Timestamp) || storedEntry.GasLimit != newEntry.GasLimit {
+			return newCompatError("GasLimitSchedule entry timestamp", storedEntry.Timestamp, newEntry.Timestamp)
+		}
+	}
 
 	return nil
 }
@@ -497,6 +683,7 @@ type Rules struct {
 
 	// Rules for Avalanche releases
 	IsApricotPhase1, IsApricotPhase2, IsApricotPhase3, IsApricotPhase4, IsApricotPhase5 bool
+	IsInitCodeLimit, IsAtomicOpsLimit, IsDynamicFeeOnly                                 bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -528,5 +715,8 @@ func (c *ChainConfig) AvalancheRules(blockNum, blockTimestamp *big.Int) Rules {
 	rules.IsApricotPhase3 = c.IsApricotPhase3(blockTimestamp)
 	rules.IsApricotPhase4 = c.IsApricotPhase4(blockTimestamp)
 	rules.IsApricotPhase5 = c.IsApricotPhase5(blockTimestamp)
+	rules.IsInitCodeLimit = c.IsInitCodeLimit(blockTimestamp)
+	rules.IsAtomicOpsLimit = c.IsAtomicOpsLimit(blockTimestamp)
+	rules.IsDynamicFeeOnly = c.IsDynamicFeeOnly(blockTimestamp)
 	return rules
 }
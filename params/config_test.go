@@ -136,3 +136,67 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestGasLimitSchedule(t *testing.T) {
+	config := *TestApricotPhase1Config
+	config.GasLimitSchedule = []GasLimitScheduleEntry{
+		{Timestamp: big.NewInt(100), GasLimit: 15_000_000},
+		{Timestamp: big.NewInt(200), GasLimit: 20_000_000},
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		t.Fatal(err)
+	}
+	for timestamp, expected := range map[int64]uint64{
+		99:  ApricotPhase1GasLimit,
+		100: 15_000_000,
+		199: 15_000_000,
+		200: 20_000_000,
+	} {
+		if gasLimit, ok := config.FixedGasLimit(big.NewInt(timestamp)); !ok || gasLimit != expected {
+			t.Fatalf("Expected the gas limit at %d to be %d, found %d (fixed: %t)", timestamp, expected, gasLimit, ok)
+		}
+	}
+	if _, ok := config.ScheduledGasLimit(big.NewInt(99)); ok {
+		t.Fatal("Expected no scheduled gas limit before the first entry")
+	}
+
+	// The entries must be in increasing order of timestamp
+	unordered := config
+	unordered.GasLimitSchedule = []GasLimitScheduleEntry{config.GasLimitSchedule[1], config.GasLimitSchedule[0]}
+	if err := unordered.CheckConfigForkOrder(); err == nil {
+		t.Fatal("Expected an unordered schedule to be refused")
+	}
+	tooLow := config
+	tooLow.GasLimitSchedule = []GasLimitScheduleEntry{{Timestamp: big.NewInt(100), GasLimit: MinGasLimit - 1}}
+	if err := tooLow.CheckConfigForkOrder(); err == nil {
+		t.Fatal("Expected a gas limit below the minimum to be refused")
+	}
+
+	// Entries in effect cannot be edited, while the upcoming ones can
+	edited := config
+	edited.GasLimitSchedule = []GasLimitScheduleEntry{
+		{Timestamp: big.NewInt(100), GasLimit: 15_000_000},
+		{Timestamp: big.NewInt(300), GasLimit: 25_000_000},
+	}
+	if err := config.CheckCompatible(&edited, 10, 150); err != nil {
+		t.Fatalf("Expected an upcoming entry to be editable, found %v", err)
+	}
+	expectedErr := &ConfigCompatError{
+		What:         "GasLimitSchedule entry timestamp",
+		StoredConfig: big.NewInt(200),
+		NewConfig:    nil,
+		RewindTo:     199,
+	}
+	if err := config.CheckCompatible(&edited, 10, 250); !reflect.DeepEqual(err, expectedErr) {
+		t.Fatalf("Expected error %v, found %v", expectedErr, err)
+	}
+	raised := config
+	raised.GasLimitSchedule = []GasLimitScheduleEntry{{Timestamp: big.NewInt(100), GasLimit: 16_000_000}, config.GasLimitSchedule[1]}
+	if err := config.CheckCompatible(&raised, 10, 150); err == nil || err.What != "GasLimitSchedule entry timestamp" {
+		t.Fatalf("Expected the edit of an entry in effect to be refused, found %v", err)
+	}
+	// Nor can entries be added before the head
+	if err := TestApricotPhase1Config.CheckCompatible(&config, 10, 150); err == nil || err.What != "GasLimitSchedule entry timestamp" {
+		t.Fatalf("Expected an entry added before the head to be refused, found %v", err)
+	}
+}
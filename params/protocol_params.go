@@ -133,6 +133,9 @@ const (
 
 	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
 
+	MaxInitCodeSize        = 2 * MaxCodeSize // Maximum initcode to permit in a creation transaction (EIP-3860)
+	InitCodeWordGas uint64 = 2               // Once per word of the init code of a creation transaction (EIP-3860)
+
 	// Precompiled contract gas prices
 
 	EcrecoverGas        uint64 = 3000 // Elliptic curve sender recovery gas price
@@ -17,8 +17,9 @@ type Client interface {
 	// Returns errNoPeersMatchingVersion if no peer could be found matching specified version
 	RequestAny(minVersion version.Application, request []byte) ([]byte, bool, error)
 
-	// Gossip sends given gossip message to peers
-	Gossip(gossip []byte) error
+	// Gossip sends given gossip message to a sample of the connected peers and
+	// returns the number of peers it was sent to
+	Gossip(gossip []byte) (uint32, error)
 }
 
 // client implements Client interface
@@ -40,7 +41,7 @@ func (c *client) RequestAny(minVersion version.Application, request []byte) ([]b
 	return <-waitingHandler.responseChan, waitingHandler.failed, nil
 }
 
-func (c *client) Gossip(gossip []byte) error {
+func (c *client) Gossip(gossip []byte) (uint32, error) {
 	return c.network.Gossip(gossip)
 }
 
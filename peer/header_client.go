@@ -0,0 +1,134 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package peer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/zsmartex/avalanchego/codec"
+	"github.com/zsmartex/avalanchego/version"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+var (
+	errHeaderRequestFailed = errors.New("header request failed")
+	errNoHeaders           = errors.New("peer returned no headers")
+)
+
+// HeaderClient fetches accepted headers from peers. The headers received are
+// verified to be consecutive and linked by their hashes before being returned.
+type HeaderClient struct {
+	client     Client
+	codec      codec.Manager
+	minVersion version.Application
+}
+
+// NewHeaderClient returns a HeaderClient sending requests through [client] to
+// the peers with at least [minVersion].
+func NewHeaderClient(client Client, codec codec.Manager, minVersion version.Application) *HeaderClient {
+	return &HeaderClient{
+		client:     client,
+		codec:      codec,
+		minVersion: minVersion,
+	}
+}
+
+// GetHeaders returns the [count] accepted headers from [height], requesting at
+// most [message.MaxHeadersPerResponse] headers per request. Returns an error
+// if the peers do not serve the [count] headers.
+//
+// The headers are linked by their hashes, also across requests, so that a
+// tampered header is detected by the next one. As the last header is not
+// verified by a next one, callers should check it against a trusted hash.
+func (c *HeaderClient) GetHeaders(height uint64, count uint64) ([]*types.Header, error) {
+	return c.getHeaders(message.HeaderRequest{Height: height}, count)
+}
+
+// GetHeadersFrom returns the [count] accepted headers from the header [hash],
+// the first header returned having [hash]. See GetHeaders.
+func (c *HeaderClient) GetHeadersFrom(hash common.Hash, count uint64) ([]*types.Header, error) {
+	return c.getHeaders(message.HeaderRequest{Hash: hash}, count)
+}
+
+func (c *HeaderClient) getHeaders(request message.HeaderRequest, count uint64) ([]*types.Header, error) {
+	headers := make([]*types.Header, 0, count)
+	for uint64(len(headers)) < count {
+		request.Count = message.MaxHeadersPerResponse
+		if left := count - uint64(len(headers)); left < message.MaxHeadersPerResponse {
+			request.Count = uint16(left)
+		}
+		var parent *types.Header
+		if len(headers) > 0 {
+			parent = headers[len(headers)-1]
+			request = message.HeaderRequest{Height: parent.Number.Uint64() + 1, Count: request.Count}
+		}
+		batch, err := c.requestHeaders(request, parent)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, batch...)
+	}
+	return headers, nil
+}
+
+// requestHeaders sends [request] to a peer and returns the headers received,
+// verifying that they start at the header requested, after [parent] if it is
+// not nil, and are linked by their hashes.
+func (c *HeaderClient) requestHeaders(request message.HeaderRequest, parent *types.Header) ([]*types.Header, error) {
+	requestBytes, err := message.RequestToBytes(c.codec, request)
+	if err != nil {
+		return nil, err
+	}
+	responseBytes, failed, err := c.client.RequestAny(c.minVersion, requestBytes)
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		return nil, errHeaderRequestFailed
+	}
+	var response message.HeaderResponse
+	if _, err := c.codec.Unmarshal(responseBytes, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse header response: %w", err)
+	}
+	if len(response.Headers) == 0 {
+		return nil, errNoHeaders
+	}
+	if len(response.Headers) > int(request.Count) {
+		return nil, fmt.Errorf("peer returned %d headers, requested %d", len(response.Headers), request.Count)
+	}
+
+	headers := make([]*types.Header, len(response.Headers))
+	for i, headerBytes := range response.Headers {
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(headerBytes, header); err != nil {
+			return nil, fmt.Errorf("failed to decode header %d: %w", i, err)
+		}
+		switch {
+		case i > 0:
+			parent = headers[i-1]
+		case request.Hash != (common.Hash{}):
+			if header.Hash() != request.Hash {
+				return nil, fmt.Errorf("peer returned header %s, requested %s", header.Hash(), request.Hash)
+			}
+		case header.Number == nil || header.Number.Uint64() != request.Height:
+			return nil, fmt.Errorf("peer returned header at height %v, requested %d", header.Number, request.Height)
+		}
+		if parent != nil {
+			if header.ParentHash != parent.Hash() {
+				return nil, fmt.Errorf("header %s at height %v does not link to parent %s", header.Hash(), header.Number, parent.Hash())
+			}
+			if header.Number == nil || header.Number.Uint64() != parent.Number.Uint64()+1 {
+				return nil, fmt.Errorf("header at height %v does not follow parent at height %d", header.Number, parent.Number)
+			}
+		}
+		headers[i] = header
+	}
+	return headers, nil
+}
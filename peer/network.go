@@ -22,8 +22,14 @@ import (
 	"golang.org/x/sync/semaphore"
 )
 
-// Minimum amount of time to handle a request
-const minRequestHandlingDuration = 100 * time.Millisecond
+const (
+	// Minimum amount of time to handle a request
+	minRequestHandlingDuration = 100 * time.Millisecond
+
+	// gossipFanout is the maximum number of connected peers each gossip
+	// message is sent to
+	gossipFanout = 10
+)
 
 var (
 	errAcquiringSemaphore                      = errors.New("error acquiring semaphore")
@@ -42,8 +48,9 @@ type Network interface {
 	// Returns errNoPeersMatchingVersion if no peer could be found matching specified version
 	RequestAny(minVersion version.Application, message []byte, handler message.ResponseHandler) error
 
-	// Gossip sends given gossip message to peers
-	Gossip(gossip []byte) error
+	// Gossip sends given gossip message to a sample of the connected peers and
+	// returns the number of peers it was sent to
+	Gossip(gossip []byte) (uint32, error)
 
 	// Shutdown stops all peer channel listeners and marks the node to have stopped
 	// n.Start() can be called again but the peers will have to be reconnected
@@ -58,6 +65,18 @@ type Network interface {
 
 	// Size returns the size of the network in number of connected peers
 	Size() uint32
+
+	// SetQuarantineConfig replaces the limits of the decode failures of the
+	// peers after which their messages are dropped
+	SetQuarantineConfig(config QuarantineConfig)
+
+	// QuarantinedPeers returns the peers whose messages are dropped for
+	// sending undecodable messages
+	QuarantinedPeers() []QuarantinedPeer
+
+	// ReleasePeer ends the quarantine of [nodeID], returning false if it is
+	// not quarantined
+	ReleasePeer(nodeID ids.ShortID) bool
 }
 
 // network is an implementation of Network that processes message requests for
@@ -73,6 +92,7 @@ type network struct {
 	requestHandler                message.RequestHandler              // maps request type => handler
 	gossipHandler                 message.GossipHandler               // maps gossip type => handler
 	peers                         map[ids.ShortID]version.Application // maps nodeID => version.Version
+	quarantine                    *quarantine                         // peers whose messages are dropped for decode failures
 }
 
 func NewNetwork(appSender common.AppSender, codec codec.Manager, self ids.ShortID, maxActiveRequests int64) Network {
@@ -83,6 +103,7 @@ func NewNetwork(appSender common.AppSender, codec codec.Manager, self ids.ShortI
 		outstandingResponseHandlerMap: make(map[uint32]message.ResponseHandler),
 		peers:                         make(map[ids.ShortID]version.Application),
 		activeRequests:                semaphore.NewWeighted(maxActiveRequests),
+		quarantine:                    newQuarantine(DefaultQuarantineConfig),
 	}
 }
 
@@ -156,9 +177,15 @@ func (n *network) AppRequest(nodeID ids.ShortID, requestID uint32, deadline time
 
 	log.Debug("received AppRequest from node", "nodeID", nodeID, "requestID", requestID, "requestLen", len(request))
 
+	if n.quarantine.isQuarantined(nodeID) {
+		log.Debug("dropping app request from quarantined peer", "nodeID", nodeID, "requestID", requestID)
+		return nil
+	}
 	var req message.Request
 	if _, err := n.codec.Unmarshal(request, &req); err != nil {
-		log.Debug("failed to unmarshal app request", "nodeID", nodeID, "requestID", requestID, "requestLen", len(request), "err", err)
+		failure := classifyDecodeError(err)
+		log.Debug("failed to unmarshal app request", "nodeID", nodeID, "requestID", requestID, "requestLen", len(request), "failure", failure, "err", err)
+		n.quarantine.record(nodeID, failure)
 		return nil
 	}
 
@@ -247,23 +274,56 @@ func (n *network) getRequestHandler(requestID uint32) (message.ResponseHandler,
 	return handler, true
 }
 
-// Gossip sends given gossip message to peers
-func (n *network) Gossip(gossip []byte) error {
-	return n.appSender.SendAppGossip(gossip)
+// Gossip sends given gossip message to at most [gossipFanout] connected peers
+// and returns the number of peers it was sent to. No message is sent if no
+// peer is connected.
+func (n *network) Gossip(gossip []byte) (uint32, error) {
+	n.lock.RLock()
+	recipients := ids.NewShortSet(gossipFanout)
+	// map iteration is sufficiently random to sample different peers for
+	// each message
+	for nodeID := range n.peers {
+		if recipients.Len() == gossipFanout {
+			break
+		}
+		recipients.Add(nodeID)
+	}
+	n.lock.RUnlock()
+
+	if recipients.Len() == 0 {
+		return 0, nil
+	}
+	if err := n.appSender.SendAppGossipSpecific(recipients, gossip); err != nil {
+		return 0, err
+	}
+	return uint32(recipients.Len()), nil
 }
 
 // AppGossip is called by avalanchego -> VM when there is an incoming AppGossip from a peer
 // error returned by this function is expected to be treated as fatal by the engine
-// returns error if request could not be parsed as message.Request or when the requestHandler returns an error
+// returns error when the gossipHandler returns an error other than message.ErrMalformedPayload
+// gossip which cannot be decoded is dropped and counted towards the quarantine of the peer
 func (n *network) AppGossip(nodeID ids.ShortID, gossipBytes []byte) error {
+	if n.quarantine.isQuarantined(nodeID) {
+		log.Debug("dropping app gossip from quarantined peer", "nodeID", nodeID, "gossipLen", len(gossipBytes))
+		return nil
+	}
 	var gossipMsg message.Message
 	if _, err := n.codec.Unmarshal(gossipBytes, &gossipMsg); err != nil {
-		log.Debug("could not parse app gossip", "nodeID", nodeID, "gossipLen", len(gossipBytes), "err", err)
+		failure := classifyDecodeError(err)
+		log.Debug("could not parse app gossip", "nodeID", nodeID, "gossipLen", len(gossipBytes), "failure", failure, "err", err)
+		n.quarantine.record(nodeID, failure)
 		return nil
 	}
 
 	log.Debug("processing AppGossip from node", "nodeID", nodeID, "type", gossipMsg.Type(), "gossipLen", len(gossipBytes))
-	return gossipMsg.Handle(n.gossipHandler, nodeID)
+	err := gossipMsg.Handle(n.gossipHandler, nodeID)
+	if errors.Is(err, message.ErrMalformedPayload) {
+		log.Debug("could not parse app gossip payload", "nodeID", nodeID, "type", gossipMsg.Type(), "err", err)
+		n.quarantine.record(nodeID, ParseError)
+		return nil
+	}
+	return err
 }
 
 // Connected adds the given nodeID to the peer list so that it can receive messages
@@ -309,6 +369,7 @@ func (n *network) Disconnected(nodeID ids.ShortID) error {
 	}
 
 	delete(n.peers, nodeID)
+	n.quarantine.forget(nodeID)
 	return nil
 }
 
@@ -341,3 +402,19 @@ func (n *network) Size() uint32 {
 
 	return uint32(len(n.peers))
 }
+
+func (n *network) SetQuarantineConfig(config QuarantineConfig) {
+	n.quarantine.setConfig(config)
+}
+
+func (n *network) QuarantinedPeers() []QuarantinedPeer {
+	return n.quarantine.quarantined()
+}
+
+func (n *network) ReleasePeer(nodeID ids.ShortID) bool {
+	released := n.quarantine.release(nodeID)
+	if released {
+		log.Info("released peer from quarantine", "nodeID", nodeID)
+	}
+	return released
+}
@@ -217,7 +217,8 @@ func TestGossip(t *testing.T) {
 	sentGossip := false
 	wg.Add(1)
 	sender := testAppSender{
-		sendAppGossipFn: func(msg []byte) error {
+		sendAppGossipSpecificFn: func(nodeIDs ids.ShortSet, msg []byte) error {
+			assert.True(t, nodeIDs.Contains(nodeID))
 			go func() {
 				defer wg.Done()
 				err := clientNetwork.AppGossip(nodeID, msg)
@@ -240,14 +241,46 @@ func TestGossip(t *testing.T) {
 	b, err := buildGossip(codecManager, HelloGossip{Msg: "hello there!"})
 	assert.NoError(t, err)
 
-	err = client.Gossip(b)
+	recipients, err := client.Gossip(b)
 	assert.NoError(t, err)
+	assert.EqualValues(t, 1, recipients)
 
 	wg.Wait()
 	assert.True(t, sentGossip)
 	assert.True(t, gossipHandler.received)
 }
 
+func TestGossipRecipients(t *testing.T) {
+	codecManager := buildCodec(t, HelloGossip{})
+
+	var sentTo []ids.ShortSet
+	sender := testAppSender{
+		sendAppGossipSpecificFn: func(nodeIDs ids.ShortSet, _ []byte) error {
+			sentTo = append(sentTo, nodeIDs)
+			return nil
+		},
+	}
+	net := NewNetwork(sender, codecManager, ids.ShortEmpty, 1)
+	b, err := buildGossip(codecManager, HelloGossip{Msg: "hello there!"})
+	assert.NoError(t, err)
+
+	// Nothing is sent without connected peers
+	recipients, err := net.Gossip(b)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, recipients)
+	assert.Len(t, sentTo, 0)
+
+	// The message is sent to at most [gossipFanout] of the connected peers
+	for i := 0; i < 2*gossipFanout; i++ {
+		assert.NoError(t, net.Connected(ids.GenerateTestShortID(), defaultPeerVersion))
+	}
+	recipients, err = net.Gossip(b)
+	assert.NoError(t, err)
+	assert.EqualValues(t, gossipFanout, recipients)
+	assert.Len(t, sentTo, 1)
+	assert.Equal(t, gossipFanout, sentTo[0].Len())
+}
+
 func TestHandleInvalidMessages(t *testing.T) {
 	codecManager := buildCodec(t, HelloGossip{}, TestMessage{})
 
@@ -341,13 +374,14 @@ func buildGossip(codec codec.Manager, msg message.Message) ([]byte, error) {
 }
 
 type testAppSender struct {
-	sendAppRequestFn  func(ids.ShortSet, uint32, []byte) error
-	sendAppResponseFn func(ids.ShortID, uint32, []byte) error
-	sendAppGossipFn   func([]byte) error
+	sendAppRequestFn        func(ids.ShortSet, uint32, []byte) error
+	sendAppResponseFn       func(ids.ShortID, uint32, []byte) error
+	sendAppGossipFn         func([]byte) error
+	sendAppGossipSpecificFn func(ids.ShortSet, []byte) error
 }
 
-func (t testAppSender) SendAppGossipSpecific(ids.ShortSet, []byte) error {
-	panic("not implemented")
+func (t testAppSender) SendAppGossipSpecific(nodeIDs ids.ShortSet, message []byte) error {
+	return t.sendAppGossipSpecificFn(nodeIDs, message)
 }
 
 func (t testAppSender) SendAppRequest(nodeIDs ids.ShortSet, requestID uint32, message []byte) error {
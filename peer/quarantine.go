@@ -0,0 +1,241 @@
+// (c) 2019-2022, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package peer
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+)
+
+// DecodeFailure is the class of a failure to decode a message from a peer.
+type DecodeFailure int
+
+const (
+	// VersionUnknown is a message of an unknown codec version, likely sent by
+	// an honest peer running a newer version.
+	VersionUnknown DecodeFailure = iota
+	// SizeOverflow is a message, or a list in it, exceeding its maximum size.
+	SizeOverflow
+	// TypeUnknown is a message of an unregistered type.
+	TypeUnknown
+	// ParseError is a message whose content cannot be parsed, by the codec or
+	// by the handler of the decoded message.
+	ParseError
+
+	numDecodeFailures
+)
+
+func (f DecodeFailure) String() string {
+	switch f {
+	case VersionUnknown:
+		return "version-unknown"
+	case SizeOverflow:
+		return "size-overflow"
+	case TypeUnknown:
+		return "type-unknown"
+	default:
+		return "parse-error"
+	}
+}
+
+// classifyDecodeError returns the class of the error [err] of the codec
+// failing to unmarshal a message. The codec does not export its errors.
+func classifyDecodeError(err error) DecodeFailure {
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "unknown codec version"):
+		return VersionUnknown
+	case strings.Contains(msg, "exceeds maximum length"):
+		return SizeOverflow
+	case strings.Contains(msg, "unknown type ID"), strings.Contains(msg, "does not implement"):
+		return TypeUnknown
+	default:
+		return ParseError
+	}
+}
+
+var (
+	quarantinedPeersMeter    = metrics.NewRegisteredMeter("peer/quarantine/peers", nil)
+	quarantinedMessagesMeter = metrics.NewRegisteredMeter("peer/quarantine/dropped", nil)
+)
+
+// QuarantineConfig is the number of decode failures within a window after
+// which the messages of a peer are dropped for a while.
+type QuarantineConfig struct {
+	// VersionLimit is the number of messages of an unknown codec version,
+	// scored apart from the others as they are likely sent by honest newer
+	// peers (0 never quarantines them).
+	VersionLimit int
+	// GarbageLimit is the number of messages overflowing their size, of an
+	// unknown type or unparsable (0 never quarantines them).
+	GarbageLimit int
+	// Window is the duration over which the failures are counted.
+	Window time.Duration
+	// Duration is the duration of the quarantine.
+	Duration time.Duration
+}
+
+// DefaultQuarantineConfig is the quarantine of the peers sending garbage
+// repeatedly, tolerating more of the messages of unknown codec versions.
+var DefaultQuarantineConfig = QuarantineConfig{
+	VersionLimit: 1000,
+	GarbageLimit: 20,
+	Window:       time.Minute,
+	Duration:     10 * time.Minute,
+}
+
+// QuarantinedPeer is a peer whose messages are dropped until [Until].
+type QuarantinedPeer struct {
+	NodeID   ids.ShortID
+	Reason   DecodeFailure
+	Until    time.Time
+	Failures map[DecodeFailure]int // Failures in the window which led to the quarantine
+}
+
+// peerFailures is the decode failures of a peer in the current window.
+type peerFailures struct {
+	windowStart time.Time
+	counts      [numDecodeFailures]int
+
+	quarantinedUntil time.Time
+	reason           DecodeFailure
+}
+
+// quarantine tracks the decode failures of the peers, by class, and the peers
+// exceeding the limits of their failures.
+type quarantine struct {
+	lock   sync.Mutex
+	config QuarantineConfig
+	clock  mockable.Clock
+	peers  map[ids.ShortID]*peerFailures
+}
+
+func newQuarantine(config QuarantineConfig) *quarantine {
+	return &quarantine{
+		config: config,
+		peers:  make(map[ids.ShortID]*peerFailures),
+	}
+}
+
+// setConfig replaces the limits of the failures, for the next failures.
+func (q *quarantine) setConfig(config QuarantineConfig) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.config = config
+}
+
+// record counts a [failure] to decode a message of [nodeID], quarantining
+// [nodeID] if it exceeds the limit of its class. Returns true if [nodeID] is
+// quarantined.
+func (q *quarantine) record(nodeID ids.ShortID, failure DecodeFailure) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := q.clock.Time()
+	peer, ok := q.peers[nodeID]
+	if !ok {
+		peer = &peerFailures{windowStart: now}
+		q.peers[nodeID] = peer
+	}
+	if now.Before(peer.quarantinedUntil) {
+		return true
+	}
+	if now.Sub(peer.windowStart) > q.config.Window {
+		*peer = peerFailures{windowStart: now}
+	}
+	peer.counts[failure]++
+
+	var score, limit int
+	if failure == VersionUnknown {
+		score, limit = peer.counts[VersionUnknown], q.config.VersionLimit
+	} else {
+		score, limit = peer.counts[SizeOverflow]+peer.counts[TypeUnknown]+peer.counts[ParseError], q.config.GarbageLimit
+	}
+	if limit <= 0 || score < limit {
+		return false
+	}
+	peer.quarantinedUntil = now.Add(q.config.Duration)
+	peer.reason = failure
+	quarantinedPeersMeter.Mark(1)
+	log.Warn("quarantining peer sending undecodable messages", "nodeID", nodeID, "reason", failure, "failures", score, "until", peer.quarantinedUntil)
+	return true
+}
+
+// isQuarantined returns true if the messages of [nodeID] are dropped.
+func (q *quarantine) isQuarantined(nodeID ids.ShortID) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	peer, ok := q.peers[nodeID]
+	if !ok || peer.quarantinedUntil.IsZero() {
+		return false
+	}
+	if !q.clock.Time().Before(peer.quarantinedUntil) {
+		log.Info("releasing peer from quarantine", "nodeID", nodeID)
+		delete(q.peers, nodeID)
+		return false
+	}
+	quarantinedMessagesMeter.Mark(1)
+	return true
+}
+
+// release ends the quarantine of [nodeID], and forgets its failures. Returns
+// false if [nodeID] is not quarantined.
+func (q *quarantine) release(nodeID ids.ShortID) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	peer, ok := q.peers[nodeID]
+	if !ok || !q.clock.Time().Before(peer.quarantinedUntil) {
+		return false
+	}
+	delete(q.peers, nodeID)
+	return true
+}
+
+// forget drops the failures of [nodeID] unless it is quarantined, so that the
+// peers which disconnected are not tracked.
+func (q *quarantine) forget(nodeID ids.ShortID) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if peer, ok := q.peers[nodeID]; ok && !q.clock.Time().Before(peer.quarantinedUntil) {
+		delete(q.peers, nodeID)
+	}
+}
+
+// quarantined returns the peers currently quarantined.
+func (q *quarantine) quarantined() []QuarantinedPeer {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var (
+		now   = q.clock.Time()
+		peers []QuarantinedPeer
+	)
+	for nodeID, peer := range q.peers {
+		if !now.Before(peer.quarantinedUntil) {
+			continue
+		}
+		failures := make(map[DecodeFailure]int)
+		for failure, count := range peer.counts {
+			if count > 0 {
+				failures[DecodeFailure(failure)] = count
+			}
+		}
+		peers = append(peers, QuarantinedPeer{
+			NodeID:   nodeID,
+			Reason:   peer.reason,
+			Until:    peer.quarantinedUntil,
+			Failures: failures,
+		})
+	}
+	return peers
+}
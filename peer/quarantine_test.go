@@ -0,0 +1,136 @@
+// (c) 2019-2022, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/units"
+
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+// malformedGossipHandler fails to parse the payload of the gossip from
+// [malformed], and records the gossip of the other peers.
+type malformedGossipHandler struct {
+	testGossipHandler
+	malformed ids.ShortID
+}
+
+func (h *malformedGossipHandler) HandleEthTxs(nodeID ids.ShortID, msg *message.EthTxs) error {
+	if nodeID == h.malformed {
+		return fmt.Errorf("%w: bad txs", message.ErrMalformedPayload)
+	}
+	return h.testGossipHandler.HandleEthTxs(nodeID, msg)
+}
+
+func TestQuarantineFailureClasses(t *testing.T) {
+	codecManager := buildCodec(t, HelloGossip{})
+	valid, err := buildGossip(codecManager, HelloGossip{Msg: "hello there!"})
+	assert.NoError(t, err)
+
+	tests := map[string]struct {
+		gossip  []byte
+		failure DecodeFailure
+		limit   int
+	}{
+		"version unknown": {
+			gossip:  []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x00},
+			failure: VersionUnknown,
+			limit:   4,
+		},
+		"size overflow": {
+			gossip:  make([]byte, units.MiB),
+			failure: SizeOverflow,
+			limit:   2,
+		},
+		"type unknown": {
+			gossip:  []byte{0x00, 0x00, 0xff, 0xff, 0xff, 0xff},
+			failure: TypeUnknown,
+			limit:   2,
+		},
+		"codec parse error": {
+			gossip:  valid[:len(valid)-3],
+			failure: ParseError,
+			limit:   2,
+		},
+		"payload parse error": {
+			gossip:  valid,
+			failure: ParseError,
+			limit:   2,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				peerID  = ids.GenerateTestShortID()
+				otherID = ids.GenerateTestShortID()
+				handler = &malformedGossipHandler{malformed: peerID}
+				net     = NewNetwork(nil, codecManager, ids.ShortEmpty, 1)
+			)
+			net.SetGossipHandler(handler)
+			net.SetQuarantineConfig(QuarantineConfig{VersionLimit: 4, GarbageLimit: 2, Window: time.Minute, Duration: time.Hour})
+
+			// The peer is quarantined once it reaches the limit of its class
+			for i := 0; i < test.limit; i++ {
+				assert.Empty(t, net.QuarantinedPeers())
+				assert.NoError(t, net.AppGossip(peerID, test.gossip))
+			}
+			quarantined := net.QuarantinedPeers()
+			assert.Len(t, quarantined, 1)
+			assert.Equal(t, peerID, quarantined[0].NodeID)
+			assert.Equal(t, test.failure, quarantined[0].Reason)
+			assert.Equal(t, map[DecodeFailure]int{test.failure: test.limit}, quarantined[0].Failures)
+
+			// The gossip of the quarantined peer is dropped, not the others'
+			handler.malformed = ids.ShortEmpty
+			assert.NoError(t, net.AppGossip(peerID, valid))
+			assert.False(t, handler.received)
+			assert.NoError(t, net.AppGossip(otherID, valid))
+			assert.True(t, handler.received)
+			assert.Equal(t, otherID, handler.nodeID)
+
+			// The released peer is processed again
+			assert.True(t, net.ReleasePeer(peerID))
+			assert.False(t, net.ReleasePeer(peerID))
+			assert.Empty(t, net.QuarantinedPeers())
+			assert.NoError(t, net.AppGossip(peerID, valid))
+			assert.Equal(t, peerID, handler.nodeID)
+		})
+	}
+}
+
+func TestQuarantineScoresVersionApart(t *testing.T) {
+	codecManager := buildCodec(t, HelloGossip{})
+	net := NewNetwork(nil, codecManager, ids.ShortEmpty, 1)
+	net.SetGossipHandler(&testGossipHandler{})
+	net.SetQuarantineConfig(QuarantineConfig{VersionLimit: 3, GarbageLimit: 3, Window: time.Minute, Duration: time.Hour})
+
+	// Unknown versions do not add up with garbage
+	nodeID := ids.GenerateTestShortID()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, net.AppGossip(nodeID, []byte{0x00, 0x07}))
+		assert.NoError(t, net.AppGossip(nodeID, []byte{0x00, 0x00, 0xff, 0xff, 0xff, 0xff}))
+	}
+	assert.Empty(t, net.QuarantinedPeers())
+
+	// The failures are counted within the window only
+	clock := &net.(*network).quarantine.clock
+	clock.Set(time.Now().Add(2 * time.Minute))
+	assert.NoError(t, net.AppGossip(nodeID, []byte{0x00, 0x07}))
+	assert.NoError(t, net.AppGossip(nodeID, []byte{0x00, 0x07}))
+	assert.Empty(t, net.QuarantinedPeers())
+	assert.NoError(t, net.AppGossip(nodeID, []byte{0x00, 0x07}))
+	assert.Len(t, net.QuarantinedPeers(), 1)
+
+	// Requests are dropped too, and the quarantine ends on its own
+	assert.NoError(t, net.AppRequest(nodeID, 1, time.Now().Add(time.Minute), []byte{0x00, 0x07}))
+	clock.Set(clock.Time().Add(2 * time.Hour))
+	assert.Empty(t, net.QuarantinedPeers())
+	assert.False(t, net.ReleasePeer(nodeID))
+}
@@ -4,12 +4,21 @@
 package evm
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
 	"github.com/zsmartex/avalanchego/utils/profiler"
+	"github.com/zsmartex/coreth/core"
 )
 
 // Admin is the API service for admin API calls
@@ -75,3 +84,442 @@ func (p *Admin) SetLogLevel(r *http.Request, args *SetLogLevelArgs, reply *api.S
 	reply.Success = true
 	return nil
 }
+
+type ExportStateSnapshotArgs struct {
+	Path   string      `json:"path"`
+	Height json.Uint64 `json:"height"`
+}
+
+// ExportStateSnapshot writes a snapshot of the state, recent headers and atomic
+// trie of the accepted block at the given height to the specified directory.
+// Calling it again with the same arguments resumes an interrupted export.
+func (p *Admin) ExportStateSnapshot(r *http.Request, args *ExportStateSnapshotArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: ExportStateSnapshot called", "path", args.Path, "height", args.Height)
+
+	_, err := p.vm.exportStateSnapshot(args.Path, uint64(args.Height))
+	reply.Success = err == nil
+	return err
+}
+
+type ImportStateSnapshotArgs struct {
+	Path string `json:"path"`
+}
+
+// ImportStateSnapshot loads the snapshot in the specified directory into a
+// fresh node. The node continues from the snapshot block once restarted.
+// Calling it again with the same arguments resumes an interrupted import.
+func (p *Admin) ImportStateSnapshot(r *http.Request, args *ImportStateSnapshotArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: ImportStateSnapshot called", "path", args.Path)
+
+	_, err := p.vm.importStateSnapshot(args.Path)
+	reply.Success = err == nil
+	return err
+}
+
+type RepairReceiptsArgs struct {
+	FromHeight json.Uint64 `json:"fromHeight"`
+	ToHeight   json.Uint64 `json:"toHeight"`
+}
+
+// RepairReceipts starts a background job replaying the accepted blocks in the
+// given range of heights and rewriting their stored receipts if they differ
+// from the re-derived ones. Calling it again with the same arguments resumes
+// an interrupted job. Use ReceiptRepairStatus to follow its progress.
+func (p *Admin) RepairReceipts(r *http.Request, args *RepairReceiptsArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: RepairReceipts called", "fromHeight", args.FromHeight, "toHeight", args.ToHeight)
+
+	_, err := p.vm.startReceiptRepair(uint64(args.FromHeight), uint64(args.ToHeight))
+	reply.Success = err == nil
+	return err
+}
+
+type ReceiptRepairStatusReply struct {
+	Running    bool          `json:"running"`
+	Done       bool          `json:"done"`
+	FromHeight json.Uint64   `json:"fromHeight"`
+	ToHeight   json.Uint64   `json:"toHeight"`
+	NextHeight json.Uint64   `json:"nextHeight"`
+	Checked    json.Uint64   `json:"checked"`
+	Repaired   []json.Uint64 `json:"repaired"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ReceiptRepairStatus returns a summary of the last receipt repair job,
+// including the heights of the blocks whose receipts were repaired.
+func (p *Admin) ReceiptRepairStatus(r *http.Request, args *struct{}, reply *ReceiptRepairStatusReply) error {
+	log.Info("Admin: ReceiptRepairStatus called")
+
+	progress, running, err := p.vm.receiptRepairStatus()
+	if err != nil {
+		return err
+	}
+	if progress == nil {
+		return errors.New("no receipt repair job was started")
+	}
+	reply.Running = running
+	reply.Done = progress.Done
+	reply.FromHeight = json.Uint64(progress.From)
+	reply.ToHeight = json.Uint64(progress.To)
+	reply.NextHeight = json.Uint64(progress.Next)
+	reply.Checked = json.Uint64(progress.Checked)
+	reply.Repaired = make([]json.Uint64, len(progress.Repaired))
+	for i, height := range progress.Repaired {
+		reply.Repaired[i] = json.Uint64(height)
+	}
+	reply.Error = progress.Error
+	return nil
+}
+
+// BackfillSupplyDelta starts a background job recording the AVAX moved by the
+// atomic txs of the blocks accepted before the supply delta index was enabled.
+// Calling it again resumes an interrupted job. Use SupplyDeltaBackfillStatus
+// to follow its progress.
+func (p *Admin) BackfillSupplyDelta(r *http.Request, args *struct{}, reply *api.SuccessResponse) error {
+	log.Info("Admin: BackfillSupplyDelta called")
+
+	_, err := p.vm.startSupplyBackfill()
+	reply.Success = err == nil
+	return err
+}
+
+type SupplyDeltaBackfillStatusReply struct {
+	Running    bool         `json:"running"`
+	Done       bool         `json:"done"`
+	BaseHeight json.Uint64  `json:"baseHeight"`
+	NextHeight json.Uint64  `json:"nextHeight"`
+	Totals     SupplyTotals `json:"totals"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// SupplyDeltaBackfillStatus returns a summary of the supply delta backfill,
+// which covers the heights up to the base height of the index. The totals are
+// the cumulative totals before the next height.
+func (p *Admin) SupplyDeltaBackfillStatus(r *http.Request, args *struct{}, reply *SupplyDeltaBackfillStatusReply) error {
+	log.Info("Admin: SupplyDeltaBackfillStatus called")
+
+	progress, base, running, err := p.vm.supplyBackfillStatus()
+	if err != nil {
+		return err
+	}
+	reply.Running = running
+	reply.BaseHeight = json.Uint64(base)
+	if base == 0 {
+		reply.Done = true
+		return nil
+	}
+	if progress == nil {
+		return errors.New("no supply delta backfill job was started")
+	}
+	reply.Done = progress.Done
+	reply.NextHeight = json.Uint64(progress.Next)
+	reply.Totals = newSupplyTotals(progress.Totals)
+	reply.Error = progress.Error
+	return nil
+}
+
+type ListForensicDumpsReply struct {
+	Dumps []core.ForensicDumpInfo `json:"dumps"`
+}
+
+// ListForensicDumps returns the forensic dumps written for blocks failing
+// verification with a state or receipt root mismatch, from the oldest to the
+// most recent.
+func (p *Admin) ListForensicDumps(r *http.Request, args *struct{}, reply *ListForensicDumpsReply) error {
+	log.Info("Admin: ListForensicDumps called")
+
+	dumps, err := p.vm.chain.BlockChain().ForensicDumps()
+	if err != nil {
+		return err
+	}
+	reply.Dumps = dumps
+	return nil
+}
+
+type WatchedTransactionsReply struct {
+	Transactions []WatchedTransaction `json:"transactions"`
+}
+
+// WatchedTransactions returns the state of the tracked transactions of the
+// watched addresses, from their admission in the tx pool to their acceptance
+// or, for the evicted ones, for some time after their eviction.
+func (p *Admin) WatchedTransactions(r *http.Request, args *struct{}, reply *WatchedTransactionsReply) error {
+	log.Info("Admin: WatchedTransactions called")
+
+	if p.vm.txWatcher == nil {
+		return errors.New("no address is watched")
+	}
+	reply.Transactions = p.vm.txWatcher.watched()
+	return nil
+}
+
+type ReloadHandlerConfigArgs struct {
+	// Config is a JSON object of the handler settings to apply over the
+	// current ones: eth-apis, eth-api-method-groups, snowman-api-enabled,
+	// api-max-duration, ws-cpu-refill-rate and ws-cpu-max-stored.
+	Config string `json:"config"`
+}
+
+// ReloadHandlerConfig swaps the configuration of the eth RPC and websocket
+// handlers without a restart. Calls in flight on the removed methods complete,
+// while the subscriptions of the disabled namespaces are terminated with an
+// error. The websocket settings apply to the new connections.
+func (p *Admin) ReloadHandlerConfig(r *http.Request, args *ReloadHandlerConfigArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: ReloadHandlerConfig called", "config", args.Config)
+
+	err := p.vm.reloadHandlerConfig([]byte(args.Config))
+	reply.Success = err == nil
+	return err
+}
+
+type SnapshotMempoolReply struct {
+	Snapshot hexutil.Bytes `json:"snapshot"`
+}
+
+// SnapshotMempool returns a snapshot of the pending and queued eth txs and of
+// the pending atomic txs, to be restored with LoadMempoolSnapshot.
+func (p *Admin) SnapshotMempool(r *http.Request, args *struct{}, reply *SnapshotMempoolReply) error {
+	log.Info("Admin: SnapshotMempool called")
+
+	snapshot, err := p.vm.SnapshotMempool()
+	if err != nil {
+		return err
+	}
+	reply.Snapshot = snapshot
+	return nil
+}
+
+type LoadMempoolSnapshotArgs struct {
+	Snapshot      hexutil.Bytes `json:"snapshot"`
+	SkipFeeChecks bool          `json:"skipFeeChecks"`
+}
+
+type LoadMempoolSnapshotReply struct {
+	Results []MempoolRestoreResult `json:"results"`
+}
+
+// LoadMempoolSnapshot restores the txs of a snapshot returned by
+// SnapshotMempool through the validation of the mempools, and returns the
+// result of the restoration of each tx.
+func (p *Admin) LoadMempoolSnapshot(r *http.Request, args *LoadMempoolSnapshotArgs, reply *LoadMempoolSnapshotReply) error {
+	log.Info("Admin: LoadMempoolSnapshot called", "size", len(args.Snapshot), "skipFeeChecks", args.SkipFeeChecks)
+
+	results, err := p.vm.LoadMempoolSnapshot(args.Snapshot, args.SkipFeeChecks)
+	if err != nil {
+		return err
+	}
+	reply.Results = results
+	return nil
+}
+
+type PrepareShutdownArgs struct {
+	DrainSeconds json.Uint64 `json:"drainSeconds"`
+}
+
+// PrepareShutdown drains the node for [DrainSeconds] ahead of a shutdown: the
+// node reports itself unhealthy, initiates no block build and refuses new
+// subscriptions, while the calls and subscriptions in flight are served.
+// Returns at the deadline of the drain, once the node can be stopped, or with
+// an error if the drain is cancelled. Calls while the node is draining wait
+// for the deadline of the drain in progress.
+func (p *Admin) PrepareShutdown(r *http.Request, args *PrepareShutdownArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: PrepareShutdown called", "drainSeconds", args.DrainSeconds)
+
+	// The lock of the chain held by the admin API is released while the node
+	// drains, so that it keeps up with the network
+	p.vm.ctx.Lock.Unlock()
+	defer p.vm.ctx.Lock.Lock()
+
+	if err := p.vm.prepareShutdown(r.Context(), time.Duration(args.DrainSeconds)*time.Second); err != nil {
+		return err
+	}
+	reply.Success = true
+	return nil
+}
+
+// CancelShutdown ends the drain of the node started by PrepareShutdown, if
+// any, restoring normal operation.
+func (p *Admin) CancelShutdown(r *http.Request, args *struct{}, reply *api.SuccessResponse) error {
+	log.Info("Admin: CancelShutdown called")
+
+	p.vm.shutdownDrain.cancel()
+	reply.Success = true
+	return nil
+}
+
+type ExportRangeToFileArgs struct {
+	Path   string      `json:"path"`
+	From   json.Uint64 `json:"from"`
+	To     json.Uint64 `json:"to"`
+	Format string      `json:"format"`
+}
+
+// ExportRangeToFile writes the accepted blocks in the given range of heights
+// to the specified file, which must not exist, either as RLP encoded blocks
+// ("rlp", the default) as read by admin_importChain, or as lines of JSON
+// holding each block and its receipts ("jsonl").
+func (p *Admin) ExportRangeToFile(r *http.Request, args *ExportRangeToFileArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: ExportRangeToFile called", "path", args.Path, "from", args.From, "to", args.To, "format", args.Format)
+
+	// The lock of the chain held by the admin API is released during the
+	// export, which only reads accepted blocks
+	p.vm.ctx.Lock.Unlock()
+	defer p.vm.ctx.Lock.Lock()
+
+	_, err := p.vm.exportRangeToFile(r.Context(), args.Path, uint64(args.From), uint64(args.To), args.Format)
+	reply.Success = err == nil
+	return err
+}
+
+type SetPrivilegedSendersArgs struct {
+	Addresses []common.Address `json:"addresses"`
+}
+
+// SetPrivilegedSenders replaces the senders whose transactions are given the
+// reserved slots of the tx pool and the reserved gas of the blocks built by
+// the node.
+func (p *Admin) SetPrivilegedSenders(r *http.Request, args *SetPrivilegedSendersArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: SetPrivilegedSenders called", "addresses", len(args.Addresses))
+
+	p.vm.chain.GetTxPool().SetPrivileged(args.Addresses)
+	reply.Success = true
+	return nil
+}
+
+type MigrationStatus struct {
+	Name       string      `json:"name"`
+	Version    json.Uint64 `json:"version"`
+	Background bool        `json:"background"`
+	State      string      `json:"state"`
+	Migrated   json.Uint64 `json:"migrated"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type MigrationStatusReply struct {
+	SchemaVersion json.Uint64       `json:"schemaVersion"`
+	LatestVersion json.Uint64       `json:"latestVersion"`
+	Migrations    []MigrationStatus `json:"migrations"`
+}
+
+// MigrationStatus returns the schema version of the chain database and the
+// state of every migration of its schema, which is "done", "running",
+// "pending" or "failed". The items migrated are counted for the migration in
+// progress or last completed by the node.
+func (p *Admin) MigrationStatus(r *http.Request, args *struct{}, reply *MigrationStatusReply) error {
+	log.Info("Admin: MigrationStatus called")
+
+	version, statuses := p.vm.migrator.status()
+	reply.SchemaVersion = json.Uint64(version)
+	reply.LatestVersion = json.Uint64(len(statuses))
+	reply.Migrations = make([]MigrationStatus, len(statuses))
+	for i, status := range statuses {
+		reply.Migrations[i] = MigrationStatus{
+			Name:       status.name,
+			Version:    json.Uint64(status.version),
+			Background: status.background,
+			State:      status.state,
+			Migrated:   json.Uint64(status.migrated),
+		}
+		if status.err != nil {
+			reply.Migrations[i].Error = status.err.Error()
+		}
+	}
+	return nil
+}
+
+type QuarantinedPeer struct {
+	NodeID   ids.ShortID            `json:"nodeID"`
+	Reason   string                 `json:"reason"`
+	Until    time.Time              `json:"until"`
+	Failures map[string]json.Uint64 `json:"failures"`
+}
+
+type QuarantinedPeersReply struct {
+	Peers []QuarantinedPeer `json:"peers"`
+}
+
+// QuarantinedPeers returns the peers whose gossip and requests are dropped for
+// sending messages which cannot be decoded, with the failures, by class,
+// which led to their quarantine.
+func (p *Admin) QuarantinedPeers(r *http.Request, args *struct{}, reply *QuarantinedPeersReply) error {
+	log.Info("Admin: QuarantinedPeers called")
+
+	peers := p.vm.Network.QuarantinedPeers()
+	sort.Slice(peers, func(i, j int) bool { return bytes.Compare(peers[i].NodeID[:], peers[j].NodeID[:]) < 0 })
+	reply.Peers = make([]QuarantinedPeer, len(peers))
+	for i, peer := range peers {
+		failures := make(map[string]json.Uint64, len(peer.Failures))
+		for failure, count := range peer.Failures {
+			failures[failure.String()] = json.Uint64(count)
+		}
+		reply.Peers[i] = QuarantinedPeer{
+			NodeID:   peer.NodeID,
+			Reason:   peer.Reason.String(),
+			Until:    peer.Until,
+			Failures: failures,
+		}
+	}
+	return nil
+}
+
+type ReleaseQuarantinedPeerArgs struct {
+	NodeID ids.ShortID `json:"nodeID"`
+}
+
+// ReleaseQuarantinedPeer ends the quarantine of a peer, processing its messages again.
+func (p *Admin) ReleaseQuarantinedPeer(r *http.Request, args *ReleaseQuarantinedPeerArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: ReleaseQuarantinedPeer called", "nodeID", args.NodeID)
+
+	if !p.vm.Network.ReleasePeer(args.NodeID) {
+		return fmt.Errorf("peer %s is not quarantined", args.NodeID)
+	}
+	reply.Success = true
+	return nil
+}
+
+type ExportDestinationArgs struct {
+	// Address, including the chainID, the exports are sent to
+	To string `json:"to"`
+}
+
+// AddExportDestination allowlists a destination of the exports issued
+// through the avax API, exempting them from the thresholds of the export
+// policy.
+func (p *Admin) AddExportDestination(r *http.Request, args *ExportDestinationArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: AddExportDestination called", "to", args.To)
+
+	if p.vm.exportPolicy == nil {
+		return errExportPolicyOff
+	}
+	chainID, to, err := p.vm.ParseAddress(args.To)
+	if err != nil {
+		return err
+	}
+	if err := p.vm.exportPolicy.add(exportDestination{chainID: chainID, to: to}); err != nil {
+		return err
+	}
+	reply.Success = true
+	return nil
+}
+
+// RemoveExportDestination removes a destination from the allowlist of the
+// export policy.
+func (p *Admin) RemoveExportDestination(r *http.Request, args *ExportDestinationArgs, reply *api.SuccessResponse) error {
+	log.Info("Admin: RemoveExportDestination called", "to", args.To)
+
+	if p.vm.exportPolicy == nil {
+		return errExportPolicyOff
+	}
+	chainID, to, err := p.vm.ParseAddress(args.To)
+	if err != nil {
+		return err
+	}
+	removed, err := p.vm.exportPolicy.remove(exportDestination{chainID: chainID, to: to})
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("export destination %s is not allowlisted", args.To)
+	}
+	reply.Success = true
+	return nil
+}
@@ -0,0 +1,129 @@
+// (c) 2019-2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ethAPIMethodGroups maps the name of each method group that can be enabled
+// through [Config.EnabledEthAPIMethodGroups] to the methods it exposes, keyed
+// by the name of the Ethereum API service that provides them.
+//
+// Method groups allow operators to expose part of a namespace (e.g. block
+// tracing but not database inspection on debug) without enabling every
+// service registered under it.
+var ethAPIMethodGroups = map[string]map[string][]string{
+	"debug-tracer": {
+		"debug-tracer": {
+			"traceChain",
+			"traceBlockByNumber",
+			"traceBlockByHash",
+			"traceBlock",
+			"traceBadBlock",
+			"intermediateRoots",
+			"traceTransaction",
+			"traceCall",
+		},
+	},
+	"debug-db": {
+		"public-debug": {
+			"dumpBlock",
+			"accountRange",
+		},
+		"private-debug": {
+			"preimage",
+			"getBadBlocks",
+			"storageRangeAt",
+			"getModifiedAccountsByNumber",
+			"getModifiedAccountsByHash",
+			"getAccessibleState",
+			"verifyBlock",
+		},
+		"internal-public-debug": {
+			"getHeaderRlp",
+			"getBlockRlp",
+			"printBlock",
+		},
+		"internal-private-debug": {
+			"chaindbProperty",
+			"chaindbCompact",
+		},
+	},
+	"debug-handler": {
+		"debug-handler": {
+			"verbosity",
+			"vmodule",
+			"backtraceAt",
+			"memStats",
+			"gcStats",
+			"cpuProfile",
+			"startCPUProfile",
+			"stopCPUProfile",
+			"goTrace",
+			"startGoTrace",
+			"stopGoTrace",
+			"blockProfile",
+			"setBlockProfileRate",
+			"writeBlockProfile",
+			"mutexProfile",
+			"setMutexProfileFraction",
+			"writeMutexProfile",
+			"writeMemProfile",
+			"stacks",
+			"freeOSMemory",
+			"setGCPercent",
+		},
+	},
+	"eth-filter": {
+		"public-eth-filter": {
+			"newPendingTransactionFilter",
+			"newPendingTransactions",
+			"newAcceptedTransactions",
+			"includedTransactions",
+			"newBlockFilter",
+			"newHeads",
+			"logs",
+			"newFilter",
+			"uninstallFilter",
+			"getFilterLogs",
+			"getFilterChanges",
+		},
+	},
+	"eth-history": {
+		"public-eth-filter": {
+			"getLogs",
+		},
+		"internal-public-eth": {
+			"feeHistory",
+		},
+	},
+}
+
+// ethAPIMethods returns the union of the methods exposed by [groups], keyed
+// by the name of the API service that provides them. An error is returned if
+// any of [groups] is not a known method group.
+func ethAPIMethods(groups []string) (map[string][]string, error) {
+	methods := make(map[string][]string)
+	for _, group := range groups {
+		services, ok := ethAPIMethodGroups[group]
+		if !ok {
+			return nil, fmt.Errorf("unknown eth API method group %q (known groups: %v)", group, knownEthAPIMethodGroups())
+		}
+		for service, serviceMethods := range services {
+			methods[service] = append(methods[service], serviceMethods...)
+		}
+	}
+	return methods, nil
+}
+
+func knownEthAPIMethodGroups() []string {
+	groups := make([]string, 0, len(ethAPIMethodGroups))
+	for group := range ethAPIMethodGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
@@ -0,0 +1,221 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/database"
+
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// [approvalsMaxPageSize] is the maximum number of approvals returned by a call
+// to eth_getApprovals.
+const approvalsMaxPageSize = 1000
+
+var (
+	// Prefixes of the approval index in [vm.db]
+	approvalIndexPrefix     = []byte("approval_index")
+	approvalIndexMetaPrefix = []byte("approval_index_meta")
+
+	// [approvalIndexFromKey] holds the first height of the accepted blocks
+	// indexed without a gap, and [approvalIndexLastKey] the last one.
+	approvalIndexFromKey = []byte("from")
+	approvalIndexLastKey = []byte("last")
+
+	// approvalTopic is the topic of the ERC-20 Approval event
+	approvalTopic = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+	errApprovalIndexOff       = errors.New("approval index is disabled")
+	errInvalidApprovalsCursor = fmt.Errorf("cursor must be %d bytes", 2*common.AddressLength)
+)
+
+// approvalIndex indexes the ERC-20 Approval events of the accepted blocks, by
+// owner, token and spender. An entry holds the amount of the last Approval
+// event of its owner, token and spender, and an approval to zero removes it,
+// so that the entries of an owner are the tokens it currently approves a
+// spender for.
+//
+// The index is written to [vm.db] on Accept, so that it is committed with the
+// accepted blocks. It covers the blocks accepted while it is enabled, from the
+// height reported as [approvalIndexFromKey].
+type approvalIndex struct {
+	lock sync.RWMutex
+
+	db     database.Database
+	metaDB database.Database
+
+	from uint64
+	// [fromStored] is false until [from] is written with the first indexed
+	// block.
+	fromStored bool
+}
+
+// newApprovalIndex returns the approval index held in [db] and [metaDB], or a
+// new one indexing the blocks accepted after [lastAccepted]. If blocks were
+// accepted while the index was disabled, the index is continued from the
+// block after [lastAccepted], keeping the entries indexed before the gap.
+func newApprovalIndex(db, metaDB database.Database, lastAccepted uint64) (*approvalIndex, error) {
+	idx := &approvalIndex{db: db, metaDB: metaDB, from: lastAccepted + 1}
+	from, err := database.GetUInt64(metaDB, approvalIndexFromKey)
+	if err == database.ErrNotFound {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	last, err := database.GetUInt64(metaDB, approvalIndexLastKey)
+	if err != nil {
+		return nil, err
+	}
+	if last != lastAccepted {
+		log.Warn("Approval index has a gap, continuing from the last accepted block", "lastIndexed", last, "lastAccepted", lastAccepted)
+		return idx, nil
+	}
+	idx.from, idx.fromStored = from, true
+	return idx, nil
+}
+
+// approvalKey is the key of the entry of [owner], [token] and [spender].
+func approvalKey(owner, token, spender common.Address) []byte {
+	key := make([]byte, 0, 3*common.AddressLength)
+	key = append(key, owner[:]...)
+	key = append(key, token[:]...)
+	return append(key, spender[:]...)
+}
+
+// approvalValue encodes the [amount] approved by the tx [txHash] of the block
+// [number].
+func approvalValue(amount common.Hash, number uint64, txHash common.Hash) []byte {
+	value := make([]byte, 2*common.HashLength+8)
+	copy(value, amount[:])
+	binary.BigEndian.PutUint64(value[common.HashLength:], number)
+	copy(value[common.HashLength+8:], txHash[:])
+	return value
+}
+
+// index records the Approval events of the successful txs of the accepted
+// [block] with [receipts], in the order they were emitted.
+func (idx *approvalIndex) index(block *types.Block, receipts types.Receipts) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	number := block.NumberU64()
+	for _, receipt := range receipts {
+		// The logs of reverted txs are discarded by the EVM, this only
+		// enforces that their events are never indexed
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		for _, l := range receipt.Logs {
+			// ERC-721 Approval events share the topic, with the token ID
+			// as a fourth topic and no data
+			if len(l.Topics) != 3 || l.Topics[0] != approvalTopic || len(l.Data) != common.HashLength {
+				continue
+			}
+			key := approvalKey(common.BytesToAddress(l.Topics[1][:]), l.Address, common.BytesToAddress(l.Topics[2][:]))
+			amount := common.BytesToHash(l.Data)
+			if amount == (common.Hash{}) {
+				if err := idx.db.Delete(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := idx.db.Put(key, approvalValue(amount, number, receipt.TxHash)); err != nil {
+				return err
+			}
+		}
+	}
+	if !idx.fromStored {
+		if err := database.PutUInt64(idx.metaDB, approvalIndexFromKey, idx.from); err != nil {
+			return err
+		}
+		idx.fromStored = true
+	}
+	return database.PutUInt64(idx.metaDB, approvalIndexLastKey, number)
+}
+
+// Approval is the last approval of a spender for a token by an owner.
+type Approval struct {
+	Token       common.Address `json:"token"`
+	Spender     common.Address `json:"spender"`
+	Amount      *hexutil.Big   `json:"amount"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	TxHash      common.Hash    `json:"transactionHash"`
+}
+
+// ApprovalsPage is a page of the approvals of an owner.
+type ApprovalsPage struct {
+	// FromBlock is the first block indexed, the approvals of earlier blocks
+	// are not reported
+	FromBlock hexutil.Uint64 `json:"fromBlock"`
+	Approvals []Approval     `json:"approvals"`      // Ordered by token, then spender
+	Next      hexutil.Bytes  `json:"next,omitempty"` // nil if no more approvals
+}
+
+// approvals returns up to [pageSize] approvals of [owner], starting at the
+// token and spender held in [cursor], if any.
+func (idx *approvalIndex) approvals(owner common.Address, pageSize int, cursor []byte) (*ApprovalsPage, error) {
+	if len(cursor) != 0 && len(cursor) != 2*common.AddressLength {
+		return nil, errInvalidApprovalsCursor
+	}
+	if pageSize <= 0 || pageSize > approvalsMaxPageSize {
+		pageSize = approvalsMaxPageSize
+	}
+
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	start := append(append([]byte{}, owner[:]...), cursor...)
+	it := idx.db.NewIteratorWithStartAndPrefix(start, owner[:])
+	defer it.Release()
+
+	page := &ApprovalsPage{FromBlock: hexutil.Uint64(idx.from), Approvals: []Approval{}}
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if len(key) != 3*common.AddressLength || len(value) != 2*common.HashLength+8 {
+			return nil, fmt.Errorf("malformed approval %x", key)
+		}
+		if len(page.Approvals) == pageSize {
+			page.Next = common.CopyBytes(key[common.AddressLength:])
+			break
+		}
+		page.Approvals = append(page.Approvals, Approval{
+			Token:       common.BytesToAddress(key[common.AddressLength : 2*common.AddressLength]),
+			Spender:     common.BytesToAddress(key[2*common.AddressLength:]),
+			Amount:      (*hexutil.Big)(new(big.Int).SetBytes(value[:common.HashLength])),
+			BlockNumber: hexutil.Uint64(binary.BigEndian.Uint64(value[common.HashLength : common.HashLength+8])),
+			TxHash:      common.BytesToHash(value[common.HashLength+8:]),
+		})
+	}
+	return page, it.Error()
+}
+
+// ApprovalIndexAPI serves the approval index in the eth namespace.
+type ApprovalIndexAPI struct{ vm *VM }
+
+// GetApprovals returns up to [pageSize] of the tokens and spenders [owner]
+// approved a non-zero amount for in the last Approval event of each, starting
+// at [cursor], the Next field of a previous page.
+func (api *ApprovalIndexAPI) GetApprovals(ctx context.Context, owner common.Address, pageSize int, cursor *hexutil.Bytes) (*ApprovalsPage, error) {
+	if api.vm.approvalIndex == nil {
+		return nil, errApprovalIndexOff
+	}
+	var start []byte
+	if cursor != nil {
+		start = *cursor
+	}
+	return api.vm.approvalIndex.approvals(owner, pageSize, start)
+}
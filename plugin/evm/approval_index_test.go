@@ -0,0 +1,152 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// approverInitCode deploys a token emitting Approval(caller, spender, amount)
+// for the calldata (spender, amount), and reverting if amount is 0xdead.
+var approverInitCode = common.FromHex("0x603e80600b6000396000f3" +
+	"6020358061dead14603957600052600035337f" +
+	ethcrypto.Keccak256Hash([]byte("Approval(address,address,uint256)")).Hex()[2:] + "60206000a3005b600080fd")
+
+// newKeys returns [n] new keys and their addresses.
+func newKeys(t *testing.T, n int) ([]*crypto.PrivateKeySECP256K1R, []common.Address) {
+	var (
+		factory = crypto.FactorySECP256K1R{}
+		keys    = make([]*crypto.PrivateKeySECP256K1R, n)
+		addrs   = make([]common.Address, n)
+	)
+	for i := range keys {
+		key, err := factory.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key.(*crypto.PrivateKeySECP256K1R)
+		addrs[i] = evm.GetEthAddress(keys[i])
+	}
+	return keys, addrs
+}
+
+func TestApprovalIndex(t *testing.T) {
+	tvm := testutils.NewTestVM(t, `{"approval-index-enabled":true}`, testutils.GenesisJSON(params.TestApricotPhase2Config))
+	client := tvm.Client()
+	keys, owners := newKeys(t, 2)
+
+	// Fund both owners and deploy two tokens
+	for _, owner := range owners {
+		tvm.FundAddress(owner, 500000000)
+		tvm.BuildAndAccept(t)
+	}
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	tvm.SendTx(t, types.NewContractCreation(0, common.Big0, 100_000, gasPrice, approverInitCode), keys[0])
+	tvm.SendTx(t, types.NewContractCreation(1, common.Big0, 100_000, gasPrice, approverInitCode), keys[0])
+	tvm.BuildAndAccept(t)
+	tokenA, tokenB := ethcrypto.CreateAddress(owners[0], 0), ethcrypto.CreateAddress(owners[0], 1)
+	spender1, spender2 := common.HexToAddress("0x0100000000000000000000000000000000000001"), common.HexToAddress("0x0100000000000000000000000000000000000002")
+
+	nonces := []uint64{2, 0}
+	approve := func(owner int, token, spender common.Address, amount int64) *types.Transaction {
+		data := append(common.LeftPadBytes(spender[:], 32), common.LeftPadBytes(big.NewInt(amount).Bytes(), 32)...)
+		tx := tvm.SendTx(t, types.NewTransaction(nonces[owner], token, common.Big0, 50_000, gasPrice, data), keys[owner])
+		nonces[owner]++
+		return tx
+	}
+	approve(0, tokenA, spender1, 100)
+	approve(0, tokenA, spender2, 5)
+	approve(0, tokenB, spender1, 7)
+	approve(1, tokenA, spender1, 9)
+	approvedBlk := tvm.BuildAndAccept(t)
+	// Revoke an approval, raise another, fail to change a third with a
+	// reverted tx and approve a new one
+	changes := []*types.Transaction{
+		approve(0, tokenA, spender2, 0),
+		approve(0, tokenA, spender1, 250),
+		approve(0, tokenB, spender1, 0xdead),
+		approve(1, tokenB, spender2, 3),
+	}
+	reverted := changes[2]
+	changedBlk := tvm.BuildAndAccept(t)
+	for _, tx := range changes {
+		var receipt *types.Receipt
+		if err := client.Call(&receipt, "eth_getTransactionReceipt", tx.Hash()); err != nil {
+			t.Fatal(err)
+		}
+		if receipt == nil || receipt.BlockNumber.Uint64() != changedBlk.Height() {
+			t.Fatalf("Expected tx %s to be accepted in block %d, found %+v", tx.Hash(), changedBlk.Height(), receipt)
+		}
+		if failed := receipt.Status == types.ReceiptStatusFailed; failed != (tx.Hash() == reverted.Hash()) {
+			t.Fatalf("Expected only tx %s to revert, found %+v", reverted.Hash(), receipt)
+		}
+	}
+
+	type approval struct {
+		token, spender common.Address
+		amount         int64
+		number         uint64
+	}
+	tests := map[int][]approval{
+		0: {
+			{tokenA, spender1, 250, changedBlk.Height()},
+			{tokenB, spender1, 7, approvedBlk.Height()},
+		},
+		1: {
+			{tokenA, spender1, 9, approvedBlk.Height()},
+			{tokenB, spender2, 3, changedBlk.Height()},
+		},
+	}
+	for owner, expected := range tests {
+		sort.Slice(expected, func(i, j int) bool { return bytes.Compare(expected[i].token[:], expected[j].token[:]) < 0 })
+
+		// Page through the approvals one at a time
+		var (
+			found  []evm.Approval
+			cursor []byte
+		)
+		for {
+			page := &evm.ApprovalsPage{}
+			args := []interface{}{owners[owner], 1}
+			if cursor != nil {
+				args = append(args, hexutil.Bytes(cursor))
+			}
+			if err := client.Call(page, "eth_getApprovals", args...); err != nil {
+				t.Fatal(err)
+			}
+			if page.FromBlock != 1 {
+				t.Fatalf("Expected the index to start at block 1, found %d", page.FromBlock)
+			}
+			found = append(found, page.Approvals...)
+			if page.Next == nil {
+				break
+			}
+			if len(page.Approvals) != 1 {
+				t.Fatalf("Expected a page of 1 approval, found %d", len(page.Approvals))
+			}
+			cursor = page.Next
+		}
+		if len(found) != len(expected) {
+			t.Fatalf("Expected %d approvals of owner %d, found %+v", len(expected), owner, found)
+		}
+		for i, approval := range expected {
+			if found[i].Token != approval.token || found[i].Spender != approval.spender || found[i].Amount.ToInt().Int64() != approval.amount || uint64(found[i].BlockNumber) != approval.number {
+				t.Fatalf("Expected approval %d of owner %d to be %+v, found %+v", i, owner, approval, found[i])
+			}
+		}
+	}
+}
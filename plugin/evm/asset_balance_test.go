@@ -0,0 +1,114 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+
+	"github.com/zsmartex/coreth/core/state"
+	corevm "github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestGetAssetBalance(t *testing.T) {
+	issuer, vm, _, sharedMemory, _ := GenesisVM(t, true, genesisJSONApricotPhase5, `{"pruning-enabled":false,"preimages-enabled":true}`, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-blockchain", "public-debug"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	// Import [assetAmounts] of [assetID] in consecutive blocks, along with
+	// AVAX to pay fees covering the block fee of consecutive blocks
+	var (
+		assetID      = ids.GenerateTestID()
+		otherAssetID = ids.GenerateTestID()
+		assetAmounts = []uint64{1000, 500}
+	)
+	for _, amount := range assetAmounts {
+		txID := ids.GenerateTestID()
+		if _, err := addUTXO(sharedMemory, vm.ctx, txID, 0, vm.ctx.AVAXAssetID, 50000000000, testShortIDAddrs[0]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := addUTXO(sharedMemory, vm.ctx, txID, 1, assetID, amount, testShortIDAddrs[0]); err != nil {
+			t.Fatal(err)
+		}
+		importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], new(big.Int).Mul(big.NewInt(100), initialBaseFee), testKeys[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		buildAndAcceptBlock(t, issuer, vm)
+	}
+
+	// The balances match the precompile at each block, including for the
+	// assets never held
+	expected := new(big.Int)
+	for height := 0; height <= len(assetAmounts); height++ {
+		if height > 0 {
+			expected.Add(expected, new(big.Int).SetUint64(assetAmounts[height-1]))
+		}
+		blockNumber := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(height))
+		for _, addr := range []common.Address{testEthAddrs[0], testEthAddrs[1]} {
+			for _, id := range []ids.ID{assetID, otherAssetID} {
+				var balance hexutil.Big
+				if err := client.Call(&balance, "eth_getAssetBalance", addr, blockNumber, id); err != nil {
+					t.Fatal(err)
+				}
+				var ret hexutil.Bytes
+				args := map[string]interface{}{
+					"to":   corevm.NativeAssetBalanceAddr,
+					"data": hexutil.Bytes(corevm.PackNativeAssetBalanceInput(addr, common.Hash(id))),
+				}
+				if err := client.Call(&ret, "eth_call", args, blockNumber); err != nil {
+					t.Fatal(err)
+				}
+				if precompileBalance := new(big.Int).SetBytes(ret); balance.ToInt().Cmp(precompileBalance) != 0 {
+					t.Fatalf("Expected balance %d of %s at height %d to match the precompile balance %d", balance.ToInt(), addr, height, precompileBalance)
+				}
+				if addr == testEthAddrs[0] && id == assetID && balance.ToInt().Cmp(expected) != 0 {
+					t.Fatalf("Expected balance %d at height %d, found %d", expected, height, balance.ToInt())
+				}
+			}
+		}
+	}
+
+	// Malformed and empty asset IDs are rejected
+	var balance hexutil.Big
+	for _, id := range []interface{}{"not an asset ID", nil} {
+		if err := client.Call(&balance, "eth_getAssetBalance", testEthAddrs[0], "latest", id); err == nil {
+			t.Fatalf("Expected asset ID %v to be rejected", id)
+		}
+	}
+
+	// The asset balances are dumped if requested
+	dump := func(assetIDs []common.Hash) state.DumpAccount {
+		var result state.IteratorDump
+		if err := client.Call(&result, "debug_accountRange", "latest", []byte{}, 0, true, true, false, assetIDs); err != nil {
+			t.Fatal(err)
+		}
+		return result.Accounts[testEthAddrs[0]]
+	}
+	if account := dump(nil); account.AssetBalances != nil {
+		t.Fatalf("Expected no asset balances, found %v", account.AssetBalances)
+	}
+	account := dump([]common.Hash{common.Hash(assetID), common.Hash(otherAssetID)})
+	if len(account.AssetBalances) != 1 || account.AssetBalances[common.Hash(assetID)] != expected.String() {
+		t.Fatalf("Expected asset balances {%s: %s}, found %v", common.Hash(assetID), expected, account.AssetBalances)
+	}
+}
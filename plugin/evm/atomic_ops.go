@@ -0,0 +1,45 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"math/big"
+
+	safemath "github.com/zsmartex/avalanchego/utils/math"
+)
+
+// atomicOpsCount returns the number of shared memory operations, puts and
+// removes, applied by [tx] when accepted.
+func atomicOpsCount(tx *Tx) (uint64, error) {
+	_, requests, err := tx.UnsignedAtomicTx.AtomicOps()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(requests.PutRequests) + len(requests.RemoveRequests)), nil
+}
+
+// verifyAtomicOpsLimit verifies that the atomic txs of [b] apply at most the
+// maximum number of shared memory operations per block, if it is limited at
+// the timestamp of [b].
+func (b *Block) verifyAtomicOpsLimit() error {
+	limit := b.vm.chainConfig.AtomicOpsLimit(new(big.Int).SetUint64(b.ethBlock.Time()))
+	if limit == 0 {
+		return nil
+	}
+	var totalOps uint64
+	for _, tx := range b.atomicTxs {
+		ops, err := atomicOpsCount(tx)
+		if err != nil {
+			return err
+		}
+		if totalOps, err = safemath.Add64(totalOps, ops); err != nil {
+			return err
+		}
+	}
+	if totalOps > limit {
+		return fmt.Errorf("%w: %d > %d", errTooManyAtomicOps, totalOps, limit)
+	}
+	return nil
+}
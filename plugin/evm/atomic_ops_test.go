@@ -0,0 +1,161 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/zsmartex/avalanchego/chains/atomic"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/hashing"
+	"github.com/zsmartex/avalanchego/utils/units"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/avalanchego/vms/components/chain"
+	"github.com/zsmartex/avalanchego/vms/secp256k1fx"
+
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// genesisJSONAtomicOpsLimit activates the atomic ops limit at [timestamp] with
+// a maximum of 3 shared memory operations per block.
+func genesisJSONAtomicOpsLimit(timestamp string) string {
+	return strings.Replace(genesisJSONApricotPhase5, `"apricotPhase5BlockTimestamp":0`,
+		`"apricotPhase5BlockTimestamp":0, "atomicOpsLimitBlockTimestamp":`+timestamp+`, "maxAtomicOpsPerBlock":3`, 1)
+}
+
+// newTestImportTxs returns import txs of the UTXOs added to [sharedMemory] of
+// [vm], where each tx imports the number of UTXOs of [sizes]. The txs pay a
+// fee high enough to cover the block fee of consecutive blocks.
+func newTestImportTxs(t *testing.T, vm *VM, sharedMemory *atomic.Memory, sizes ...int) []*Tx {
+	kc := secp256k1fx.NewKeychain()
+	kc.Add(testKeys[0])
+	txID, err := ids.ToID(hashing.ComputeHash256(testShortIDAddrs[0][:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		txs   []*Tx
+		index uint32
+	)
+	for _, size := range sizes {
+		var utxos []*avax.UTXO
+		for i := 0; i < size; i++ {
+			utxo, err := addUTXO(sharedMemory, vm.ctx, txID, index, vm.ctx.AVAXAssetID, units.Avax, testShortIDAddrs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			utxos = append(utxos, utxo)
+			index++
+		}
+		tx, err := vm.newImportTxWithUTXOs(vm.ctx.XChainID, testEthAddrs[0], new(big.Int).Mul(big.NewInt(100), initialBaseFee), kc, utxos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func TestAtomicOpsLimit(t *testing.T) {
+	issuer, vm, _, sharedMemory, _ := GenesisVM(t, true, genesisJSONAtomicOpsLimit("0"), "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// A block can use exactly the whole budget
+	txs := newTestImportTxs(t, vm, sharedMemory, 3, 2, 2)
+	if err := vm.issueTx(txs[0], true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	if atomicTxs := blk.(*chain.BlockWrapper).Block.(*Block).atomicTxs; len(atomicTxs) != 1 {
+		t.Fatalf("Expected 1 atomic tx in the block, found %d", len(atomicTxs))
+	}
+	if count, max := vm.atomicOpsHistogram.Count(), vm.atomicOpsHistogram.Max(); count != 1 || max != 3 {
+		t.Fatalf("Expected the 3 ops of 1 block to be recorded, found %d blocks up to %d ops", count, max)
+	}
+
+	// Txs over the remaining budget are left for the next block
+	for _, tx := range txs[1:] {
+		if err := vm.issueTx(tx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		blk := buildAndAcceptBlock(t, issuer, vm)
+		if atomicTxs := blk.(*chain.BlockWrapper).Block.(*Block).atomicTxs; len(atomicTxs) != 1 {
+			t.Fatalf("Expected 1 atomic tx in block %d, found %d", i, len(atomicTxs))
+		}
+	}
+	if vm.mempool.Len() != 0 {
+		t.Fatalf("Expected the mempool to be empty, found %d txs", vm.mempool.Len())
+	}
+}
+
+func TestAtomicOpsLimitRejectsBlock(t *testing.T) {
+	// Blocks are built without the limit by [vm1] and parsed with it by [vm2]
+	issuer1, vm1, _, sharedMemory1, _ := GenesisVM(t, true, genesisJSONApricotPhase5, "", "")
+	_, vm2, _, _, _ := GenesisVM(t, true, genesisJSONAtomicOpsLimit("0"), "", "")
+	defer func() {
+		if err := vm1.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm2.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for _, tx := range newTestImportTxs(t, vm1, sharedMemory1, 2, 2) {
+		if err := vm1.issueTx(tx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-issuer1
+	blk, err := vm1.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomicTxs := blk.(*chain.BlockWrapper).Block.(*Block).atomicTxs; len(atomicTxs) != 2 {
+		t.Fatalf("Expected 2 atomic txs in the block, found %d", len(atomicTxs))
+	}
+	if _, err := vm2.ParseBlock(blk.Bytes()); !errors.Is(err, errTooManyAtomicOps) {
+		t.Fatalf("Expected the block to be rejected with %q, found %v", errTooManyAtomicOps, err)
+	}
+}
+
+func TestAtomicOpsLimitActivation(t *testing.T) {
+	_, vm, _, sharedMemory, _ := GenesisVM(t, false, genesisJSONAtomicOpsLimit("100"), "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	txs := newTestImportTxs(t, vm, sharedMemory, 2, 2, 1)
+	tests := map[string]struct {
+		timestamp uint64
+		atomicTxs []*Tx
+		err       error
+	}{
+		"before activation":             {99, txs[:2], nil},
+		"at activation":                 {100, txs[:2], errTooManyAtomicOps},
+		"after activation":              {101, txs[:2], errTooManyAtomicOps},
+		"exact budget at activation":    {100, []*Tx{txs[0], txs[2]}, nil},
+		"exact budget after activation": {101, []*Tx{txs[0], txs[2]}, nil},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := &types.Header{Number: big.NewInt(1), Time: test.timestamp}
+			blk := &Block{vm: vm, ethBlock: types.NewBlockWithHeader(header), atomicTxs: test.atomicTxs}
+			if err := blk.verifyAtomicOpsLimit(); !errors.Is(err, test.err) {
+				t.Fatalf("Expected %v, found %v", test.err, err)
+			}
+		})
+	}
+}
@@ -64,6 +64,11 @@ type AtomicTrie interface {
 	// common.Hash{} instead
 	Root(height uint64) (common.Hash, error)
 
+	// CommittedRoot returns the root and height of the most recent commit at
+	// or before [height]. Returns an error wrapping errAtomicTrieRootPruned
+	// if no root is retained at or before [height].
+	CommittedRoot(height uint64) (common.Hash, uint64, error)
+
 	// ApplyToSharedMemory applies the atomic operations that have been indexed into the trie
 	// but not yet applied to shared memory for heights less than or equal to [lastAcceptedBlock].
 	// This executes operations in the range [cursorHeight+1, lastAcceptedBlock].
@@ -77,6 +82,11 @@ type AtomicTrie interface {
 	// from [previousLastAcceptedHeight+1] to the [lastAcceptedHeight] set by state sync
 	// will not have been executed on shared memory.
 	MarkApplyToSharedMemoryCursor(previousLastAcceptedHeight uint64) error
+
+	// ClearCommitMarker clears the marker of the last commit, if it is still set.
+	// Must be called once the versiondb holding the commit has been written to
+	// the database.
+	ClearCommitMarker() error
 }
 
 // AtomicTrieIterator is a stateful iterator that iterates the leafs of an AtomicTrie
@@ -110,6 +120,7 @@ type atomicTrie struct {
 	db                   *versiondb.Database // Underlying database
 	bonusBlocks          map[uint64]ids.ID   // Map of height to blockID for blocks to skip indexing
 	metadataDB           database.Database   // Underlying database containing the atomic trie metadata
+	baseMetadataDB       database.Database   // Atomic trie metadata in the database below [db], containing the commit marker
 	atomicTrieDB         database.Database   // Underlying database containing the atomic trie
 	trieDB               *trie.Database      // Trie database
 	trie                 *trie.Trie          // Atomic trie.Trie mapping key (height+blockchainID) and value (codec serialized atomic.Requests)
@@ -119,6 +130,7 @@ type atomicTrie struct {
 	codec                codec.Manager
 	log                  log.Logger // struct logger
 	sharedMemory         atomic.SharedMemory
+	markerSet            bool // whether the marker of the last commit is set in [baseMetadataDB]
 }
 
 var _ AtomicTrie = &atomicTrie{}
@@ -143,6 +155,7 @@ func newAtomicTrie(
 ) (*atomicTrie, error) {
 	atomicTrieDB := prefixdb.New(atomicTrieDBPrefix, db)
 	metadataDB := prefixdb.New(atomicTrieMetaDBPrefix, db)
+	baseMetadataDB := prefixdb.New(atomicTrieMetaDBPrefix, db.GetDatabase())
 	root, height, err := lastCommittedRootIfExists(metadataDB)
 	if err != nil {
 		return nil, err
@@ -155,6 +168,24 @@ func newAtomicTrie(
 			Preimages: false, // Keys are not hashed, so there is no need for preimages
 		},
 	)
+	// A commit interrupted by a crash is recovered before the trie is opened
+	// at its root, which may be missing nodes
+	marker, err := readCommitMarker(baseMetadataDB)
+	if err != nil {
+		return nil, err
+	}
+	rolledBack := false
+	if marker != nil {
+		if root, height, rolledBack, err = recoverCommit(metadataDB, triedb, marker); err != nil {
+			return nil, fmt.Errorf("failed to recover the atomic trie commit at height %d: %w", marker.height, err)
+		}
+		if err := db.Commit(); err != nil {
+			return nil, err
+		}
+		if err := baseMetadataDB.Delete(commitInProgressKey); err != nil {
+			return nil, err
+		}
+	}
 	t, err := trie.New(root, triedb)
 	if err != nil {
 		return nil, err
@@ -166,6 +197,7 @@ func newAtomicTrie(
 		bonusBlocks:          bonusBlocks,
 		atomicTrieDB:         atomicTrieDB,
 		metadataDB:           metadataDB,
+		baseMetadataDB:       baseMetadataDB,
 		trieDB:               triedb,
 		trie:                 t,
 		repo:                 repo,
@@ -183,7 +215,15 @@ func newAtomicTrie(
 	if err := atomicTrie.ApplyToSharedMemory(lastAcceptedHeight); err != nil {
 		return nil, err
 	}
-	return atomicTrie, atomicTrie.initialize(lastAcceptedHeight)
+	if err := atomicTrie.initialize(lastAcceptedHeight); err != nil {
+		return nil, err
+	}
+	// The commit rolled back is replayed by [initialize] from the atomic tx
+	// repository, to the root it was interrupted at
+	if rolledBack && atomicTrie.lastCommittedHeight == marker.height && atomicTrie.lastCommittedHash != marker.root {
+		return nil, fmt.Errorf("replayed atomic trie root %s at height %d does not match the interrupted commit %s", atomicTrie.lastCommittedHash, marker.height, marker.root)
+	}
+	return atomicTrie, nil
 }
 
 // lastCommittedRootIfExists returns the last committed trie root and height if it exists
@@ -295,11 +335,16 @@ func (a *atomicTrie) initialize(lastAcceptedBlockNumber uint64) error {
 			storage, _ := a.trieDB.Size()
 			if storage > trieCommitSizeCap {
 				a.log.Info("committing atomic trie progress", "storage", storage)
-				a.commit(commitHeight)
+				if err := a.commit(commitHeight); err != nil {
+					return err
+				}
 				// Flush any remaining changes that have not been committed yet in the versiondb.
 				if err := a.db.Commit(); err != nil {
 					return err
 				}
+				if err := a.ClearCommitMarker(); err != nil {
+					return err
+				}
 			}
 			lastHash = hash
 			lastHeight = commitHeight
@@ -322,6 +367,9 @@ func (a *atomicTrie) initialize(lastAcceptedBlockNumber uint64) error {
 	if err := a.db.Commit(); err != nil {
 		return err
 	}
+	if err := a.ClearCommitMarker(); err != nil {
+		return err
+	}
 
 	// process uncommitted ops for heights > finalCommitHeight
 	for height, ops := range uncommittedOpsMap {
@@ -385,6 +433,8 @@ func (a *atomicTrie) validateIndexHeight(height uint64) error {
 
 // commit calls commit on the trie to generate a root, commits the underlying trieDB, and updates the
 // metadata pointers.
+// The commit is marked in progress in the database below the versiondb until ClearCommitMarker is called
+// once the versiondb is written, so that it is recovered at startup if the write is interrupted.
 // assumes that the caller is aware of the commit rules i.e. the height being within commitInterval.
 // returns the trie root from the commit
 func (a *atomicTrie) commit(height uint64) error {
@@ -393,15 +443,18 @@ func (a *atomicTrie) commit(height uint64) error {
 		return err
 	}
 
-	a.log.Info("committed atomic trie", "hash", hash.String(), "height", height)
-	if err := a.trieDB.Commit(hash, false, nil); err != nil {
+	marker := &commitMarker{height: height, root: hash, prevHeight: a.lastCommittedHeight, prevRoot: a.lastCommittedHash}
+	if err := a.baseMetadataDB.Put(commitInProgressKey, marker.bytes()); err != nil {
 		return err
 	}
+	a.markerSet = true
 
-	if err := a.UpdateLastCommitted(hash, height); err != nil {
+	a.log.Info("committed atomic trie", "hash", hash.String(), "height", height)
+	if err := a.trieDB.Commit(hash, false, nil); err != nil {
 		return err
 	}
-	return nil
+
+	return a.UpdateLastCommitted(hash, height)
 }
 
 func (a *atomicTrie) updateTrie(height uint64, atomicOps map[ids.ID]*atomic.Requests) error {
@@ -414,10 +467,7 @@ func (a *atomicTrie) updateTrie(height uint64, atomicOps map[ids.ID]*atomic.Requ
 		}
 
 		// key is [height]+[blockchainID]
-		keyPacker := wrappers.Packer{Bytes: make([]byte, wrappers.LongLen+common.HashLength)}
-		keyPacker.PackLong(height)
-		keyPacker.PackFixedBytes(blockchainID[:])
-		if err := a.trie.TryUpdate(keyPacker.Bytes, valueBytes); err != nil {
+		if err := a.trie.TryUpdate(atomicTrieKey(height, blockchainID), valueBytes); err != nil {
 			return err
 		}
 	}
@@ -433,22 +483,26 @@ func (a *atomicTrie) LastCommitted() (common.Hash, uint64) {
 // UpdateLastCommitted adds [height] -> [root] to the index and marks it as the last committed
 // root/height pair.
 func (a *atomicTrie) UpdateLastCommitted(root common.Hash, height uint64) error {
-	heightBytes := make([]byte, wrappers.LongLen)
-	binary.BigEndian.PutUint64(heightBytes, height)
-
-	// now save the trie hash against the height it was committed at
-	if err := a.metadataDB.Put(heightBytes, root[:]); err != nil {
+	if err := putLastCommitted(a.metadataDB, root, height); err != nil {
 		return err
 	}
+	a.lastCommittedHash = root
+	a.lastCommittedHeight = height
+	return nil
+}
 
-	// update lastCommittedKey with the current height
-	if err := a.metadataDB.Put(lastCommittedKey, heightBytes); err != nil {
+// putLastCommitted adds [height] -> [root] to the index of [db] and marks it as
+// the last committed root/height pair.
+func putLastCommitted(db database.Database, root common.Hash, height uint64) error {
+	heightBytes := commitHeightKey(height)
+
+	// now save the trie hash against the height it was committed at
+	if err := db.Put(heightBytes, root[:]); err != nil {
 		return err
 	}
 
-	a.lastCommittedHash = root
-	a.lastCommittedHeight = height
-	return nil
+	// update lastCommittedKey with the current height
+	return db.Put(lastCommittedKey, heightBytes)
 }
 
 // Iterator returns a types.AtomicTrieIterator that iterates the trie from the given
@@ -484,6 +538,53 @@ func (a *atomicTrie) Root(height uint64) (common.Hash, error) {
 	return common.BytesToHash(hash), nil
 }
 
+// CommittedRoot returns the root and height of the most recent commit at or
+// before [height]. Roots are retained from the oldest commit, which is the
+// height synced to if the node state synced, to the last commit. Commits may
+// skip commit heights without atomic operations, in which case the preceding
+// commit is returned.
+func (a *atomicTrie) CommittedRoot(height uint64) (common.Hash, uint64, error) {
+	if height >= a.lastCommittedHeight && a.lastCommittedHash != (common.Hash{}) {
+		return a.lastCommittedHash, a.lastCommittedHeight, nil
+	}
+	oldestHeight, found, err := a.oldestCommitHeight()
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	if !found {
+		return common.Hash{}, 0, fmt.Errorf("%w: no root is retained yet", errAtomicTrieRootPruned)
+	}
+	for commitHeight := nearestCommitHeight(height, a.commitHeightInterval); commitHeight >= oldestHeight; commitHeight -= a.commitHeightInterval {
+		root, err := a.Root(commitHeight)
+		if err != nil {
+			return common.Hash{}, 0, err
+		}
+		if root != (common.Hash{}) {
+			return root, commitHeight, nil
+		}
+		if commitHeight < a.commitHeightInterval {
+			break
+		}
+	}
+	return common.Hash{}, 0, fmt.Errorf("%w: height %d, roots are retained from height %d to %d", errAtomicTrieRootPruned, height, oldestHeight, a.lastCommittedHeight)
+}
+
+// oldestCommitHeight returns the height of the oldest root in the index, if
+// any.
+func (a *atomicTrie) oldestCommitHeight() (uint64, bool, error) {
+	iter := a.metadataDB.NewIterator()
+	defer iter.Release()
+
+	// Heights are the only keys of [wrappers.LongLen] bytes, and sort in
+	// ascending order as they are big endian
+	for iter.Next() {
+		if key := iter.Key(); len(key) == wrappers.LongLen {
+			return binary.BigEndian.Uint64(key), true, nil
+		}
+	}
+	return 0, false, iter.Error()
+}
+
 // ApplyToSharedMemory applies the atomic operations that have been indexed into the trie
 // but not yet applied to shared memory for heights less than or equal to [lastAcceptedBlock].
 // This executes operations in the range [cursorHeight+1, lastAcceptedBlock].
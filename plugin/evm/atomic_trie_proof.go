@@ -0,0 +1,124 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb/memorydb"
+	"github.com/zsmartex/coreth/trie"
+)
+
+var (
+	errAtomicTrieRootPruned         = errors.New("atomic trie root is not retained")
+	errAtomicTrieProofValueMismatch = errors.New("atomic trie proof does not match the value")
+)
+
+// AtomicTrieProof is a merkle proof of the value of [Key] in the atomic trie
+// root committed at [RootHeight], the most recent commit at or before the
+// requested height.
+//
+// [Value] is the codec serialized atomic.Requests applied to shared memory for
+// the blockchainID of [Key] by the block at the height of [Key], and is empty
+// if the trie does not contain [Key], in which case [Proof] proves its absence.
+type AtomicTrieProof struct {
+	Root       common.Hash     `json:"root"`
+	RootHeight json.Uint64     `json:"rootHeight"`
+	Key        hexutil.Bytes   `json:"key"`
+	Value      hexutil.Bytes   `json:"value"`
+	Proof      []hexutil.Bytes `json:"proof"`
+}
+
+// atomicTrieKey returns the key of the atomic operations of [blockchainID] at
+// [height] in the atomic trie.
+func atomicTrieKey(height uint64, blockchainID ids.ID) []byte {
+	keyPacker := wrappers.Packer{Bytes: make([]byte, atomicTrieKeyLen)}
+	keyPacker.PackLong(height)
+	keyPacker.PackFixedBytes(blockchainID[:])
+	return keyPacker.Bytes
+}
+
+// proveAtomicTrie returns the proof of [key] in the root of [atomicTrie]
+// committed at or before [height].
+func proveAtomicTrie(atomicTrie AtomicTrie, height uint64, key []byte) (*AtomicTrieProof, error) {
+	if len(key) != atomicTrieKeyLen {
+		return nil, fmt.Errorf("invalid atomic trie key length %d, expected %d", len(key), atomicTrieKeyLen)
+	}
+	root, rootHeight, err := atomicTrie.CommittedRoot(height)
+	if err != nil {
+		return nil, err
+	}
+	t, err := trie.New(root, atomicTrie.TrieDB())
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not open root %s at height %d: %v", errAtomicTrieRootPruned, root, rootHeight, err)
+	}
+	value, err := t.TryGet(key)
+	if err != nil {
+		return nil, err
+	}
+	proofDB := memorydb.New()
+	defer proofDB.Close()
+	if err := t.Prove(key, 0, proofDB); err != nil {
+		return nil, err
+	}
+
+	proof := &AtomicTrieProof{
+		Root:       root,
+		RootHeight: json.Uint64(rootHeight),
+		Key:        key,
+		Value:      value,
+	}
+	iter := proofDB.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		proof.Proof = append(proof.Proof, common.CopyBytes(iter.Value()))
+	}
+	return proof, iter.Error()
+}
+
+// getAtomicTrieProof returns the proof of [key] in the atomic trie root
+// committed at or before the accepted [height].
+func (vm *VM) getAtomicTrieProof(height uint64, key []byte) (*AtomicTrieProof, error) {
+	if lastAcceptedHeight := vm.chain.LastAcceptedBlock().NumberU64(); height > lastAcceptedHeight {
+		return nil, fmt.Errorf("height %d is above the last accepted height %d", height, lastAcceptedHeight)
+	}
+	return proveAtomicTrie(vm.atomicTrie, height, key)
+}
+
+// VerifyAtomicTrieProof returns the value proven by [proof] for its key in
+// the atomic trie with [root], which is nil if the key is proven absent.
+// Returns an error if [proof] does not prove its value in [root].
+func VerifyAtomicTrieProof(root common.Hash, proof *AtomicTrieProof) ([]byte, error) {
+	var value []byte
+	if root == types.EmptyRootHash && len(proof.Proof) == 0 {
+		// The empty trie has no nodes to prove the absence of the key
+	} else {
+		proofDB := memorydb.New()
+		defer proofDB.Close()
+		for _, node := range proof.Proof {
+			if err := proofDB.Put(crypto.Keccak256(node), node); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		value, err = trie.VerifyProof(root, proof.Key, proofDB)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.Equal(value, proof.Value) {
+		return nil, errAtomicTrieProofValueMismatch
+	}
+	return value, nil
+}
@@ -0,0 +1,139 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/zsmartex/avalanchego/chains/atomic"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/database/versiondb"
+	"github.com/zsmartex/avalanchego/ids"
+)
+
+func TestAtomicTrieProof(t *testing.T) {
+	db := versiondb.New(memdb.New())
+	repo, err := NewAtomicTxRepository(db, testTxCodec(), 0)
+	assert.NoError(t, err)
+	atomicTrie, err := newAtomicTrie(db, testSharedMemory(), nil, repo, testTxCodec(), 0, testCommitInterval)
+	assert.NoError(t, err)
+
+	// Index the atomic operations of heights 1 to 205, committing at 100 and
+	// 200, skipping the commit at 0 as a node state synced to 100 would
+	ops := make(map[uint64]map[ids.ID]*atomic.Requests)
+	for height := uint64(1); height <= testCommitInterval*2+5; height++ {
+		ops[height] = testDataImportTx().mustAtomicOps()
+		assert.NoError(t, atomicTrie.Index(height, ops[height]))
+	}
+	root100, err := atomicTrie.Root(testCommitInterval)
+	assert.NoError(t, err)
+	root200, err := atomicTrie.Root(testCommitInterval * 2)
+	assert.NoError(t, err)
+
+	key := func(height uint64) []byte {
+		for blockchainID := range ops[height] {
+			return atomicTrieKey(height, blockchainID)
+		}
+		t.Fatalf("no atomic operations at height %d", height)
+		return nil
+	}
+	value := func(height uint64) []byte {
+		for _, requests := range ops[height] {
+			valueBytes, err := testTxCodec().Marshal(codecVersion, requests)
+			assert.NoError(t, err)
+			return valueBytes
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name               string
+		height             uint64
+		key                []byte
+		expectedRoot       common.Hash
+		expectedRootHeight uint64
+		expectedValue      []byte
+	}{
+		{name: "present at commit height", height: 100, key: key(50), expectedRoot: root100, expectedRootHeight: 100, expectedValue: value(50)},
+		{name: "present between commit heights", height: 150, key: key(100), expectedRoot: root100, expectedRootHeight: 100, expectedValue: value(100)},
+		{name: "absent after the preceding commit", height: 150, key: key(150), expectedRoot: root100, expectedRootHeight: 100},
+		{name: "present after the last commit", height: 205, key: key(200), expectedRoot: root200, expectedRootHeight: 200, expectedValue: value(200)},
+		{name: "absent blockchainID", height: 200, key: atomicTrieKey(50, ids.GenerateTestID()), expectedRoot: root200, expectedRootHeight: 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof, err := proveAtomicTrie(atomicTrie, test.height, test.key)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedRoot, proof.Root)
+			assert.EqualValues(t, test.expectedRootHeight, proof.RootHeight)
+
+			// Proofs are verified by clients after a round trip through JSON
+			blob, err := json.Marshal(proof)
+			assert.NoError(t, err)
+			proof = &AtomicTrieProof{}
+			assert.NoError(t, json.Unmarshal(blob, proof))
+
+			value, err := VerifyAtomicTrieProof(proof.Root, proof)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, value)
+
+			// Proofs do not verify against another root
+			otherRoot := root200
+			if proof.Root == root200 {
+				otherRoot = root100
+			}
+			_, err = VerifyAtomicTrieProof(otherRoot, proof)
+			assert.Error(t, err)
+
+			// Nor with another value
+			tampered := *proof
+			tampered.Value = append([]byte{1}, proof.Value...)
+			_, err = VerifyAtomicTrieProof(proof.Root, &tampered)
+			assert.True(t, errors.Is(err, errAtomicTrieProofValueMismatch), "unexpected error %v", err)
+		})
+	}
+
+	// Heights before the oldest commit are refused with the retention window
+	_, err = proveAtomicTrie(atomicTrie, testCommitInterval-1, key(50))
+	assert.True(t, errors.Is(err, errAtomicTrieRootPruned), "unexpected error %v", err)
+	assert.Contains(t, err.Error(), "roots are retained from height 100 to 200")
+
+	_, err = proveAtomicTrie(atomicTrie, testCommitInterval, []byte{1, 2, 3})
+	assert.Error(t, err)
+}
+
+func TestGetAtomicTrieProof(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	service := &AvaxAPI{vm}
+	key := atomicTrieKey(1, vm.ctx.XChainID)
+	reply := &AtomicTrieProof{}
+	if err := service.GetAtomicTrieProof(nil, &GetAtomicTrieProofArgs{Height: 2, Key: key}, reply); err == nil {
+		t.Fatal("Expected a height above the last accepted height to be refused")
+	}
+	// The trie is first committed at the first commit height
+	if err := service.GetAtomicTrieProof(nil, &GetAtomicTrieProofArgs{Height: 1, Key: key}, reply); !errors.Is(err, errAtomicTrieRootPruned) {
+		t.Fatalf("Expected %v before the first commit, found %v", errAtomicTrieRootPruned, err)
+	}
+}
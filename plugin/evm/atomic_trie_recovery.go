@@ -0,0 +1,145 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+	"github.com/zsmartex/coreth/trie"
+)
+
+const commitMarkerLen = 2 * (wrappers.LongLen + common.HashLength)
+
+// commitInProgressKey holds the marker of the atomic trie commit in progress.
+// It is written straight to the database below the versiondb before the nodes
+// of the commit, and cleared once the versiondb holding the nodes and metadata
+// is written, which may be split across several writes, so that a commit
+// interrupted by a crash is recovered at startup.
+var commitInProgressKey = []byte("atomicTrieCommitInProgress")
+
+// commitMarker is the commit of the atomic trie at [height] to [root], in
+// progress, over the last commit at [prevHeight] to [prevRoot].
+type commitMarker struct {
+	height     uint64
+	root       common.Hash
+	prevHeight uint64
+	prevRoot   common.Hash
+}
+
+func (m *commitMarker) bytes() []byte {
+	b := make([]byte, 0, commitMarkerLen)
+	b = append(b, commitHeightKey(m.height)...)
+	b = append(b, m.root[:]...)
+	b = append(b, commitHeightKey(m.prevHeight)...)
+	return append(b, m.prevRoot[:]...)
+}
+
+// commitHeightKey returns the key of the root committed at [height] in the
+// atomic trie metadata, [height] in big endian.
+func commitHeightKey(height uint64) []byte {
+	b := make([]byte, wrappers.LongLen)
+	binary.BigEndian.PutUint64(b, height)
+	return b
+}
+
+// readCommitMarker returns the marker of the commit interrupted in [db], or
+// nil if there is none.
+func readCommitMarker(db database.Database) (*commitMarker, error) {
+	b, err := db.Get(commitInProgressKey)
+	switch {
+	case err == database.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case len(b) != commitMarkerLen:
+		return nil, fmt.Errorf("expected value of commitInProgressKey to be %d but was %d", commitMarkerLen, len(b))
+	}
+	const prevOffset = wrappers.LongLen + common.HashLength
+	return &commitMarker{
+		height:     binary.BigEndian.Uint64(b[:wrappers.LongLen]),
+		root:       common.BytesToHash(b[wrappers.LongLen:prevOffset]),
+		prevHeight: binary.BigEndian.Uint64(b[prevOffset : prevOffset+wrappers.LongLen]),
+		prevRoot:   common.BytesToHash(b[prevOffset+wrappers.LongLen:]),
+	}, nil
+}
+
+// recoverCommit recovers the commit of [marker], interrupted in [metadataDB],
+// and returns the last committed root and height. If the nodes of its root
+// were all written, the commit is finished. Otherwise the atomic trie is
+// rolled back to the previous root, and the atomic operations of the blocks
+// since are replayed from the atomic tx repository on initialization, in
+// which case [rolledBack] is true.
+func recoverCommit(metadataDB database.Database, triedb *trie.Database, marker *commitMarker) (root common.Hash, height uint64, rolledBack bool, err error) {
+	reachable, err := trieReachable(triedb, marker.root)
+	if err != nil {
+		return common.Hash{}, 0, false, err
+	}
+	if reachable {
+		log.Warn("Finishing the interrupted atomic trie commit", "height", marker.height, "root", marker.root)
+		if err := putLastCommitted(metadataDB, marker.root, marker.height); err != nil {
+			return common.Hash{}, 0, false, err
+		}
+		return marker.root, marker.height, false, nil
+	}
+
+	log.Warn("Rolling back the interrupted atomic trie commit", "height", marker.height, "root", marker.root, "prevHeight", marker.prevHeight, "prevRoot", marker.prevRoot)
+	committed, err := metadataDB.Get(commitHeightKey(marker.height))
+	switch {
+	case err == nil && common.BytesToHash(committed) == marker.root:
+		if err := metadataDB.Delete(commitHeightKey(marker.height)); err != nil {
+			return common.Hash{}, 0, false, err
+		}
+	case err != nil && err != database.ErrNotFound:
+		return common.Hash{}, 0, false, err
+	}
+	if marker.prevRoot == (common.Hash{}) {
+		// The trie was never committed before
+		err = metadataDB.Delete(lastCommittedKey)
+	} else {
+		err = putLastCommitted(metadataDB, marker.prevRoot, marker.prevHeight)
+	}
+	if err != nil {
+		return common.Hash{}, 0, false, err
+	}
+	return marker.prevRoot, marker.prevHeight, true, nil
+}
+
+// trieReachable returns whether all the nodes of the trie at [root] are in
+// [triedb].
+func trieReachable(triedb *trie.Database, root common.Hash) (bool, error) {
+	var missing *trie.MissingNodeError
+	t, err := trie.New(root, triedb)
+	if errors.As(err, &missing) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	it := t.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if err := it.Error(); errors.As(err, &missing) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ClearCommitMarker implements the AtomicTrie interface
+func (a *atomicTrie) ClearCommitMarker() error {
+	if !a.markerSet {
+		return nil
+	}
+	if err := a.baseMetadataDB.Delete(commitInProgressKey); err != nil {
+		return err
+	}
+	a.markerSet = false
+	return nil
+}
@@ -0,0 +1,230 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/zsmartex/avalanchego/chains/atomic"
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/database/versiondb"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/hashing"
+)
+
+var errFlushCrash = errors.New("crashed during the flush")
+
+// splitFlushDB is a database whose batches, once [persist] is set, write only
+// the keys it returns true for and then fail, as a flush split across several
+// writes that crashes partway through.
+type splitFlushDB struct {
+	database.Database
+	persist func(key []byte) bool
+}
+
+func (db *splitFlushDB) NewBatch() database.Batch {
+	return &splitFlushBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+type splitFlushBatch struct {
+	database.Batch
+	db *splitFlushDB
+}
+
+func (b *splitFlushBatch) Put(key, value []byte) error {
+	if b.db.persist != nil && !b.db.persist(key) {
+		return nil
+	}
+	return b.Batch.Put(key, value)
+}
+
+func (b *splitFlushBatch) Delete(key []byte) error {
+	if b.db.persist != nil && !b.db.persist(key) {
+		return nil
+	}
+	return b.Batch.Delete(key)
+}
+
+func (b *splitFlushBatch) Write() error {
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	if b.db.persist != nil {
+		return errFlushCrash
+	}
+	return nil
+}
+
+func TestAtomicTrieCommitRecovery(t *testing.T) {
+	const (
+		commitInterval = 10
+		// The flush of the commit at [crashHeight] crashes, with the blocks
+		// accepted before it committed at [commitInterval]
+		crashHeight = 2 * commitInterval
+	)
+	var (
+		nodesPrefix    = hashing.ComputeHash256(atomicTrieDBPrefix)
+		metadataPrefix = hashing.ComputeHash256(atomicTrieMetaDBPrefix)
+	)
+	for name, test := range map[string]struct {
+		// The keys of the trie nodes and metadata written by the flush
+		nodes, metadata func(key []byte) bool
+		// The commit crashing is the first one, without a previous root
+		firstCommit bool
+	}{
+		"nothing written":                  {nodes: persistNone, metadata: persistNone},
+		"nodes written without metadata":   {nodes: persistAll, metadata: persistNone},
+		"metadata written without nodes":   {nodes: persistNone, metadata: persistAll},
+		"metadata written with half nodes": {nodes: persistEvery(2), metadata: persistAll},
+		"everything written":               {nodes: persistAll, metadata: persistAll},
+		"first commit nothing written":     {nodes: persistNone, metadata: persistNone, firstCommit: true},
+		"first commit without nodes":       {nodes: persistNone, metadata: persistAll, firstCommit: true},
+		"first commit everything written":  {nodes: persistAll, metadata: persistAll, firstCommit: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			baseDB := &splitFlushDB{Database: memdb.New()}
+			db := versiondb.New(baseDB)
+			codec := testTxCodec()
+			repo, err := NewAtomicTxRepository(db, codec, 0)
+			assert.NoError(t, err)
+			lastAccepted := uint64(crashHeight - 5)
+			if test.firstCommit {
+				lastAccepted = 0
+			}
+			operationsMap := make(map[uint64]map[ids.ID]*atomic.Requests)
+			writeTxs(t, repo, 1, lastAccepted+1, constTxsPerHeight(2), nil, operationsMap)
+			atomicTrie, err := newAtomicTrie(db, testSharedMemory(), nil, repo, codec, lastAccepted, commitInterval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, db.Commit())
+			prevRoot, prevHeight := atomicTrie.LastCommitted()
+
+			// Accept the blocks up to the commit, crashing partway through
+			// the flush of the versiondb holding it
+			commitHeight := nearestCommitHeight(lastAccepted, commitInterval) + commitInterval
+			for height := lastAccepted + 1; height <= commitHeight; height++ {
+				txs := newTestTxs(2)
+				assert.NoError(t, repo.Write(height, txs))
+				ops, err := mergeAtomicOps(txs)
+				assert.NoError(t, err)
+				operationsMap[height] = ops
+				assert.NoError(t, atomicTrie.Index(height, ops))
+				if height < commitHeight {
+					assert.NoError(t, db.Commit())
+					assert.NoError(t, atomicTrie.ClearCommitMarker())
+					continue
+				}
+				baseDB.persist = func(key []byte) bool {
+					switch {
+					case bytes.HasPrefix(key, nodesPrefix):
+						return test.nodes(key)
+					case bytes.HasPrefix(key, metadataPrefix):
+						return test.metadata(key)
+					default:
+						return true
+					}
+				}
+				assert.ErrorIs(t, db.Commit(), errFlushCrash)
+			}
+			marker, err := readCommitMarker(atomicTrie.baseMetadataDB)
+			assert.NoError(t, err)
+			assert.NotNil(t, marker, "expected the commit marker to be written")
+
+			// Restart from the persisted data
+			restartDB := versiondb.New(baseDB.Database)
+			restartRepo, err := NewAtomicTxRepository(restartDB, codec, commitHeight)
+			assert.NoError(t, err)
+			recovered, err := newAtomicTrie(restartDB, testSharedMemory(), nil, restartRepo, codec, commitHeight, commitInterval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			marker, err = readCommitMarker(recovered.baseMetadataDB)
+			assert.NoError(t, err)
+			assert.Nil(t, marker, "expected the commit marker to be cleared")
+
+			// The recovered root is the one of a trie built from scratch
+			reference, err := newAtomicTrie(versiondb.New(memdb.New()), testSharedMemory(), nil, restartRepo, codec, commitHeight, commitInterval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, height := recovered.LastCommitted()
+			referenceRoot, referenceHeight := reference.LastCommitted()
+			assert.EqualValues(t, commitHeight, height)
+			assert.EqualValues(t, referenceHeight, height)
+			assert.Equal(t, referenceRoot, root)
+			assert.NotEqual(t, prevRoot, root)
+			reachable, err := trieReachable(recovered.trieDB, root)
+			assert.NoError(t, err)
+			assert.True(t, reachable, "expected all the nodes of the recovered root to be written")
+			verifyOperations(t, recovered, codec, root, 1, commitHeight, operationsMap)
+
+			// The previous root is still retained, and the next commit follows
+			if prevRoot != (common.Hash{}) {
+				committed, err := recovered.Root(prevHeight)
+				assert.NoError(t, err)
+				assert.Equal(t, prevRoot, committed)
+			}
+			next := newTestTxs(2)
+			assert.NoError(t, restartRepo.Write(commitHeight+1, next))
+			ops, err := mergeAtomicOps(next)
+			assert.NoError(t, err)
+			assert.NoError(t, recovered.Index(commitHeight+1, ops))
+		})
+	}
+}
+
+func TestAtomicTrieCommitMarkerCleared(t *testing.T) {
+	const commitInterval = 10
+	db := versiondb.New(memdb.New())
+	codec := testTxCodec()
+	repo, err := NewAtomicTxRepository(db, codec, 0)
+	assert.NoError(t, err)
+	atomicTrie, err := newAtomicTrie(db, testSharedMemory(), nil, repo, codec, 0, commitInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := uint64(1); height <= commitInterval; height++ {
+		txs := newTestTxs(2)
+		assert.NoError(t, repo.Write(height, txs))
+		ops, err := mergeAtomicOps(txs)
+		assert.NoError(t, err)
+		assert.NoError(t, atomicTrie.Index(height, ops))
+	}
+
+	// The marker is written below the versiondb before it is committed
+	marker, err := readCommitMarker(atomicTrie.baseMetadataDB)
+	assert.NoError(t, err)
+	if assert.NotNil(t, marker) {
+		root, _ := atomicTrie.LastCommitted()
+		assert.EqualValues(t, commitInterval, marker.height)
+		assert.Equal(t, root, marker.root)
+	}
+	db.Abort()
+	marker, err = readCommitMarker(atomicTrie.baseMetadataDB)
+	assert.NoError(t, err)
+	assert.NotNil(t, marker, "expected the commit marker to outlive the versiondb")
+
+	assert.NoError(t, atomicTrie.ClearCommitMarker())
+	marker, err = readCommitMarker(atomicTrie.baseMetadataDB)
+	assert.NoError(t, err)
+	assert.Nil(t, marker)
+}
+
+func persistAll([]byte) bool  { return true }
+func persistNone([]byte) bool { return false }
+
+// persistEvery returns a filter of every [n]th key.
+func persistEvery(n int) func([]byte) bool {
+	i := 0
+	return func([]byte) bool {
+		i++
+		return i%n == 0
+	}
+}
@@ -0,0 +1,179 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/params"
+)
+
+// Checks of a dry run of an atomic tx, in the order they are applied
+const (
+	dryRunCheckSyntax   = "syntax"   // The tx is well formed
+	dryRunCheckFee      = "fee"      // The tx burns the fee required at the base fee
+	dryRunCheckUTXOs    = "utxos"    // The UTXOs imported by the tx are in shared memory
+	dryRunCheckSemantic = "semantic" // The credentials and flows of the tx are valid
+	dryRunCheckState    = "state"    // The balances and nonces of the tx match the state
+)
+
+// DryRunUTXO is a UTXO consumed or produced by a dry run atomic tx.
+type DryRunUTXO struct {
+	UTXOID  string      `json:"utxoID"`
+	ChainID ids.ID      `json:"chainID"`
+	AssetID ids.ID      `json:"assetID"`
+	Amount  json.Uint64 `json:"amount"`
+}
+
+// DryRunAtomicTxReply is the report of a dry run of an atomic tx. The fees are
+// denominated in nAVAX and the base fee in wei.
+type DryRunAtomicTxReply struct {
+	TxID          ids.ID       `json:"txID"`
+	Valid         bool         `json:"valid"`
+	FailingCheck  string       `json:"failingCheck,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	GasUsed       json.Uint64  `json:"gasUsed"`
+	BaseFee       *json.Uint64 `json:"baseFee,omitempty"`
+	FeeRequired   json.Uint64  `json:"feeRequired"`
+	FeeProvided   json.Uint64  `json:"feeProvided"`
+	ConsumedUTXOs []DryRunUTXO `json:"consumedUTXOs"`
+	ProducedUTXOs []DryRunUTXO `json:"producedUTXOs"`
+	EVMInputs     []EVMInput   `json:"evmInputs"`
+	EVMOutputs    []EVMOutput  `json:"evmOutputs"`
+}
+
+// fail records that [tx] fails [check] with [err].
+func (r *DryRunAtomicTxReply) fail(check string, err error) {
+	r.Valid, r.FailingCheck, r.Error = false, check, err.Error()
+}
+
+// dryRunAtomicTx verifies [tx] as it would be verified in a block built on
+// the last accepted block at the current time, without adding it to the
+// mempool. The shared memory is only read and the state transfer is applied to
+// a throwaway copy of the last accepted state.
+func (vm *VM) dryRunAtomicTx(tx *Tx) (*DryRunAtomicTxReply, error) {
+	reply := &DryRunAtomicTxReply{
+		TxID:          tx.ID(),
+		Valid:         true,
+		ConsumedUTXOs: []DryRunUTXO{},
+		ProducedUTXOs: []DryRunUTXO{},
+		EVMInputs:     []EVMInput{},
+		EVMOutputs:    []EVMOutput{},
+	}
+	var importTx *UnsignedImportTx
+	switch utx := tx.UnsignedAtomicTx.(type) {
+	case *UnsignedImportTx:
+		importTx = utx
+		for _, in := range utx.ImportedInputs {
+			reply.ConsumedUTXOs = append(reply.ConsumedUTXOs, DryRunUTXO{
+				UTXOID:  in.UTXOID.String(),
+				ChainID: utx.SourceChain,
+				AssetID: in.AssetID(),
+				Amount:  json.Uint64(in.Input().Amount()),
+			})
+		}
+		reply.EVMOutputs = append(reply.EVMOutputs, utx.Outs...)
+	case *UnsignedExportTx:
+		reply.EVMInputs = append(reply.EVMInputs, utx.Ins...)
+		for i, out := range utx.ExportedOutputs {
+			utxoID := avax.UTXOID{TxID: tx.ID(), OutputIndex: uint32(i)}
+			reply.ProducedUTXOs = append(reply.ProducedUTXOs, DryRunUTXO{
+				UTXOID:  utxoID.String(),
+				ChainID: utx.DestinationChain,
+				AssetID: out.AssetID(),
+				Amount:  json.Uint64(out.Output().Amount()),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unexpected atomic tx type %T", utx)
+	}
+
+	lastAccepted := vm.chain.LastAcceptedBlock()
+	parentIntf, err := vm.GetBlockInternal(ids.ID(lastAccepted.Hash()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last accepted block: %w", err)
+	}
+	parent, ok := parentIntf.(*Block)
+	if !ok {
+		return nil, fmt.Errorf("last accepted block %s had unexpected type %T", parentIntf.ID(), parentIntf)
+	}
+	rules := vm.currentRules()
+	var baseFee *big.Int
+	timestamp := vm.clock.Time().Unix()
+	if vm.chainConfig.IsApricotPhase3(big.NewInt(timestamp)) {
+		_, baseFee, err = dummy.EstimateNextBaseFee(vm.chainConfig, lastAccepted.Header(), uint64(timestamp))
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate base fee: %w", err)
+		}
+		reply.BaseFee = new(json.Uint64)
+		*reply.BaseFee = json.Uint64(baseFee.Uint64())
+	}
+
+	if err := tx.Verify(vm.ctx, rules); err != nil {
+		reply.fail(dryRunCheckSyntax, err)
+		return reply, nil
+	}
+
+	gasUsed, err := tx.GasUsed(rules.IsApricotPhase5)
+	if err != nil {
+		reply.fail(dryRunCheckFee, err)
+		return reply, nil
+	}
+	reply.GasUsed = json.Uint64(gasUsed)
+	var feeRequired uint64
+	switch {
+	case rules.IsApricotPhase3:
+		if feeRequired, err = calculateDynamicFee(gasUsed, baseFee); err != nil {
+			reply.fail(dryRunCheckFee, err)
+			return reply, nil
+		}
+	case importTx == nil || rules.IsApricotPhase2:
+		feeRequired = params.AvalancheAtomicTxFee
+	}
+	reply.FeeRequired = json.Uint64(feeRequired)
+	feeProvided, err := tx.Burned(vm.ctx.AVAXAssetID)
+	if err != nil {
+		reply.fail(dryRunCheckFee, err)
+		return reply, nil
+	}
+	reply.FeeProvided = json.Uint64(feeProvided)
+	if feeProvided < feeRequired {
+		reply.fail(dryRunCheckFee, fmt.Errorf("insufficient AVAX burned (%d) to cover the tx fee (%d) at base fee %d", feeProvided, feeRequired, baseFee))
+		return reply, nil
+	}
+
+	if importTx != nil {
+		utxoIDs := make([][]byte, len(importTx.ImportedInputs))
+		for i, in := range importTx.ImportedInputs {
+			inputID := in.InputID()
+			utxoIDs[i] = inputID[:]
+		}
+		if _, err := vm.ctx.SharedMemory.Get(importTx.SourceChain, utxoIDs); err != nil {
+			reply.fail(dryRunCheckUTXOs, fmt.Errorf("failed to fetch import UTXOs from %s: %w", importTx.SourceChain, err))
+			return reply, nil
+		}
+	}
+
+	if err := tx.SemanticVerify(vm, tx, parent, baseFee, rules); err != nil {
+		reply.fail(dryRunCheckSemantic, err)
+		return reply, nil
+	}
+
+	// [BlockState] opens a new state, so the transfer is not applied to the
+	// state of the chain
+	statedb, err := vm.chain.BlockState(lastAccepted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last accepted state: %w", err)
+	}
+	if err := tx.EVMStateTransfer(vm.ctx, statedb); err != nil {
+		reply.fail(dryRunCheckState, err)
+	}
+	return reply, nil
+}
@@ -0,0 +1,101 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/formatting"
+)
+
+func TestDryRunAtomicTx(t *testing.T) {
+	importAmount := uint64(50000000000)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	service := &AvaxAPI{vm}
+	dryRun := func(tx *Tx) *DryRunAtomicTxReply {
+		txStr, err := formatting.EncodeWithChecksum(formatting.Hex, tx.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply := &DryRunAtomicTxReply{}
+		if err := service.DryRunAtomicTx(&http.Request{}, &api.FormattedTx{Tx: txStr, Encoding: formatting.Hex}, reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.TxID != tx.ID() {
+			t.Fatalf("Expected the report of %s, found %s", tx.ID(), reply.TxID)
+		}
+		return reply
+	}
+	balance := func() *big.Int {
+		statedb, err := vm.chain.BlockState(vm.chain.LastAcceptedBlock())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return statedb.GetBalance(testEthAddrs[0])
+	}
+	balanceBefore := balance()
+
+	// A valid export is reported with its fee and the UTXOs it produces,
+	// without entering the mempool or changing the state
+	exportAmount := importAmount / 2
+	exportTx, err := vm.newExportTx(vm.ctx.AVAXAssetID, exportAmount, vm.ctx.XChainID, testShortIDAddrs[0], new(big.Int).Mul(initialBaseFee, big.NewInt(10)), testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := dryRun(exportTx)
+	if !reply.Valid || reply.FailingCheck != "" {
+		t.Fatalf("Expected the export to be valid, found it failing the %s check: %s", reply.FailingCheck, reply.Error)
+	}
+	if reply.GasUsed == 0 || reply.BaseFee == nil || reply.FeeRequired == 0 || reply.FeeProvided < reply.FeeRequired {
+		t.Fatalf("Expected the fee of the export to be reported, found %d gas, %d nAVAX required and %d provided", reply.GasUsed, reply.FeeRequired, reply.FeeProvided)
+	}
+	if len(reply.EVMInputs) != 1 || len(reply.ProducedUTXOs) != 1 || uint64(reply.ProducedUTXOs[0].Amount) != exportAmount || reply.ProducedUTXOs[0].ChainID != vm.ctx.XChainID {
+		t.Fatalf("Expected the export to consume an EVM input and produce a UTXO of %d, found %+v and %+v", exportAmount, reply.EVMInputs, reply.ProducedUTXOs)
+	}
+	if vm.mempool.Len() != 0 || vm.mempool.has(exportTx.ID()) {
+		t.Fatal("Expected the dry run to leave the mempool unchanged")
+	}
+	if balanceAfter := balance(); balanceAfter.Cmp(balanceBefore) != 0 {
+		t.Fatalf("Expected the dry run to leave the balance at %d, found %d", balanceBefore, balanceAfter)
+	}
+
+	// The accepted import no longer finds its UTXO in shared memory
+	reply = dryRun(importTx)
+	if reply.Valid || reply.FailingCheck != dryRunCheckUTXOs {
+		t.Fatalf("Expected the import to fail the %s check, found %q: %s", dryRunCheckUTXOs, reply.FailingCheck, reply.Error)
+	}
+	if len(reply.ConsumedUTXOs) != 1 || uint64(reply.ConsumedUTXOs[0].Amount) != importAmount || len(reply.EVMOutputs) != 1 {
+		t.Fatalf("Expected the import to consume a UTXO of %d, found %+v", importAmount, reply.ConsumedUTXOs)
+	}
+
+	// An export paying for a base fee below the current one is underfunded
+	underfundedTx, err := vm.newExportTx(vm.ctx.AVAXAssetID, exportAmount, vm.ctx.XChainID, testShortIDAddrs[0], big.NewInt(1), testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply = dryRun(underfundedTx)
+	if reply.Valid || reply.FailingCheck != dryRunCheckFee || reply.FeeProvided >= reply.FeeRequired {
+		t.Fatalf("Expected the export to fail the %s check, found %q with %d nAVAX required and %d provided", dryRunCheckFee, reply.FailingCheck, reply.FeeRequired, reply.FeeProvided)
+	}
+}
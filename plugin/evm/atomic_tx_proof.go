@@ -0,0 +1,142 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+// AtomicTxProofVersion is the version of the atomic tx proof format produced
+// by this node. Verifiers reject proofs of any other version.
+const AtomicTxProofVersion = 1
+
+var (
+	errUnsupportedProofVersion = errors.New("unsupported atomic tx proof version")
+	errProofHeaderMismatch     = errors.New("atomic tx proof does not match the header")
+	errProofExtDataMismatch    = errors.New("atomic tx proof extra data does not match the header's extra data hash")
+	errProofPositionMismatch   = errors.New("atomic tx proof position does not match the extra data")
+	errProofTxMismatch         = errors.New("atomic tx proof does not contain the tx")
+	errExtDataNotCommitted     = errors.New("extra data of blocks before ApricotPhase1 is not committed to by the header")
+)
+
+// AtomicTxProof links the bytes of an atomic tx to the extra data hash of the
+// header of the block it was accepted in.
+//
+// The header commits to the extra data of the block, which holds the block's
+// atomic txs. ExtData[Offset:Offset+Length] is the encoding of the tx at
+// [Index], that is the signed bytes of the tx without their codec version
+// prefix. Before ApricotPhase5 the extra data holds a single tx, afterwards
+// a batch of txs.
+type AtomicTxProof struct {
+	Version     json.Uint16   `json:"version"`
+	TxID        ids.ID        `json:"txID"`
+	BlockHash   common.Hash   `json:"blockHash"`
+	BlockHeight json.Uint64   `json:"blockHeight"`
+	Index       json.Uint32   `json:"index"`
+	Batch       bool          `json:"batch"`
+	ExtData     hexutil.Bytes `json:"extData"`
+	Offset      json.Uint32   `json:"offset"`
+	Length      json.Uint32   `json:"length"`
+}
+
+// atomicTxOffsets returns the offset of each of [txs] within their encoding
+// as extra data, batched if [batch] is true.
+func atomicTxOffsets(txs []*Tx, batch bool) []int {
+	offset := wrappers.ShortLen // codec version
+	if batch {
+		offset += wrappers.IntLen // number of txs
+	}
+	offsets := make([]int, len(txs))
+	for i, tx := range txs {
+		offsets[i] = offset
+		offset += len(tx.Bytes()) - wrappers.ShortLen
+	}
+	return offsets
+}
+
+// getAtomicTxProof returns the proof of inclusion of the accepted atomic tx
+// [txID], along with the header of the block it was accepted in.
+func (vm *VM) getAtomicTxProof(txID ids.ID) (*AtomicTxProof, *types.Header, error) {
+	_, status, height, err := vm.getAtomicTx(txID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != Accepted {
+		return nil, nil, fmt.Errorf("tx %s is not accepted, status: %s", txID, status)
+	}
+	block := vm.chain.GetBlockByNumber(height)
+	if block == nil {
+		return nil, nil, fmt.Errorf("could not find block at height %d for tx %s", height, txID)
+	}
+	if !vm.chainConfig.IsApricotPhase1(new(big.Int).SetUint64(block.Time())) {
+		return nil, nil, errExtDataNotCommitted
+	}
+	batch := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(block.Time()))
+	txs, err := vm.extractAtomicTxs(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	offsets := atomicTxOffsets(txs, batch)
+	for i, tx := range txs {
+		if tx.ID() != txID {
+			continue
+		}
+		return &AtomicTxProof{
+			Version:     AtomicTxProofVersion,
+			TxID:        txID,
+			BlockHash:   block.Hash(),
+			BlockHeight: json.Uint64(height),
+			Index:       json.Uint32(i),
+			Batch:       batch,
+			ExtData:     block.ExtData(),
+			Offset:      json.Uint32(offsets[i]),
+			Length:      json.Uint32(len(tx.Bytes()) - wrappers.ShortLen),
+		}, block.Header(), nil
+	}
+	return nil, nil, fmt.Errorf("could not find tx %s in block %s at height %d", txID, block.Hash(), height)
+}
+
+// VerifyAtomicTxProof returns nil if [proof] proves that the atomic tx with
+// signed bytes [txBytes] was included in the block with [header].
+func VerifyAtomicTxProof(header *types.Header, txBytes []byte, proof *AtomicTxProof) error {
+	if proof.Version != AtomicTxProofVersion {
+		return fmt.Errorf("%w: %d", errUnsupportedProofVersion, proof.Version)
+	}
+	if header.Hash() != proof.BlockHash || header.Number == nil || header.Number.Uint64() != uint64(proof.BlockHeight) {
+		return errProofHeaderMismatch
+	}
+	if types.CalcExtDataHash(proof.ExtData) != header.ExtDataHash {
+		return errProofExtDataMismatch
+	}
+
+	txs, err := ExtractAtomicTxs(proof.ExtData, proof.Batch, Codec)
+	if err != nil {
+		return err
+	}
+	if int(proof.Index) >= len(txs) {
+		return fmt.Errorf("%w: index %d out of %d txs", errProofPositionMismatch, proof.Index, len(txs))
+	}
+	tx := txs[proof.Index]
+	offset, length := int(proof.Offset), int(proof.Length)
+	if offset != atomicTxOffsets(txs, proof.Batch)[proof.Index] || length != len(tx.Bytes())-wrappers.ShortLen {
+		return fmt.Errorf("%w: range [%d, %d)", errProofPositionMismatch, offset, offset+length)
+	}
+	if len(txBytes) < wrappers.ShortLen || !bytes.Equal(proof.ExtData[offset:offset+length], txBytes[wrappers.ShortLen:]) {
+		return errProofTxMismatch
+	}
+	if !bytes.Equal(tx.Bytes(), txBytes) || tx.ID() != proof.TxID {
+		return errProofTxMismatch
+	}
+	return nil
+}
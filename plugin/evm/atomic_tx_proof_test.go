@@ -0,0 +1,150 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+func TestAtomicTxProof(t *testing.T) {
+	tests := map[string]struct {
+		genesisJSON string
+		batch       bool
+	}{
+		"single tx": {genesisJSON: genesisJSONApricotPhase3},
+		"batch":     {genesisJSON: genesisJSONApricotPhase5, batch: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			importAmount := uint64(500000000)
+			issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, test.genesisJSON, "", "", map[ids.ShortID]uint64{
+				testShortIDAddrs[0]: importAmount,
+				testShortIDAddrs[1]: importAmount,
+			})
+			defer func() {
+				if err := vm.Shutdown(); err != nil {
+					t.Fatal(err)
+				}
+			}()
+
+			var importTxs []*Tx
+			for i := 0; i < 2; i++ {
+				importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[i], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[i]})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+					t.Fatal(err)
+				}
+				importTxs = append(importTxs, importTx)
+			}
+			blk := buildAndAcceptBlock(t, issuer, vm)
+			// Without batching the second tx goes in the next block
+			if !test.batch {
+				buildAndAcceptBlock(t, issuer, vm)
+			}
+
+			service := &AvaxAPI{vm}
+			for i, importTx := range importTxs {
+				reply := &GetAtomicTxProofReply{}
+				if err := service.GetAtomicTxProof(nil, &api.JSONTxID{TxID: importTx.ID()}, reply); err != nil {
+					t.Fatal(err)
+				}
+				// Proofs are verified by clients after a round trip through JSON
+				blob, err := json.Marshal(reply)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reply = &GetAtomicTxProofReply{}
+				if err := json.Unmarshal(blob, reply); err != nil {
+					t.Fatal(err)
+				}
+				proof, header := reply.Proof, reply.Header
+				if proof.Batch != test.batch {
+					t.Fatalf("Expected batch to be %t, found %t", test.batch, proof.Batch)
+				}
+				expectedIndex, expectedHeight := i, blk.Height()
+				if !test.batch {
+					expectedIndex, expectedHeight = 0, blk.Height()+uint64(i)
+				}
+				if int(proof.Index) != expectedIndex || uint64(proof.BlockHeight) != expectedHeight {
+					t.Fatalf("Expected tx %d at index %d of block %d, found index %d of block %d", i, expectedIndex, expectedHeight, proof.Index, proof.BlockHeight)
+				}
+				if err := VerifyAtomicTxProof(header, importTx.Bytes(), proof); err != nil {
+					t.Fatalf("Expected proof of tx %d to verify, found %v", i, err)
+				}
+
+				// Tampered tx bytes
+				tampered := append([]byte{}, importTx.Bytes()...)
+				tampered[len(tampered)-1] ^= 1
+				if err := VerifyAtomicTxProof(header, tampered, proof); !errors.Is(err, errProofTxMismatch) {
+					t.Fatalf("Expected tampered tx bytes to fail with %v, found %v", errProofTxMismatch, err)
+				}
+				if err := VerifyAtomicTxProof(header, importTxs[1-i].Bytes(), proof); !errors.Is(err, errProofTxMismatch) {
+					t.Fatalf("Expected another tx to fail with %v, found %v", errProofTxMismatch, err)
+				}
+
+				// Tampered positions
+				for _, tamper := range []func(p *AtomicTxProof){
+					func(p *AtomicTxProof) { p.Index++ },
+					func(p *AtomicTxProof) { p.Offset++ },
+					func(p *AtomicTxProof) { p.Length-- },
+				} {
+					tamperedProof := *proof
+					tamper(&tamperedProof)
+					if err := VerifyAtomicTxProof(header, importTx.Bytes(), &tamperedProof); !errors.Is(err, errProofPositionMismatch) {
+						t.Fatalf("Expected tampered position to fail with %v, found %v", errProofPositionMismatch, err)
+					}
+				}
+				if test.batch {
+					tamperedProof := *proof
+					tamperedProof.Index = 1 - proof.Index
+					if err := VerifyAtomicTxProof(header, importTx.Bytes(), &tamperedProof); err == nil {
+						t.Fatal("Expected swapped index to fail verification")
+					}
+				}
+
+				// Tampered extra data
+				tamperedProof := *proof
+				tamperedProof.ExtData = append([]byte{}, proof.ExtData...)
+				tamperedProof.ExtData[len(tamperedProof.ExtData)-1] ^= 1
+				if err := VerifyAtomicTxProof(header, importTx.Bytes(), &tamperedProof); !errors.Is(err, errProofExtDataMismatch) {
+					t.Fatalf("Expected tampered extra data to fail with %v, found %v", errProofExtDataMismatch, err)
+				}
+
+				// Mismatched headers
+				otherHeader := vm.chain.GetBlockByNumber(expectedHeight - 1).Header()
+				if err := VerifyAtomicTxProof(otherHeader, importTx.Bytes(), proof); !errors.Is(err, errProofHeaderMismatch) {
+					t.Fatalf("Expected mismatched header to fail with %v, found %v", errProofHeaderMismatch, err)
+				}
+				forgedHeader := types.CopyHeader(header)
+				forgedHeader.ExtDataHash[0] ^= 1
+				tamperedProof = *proof
+				tamperedProof.BlockHash = forgedHeader.Hash()
+				if err := VerifyAtomicTxProof(forgedHeader, importTx.Bytes(), &tamperedProof); !errors.Is(err, errProofExtDataMismatch) {
+					t.Fatalf("Expected forged extra data hash to fail with %v, found %v", errProofExtDataMismatch, err)
+				}
+
+				// Unsupported versions
+				tamperedProof = *proof
+				tamperedProof.Version++
+				if err := VerifyAtomicTxProof(header, importTx.Bytes(), &tamperedProof); !errors.Is(err, errUnsupportedProofVersion) {
+					t.Fatalf("Expected unknown version to fail with %v, found %v", errUnsupportedProofVersion, err)
+				}
+			}
+
+			// Only accepted txs have proofs
+			if err := service.GetAtomicTxProof(nil, &api.JSONTxID{TxID: ids.GenerateTestID()}, &GetAtomicTxProofReply{}); err == nil {
+				t.Fatal("Expected proof of an unknown tx to fail")
+			}
+		})
+	}
+}
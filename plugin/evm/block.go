@@ -112,6 +112,8 @@ type Block struct {
 	vm        *VM
 	status    choices.Status
 	atomicTxs []*Tx
+	// [received] is when [b] was built or parsed by the VM
+	received time.Time
 }
 
 // ID implements the snowman.Block interface
@@ -125,29 +127,68 @@ func (b *Block) Accept() error {
 	// practice to cleanup the batch we were modifying in the case of an error.
 	defer vm.db.Abort()
 
+	vm.health.accepting()
+	defer vm.health.accepted(b.ethBlock.Time())
+	defer vm.stallDetector.called(consensusCallAccept, vm.clock.Time())
+	defer vm.chain.APIBackend().TracePool().Throttle()()
+
 	b.status = choices.Accepted
 	log.Debug(fmt.Sprintf("Accepting block %s (%s) at height %d", b.ID().Hex(), b.ID(), b.Height()))
 	if err := vm.chain.Accept(b.ethBlock); err != nil {
 		return fmt.Errorf("chain could not accept %s: %w", b.ID(), err)
 	}
+	vm.stallDetector.accepted()
 	if err := vm.acceptedBlockDB.Put(lastAcceptedKey, b.id[:]); err != nil {
 		return fmt.Errorf("failed to put %s as the last accepted block: %w", b.ID(), err)
 	}
+	vm.chain.GetTxPool().NetworkStats().MarkAccepted(b.ethBlock)
+	vm.chain.GetTxPool().Propagation().MarkAccepted(b.ethBlock)
+	vm.verifyCache.accept(b.ethBlock.Hash(), b.Height())
+	vm.processingBlocks.accepted(b.ethBlock.Hash(), b.Height())
+	vm.readiness.accepted(b.Height())
+	receipts := vm.chain.GetReceiptsByHash(b.ethBlock.Hash())
+	vm.blockCounters.accepted(b.ethBlock, receipts)
+	vm.hotAccounts.record(b.ethBlock, types.MakeSigner(vm.chainConfig, b.ethBlock.Number(), new(big.Int).SetUint64(b.ethBlock.Time())))
+	if vm.approvalIndex != nil {
+		if err := vm.approvalIndex.index(b.ethBlock, receipts); err != nil {
+			return fmt.Errorf("failed to index the approvals of %s: %w", b.ID(), err)
+		}
+	}
+	if vm.supplyIndex != nil {
+		if err := vm.supplyIndex.index(b.Height(), b.atomicTxs, bonusBlocks.Contains(b.id)); err != nil {
+			return fmt.Errorf("failed to index the supply delta of %s: %w", b.ID(), err)
+		}
+	}
+	if vm.stateGrowthIndex != nil {
+		growth, known := vm.chain.BlockChain().StorageGrowth(b.ethBlock.Hash())
+		if err := vm.stateGrowthIndex.index(b.Height(), growth, known); err != nil {
+			return fmt.Errorf("failed to index the state growth of %s: %w", b.ID(), err)
+		}
+	}
 
 	if len(b.atomicTxs) == 0 {
 		if err := b.vm.atomicTrie.Index(b.Height(), nil); err != nil {
 			return err
 		}
-		return vm.db.Commit()
+		if err := vm.db.Commit(); err != nil {
+			return err
+		}
+		return vm.atomicTrie.ClearCommitMarker()
 	}
 
 	batchChainsAndInputs, err := mergeAtomicOps(b.atomicTxs)
 	if err != nil {
 		return err
 	}
+	var ops int64
+	for _, requests := range batchChainsAndInputs {
+		ops += int64(len(requests.PutRequests) + len(requests.RemoveRequests))
+	}
+	vm.atomicOpsHistogram.Update(ops)
 	for _, tx := range b.atomicTxs {
 		// Remove the accepted transaction from the mempool
 		vm.mempool.RemoveTx(tx.ID())
+		vm.atomicGossipDedup.accepted(tx.ID())
 	}
 
 	isBonus := bonusBlocks.Contains(b.id)
@@ -158,14 +199,21 @@ func (b *Block) Accept() error {
 	// the atmoic transactions to shared memory.
 	if isBonus {
 		log.Info("skipping atomic tx acceptance on bonus block", "block", b.id)
-		return vm.db.Commit()
+		if err := vm.db.Commit(); err != nil {
+			return err
+		}
+		return vm.atomicTrie.ClearCommitMarker()
 	}
+	vm.blockCounters.atomicOps.Inc(ops)
 
 	batch, err := vm.db.CommitBatch()
 	if err != nil {
 		return fmt.Errorf("failed to create commit batch due to: %w", err)
 	}
-	return vm.ctx.SharedMemory.Apply(batchChainsAndInputs, batch)
+	if err := vm.ctx.SharedMemory.Apply(batchChainsAndInputs, batch); err != nil {
+		return err
+	}
+	return vm.atomicTrie.ClearCommitMarker()
 }
 
 // indexAtomics writes given list of atomic transactions and atomic operations to atomic repository
@@ -186,8 +234,12 @@ func (b *Block) indexAtomics(vm *VM, height uint64, atomicTxs []*Tx, batchChains
 // Reject implements the snowman.Block interface
 // If [b] contains an atomic transaction, attempt to re-issue it
 func (b *Block) Reject() error {
+	defer b.vm.stallDetector.called(consensusCallReject, b.vm.clock.Time())
+
 	b.status = choices.Rejected
 	log.Debug(fmt.Sprintf("Rejecting block %s (%s) at height %d", b.ID().Hex(), b.ID(), b.Height()))
+	b.vm.verifyCache.remove(b.ethBlock.Hash())
+	b.vm.processingBlocks.rejectedBlock(b.ethBlock.Hash(), b.Height(), b.vm.rejectReason(b), b.vm.clock.Time())
 	for _, tx := range b.atomicTxs {
 		b.vm.mempool.RemoveTx(tx.ID())
 		if err := b.vm.issueTx(tx, false /* set local to false when re-issuing */); err != nil {
@@ -229,12 +281,26 @@ func (b *Block) syntacticVerify() (params.Rules, error) {
 
 	header := b.ethBlock.Header()
 	rules := b.vm.chainConfig.AvalancheRules(header.Number, new(big.Int).SetUint64(header.Time))
-	return rules, b.vm.getBlockValidator(rules).SyntacticVerify(b)
+	if err := b.vm.getBlockValidator(rules).SyntacticVerify(b); err != nil {
+		return rules, err
+	}
+	return rules, b.verifyAtomicOpsLimit()
 }
 
 // Verify implements the snowman.Block interface
+// The outcome of the verification is recorded, so that verifying [b] again
+// does not execute it again.
 func (b *Block) Verify() error {
-	return b.verify(true)
+	defer b.vm.chain.APIBackend().TracePool().Throttle()()
+
+	start := time.Now()
+	defer b.vm.stallDetector.called(consensusCallVerify, b.vm.clock.Time())
+	if err := b.vm.verifyCache.verify(b); err != nil {
+		return err
+	}
+	b.vm.processingBlocks.verified(b, b.received, time.Since(start))
+	b.vm.readiness.verified(b.Height())
+	return nil
 }
 
 func (b *Block) verify(writes bool) error {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	coreth "github.com/zsmartex/coreth/chain"
+	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/params"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -55,6 +56,7 @@ type blockBuilder struct {
 	chain    *coreth.ETHChain
 	mempool  *Mempool
 	gossiper Gossiper
+	health   *httpHealth
 
 	shutdownChan <-chan struct{}
 	shutdownWg   *sync.WaitGroup
@@ -78,6 +80,10 @@ type blockBuilder struct {
 	// [building] indicates the VM has sent a request to the engine to build a block.
 	buildStatus buildingBlkStatus
 
+	// paused is set while the node drains ahead of a shutdown, so that no
+	// block build is initiated.
+	paused bool
+
 	// isAP4 is a boolean indicating if AP4 is activated. This prevents us from
 	// getting the current time and comparing it to the *params.chainConfig more
 	// than once.
@@ -91,6 +97,7 @@ func (vm *VM) NewBlockBuilder(notifyBuildBlockChan chan<- commonEng.Message) *bl
 		chain:                vm.chain,
 		mempool:              vm.mempool,
 		gossiper:             vm.gossiper,
+		health:               vm.health,
 		shutdownChan:         vm.shutdownChan,
 		shutdownWg:           &vm.shutdownWg,
 		notifyBuildBlockChan: notifyBuildBlockChan,
@@ -226,6 +233,10 @@ func (b *blockBuilder) buildBlockTwoStageTimer() (time.Duration, bool) {
 
 // markBuilding assumes the [buildBlockLock] is held.
 func (b *blockBuilder) markBuilding() {
+	if b.paused {
+		b.buildStatus = dontBuild
+		return
+	}
 	select {
 	case b.notifyBuildBlockChan <- commonEng.PendingTxs:
 		b.buildStatus = building
@@ -261,6 +272,18 @@ func (b *blockBuilder) signalTxsReady() {
 	b.markBuilding()
 }
 
+// setPaused pauses or resumes the initiation of block builds. Once resumed,
+// a block is built if there are outstanding transactions.
+func (b *blockBuilder) setPaused(paused bool) {
+	b.buildBlockLock.Lock()
+	defer b.buildBlockLock.Unlock()
+
+	b.paused = paused
+	if !paused && b.buildStatus == dontBuild && b.needToBuild() {
+		b.markBuilding()
+	}
+}
+
 // awaitSubmittedTxs waits for new transactions to be submitted
 // and notifies the VM when the tx pool has transactions to be
 // put into a new block.
@@ -272,25 +295,19 @@ func (b *blockBuilder) awaitSubmittedTxs() {
 		// txSubmitChan is invoked when new transactions are issued as well as on re-orgs which
 		// may orphan transactions that were previously in a preferred block.
 		txSubmitChan := b.chain.GetTxSubmitCh()
+		heartbeat := time.NewTicker(builderHeartbeatInterval)
+		defer heartbeat.Stop()
 		for {
+			b.health.beat()
 			select {
+			case <-heartbeat.C:
 			case ethTxsEvent := <-txSubmitChan:
 				log.Trace("New tx detected, trying to generate a block")
 				b.signalTxsReady()
 
 				// We only attempt to invoke [GossipEthTxs] once AP4 is activated
 				if b.isAP4 && b.gossiper != nil && len(ethTxsEvent.Txs) > 0 {
-					// Give time for this node to build a block before attempting to
-					// gossip
-					time.Sleep(waitBlockTime)
-					// [GossipEthTxs] will block unless [gossiper.ethTxsToGossipChan] (an
-					// unbuffered channel) is listened on
-					if err := b.gossiper.GossipEthTxs(ethTxsEvent.Txs); err != nil {
-						log.Warn(
-							"failed to gossip new eth transactions",
-							"err", err,
-						)
-					}
+					b.gossipEthTxs(ethTxsEvent.Txs)
 				}
 			case <-b.mempool.Pending:
 				log.Trace("New atomic Tx detected, trying to generate a block")
@@ -299,15 +316,7 @@ func (b *blockBuilder) awaitSubmittedTxs() {
 				// We only attempt to invoke [GossipAtomicTxs] once AP4 is activated
 				newTxs := b.mempool.GetNewTxs()
 				if b.isAP4 && b.gossiper != nil && len(newTxs) > 0 {
-					// Give time for this node to build a block before attempting to
-					// gossip
-					time.Sleep(waitBlockTime)
-					if err := b.gossiper.GossipAtomicTxs(newTxs); err != nil {
-						log.Warn(
-							"failed to gossip new atomic transactions",
-							"err", err,
-						)
-					}
+					b.gossipAtomicTxs(newTxs)
 				}
 			case <-b.shutdownChan:
 				return
@@ -315,3 +324,72 @@ func (b *blockBuilder) awaitSubmittedTxs() {
 		}
 	})
 }
+
+// gossipEthTxs gossips locally issued [txs] right away and gives this node
+// time to build a block before gossiping the rest.
+func (b *blockBuilder) gossipEthTxs(txs []*types.Transaction) {
+	txPool := b.chain.GetTxPool()
+	localTxs := make([]*types.Transaction, 0)
+	remoteTxs := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if txPool.HasLocal(tx.Hash()) {
+			localTxs = append(localTxs, tx)
+		} else {
+			remoteTxs = append(remoteTxs, tx)
+		}
+	}
+	// [GossipEthTxs] will block unless [gossiper.ethTxsToGossipChan] (an
+	// unbuffered channel) is listened on
+	if len(localTxs) > 0 {
+		if err := b.gossiper.GossipEthTxs(localTxs); err != nil {
+			log.Warn(
+				"failed to gossip new local eth transactions",
+				"err", err,
+			)
+		}
+	}
+	if len(remoteTxs) > 0 {
+		// Give time for this node to build a block before attempting to
+		// gossip
+		time.Sleep(waitBlockTime)
+		if err := b.gossiper.GossipEthTxs(remoteTxs); err != nil {
+			log.Warn(
+				"failed to gossip new eth transactions",
+				"err", err,
+			)
+		}
+	}
+}
+
+// gossipAtomicTxs gossips locally issued [txs] right away and gives this node
+// time to build a block before gossiping the rest.
+func (b *blockBuilder) gossipAtomicTxs(txs []*Tx) {
+	localTxs := make([]*Tx, 0)
+	remoteTxs := make([]*Tx, 0, len(txs))
+	for _, tx := range txs {
+		if b.mempool.IsLocalTx(tx.ID()) {
+			localTxs = append(localTxs, tx)
+		} else {
+			remoteTxs = append(remoteTxs, tx)
+		}
+	}
+	if len(localTxs) > 0 {
+		if err := b.gossiper.GossipAtomicTxs(localTxs); err != nil {
+			log.Warn(
+				"failed to gossip new local atomic transactions",
+				"err", err,
+			)
+		}
+	}
+	if len(remoteTxs) > 0 {
+		// Give time for this node to build a block before attempting to
+		// gossip
+		time.Sleep(waitBlockTime)
+		if err := b.gossiper.GossipAtomicTxs(remoteTxs); err != nil {
+			log.Warn(
+				"failed to gossip new atomic transactions",
+				"err", err,
+			)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/zsmartex/avalanchego/codec"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// blockFormat is a format of the extra data of blocks, selected by the
+// version of the block.
+//
+// Blocks must use the format with the highest version active at their
+// timestamp, so that the version of a block is determined by its timestamp.
+// This allows nodes to parse blocks from any range of the chain, and prevents
+// blocks from using a format that is no longer active, as the version of a
+// block is not committed to by its header.
+type blockFormat struct {
+	version uint32
+	// activation returns the timestamp from which blocks must use the format,
+	// or nil if the format is not scheduled in [config]
+	activation func(config *params.ChainConfig) *big.Int
+	// extractAtomicTxs returns the atomic txs in [extData]
+	extractAtomicTxs func(extData []byte, isApricotPhase5 bool, codec codec.Manager) ([]*Tx, error)
+	// encodeAtomicTxs returns the extra data holding [txs]
+	encodeAtomicTxs func(txs []*Tx, isApricotPhase5 bool, codec codec.Manager) ([]byte, error)
+}
+
+// blockFormats are the supported block formats, ordered by version.
+var blockFormats = []*blockFormat{
+	{
+		version:          0,
+		activation:       func(*params.ChainConfig) *big.Int { return big.NewInt(0) },
+		extractAtomicTxs: ExtractAtomicTxs,
+		encodeAtomicTxs:  encodeAtomicTxs,
+	},
+}
+
+// encodeAtomicTxs returns the encoding of [txs] as the extra data of a block
+// of version 0. If [isApricotPhase5] is false, [txs] must hold a single tx.
+func encodeAtomicTxs(txs []*Tx, isApricotPhase5 bool, codec codec.Manager) ([]byte, error) {
+	if isApricotPhase5 {
+		return codec.Marshal(codecVersion, txs)
+	}
+	if len(txs) != 1 {
+		return nil, fmt.Errorf("expected a single atomic tx before ApricotPhase5 but got %d", len(txs))
+	}
+	return codec.Marshal(codecVersion, txs[0])
+}
+
+// blockFormat returns the format blocks with [timestamp] must use.
+func (vm *VM) blockFormat(timestamp uint64) *blockFormat {
+	return blockFormatAt(vm.chainConfig, timestamp)
+}
+
+// blockFormatAt returns the format the blocks of the chain with [config] and
+// [timestamp] must use.
+func blockFormatAt(config *params.ChainConfig, timestamp uint64) *blockFormat {
+	time := new(big.Int).SetUint64(timestamp)
+	format := blockFormats[0]
+	for _, f := range blockFormats[1:] {
+		if activation := f.activation(config); activation != nil && activation.Cmp(time) <= 0 {
+			format = f
+		}
+	}
+	return format
+}
+
+// blockFormatByVersion returns the format with [version].
+func blockFormatByVersion(version uint32) (*blockFormat, error) {
+	for _, format := range blockFormats {
+		if format.version == version {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown block version %d: %w", version, errInvalidBlockVersion)
+}
+
+// verifyBlockVersion returns an error if [block] does not use the format
+// active at its timestamp.
+func (vm *VM) verifyBlockVersion(block *types.Block) error {
+	if expected := vm.blockFormat(block.Time()).version; block.Version() != expected {
+		return fmt.Errorf(
+			"expected block version to be %d but got %d: %w",
+			expected, block.Version(), errInvalidBlockVersion,
+		)
+	}
+	return nil
+}
+
+// extractAtomicTxs returns the atomic txs in the extra data of [block],
+// decoded with the format of its version.
+func (vm *VM) extractAtomicTxs(block *types.Block) ([]*Tx, error) {
+	return extractBlockAtomicTxs(vm.chainConfig, block, vm.codec)
+}
+
+// encodeAtomicTxs returns the extra data holding [txs] for a block with
+// [timestamp], encoded with the format active at [timestamp].
+func (vm *VM) encodeAtomicTxs(timestamp uint64, txs []*Tx) ([]byte, error) {
+	isApricotPhase5 := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(timestamp))
+	return vm.blockFormat(timestamp).encodeAtomicTxs(txs, isApricotPhase5, vm.codec)
+}
+
+// ExtractBlockAtomicTxs returns the atomic txs in the extra data of [block] of
+// the chain with [config], decoded with the format of its version.
+func ExtractBlockAtomicTxs(config *params.ChainConfig, block *types.Block) ([]*Tx, error) {
+	return extractBlockAtomicTxs(config, block, Codec)
+}
+
+// EncodeBlockAtomicTxs returns the extra data holding [txs] for a block of the
+// chain with [config] and [timestamp], and the version the block must have
+// for it to be decoded.
+func EncodeBlockAtomicTxs(config *params.ChainConfig, timestamp uint64, txs []*Tx) ([]byte, uint32, error) {
+	format := blockFormatAt(config, timestamp)
+	isApricotPhase5 := config.IsApricotPhase5(new(big.Int).SetUint64(timestamp))
+	extData, err := format.encodeAtomicTxs(txs, isApricotPhase5, Codec)
+	return extData, format.version, err
+}
+
+func extractBlockAtomicTxs(config *params.ChainConfig, block *types.Block, codec codec.Manager) ([]*Tx, error) {
+	format, err := blockFormatByVersion(block.Version())
+	if err != nil {
+		return nil, err
+	}
+	isApricotPhase5 := config.IsApricotPhase5(new(big.Int).SetUint64(block.Time()))
+	return format.extractAtomicTxs(block.ExtData(), isApricotPhase5, codec)
+}
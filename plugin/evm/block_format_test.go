@@ -0,0 +1,113 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestBlockFormatActivation(t *testing.T) {
+	activation := time.Now().Add(-time.Hour).Truncate(time.Second)
+	defer func(formats []*blockFormat) { blockFormats = formats }(blockFormats)
+	blockFormats = append(blockFormats[:1:1], &blockFormat{
+		version:          1,
+		activation:       func(*params.ChainConfig) *big.Int { return big.NewInt(activation.Unix()) },
+		extractAtomicTxs: ExtractAtomicTxs,
+		encodeAtomicTxs:  encodeAtomicTxs,
+	})
+
+	importAmount := uint64(50000000)
+	utxos := map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+		testShortIDAddrs[1]: importAmount,
+	}
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", utxos)
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Build a block on each side of the activation
+	var blocks [][]byte
+	for i, now := range []time.Time{activation.Add(-time.Minute), activation} {
+		vm.clock.Set(now)
+		importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[i], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		blk := buildAndAcceptBlock(t, issuer, vm)
+		ethBlock := vm.chain.GetBlockByHash(common.Hash(blk.ID()))
+		if version := ethBlock.Version(); version != uint32(i) {
+			t.Fatalf("Expected block %d with timestamp %d to have version %d, found %d", i, ethBlock.Time(), i, version)
+		}
+		blocks = append(blocks, blk.Bytes())
+	}
+
+	// parseWithVersion parses [blockBytes] with its version replaced by [version]
+	parseWithVersion := func(blockBytes []byte, version uint32) error {
+		ethBlock := new(types.Block)
+		if err := rlp.DecodeBytes(blockBytes, ethBlock); err != nil {
+			t.Fatal(err)
+		}
+		ethBlock.SetVersion(version)
+		b, err := rlp.EncodeToBytes(ethBlock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = vm.parseBlock(b)
+		return err
+	}
+	for i, blockBytes := range blocks {
+		if err := parseWithVersion(blockBytes, uint32(i)); err != nil {
+			t.Fatalf("Expected block %d to parse with version %d, found %v", i, i, err)
+		}
+		// Only the version active at the timestamp of the block is accepted,
+		// which rejects early versions after the activation
+		for _, version := range []uint32{uint32(1 - i), 2} {
+			if err := parseWithVersion(blockBytes, version); !errors.Is(err, errInvalidBlockVersion) {
+				t.Fatalf("Expected block %d with version %d to fail with %v, found %v", i, version, errInvalidBlockVersion, err)
+			}
+		}
+	}
+
+	// A bootstrapping node parses and accepts blocks of both versions
+	_, bootstrapVM, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", utxos)
+	defer func() {
+		if err := bootstrapVM.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	for i, blockBytes := range blocks {
+		blk, err := bootstrapVM.ParseBlock(blockBytes)
+		if err != nil {
+			t.Fatalf("Failed to parse block %d: %v", i, err)
+		}
+		if err := blk.Verify(); err != nil {
+			t.Fatalf("Failed to verify block %d: %v", i, err)
+		}
+		if err := bootstrapVM.SetPreference(blk.ID()); err != nil {
+			t.Fatal(err)
+		}
+		if err := blk.Accept(); err != nil {
+			t.Fatalf("Failed to accept block %d: %v", i, err)
+		}
+	}
+	if lastAccepted := bootstrapVM.chain.LastAcceptedBlock(); lastAccepted.NumberU64() != 2 {
+		t.Fatalf("Expected the bootstrapping node to accept 2 blocks, found last accepted height %d", lastAccepted.NumberU64())
+	}
+}
@@ -0,0 +1,82 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/params"
+)
+
+const (
+	// limitSourceConsensus labels the limits enforced by every node of the
+	// network, set by the chain config.
+	limitSourceConsensus = "consensus"
+	// limitSourceNodePolicy labels the limits enforced by this node only, set
+	// by its config.
+	limitSourceNodePolicy = "node-policy"
+)
+
+// BlockLimit is a limit applying to the next block, and whether it is
+// enforced by consensus or by the policy of the node.
+type BlockLimit struct {
+	Value  hexutil.Uint64 `json:"value"`
+	Source string         `json:"source"`
+}
+
+// BlockLimits are the limits applying to the next block. The limits that are
+// not active at its timestamp are omitted.
+type BlockLimits struct {
+	// Timestamp is the timestamp of the next block the limits are computed at
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+
+	GasLimit        BlockLimit  `json:"gasLimit"`
+	AtomicGasLimit  *BlockLimit `json:"atomicGasLimit,omitempty"`
+	MaxAtomicOps    *BlockLimit `json:"maxAtomicOps,omitempty"`
+	MaxInitCodeSize *BlockLimit `json:"maxInitCodeSize,omitempty"`
+	MaxTxSize       BlockLimit  `json:"maxTxSize"`
+	RPCGasCap       *BlockLimit `json:"rpcGasCap,omitempty"`
+}
+
+// BlockLimitsAPI serves the limits applying to the next block in the eth
+// namespace.
+type BlockLimitsAPI struct{ vm *VM }
+
+// GetBlockLimits returns the limits applying to the next block, at the
+// timestamp it would be built with now. They are computed from the chain
+// config at that timestamp, so that the upgrades are reflected as soon as
+// they activate.
+func (api *BlockLimitsAPI) GetBlockLimits() *BlockLimits {
+	vm := api.vm
+	parent := vm.chain.LastAcceptedBlock()
+	timestamp := uint64(vm.clock.Unix())
+	if parent.Time() > timestamp {
+		timestamp = parent.Time()
+	}
+	blockTimestamp := new(big.Int).SetUint64(timestamp)
+
+	gasLimit, fixed := vm.chainConfig.FixedGasLimit(blockTimestamp)
+	if !fixed {
+		gasLimit = parent.GasLimit()
+	}
+	limits := &BlockLimits{
+		Timestamp: hexutil.Uint64(timestamp),
+		GasLimit:  BlockLimit{Value: hexutil.Uint64(gasLimit), Source: limitSourceConsensus},
+		MaxTxSize: BlockLimit{Value: hexutil.Uint64(vm.chain.GetTxPool().MaxTxSize()), Source: limitSourceNodePolicy},
+	}
+	if vm.chainConfig.IsApricotPhase5(blockTimestamp) {
+		limits.AtomicGasLimit = &BlockLimit{Value: hexutil.Uint64(params.AtomicGasLimit.Uint64()), Source: limitSourceConsensus}
+	}
+	if maxAtomicOps := vm.chainConfig.AtomicOpsLimit(blockTimestamp); maxAtomicOps > 0 {
+		limits.MaxAtomicOps = &BlockLimit{Value: hexutil.Uint64(maxAtomicOps), Source: limitSourceConsensus}
+	}
+	if maxInitCodeSize, _ := vm.chainConfig.InitCodeLimits(blockTimestamp); maxInitCodeSize > 0 {
+		limits.MaxInitCodeSize = &BlockLimit{Value: hexutil.Uint64(maxInitCodeSize), Source: limitSourceConsensus}
+	}
+	if gasCap := vm.chain.APIBackend().RPCGasCap(); gasCap > 0 {
+		limits.RPCGasCap = &BlockLimit{Value: hexutil.Uint64(gasCap), Source: limitSourceNodePolicy}
+	}
+	return limits
+}
@@ -0,0 +1,57 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// TestBlockLimitsGasLimitSchedule checks that eth_getBlockLimits reports the
+// gas limit of the next block across the activation of a gas limit schedule
+// entry.
+func TestBlockLimitsGasLimitSchedule(t *testing.T) {
+	config := *params.TestApricotPhase5Config
+	activation := int64(testutils.StartTime + 60)
+	config.GasLimitSchedule = []params.GasLimitScheduleEntry{{Timestamp: big.NewInt(activation), GasLimit: 15_000_000}}
+	tvm := testutils.NewTestVM(t, "", testutils.GenesisJSON(&config))
+
+	limits := func() *evm.BlockLimits {
+		limits := new(evm.BlockLimits)
+		if err := tvm.Client().Call(limits, "eth_getBlockLimits"); err != nil {
+			t.Fatal(err)
+		}
+		return limits
+	}
+	for _, test := range []struct {
+		now      int64
+		gasLimit uint64
+	}{
+		{now: activation - 1, gasLimit: params.ApricotPhase1GasLimit},
+		{now: activation, gasLimit: 15_000_000},
+	} {
+		// The clock of the VM is synced with the harness before building
+		// blocks only
+		tvm.SetTime(time.Unix(test.now, 0))
+		tvm.VM.Clock().Set(tvm.Time())
+		got := limits()
+		if uint64(got.Timestamp) != uint64(test.now) {
+			t.Fatalf("Expected the limits at %d, found them at %d", test.now, got.Timestamp)
+		}
+		if uint64(got.GasLimit.Value) != test.gasLimit || got.GasLimit.Source != "consensus" {
+			t.Fatalf("Expected a consensus gas limit of %d at %d, found %+v", test.gasLimit, test.now, got.GasLimit)
+		}
+		if got.AtomicGasLimit == nil || uint64(got.AtomicGasLimit.Value) != params.AtomicGasLimit.Uint64() || got.AtomicGasLimit.Source != "consensus" {
+			t.Fatalf("Expected the consensus atomic gas limit of Apricot Phase 5, found %+v", got.AtomicGasLimit)
+		}
+		if got.MaxTxSize.Source != "node-policy" || got.RPCGasCap == nil || got.RPCGasCap.Source != "node-policy" {
+			t.Fatalf("Expected the max tx size and RPC gas cap to be node policies, found %+v and %+v", got.MaxTxSize, got.RPCGasCap)
+		}
+	}
+}
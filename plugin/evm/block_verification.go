@@ -104,11 +104,8 @@ func (v blockValidatorPhase0) SyntacticVerify(b *Block) error {
 			params.MaximumExtraDataSize, headerExtraDataSize, errHeaderExtraDataTooBig,
 		)
 	}
-	if b.ethBlock.Version() != 0 {
-		return fmt.Errorf(
-			"expected block version to be 0 but got %d: %w",
-			b.ethBlock.Version(), errInvalidBlockVersion,
-		)
+	if err := b.vm.verifyBlockVersion(b.ethBlock); err != nil {
+		return err
 	}
 
 	// Check that the tx hash in the header matches the body
@@ -181,10 +178,10 @@ func (blockValidatorPhase1) SyntacticVerify(b *Block) error {
 			ethHeader.Nonce.Uint64(), errInvalidNonce,
 		)
 	}
-	if ethHeader.GasLimit != params.ApricotPhase1GasLimit {
+	if gasLimit := fixedGasLimit(b); ethHeader.GasLimit != gasLimit {
 		return fmt.Errorf(
-			"expected gas limit to be %d in apricot phase 1 but got %d",
-			params.ApricotPhase1GasLimit, ethHeader.GasLimit,
+			"expected gas limit to be %d but got %d",
+			gasLimit, ethHeader.GasLimit,
 		)
 	}
 	if ethHeader.MixDigest != (common.Hash{}) {
@@ -203,11 +200,8 @@ func (blockValidatorPhase1) SyntacticVerify(b *Block) error {
 			headerExtraDataSize, errHeaderExtraDataTooBig,
 		)
 	}
-	if b.ethBlock.Version() != 0 {
-		return fmt.Errorf(
-			"expected block version to be 0 but got %d: %w",
-			b.ethBlock.Version(), errInvalidBlockVersion,
-		)
+	if err := b.vm.verifyBlockVersion(b.ethBlock); err != nil {
+		return err
 	}
 
 	// Check that the tx hash in the header matches the body
@@ -280,10 +274,10 @@ func (blockValidatorPhase3) SyntacticVerify(b *Block) error {
 			ethHeader.Nonce.Uint64(), errInvalidNonce,
 		)
 	}
-	if ethHeader.GasLimit != params.ApricotPhase1GasLimit {
+	if gasLimit := fixedGasLimit(b); ethHeader.GasLimit != gasLimit {
 		return fmt.Errorf(
-			"expected gas limit to be %d in apricot phase 1 but got %d",
-			params.ApricotPhase1GasLimit, ethHeader.GasLimit,
+			"expected gas limit to be %d but got %d",
+			gasLimit, ethHeader.GasLimit,
 		)
 	}
 	if ethHeader.MixDigest != (common.Hash{}) {
@@ -307,11 +301,8 @@ func (blockValidatorPhase3) SyntacticVerify(b *Block) error {
 	if bfLen := ethHeader.BaseFee.BitLen(); bfLen > 256 {
 		return fmt.Errorf("too large base fee: bitlen %d", bfLen)
 	}
-	if b.ethBlock.Version() != 0 {
-		return fmt.Errorf(
-			"expected block version to be 0 but got %d: %w",
-			b.ethBlock.Version(), errInvalidBlockVersion,
-		)
+	if err := b.vm.verifyBlockVersion(b.ethBlock); err != nil {
+		return err
 	}
 
 	// Check that the tx hash in the header matches the body
@@ -377,10 +368,10 @@ func (blockValidatorPhase4) SyntacticVerify(b *Block) error {
 			ethHeader.Nonce.Uint64(), errInvalidNonce,
 		)
 	}
-	if ethHeader.GasLimit != params.ApricotPhase1GasLimit {
+	if gasLimit := fixedGasLimit(b); ethHeader.GasLimit != gasLimit {
 		return fmt.Errorf(
-			"expected gas limit to be %d in apricot phase 1 but got %d",
-			params.ApricotPhase1GasLimit, ethHeader.GasLimit,
+			"expected gas limit to be %d but got %d",
+			gasLimit, ethHeader.GasLimit,
 		)
 	}
 	if ethHeader.MixDigest != (common.Hash{}) {
@@ -404,11 +395,8 @@ func (blockValidatorPhase4) SyntacticVerify(b *Block) error {
 	if bfLen := ethHeader.BaseFee.BitLen(); bfLen > 256 {
 		return fmt.Errorf("too large base fee: bitlen %d", bfLen)
 	}
-	if b.ethBlock.Version() != 0 {
-		return fmt.Errorf(
-			"expected block version to be 0 but got %d: %w",
-			b.ethBlock.Version(), errInvalidBlockVersion,
-		)
+	if err := b.vm.verifyBlockVersion(b.ethBlock); err != nil {
+		return err
 	}
 
 	// Check that the tx hash in the header matches the body
@@ -507,10 +495,10 @@ func (blockValidatorPhase5) SyntacticVerify(b *Block) error {
 			ethHeader.Nonce.Uint64(), errInvalidNonce,
 		)
 	}
-	if ethHeader.GasLimit != params.ApricotPhase1GasLimit {
+	if gasLimit := fixedGasLimit(b); ethHeader.GasLimit != gasLimit {
 		return fmt.Errorf(
-			"expected gas limit to be %d in apricot phase 1 but got %d",
-			params.ApricotPhase1GasLimit, ethHeader.GasLimit,
+			"expected gas limit to be %d but got %d",
+			gasLimit, ethHeader.GasLimit,
 		)
 	}
 	if ethHeader.MixDigest != (common.Hash{}) {
@@ -534,11 +522,8 @@ func (blockValidatorPhase5) SyntacticVerify(b *Block) error {
 	if bfLen := ethHeader.BaseFee.BitLen(); bfLen > 256 {
 		return fmt.Errorf("too large base fee: bitlen %d", bfLen)
 	}
-	if b.ethBlock.Version() != 0 {
-		return fmt.Errorf(
-			"expected block version to be 0 but got %d: %w",
-			b.ethBlock.Version(), errInvalidBlockVersion,
-		)
+	if err := b.vm.verifyBlockVersion(b.ethBlock); err != nil {
+		return err
 	}
 
 	// Check that the tx hash in the header matches the body
@@ -606,3 +591,12 @@ func (blockValidatorPhase5) SyntacticVerify(b *Block) error {
 	}
 	return nil
 }
+
+// fixedGasLimit returns the gas limit of [b], set by the gas limit schedule of
+// the chain or else by Apricot Phase 1.
+func fixedGasLimit(b *Block) uint64 {
+	if gasLimit, ok := b.vm.chainConfig.ScheduledGasLimit(new(big.Int).SetUint64(b.ethBlock.Time())); ok {
+		return gasLimit
+	}
+	return params.ApricotPhase1GasLimit
+}
@@ -0,0 +1,99 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/eth"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestCallAt(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	vm.clock.Set(time.Now().Add(-time.Minute))
+	buildAndAcceptBlock(t, issuer, vm)
+
+	// Accept enough blocks with a transfer for the state of the first ones to
+	// be pruned, only the genesis state being retained below the tip buffer
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	var blocks []*types.Block
+	for nonce := uint64(0); nonce < 20; nonce++ {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatal(err)
+		}
+		vm.clock.Set(vm.clock.Time().Add(2 * time.Second))
+		blk := buildAndAcceptBlock(t, issuer, vm)
+		blocks = append(blocks, vm.chain.GetBlockByHash(common.Hash(blk.ID())))
+	}
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"private-debug"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	callAt := func(block *types.Block, tolerance uint64) (*eth.CallAtResult, error) {
+		args := map[string]interface{}{"from": testEthAddrs[0], "to": testEthAddrs[1]}
+		result := new(eth.CallAtResult)
+		err := client.Call(result, "debug_callAt", args, rpc.BlockNumberOrHashWithHash(block.Hash(), false), hexutil.Uint64(tolerance))
+		return result, err
+	}
+
+	// A call at a block whose state is retained is executed on it
+	last := blocks[len(blocks)-1]
+	result, err := callAt(last, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stale || result.Block.Hash != last.Hash() || result.Requested.Hash != last.Hash() || uint64(result.Block.Number) != last.NumberU64() {
+		t.Fatalf("Expected the call to be executed on block %s, found %+v", last.Hash(), result)
+	}
+
+	// A call at a pruned block is executed on the nearest older retained
+	// state within the tolerance
+	pruned := blocks[1]
+	genesis := vm.chain.GetBlockByNumber(0)
+	result, err = callAt(pruned, pruned.NumberU64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Stale || result.Block.Hash != genesis.Hash() || result.Requested.Hash != pruned.Hash() || uint64(result.Requested.Number) != pruned.NumberU64() {
+		t.Fatalf("Expected the call at block %d to be executed on the genesis, found %+v", pruned.NumberU64(), result)
+	}
+
+	// A call at a pruned block without retained state within the tolerance
+	// is refused
+	if _, err := callAt(pruned, pruned.NumberU64()-1); err == nil || !strings.Contains(err.Error(), "required historical state unavailable") {
+		t.Fatalf("Expected the call at block %d to be refused, found %v", pruned.NumberU64(), err)
+	}
+}
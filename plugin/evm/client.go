@@ -21,8 +21,13 @@ var _ Client = (*client)(nil)
 // Client interface for interacting with EVM [chain]
 type Client interface {
 	IssueTx(ctx context.Context, txBytes []byte) (ids.ID, error)
+	DryRunAtomicTx(ctx context.Context, txBytes []byte) (*DryRunAtomicTxReply, error)
 	GetAtomicTxStatus(ctx context.Context, txID ids.ID) (Status, error)
+	GetChainInfo(ctx context.Context) (*GetChainInfoReply, error)
 	GetAtomicTx(ctx context.Context, txID ids.ID) ([]byte, error)
+	GetAtomicTxProof(ctx context.Context, txID ids.ID) (*GetAtomicTxProofReply, error)
+	GetAtomicTrieProof(ctx context.Context, height uint64, key []byte) (*AtomicTrieProof, error)
+	GetFullBalance(ctx context.Context, address string, utxoAddress string) (*GetFullBalanceReply, error)
 	GetAtomicUTXOs(ctx context.Context, addrs []string, sourceChain string, limit uint32, startAddress, startUTXOID string) ([][]byte, api.Index, error)
 	ListAddresses(ctx context.Context, userPass api.UserPass) ([]string, error)
 	ExportKey(ctx context.Context, userPass api.UserPass, addr string) (string, string, error)
@@ -70,6 +75,21 @@ func (c *client) IssueTx(ctx context.Context, txBytes []byte) (ids.ID, error) {
 	return res.TxID, err
 }
 
+// DryRunAtomicTx verifies a transaction without issuing it and returns the
+// report of the verification
+func (c *client) DryRunAtomicTx(ctx context.Context, txBytes []byte) (*DryRunAtomicTxReply, error) {
+	res := &DryRunAtomicTxReply{}
+	txStr, err := formatting.EncodeWithChecksum(formatting.Hex, txBytes)
+	if err != nil {
+		return nil, fmt.Errorf("problem hex encoding bytes: %w", err)
+	}
+	err = c.requester.SendRequest(ctx, "dryRunAtomicTx", &api.FormattedTx{
+		Tx:       txStr,
+		Encoding: formatting.Hex,
+	}, res)
+	return res, err
+}
+
 // GetAtomicTxStatus returns the status of [txID]
 func (c *client) GetAtomicTxStatus(ctx context.Context, txID ids.ID) (Status, error) {
 	res := &GetAtomicTxStatusReply{}
@@ -79,6 +99,13 @@ func (c *client) GetAtomicTxStatus(ctx context.Context, txID ids.ID) (Status, er
 	return res.Status, err
 }
 
+// GetChainInfo returns the identity, progress and configuration of the chain
+func (c *client) GetChainInfo(ctx context.Context) (*GetChainInfoReply, error) {
+	res := &GetChainInfoReply{}
+	err := c.requester.SendRequest(ctx, "getChainInfo", struct{}{}, res)
+	return res, err
+}
+
 // GetAtomicTx returns the byte representation of [txID]
 func (c *client) GetAtomicTx(ctx context.Context, txID ids.ID) ([]byte, error) {
 	res := &api.FormattedTx{}
@@ -93,6 +120,38 @@ func (c *client) GetAtomicTx(ctx context.Context, txID ids.ID) ([]byte, error) {
 	return formatting.Decode(formatting.Hex, res.Tx)
 }
 
+// GetAtomicTxProof returns the header of the block [txID] was accepted in and
+// the proof of its inclusion
+func (c *client) GetAtomicTxProof(ctx context.Context, txID ids.ID) (*GetAtomicTxProofReply, error) {
+	res := &GetAtomicTxProofReply{}
+	err := c.requester.SendRequest(ctx, "getAtomicTxProof", &api.JSONTxID{
+		TxID: txID,
+	}, res)
+	return res, err
+}
+
+// GetAtomicTrieProof returns the atomic trie root committed at or before
+// [height] and the proof of the value of [key] in it
+func (c *client) GetAtomicTrieProof(ctx context.Context, height uint64, key []byte) (*AtomicTrieProof, error) {
+	res := &AtomicTrieProof{}
+	err := c.requester.SendRequest(ctx, "getAtomicTrieProof", &GetAtomicTrieProofArgs{
+		Height: cjson.Uint64(height),
+		Key:    key,
+	}, res)
+	return res, err
+}
+
+// GetFullBalance returns the AVAX of the account with EVM address [address]
+// and atomic UTXOs owned by [utxoAddress], split by where it is held
+func (c *client) GetFullBalance(ctx context.Context, address string, utxoAddress string) (*GetFullBalanceReply, error) {
+	res := &GetFullBalanceReply{}
+	err := c.requester.SendRequest(ctx, "getFullBalance", &GetFullBalanceArgs{
+		Address:     address,
+		UTXOAddress: utxoAddress,
+	}, res)
+	return res, err
+}
+
 // GetAtomicUTXOs returns the byte representation of the atomic UTXOs controlled by [addresses]
 // from [sourceChain]
 func (c *client) GetAtomicUTXOs(ctx context.Context, addrs []string, sourceChain string, limit uint32, startAddress, startUTXOID string) ([][]byte, api.Index, error) {
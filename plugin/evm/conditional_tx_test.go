@@ -0,0 +1,133 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/vms/components/chain"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// slotSetterAddr holds a contract storing its calldata in slot 0.
+var slotSetterAddr = common.HexToAddress("0x0300000000000000000000000000000000000000")
+
+func TestSendRawTransactionConditional(t *testing.T) {
+	balance := new(big.Int).Lsh(common.Big1, 100)
+	genesis := &core.Genesis{
+		Difficulty: common.Big0,
+		GasLimit:   params.ApricotPhase1GasLimit,
+		Config: &params.ChainConfig{
+			ChainID:                     params.AvalancheLocalChainID,
+			ApricotPhase1BlockTimestamp: big.NewInt(0),
+			ApricotPhase2BlockTimestamp: big.NewInt(0),
+			ApricotPhase3BlockTimestamp: big.NewInt(0),
+			ApricotPhase4BlockTimestamp: big.NewInt(0),
+		},
+		Alloc: core.GenesisAlloc{
+			testEthAddrs[0]: {Balance: balance},
+			testEthAddrs[1]: {Balance: balance},
+			slotSetterAddr: {
+				Balance: common.Big0,
+				Code:    common.FromHex("0x600035600055"),
+				Storage: map[common.Hash]common.Hash{{}: common.BigToHash(common.Big1)},
+			},
+		},
+	}
+	genesisJSON, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, vm, _, _, _ := GenesisVM(t, true, string(genesisJSON), "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+
+	signer := types.NewEIP155Signer(vm.chainID)
+	signedTx := func(key int, nonce uint64, to common.Address, gasPrice *big.Int, data []byte) (*types.Transaction, hexutil.Bytes) {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, common.Big0, 100_000, gasPrice, data), signer, testKeys[key].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx, raw
+	}
+	slotIs := func(value int64) types.TransactionConditional {
+		return types.TransactionConditional{KnownAccounts: map[common.Address]types.KnownAccount{
+			slotSetterAddr: {StorageSlots: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(value))}},
+		}}
+	}
+	send := func(raw hexutil.Bytes, cond types.TransactionConditional) error {
+		var hash common.Hash
+		return client.Call(&hash, "eth_sendRawTransactionConditional", raw, cond)
+	}
+	txPool := vm.chain.GetTxPool()
+	// Single transactions pay enough tip to cover the block gas cost
+	gasPrice := new(big.Int).Mul(initialBaseFee, big.NewInt(50))
+
+	// Transactions whose conditions do not hold for the accepted state are
+	// rejected on admission
+	_, raw := signedTx(0, 0, testEthAddrs[2], gasPrice, nil)
+	err = send(raw, slotIs(2))
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) || dataErr.ErrorData().(map[string]interface{})["reason"] != "conditionNotMet" {
+		t.Fatalf("Expected the transaction to be rejected with unmet conditions, found %v", err)
+	}
+	tooEarly := types.TransactionConditional{BlockNumberMin: (*hexutil.Big)(big.NewInt(5))}
+	if err := send(raw, tooEarly); !errors.As(err, &dataErr) {
+		t.Fatalf("Expected the transaction to be rejected before its minimum block number, found %v", err)
+	}
+
+	// Transactions whose conditions hold are included
+	tx, raw := signedTx(0, 0, testEthAddrs[2], gasPrice, nil)
+	if err := send(raw, slotIs(1)); err != nil {
+		t.Fatal(err)
+	}
+	if txPool.Conditional(tx.Hash()) == nil {
+		t.Fatal("Expected the conditions to be kept with the pooled transaction")
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	if ethBlock := blk.(*chain.BlockWrapper).Block.(*Block).ethBlock; ethBlock.Transaction(tx.Hash()) == nil {
+		t.Fatal("Expected the transaction to be included while its conditions hold")
+	}
+
+	// A transaction updating the slot first makes the builder skip a
+	// transaction conditional on its previous value, without dropping it
+	conditional, raw := signedTx(0, 1, testEthAddrs[2], gasPrice, nil)
+	if err := send(raw, slotIs(1)); err != nil {
+		t.Fatal(err)
+	}
+	update, _ := signedTx(1, 0, slotSetterAddr, new(big.Int).Mul(gasPrice, big.NewInt(2)), common.BigToHash(big.NewInt(2)).Bytes())
+	if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{update})[0]; err != nil {
+		t.Fatal(err)
+	}
+	blk = buildAndAcceptBlock(t, issuer, vm)
+	ethBlock := blk.(*chain.BlockWrapper).Block.(*Block).ethBlock
+	if ethBlock.Transaction(update.Hash()) == nil || ethBlock.Transaction(conditional.Hash()) != nil {
+		t.Fatalf("Expected only the update of the slot to be included, found %d txs", len(ethBlock.Transactions()))
+	}
+	if status := txPool.Status([]common.Hash{conditional.Hash()})[0]; status != core.TxStatusPending {
+		t.Fatalf("Expected the skipped transaction to stay pending, found status %d", status)
+	}
+}
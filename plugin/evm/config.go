@@ -5,30 +5,74 @@ package evm
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cast"
+	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/eth"
 )
 
 const (
-	defaultPruningEnabled                       = true
-	defaultSnapshotAsync                        = true
-	defaultRpcGasCap                            = 50_000_000 // Default to 50M Gas Limit
-	defaultRpcTxFeeCap                          = 100        // 100 AVAX
-	defaultMetricsEnabled                       = true
-	defaultMetricsExpensiveEnabled              = false
-	defaultApiMaxDuration                       = 0 // Default to no maximum API call duration
-	defaultWsCpuRefillRate                      = 0 // Default to no maximum WS CPU usage
-	defaultWsCpuMaxStored                       = 0 // Default to no maximum WS CPU usage
-	defaultMaxBlocksPerRequest                  = 0 // Default to no maximum on the number of blocks per getLogs request
-	defaultContinuousProfilerFrequency          = 15 * time.Minute
-	defaultContinuousProfilerMaxFiles           = 5
-	defaultTxRegossipFrequency                  = 1 * time.Minute
-	defaultTxRegossipMaxSize                    = 15
-	defaultOfflinePruningBloomFilterSize uint64 = 512 // Default size (MB) for the offline pruner to use
-	defaultLogLevel                             = "info"
-	defaultMaxOutboundActiveRequests            = 8
+	defaultPruningEnabled                           = true
+	defaultSnapshotAsync                            = true
+	defaultRpcGasCap                                = 50_000_000 // Default to 50M Gas Limit
+	defaultRpcTxFeeCap                              = 100        // 100 AVAX
+	defaultMetricsEnabled                           = true
+	defaultMetricsExpensiveEnabled                  = false
+	defaultMetricsPersistenceFrequency              = 1 * time.Minute
+	defaultApiMaxDuration                           = 0 // Default to no maximum API call duration
+	defaultWsCpuRefillRate                          = 0 // Default to no maximum WS CPU usage
+	defaultWsCpuMaxStored                           = 0 // Default to no maximum WS CPU usage
+	defaultMaxBlocksPerRequest                      = 0 // Default to no maximum on the number of blocks per getLogs request
+	defaultMaxBlocksPerMultiRequest                 = 20000
+	defaultMaxLogsPerMultiRequest                   = 100000
+	defaultContinuousProfilerFrequency              = 15 * time.Minute
+	defaultContinuousProfilerMaxFiles               = 5
+	defaultForensicDumpMaxFiles                     = 10
+	defaultUnixSocketPermissions                    = "0600"
+	defaultTxRegossipFrequency                      = 1 * time.Minute
+	defaultTxRegossipMaxSize                        = 15
+	defaultTxWatchMaxAge                            = 1 * time.Minute
+	defaultNonceReservationTTL                      = 5 * time.Minute
+	defaultRPCReadinessMaxHeightLag                 = 16
+	defaultHealthMaxStall                           = 30 * time.Second
+	defaultStallThreshold                           = 5 * time.Minute
+	defaultStallDiagnosticsMaxFiles                 = 10
+	defaultStallDiagnosticsMaxGoroutineBytes        = 4 * 1024 * 1024
+	defaultWarmupBlocks                             = 256
+	defaultWarmupHotAccounts                        = 1024
+	defaultWarmupDuration                           = 30 * time.Second
+	defaultStateGrowthEpochBlocks                   = 4096
+	defaultCallAtMaxStaleness                       = 32
+	defaultTraceConcurrency                         = 4
+	defaultTraceThrottledConcurrency                = 1
+	defaultTraceQueueLimit                          = 64
+	defaultSubmissionAuditMaxFileSize               = 100 * 1024 * 1024
+	defaultSubmissionAuditMaxFiles                  = 5
+	defaultSubmissionAuditSampleRate                = 1
+	defaultOfflinePruningBloomFilterSize     uint64 = 512 // Default size (MB) for the offline pruner to use
+	defaultLogLevel                                 = "info"
+	defaultMigrationPolicy                          = migrationPolicyBlocking
+	defaultMaxOutboundActiveRequests                = 8
+	defaultGossipQuarantineVersionLimit             = 1000
+	defaultGossipQuarantineGarbageLimit             = 20
+	defaultGossipQuarantineWindow                   = 1 * time.Minute
+	defaultGossipQuarantineDuration                 = 10 * time.Minute
+	defaultAtomicGossipDiscardedRetention           = 30 * time.Second
+	defaultAtomicGossipAcceptedRetention            = 10 * time.Minute
+	defaultTxPropagationReceiptsTTL                 = 30 * time.Minute
+	defaultBuilderTxTieBreak                        = builderTxTieBreakFIFO
+)
+
+// The orders of the transactions paying the same tip in the blocks built by
+// the node
+const (
+	builderTxTieBreakFIFO = "fifo"
+	builderTxTieBreakHash = "hash"
 )
 
 var defaultEnabledAPIs = []string{
@@ -56,6 +100,11 @@ type Config struct {
 	// If none is specified, then we use the default list [defaultEnabledAPIs]
 	EnabledEthAPIs []string `json:"eth-apis"`
 
+	// EnabledEthAPIMethodGroups is a list of method groups (see [ethAPIMethodGroups])
+	// to enable in addition to [EnabledEthAPIs]. This allows enabling a subset
+	// of the methods of a namespace without enabling every service under it.
+	EnabledEthAPIMethodGroups []string `json:"eth-api-method-groups"`
+
 	// Continuous Profiler
 	ContinuousProfilerDir       string   `json:"continuous-profiler-dir"`       // If set to non-empty string creates a continuous profiler
 	ContinuousProfilerFrequency Duration `json:"continuous-profiler-frequency"` // Frequency to run continuous profiler if enabled
@@ -65,15 +114,72 @@ type Config struct {
 	RPCGasCap   uint64  `json:"rpc-gas-cap"`
 	RPCTxFeeCap float64 `json:"rpc-tx-fee-cap"`
 
+	// Optional guardrail against locally submitted transactions with absurd fee
+	// caps. Each check is disabled when set to 0, and can be bypassed for a single
+	// submission. Gossiped transactions are never subject to the guardrail.
+	RPCFeeCapMultiple  float64 `json:"rpc-fee-cap-multiple"`  // Maximum max fee per gas as a multiple of the estimated base fee
+	RPCFeeGuardrailCap float64 `json:"rpc-fee-guardrail-cap"` // Maximum potential fee (max fee per gas * gas limit) in AVAX
+
+	// Optional audit log of the raw transaction submissions served by the API,
+	// recording the client, the hash, the sender, the nonce, the fees and the
+	// outcome of each, without the payload. Gossiped transactions are not
+	// recorded.
+	SubmissionAuditEnabled     bool    `json:"submission-audit-enabled"`
+	SubmissionAuditFile        string  `json:"submission-audit-file"`          // Written as JSON lines, to the structured logger if empty
+	SubmissionAuditMaxFileSize int64   `json:"submission-audit-max-file-size"` // Size in bytes the file is rotated above, 0 disables the rotation
+	SubmissionAuditMaxFiles    int     `json:"submission-audit-max-files"`     // Maximum number of rotated files to maintain
+	SubmissionAuditSampleRate  float64 `json:"submission-audit-sample-rate"`   // Fraction of the submissions recorded, in (0, 1]
+
+	// Optional guards against the responses of blocks with full transactions
+	// growing too large. Each check is disabled when set to 0, and can be
+	// bypassed for a single request.
+	RPCFullBlockTxLimit   int    `json:"rpc-full-block-tx-limit"`   // Maximum number of transactions
+	RPCFullBlockSizeLimit uint64 `json:"rpc-full-block-size-limit"` // Maximum size of the transactions in bytes
+
+	// Reject the quantities of the RPC arguments with leading zero digits or
+	// in decimal, instead of canonicalizing them to 0x-prefixed hex
+	RPCStrictQuantities bool `json:"rpc-strict-quantities"`
+
 	// Eth Settings
 	Preimages      bool `json:"preimages-enabled"`
 	Pruning        bool `json:"pruning-enabled"`
 	SnapshotAsync  bool `json:"snapshot-async"`
 	SnapshotVerify bool `json:"snapshot-verification-enabled"`
 
+	// Chain Cache Settings (in number of items, 0 uses the default)
+	HeaderCacheSize   int `json:"header-cache-size"`
+	BodyCacheSize     int `json:"body-cache-size"`
+	ReceiptsCacheSize int `json:"receipts-cache-size"`
+	BlockCacheSize    int `json:"block-cache-size"`
+
+	// Number of accounts whose balance and nonce at the last accepted block
+	// are cached for eth_getBalance and eth_getTransactionCount (0 disables
+	// the cache, requires snapshots)
+	AccountCacheSize int `json:"account-cache-size"`
+
+	// Number of goroutines hashing and committing the modified storage tries
+	// of a block (0 uses GOMAXPROCS)
+	StorageCommitWorkers int `json:"storage-commit-workers"`
+
+	// Number of state keys accessed the most by a block that are warmed up
+	// while its children are processed, for at most [HotKeysWarmupTimeout]
+	// (0 disables the warm-up)
+	HotKeysWarmup        int      `json:"hot-keys-warmup"`
+	HotKeysWarmupTimeout Duration `json:"hot-keys-warmup-timeout"`
+
+	// Number of accepted blocks whose tx lookup entries and accepted events
+	// may be written in the background before Accept waits for them (0 uses
+	// the default)
+	AcceptedIndicesQueueLimit int `json:"accepted-indices-queue-limit"`
+
 	// Metric Settings
 	MetricsEnabled          bool `json:"metrics-enabled"`
 	MetricsExpensiveEnabled bool `json:"metrics-expensive-enabled"`
+	// Persist the long-window counters, such as the number of accepted
+	// transactions, every [MetricsPersistenceFrequency] and on shutdown, so
+	// that they continue from their prior values after a restart
+	MetricsPersistenceEnabled   bool     `json:"metrics-persistence-enabled"`
+	MetricsPersistenceFrequency Duration `json:"metrics-persistence-frequency"`
 
 	// API Settings
 	LocalTxsEnabled         bool     `json:"local-txs-enabled"`
@@ -83,6 +189,112 @@ type Config struct {
 	MaxBlocksPerRequest     int64    `json:"api-max-blocks-per-request"`
 	AllowUnfinalizedQueries bool     `json:"allow-unfinalized-queries"`
 	AllowUnprotectedTxs     bool     `json:"allow-unprotected-txs"`
+	TraceBlockWorkers       int      `json:"trace-block-workers"`
+
+	// Number of trace requests executed concurrently (0 does not bound them),
+	// lowered to [TraceThrottledConcurrency] while a block is verified or
+	// accepted, queueing up to [TraceQueueLimit] requests beyond which they
+	// are refused as retryable
+	TraceConcurrency          int `json:"trace-concurrency"`
+	TraceThrottledConcurrency int `json:"trace-throttled-concurrency"`
+	TraceQueueLimit           int `json:"trace-queue-limit"`
+
+	// Maximum number of blocks below the requested block whose state
+	// debug_callAt may execute a call on, flagged as stale, if the state of
+	// the requested block was pruned
+	CallAtMaxStaleness uint64 `json:"call-at-max-staleness"`
+
+	// Close the websocket connections whose notifications pending to be
+	// written exceed [WSMaxPendingNotificationBytes] (0 writes them
+	// synchronously, without a ceiling)
+	WSMaxPendingNotificationBytes int `json:"ws-max-pending-notification-bytes"`
+
+	// Combined limits across all the ranges of a getLogsMulti request (0 is no maximum)
+	MaxBlocksPerMultiRequest int64 `json:"api-max-blocks-per-multi-request"`
+	MaxLogsPerMultiRequest   int64 `json:"api-max-logs-per-multi-request"`
+
+	// Execution budget of a getLogs request, counting the headers read and the
+	// logs fetched for bloom-matched blocks, and the logs returned (0 is no maximum)
+	MaxBlocksScannedPerRequest int64 `json:"api-max-blocks-scanned-per-request"`
+	MaxLogsPerRequest          int64 `json:"api-max-logs-per-request"`
+	// Maximum number of getLogs requests served concurrently per connection (0 is no maximum)
+	MaxConcurrentLogsRequestsPerConn int `json:"api-max-concurrent-logs-requests-per-conn"`
+
+	// Pressure on the transaction pools and on the block builder, as the
+	// highest fraction of their capacity in use, at which transactions
+	// submitted over RPC are rejected with a retryable error unless local
+	// transactions are enabled (0 disables the check)
+	TxPressureThreshold float64 `json:"tx-pressure-threshold"`
+
+	// Minimum gas tip cap, in wei, of the remote transactions admitted to the
+	// tx pool, growing with their weight in bytes of calldata and access list:
+	// [TxPoolTipFloorBase] + [TxPoolTipFloorPerByte] x weight. It never lowers
+	// the flat floor of the tx pool and is not applied to the transactions of
+	// blocks (0 disables the policy)
+	TxPoolTipFloorBase    uint64 `json:"tx-pool-tip-floor-base"`
+	TxPoolTipFloorPerByte uint64 `json:"tx-pool-tip-floor-per-byte"`
+
+	// Fraction of the transactions admitted to the tx pool also applied on a
+	// copy of the current state as block verification would, reporting in the
+	// logs and the txpool/invariant metrics the transactions the consensus
+	// rules reject (0 disables the checks)
+	TxPoolInvariantCheckRate float64 `json:"tx-pool-invariant-check-rate"`
+
+	// Senders whose transactions are given [PrivilegedTxPoolSlots] slots of the
+	// tx pool, which other transactions cannot evict them from, and the first
+	// [PrivilegedBlockGas] of the blocks built by the node. It is a local
+	// building policy only, never required of the blocks of other nodes. The
+	// senders can be replaced with admin.setPrivilegedSenders
+	PrivilegedSenders     []common.Address `json:"privileged-senders"`
+	PrivilegedTxPoolSlots uint64           `json:"privileged-tx-pool-slots"`
+	PrivilegedBlockGas    uint64           `json:"privileged-block-gas"`
+
+	// Number of senders whose transactions failing or running hot when a block
+	// is built have their accesses recorded, warmed up before the next blocks
+	// built with them (0 disables the access hints)
+	BuilderAccessHints int `json:"builder-access-hints"`
+
+	// Order of the transactions paying the same tip in the blocks built by
+	// the node: "fifo" for the first admitted to the pool first, then by
+	// hash, or "hash" for by hash only, independent of when the node received
+	// them
+	BuilderTxTieBreak string `json:"builder-tx-tie-break"`
+
+	// Reject the Ethereum RPC calls, apart from [rpcReadinessExemptMethods],
+	// with a "node syncing" error until the chain is bootstrapped and the last
+	// accepted block is at most [RPCReadinessMaxHeightLag] blocks behind the
+	// highest block seen from the network
+	RPCReadinessGatingEnabled bool   `json:"rpc-readiness-gating-enabled"`
+	RPCReadinessMaxHeightLag  uint64 `json:"rpc-readiness-max-height-lag"`
+
+	// The /live endpoint fails once the loop of the block builder or an
+	// Accept call stalls for [HealthMaxStall], and /ready while the chain
+	// bootstraps, drains ahead of a shutdown or, if [HealthMaxHeadAge] is set,
+	// while the last accepted block is older than it. Blocks are only built
+	// with txs, so the age of the head is not checked by default.
+	HealthMaxStall   Duration `json:"health-max-stall"`
+	HealthMaxHeadAge Duration `json:"health-max-head-age"`
+
+	// The chain is reported unhealthy once no block was accepted for
+	// [StallThreshold] (0 disables the detection) while peers are connected
+	// and the mempools hold txs, until a block is accepted. On each stall, a
+	// bundle of diagnostics is written to [StallDiagnosticsDir], if set,
+	// keeping the last [StallDiagnosticsMaxFiles], with a goroutine dump
+	// truncated to [StallDiagnosticsMaxGoroutineBytes]
+	StallThreshold                    Duration `json:"stall-threshold"`
+	StallDiagnosticsDir               string   `json:"stall-diagnostics-dir"`
+	StallDiagnosticsMaxFiles          int      `json:"stall-diagnostics-max-files"`
+	StallDiagnosticsMaxGoroutineBytes int      `json:"stall-diagnostics-max-goroutine-bytes"`
+
+	// Warm the caches after startup, before the RPC calls are served if they
+	// are gated by readiness, by reading the last [WarmupBlocks] accepted
+	// blocks and the state of the [WarmupHotAccounts] accounts most frequent
+	// in the transactions accepted in the last session, for at most
+	// [WarmupDuration]
+	WarmupEnabled     bool     `json:"warmup-enabled"`
+	WarmupBlocks      uint64   `json:"warmup-blocks"`
+	WarmupHotAccounts int      `json:"warmup-hot-accounts"`
+	WarmupDuration    Duration `json:"warmup-duration"`
 
 	// Keystore Settings
 	KeystoreDirectory             string `json:"keystore-directory"` // both absolute and relative supported
@@ -94,6 +306,62 @@ type Config struct {
 	TxRegossipFrequency       Duration `json:"tx-regossip-frequency"`
 	TxRegossipMaxSize         int      `json:"tx-regossip-max-size"`
 
+	// Maximum number of gossip messages per second sent for first-time gossip
+	// of locally issued transactions (priority) and for regossip and gossip of
+	// transactions received from peers (background). 0 disables the limit.
+	TxGossipPriorityRateLimit   float64 `json:"tx-gossip-priority-rate-limit"`
+	TxGossipBackgroundRateLimit float64 `json:"tx-gossip-background-rate-limit"`
+
+	// Track the origin (RPC or gossip) of the transactions reaching the node
+	// and their time to inclusion, served by txpool_networkStats
+	TxNetworkStatsEnabled bool `json:"tx-network-stats-enabled"`
+
+	// Track the gossip of the locally submitted transactions, and of them
+	// back by the peers, until their inclusion or for at most
+	// [TxPropagationReceiptsTTL], served by txpool_propagationStatus
+	TxPropagationReceiptsEnabled bool     `json:"tx-propagation-receipts-enabled"`
+	TxPropagationReceiptsTTL     Duration `json:"tx-propagation-receipts-ttl"`
+
+	// Addresses whose transactions are monitored from their admission in the
+	// tx pool to their acceptance, raising an alert if one is not accepted
+	// within [TxWatchMaxAge] or is evicted, see admin.watchedTransactions
+	TxWatchAddresses []common.Address `json:"tx-watch-addresses"`
+	TxWatchMaxAge    Duration         `json:"tx-watch-max-age"`
+
+	// Serve eth_reserveNonce and eth_releaseNonce, handing out the nonces of
+	// the senders sharing an account. The reservations are persisted and
+	// reclaimed if no transaction uses them within [NonceReservationTTL].
+	NonceReservationsEnabled bool     `json:"nonce-reservations-enabled"`
+	NonceReservationTTL      Duration `json:"nonce-reservation-ttl"`
+
+	// Refuse the exports issued through the avax API whose destination is
+	// not allowlisted with admin.addExportDestination, if their amount
+	// exceeds [ExportPolicyTxThreshold] or brings the amount exported over
+	// the last 24 hours to such destinations above
+	// [ExportPolicyDailyThreshold]. Exports carrying the
+	// [ExportPolicyOverrideToken] are issued regardless, if it is set.
+	ExportPolicyEnabled        bool   `json:"export-policy-enabled"`
+	ExportPolicyTxThreshold    uint64 `json:"export-policy-tx-threshold"`
+	ExportPolicyDailyThreshold uint64 `json:"export-policy-daily-threshold"`
+	ExportPolicyOverrideToken  string `json:"export-policy-override-token"`
+
+	// Index the ERC-20 Approval events of the accepted blocks by owner, token
+	// and spender, served by eth_getApprovals
+	ApprovalIndexEnabled bool `json:"approval-index-enabled"`
+
+	// Record the AVAX imported, exported and burned by the atomic txs of the
+	// accepted blocks, served by avax.getSupplyDelta. The blocks accepted
+	// before the index was enabled are covered by admin.backfillSupplyDelta.
+	SupplyDeltaIndexEnabled bool `json:"supply-delta-index-enabled"`
+
+	// Record the storage slots and code added by each account of the accepted
+	// blocks, by epochs of [StateGrowthEpochBlocks] heights, served by
+	// debug_getStateGrowth. Only the last [StateGrowthEpochsRetained] epochs
+	// are kept, or every epoch if zero.
+	StateGrowthIndexEnabled   bool   `json:"state-growth-index-enabled"`
+	StateGrowthEpochBlocks    uint64 `json:"state-growth-epoch-blocks"`
+	StateGrowthEpochsRetained uint64 `json:"state-growth-epochs-retained"`
+
 	// Log level
 	LogLevel string `json:"log-level"`
 
@@ -102,8 +370,36 @@ type Config struct {
 	OfflinePruningBloomFilterSize uint64 `json:"offline-pruning-bloom-filter-size"`
 	OfflinePruningDataDirectory   string `json:"offline-pruning-data-directory"`
 
+	// Schema Migration Settings
+	MigrationPolicy string `json:"migration-policy"` // "blocking" to migrate the database before starting, "background" to migrate it while serving the old format where possible
+
+	// Unix Socket Settings
+	UnixSocketDir         string `json:"unix-socket-dir"`         // If set to non-empty string, serves read-only APIs over a unix socket in this directory
+	UnixSocketPermissions string `json:"unix-socket-permissions"` // File permissions of the unix socket, in octal
+
+	// Forensic Dump Settings
+	ForensicDumpDir      string `json:"forensic-dump-dir"`       // If set to non-empty string, writes a forensic dump of blocks failing with a root mismatch
+	ForensicDumpMaxFiles int    `json:"forensic-dump-max-files"` // Maximum number of forensic dumps to maintain
+
 	// VM2VM network
 	MaxOutboundActiveRequests int64 `json:"max-outbound-active-requests"`
+
+	// Peers sending, within [GossipQuarantineWindow], more than
+	// [GossipQuarantineGarbageLimit] gossip and requests which cannot be
+	// decoded, or more than [GossipQuarantineVersionLimit] of an unknown codec
+	// version, have their messages dropped for [GossipQuarantineDuration]
+	// (a limit of 0 never quarantines the peers). The quarantined peers are
+	// listed and released with admin.quarantinedPeers and admin.releaseQuarantinedPeer
+	GossipQuarantineVersionLimit int      `json:"gossip-quarantine-version-limit"`
+	GossipQuarantineGarbageLimit int      `json:"gossip-quarantine-garbage-limit"`
+	GossipQuarantineWindow       Duration `json:"gossip-quarantine-window"`
+	GossipQuarantineDuration     Duration `json:"gossip-quarantine-duration"`
+
+	// The atomic txs delivered by gossip are not verified again within
+	// [AtomicGossipDiscardedRetention] of being discarded, or within
+	// [AtomicGossipAcceptedRetention] of being accepted
+	AtomicGossipDiscardedRetention Duration `json:"atomic-gossip-discarded-retention"`
+	AtomicGossipAcceptedRetention  Duration `json:"atomic-gossip-accepted-retention"`
 }
 
 // EthAPIs returns an array of strings representing the Eth APIs that should be enabled
@@ -111,29 +407,159 @@ func (c Config) EthAPIs() []string {
 	return c.EnabledEthAPIs
 }
 
+// EthAPIMethods returns the methods enabled by [EnabledEthAPIMethodGroups],
+// keyed by the name of the Ethereum service providing them.
+func (c Config) EthAPIMethods() (map[string][]string, error) {
+	return ethAPIMethods(c.EnabledEthAPIMethodGroups)
+}
+
 func (c Config) EthBackendSettings() eth.Settings {
-	return eth.Settings{MaxBlocksPerRequest: c.MaxBlocksPerRequest}
+	return eth.Settings{
+		MaxBlocksPerRequest:      c.MaxBlocksPerRequest,
+		MaxBlocksPerMultiRequest: c.MaxBlocksPerMultiRequest,
+		MaxLogsPerMultiRequest:   c.MaxLogsPerMultiRequest,
+
+		MaxBlocksScannedPerRequest:       c.MaxBlocksScannedPerRequest,
+		MaxLogsPerRequest:                c.MaxLogsPerRequest,
+		MaxConcurrentLogsRequestsPerConn: c.MaxConcurrentLogsRequestsPerConn,
+	}
 }
 
 func (c *Config) SetDefaults() {
-	c.EnabledEthAPIs = defaultEnabledAPIs
+	// Copied so that unmarshalling "eth-apis" does not overwrite the defaults
+	c.EnabledEthAPIs = append([]string{}, defaultEnabledAPIs...)
 	c.RPCGasCap = defaultRpcGasCap
 	c.RPCTxFeeCap = defaultRpcTxFeeCap
 	c.MetricsEnabled = defaultMetricsEnabled
 	c.MetricsExpensiveEnabled = defaultMetricsExpensiveEnabled
+	c.MetricsPersistenceFrequency.Duration = defaultMetricsPersistenceFrequency
 	c.APIMaxDuration.Duration = defaultApiMaxDuration
 	c.WSCPURefillRate.Duration = defaultWsCpuRefillRate
 	c.WSCPUMaxStored.Duration = defaultWsCpuMaxStored
 	c.MaxBlocksPerRequest = defaultMaxBlocksPerRequest
+	c.MaxBlocksPerMultiRequest = defaultMaxBlocksPerMultiRequest
+	c.MaxLogsPerMultiRequest = defaultMaxLogsPerMultiRequest
 	c.ContinuousProfilerFrequency.Duration = defaultContinuousProfilerFrequency
 	c.ContinuousProfilerMaxFiles = defaultContinuousProfilerMaxFiles
+	c.ForensicDumpMaxFiles = defaultForensicDumpMaxFiles
+	c.UnixSocketPermissions = defaultUnixSocketPermissions
 	c.Pruning = defaultPruningEnabled
 	c.SnapshotAsync = defaultSnapshotAsync
 	c.TxRegossipFrequency.Duration = defaultTxRegossipFrequency
 	c.TxRegossipMaxSize = defaultTxRegossipMaxSize
+	c.TxWatchMaxAge.Duration = defaultTxWatchMaxAge
+	c.NonceReservationTTL.Duration = defaultNonceReservationTTL
+	c.RPCReadinessMaxHeightLag = defaultRPCReadinessMaxHeightLag
+	c.HealthMaxStall.Duration = defaultHealthMaxStall
+	c.StallThreshold.Duration = defaultStallThreshold
+	c.StallDiagnosticsMaxFiles = defaultStallDiagnosticsMaxFiles
+	c.StallDiagnosticsMaxGoroutineBytes = defaultStallDiagnosticsMaxGoroutineBytes
+	c.WarmupBlocks = defaultWarmupBlocks
+	c.WarmupHotAccounts = defaultWarmupHotAccounts
+	c.WarmupDuration.Duration = defaultWarmupDuration
+	c.StateGrowthEpochBlocks = defaultStateGrowthEpochBlocks
+	c.CallAtMaxStaleness = defaultCallAtMaxStaleness
+	c.TraceConcurrency = defaultTraceConcurrency
+	c.TraceThrottledConcurrency = defaultTraceThrottledConcurrency
+	c.TraceQueueLimit = defaultTraceQueueLimit
+	c.SubmissionAuditMaxFileSize = defaultSubmissionAuditMaxFileSize
+	c.SubmissionAuditMaxFiles = defaultSubmissionAuditMaxFiles
+	c.SubmissionAuditSampleRate = defaultSubmissionAuditSampleRate
 	c.OfflinePruningBloomFilterSize = defaultOfflinePruningBloomFilterSize
 	c.LogLevel = defaultLogLevel
+	c.MigrationPolicy = defaultMigrationPolicy
 	c.MaxOutboundActiveRequests = defaultMaxOutboundActiveRequests
+	c.GossipQuarantineVersionLimit = defaultGossipQuarantineVersionLimit
+	c.GossipQuarantineGarbageLimit = defaultGossipQuarantineGarbageLimit
+	c.GossipQuarantineWindow.Duration = defaultGossipQuarantineWindow
+	c.GossipQuarantineDuration.Duration = defaultGossipQuarantineDuration
+	c.AtomicGossipDiscardedRetention.Duration = defaultAtomicGossipDiscardedRetention
+	c.AtomicGossipAcceptedRetention.Duration = defaultAtomicGossipAcceptedRetention
+	c.TxPropagationReceiptsTTL.Duration = defaultTxPropagationReceiptsTTL
+	c.BuilderTxTieBreak = defaultBuilderTxTieBreak
+}
+
+// Validate returns an error if [c] contains invalid settings.
+func (c *Config) Validate() error {
+	if _, err := c.EthAPIMethods(); err != nil {
+		return fmt.Errorf("invalid eth-api-method-groups: %w", err)
+	}
+	if c.UnixSocketDir != "" {
+		if _, err := c.UnixSocketFileMode(); err != nil {
+			return fmt.Errorf("invalid unix-socket-permissions: %w", err)
+		}
+	}
+	if c.MetricsPersistenceEnabled && c.MetricsPersistenceFrequency.Duration <= 0 {
+		return fmt.Errorf("metrics-persistence-frequency must be positive, found %s", c.MetricsPersistenceFrequency.Duration)
+	}
+	if c.HealthMaxStall.Duration <= 0 {
+		return fmt.Errorf("health-max-stall must be positive, found %s", c.HealthMaxStall.Duration)
+	}
+	if c.StallThreshold.Duration < 0 {
+		return fmt.Errorf("stall-threshold must not be negative, found %s", c.StallThreshold.Duration)
+	}
+	if c.NonceReservationsEnabled && c.NonceReservationTTL.Duration <= 0 {
+		return fmt.Errorf("nonce-reservation-ttl must be positive, found %s", c.NonceReservationTTL.Duration)
+	}
+	if c.StateGrowthIndexEnabled && c.StateGrowthEpochBlocks == 0 {
+		return fmt.Errorf("state-growth-epoch-blocks must be positive, found %d", c.StateGrowthEpochBlocks)
+	}
+	if _, err := c.BuilderTxTieBreakPolicy(); err != nil {
+		return err
+	}
+	if c.MigrationPolicy != migrationPolicyBlocking && c.MigrationPolicy != migrationPolicyBackground {
+		return fmt.Errorf("migration-policy must be %q or %q, found %q", migrationPolicyBlocking, migrationPolicyBackground, c.MigrationPolicy)
+	}
+	if c.TraceConcurrency > 0 && (c.TraceThrottledConcurrency <= 0 || c.TraceThrottledConcurrency > c.TraceConcurrency) {
+		return fmt.Errorf("trace-throttled-concurrency must be between 1 and trace-concurrency (%d), found %d", c.TraceConcurrency, c.TraceThrottledConcurrency)
+	}
+	if c.ExportPolicyEnabled && c.ExportPolicyDailyThreshold < c.ExportPolicyTxThreshold {
+		return fmt.Errorf("export-policy-daily-threshold (%d) must not be below export-policy-tx-threshold (%d)", c.ExportPolicyDailyThreshold, c.ExportPolicyTxThreshold)
+	}
+	if c.TraceQueueLimit < 0 {
+		return fmt.Errorf("trace-queue-limit must not be negative, found %d", c.TraceQueueLimit)
+	}
+	if c.SubmissionAuditEnabled {
+		if c.SubmissionAuditSampleRate <= 0 || c.SubmissionAuditSampleRate > 1 {
+			return fmt.Errorf("submission-audit-sample-rate must be in (0, 1], found %f", c.SubmissionAuditSampleRate)
+		}
+		if c.SubmissionAuditMaxFileSize < 0 || c.SubmissionAuditMaxFiles < 0 {
+			return fmt.Errorf("submission-audit-max-file-size and submission-audit-max-files must not be negative, found %d and %d", c.SubmissionAuditMaxFileSize, c.SubmissionAuditMaxFiles)
+		}
+	}
+	if c.TxPropagationReceiptsEnabled && c.TxPropagationReceiptsTTL.Duration <= 0 {
+		return fmt.Errorf("tx-propagation-receipts-ttl must be positive, found %s", c.TxPropagationReceiptsTTL.Duration)
+	}
+	if c.GossipQuarantineWindow.Duration <= 0 {
+		return fmt.Errorf("gossip-quarantine-window must be positive, found %s", c.GossipQuarantineWindow.Duration)
+	}
+	return nil
+}
+
+// BuilderTxTieBreakPolicy returns the order of the transactions paying the
+// same tip in the blocks built by the node, parsed from [BuilderTxTieBreak].
+func (c Config) BuilderTxTieBreakPolicy() (types.TxTieBreak, error) {
+	switch c.BuilderTxTieBreak {
+	case builderTxTieBreakFIFO:
+		return types.TxTieBreakFIFO, nil
+	case builderTxTieBreakHash:
+		return types.TxTieBreakHash, nil
+	default:
+		return 0, fmt.Errorf("builder-tx-tie-break must be %q or %q, found %q", builderTxTieBreakFIFO, builderTxTieBreakHash, c.BuilderTxTieBreak)
+	}
+}
+
+// UnixSocketFileMode returns the file permissions of the unix socket parsed
+// from [UnixSocketPermissions].
+func (c Config) UnixSocketFileMode() (os.FileMode, error) {
+	perm, err := strconv.ParseUint(c.UnixSocketPermissions, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if os.FileMode(perm)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("%q is not a file permission", c.UnixSocketPermissions)
+	}
+	return os.FileMode(perm), nil
 }
 
 func (d *Duration) UnmarshalJSON(data []byte) (err error) {
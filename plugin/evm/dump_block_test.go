@@ -0,0 +1,202 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/eth"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestDumpBlock(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, `{"pruning-enabled":false,"preimages-enabled":true}`, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	before := buildAndAcceptBlock(t, issuer, vm)
+
+	// Transfer to a new account and create a contract setting its slot 0 to
+	// 0x2a, leaving it without code
+	var (
+		sender    = testEthAddrs[0]
+		recipient = common.Address{0x01, 0x02}
+		contract  = crypto.CreateAddress(sender, 1)
+		value     = big.NewInt(1000)
+		gasPrice  = new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	)
+	txs := []*types.Transaction{
+		types.NewTransaction(0, recipient, value, 21000, gasPrice, nil),
+		types.NewContractCreation(1, common.Big0, 100000, gasPrice, common.FromHex("0x602a600055")),
+	}
+	for i, tx := range txs {
+		signedTx, err := types.SignTx(tx, types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = signedTx
+	}
+	for i, err := range vm.chain.AddRemoteTxsSync(txs) {
+		if err != nil {
+			t.Fatalf("Failed to add tx at index %d: %s", i, err)
+		}
+	}
+	after := buildAndAcceptBlock(t, issuer, vm)
+	var fees uint64
+	for _, receipt := range vm.chain.GetReceiptsByHash(common.Hash(after.ID())) {
+		fees += receipt.GasUsed * gasPrice.Uint64()
+	}
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"public-debug"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	// dump returns the accounts of the block at [height], requesting pages
+	// of [maxResults] accounts
+	dump := func(height uint64, maxResults int) (*eth.DumpBlockResult, int) {
+		var (
+			result   *eth.DumpBlockResult
+			requests int
+			opts     = &eth.DumpBlockOptions{MaxResults: maxResults, Storage: []common.Address{contract}}
+		)
+		for {
+			requests++
+			page := new(eth.DumpBlockResult)
+			if err := client.Call(page, "debug_dumpBlock", rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(height)), opts); err != nil {
+				t.Fatal(err)
+			}
+			if result == nil {
+				result = page
+			} else {
+				result.Accounts = append(result.Accounts, page.Accounts...)
+			}
+			if page.Next == nil {
+				return result, requests
+			}
+			opts.Start = page.Next
+		}
+	}
+	dumpBefore, _ := dump(before.Height(), 0)
+	dumpAfter, _ := dump(after.Height(), 0)
+	if dumpAfter.BlockHash != common.Hash(after.ID()) || uint64(dumpAfter.BlockNumber) != after.Height() {
+		t.Fatalf("Expected a dump of block %s at height %d, found %s at height %d", after.ID(), after.Height(), dumpAfter.BlockHash, dumpAfter.BlockNumber)
+	}
+
+	// The accounts are ordered by hashed key
+	for _, result := range []*eth.DumpBlockResult{dumpBefore, dumpAfter} {
+		for i := 1; i < len(result.Accounts); i++ {
+			if bytes.Compare(result.Accounts[i-1].SecureKey, result.Accounts[i].SecureKey) >= 0 {
+				t.Fatalf("Expected accounts ordered by hashed key, found %s before %s", result.Accounts[i-1].SecureKey, result.Accounts[i].SecureKey)
+			}
+		}
+	}
+
+	// Paging through the dump returns the same accounts
+	paged, requests := dump(after.Height(), 1)
+	if requests != len(dumpAfter.Accounts) {
+		t.Fatalf("Expected %d requests of a single account, found %d", len(dumpAfter.Accounts), requests)
+	}
+	if !reflect.DeepEqual(paged.Accounts, dumpAfter.Accounts) {
+		t.Fatal("Expected the paged dump to match the full dump")
+	}
+
+	// The diff between the dumps is the effect of the txs of the block, whose
+	// fees are sent to the coinbase
+	accountsBefore := make(map[common.Address]state.DumpAccount)
+	for _, account := range dumpBefore.Accounts {
+		accountsBefore[*account.Address] = account
+	}
+	coinbase := vm.chain.GetBlockByHash(common.Hash(after.ID())).Coinbase()
+	coinbaseBalance, ok := new(big.Int).SetString(accountsBefore[coinbase].Balance, 10)
+	if !ok {
+		coinbaseBalance = new(big.Int)
+	}
+	coinbaseBalance.Add(coinbaseBalance, new(big.Int).SetUint64(fees))
+	changed := make(map[common.Address]state.DumpAccount)
+	for _, account := range dumpAfter.Accounts {
+		if previous, ok := accountsBefore[*account.Address]; !ok || !reflect.DeepEqual(previous, account) {
+			changed[*account.Address] = account
+		}
+		delete(accountsBefore, *account.Address)
+	}
+	if len(accountsBefore) != 0 {
+		t.Fatalf("Expected no account to be deleted, found %d", len(accountsBefore))
+	}
+	if len(changed) != 4 {
+		t.Fatalf("Expected 4 changed accounts, found %d", len(changed))
+	}
+	initialBalance, _ := new(big.Int).SetString(dumpAccount(t, dumpBefore, sender).Balance, 10)
+	expectedBalance := new(big.Int).Sub(initialBalance, value)
+	expectedBalance.Sub(expectedBalance, new(big.Int).SetUint64(fees))
+	if account := changed[sender]; account.Balance != expectedBalance.String() || account.Nonce != 2 {
+		t.Fatalf("Expected sender balance %s and nonce 2, found %s and %d", expectedBalance, account.Balance, account.Nonce)
+	}
+	if account := changed[recipient]; account.Balance != value.String() || len(account.Storage) != 0 {
+		t.Fatalf("Expected recipient balance %s without storage, found %s with %d slots", value, account.Balance, len(account.Storage))
+	}
+	if account := changed[coinbase]; account.Balance != coinbaseBalance.String() {
+		t.Fatalf("Expected coinbase balance %s, found %s", coinbaseBalance, account.Balance)
+	}
+	expectedStorage := map[common.Hash]string{{}: "2a"}
+	if account := changed[contract]; !reflect.DeepEqual(account.Storage, expectedStorage) || len(account.Code) != 0 {
+		t.Fatalf("Expected contract storage %v without code, found %v with %d bytes of code", expectedStorage, account.Storage, len(account.Code))
+	}
+
+	// The snapshot holds the state of the last accepted block, and dumps it
+	// like the state trie
+	stateDb, err := vm.chain.BlockState(vm.chain.LastAcceptedBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &state.DumpConfig{OnlyWithAddresses: true, StorageAddresses: []common.Address{contract}}
+	fromTrie, fromSnapshot := new(eth.DumpBlockResult), new(eth.DumpBlockResult)
+	stateDb.DumpToCollector(fromTrie, conf)
+	if _, err := stateDb.DumpSnapshotToCollector(vm.chain.BlockChain().Snapshots(), fromSnapshot, conf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromTrie, fromSnapshot) {
+		t.Fatal("Expected the snapshot dump to match the trie dump")
+	}
+
+	// Only accepted blocks can be dumped
+	var result eth.DumpBlockResult
+	if err := client.Call(&result, "debug_dumpBlock", rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(after.Height()+1)), nil); err == nil {
+		t.Fatal("Expected a dump of a block above the last accepted block to fail")
+	}
+}
+
+// dumpAccount returns the account of [result] at [addr].
+func dumpAccount(t *testing.T, result *eth.DumpBlockResult, addr common.Address) state.DumpAccount {
+	for _, account := range result.Accounts {
+		if *account.Address == addr {
+			return account
+		}
+	}
+	t.Fatalf("Expected account %s in the dump", addr)
+	return state.DumpAccount{}
+}
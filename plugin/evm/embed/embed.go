@@ -0,0 +1,453 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// Package embed runs the C-Chain VM in process, without the plugin and gRPC
+// layers of avalanchego, for programs that drive the chain themselves: they
+// submit txs, build, verify and accept blocks, and serve its RPC APIs.
+//
+// The consensus engine is played by the embedding program, so a [Chain] never
+// builds or accepts a block on its own. It only requests blocks to be built,
+// which [Chain.WaitForBuildRequest] waits for.
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/chains/atomic"
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/database/manager"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow"
+	"github.com/zsmartex/avalanchego/snow/consensus/snowman"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+	"github.com/zsmartex/avalanchego/utils/constants"
+	"github.com/zsmartex/avalanchego/utils/formatting"
+	"github.com/zsmartex/avalanchego/utils/logging"
+	"github.com/zsmartex/avalanchego/version"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+const (
+	// EthRPCEndpoint and AvaxEndpoint are the paths of the eth and avax RPC
+	// APIs in [Chain.Handlers] and [Chain.Mux].
+	EthRPCEndpoint = "/rpc"
+	AvaxEndpoint   = "/avax"
+)
+
+var (
+	// DefaultChainID, DefaultXChainID and DefaultAVAXAssetID identify the
+	// chain, the chain it imports from and exports to, and the asset it
+	// pays fees in, unless set in the [Config].
+	DefaultChainID     = ids.ID{'C'}
+	DefaultXChainID    = ids.ID{'X'}
+	DefaultAVAXAssetID = ids.ID{'A', 'V', 'A', 'X'}
+
+	// dbVersion is the version of the database of the VM.
+	dbVersion = version.NewDefaultVersion(1, 4, 5)
+
+	errNoDatabase = errors.New("no database")
+	errShutdown   = errors.New("chain is shut down")
+)
+
+// Clock tells the time to the VM. [Chain] sets the clock of the VM to it
+// before each of its calls and each request it serves.
+type Clock interface {
+	Time() time.Time
+}
+
+// Config configures a [Chain].
+type Config struct {
+	// Database stores the chain. A [Chain] resumes from the last block
+	// accepted into it.
+	Database database.Database
+	// Genesis is the JSON of the genesis of the chain.
+	Genesis []byte
+	// ConfigJSON is the JSON of the config of the VM, empty for the defaults.
+	ConfigJSON []byte
+
+	// Clock is the clock of the VM, or nil for the wall clock.
+	Clock Clock
+	// SharedMemory is the shared memory of the chain, or nil for an empty one
+	// in memory.
+	SharedMemory atomic.SharedMemory
+	// AppSender sends the messages of the VM to its peers, or drops them if
+	// nil.
+	AppSender engCommon.AppSender
+
+	// NetworkID, ChainID, XChainID and AVAXAssetID identify the network, the
+	// chain, the chain it imports from and exports to and the asset it pays
+	// fees in. Their zero values stand for [constants.UnitTestID] and the
+	// defaults above.
+	NetworkID   uint32
+	ChainID     ids.ID
+	XChainID    ids.ID
+	AVAXAssetID ids.ID
+}
+
+// Chain is a bootstrapped VM whose consensus engine is played by the caller.
+//
+// Blocks are accepted one at a time through [Chain.AcceptBlock], which also
+// sets the preference of the VM.
+type Chain struct {
+	vm       *evm.VM
+	clock    Clock
+	toEngine chan engCommon.Message
+	handlers map[string]*engCommon.HTTPHandler
+	client   *rpc.Client
+
+	// [lock] serializes the calls that move the chain, and guards
+	// [preferred] and [shutdown].
+	lock      sync.Mutex
+	preferred ids.ID
+	shutdown  bool
+}
+
+// New initializes and bootstraps a VM on [config.Database].
+func New(config Config) (*Chain, error) {
+	if config.Database == nil {
+		return nil, errNoDatabase
+	}
+	dbManager, err := manager.NewManagerFromDBs([]*manager.VersionedDatabase{{
+		Database: config.Database,
+		Version:  dbVersion,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := newContext(config)
+	if err != nil {
+		return nil, err
+	}
+	appSender := config.AppSender
+	if appSender == nil {
+		appSender = noopSender{}
+	}
+
+	c := &Chain{
+		vm:       &evm.VM{},
+		clock:    config.Clock,
+		toEngine: make(chan engCommon.Message, 1),
+	}
+	c.syncClock()
+	if err := c.vm.Initialize(
+		ctx,
+		dbManager,
+		config.Genesis,
+		nil,
+		config.ConfigJSON,
+		c.toEngine,
+		[]*engCommon.Fx{},
+		appSender,
+	); err != nil {
+		return nil, fmt.Errorf("failed to initialize the VM: %w", err)
+	}
+	if err := c.start(); err != nil {
+		_ = c.vm.Shutdown()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newContext returns the context of a VM configured by [config].
+func newContext(config Config) (*snow.Context, error) {
+	ctx := snow.DefaultContextTest()
+	ctx.NetworkID = config.NetworkID
+	if ctx.NetworkID == 0 {
+		ctx.NetworkID = constants.UnitTestID
+	}
+	ctx.ChainID = withDefault(config.ChainID, DefaultChainID)
+	ctx.XChainID = withDefault(config.XChainID, DefaultXChainID)
+	ctx.AVAXAssetID = withDefault(config.AVAXAssetID, DefaultAVAXAssetID)
+	aliaser := ctx.BCLookup.(ids.Aliaser)
+	for alias, chainID := range map[string]ids.ID{"C": ctx.ChainID, "X": ctx.XChainID} {
+		if err := aliaser.Alias(chainID, alias); err != nil {
+			return nil, err
+		}
+		if err := aliaser.Alias(chainID, chainID.String()); err != nil {
+			return nil, err
+		}
+	}
+	ctx.SNLookup = primaryNetwork{}
+
+	if config.SharedMemory != nil {
+		ctx.SharedMemory = config.SharedMemory
+		return ctx, nil
+	}
+	sharedMemory := &atomic.Memory{}
+	if err := sharedMemory.Initialize(logging.NoLog{}, memdb.New()); err != nil {
+		return nil, err
+	}
+	ctx.SharedMemory = sharedMemory.NewSharedMemory(ctx.ChainID)
+	return ctx, nil
+}
+
+// withDefault returns [id], or [defaultID] if it is empty.
+func withDefault(id, defaultID ids.ID) ids.ID {
+	if id == ids.Empty {
+		return defaultID
+	}
+	return id
+}
+
+// start bootstraps the VM and creates its handlers.
+func (c *Chain) start() error {
+	if err := c.vm.SetState(snow.Bootstrapping); err != nil {
+		return err
+	}
+	if err := c.vm.SetState(snow.NormalOp); err != nil {
+		return err
+	}
+	lastAccepted, err := c.vm.LastAccepted()
+	if err != nil {
+		return err
+	}
+	c.preferred = lastAccepted
+
+	handlers, err := c.vm.CreateHandlers()
+	if err != nil {
+		return fmt.Errorf("failed to create the handlers: %w", err)
+	}
+	c.handlers = handlers
+	c.client = rpc.DialInProc(handlers[EthRPCEndpoint].Handler.(*rpc.Server))
+	return nil
+}
+
+// primaryNetwork places every chain in the primary network.
+type primaryNetwork struct{}
+
+func (primaryNetwork) SubnetID(ids.ID) (ids.ID, error) { return constants.PrimaryNetworkID, nil }
+
+// noopSender drops every message.
+type noopSender struct{}
+
+func (noopSender) SendAppRequest(ids.ShortSet, uint32, []byte) error { return nil }
+func (noopSender) SendAppResponse(ids.ShortID, uint32, []byte) error { return nil }
+func (noopSender) SendAppGossip([]byte) error                        { return nil }
+func (noopSender) SendAppGossipSpecific(ids.ShortSet, []byte) error  { return nil }
+
+// syncClock sets the clock of the VM to [c.clock], if any.
+func (c *Chain) syncClock() {
+	if c.clock != nil {
+		c.vm.Clock().Set(c.clock.Time())
+	}
+}
+
+// VM returns the VM of the chain, for the calls not covered by [Chain].
+func (c *Chain) VM() *evm.VM { return c.vm }
+
+// Handlers returns the RPC handlers of the VM by endpoint.
+func (c *Chain) Handlers() map[string]*engCommon.HTTPHandler { return c.handlers }
+
+// Mux returns a mux serving the RPC handlers of the VM at their endpoints,
+// which sets the clock of the VM before each request.
+func (c *Chain) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for endpoint, handler := range c.handlers {
+		handler := handler.Handler
+		mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+			c.syncClock()
+			handler.ServeHTTP(w, r)
+		})
+	}
+	return mux
+}
+
+// Client returns a client attached to the eth RPC API of the VM, which is
+// closed by [Chain.Shutdown].
+func (c *Chain) Client() *rpc.Client { return c.client }
+
+// SubmitTx submits [tx] to the tx pool and returns once it is added.
+func (c *Chain) SubmitTx(ctx context.Context, tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c.syncClock()
+	var hash common.Hash
+	return c.client.CallContext(ctx, &hash, "eth_sendRawTransaction", hexutil.Bytes(raw))
+}
+
+// SubmitAtomicTx submits [tx] to the atomic mempool and returns once it is
+// added.
+func (c *Chain) SubmitAtomicTx(tx *evm.Tx) error {
+	txHex, err := formatting.EncodeWithChecksum(formatting.Hex, tx.Bytes())
+	if err != nil {
+		return err
+	}
+	return c.CallAvax("avax.issueTx", map[string]interface{}{"tx": txHex, "encoding": formatting.Hex}, nil)
+}
+
+// CallAvax calls [method] of the avax API of the VM with [args], and decodes
+// its result into [reply] unless it is nil.
+func (c *Chain) CallAvax(method string, args interface{}, reply interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  args,
+	})
+	if err != nil {
+		return err
+	}
+	req := httptest.NewRequest(http.MethodPost, AvaxEndpoint, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	c.syncClock()
+	c.handlers[AvaxEndpoint].Handler.ServeHTTP(w, req)
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		return fmt.Errorf("invalid response %q: %w", w.Body.String(), err)
+	}
+	if response.Error != nil {
+		return errors.New(response.Error.Message)
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, reply)
+}
+
+// WaitForBuildRequest waits until the VM requests a block to be built, as it
+// does once it has txs to include.
+func (c *Chain) WaitForBuildRequest(ctx context.Context) error {
+	select {
+	case <-c.toEngine:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BuildBlock builds a block on the preferred block, without verifying it.
+func (c *Chain) BuildBlock() (snowman.Block, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown {
+		return nil, errShutdown
+	}
+	c.syncClock()
+	return c.vm.BuildBlock()
+}
+
+// ParseBlock parses the block [b], built by a VM of the same chain.
+func (c *Chain) ParseBlock(b []byte) (snowman.Block, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown {
+		return nil, errShutdown
+	}
+	c.syncClock()
+	return c.vm.ParseBlock(b)
+}
+
+// VerifyBlock verifies [blk], whose parent must be verified or accepted.
+func (c *Chain) VerifyBlock(blk snowman.Block) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown {
+		return errShutdown
+	}
+	c.syncClock()
+	return blk.Verify()
+}
+
+// AcceptBlock prefers and accepts the verified [blk], a child of the last
+// accepted block. It returns once the tx pool is reset to [blk], so that the
+// next block built is built on it.
+func (c *Chain) AcceptBlock(blk snowman.Block) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown {
+		return errShutdown
+	}
+	c.syncClock()
+
+	// The tx pool is only reset when the preference changes
+	reorgs := make(chan core.NewTxPoolReorgEvent, 1)
+	sub := c.vm.SubscribeTxPoolReorgs(reorgs)
+	defer sub.Unsubscribe()
+	reset := c.preferred == blk.ID()
+
+	if err := c.vm.SetPreference(blk.ID()); err != nil {
+		return err
+	}
+	c.preferred = blk.ID()
+	if err := blk.Accept(); err != nil {
+		return fmt.Errorf("failed to accept block %s: %w", blk.ID(), err)
+	}
+	for !reset {
+		select {
+		case reorg := <-reorgs:
+			reset = reorg.Head.Hash() == common.Hash(blk.ID())
+		case err := <-sub.Err():
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildAndAccept waits for the VM to request a block, and builds, verifies
+// and accepts it.
+func (c *Chain) BuildAndAccept(ctx context.Context) (snowman.Block, error) {
+	if err := c.WaitForBuildRequest(ctx); err != nil {
+		return nil, err
+	}
+	blk, err := c.BuildBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a block: %w", err)
+	}
+	if err := c.VerifyBlock(blk); err != nil {
+		return nil, fmt.Errorf("failed to verify block %s: %w", blk.ID(), err)
+	}
+	if err := c.AcceptBlock(blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// LastAccepted returns the last accepted block.
+func (c *Chain) LastAccepted() (snowman.Block, error) {
+	lastAccepted, err := c.vm.LastAccepted()
+	if err != nil {
+		return nil, err
+	}
+	return c.vm.GetBlock(lastAccepted)
+}
+
+// Shutdown shuts down the VM, leaving [Config.Database] open.
+func (c *Chain) Shutdown() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.shutdown {
+		return nil
+	}
+	c.shutdown = true
+	c.client.Close()
+	return c.vm.Shutdown()
+}
@@ -0,0 +1,209 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package embed_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm/embed"
+)
+
+var (
+	testKey, _ = ethcrypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = ethcrypto.PubkeyToAddress(testKey.PublicKey)
+	recipient  = common.HexToAddress("0x1234567890123456789012345678901234567890")
+	testTime   = time.Unix(1_600_000_000, 0)
+)
+
+// testGenesis returns the genesis of a chain funding [testAddr].
+func testGenesis(t *testing.T) []byte {
+	genesis, err := json.Marshal(&core.Genesis{
+		Config:     params.TestApricotPhase5Config,
+		GasLimit:   params.ApricotPhase1GasLimit,
+		Difficulty: common.Big0,
+		Alloc:      core.GenesisAlloc{testAddr: {Balance: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(10))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genesis
+}
+
+// newTestChain returns a chain on [db] with [clock], shut down when [t]
+// completes.
+func newTestChain(t *testing.T, db *memdb.Database, clock embed.Clock) *embed.Chain {
+	chain, err := embed.New(embed.Config{Database: db, Genesis: testGenesis(t), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := chain.Shutdown(); err != nil {
+			t.Errorf("Failed to shut down the chain: %s", err)
+		}
+	})
+	return chain
+}
+
+// transfer returns the transfer of [amount] wei from [testAddr] to
+// [recipient] with [nonce].
+func transfer(t *testing.T, nonce uint64, amount int64) *types.Transaction {
+	signer := types.LatestSignerForChainID(params.TestApricotPhase5Config.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(nonce, recipient, big.NewInt(amount), params.TxGas, big.NewInt(params.ApricotPhase4MaxBaseFee), nil), signer, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// buildAndAccept submits [tx] to [chain], advancing [clock] by 2 seconds, and
+// builds and accepts the block including it.
+func buildAndAccept(t *testing.T, chain *embed.Chain, clock *mockable.Clock, tx *types.Transaction) *types.Block {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := chain.SubmitTx(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	clock.Set(clock.Time().Add(2 * time.Second))
+	blk, err := chain.BuildAndAccept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(blk.Bytes(), block); err != nil {
+		t.Fatal(err)
+	}
+	if !blk.Timestamp().Equal(clock.Time()) {
+		t.Fatalf("Expected block %d at %s, found %s", blk.Height(), clock.Time(), blk.Timestamp())
+	}
+	return block
+}
+
+func TestChainBuildAndAccept(t *testing.T) {
+	clock := &mockable.Clock{}
+	clock.Set(testTime)
+	chain := newTestChain(t, memdb.New(), clock)
+
+	tx := transfer(t, 0, 1000)
+	block := buildAndAccept(t, chain, clock, tx)
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != tx.Hash() {
+		t.Fatalf("Expected block %d to include tx %s, found %d txs", block.NumberU64(), tx.Hash(), len(block.Transactions()))
+	}
+	lastAccepted, err := chain.LastAccepted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastAccepted.Height() != 1 || common.Hash(lastAccepted.ID()) != block.Hash() {
+		t.Fatalf("Expected block %s to be the last accepted, found %s at %d", block.Hash(), lastAccepted.ID(), lastAccepted.Height())
+	}
+
+	// Serve the eth API over HTTP from the mux
+	server := httptest.NewServer(chain.Mux())
+	defer server.Close()
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "eth_getBalance",
+		"params":  []interface{}{recipient, "latest"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(server.URL+embed.EthRPCEndpoint, "application/json", bytes.NewReader(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Result hexutil.Big `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result.ToInt().Int64() != 1000 {
+		t.Fatalf("Expected a balance of 1000, found %d", reply.Result.ToInt())
+	}
+}
+
+func TestChainVerifyRemoteBlock(t *testing.T) {
+	clock := &mockable.Clock{}
+	clock.Set(testTime)
+	builder := newTestChain(t, memdb.New(), clock)
+	verifier := newTestChain(t, memdb.New(), clock)
+
+	// Accept the blocks of [builder] on [verifier] from their bytes
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		block := buildAndAccept(t, builder, clock, transfer(t, nonce, 1000))
+		blk, err := builder.LastAccepted()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := verifier.ParseBlock(blk.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.ID() != blk.ID() {
+			t.Fatalf("Expected to parse block %s, found %s", blk.ID(), parsed.ID())
+		}
+		if err := verifier.VerifyBlock(parsed); err != nil {
+			t.Fatalf("Failed to verify block %d: %s", block.NumberU64(), err)
+		}
+		if err := verifier.AcceptBlock(parsed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var balance hexutil.Big
+	if err := verifier.Client().Call(&balance, "eth_getBalance", recipient, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if balance.ToInt().Int64() != 2000 {
+		t.Fatalf("Expected a balance of 2000, found %d", balance.ToInt())
+	}
+}
+
+func TestChainRestart(t *testing.T) {
+	clock := &mockable.Clock{}
+	clock.Set(testTime)
+	db := memdb.New()
+	chain, err := embed.New(embed.Config{Database: db, Genesis: testGenesis(t), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := buildAndAccept(t, chain, clock, transfer(t, 0, 1000))
+	if err := chain.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.BuildBlock(); err == nil {
+		t.Fatal("Expected building a block on a shut down chain to fail")
+	}
+
+	// The chain resumes from the last accepted block
+	restarted := newTestChain(t, db, clock)
+	lastAccepted, err := restarted.LastAccepted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.Hash(lastAccepted.ID()) != block.Hash() {
+		t.Fatalf("Expected to resume from block %s, found %s", block.Hash(), lastAccepted.ID())
+	}
+	buildAndAccept(t, restarted, clock, transfer(t, 1, 1000))
+}
@@ -0,0 +1,208 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+)
+
+// exportPolicyWindow is the period over which the exports to destinations
+// that are not allowlisted are summed up.
+const exportPolicyWindow = 24 * time.Hour
+
+var (
+	exportDestinationsPrefix = []byte("export_destinations")
+
+	errExportPolicyOff = errors.New("export policy is disabled")
+)
+
+// exportDestination is a destination of exports, the address [to] on the chain
+// [chainID].
+type exportDestination struct {
+	chainID ids.ID
+	to      ids.ShortID
+}
+
+func (d exportDestination) key() []byte {
+	key := make([]byte, 0, len(d.chainID)+len(d.to))
+	key = append(key, d.chainID[:]...)
+	return append(key, d.to[:]...)
+}
+
+// exportRecord is an export to a destination that is not allowlisted, counted
+// towards the rolling threshold.
+type exportRecord struct {
+	assetID ids.ID
+	amount  uint64
+	time    time.Time
+}
+
+// exportPolicy guards the exports issued through the avax API of this node
+// against operator mistakes: the exports of an amount above [txThreshold], or
+// bringing the amount exported over the last [exportPolicyWindow] to
+// destinations that are not allowlisted above [dailyThreshold], are refused
+// unless their destination is allowlisted. Amounts are in the units of the
+// exported asset, and summed up for each asset.
+//
+// The policy is node-local: it is not consulted when verifying the exports
+// gossiped by other nodes or accepted in blocks. An export carrying
+// [overrideToken] is issued regardless of the policy, and logged loudly.
+//
+// The allowlist is written to [db] as it changes so that it is kept across
+// restarts, the rolling amounts are kept in memory.
+type exportPolicy struct {
+	lock sync.Mutex
+
+	db                          database.Database
+	txThreshold, dailyThreshold uint64
+	overrideToken               string
+	clock                       *mockable.Clock
+
+	allowlist map[exportDestination]struct{}
+	// [records] are ordered by time
+	records []*exportRecord
+}
+
+// newExportPolicy returns the export policy of [vm], restoring the allowlist
+// held in [db].
+func (vm *VM) newExportPolicy(db database.Database) (*exportPolicy, error) {
+	p := &exportPolicy{
+		db:             db,
+		txThreshold:    vm.config.ExportPolicyTxThreshold,
+		dailyThreshold: vm.config.ExportPolicyDailyThreshold,
+		overrideToken:  vm.config.ExportPolicyOverrideToken,
+		clock:          &vm.clock,
+		allowlist:      make(map[exportDestination]struct{}),
+	}
+	if err := p.restore(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// restore loads the allowlist from the database.
+func (p *exportPolicy) restore() error {
+	it := p.db.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(ids.ID{})+len(ids.ShortID{}) {
+			return fmt.Errorf("malformed export destination %x", key)
+		}
+		var dest exportDestination
+		copy(dest.chainID[:], key)
+		copy(dest.to[:], key[len(dest.chainID):])
+		p.allowlist[dest] = struct{}{}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if len(p.allowlist) > 0 {
+		log.Info("Restored export destinations", "destinations", len(p.allowlist))
+	}
+	return nil
+}
+
+// add allowlists [dest].
+func (p *exportPolicy) add(dest exportDestination) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.db.Put(dest.key(), nil); err != nil {
+		return err
+	}
+	p.allowlist[dest] = struct{}{}
+	return nil
+}
+
+// remove removes [dest] from the allowlist, returning false if it was not
+// allowlisted.
+func (p *exportPolicy) remove(dest exportDestination) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.allowlist[dest]; !ok {
+		return false, nil
+	}
+	if err := p.db.Delete(dest.key()); err != nil {
+		return false, err
+	}
+	delete(p.allowlist, dest)
+	return true, nil
+}
+
+// authorize checks an export of [amount] of [assetID] to [dest] against the
+// policy. An authorized export to a destination that is not allowlisted is
+// counted towards the rolling threshold, and the returned record is passed to
+// [cancel] if the export is not issued.
+func (p *exportPolicy) authorize(assetID ids.ID, amount uint64, dest exportDestination, token string) (*exportRecord, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.allowlist[dest]; ok {
+		return nil, nil
+	}
+	now := p.clock.Time()
+	p.expire(now)
+
+	exported := uint64(0)
+	for _, record := range p.records {
+		if record.assetID == assetID {
+			exported += record.amount
+		}
+	}
+	var violation error
+	switch {
+	case amount > p.txThreshold:
+		violation = fmt.Errorf("export of %d exceeds the per-tx threshold of %d for destinations that are not allowlisted", amount, p.txThreshold)
+	case exported+amount < exported || exported+amount > p.dailyThreshold:
+		violation = fmt.Errorf("export of %d would bring the amount exported over the last %s to destinations that are not allowlisted to %d, above the threshold of %d", amount, exportPolicyWindow, exported+amount, p.dailyThreshold)
+	}
+	if violation != nil {
+		if p.overrideToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.overrideToken)) != 1 {
+			return nil, fmt.Errorf("%w: add the destination with admin.addExportDestination first", violation)
+		}
+		log.Warn("EXPORT POLICY OVERRIDDEN with the override token", "chainID", dest.chainID, "to", dest.to, "assetID", assetID, "amount", amount, "violation", violation)
+	}
+	record := &exportRecord{assetID: assetID, amount: amount, time: now}
+	p.records = append(p.records, record)
+	return record, nil
+}
+
+// cancel stops counting [record] towards the rolling threshold.
+func (p *exportPolicy) cancel(record *exportRecord) {
+	if record == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i, r := range p.records {
+		if r == record {
+			p.records = append(p.records[:i], p.records[i+1:]...)
+			return
+		}
+	}
+}
+
+// expire drops the records older than [exportPolicyWindow].
+// Assumes [p.lock] is held.
+func (p *exportPolicy) expire(now time.Time) {
+	expired := 0
+	for expired < len(p.records) && now.Sub(p.records[expired].time) >= exportPolicyWindow {
+		expired++
+	}
+	p.records = p.records[expired:]
+}
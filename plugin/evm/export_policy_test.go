@@ -0,0 +1,190 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+)
+
+func newTestExportPolicy(t *testing.T, db *memdb.Database, clock *mockable.Clock) *exportPolicy {
+	p := &exportPolicy{
+		db:             db,
+		txThreshold:    100,
+		dailyThreshold: 250,
+		overrideToken:  "break-glass",
+		clock:          clock,
+		allowlist:      make(map[exportDestination]struct{}),
+	}
+	if err := p.restore(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExportPolicyThresholds(t *testing.T) {
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_000_000, 0))
+	p := newTestExportPolicy(t, memdb.New(), clock)
+	assetID := ids.ID{1}
+	dest := exportDestination{chainID: testXChainID, to: ids.ShortID{2}}
+
+	// An export of the per-tx threshold is authorized, one above it is not
+	if _, err := p.authorize(assetID, 100, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.authorize(assetID, 101, dest, ""); err == nil || !strings.Contains(err.Error(), "per-tx threshold") {
+		t.Fatalf("Expected the export above the per-tx threshold to be refused, found %v", err)
+	}
+
+	// The exports are summed up to the rolling threshold, for each asset
+	if _, err := p.authorize(assetID, 100, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.authorize(assetID, 51, dest, ""); err == nil || !strings.Contains(err.Error(), "above the threshold of 250") {
+		t.Fatalf("Expected the export above the rolling threshold to be refused, found %v", err)
+	}
+	if _, err := p.authorize(ids.ID{3}, 100, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+	record, err := p.authorize(assetID, 50, dest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An export that is not issued no longer counts
+	p.cancel(record)
+	if _, err := p.authorize(assetID, 50, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.authorize(assetID, 1, dest, ""); err == nil {
+		t.Fatal("Expected the export above the rolling threshold to be refused")
+	}
+
+	// The exports older than the window no longer count
+	clock.Set(clock.Time().Add(exportPolicyWindow - time.Second))
+	if _, err := p.authorize(assetID, 1, dest, ""); err == nil {
+		t.Fatal("Expected the export above the rolling threshold to be refused within the window")
+	}
+	clock.Set(clock.Time().Add(time.Second))
+	if _, err := p.authorize(assetID, 100, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportPolicyAllowlist(t *testing.T) {
+	db := memdb.New()
+	clock := &mockable.Clock{}
+	p := newTestExportPolicy(t, db, clock)
+	assetID := ids.ID{1}
+	dest := exportDestination{chainID: testXChainID, to: ids.ShortID{2}}
+
+	if _, err := p.authorize(assetID, 1000, dest, ""); err == nil {
+		t.Fatal("Expected the export to a destination that is not allowlisted to be refused")
+	}
+
+	// An allowlisted destination is exempt from the thresholds, and its
+	// exports are not counted towards them
+	if err := p.add(dest); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := p.authorize(assetID, 1000, dest, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.authorize(assetID, 100, exportDestination{chainID: testXChainID, to: ids.ShortID{3}}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The allowlist is kept across restarts
+	restored := newTestExportPolicy(t, db, clock)
+	if _, err := restored.authorize(assetID, 1000, dest, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A removed destination is subject to the thresholds again
+	if removed, err := p.remove(dest); err != nil || !removed {
+		t.Fatalf("Expected the destination to be removed, found %v, %v", removed, err)
+	}
+	if removed, err := p.remove(dest); err != nil || removed {
+		t.Fatalf("Expected the destination to be removed already, found %v, %v", removed, err)
+	}
+	if _, err := p.authorize(assetID, 1000, dest, ""); err == nil {
+		t.Fatal("Expected the export to a removed destination to be refused")
+	}
+	if restored := newTestExportPolicy(t, db, clock); len(restored.allowlist) != 0 {
+		t.Fatalf("Expected the removal to be persisted, found %d destinations", len(restored.allowlist))
+	}
+}
+
+func TestExportPolicyOverride(t *testing.T) {
+	p := newTestExportPolicy(t, memdb.New(), &mockable.Clock{})
+	assetID := ids.ID{1}
+	dest := exportDestination{chainID: testXChainID, to: ids.ShortID{2}}
+
+	if _, err := p.authorize(assetID, 1000, dest, "guess"); err == nil {
+		t.Fatal("Expected the export with a wrong override token to be refused")
+	}
+	if _, err := p.authorize(assetID, 1000, dest, "break-glass"); err != nil {
+		t.Fatal(err)
+	}
+	// The overridden export counts towards the rolling threshold
+	if _, err := p.authorize(assetID, 1, dest, ""); err == nil {
+		t.Fatal("Expected the export above the rolling threshold to be refused")
+	}
+
+	// Without a token configured, no export overrides the policy
+	p.overrideToken = ""
+	if _, err := p.authorize(assetID, 1000, dest, ""); err == nil {
+		t.Fatal("Expected the export with an empty override token to be refused")
+	}
+}
+
+func TestExportPolicyAPI(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase5, `{"export-policy-enabled": true, "export-policy-tx-threshold": 10, "export-policy-daily-threshold": 10}`, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	to, err := vm.FormatAddress(testXChainID, testShortIDAddrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := func() error {
+		return (&AvaxAPI{vm}).ExportAVAX(nil, &ExportAVAXArgs{
+			UserPass: api.UserPass{Username: username, Password: password},
+			Amount:   json.Uint64(11),
+			To:       to,
+		}, &api.JSONTxID{})
+	}
+	if err := export(); err == nil || !strings.Contains(err.Error(), "per-tx threshold") {
+		t.Fatalf("Expected the export to be refused by the policy, found %v", err)
+	}
+
+	// The allowlisted destination passes the policy, the user holding no
+	// funds to export
+	admin := NewAdminService(vm, "")
+	if err := admin.AddExportDestination(nil, &ExportDestinationArgs{To: to}, &api.SuccessResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := export(); err == nil || strings.Contains(err.Error(), "threshold") {
+		t.Fatalf("Expected the export to pass the policy, found %v", err)
+	}
+	if err := admin.RemoveExportDestination(nil, &ExportDestinationArgs{To: to}, &api.SuccessResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := export(); err == nil || !strings.Contains(err.Error(), "per-tx threshold") {
+		t.Fatalf("Expected the export to be refused by the policy, found %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/avalanchego/utils/perms"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+const (
+	// exportFormatRLP writes the RLP encoding of each block, as read by
+	// admin_importChain.
+	exportFormatRLP = "rlp"
+	// exportFormatJSONL writes a line holding the JSON encoding of each block
+	// and its receipts.
+	exportFormatJSONL = "jsonl"
+)
+
+var errExportFileExists = errors.New("location would overwrite an existing file")
+
+// exportedBlockJSON is a line of a JSONL export.
+type exportedBlockJSON struct {
+	Header       *types.Header        `json:"header"`
+	Transactions []*types.Transaction `json:"transactions"`
+	Uncles       []*types.Header      `json:"uncles"`
+	Version      uint32               `json:"version"`
+	ExtData      hexutil.Bytes        `json:"extData"`
+	Receipts     types.Receipts       `json:"receipts"`
+}
+
+// exportRangeToFile writes the accepted blocks from [from] to [to] to the file
+// at [path] in [format], and returns the number of blocks written. The file
+// is written to a temporary file that is only moved into place once the
+// export is complete. An existing file is not overwritten.
+func (vm *VM) exportRangeToFile(ctx context.Context, path string, from, to uint64, format string) (uint64, error) {
+	var encode func(w io.Writer, header *types.Header, body *types.Body, receipts types.Receipts) error
+	switch format {
+	case exportFormatRLP, "":
+		encode = encodeExportedBlockRLP
+	case exportFormatJSONL:
+		encode = encodeExportedBlockJSONL
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return 0, errExportFileExists
+	}
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perms.ReadWrite)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		buf      = bufio.NewWriter(f)
+		exported uint64
+	)
+	err = vm.chain.ExportAcceptedRange(ctx, from, to, func(header *types.Header, body *types.Body, receipts types.Receipts) error {
+		exported++
+		return encode(buf, header, body, receipts)
+	})
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return 0, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, err
+	}
+	log.Info("Exported accepted blocks", "path", path, "from", from, "to", to, "format", format)
+	return exported, nil
+}
+
+func encodeExportedBlockRLP(w io.Writer, header *types.Header, body *types.Body, receipts types.Receipts) error {
+	block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles, body.Version, body.ExtData)
+	return block.EncodeRLP(w)
+}
+
+func encodeExportedBlockJSONL(w io.Writer, header *types.Header, body *types.Body, receipts types.Receipts) error {
+	line := exportedBlockJSON{
+		Header:       header,
+		Transactions: body.Transactions,
+		Uncles:       body.Uncles,
+		Version:      body.Version,
+		Receipts:     receipts,
+	}
+	if body.ExtData != nil {
+		line.ExtData = *body.ExtData
+	}
+	// Encoder.Encode terminates each encoding with a newline
+	return json.NewEncoder(w).Encode(&line)
+}
@@ -0,0 +1,190 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	avajson "github.com/zsmartex/avalanchego/utils/json"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestExportRangeToFile(t *testing.T) {
+	importAmount := uint64(500000000)
+	utxos := map[ids.ShortID]uint64{testShortIDAddrs[0]: importAmount}
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", utxos)
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		sendEthTxs(t, vm, types.NewTransaction(nonce, testEthAddrs[1], common.Big1, 21_000, gasPrice, nil))
+		buildAndAcceptBlock(t, issuer, vm)
+	}
+	lastAccepted := vm.chain.LastAcceptedBlock().NumberU64()
+
+	dir := t.TempDir()
+	rlpPath, jsonlPath := filepath.Join(dir, "blocks.rlp"), filepath.Join(dir, "blocks.jsonl")
+	admin := NewAdminService(vm, "")
+	for _, path := range []string{rlpPath, jsonlPath} {
+		args := &ExportRangeToFileArgs{Path: path, From: 1, To: avajson.Uint64(lastAccepted), Format: filepath.Ext(path)[1:]}
+		reply := &api.SuccessResponse{}
+		if err := admin.ExportRangeToFile(&http.Request{}, args, reply); err != nil || !reply.Success {
+			t.Fatalf("Failed to export to %s: %v", path, err)
+		}
+		// An existing file is not overwritten
+		if err := admin.ExportRangeToFile(&http.Request{}, args, reply); !errors.Is(err, errExportFileExists) {
+			t.Fatalf("Expected the export to refuse to overwrite %s, found %v", path, err)
+		}
+	}
+
+	// Each line of the JSONL export holds a block and its receipts
+	f, err := os.Open(jsonlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	number := uint64(1)
+	for ; scanner.Scan(); number++ {
+		var line exportedBlockJSON
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		block := vm.chain.GetBlockByNumber(number)
+		if line.Header.Hash() != block.Hash() {
+			t.Fatalf("Expected the header of block %d to be %s, found %s", number, block.Hash(), line.Header.Hash())
+		}
+		if len(line.Transactions) != len(block.Transactions()) || len(line.Receipts) != len(block.Transactions()) {
+			t.Fatalf("Expected %d txs and receipts in block %d, found %d and %d", len(block.Transactions()), number, len(line.Transactions), len(line.Receipts))
+		}
+		if !bytes.Equal(line.ExtData, block.ExtData()) {
+			t.Fatalf("Expected the ext data of block %d to be exported", number)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if number != lastAccepted+1 {
+		t.Fatalf("Expected %d lines, found %d", lastAccepted, number-1)
+	}
+
+	// The RLP export is imported by a fresh node with the same genesis
+	_, importer, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, `{"eth-apis":["private-admin"]}`, "", utxos)
+	defer func() {
+		if err := importer.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	handlers, err := importer.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+	var imported bool
+	if err := client.Call(&imported, "admin_importChain", rlpPath); err != nil || !imported {
+		t.Fatalf("Failed to import the RLP export: %v", err)
+	}
+	for number := uint64(1); number <= lastAccepted; number++ {
+		block := vm.chain.GetBlockByNumber(number)
+		importedBlock := importer.chain.GetBlockByHash(block.Hash())
+		if importedBlock == nil || importedBlock.Root() != block.Root() {
+			t.Fatalf("Expected block %d (%s) to be imported", number, block.Hash())
+		}
+	}
+}
+
+func TestExportAcceptedRange(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 500000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	sendEthTxs(t, vm, types.NewTransaction(0, testEthAddrs[1], common.Big1, 21_000, gasPrice, nil))
+	buildAndAcceptBlock(t, issuer, vm)
+	lastAccepted := vm.chain.LastAcceptedBlock().NumberU64()
+	noop := func(*types.Header, *types.Body, types.Receipts) error { return nil }
+
+	// The blocks are passed in order, up to the last accepted block
+	var numbers []uint64
+	err = vm.chain.ExportAcceptedRange(context.Background(), 0, lastAccepted, func(header *types.Header, body *types.Body, receipts types.Receipts) error {
+		numbers = append(numbers, header.Number.Uint64())
+		if len(receipts) != len(body.Transactions) {
+			t.Fatalf("Expected %d receipts in block %d, found %d", len(body.Transactions), header.Number, len(receipts))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, number := range numbers {
+		if number != uint64(i) {
+			t.Fatalf("Expected block %d at index %d, found %d", i, i, number)
+		}
+	}
+	if uint64(len(numbers)) != lastAccepted+1 {
+		t.Fatalf("Expected %d blocks, found %d", lastAccepted+1, len(numbers))
+	}
+	if err := vm.chain.ExportAcceptedRange(context.Background(), 0, lastAccepted+1, noop); err == nil {
+		t.Fatal("Expected an export above the last accepted block to fail")
+	}
+
+	// The export stops once the context is cancelled, or at the first error
+	// of the callback
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err = vm.chain.ExportAcceptedRange(ctx, 0, lastAccepted, func(*types.Header, *types.Body, types.Receipts) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Fatalf("Expected the export to be cancelled after a block, found %d blocks and %v", calls, err)
+	}
+	errStop := errors.New("stop")
+	if err := vm.chain.ExportAcceptedRange(context.Background(), 0, lastAccepted, func(*types.Header, *types.Body, types.Receipts) error { return errStop }); !errors.Is(err, errStop) {
+		t.Fatalf("Expected the error of the callback, found %v", err)
+	}
+}
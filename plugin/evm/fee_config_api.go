@@ -0,0 +1,83 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// FeeParam is a fee parameter and the activation that supplied it.
+type FeeParam struct {
+	Value      *hexutil.Big `json:"value"`
+	Activation string       `json:"activation"`
+}
+
+// FeeConfigAt are the fee parameters selected by the rules active at the
+// timestamp of a block, which the consensus engine applies to compute its
+// block gas cost and the base fee of its child. The parameters that do not
+// apply are omitted.
+type FeeConfigAt struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+
+	TargetGas                *FeeParam `json:"targetGas,omitempty"`
+	BaseFeeChangeDenominator *FeeParam `json:"baseFeeChangeDenominator,omitempty"`
+	MinBaseFee               *FeeParam `json:"minBaseFee,omitempty"`
+	MaxBaseFee               *FeeParam `json:"maxBaseFee,omitempty"`
+	BlockGasFee              *FeeParam `json:"blockGasFee,omitempty"`
+	TargetBlockRate          *FeeParam `json:"targetBlockRate,omitempty"`
+	MinBlockGasCost          *FeeParam `json:"minBlockGasCost,omitempty"`
+	MaxBlockGasCost          *FeeParam `json:"maxBlockGasCost,omitempty"`
+	BlockGasCostStep         *FeeParam `json:"blockGasCostStep,omitempty"`
+}
+
+// FeeConfigAPI serves the historical fee parameters in the eth namespace.
+type FeeConfigAPI struct{ vm *VM }
+
+// GetFeeConfigAt returns the fee parameters that applied at the block
+// [blockNrOrHash]. They are selected by the same code as the consensus
+// engine, from the chain config at the timestamp of the block.
+func (api *FeeConfigAPI) GetFeeConfigAt(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*FeeConfigAt, error) {
+	header, err := api.vm.chain.APIBackend().HeaderByNumberOrHash(ctx, blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block %s not found", blockNrOrHash.String())
+	}
+	fc := dummy.FeeConfigAt(api.vm.chainConfig, header.Time)
+	return &FeeConfigAt{
+		Number:                   hexutil.Uint64(header.Number.Uint64()),
+		Hash:                     header.Hash(),
+		Timestamp:                hexutil.Uint64(header.Time),
+		TargetGas:                newFeeParam(fc.TargetGas),
+		BaseFeeChangeDenominator: newFeeParam(fc.BaseFeeChangeDenominator),
+		MinBaseFee:               newFeeParam(fc.MinBaseFee),
+		MaxBaseFee:               newFeeParam(fc.MaxBaseFee),
+		BlockGasFee:              newFeeParam(fc.BlockGasFee),
+		TargetBlockRate:          newFeeParam(fc.TargetBlockRate),
+		MinBlockGasCost:          newFeeParam(fc.MinBlockGasCost),
+		MaxBlockGasCost:          newFeeParam(fc.MaxBlockGasCost),
+		BlockGasCostStep:         newFeeParam(fc.BlockGasCostStep),
+	}, nil
+}
+
+// newFeeParam returns a copy of [param], or nil if it does not apply.
+func newFeeParam(param dummy.FeeParam) *FeeParam {
+	if param.Value == nil {
+		return nil
+	}
+	return &FeeParam{
+		Value:      (*hexutil.Big)(new(big.Int).Set(param.Value)),
+		Activation: param.Activation,
+	}
+}
@@ -0,0 +1,96 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// TestGetFeeConfigAt builds blocks on both sides of the Apricot Phase 3, 4 and
+// 5 activations and checks that eth_getFeeConfigAt reports the parameters
+// selected by the engine at the timestamp of each block.
+func TestGetFeeConfigAt(t *testing.T) {
+	interval := int64(testutils.BlockInterval.Seconds())
+	config := *params.TestApricotPhase2Config
+	config.ApricotPhase3BlockTimestamp = big.NewInt(testutils.StartTime + 2*interval)
+	config.ApricotPhase4BlockTimestamp = big.NewInt(testutils.StartTime + 4*interval)
+	config.ApricotPhase5BlockTimestamp = big.NewInt(testutils.StartTime + 6*interval)
+	tvm := testutils.NewTestVM(t, "", testutils.GenesisJSON(&config))
+
+	expected := []struct {
+		targetGasActivation string
+		maxBaseFeeSet       bool
+		stepActivation      string
+	}{
+		{},
+		{targetGasActivation: dummy.FeeActivationApricotPhase3, maxBaseFeeSet: true},
+		{targetGasActivation: dummy.FeeActivationApricotPhase3, maxBaseFeeSet: true},
+		{targetGasActivation: dummy.FeeActivationApricotPhase3, maxBaseFeeSet: true, stepActivation: dummy.FeeActivationApricotPhase4},
+		{targetGasActivation: dummy.FeeActivationApricotPhase3, maxBaseFeeSet: true, stepActivation: dummy.FeeActivationApricotPhase4},
+		{targetGasActivation: dummy.FeeActivationApricotPhase5, stepActivation: dummy.FeeActivationApricotPhase5},
+	}
+	for i, test := range expected {
+		tvm.FundAddress(common.Address{byte(i + 1)}, 1_000_000)
+		blk := tvm.BuildAndAccept(t)
+
+		got := new(evm.FeeConfigAt)
+		if err := tvm.Client().Call(got, "eth_getFeeConfigAt", hexutil.Uint64(blk.Height())); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(got.Number) != blk.Height() || got.Hash != common.Hash(blk.ID()) {
+			t.Fatalf("Expected the fee config of block %d, found it of block %d (%s)", blk.Height(), got.Number, got.Hash)
+		}
+		fc := dummy.FeeConfigAt(&config, uint64(got.Timestamp))
+		for _, param := range []struct {
+			name     string
+			got      *evm.FeeParam
+			expected dummy.FeeParam
+		}{
+			{"targetGas", got.TargetGas, fc.TargetGas},
+			{"baseFeeChangeDenominator", got.BaseFeeChangeDenominator, fc.BaseFeeChangeDenominator},
+			{"minBaseFee", got.MinBaseFee, fc.MinBaseFee},
+			{"maxBaseFee", got.MaxBaseFee, fc.MaxBaseFee},
+			{"blockGasFee", got.BlockGasFee, fc.BlockGasFee},
+			{"targetBlockRate", got.TargetBlockRate, fc.TargetBlockRate},
+			{"minBlockGasCost", got.MinBlockGasCost, fc.MinBlockGasCost},
+			{"maxBlockGasCost", got.MaxBlockGasCost, fc.MaxBlockGasCost},
+			{"blockGasCostStep", got.BlockGasCostStep, fc.BlockGasCostStep},
+		} {
+			if param.expected.Value == nil {
+				if param.got != nil {
+					t.Fatalf("Expected %s of block %d to be omitted, found %+v", param.name, blk.Height(), param.got)
+				}
+				continue
+			}
+			if param.got == nil || param.got.Value.ToInt().Cmp(param.expected.Value) != 0 || param.got.Activation != param.expected.Activation {
+				t.Fatalf("Expected %s of block %d to be %v, found %+v", param.name, blk.Height(), param.expected, param.got)
+			}
+		}
+
+		switch {
+		case test.targetGasActivation == "":
+			if got.TargetGas != nil {
+				t.Fatalf("Expected no fee parameters before Apricot Phase 3, found %+v", got)
+			}
+			continue
+		case got.TargetGas.Activation != test.targetGasActivation:
+			t.Fatalf("Expected the target gas of block %d to be supplied by %s, found %s", blk.Height(), test.targetGasActivation, got.TargetGas.Activation)
+		case (got.MaxBaseFee != nil) != test.maxBaseFeeSet:
+			t.Fatalf("Expected the max base fee of block %d to be set: %t, found %+v", blk.Height(), test.maxBaseFeeSet, got.MaxBaseFee)
+		case test.stepActivation == "" && got.BlockGasCostStep != nil:
+			t.Fatalf("Expected no block gas cost step before Apricot Phase 4, found %+v", got.BlockGasCostStep)
+		case test.stepActivation != "" && (got.BlockGasCostStep == nil || got.BlockGasCostStep.Activation != test.stepActivation):
+			t.Fatalf("Expected the block gas cost step of block %d to be supplied by %s, found %+v", blk.Height(), test.stepActivation, got.BlockGasCostStep)
+		}
+	}
+}
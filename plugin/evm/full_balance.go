@@ -0,0 +1,134 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/constants"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+)
+
+// BalanceAmount is an amount of AVAX in both denominations.
+//
+// Wei is the denomination of EVM balances, with 10^18 wei per AVAX, and is
+// encoded as a decimal string. NAVAX is the denomination of atomic UTXOs,
+// with 10^9 nAVAX per AVAX, so that 1 nAVAX is 10^9 wei. NAVAX is Wei divided
+// by 10^9 rounded down, so that an EVM balance may hold less than 1 nAVAX of
+// dust not reflected in NAVAX.
+type BalanceAmount struct {
+	Wei   string      `json:"wei"`
+	NAVAX json.Uint64 `json:"nAVAX"`
+}
+
+// FullBalance is the AVAX held by an account, split in components that do not
+// overlap so that their sum is the total.
+type FullBalance struct {
+	// Height and hash of the accepted block the balance was read at
+	BlockHeight uint64
+	BlockHash   common.Hash
+
+	// EVM balance of the account, less the amounts spent by the account's
+	// export txs in the mempool
+	EVM *big.Int
+	// AVAX UTXOs of the account in shared memory that are not spent by an
+	// import tx in the mempool
+	UTXOs *big.Int
+	// AVAX locked in atomic txs in the mempool, spent from the account's EVM
+	// balance by export txs or from the account's UTXOs by import txs
+	Pending *big.Int
+}
+
+// Total returns the sum of the components of [b] in wei.
+func (b *FullBalance) Total() *big.Int {
+	total := new(big.Int).Add(b.EVM, b.UTXOs)
+	return total.Add(total, b.Pending)
+}
+
+// newBalanceAmount returns [wei] in both denominations.
+func newBalanceAmount(wei *big.Int) (BalanceAmount, error) {
+	nAVAX := new(big.Int).Div(wei, x2cRate)
+	if !nAVAX.IsUint64() {
+		return BalanceAmount{}, fmt.Errorf("balance of %s wei overflows nAVAX", wei)
+	}
+	return BalanceAmount{Wei: wei.String(), NAVAX: json.Uint64(nAVAX.Uint64())}, nil
+}
+
+// getFullBalance returns the full balance of the account with EVM address
+// [addr] and atomic UTXOs owned by [utxoAddr].
+//
+// The EVM balance is read at the last accepted block. The balance is
+// consistent as long as no block is accepted during the call, which holds
+// when the caller holds the context lock, as the API handlers do.
+func (vm *VM) getFullBalance(addr common.Address, utxoAddr ids.ShortID) (*FullBalance, error) {
+	block := vm.chain.LastAcceptedBlock()
+	state, err := vm.chain.BlockState(block)
+	if err != nil {
+		return nil, err
+	}
+	balance := &FullBalance{
+		BlockHeight: block.NumberU64(),
+		BlockHash:   block.Hash(),
+		EVM:         state.GetBalance(addr),
+		UTXOs:       new(big.Int),
+		Pending:     new(big.Int),
+	}
+
+	// Amounts locked in the mempool are taken out of the other components
+	var (
+		pendingExports uint64
+		pendingInputs  = ids.NewSet(0)
+	)
+	for _, tx := range vm.mempool.Txs() {
+		switch utx := tx.UnsignedAtomicTx.(type) {
+		case *UnsignedExportTx:
+			for _, in := range utx.Ins {
+				if in.Address == addr && in.AssetID == vm.ctx.AVAXAssetID {
+					pendingExports += in.Amount
+				}
+			}
+		case *UnsignedImportTx:
+			pendingInputs.Union(utx.InputUTXOs())
+		}
+	}
+	exported := new(big.Int).Mul(new(big.Int).SetUint64(pendingExports), x2cRate)
+	if exported.Cmp(balance.EVM) > 0 {
+		exported.Set(balance.EVM)
+	}
+	balance.EVM.Sub(balance.EVM, exported)
+	balance.Pending.Add(balance.Pending, exported)
+
+	addrs := ids.ShortSet{}
+	addrs.Add(utxoAddr)
+	for _, chainID := range []ids.ID{vm.ctx.XChainID, constants.PlatformChainID} {
+		startAddr, startUTXOID := ids.ShortEmpty, ids.Empty
+		for {
+			utxos, endAddr, endUTXOID, err := vm.GetAtomicUTXOs(chainID, addrs, startAddr, startUTXOID, maxUTXOsToFetch)
+			if err != nil {
+				return nil, fmt.Errorf("problem retrieving UTXOs from %s: %w", chainID, err)
+			}
+			for _, utxo := range utxos {
+				out, ok := utxo.Out.(avax.TransferableOut)
+				if !ok || utxo.AssetID() != vm.ctx.AVAXAssetID {
+					continue
+				}
+				amount := new(big.Int).Mul(new(big.Int).SetUint64(out.Amount()), x2cRate)
+				if pendingInputs.Contains(utxo.InputID()) {
+					balance.Pending.Add(balance.Pending, amount)
+				} else {
+					balance.UTXOs.Add(balance.UTXOs, amount)
+				}
+			}
+			if len(utxos) < maxUTXOsToFetch {
+				break
+			}
+			startAddr, startUTXOID = endAddr, endUTXOID
+		}
+	}
+	return balance, nil
+}
@@ -0,0 +1,128 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/avalanchego/vms/secp256k1fx"
+)
+
+func TestGetFullBalance(t *testing.T) {
+	importAmount := uint64(5000000000)
+	issuer, vm, _, sharedMemory, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	keys := []*crypto.PrivateKeySECP256K1R{testKeys[0]}
+
+	// Fund the EVM balance of the account
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	state, err := vm.chain.BlockState(vm.chain.LastAcceptedBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := state.GetBalance(testEthAddrs[0])
+	if accepted.Sign() == 0 {
+		t.Fatal("Expected the import to fund the EVM balance")
+	}
+
+	// Add UTXOs awaiting import, one of which is spent by a pending import
+	pendingUTXO, err := addUTXO(sharedMemory, vm.ctx, ids.GenerateTestID(), 0, vm.ctx.AVAXAssetID, 2000000000, testShortIDAddrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addUTXO(sharedMemory, vm.ctx, ids.GenerateTestID(), 0, vm.ctx.AVAXAssetID, 3000000000, testShortIDAddrs[0]); err != nil {
+		t.Fatal(err)
+	}
+	// UTXOs of other assets and other addresses are not part of the balance
+	if _, err := addUTXO(sharedMemory, vm.ctx, ids.GenerateTestID(), 0, ids.GenerateTestID(), 4000000000, testShortIDAddrs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addUTXO(sharedMemory, vm.ctx, ids.GenerateTestID(), 0, vm.ctx.AVAXAssetID, 4000000000, testShortIDAddrs[1]); err != nil {
+		t.Fatal(err)
+	}
+	kc := secp256k1fx.NewKeychain()
+	kc.Add(testKeys[0])
+	pendingImportTx, err := vm.newImportTxWithUTXOs(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, kc, []*avax.UTXO{pendingUTXO})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(pendingImportTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	exportTx, err := vm.newExportTx(vm.ctx.AVAXAssetID, 1000000000, vm.ctx.XChainID, testShortIDAddrs[1], initialBaseFee, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(exportTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	var exported uint64
+	for _, in := range exportTx.UnsignedAtomicTx.(*UnsignedExportTx).Ins {
+		exported += in.Amount
+	}
+
+	utxoAddr, err := vm.FormatLocalAddress(testShortIDAddrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &AvaxAPI{vm}
+	reply := &GetFullBalanceReply{}
+	if err := service.GetFullBalance(nil, &GetFullBalanceArgs{
+		Address:     testEthAddrs[0].Hex(),
+		UTXOAddress: utxoAddr,
+	}, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if lastAccepted := vm.chain.LastAcceptedBlock(); uint64(reply.BlockHeight) != lastAccepted.NumberU64() || reply.BlockHash != lastAccepted.Hash() {
+		t.Fatalf("Expected balance at block %s at height %d, found %s at height %d", lastAccepted.Hash(), lastAccepted.NumberU64(), reply.BlockHash, reply.BlockHeight)
+	}
+	wei := func(nAVAX uint64) *big.Int {
+		return new(big.Int).Mul(new(big.Int).SetUint64(nAVAX), x2cRate)
+	}
+	expectedEVM := new(big.Int).Sub(accepted, wei(exported))
+	expectedPending := new(big.Int).Add(wei(exported), wei(2000000000))
+	expectedTotal := new(big.Int).Add(accepted, wei(2000000000+3000000000))
+	for name, test := range map[string]struct {
+		amount   BalanceAmount
+		expected *big.Int
+	}{
+		"evm":     {reply.EVM, expectedEVM},
+		"utxos":   {reply.UTXOs, wei(3000000000)},
+		"pending": {reply.Pending, expectedPending},
+		"total":   {reply.Total, expectedTotal},
+	} {
+		if test.amount.Wei != test.expected.String() {
+			t.Fatalf("Expected %s balance of %s wei, found %s", name, test.expected, test.amount.Wei)
+		}
+		if expectedNAVAX := new(big.Int).Div(test.expected, x2cRate).Uint64(); uint64(test.amount.NAVAX) != expectedNAVAX {
+			t.Fatalf("Expected %s balance of %d nAVAX, found %d", name, expectedNAVAX, test.amount.NAVAX)
+		}
+	}
+
+	// Both addresses are required
+	if err := service.GetFullBalance(nil, &GetFullBalanceArgs{Address: testEthAddrs[0].Hex()}, &GetFullBalanceReply{}); err == nil {
+		t.Fatal("Expected a missing UTXO address to fail")
+	}
+	if err := service.GetFullBalance(nil, &GetFullBalanceArgs{Address: "0x01", UTXOAddress: utxoAddr}, &GetFullBalanceReply{}); err == nil {
+		t.Fatal("Expected an invalid EVM address to fail")
+	}
+}
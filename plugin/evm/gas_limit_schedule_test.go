@@ -0,0 +1,40 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// TestGasLimitScheduleBuilder builds blocks across the activation of a gas
+// limit schedule entry and checks they use the scheduled gas limit from the
+// transition block on.
+func TestGasLimitScheduleBuilder(t *testing.T) {
+	config := *params.TestApricotPhase2Config
+	activation := testutils.StartTime + 2*int64(testutils.BlockInterval.Seconds())
+	config.GasLimitSchedule = []params.GasLimitScheduleEntry{{Timestamp: big.NewInt(activation), GasLimit: 15_000_000}}
+	tvm := testutils.NewTestVM(t, "", testutils.GenesisJSON(&config))
+
+	for i, expected := range []uint64{params.ApricotPhase1GasLimit, 15_000_000, 15_000_000} {
+		tvm.FundAddress(common.Address{byte(i + 1)}, 1_000_000)
+		blk := tvm.BuildAndAccept(t)
+		var header struct {
+			GasLimit  hexutil.Uint64 `json:"gasLimit"`
+			Timestamp hexutil.Uint64 `json:"timestamp"`
+		}
+		if err := tvm.Client().Call(&header, "eth_getBlockByNumber", hexutil.Uint64(blk.Height()), false); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(header.GasLimit) != expected {
+			t.Fatalf("Expected block %d at %d to have a gas limit of %d, found %d", blk.Height(), header.Timestamp, expected, header.GasLimit)
+		}
+	}
+}
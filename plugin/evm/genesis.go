@@ -0,0 +1,170 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/params"
+)
+
+var (
+	errGenesisMissingConfig  = errors.New("genesis field \"config\": missing")
+	errGenesisMissingChainID = errors.New("genesis field \"config.chainId\": missing")
+
+	genesisFields        = jsonFields(reflect.TypeOf(core.Genesis{}))
+	genesisAccountFields = jsonFields(reflect.TypeOf(core.GenesisAccount{}))
+)
+
+// jsonFields returns the set of the JSON names of the fields of [t].
+func jsonFields(t reflect.Type) map[string]struct{} {
+	fields := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = struct{}{}
+		}
+	}
+	return fields
+}
+
+// canonicalNetworks are the networks whose chains run with a canonical config
+// in place of the config of their genesis.
+var canonicalNetworks = []struct {
+	name    string
+	chainID *big.Int
+	config  *params.ChainConfig
+}{
+	{"mainnet", params.AvalancheMainnetChainID, params.AvalancheMainnetChainConfig},
+	{"fuji", params.AvalancheFujiChainID, params.AvalancheFujiChainConfig},
+	{"local", params.AvalancheLocalChainID, params.AvalancheLocalChainConfig},
+}
+
+// canonicalChainConfig returns the name of the network of [chainID] and the
+// config its chain runs with in place of the config of its genesis, or
+// "custom" and nil if it runs with the config of its genesis.
+func canonicalChainConfig(chainID *big.Int) (string, *params.ChainConfig) {
+	for _, network := range canonicalNetworks {
+		if chainID.Cmp(network.chainID) == 0 {
+			return network.name, network.config
+		}
+	}
+	return "custom", nil
+}
+
+// parseGenesis returns the genesis of [genesisBytes] as the VM runs it, with
+// the canonical config of its chain ID if any.
+func parseGenesis(genesisBytes []byte) (*core.Genesis, error) {
+	g := new(core.Genesis)
+	if err := json.Unmarshal(genesisBytes, g); err != nil {
+		return nil, err
+	}
+	switch {
+	case g.Config == nil:
+		return nil, errGenesisMissingConfig
+	case g.Config.ChainID == nil:
+		return nil, errGenesisMissingChainID
+	}
+	if _, config := canonicalChainConfig(g.Config.ChainID); config != nil {
+		g.Config = config
+	}
+	return g, nil
+}
+
+// parseGenesisStrict returns the genesis of [genesisBytes] as [parseGenesis],
+// rejecting the genesis that the VM would not run or would run differently
+// than specified, with an error naming the offending field.
+func parseGenesisStrict(genesisBytes []byte) (*core.Genesis, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(genesisBytes, &fields); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
+	for name := range fields {
+		if _, ok := genesisFields[name]; !ok {
+			return nil, fmt.Errorf("genesis field %q: unknown", name)
+		}
+	}
+	if err := verifyGenesisAlloc(fields["alloc"]); err != nil {
+		return nil, err
+	}
+
+	g, err := parseGenesis(genesisBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Config.CheckConfigForkOrder(); err != nil {
+		return nil, fmt.Errorf("genesis field \"config\": %w", err)
+	}
+	if g.Number != 0 {
+		return nil, fmt.Errorf("genesis field \"number\": %d, expected 0", g.Number)
+	}
+	// The genesis block has a base fee if Apricot Phase 3 is active at 0, as
+	// set by [core.Genesis.ToBlock]
+	if g.BaseFee != nil {
+		if !g.Config.IsApricotPhase3(common.Big0) {
+			return nil, errors.New("genesis field \"baseFeePerGas\": set but apricotPhase3BlockTimestamp is not active at genesis")
+		}
+		feeConfig := dummy.FeeConfigAt(g.Config, 0)
+		if min := feeConfig.MinBaseFee.Value; min != nil && g.BaseFee.Cmp(min) < 0 {
+			return nil, fmt.Errorf("genesis field \"baseFeePerGas\": %d below the minimum base fee %d", g.BaseFee, min)
+		}
+		if max := feeConfig.MaxBaseFee.Value; max != nil && g.BaseFee.Cmp(max) > 0 {
+			return nil, fmt.Errorf("genesis field \"baseFeePerGas\": %d above the maximum base fee %d", g.BaseFee, max)
+		}
+	}
+	return g, nil
+}
+
+// verifyGenesisAlloc verifies the accounts of the JSON [alloc] of a genesis.
+func verifyGenesisAlloc(alloc json.RawMessage) error {
+	if len(alloc) == 0 {
+		return errors.New("genesis field \"alloc\": missing")
+	}
+	var accounts map[string]json.RawMessage
+	if err := json.Unmarshal(alloc, &accounts); err != nil {
+		return fmt.Errorf("genesis field \"alloc\": %w", err)
+	}
+	addrs := make(map[common.Address]string, len(accounts))
+	for key, raw := range accounts {
+		var addr common.UnprefixedAddress
+		if err := addr.UnmarshalText([]byte(key)); err != nil {
+			return fmt.Errorf("genesis field \"alloc.%s\": invalid address: %w", key, err)
+		}
+		if other, ok := addrs[common.Address(addr)]; ok {
+			return fmt.Errorf("genesis field \"alloc.%s\": duplicate of %q", key, other)
+		}
+		addrs[common.Address(addr)] = key
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("genesis field \"alloc.%s\": %w", key, err)
+		}
+		for name := range fields {
+			if _, ok := genesisAccountFields[name]; !ok {
+				return fmt.Errorf("genesis field \"alloc.%s.%s\": unknown", key, name)
+			}
+		}
+		var account core.GenesisAccount
+		if err := json.Unmarshal(raw, &account); err != nil {
+			return fmt.Errorf("genesis field \"alloc.%s\": %w", key, err)
+		}
+		if account.Balance.Sign() < 0 {
+			return fmt.Errorf("genesis field \"alloc.%s.balance\": negative", key)
+		}
+		for coinID, balance := range account.MCBalance {
+			if balance == nil || balance.Sign() < 0 {
+				return fmt.Errorf("genesis field \"alloc.%s.mcbalance.%s\": negative or missing", key, coinID.Hex())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+)
+
+// atomicGossipDedupSize is the maximum number of txIDs remembered by the
+// deduplication of the atomic tx gossip.
+const atomicGossipDedupSize = 16384
+
+// atomicGossipDedup remembers the atomic txs discarded or accepted which are no
+// longer pending in the mempool, so that the repeated deliveries of a tx by
+// gossip are dropped without verifying it again. A discarded tx is remembered
+// for [discardedRetention], after which a delivery of it is verified again as
+// it may have become valid, and an accepted tx for [acceptedRetention].
+type atomicGossipDedup struct {
+	clock                                 *mockable.Clock
+	discardedRetention, acceptedRetention time.Duration
+
+	// [expiries] maps the remembered txIDs to the time they are forgotten
+	expiries *lru.Cache
+	// [duplicates] counts the deliveries dropped as duplicates, including the
+	// txs pending in the mempool
+	duplicates metrics.Meter
+}
+
+func newAtomicGossipDedup(clock *mockable.Clock, discardedRetention, acceptedRetention time.Duration) *atomicGossipDedup {
+	expiries, _ := lru.New(atomicGossipDedupSize)
+	return &atomicGossipDedup{
+		clock:              clock,
+		discardedRetention: discardedRetention,
+		acceptedRetention:  acceptedRetention,
+		expiries:           expiries,
+		duplicates:         metrics.NewRegisteredMeter("gossip/atomic/duplicates", nil),
+	}
+}
+
+// duplicate returns whether [txID] was recently discarded or accepted, in
+// which case its delivery is counted as a duplicate. [discarded] is whether
+// [txID] is recorded as discarded by the mempool, whose retention starts now
+// if it was not discarded through gossip.
+func (d *atomicGossipDedup) duplicate(txID ids.ID, discarded bool) bool {
+	expiry, ok := d.expiries.Get(txID)
+	switch {
+	case ok && d.clock.Time().Before(expiry.(time.Time)):
+	case ok:
+		// The retention expired, the tx is verified again
+		d.expiries.Remove(txID)
+		return false
+	case discarded:
+		d.discarded(txID)
+	default:
+		return false
+	}
+	d.duplicates.Mark(1)
+	return true
+}
+
+// discarded remembers that [txID] was discarded, unless it was accepted.
+func (d *atomicGossipDedup) discarded(txID ids.ID) {
+	expiry := d.clock.Time().Add(d.discardedRetention)
+	if previous, ok := d.expiries.Peek(txID); ok && previous.(time.Time).After(expiry) {
+		return
+	}
+	d.expiries.Add(txID, expiry)
+}
+
+// accepted remembers that [txID] was accepted.
+func (d *atomicGossipDedup) accepted(txID ids.ID) {
+	d.expiries.Add(txID, d.clock.Time().Add(d.acceptedRetention))
+}
@@ -0,0 +1,131 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/avalanchego/vms/secp256k1fx"
+
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+func TestAtomicGossipDedupRetention(t *testing.T) {
+	clock := &mockable.Clock{}
+	clock.Set(time.Unix(1_000_000, 0))
+	dedup := newAtomicGossipDedup(clock, time.Minute, 10*time.Minute)
+
+	discarded, accepted := ids.ID{1}, ids.ID{2}
+	if dedup.duplicate(discarded, false) {
+		t.Fatal("Expected an unknown tx not to be a duplicate")
+	}
+	dedup.discarded(discarded)
+	dedup.accepted(accepted)
+	// A discard does not shorten the retention of an accepted tx
+	dedup.discarded(accepted)
+
+	clock.Set(clock.Time().Add(time.Minute - time.Second))
+	if !dedup.duplicate(discarded, false) || !dedup.duplicate(accepted, false) {
+		t.Fatal("Expected the discarded and accepted txs to be duplicates within their retention")
+	}
+	clock.Set(clock.Time().Add(time.Second))
+	if dedup.duplicate(discarded, false) {
+		t.Fatal("Expected the discarded tx to be forgotten after its retention")
+	}
+	if !dedup.duplicate(accepted, false) {
+		t.Fatal("Expected the accepted tx to be a duplicate within its retention")
+	}
+	clock.Set(clock.Time().Add(9 * time.Minute))
+	if dedup.duplicate(accepted, false) {
+		t.Fatal("Expected the accepted tx to be forgotten after its retention")
+	}
+
+	// The retention of a tx discarded by the mempool starts with its first
+	// delivery
+	if !dedup.duplicate(discarded, true) {
+		t.Fatal("Expected the tx discarded by the mempool to be a duplicate")
+	}
+	clock.Set(clock.Time().Add(time.Minute))
+	if dedup.duplicate(discarded, true) {
+		t.Fatal("Expected the tx discarded by the mempool to be verified again after its retention")
+	}
+}
+
+// TestAtomicGossipDedupDelivery delivers the same invalid tx 100 times and
+// checks that it is only verified once within the discard retention, after
+// which it is verified again.
+func TestAtomicGossipDedupDelivery(t *testing.T) {
+	_, vm, _, sharedMemory, _ := GenesisVM(t, true, genesisJSONApricotPhase5, `{"atomic-gossip-discarded-retention": "30s"}`, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	vm.clock.Set(time.Now())
+
+	// The UTXO of [tx] is not in shared memory yet, so that it fails
+	// verification
+	const importAmount = 50000000
+	utxoID := avax.UTXOID{TxID: ids.ID{9}}
+	tx := &Tx{UnsignedAtomicTx: &UnsignedImportTx{
+		NetworkID:    vm.ctx.NetworkID,
+		BlockchainID: vm.ctx.ChainID,
+		SourceChain:  vm.ctx.XChainID,
+		ImportedInputs: []*avax.TransferableInput{{
+			UTXOID: utxoID,
+			Asset:  avax.Asset{ID: vm.ctx.AVAXAssetID},
+			In: &secp256k1fx.TransferInput{
+				Amt:   importAmount,
+				Input: secp256k1fx.Input{SigIndices: []uint32{0}},
+			},
+		}},
+		Outs: []EVMOutput{{Address: testEthAddrs[0], Amount: importAmount / 2, AssetID: vm.ctx.AVAXAssetID}},
+	}}
+	if err := tx.Sign(vm.codec, [][]*crypto.PrivateKeySECP256K1R{{testKeys[0]}}); err != nil {
+		t.Fatal(err)
+	}
+	msgBytes, err := message.BuildMessage(vm.networkCodec, &message.AtomicTx{Tx: tx.Bytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeID := ids.GenerateTestShortID()
+	if err := vm.AppGossip(nodeID, msgBytes); err != nil {
+		t.Fatal(err)
+	}
+	if _, dropped, _ := vm.mempool.GetTx(tx.ID()); !dropped {
+		t.Fatal("Expected the tx to be discarded")
+	}
+
+	// Once its UTXO is available, [tx] is only added to the mempool if it
+	// is verified again
+	if _, err := addUTXO(sharedMemory, vm.ctx, utxoID.TxID, utxoID.OutputIndex, vm.ctx.AVAXAssetID, importAmount, testShortIDAddrs[0]); err != nil {
+		t.Fatal(err)
+	}
+	duplicates := vm.atomicGossipDedup.duplicates.Count()
+	for i := 0; i < 99; i++ {
+		if err := vm.AppGossip(nodeID, msgBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if vm.mempool.has(tx.ID()) {
+		t.Fatal("Expected the repeated deliveries of the discarded tx not to be verified")
+	}
+	if suppressed := vm.atomicGossipDedup.duplicates.Count() - duplicates; suppressed != 99 {
+		t.Fatalf("Expected 99 suppressed duplicates, found %d", suppressed)
+	}
+
+	// After the discard retention, the tx is verified again
+	vm.clock.Set(vm.clock.Time().Add(30 * time.Second))
+	if err := vm.AppGossip(nodeID, msgBytes); err != nil {
+		t.Fatal(err)
+	}
+	if !vm.mempool.has(tx.ID()) {
+		t.Fatal("Expected the tx to be verified again after the discard retention")
+	}
+}
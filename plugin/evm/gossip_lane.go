@@ -0,0 +1,135 @@
+// (c) 2019-2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"golang.org/x/time/rate"
+
+	"github.com/zsmartex/avalanchego/snow"
+
+	"github.com/zsmartex/coreth/peer"
+)
+
+const (
+	// [priorityGossipQueueSize] is the number of messages that can be waiting
+	// on the priority lane. Only first-time gossip of locally issued
+	// transactions uses this lane, so it should rarely back up.
+	priorityGossipQueueSize = 64
+
+	// [backgroundGossipQueueSize] is the number of messages that can be
+	// waiting on the background lane before new messages are dropped. Dropped
+	// messages are recovered by regossip.
+	backgroundGossipQueueSize = 256
+)
+
+var errGossipLaneFull = errors.New("gossip lane is full")
+
+// gossipMessage is a message queued on a [gossipLane]. [onSent], if set, is
+// called with the number of peers the message was sent to.
+type gossipMessage struct {
+	bytes  []byte
+	onSent func(recipients uint32)
+}
+
+// gossipLane sends queued gossip messages on its own goroutine, subject to a
+// rate limit that is independent of any other lane.
+type gossipLane struct {
+	name    string
+	client  peer.Client
+	limiter *rate.Limiter
+	queue   chan gossipMessage
+
+	sentMeter      metrics.Meter
+	sentBytesMeter metrics.Meter
+	droppedMeter   metrics.Meter
+}
+
+// newGossipLane returns a gossipLane that sends at most [rateLimit] messages
+// per second. A non-positive [rateLimit] disables rate limiting.
+func newGossipLane(name string, client peer.Client, rateLimit float64, queueSize int) *gossipLane {
+	limit, burst := rate.Inf, 1
+	if rateLimit > 0 {
+		limit, burst = rate.Limit(rateLimit), int(math.Max(1, rateLimit))
+	}
+	return &gossipLane{
+		name:           name,
+		client:         client,
+		limiter:        rate.NewLimiter(limit, burst),
+		queue:          make(chan gossipMessage, queueSize),
+		sentMeter:      metrics.NewRegisteredMeter("gossip/"+name+"/sent", nil),
+		sentBytesMeter: metrics.NewRegisteredMeter("gossip/"+name+"/sent/bytes", nil),
+		droppedMeter:   metrics.NewRegisteredMeter("gossip/"+name+"/dropped", nil),
+	}
+}
+
+// enqueue schedules [msg] to be gossiped without blocking, [onSent] being
+// called once it is sent if not nil. If the lane is saturated, [msg] is
+// dropped and errGossipLaneFull is returned.
+func (l *gossipLane) enqueue(msg []byte, onSent func(recipients uint32)) error {
+	select {
+	case l.queue <- gossipMessage{bytes: msg, onSent: onSent}:
+		return nil
+	default:
+		l.droppedMeter.Mark(1)
+		return errGossipLaneFull
+	}
+}
+
+// dispatch sends queued messages until [shutdownChan] is closed.
+func (l *gossipLane) dispatch(ctx *snow.Context, shutdownChan <-chan struct{}, shutdownWg *sync.WaitGroup) {
+	shutdownWg.Add(1)
+	go ctx.Log.RecoverAndPanic(func() {
+		defer shutdownWg.Done()
+
+		for {
+			select {
+			case msg := <-l.queue:
+				if !l.wait(shutdownChan) {
+					return
+				}
+				recipients, err := l.client.Gossip(msg.bytes)
+				if err != nil {
+					log.Warn(
+						"failed to gossip message",
+						"lane", l.name,
+						"err", err,
+					)
+					continue
+				}
+				l.sentMeter.Mark(1)
+				l.sentBytesMeter.Mark(int64(len(msg.bytes)))
+				if msg.onSent != nil {
+					msg.onSent(recipients)
+				}
+			case <-shutdownChan:
+				return
+			}
+		}
+	})
+}
+
+// wait blocks until the rate limit allows another message to be sent. Returns
+// false if [shutdownChan] was closed while waiting.
+func (l *gossipLane) wait(shutdownChan <-chan struct{}) bool {
+	delay := l.limiter.Reserve().Delay()
+	if delay == 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-shutdownChan:
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+// (c) 2019-2022, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+func TestAdminQuarantinedPeers(t *testing.T) {
+	assert := assert.New(t)
+
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase4, `{"gossip-quarantine-garbage-limit":2}`, "")
+	defer func() {
+		assert.NoError(vm.Shutdown())
+	}()
+	admin := NewAdminService(vm, "")
+
+	// Txs which cannot be parsed count as garbage
+	nodeID := ids.GenerateTestShortID()
+	msgBytes, err := message.BuildMessage(vm.networkCodec, &message.EthTxs{Txs: []byte{0xff}})
+	assert.NoError(err)
+	assert.NoError(vm.AppGossip(nodeID, msgBytes))
+	assert.NoError(vm.AppGossip(nodeID, []byte{0x00, 0x00, 0xff, 0xff, 0xff, 0xff}))
+
+	reply := QuarantinedPeersReply{}
+	assert.NoError(admin.QuarantinedPeers(&http.Request{}, &struct{}{}, &reply))
+	assert.Len(reply.Peers, 1)
+	assert.Equal(nodeID, reply.Peers[0].NodeID)
+	assert.Equal("type-unknown", reply.Peers[0].Reason)
+	assert.Equal(map[string]json.Uint64{"parse-error": 1, "type-unknown": 1}, reply.Peers[0].Failures)
+
+	success := api.SuccessResponse{}
+	assert.NoError(admin.ReleaseQuarantinedPeer(&http.Request{}, &ReleaseQuarantinedPeerArgs{NodeID: nodeID}, &success))
+	assert.True(success.Success)
+	assert.Error(admin.ReleaseQuarantinedPeer(&http.Request{}, &ReleaseQuarantinedPeerArgs{NodeID: nodeID}, &success))
+
+	reply = QuarantinedPeersReply{}
+	assert.NoError(admin.QuarantinedPeers(&http.Request{}, &struct{}{}, &reply))
+	assert.Empty(reply.Peers)
+}
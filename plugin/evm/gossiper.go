@@ -5,6 +5,8 @@ package evm
 
 import (
 	"container/heap"
+	"errors"
+	"fmt"
 	"math/big"
 	"sync"
 	"time"
@@ -36,6 +38,14 @@ const (
 	// [ethTxsGossipInterval] is how often we attempt to gossip newly seen
 	// transactions to other nodes.
 	ethTxsGossipInterval = 500 * time.Millisecond
+
+	// [txNetworkStatsCapacity] is the number of transactions tracked until
+	// their inclusion when network stats are enabled.
+	txNetworkStatsCapacity = 4096
+
+	// [txPropagationCapacity] is the number of locally submitted transactions
+	// whose propagation is tracked when propagation receipts are enabled.
+	txPropagationCapacity = 4096
 )
 
 // Gossiper handles outgoing gossip of transactions
@@ -57,6 +67,12 @@ type pushGossiper struct {
 	txPool        *core.TxPool
 	atomicMempool *Mempool
 
+	// First-time gossip of locally issued transactions is sent on
+	// [priorityLane] so that it is never delayed behind regossip and gossip
+	// of transactions received from peers, which is sent on [backgroundLane].
+	priorityLane   *gossipLane
+	backgroundLane *gossipLane
+
 	// We attempt to batch transactions we need to gossip to avoid runaway
 	// amplification of mempol chatter.
 	ethTxsToGossipChan chan []*types.Transaction
@@ -84,6 +100,8 @@ func (vm *VM) newPushGossiper() Gossiper {
 		blockchain:           vm.chain.BlockChain(),
 		txPool:               vm.chain.GetTxPool(),
 		atomicMempool:        vm.mempool,
+		priorityLane:         newGossipLane("priority", vm.client, vm.config.TxGossipPriorityRateLimit, priorityGossipQueueSize),
+		backgroundLane:       newGossipLane("background", vm.client, vm.config.TxGossipBackgroundRateLimit, backgroundGossipQueueSize),
 		ethTxsToGossipChan:   make(chan []*types.Transaction),
 		ethTxsToGossip:       make(map[common.Hash]*types.Transaction),
 		shutdownChan:         vm.shutdownChan,
@@ -92,6 +110,8 @@ func (vm *VM) newPushGossiper() Gossiper {
 		recentEthTxs:         &cache.LRU{Size: recentCacheSize},
 		codec:                vm.networkCodec,
 	}
+	net.priorityLane.dispatch(vm.ctx, vm.shutdownChan, &vm.shutdownWg)
+	net.backgroundLane.dispatch(vm.ctx, vm.shutdownChan, &vm.shutdownWg)
 	net.awaitEthTxGossip()
 	return net
 }
@@ -227,6 +247,7 @@ func (n *pushGossiper) awaitEthTxGossip() {
 				for _, tx := range n.queueRegossipTxs() {
 					n.ethTxsToGossip[tx.Hash()] = tx
 				}
+				n.txPool.NetworkStats().SetRegossipQueue(len(n.ethTxsToGossip))
 				if attempted, err := n.gossipEthTxs(true); err != nil {
 					log.Warn(
 						"failed to send eth transactions",
@@ -238,6 +259,7 @@ func (n *pushGossiper) awaitEthTxGossip() {
 				for _, tx := range txs {
 					n.ethTxsToGossip[tx.Hash()] = tx
 				}
+				n.txPool.NetworkStats().SetRegossipQueue(len(n.ethTxsToGossip))
 				if attempted, err := n.gossipEthTxs(false); err != nil {
 					log.Warn(
 						"failed to send eth transactions",
@@ -289,14 +311,21 @@ func (n *pushGossiper) gossipAtomicTx(tx *Tx) error {
 		return err
 	}
 
+	// Locally issued transactions skip the queue of regossip and gossip
+	// received from peers.
+	lane := n.backgroundLane
+	if n.atomicMempool.IsLocalTx(txID) {
+		lane = n.priorityLane
+	}
 	log.Trace(
 		"gossiping atomic tx",
 		"txID", txID,
+		"lane", lane.name,
 	)
-	return n.client.Gossip(msgBytes)
+	return lane.enqueue(msgBytes, nil)
 }
 
-func (n *pushGossiper) sendEthTxs(txs []*types.Transaction) error {
+func (n *pushGossiper) sendEthTxs(lane *gossipLane, txs []*types.Transaction) error {
 	if len(txs) == 0 {
 		return nil
 	}
@@ -317,8 +346,20 @@ func (n *pushGossiper) sendEthTxs(txs []*types.Transaction) error {
 		"gossiping eth txs",
 		"len(txs)", len(txs),
 		"size(txs)", len(msg.Txs),
+		"lane", lane.name,
 	)
-	return n.client.Gossip(msgBytes)
+	propagation := n.txPool.Propagation()
+	if propagation == nil {
+		return lane.enqueue(msgBytes, nil)
+	}
+	// [txs] is reused by the caller for the next message
+	sentTxs := make([]*types.Transaction, len(txs))
+	copy(sentTxs, txs)
+	return lane.enqueue(msgBytes, func(recipients uint32) {
+		if recipients > 0 {
+			propagation.MarkGossiped(recipients, sentTxs...)
+		}
+	})
 }
 
 func (n *pushGossiper) gossipEthTxs(force bool) (int, error) {
@@ -331,7 +372,22 @@ func (n *pushGossiper) gossipEthTxs(force bool) (int, error) {
 		txs = append(txs, tx)
 		delete(n.ethTxsToGossip, tx.Hash())
 	}
+	n.txPool.NetworkStats().SetRegossipQueue(0)
+
+	selectedTxs := n.selectEthTxs(txs, force)
+	return len(selectedTxs), n.sendEthTxsChunked(n.backgroundLane, selectedTxs)
+}
+
+// gossipLocalEthTxs immediately gossips locally issued [txs] on the priority
+// lane, bypassing the batching of [gossipEthTxs].
+func (n *pushGossiper) gossipLocalEthTxs(txs []*types.Transaction) (int, error) {
+	selectedTxs := n.selectEthTxs(txs, false)
+	return len(selectedTxs), n.sendEthTxsChunked(n.priorityLane, selectedTxs)
+}
 
+// selectEthTxs returns the transactions in [txs] that should be gossiped. If
+// [force] is false, transactions that were gossiped recently are skipped.
+func (n *pushGossiper) selectEthTxs(txs []*types.Transaction, force bool) []*types.Transaction {
 	selectedTxs := make([]*types.Transaction, 0)
 	for _, tx := range txs {
 		txHash := tx.Hash()
@@ -343,6 +399,11 @@ func (n *pushGossiper) gossipEthTxs(force bool) (int, error) {
 		if n.config.RemoteTxGossipOnlyEnabled && n.txPool.HasLocal(txHash) {
 			continue
 		}
+		// The conditions of a tx are only known to this node, which would not
+		// be checked by the nodes it is gossiped to
+		if n.txPool.Conditional(txHash) != nil {
+			continue
+		}
 
 		// We check [force] outside of the if statement to avoid an unnecessary
 		// cache lookup.
@@ -355,19 +416,19 @@ func (n *pushGossiper) gossipEthTxs(force bool) (int, error) {
 
 		selectedTxs = append(selectedTxs, tx)
 	}
+	return selectedTxs
+}
 
-	if len(selectedTxs) == 0 {
-		return 0, nil
-	}
-
-	// Attempt to gossip [selectedTxs]
+// sendEthTxsChunked gossips [txs] on [lane], split into messages of at most
+// [message.EthMsgSoftCapSize].
+func (n *pushGossiper) sendEthTxsChunked(lane *gossipLane, txs []*types.Transaction) error {
 	msgTxs := make([]*types.Transaction, 0)
 	msgTxsSize := common.StorageSize(0)
-	for _, tx := range selectedTxs {
+	for _, tx := range txs {
 		size := tx.Size()
 		if msgTxsSize+size > message.EthMsgSoftCapSize {
-			if err := n.sendEthTxs(msgTxs); err != nil {
-				return len(selectedTxs), err
+			if err := n.sendEthTxs(lane, msgTxs); err != nil {
+				return err
 			}
 			msgTxs = msgTxs[:0]
 			msgTxsSize = 0
@@ -377,15 +438,13 @@ func (n *pushGossiper) gossipEthTxs(force bool) (int, error) {
 	}
 
 	// Send any remaining [msgTxs]
-	return len(selectedTxs), n.sendEthTxs(msgTxs)
+	return n.sendEthTxs(lane, msgTxs)
 }
 
-// GossipEthTxs enqueues the provided [txs] for gossiping. At some point, the
-// [pushGossiper] will attempt to gossip the provided txs to other nodes
+// GossipEthTxs enqueues the provided [txs] for gossiping. Locally issued txs
+// are gossiped right away on the priority lane. At some point, the
+// [pushGossiper] will attempt to gossip the remaining txs to other nodes
 // (usually right away if not under load).
-//
-// NOTE: We never return a non-nil error from this function but retain the
-// option to do so in case it becomes useful.
 func (n *pushGossiper) GossipEthTxs(txs []*types.Transaction) error {
 	if time.Now().Before(n.gossipActivationTime) {
 		log.Trace(
@@ -395,8 +454,26 @@ func (n *pushGossiper) GossipEthTxs(txs []*types.Transaction) error {
 		return nil
 	}
 
+	localTxs := make([]*types.Transaction, 0)
+	remoteTxs := make([]*types.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if n.txPool.HasLocal(tx.Hash()) {
+			localTxs = append(localTxs, tx)
+		} else {
+			remoteTxs = append(remoteTxs, tx)
+		}
+	}
+	if len(localTxs) > 0 {
+		if attempted, err := n.gossipLocalEthTxs(localTxs); err != nil {
+			return fmt.Errorf("failed to gossip %d local eth transactions: %w", attempted, err)
+		}
+	}
+	if len(remoteTxs) == 0 {
+		return nil
+	}
+
 	select {
-	case n.ethTxsToGossipChan <- txs:
+	case n.ethTxsToGossipChan <- remoteTxs:
 	case <-n.shutdownChan:
 	}
 	return nil
@@ -439,7 +516,7 @@ func (h *GossipHandler) HandleAtomicTx(nodeID ids.ShortID, msg *message.AtomicTx
 			"AppGossip provided invalid tx",
 			"err", err,
 		)
-		return nil
+		return fmt.Errorf("%w: %s", message.ErrMalformedPayload, err)
 	}
 	unsignedBytes, err := Codec.Marshal(codecVersion, &tx.UnsignedAtomicTx)
 	if err != nil {
@@ -452,7 +529,12 @@ func (h *GossipHandler) HandleAtomicTx(nodeID ids.ShortID, msg *message.AtomicTx
 	tx.Initialize(unsignedBytes, msg.Tx)
 
 	txID := tx.ID()
-	if _, dropped, found := h.atomicMempool.GetTx(txID); found || dropped {
+	_, dropped, found := h.atomicMempool.GetTx(txID)
+	if found && !dropped {
+		h.vm.atomicGossipDedup.duplicates.Mark(1)
+		return nil
+	}
+	if h.vm.atomicGossipDedup.duplicate(txID, dropped) {
 		return nil
 	}
 
@@ -463,6 +545,9 @@ func (h *GossipHandler) HandleAtomicTx(nodeID ids.ShortID, msg *message.AtomicTx
 			"err", err,
 		)
 	}
+	if _, dropped, _ := h.atomicMempool.GetTx(txID); dropped {
+		h.vm.atomicGossipDedup.discarded(txID)
+	}
 
 	return nil
 }
@@ -483,25 +568,60 @@ func (h *GossipHandler) HandleEthTxs(nodeID ids.ShortID, msg *message.EthTxs) er
 	}
 
 	// The maximum size of this encoded object is enforced by the codec.
-	txs := make([]*types.Transaction, 0)
-	if err := rlp.DecodeBytes(msg.Txs, &txs); err != nil {
+	encodedTxs := make([]rlp.RawValue, 0)
+	if err := rlp.DecodeBytes(msg.Txs, &encodedTxs); err != nil {
 		log.Trace(
 			"AppGossip provided invalid txs",
 			"peerID", nodeID,
 			"err", err,
 		)
-		return nil
+		return fmt.Errorf("%w: %s", message.ErrMalformedPayload, err)
+	}
+	// Txs are decoded one by one so that well-formed txs of a type that is not
+	// supported yet, forwarded by peers running newer tooling, are skipped
+	// without dropping the rest of the message.
+	txs := make([]*types.Transaction, 0, len(encodedTxs))
+	for _, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		err := rlp.DecodeBytes(encodedTx, tx)
+		switch {
+		case errors.Is(err, types.ErrTxTypeNotSupported):
+			log.Trace(
+				"AppGossip provided tx of unsupported type",
+				"peerID", nodeID,
+				"err", err,
+			)
+		case err != nil:
+			log.Trace(
+				"AppGossip provided invalid txs",
+				"peerID", nodeID,
+				"err", err,
+			)
+			return fmt.Errorf("%w: %s", message.ErrMalformedPayload, err)
+		default:
+			txs = append(txs, tx)
+		}
 	}
 	errs := h.txPool.AddRemotes(txs)
+	added := make([]*types.Transaction, 0, len(txs))
+	propagation := h.txPool.Propagation()
 	for i, err := range errs {
+		if errors.Is(err, core.ErrAlreadyKnown) {
+			// A tx submitted to this node and gossiped back by a peer
+			// propagated
+			propagation.MarkSeenBack(nodeID.String(), txs[i])
+		}
 		if err != nil {
 			log.Trace(
 				"AppGossip failed to add to mempool",
 				"err", err,
 				"tx", txs[i].Hash(),
 			)
+			continue
 		}
+		added = append(added, txs[i])
 	}
+	h.txPool.NetworkStats().MarkSeen(core.TxOriginGossip, added...)
 	return nil
 }
 
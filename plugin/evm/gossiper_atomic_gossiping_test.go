@@ -30,8 +30,9 @@ func TestMempoolAtmTxsIssueTxAndGossiping(t *testing.T) {
 
 	var gossiped int
 	var gossipedLock sync.Mutex // needed to prevent race
-	sender.CantSendAppGossip = false
-	sender.SendAppGossipF = func(gossipedBytes []byte) error {
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, gossipedBytes []byte) error {
 		gossipedLock.Lock()
 		defer gossipedLock.Unlock()
 
@@ -55,6 +56,7 @@ func TestMempoolAtmTxsIssueTxAndGossiping(t *testing.T) {
 
 	// Optimistically gossip raw tx
 	assert.NoError(vm.issueTx(tx, true /*=local*/))
+	assert.True(vm.mempool.IsLocalTx(tx.ID()), "issued tx should be tagged as local")
 	time.Sleep(waitBlockTime * 3)
 	gossipedLock.Lock()
 	assert.Equal(1, gossiped)
@@ -90,8 +92,9 @@ func TestMempoolAtmTxsAppGossipHandling(t *testing.T) {
 		txGossipedLock sync.Mutex
 		txRequested    bool
 	)
-	sender.CantSendAppGossip = false
-	sender.SendAppGossipF = func(_ []byte) error {
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, _ []byte) error {
 		txGossipedLock.Lock()
 		defer txGossipedLock.Unlock()
 
@@ -123,6 +126,7 @@ func TestMempoolAtmTxsAppGossipHandling(t *testing.T) {
 	assert.Equal(1, txGossiped, "tx should have been gossiped")
 	txGossipedLock.Unlock()
 	assert.True(vm.mempool.has(tx.ID()))
+	assert.False(vm.mempool.IsLocalTx(tx.ID()), "gossiped tx should not be tagged as local")
 
 	// show that tx is not re-gossiped
 	assert.NoError(vm.AppGossip(nodeID, msgBytes))
@@ -159,8 +163,9 @@ func TestMempoolAtmTxsAppGossipHandlingDiscardedTx(t *testing.T) {
 		txGossipedLock sync.Mutex
 		txRequested    bool
 	)
-	sender.CantSendAppGossip = false
-	sender.SendAppGossipF = func(_ []byte) error {
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, _ []byte) error {
 		txGossipedLock.Lock()
 		defer txGossipedLock.Unlock()
 
@@ -221,3 +226,66 @@ func TestMempoolAtmTxsAppGossipHandlingDiscardedTx(t *testing.T) {
 	assert.False(mempool.has(txID))
 	assert.True(mempool.has(conflictingTx.ID()))
 }
+
+// locally issued txs should be gossiped right away, even when the background
+// lane is saturated
+func TestMempoolAtmTxsLocalGossipPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	const priorityGossipDeadline = 500 * time.Millisecond
+
+	issuer, vm, _, sharedMemory, sender := GenesisVM(t, true, genesisJSONApricotPhase4, `{"tx-gossip-background-rate-limit": 1}`, "")
+	defer func() {
+		assert.NoError(vm.Shutdown())
+	}()
+
+	gossipedTxIDs := make(chan ids.ID, 16)
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, gossipedBytes []byte) error {
+		notifyMsgIntf, err := message.ParseMessage(vm.networkCodec, gossipedBytes)
+		if err != nil {
+			// Filler sent on the background lane
+			return nil
+		}
+		requestMsg, ok := notifyMsgIntf.(*message.AtomicTx)
+		if !ok {
+			return nil
+		}
+
+		txg := Tx{}
+		_, err = Codec.Unmarshal(requestMsg.Tx, &txg)
+		assert.NoError(err)
+		unsignedBytes, err := Codec.Marshal(codecVersion, &txg.UnsignedAtomicTx)
+		assert.NoError(err)
+		txg.Initialize(unsignedBytes, requestMsg.Tx)
+		gossipedTxIDs <- txg.ID()
+		return nil
+	}
+
+	exportTxs := createExportTxOptions(t, vm, issuer, sharedMemory)
+	tx := exportTxs[0]
+
+	// Saturate the background lane
+	pushNetwork := vm.gossiper.(*pushGossiper)
+	for {
+		if err := pushNetwork.backgroundLane.enqueue(nil, nil); err != nil {
+			assert.ErrorIs(err, errGossipLaneFull)
+			break
+		}
+	}
+
+	assert.NoError(vm.issueTx(tx, true /*=local*/))
+	deadline := time.After(priorityGossipDeadline)
+	for gossiped := false; !gossiped; {
+		select {
+		case txID := <-gossipedTxIDs:
+			gossiped = txID == tx.ID()
+		case <-deadline:
+			t.Fatal("locally issued tx was not gossiped within the priority deadline")
+		}
+	}
+
+	// The background lane should still be backed up
+	assert.Greater(len(pushNetwork.backgroundLane.queue), 0)
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/version"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -26,6 +27,15 @@ import (
 	"github.com/zsmartex/coreth/plugin/evm/message"
 )
 
+// connectGossipPeer connects a peer to [vm], for its gossip to be sent.
+func connectGossipPeer(t *testing.T, vm *VM) ids.ShortID {
+	nodeID := ids.GenerateTestShortID()
+	if err := vm.Network.Connected(nodeID, version.NewDefaultApplication("corethtest", 1, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	return nodeID
+}
+
 func fundAddressByGenesis(addrs []common.Address) (string, error) {
 	balance := big.NewInt(0xffffffffffffff)
 	genesis := &core.Genesis{
@@ -103,10 +113,11 @@ func TestMempoolEthTxsAddedTxsGossipedAfterActivation(t *testing.T) {
 
 	var wg sync.WaitGroup
 	wg.Add(2)
-	sender.CantSendAppGossip = false
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
 	signal1 := make(chan struct{})
 	seen := 0
-	sender.SendAppGossipF = func(gossipedBytes []byte) error {
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, gossipedBytes []byte) error {
 		if seen == 0 {
 			notifyMsgIntf, err := message.ParseMessage(vm.networkCodec, gossipedBytes)
 			assert.NoError(err)
@@ -188,9 +199,10 @@ func TestMempoolEthTxsAddedTxsGossipedAfterActivationChunking(t *testing.T) {
 
 	var wg sync.WaitGroup
 	wg.Add(2)
-	sender.CantSendAppGossip = false
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
 	seen := map[common.Hash]struct{}{}
-	sender.SendAppGossipF = func(gossipedBytes []byte) error {
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, gossipedBytes []byte) error {
 		notifyMsgIntf, err := message.ParseMessage(vm.networkCodec, gossipedBytes)
 		assert.NoError(err)
 
@@ -246,13 +258,14 @@ func TestMempoolEthTxsAppGossipHandling(t *testing.T) {
 		wg          sync.WaitGroup
 		txRequested bool
 	)
-	sender.CantSendAppGossip = false
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
 	sender.SendAppRequestF = func(_ ids.ShortSet, _ uint32, _ []byte) error {
 		txRequested = true
 		return nil
 	}
 	wg.Add(1)
-	sender.SendAppGossipF = func(_ []byte) error {
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, _ []byte) error {
 		wg.Done()
 		return nil
 	}
@@ -278,6 +291,55 @@ func TestMempoolEthTxsAppGossipHandling(t *testing.T) {
 	attemptAwait(t, &wg, 5*time.Second)
 }
 
+// show that well-formed txs of a type that is not supported yet do not cause
+// the other txs of a gossip message to be dropped
+func TestMempoolEthTxsAppGossipUnsupportedType(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.GenerateKey()
+	assert.NoError(err)
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	cfgJson, err := fundAddressByGenesis([]common.Address{addr})
+	assert.NoError(err)
+
+	_, vm, _, _, sender := GenesisVM(t, true, cfgJson, "", "")
+	defer func() {
+		err := vm.Shutdown()
+		assert.NoError(err)
+	}()
+	vm.chain.GetTxPool().SetGasPrice(common.Big1)
+	vm.chain.GetTxPool().SetMinFee(common.Big0)
+
+	var wg sync.WaitGroup
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+	wg.Add(1)
+	sender.SendAppGossipSpecificF = func(_ ids.ShortSet, _ []byte) error {
+		wg.Done()
+		return nil
+	}
+
+	tx := getValidEthTxs(key, 1, common.Big1)[0]
+	txBytes, err := rlp.EncodeToBytes(tx)
+	assert.NoError(err)
+	// A blob tx envelope, encoded in the list as typed txs are
+	blobTxBytes, err := rlp.EncodeToBytes([]byte{0x03, 0xc0})
+	assert.NoError(err)
+	msgTxs, err := rlp.EncodeToBytes([]rlp.RawValue{blobTxBytes, txBytes})
+	assert.NoError(err)
+	msgBytes, err := message.BuildMessage(vm.networkCodec, &message.EthTxs{Txs: msgTxs})
+	assert.NoError(err)
+
+	err = vm.AppGossip(ids.GenerateTestShortID(), msgBytes)
+	assert.NoError(err)
+	assert.True(vm.chain.GetTxPool().Has(tx.Hash()), "supported tx should be added to the mempool")
+
+	// wait for the supported transaction to be re-gossiped
+	attemptAwait(t, &wg, 5*time.Second)
+}
+
 func TestMempoolEthTxsRegossipSingleAccount(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,207 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// handlerDrainTimeout is the maximum duration to wait for the calls in flight
+// on the removed methods to complete when reloading the handler config.
+const handlerDrainTimeout = 30 * time.Second
+
+// handlerConfig is the part of the [Config] of the eth RPC and websocket
+// handlers that can be reloaded at runtime with admin.reloadHandlerConfig.
+type handlerConfig struct {
+	EnabledEthAPIs                []string `json:"eth-apis"`
+	EnabledEthAPIMethodGroups     []string `json:"eth-api-method-groups"`
+	SnowmanAPIEnabled             bool     `json:"snowman-api-enabled"`
+	APIMaxDuration                Duration `json:"api-max-duration"`
+	WSCPURefillRate               Duration `json:"ws-cpu-refill-rate"`
+	WSCPUMaxStored                Duration `json:"ws-cpu-max-stored"`
+	WSMaxPendingNotificationBytes int      `json:"ws-max-pending-notification-bytes"`
+}
+
+// handlerConfig returns a copy of the handler config of [c].
+func (c Config) handlerConfig() handlerConfig {
+	return handlerConfig{
+		EnabledEthAPIs:                append([]string{}, c.EnabledEthAPIs...),
+		EnabledEthAPIMethodGroups:     append([]string{}, c.EnabledEthAPIMethodGroups...),
+		SnowmanAPIEnabled:             c.SnowmanAPIEnabled,
+		APIMaxDuration:                c.APIMaxDuration,
+		WSCPURefillRate:               c.WSCPURefillRate,
+		WSCPUMaxStored:                c.WSCPUMaxStored,
+		WSMaxPendingNotificationBytes: c.WSMaxPendingNotificationBytes,
+	}
+}
+
+// update returns [c] with the settings of the JSON object [b] applied over
+// it. Unknown settings are refused.
+func (c handlerConfig) update(b []byte) (handlerConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return handlerConfig{}, fmt.Errorf("failed to parse handler config: %w", err)
+	}
+	if _, err := ethAPIMethods(c.EnabledEthAPIMethodGroups); err != nil {
+		return handlerConfig{}, err
+	}
+	return c, nil
+}
+
+// wsDispatcher serves the websocket connections with the handler set last,
+// so that reloading the websocket settings applies to the new connections
+// while the established ones keep theirs.
+type wsDispatcher struct {
+	handler atomic.Value // http.Handler
+}
+
+func (d *wsDispatcher) set(handler http.Handler) {
+	d.handler.Store(handler)
+}
+
+func (d *wsDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.handler.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// rpcHandlers are the long-lived eth RPC and websocket handlers of the VM,
+// whose services are replaced when the handler config is reloaded.
+type rpcHandlers struct {
+	lock   sync.Mutex // serializes the reloads
+	config handlerConfig
+	server *rpc.Server
+	ws     *wsDispatcher
+}
+
+// newRPCServer returns a server with the services enabled by [config], and the
+// names of the enabled APIs.
+func (vm *VM) newRPCServer(config handlerConfig) (*rpc.Server, []string, error) {
+	server := vm.chain.NewRPCHandler(config.APIMaxDuration.Duration)
+	if err := vm.registerIdentityAPIs(server); err != nil {
+		return nil, nil, err
+	}
+	enabledMethods, err := ethAPIMethods(config.EnabledEthAPIMethodGroups)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := vm.chain.AttachEthServiceMethods(server, config.EnabledEthAPIs, enabledMethods); err != nil {
+		return nil, nil, err
+	}
+	enabledAPIs := append(append([]string{}, config.EnabledEthAPIs...), config.EnabledEthAPIMethodGroups...)
+	for _, name := range config.EnabledEthAPIs {
+		if name != "public-eth" {
+			continue
+		}
+		if err := server.RegisterName("eth", &BlockLimitsAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		if err := server.RegisterName("eth", &FeeConfigAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		break
+	}
+	if config.SnowmanAPIEnabled {
+		if err := server.RegisterName("snowman", &SnowmanAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		enabledAPIs = append(enabledAPIs, "snowman")
+	}
+	if vm.nonceReserver != nil {
+		if err := server.RegisterName("eth", &NonceReservationAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		enabledAPIs = append(enabledAPIs, "nonce-reservations")
+	}
+	if vm.approvalIndex != nil {
+		if err := server.RegisterName("eth", &ApprovalIndexAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		enabledAPIs = append(enabledAPIs, "approval-index")
+	}
+	if vm.stateGrowthIndex != nil {
+		if err := server.RegisterName("debug", &StateGrowthAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		enabledAPIs = append(enabledAPIs, "state-growth-index")
+	}
+	for _, name := range config.EnabledEthAPIs {
+		if name != "private-debug" {
+			continue
+		}
+		if err := server.RegisterName("debug", &ProcessingBlocksAPI{vm}); err != nil {
+			return nil, nil, err
+		}
+		break
+	}
+	return server, enabledAPIs, nil
+}
+
+// newRPCHandlers returns the eth RPC and websocket handlers configured by
+// [config], and the names of the enabled APIs.
+func (vm *VM) newRPCHandlers(config handlerConfig) (*rpcHandlers, []string, error) {
+	server, enabledAPIs, err := vm.newRPCServer(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.SetGate(vm.rpcGate)
+	server.SetStrictQuantities(vm.config.RPCStrictQuantities)
+	handlers := &rpcHandlers{
+		config: config,
+		server: server,
+		ws:     &wsDispatcher{},
+	}
+	handlers.ws.set(server.WebsocketHandlerWithDuration([]string{"*"}, config.APIMaxDuration.Duration, config.WSCPURefillRate.Duration, config.WSCPUMaxStored.Duration, config.WSMaxPendingNotificationBytes))
+	return handlers, enabledAPIs, nil
+}
+
+// reloadHandlerConfig applies the settings of the JSON object [b] over the
+// handler config of the eth RPC and websocket handlers, without interrupting
+// the calls to the methods that remain enabled. Waits for the calls in flight
+// on the removed methods to complete, while the subscriptions of the disabled
+// namespaces are terminated.
+func (vm *VM) reloadHandlerConfig(b []byte) error {
+	vm.rpcHandlersLock.Lock()
+	handlers := vm.rpcHandlers
+	vm.rpcHandlersLock.Unlock()
+	if handlers == nil {
+		return errors.New("the handlers are not created")
+	}
+
+	handlers.lock.Lock()
+	defer handlers.lock.Unlock()
+
+	config, err := handlers.config.update(b)
+	if err != nil {
+		return err
+	}
+	server, enabledAPIs, err := vm.newRPCServer(config)
+	if err != nil {
+		return err
+	}
+	handlers.server.SetMaximumDuration(config.APIMaxDuration.Duration)
+	handlers.ws.set(handlers.server.WebsocketHandlerWithDuration([]string{"*"}, config.APIMaxDuration.Duration, config.WSCPURefillRate.Duration, config.WSCPUMaxStored.Duration, config.WSMaxPendingNotificationBytes))
+	handlers.config = config
+
+	ctx, cancel := context.WithTimeout(context.Background(), handlerDrainTimeout)
+	defer cancel()
+	err = handlers.server.ReplaceServices(ctx, server)
+	log.Info(fmt.Sprintf("Reloaded handler config, enabled eth APIs: %s", strings.Join(enabledAPIs, ", ")))
+	if err != nil {
+		return fmt.Errorf("calls of the removed methods are still in flight: %w", err)
+	}
+	return nil
+}
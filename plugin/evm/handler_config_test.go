@@ -0,0 +1,108 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestReloadHandlerConfig(t *testing.T) {
+	config := `{"eth-apis":["public-eth","internal-public-eth","internal-public-blockchain","internal-public-tx-pool"]}`
+	_, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+
+	var status map[string]hexutil.Uint
+	if err := client.Call(&status, "txpool_status"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown settings are refused, leaving the handlers unchanged
+	admin := NewAdminService(vm, "")
+	reply := &api.SuccessResponse{}
+	if err := admin.ReloadHandlerConfig(nil, &ReloadHandlerConfigArgs{Config: `{"eth-api":[]}`}, reply); err == nil || reply.Success {
+		t.Fatal("Expected an unknown setting to be refused")
+	}
+	if err := admin.ReloadHandlerConfig(nil, &ReloadHandlerConfigArgs{Config: `{"eth-api-method-groups":["unknown"]}`}, reply); err == nil || reply.Success {
+		t.Fatal("Expected an unknown method group to be refused")
+	}
+	if err := client.Call(&status, "txpool_status"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabling the txpool namespace fails its later calls on the same
+	// connection, while the eth calls continue
+	if err := admin.ReloadHandlerConfig(nil, &ReloadHandlerConfigArgs{Config: `{"eth-apis":["public-eth","internal-public-eth","internal-public-blockchain"]}`}, reply); err != nil || !reply.Success {
+		t.Fatalf("Failed to reload the handler config: %v", err)
+	}
+	if err := client.Call(&status, "txpool_status"); err == nil {
+		t.Fatal("Expected the calls of the disabled txpool namespace to fail")
+	}
+	var blockNumber hexutil.Uint64
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+	var gasPrice hexutil.Big
+	if err := client.Call(&gasPrice, "eth_gasPrice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The settings that are not specified are kept
+	if err := admin.ReloadHandlerConfig(nil, &ReloadHandlerConfigArgs{Config: `{"snowman-api-enabled":true}`}, reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(&status, "txpool_status"); err == nil {
+		t.Fatal("Expected the txpool namespace to remain disabled")
+	}
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRPCStrictQuantities checks that the eth RPC handler rejects the
+// non-canonical quantities only if rpc-strict-quantities is set.
+func TestRPCStrictQuantities(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase5, fmt.Sprintf(`{"rpc-strict-quantities": %t}`, strict), "")
+		handlers, err := vm.CreateHandlers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+
+		var header map[string]interface{}
+		err = client.Call(&header, "eth_getBlockByNumber", "0x00", false)
+		var rpcErr rpc.Error
+		switch {
+		case !strict && err != nil:
+			t.Fatalf("Expected the quantity to be canonicalized, found %s", err)
+		case strict && (!errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32602):
+			t.Fatalf("Expected the quantity to be rejected with an invalid params error, found %v", err)
+		}
+		client.Close()
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
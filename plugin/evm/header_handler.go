@@ -0,0 +1,80 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/zsmartex/avalanchego/codec"
+	"github.com/zsmartex/avalanchego/ids"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+var _ message.HeaderRequestHandler = &headerRequestHandler{}
+
+// headerChain is the chain the headers served are read from. The canonical
+// chain up to the last accepted block is the accepted chain.
+type headerChain interface {
+	LastAcceptedBlock() *types.Block
+	GetHeaderByHash(hash common.Hash) *types.Header
+	GetHeaderByNumber(number uint64) *types.Header
+}
+
+// headerRequestHandler serves the accepted headers of [chain] to peers, so
+// that light clients can track the accepted chain by its headers.
+type headerRequestHandler struct {
+	chain headerChain
+	codec codec.Manager
+}
+
+func newHeaderRequestHandler(chain headerChain, codec codec.Manager) *headerRequestHandler {
+	return &headerRequestHandler{
+		chain: chain,
+		codec: codec,
+	}
+}
+
+// HandleHeaderRequest responds with the accepted headers of [request]. Headers
+// that are not accepted, such as those of preferred blocks that are still
+// processing, are never served.
+func (h *headerRequestHandler) HandleHeaderRequest(ctx context.Context, nodeID ids.ShortID, requestID uint32, request *message.HeaderRequest) ([]byte, error) {
+	lastAccepted := h.chain.LastAcceptedBlock().NumberU64()
+	height := request.Height
+	if request.Hash != (common.Hash{}) {
+		header := h.chain.GetHeaderByHash(request.Hash)
+		if header == nil || header.Number.Uint64() > lastAccepted || h.chain.GetHeaderByNumber(header.Number.Uint64()).Hash() != request.Hash {
+			log.Debug("header requested is not accepted", "nodeID", nodeID, "requestID", requestID, "hash", request.Hash)
+			return h.codec.Marshal(message.Version, message.HeaderResponse{})
+		}
+		height = header.Number.Uint64()
+	}
+
+	count := uint64(request.Count)
+	if count > message.MaxHeadersPerResponse {
+		count = message.MaxHeadersPerResponse
+	}
+	var response message.HeaderResponse
+	for number := height; number < height+count && number <= lastAccepted; number++ {
+		if ctx.Err() != nil {
+			break
+		}
+		header := h.chain.GetHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		headerBytes, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			log.Warn("failed to encode header", "number", number, "err", err)
+			break
+		}
+		response.Headers = append(response.Headers, headerBytes)
+	}
+	return h.codec.Marshal(message.Version, response)
+}
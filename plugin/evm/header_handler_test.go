@@ -0,0 +1,214 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/zsmartex/avalanchego/codec"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+	"github.com/zsmartex/avalanchego/version"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/peer"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+// testHeaderChain is a chain of linked headers, accepted up to [accepted].
+type testHeaderChain struct {
+	headers  []*types.Header
+	accepted uint64
+}
+
+func newTestHeaderChain(length int, accepted uint64) *testHeaderChain {
+	chain := &testHeaderChain{accepted: accepted}
+	parentHash := common.Hash{}
+	for i := 0; i < length; i++ {
+		header := &types.Header{
+			ParentHash: parentHash,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: common.Big1,
+			Time:       uint64(i),
+		}
+		chain.headers = append(chain.headers, header)
+		parentHash = header.Hash()
+	}
+	return chain
+}
+
+func (c *testHeaderChain) LastAcceptedBlock() *types.Block {
+	return types.NewBlockWithHeader(c.headers[c.accepted])
+}
+
+func (c *testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range c.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+
+func (c *testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number >= uint64(len(c.headers)) {
+		return nil
+	}
+	return c.headers[number]
+}
+
+// tamperingHeaderHandler serves the headers of its handler with the header at
+// [height] replaced by a tampered one.
+type tamperingHeaderHandler struct {
+	handler *headerRequestHandler
+	height  uint64
+}
+
+func (h *tamperingHeaderHandler) HandleHeaderRequest(ctx context.Context, nodeID ids.ShortID, requestID uint32, request *message.HeaderRequest) ([]byte, error) {
+	responseBytes, err := h.handler.HandleHeaderRequest(ctx, nodeID, requestID, request)
+	if err != nil {
+		return nil, err
+	}
+	var response message.HeaderResponse
+	if _, err := h.handler.codec.Unmarshal(responseBytes, &response); err != nil {
+		return nil, err
+	}
+	for i, headerBytes := range response.Headers {
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(headerBytes, header); err != nil {
+			return nil, err
+		}
+		if header.Number.Uint64() == h.height {
+			header.Extra = []byte("tampered")
+			if response.Headers[i], err = rlp.EncodeToBytes(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h.handler.codec.Marshal(message.Version, response)
+}
+
+// newTestHeaderClient returns a header client connected to a single peer
+// serving headers with [handler].
+func newTestHeaderClient(t *testing.T, codec codec.Manager, handler message.RequestHandler) *peer.HeaderClient {
+	var (
+		clientID, serverID           = ids.GenerateTestShortID(), ids.GenerateTestShortID()
+		clientNetwork, serverNetwork peer.Network
+		clientSender, serverSender   = &engCommon.SenderTest{T: t}, &engCommon.SenderTest{T: t}
+	)
+	clientSender.SendAppRequestF = func(_ ids.ShortSet, requestID uint32, request []byte) error {
+		go func() {
+			if err := serverNetwork.AppRequest(clientID, requestID, time.Now().Add(5*time.Second), request); err != nil {
+				panic(err)
+			}
+		}()
+		return nil
+	}
+	serverSender.SendAppResponseF = func(_ ids.ShortID, requestID uint32, response []byte) error {
+		go func() {
+			if err := clientNetwork.AppResponse(serverID, requestID, response); err != nil {
+				panic(err)
+			}
+		}()
+		return nil
+	}
+	clientNetwork = peer.NewNetwork(clientSender, codec, clientID, 16)
+	serverNetwork = peer.NewNetwork(serverSender, codec, serverID, 16)
+	serverNetwork.SetRequestHandler(handler)
+	peerVersion := version.NewDefaultApplication("corethtest", 1, 0, 0)
+	if err := clientNetwork.Connected(serverID, peerVersion); err != nil {
+		t.Fatal(err)
+	}
+	return peer.NewHeaderClient(peer.NewClient(clientNetwork), codec, peerVersion)
+}
+
+func TestHeaderRequestHandler(t *testing.T) {
+	codec, err := message.BuildCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestHeaderChain(600, 550)
+	handler := newHeaderRequestHandler(chain, codec)
+
+	serve := func(request message.HeaderRequest) [][]byte {
+		responseBytes, err := handler.HandleHeaderRequest(context.Background(), ids.ShortEmpty, 0, &request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response message.HeaderResponse
+		if _, err := codec.Unmarshal(responseBytes, &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Headers
+	}
+	tests := map[string]struct {
+		request  message.HeaderRequest
+		expected int
+	}{
+		"by height":             {message.HeaderRequest{Height: 10, Count: 20}, 20},
+		"by hash":               {message.HeaderRequest{Hash: chain.headers[10].Hash(), Count: 20}, 20},
+		"capped":                {message.HeaderRequest{Height: 0, Count: 1000}, message.MaxHeadersPerResponse},
+		"up to last accepted":   {message.HeaderRequest{Height: 540, Count: 20}, 11},
+		"after last accepted":   {message.HeaderRequest{Height: 551, Count: 20}, 0},
+		"hash not accepted":     {message.HeaderRequest{Hash: chain.headers[560].Hash(), Count: 20}, 0},
+		"hash of unknown block": {message.HeaderRequest{Hash: common.Hash{1}, Count: 20}, 0},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if headers := serve(test.request); len(headers) != test.expected {
+				t.Fatalf("Expected %d headers, found %d", test.expected, len(headers))
+			}
+		})
+	}
+}
+
+func TestHeaderClient(t *testing.T) {
+	codec, err := message.BuildCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestHeaderChain(600, 550)
+	handler := newHeaderRequestHandler(chain, codec)
+
+	// Fetch a range served in multiple requests
+	client := newTestHeaderClient(t, codec, handler)
+	headers, err := client.GetHeaders(20, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 500 {
+		t.Fatalf("Expected 500 headers, found %d", len(headers))
+	}
+	for i, header := range headers {
+		if expected := chain.headers[20+i].Hash(); header.Hash() != expected {
+			t.Fatalf("Expected header %s at height %d, found %s", expected, 20+i, header.Hash())
+		}
+	}
+	headers, err = client.GetHeadersFrom(chain.headers[300].Hash(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 10 || headers[0].Hash() != chain.headers[300].Hash() {
+		t.Fatalf("Expected 10 headers from %s, found %d", chain.headers[300].Hash(), len(headers))
+	}
+
+	// Headers that are not accepted are not served
+	if _, err := client.GetHeaders(540, 20); err == nil {
+		t.Fatal("Expected fetching headers after the last accepted header to fail")
+	}
+
+	// A tampered header is detected, including at the end of a response
+	for _, height := range []uint64{100, 20 + message.MaxHeadersPerResponse - 1} {
+		client := newTestHeaderClient(t, codec, &tamperingHeaderHandler{handler: handler, height: height})
+		if _, err := client.GetHeaders(20, 500); err == nil {
+			t.Fatalf("Expected the tampered header at height %d to be detected", height)
+		}
+	}
+}
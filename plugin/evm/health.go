@@ -7,6 +7,24 @@ package evm
 // Also returns details, which should be one of:
 // string, []byte, map[string]string
 func (vm *VM) HealthCheck() (interface{}, error) {
-	// TODO perform actual health check
-	return nil, nil
+	// The chain is reported degraded while the pressure on transaction
+	// admission is above the configured threshold
+	details, err := vm.txPressureHealth()
+	// and unhealthy while draining ahead of a shutdown, so that load balancers
+	// stop routing traffic to the node
+	if vm.shutdownDrain.isDraining() {
+		details["shutdown"] = "draining"
+		return details, errDraining
+	}
+	// and unhealthy while the indices of the accepted blocks fail to be written
+	if indicesErr := vm.chain.BlockChain().AcceptedIndicesErr(); indicesErr != nil {
+		details["acceptedIndices"] = indicesErr.Error()
+		return details, indicesErr
+	}
+	// and unhealthy while the acceptance of blocks is stalled
+	if stallErr := vm.stallDetector.stallErr(); stallErr != nil {
+		details["stall"] = stallErr.Error()
+		return details, stallErr
+	}
+	return details, err
 }
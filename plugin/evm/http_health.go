@@ -0,0 +1,155 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/zsmartex/avalanchego/utils"
+)
+
+const (
+	liveEndpoint  = "/live"
+	readyEndpoint = "/ready"
+
+	// [builderHeartbeatInterval] is how often the loop of the block builder
+	// beats while it is idle.
+	builderHeartbeatInterval = time.Second
+)
+
+// Bodies of the responses of the health endpoints, encoded once so that
+// serving them does not allocate.
+var (
+	liveBody    = []byte(`{"live":true}`)
+	readyBody   = []byte(`{"ready":true}`)
+	notLiveBody = map[string][]byte{
+		"builder": []byte(`{"live":false,"reason":"block builder loop stalled"}`),
+		"accept":  []byte(`{"live":false,"reason":"block acceptance stalled"}`),
+	}
+	notReadyBody = map[string][]byte{
+		"bootstrapping": []byte(`{"ready":false,"reason":"bootstrapping"}`),
+		"draining":      []byte(`{"ready":false,"reason":"draining ahead of shutdown"}`),
+		"head":          []byte(`{"ready":false,"reason":"accepted head behind wall clock"}`),
+	}
+)
+
+// httpHealth serves the liveness and readiness of the VM to load balancers as
+// plain HTTP status codes. The VM is live while the loop of the block builder
+// beats and no Accept call runs for longer than [maxStall]. It is ready once
+// bootstrapped, unless it drains ahead of a shutdown or its accepted head is
+// older than [maxHeadAge], if set.
+//
+// The state is updated and read atomically, so that the endpoints never wait
+// on the locks held by block processing.
+type httpHealth struct {
+	maxStall   time.Duration
+	maxHeadAge time.Duration
+	now        func() time.Time
+	draining   func() bool
+
+	builderBeat  int64 // Unix nanoseconds, accessed atomically
+	acceptStart  int64 // Unix nanoseconds of the Accept in progress, or 0, accessed atomically
+	headTime     int64 // Unix seconds of the accepted head, accessed atomically
+	bootstrapped utils.AtomicBool
+}
+
+// newHTTPHealth returns the health of a VM whose accepted head has the
+// timestamp [headTime].
+func newHTTPHealth(maxStall, maxHeadAge time.Duration, now func() time.Time, draining func() bool, headTime uint64) *httpHealth {
+	return &httpHealth{
+		maxStall:    maxStall,
+		maxHeadAge:  maxHeadAge,
+		now:         now,
+		draining:    draining,
+		builderBeat: now().UnixNano(),
+		headTime:    int64(headTime),
+	}
+}
+
+// beat records that the loop of the block builder is responsive.
+func (h *httpHealth) beat() {
+	if h == nil {
+		return
+	}
+	atomic.StoreInt64(&h.builderBeat, h.now().UnixNano())
+}
+
+// accepting records the start of the acceptance of a block.
+func (h *httpHealth) accepting() {
+	if h == nil {
+		return
+	}
+	atomic.StoreInt64(&h.acceptStart, h.now().UnixNano())
+}
+
+// accepted records the end of the acceptance of a block, and the timestamp
+// [headTime] of the accepted head.
+func (h *httpHealth) accepted(headTime uint64) {
+	if h == nil {
+		return
+	}
+	atomic.StoreInt64(&h.headTime, int64(headTime))
+	atomic.StoreInt64(&h.acceptStart, 0)
+}
+
+// setBootstrapped records whether the chain is bootstrapped.
+func (h *httpHealth) setBootstrapped(bootstrapped bool) {
+	if h == nil {
+		return
+	}
+	h.bootstrapped.SetValue(bootstrapped)
+}
+
+// notLive returns why the VM is not live, or "" if it is.
+func (h *httpHealth) notLive() string {
+	now := h.now().UnixNano()
+	if now-atomic.LoadInt64(&h.builderBeat) > int64(h.maxStall) {
+		return "builder"
+	}
+	if start := atomic.LoadInt64(&h.acceptStart); start != 0 && now-start > int64(h.maxStall) {
+		return "accept"
+	}
+	return ""
+}
+
+// notReady returns why the VM is not ready, or "" if it is.
+func (h *httpHealth) notReady() string {
+	switch {
+	case !h.bootstrapped.GetValue():
+		return "bootstrapping"
+	case h.draining():
+		return "draining"
+	case h.maxHeadAge > 0 && h.now().Sub(time.Unix(atomic.LoadInt64(&h.headTime), 0)) > h.maxHeadAge:
+		return "head"
+	default:
+		return ""
+	}
+}
+
+// writeHealth writes [body] with the status 200 if [reason] is empty, and 503
+// with the body of [reason] in [reasons] otherwise.
+func writeHealth(w http.ResponseWriter, reason string, body []byte, reasons map[string][]byte) {
+	w.Header().Set("Content-Type", "application/json")
+	if reason != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		body = reasons[reason]
+	}
+	_, _ = w.Write(body)
+}
+
+// liveHandler serves the liveness of the VM.
+func (h *httpHealth) liveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.notLive(), liveBody, notLiveBody)
+	})
+}
+
+// readyHandler serves the readiness of the VM.
+func (h *httpHealth) readyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.notReady(), readyBody, notReadyBody)
+	})
+}
@@ -0,0 +1,93 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// checkHealth expects [handler] to respond with [status] and, if it fails,
+// with [reason].
+func checkHealth(t *testing.T, handler http.Handler, status int, reason string) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid body %q: %v", w.Body.String(), err)
+	}
+	if w.Code != status || body.Reason != reason {
+		t.Fatalf("Expected status %d with reason %q, found %d with %q", status, reason, w.Code, w.Body.String())
+	}
+}
+
+func TestHTTPHealth(t *testing.T) {
+	var (
+		now      = time.Unix(1_000_000, 0)
+		draining bool
+		h        = newHTTPHealth(10*time.Second, time.Minute, func() time.Time { return now }, func() bool { return draining }, uint64(now.Unix()))
+		live     = h.liveHandler()
+		ready    = h.readyHandler()
+	)
+
+	// The VM is live while the block builder beats and no Accept stalls
+	checkHealth(t, live, http.StatusOK, "")
+	now = now.Add(11 * time.Second)
+	checkHealth(t, live, http.StatusServiceUnavailable, "block builder loop stalled")
+	h.beat()
+	checkHealth(t, live, http.StatusOK, "")
+	h.accepting()
+	now = now.Add(11 * time.Second)
+	h.beat()
+	checkHealth(t, live, http.StatusServiceUnavailable, "block acceptance stalled")
+	h.accepted(uint64(now.Unix()))
+	checkHealth(t, live, http.StatusOK, "")
+
+	// The VM is ready once bootstrapped, unless it drains or its head is
+	// too old
+	checkHealth(t, ready, http.StatusServiceUnavailable, "bootstrapping")
+	h.setBootstrapped(true)
+	checkHealth(t, ready, http.StatusOK, "")
+	draining = true
+	checkHealth(t, ready, http.StatusServiceUnavailable, "draining ahead of shutdown")
+	draining = false
+	now = now.Add(2 * time.Minute)
+	checkHealth(t, ready, http.StatusServiceUnavailable, "accepted head behind wall clock")
+	h.accepted(uint64(now.Unix()))
+	checkHealth(t, ready, http.StatusOK, "")
+	h.setBootstrapped(false)
+	checkHealth(t, ready, http.StatusServiceUnavailable, "bootstrapping")
+}
+
+func TestHTTPHealthHandlers(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase0, "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHealth(t, handlers[liveEndpoint].Handler, http.StatusOK, "")
+	checkHealth(t, handlers[readyEndpoint].Handler, http.StatusOK, "")
+
+	// The readiness fails while the node drains, with the lock of the drain
+	// held by a transition
+	vm.shutdownDrain.prepare(time.Minute)
+	vm.shutdownDrain.lock.Lock()
+	checkHealth(t, handlers[readyEndpoint].Handler, http.StatusServiceUnavailable, "draining ahead of shutdown")
+	vm.shutdownDrain.lock.Unlock()
+	vm.shutdownDrain.cancel()
+	checkHealth(t, handlers[readyEndpoint].Handler, http.StatusOK, "")
+}
@@ -0,0 +1,62 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// registerIdentityAPIs registers the methods identifying the chain and the
+// client on [server], so that wallets and tooling can connect to a VM with
+// every other API disabled. They are registered before the other APIs, which
+// take over the methods they share when enabled.
+func (vm *VM) registerIdentityAPIs(server *rpc.Server) error {
+	if err := server.RegisterName("eth", &IdentityEthAPI{vm}); err != nil {
+		return err
+	}
+	if err := server.RegisterName("net", &IdentityNetAPI{vm}); err != nil {
+		return err
+	}
+	return server.RegisterName("web3", &IdentityWeb3API{})
+}
+
+// IdentityEthAPI serves the identity of the chain in the eth namespace.
+type IdentityEthAPI struct{ vm *VM }
+
+// ChainId returns the chain ID of the chain config.
+func (api *IdentityEthAPI) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(api.vm.chainConfig.ChainID)
+}
+
+// Syncing returns false once the chain is bootstrapped, and its progress
+// otherwise.
+func (api *IdentityEthAPI) Syncing() interface{} {
+	if api.vm.health.bootstrapped.GetValue() {
+		return false
+	}
+	if api.vm.readiness != nil {
+		return api.vm.readiness.progress()
+	}
+	return SyncProgress{CurrentHeight: hexutil.Uint64(api.vm.chain.LastAcceptedBlock().NumberU64())}
+}
+
+// IdentityNetAPI serves the identity of the network in the net namespace.
+type IdentityNetAPI struct{ vm *VM }
+
+// Version returns the network ID.
+func (api *IdentityNetAPI) Version() string {
+	return fmt.Sprintf("%d", api.vm.networkID)
+}
+
+// IdentityWeb3API serves the identity of the client in the web3 namespace.
+type IdentityWeb3API struct{}
+
+// ClientVersion returns the [ClientVersion] of the build.
+func (api *IdentityWeb3API) ClientVersion() string {
+	return ClientVersion
+}
@@ -0,0 +1,54 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+func TestIdentityAPIs(t *testing.T) {
+	tvm := testutils.NewTestVM(t, `{"eth-apis":[]}`, testutils.GenesisJSON(params.TestLaunchConfig))
+	client := tvm.Client()
+
+	// The identity methods respond with every other API disabled
+	var chainID hexutil.Big
+	if err := client.Call(&chainID, "eth_chainId"); err != nil {
+		t.Fatal(err)
+	}
+	if chainID.ToInt().Cmp(tvm.ChainID()) != 0 {
+		t.Fatalf("Expected chain ID %d, found %d", tvm.ChainID(), chainID.ToInt())
+	}
+	var networkID string
+	if err := client.Call(&networkID, "net_version"); err != nil {
+		t.Fatal(err)
+	}
+	if networkID != "43111" {
+		t.Fatalf("Expected network ID 43111, found %s", networkID)
+	}
+	var version string
+	if err := client.Call(&version, "web3_clientVersion"); err != nil {
+		t.Fatal(err)
+	}
+	if version != evm.ClientVersion {
+		t.Fatalf("Expected client version %q, found %q", evm.ClientVersion, version)
+	}
+	var syncing bool
+	if err := client.Call(&syncing, "eth_syncing"); err != nil {
+		t.Fatal(err)
+	}
+	if syncing {
+		t.Fatal("Expected the bootstrapped VM not to be syncing")
+	}
+
+	var blockNumber hexutil.Uint64
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err == nil {
+		t.Fatal("Expected eth_blockNumber to be disabled")
+	}
+}
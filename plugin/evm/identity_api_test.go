@@ -0,0 +1,26 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestClientVersion(t *testing.T) {
+	platform := runtime.GOOS + "-" + runtime.GOARCH + "/" + runtime.Version()
+	tests := []struct {
+		forkName, version, commit string
+		expected                  string
+	}{
+		{"zsmartex", "v0.8.6", "1a2b3c4d5e6f", "coreth-zsmartex/v0.8.6-1a2b3c4d/" + platform},
+		{"zsmartex", "v0.8.6", "", "coreth-zsmartex/v0.8.6/" + platform},
+		{"", "v0.8.6", "1a2b", "coreth/v0.8.6-1a2b/" + platform},
+	}
+	for _, test := range tests {
+		if version := clientVersion(test.forkName, test.version, test.commit); version != test.expected {
+			t.Fatalf("Expected client version %q, found %q", test.expected, version)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/zsmartex/avalanchego/cache"
@@ -39,6 +40,12 @@ type Mempool struct {
 	Pending chan struct{}
 	// newTxs is an array of [Tx] that are ready to be gossiped.
 	newTxs []*Tx
+	// localTxs is the set of transactions in the mempool that were issued by
+	// this node rather than received from a peer.
+	localTxs ids.Set
+	// firstSeen is the time the transactions in the mempool were first added
+	// to it.
+	firstSeen map[ids.ID]time.Time
 	// utxoSet is a collection of all pending and issued UTXOs
 	utxoSet ids.Set
 	// txHeap is a sorted record of all txs in the mempool by [gasPrice]
@@ -53,6 +60,8 @@ func NewMempool(AVAXAssetID ids.ID, maxSize int) *Mempool {
 		issuedTxs:    make(map[ids.ID]*Tx),
 		discardedTxs: &cache.LRU{Size: discardedTxsCacheSize},
 		currentTxs:   make(map[ids.ID]*Tx),
+		localTxs:     ids.NewSet(0),
+		firstSeen:    make(map[ids.ID]time.Time),
 		Pending:      make(chan struct{}, 1),
 		utxoSet:      ids.NewSet(maxSize),
 		txHeap:       newTxHeap(maxSize),
@@ -103,7 +112,16 @@ func (m *Mempool) AddTx(tx *Tx) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	return m.addTx(tx, false)
+	return m.addTx(tx, false, false)
+}
+
+// AddLocalTx attempts to add [tx], which was issued by this node, to the
+// mempool and returns an error if it could not be added to the mempool.
+func (m *Mempool) AddLocalTx(tx *Tx) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.addTx(tx, true, false)
 }
 
 // forceAddTx forcibly adds a *Tx to the mempool and bypasses all verification.
@@ -111,12 +129,13 @@ func (m *Mempool) ForceAddTx(tx *Tx) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	return m.addTx(tx, true)
+	return m.addTx(tx, false, true)
 }
 
 // addTx adds [tx] to the mempool. Assumes [m.lock] is held.
+// If [local], [tx] is recorded as issued by this node.
 // If [force], skips conflict checks within the mempool.
-func (m *Mempool) addTx(tx *Tx, force bool) error {
+func (m *Mempool) addTx(tx *Tx, local bool, force bool) error {
 	txID := tx.ID()
 	// If [txID] has already been issued or is in the currentTxs map
 	// there's no need to add it.
@@ -160,6 +179,8 @@ func (m *Mempool) addTx(tx *Tx, force bool) error {
 
 			tx := m.txHeap.PopMin()
 			m.utxoSet.Remove(tx.InputUTXOs().List()...)
+			m.localTxs.Remove(tx.ID())
+			delete(m.firstSeen, tx.ID())
 			m.discardedTxs.Evict(tx.ID())
 		} else {
 			// This could occur if we have used our entire size allowance on
@@ -182,6 +203,12 @@ func (m *Mempool) addTx(tx *Tx, force bool) error {
 	// reject conflicting transactions.
 	m.txHeap.Push(tx, gasPrice)
 	m.utxoSet.Union(utxoSet)
+	if local {
+		m.localTxs.Add(txID)
+	}
+	if _, seen := m.firstSeen[txID]; !seen {
+		m.firstSeen[txID] = time.Now()
+	}
 
 	// When adding [tx] to the mempool make sure that there is an item in Pending
 	// to signal the VM to produce a block. Note: if the VM's buildStatus has already
@@ -193,6 +220,24 @@ func (m *Mempool) addTx(tx *Tx, force bool) error {
 	return nil
 }
 
+// RestoreTx adds [tx], restored from a snapshot of a mempool, to the mempool
+// as if it was first added at [firstSeen]. If [local], [tx] is recorded as
+// issued by this node.
+func (m *Mempool) RestoreTx(tx *Tx, local bool, firstSeen time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	txID := tx.ID()
+	_, seen := m.firstSeen[txID]
+	if err := m.addTx(tx, local, false); err != nil {
+		return err
+	}
+	if !seen && m.txHeap.Has(txID) {
+		m.firstSeen[txID] = firstSeen
+	}
+	return nil
+}
+
 // NextTx returns a transaction to be issued from the mempool.
 func (m *Mempool) NextTx() (*Tx, bool) {
 	m.lock.Lock()
@@ -242,6 +287,58 @@ func (m *Mempool) GetTx(txID ids.ID) (*Tx, bool, bool) {
 	return nil, false, false
 }
 
+// Txs returns the transactions in the mempool that have not been accepted
+// yet, whether pending, about to be added to a block or issued into one.
+func (m *Mempool) Txs() []*Tx {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	txs := make([]*Tx, 0, m.length())
+	for _, entry := range m.txHeap.maxHeap.items {
+		txs = append(txs, entry.tx)
+	}
+	for _, tx := range m.currentTxs {
+		txs = append(txs, tx)
+	}
+	for _, tx := range m.issuedTxs {
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// PendingTx is a transaction waiting to be issued into a block.
+type PendingTx struct {
+	Tx        *Tx
+	Local     bool      // Issued by this node rather than received from a peer
+	FirstSeen time.Time // Time the transaction was first added to the mempool
+}
+
+// PendingTxs returns the transactions in the mempool waiting to be issued
+// into a block.
+func (m *Mempool) PendingTxs() []PendingTx {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	txs := make([]PendingTx, 0, m.txHeap.Len())
+	for _, entry := range m.txHeap.maxHeap.items {
+		txs = append(txs, PendingTx{
+			Tx:        entry.tx,
+			Local:     m.localTxs.Contains(entry.id),
+			FirstSeen: m.firstSeen[entry.id],
+		})
+	}
+	return txs
+}
+
+// IsLocalTx returns true if [txID] is in the mempool and was issued by this
+// node rather than received from a peer.
+func (m *Mempool) IsLocalTx(txID ids.ID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.localTxs.Contains(txID)
+}
+
 // IssueCurrentTx marks [currentTx] as issued if there is one
 func (m *Mempool) IssueCurrentTxs() {
 	m.lock.Lock()
@@ -307,6 +404,8 @@ func (m *Mempool) cancelTx(tx *Tx) {
 		// invalid. This should never happen but we guard against the case it does.
 		log.Error("failed to calculate atomic tx gas price while canceling current tx", "err", err)
 		m.utxoSet.Remove(tx.InputUTXOs().List()...)
+		m.localTxs.Remove(tx.ID())
+		delete(m.firstSeen, tx.ID())
 		m.discardedTxs.Put(tx.ID(), tx)
 	}
 
@@ -338,6 +437,8 @@ func (m *Mempool) DiscardCurrentTxs() {
 // Assumes the lock is held.
 func (m *Mempool) discardCurrentTx(tx *Tx) {
 	m.utxoSet.Remove(tx.InputUTXOs().List()...)
+	m.localTxs.Remove(tx.ID())
+	delete(m.firstSeen, tx.ID())
 	m.discardedTxs.Put(tx.ID(), tx)
 	delete(m.currentTxs, tx.ID())
 }
@@ -363,6 +464,8 @@ func (m *Mempool) RemoveTx(txID ids.ID) {
 	if removedTx != nil {
 		m.utxoSet.Remove(removedTx.InputUTXOs().List()...)
 	}
+	m.localTxs.Remove(txID)
+	delete(m.firstSeen, txID)
 	m.discardedTxs.Evict(txID)
 }
 
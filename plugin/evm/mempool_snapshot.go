@@ -0,0 +1,170 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+)
+
+// MempoolRestoreResult is the outcome of the restoration of a tx of a mempool
+// snapshot.
+type MempoolRestoreResult struct {
+	// TxID is the hash of an eth tx or the ID of an atomic tx.
+	TxID   string `json:"txID"`
+	Atomic bool   `json:"atomic"`
+	// Error is the reason the tx was not restored, empty if it was.
+	Error string `json:"error,omitempty"`
+}
+
+// SnapshotMempool returns a snapshot of the pending and queued eth txs and of
+// the pending atomic txs, with their origin and the time they were admitted,
+// serialized as a [message.MempoolSnapshot] with the message codec.
+func (vm *VM) SnapshotMempool() ([]byte, error) {
+	snapshot := message.MempoolSnapshot{}
+
+	txPool := vm.chain.GetTxPool()
+	pending, queued := txPool.Content()
+	senders := make([]common.Address, 0, len(pending)+len(queued))
+	for sender := range pending {
+		senders = append(senders, sender)
+	}
+	for sender := range queued {
+		if _, ok := pending[sender]; !ok {
+			senders = append(senders, sender)
+		}
+	}
+	sort.Slice(senders, func(i, j int) bool { return bytes.Compare(senders[i][:], senders[j][:]) < 0 })
+	// The txs submitted with conditions are left out, as they would be
+	// restored without their conditions
+	conditionals := txPool.Conditionals()
+	for _, sender := range senders {
+		for _, tx := range append(pending[sender], queued[sender]...) {
+			if conditionals[tx.Hash()] != nil {
+				continue
+			}
+			txBytes, err := tx.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode eth tx %s: %w", tx.Hash(), err)
+			}
+			snapshot.EthTxs = append(snapshot.EthTxs, message.MempoolSnapshotTx{
+				Tx:        txBytes,
+				Local:     txPool.HasLocal(tx.Hash()),
+				FirstSeen: tx.FirstSeen().UnixNano(),
+			})
+		}
+	}
+
+	for _, pendingTx := range vm.mempool.PendingTxs() {
+		snapshot.AtomicTxs = append(snapshot.AtomicTxs, message.MempoolSnapshotTx{
+			Tx:        pendingTx.Tx.Bytes(),
+			Local:     pendingTx.Local,
+			FirstSeen: pendingTx.FirstSeen.UnixNano(),
+		})
+	}
+
+	snapshotCodec, err := message.BuildSnapshotCodec()
+	if err != nil {
+		return nil, err
+	}
+	return snapshotCodec.Marshal(message.Version, &snapshot)
+}
+
+// LoadMempoolSnapshot restores the txs of [snapshotBytes], returned by
+// [SnapshotMempool], to the mempools through their validation at the
+// preferred block, with their origin and admission time. If [skipFeeChecks],
+// the txs are exempt from the pricing constraints of the mempools, so that a
+// snapshot can be reproduced exactly despite the fees having changed.
+//
+// Returns the result of the restoration of each tx of the snapshot, eth txs
+// first, in their order in the snapshot.
+func (vm *VM) LoadMempoolSnapshot(snapshotBytes []byte, skipFeeChecks bool) ([]MempoolRestoreResult, error) {
+	snapshotCodec, err := message.BuildSnapshotCodec()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := message.MempoolSnapshot{}
+	version, err := snapshotCodec.Unmarshal(snapshotBytes, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mempool snapshot: %w", err)
+	}
+	if version != message.Version {
+		return nil, fmt.Errorf("unexpected mempool snapshot version %d", version)
+	}
+
+	results := make([]MempoolRestoreResult, 0, len(snapshot.EthTxs)+len(snapshot.AtomicTxs))
+	// The consecutive eth txs of the same origin are restored in a batch
+	var (
+		txPool = vm.chain.GetTxPool()
+		batch  []*types.Transaction
+		local  bool
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for i, err := range txPool.AddRestored(batch, local, skipFeeChecks) {
+			if err != nil {
+				results[len(results)-len(batch)+i].Error = err.Error()
+			}
+		}
+		batch = nil
+	}
+	for _, snapshotTx := range snapshot.EthTxs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(snapshotTx.Tx); err != nil {
+			flush()
+			results = append(results, MempoolRestoreResult{Error: fmt.Sprintf("failed to decode eth tx: %s", err)})
+			continue
+		}
+		tx.SetFirstSeen(time.Unix(0, snapshotTx.FirstSeen))
+		if snapshotTx.Local != local {
+			flush()
+			local = snapshotTx.Local
+		}
+		batch = append(batch, tx)
+		results = append(results, MempoolRestoreResult{TxID: tx.Hash().Hex()})
+	}
+	flush()
+
+	for _, snapshotTx := range snapshot.AtomicTxs {
+		tx, err := ExtractAtomicTx(snapshotTx.Tx, vm.codec)
+		if err != nil {
+			results = append(results, MempoolRestoreResult{Atomic: true, Error: err.Error()})
+			continue
+		}
+		result := MempoolRestoreResult{TxID: tx.ID().String(), Atomic: true}
+		if err := vm.restoreAtomicTx(tx, snapshotTx.Local, time.Unix(0, snapshotTx.FirstSeen), skipFeeChecks); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	restored := 0
+	for _, result := range results {
+		if result.Error == "" {
+			restored++
+		}
+	}
+	log.Info("Loaded mempool snapshot", "txs", len(results), "restored", restored, "skipFeeChecks", skipFeeChecks)
+	return results, nil
+}
+
+// restoreAtomicTx adds the atomic [tx] of a mempool snapshot to the mempool
+// after verifying it at the preferred block, paying the dynamic fee unless
+// [skipFeeChecks].
+func (vm *VM) restoreAtomicTx(tx *Tx, local bool, firstSeen time.Time, skipFeeChecks bool) error {
+	if err := vm.verifyTxAtTipFees(tx, !skipFeeChecks); err != nil {
+		return err
+	}
+	return vm.mempool.RestoreTx(tx, local, firstSeen)
+}
@@ -0,0 +1,162 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestMempoolSnapshotRoundTrip(t *testing.T) {
+	genesisJSON, err := fundAddressByGenesis([]common.Address{testEthAddrs[0], testEthAddrs[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxos := map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+		testShortIDAddrs[1]: 50000000000,
+	}
+	newVM := func() *VM {
+		_, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSON, `{"local-txs-enabled":true}`, "", utxos)
+		t.Cleanup(func() {
+			if err := vm.Shutdown(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		return vm
+	}
+	vm := newVM()
+
+	// A local and a remote pending eth tx, and a remote queued one
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	ethTx := func(nonce uint64, key int) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[2], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[key].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	localTx, remoteTx, queuedTx := ethTx(0, 0), ethTx(0, 1), ethTx(2, 1)
+	if err := vm.chain.AddLocalTxs([]*types.Transaction{localTx})[0]; err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range vm.chain.AddRemoteTxsSync([]*types.Transaction{remoteTx, queuedTx}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// And a local and a remote pending atomic tx
+	localAtomicTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAtomicTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[1], initialBaseFee, testKeys[1:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(localAtomicTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(remoteAtomicTx, false /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := vm.SnapshotMempool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The state of the mempools is reproduced by another VM
+	restoredVM := newVM()
+	results, err := restoredVM.LoadMempoolSnapshot(snapshot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected the results of 5 txs, found %v", results)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Fatalf("Failed to restore tx %s: %s", result.TxID, result.Error)
+		}
+	}
+	txPool, restoredTxPool := vm.chain.GetTxPool(), restoredVM.chain.GetTxPool()
+	if !txPool.HasLocal(localTx.Hash()) || txPool.HasLocal(remoteTx.Hash()) {
+		t.Fatal("Expected only the local eth tx to be tracked as local")
+	}
+	if pending, queued := restoredTxPool.Stats(); pending != 2 || queued != 1 {
+		t.Fatalf("Expected 2 pending and 1 queued eth txs, found %d and %d", pending, queued)
+	}
+	for _, tx := range []*types.Transaction{localTx, remoteTx, queuedTx} {
+		restored := restoredTxPool.Get(tx.Hash())
+		if restored == nil {
+			t.Fatalf("Expected eth tx %s to be restored", tx.Hash())
+		}
+		if restoredTxPool.HasLocal(tx.Hash()) != txPool.HasLocal(tx.Hash()) {
+			t.Fatalf("Expected the origin of eth tx %s to be restored", tx.Hash())
+		}
+		if seen := txPool.Get(tx.Hash()).FirstSeen(); !restored.FirstSeen().Equal(seen) {
+			t.Fatalf("Expected eth tx %s to be first seen at %v, found %v", tx.Hash(), seen, restored.FirstSeen())
+		}
+	}
+	pendingAtomicTxs := make(map[ids.ID]PendingTx)
+	for _, pendingTx := range vm.mempool.PendingTxs() {
+		pendingAtomicTxs[pendingTx.Tx.ID()] = pendingTx
+	}
+	restoredAtomicTxs := restoredVM.mempool.PendingTxs()
+	if len(restoredAtomicTxs) != 2 {
+		t.Fatalf("Expected 2 pending atomic txs, found %d", len(restoredAtomicTxs))
+	}
+	for _, restored := range restoredAtomicTxs {
+		pendingTx, ok := pendingAtomicTxs[restored.Tx.ID()]
+		if !ok || restored.Local != pendingTx.Local || !restored.FirstSeen.Equal(pendingTx.FirstSeen) {
+			t.Fatalf("Expected atomic tx %s to be restored as %+v, found %+v", restored.Tx.ID(), pendingTx, restored)
+		}
+	}
+	if !restoredVM.mempool.IsLocalTx(localAtomicTx.ID()) || restoredVM.mempool.IsLocalTx(remoteAtomicTx.ID()) {
+		t.Fatal("Expected the origin of the atomic txs to be restored")
+	}
+
+	// The remote eth txs below the price of another pool are only restored
+	// skipping the fee checks
+	pricedVM := newVM()
+	pricedVM.chain.GetTxPool().SetGasPrice(new(big.Int).Add(gasPrice, common.Big1))
+	results, err = pricedVM.LoadMempoolSnapshot(snapshot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		remote := result.TxID == remoteTx.Hash().Hex() || result.TxID == queuedTx.Hash().Hex()
+		if remote != strings.Contains(result.Error, core.ErrUnderpriced.Error()) {
+			t.Fatalf("Unexpected result %+v", result)
+		}
+	}
+	results, err = pricedVM.LoadMempoolSnapshot(snapshot, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results[:3] {
+		if result.Error != "" && result.Error != core.ErrAlreadyKnown.Error() {
+			t.Fatalf("Failed to restore tx %s skipping the fee checks: %s", result.TxID, result.Error)
+		}
+	}
+	if pending, queued := pricedVM.chain.GetTxPool().Stats(); pending != 2 || queued != 1 {
+		t.Fatalf("Expected 2 pending and 1 queued eth txs, found %d and %d", pending, queued)
+	}
+
+	if _, err := restoredVM.LoadMempoolSnapshot(snapshot[:len(snapshot)-1], false); err == nil {
+		t.Fatal("Expected a truncated snapshot to be refused")
+	}
+	if _, err := restoredVM.LoadMempoolSnapshot(append([]byte{0, 1}, snapshot[2:]...), false); err == nil {
+		t.Fatal("Expected a snapshot of an unknown version to be refused")
+	}
+}
@@ -13,13 +13,30 @@ import (
 const Version = uint16(0)
 const maxMessageSize = 1 * units.MiB
 
+// maxSnapshotSize is the maximum size of a [MempoolSnapshot], which is not
+// sent over the network.
+const maxSnapshotSize = 256 * units.MiB
+
 func BuildCodec() (codec.Manager, error) {
-	codecManager := codec.NewManager(maxMessageSize)
+	return buildCodec(maxMessageSize)
+}
+
+// BuildSnapshotCodec returns the message codec allowing the size of
+// [MempoolSnapshot]s.
+func BuildSnapshotCodec() (codec.Manager, error) {
+	return buildCodec(maxSnapshotSize)
+}
+
+func buildCodec(maxSize int) (codec.Manager, error) {
+	codecManager := codec.NewManager(maxSize)
 	c := linearcodec.NewDefault()
 	errs := wrappers.Errs{}
 	errs.Add(
 		c.RegisterType(&AtomicTx{}),
 		c.RegisterType(&EthTxs{}),
+		c.RegisterType(HeaderRequest{}),
+		c.RegisterType(HeaderResponse{}),
+		c.RegisterType(MempoolSnapshot{}),
 	)
 	errs.Add(codecManager.RegisterCodec(Version, c))
 	return codecManager, errs.Err
@@ -4,6 +4,9 @@
 package message
 
 import (
+	"context"
+	"errors"
+
 	"github.com/ethereum/go-ethereum/log"
 
 	"github.com/zsmartex/avalanchego/ids"
@@ -11,6 +14,11 @@ import (
 
 var _ GossipHandler = NoopMempoolGossipHandler{}
 
+// ErrMalformedPayload is returned, wrapped, by a GossipHandler when the payload
+// of a gossip message cannot be parsed. The message is dropped and counted as
+// a parse failure of the peer which sent it, instead of being fatal.
+var ErrMalformedPayload = errors.New("malformed gossip payload")
+
 // GossipHandler handles incoming gossip messages
 type GossipHandler interface {
 	HandleAtomicTx(nodeID ids.ShortID, msg *AtomicTx) error
@@ -36,6 +44,11 @@ func (NoopMempoolGossipHandler) HandleEthTxs(nodeID ids.ShortID, _ *EthTxs) erro
 // Also see GossipHandler for implementation style.
 type RequestHandler interface{}
 
+// HeaderRequestHandler is a RequestHandler serving accepted headers
+type HeaderRequestHandler interface {
+	HandleHeaderRequest(ctx context.Context, nodeID ids.ShortID, requestID uint32, request *HeaderRequest) ([]byte, error)
+}
+
 // ResponseHandler handles response for a sent request
 // Only one of OnResponse or OnFailure is called for a given requestID, not both
 type ResponseHandler interface {
@@ -0,0 +1,51 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package message
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/ids"
+)
+
+const (
+	// MaxHeadersPerResponse is the maximum number of headers served in a
+	// [HeaderResponse].
+	MaxHeadersPerResponse = 256
+	headerRequestType     = "header-request"
+)
+
+var _ Request = HeaderRequest{}
+
+// HeaderRequest is a request for [Count] consecutive accepted headers, starting
+// at the accepted header [Hash] if it is set, or at [Height] otherwise.
+type HeaderRequest struct {
+	Hash   common.Hash `serialize:"true"`
+	Height uint64      `serialize:"true"`
+	Count  uint16      `serialize:"true"`
+}
+
+func (r HeaderRequest) Handle(ctx context.Context, nodeID ids.ShortID, requestID uint32, handler RequestHandler) ([]byte, error) {
+	headerHandler, ok := handler.(HeaderRequestHandler)
+	if !ok {
+		log.Debug("dropping unexpected HeaderRequest", "peerID", nodeID, "requestID", requestID)
+		return nil, nil
+	}
+	return headerHandler.HandleHeaderRequest(ctx, nodeID, requestID, &r)
+}
+
+func (r HeaderRequest) Type() string {
+	return headerRequestType
+}
+
+// HeaderResponse is the response to a [HeaderRequest]. [Headers] are the RLP
+// encoded headers requested, in ascending height order, up to
+// [MaxHeadersPerResponse] headers. [Headers] stops at the last accepted header,
+// and is empty if the start header is not accepted.
+type HeaderResponse struct {
+	Headers [][]byte `serialize:"true"`
+}
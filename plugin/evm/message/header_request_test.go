@@ -0,0 +1,42 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package message
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	codec, err := BuildCodec()
+	assert.NoError(err)
+
+	request := HeaderRequest{
+		Hash:   common.Hash{1},
+		Height: 10,
+		Count:  MaxHeadersPerResponse,
+	}
+	requestBytes, err := RequestToBytes(codec, request)
+	assert.NoError(err)
+	parsedRequest, err := BytesToRequest(codec, requestBytes)
+	assert.NoError(err)
+	assert.Equal(request, parsedRequest)
+
+	// Header requests are not gossip messages
+	_, err = ParseMessage(codec, requestBytes)
+	assert.Error(err)
+
+	response := HeaderResponse{Headers: [][]byte{{1}, {2, 3}}}
+	responseBytes, err := codec.Marshal(Version, response)
+	assert.NoError(err)
+	var parsedResponse HeaderResponse
+	_, err = codec.Unmarshal(responseBytes, &parsedResponse)
+	assert.NoError(err)
+	assert.Equal(response, parsedResponse)
+}
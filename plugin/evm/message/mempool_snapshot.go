@@ -0,0 +1,27 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package message
+
+// MempoolSnapshot is the state of the eth tx pool and of the atomic mempool of
+// a node at a point in time, to be restored by another node. It is not sent
+// over the network.
+type MempoolSnapshot struct {
+	// EthTxs are the pending and queued eth txs, grouped by sender and sorted
+	// by nonce.
+	EthTxs []MempoolSnapshotTx `serialize:"true"`
+	// AtomicTxs are the atomic txs waiting to be issued into a block.
+	AtomicTxs []MempoolSnapshotTx `serialize:"true"`
+}
+
+// MempoolSnapshotTx is a tx of a [MempoolSnapshot].
+type MempoolSnapshotTx struct {
+	// Tx is the binary encoding of the tx.
+	Tx []byte `serialize:"true"`
+	// Local is true if the tx was issued by the node rather than received
+	// from a peer.
+	Local bool `serialize:"true"`
+	// FirstSeen is the time the tx was admitted to the mempool of the node,
+	// in nanoseconds since the Unix epoch.
+	FirstSeen int64 `serialize:"true"`
+}
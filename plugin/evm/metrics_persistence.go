@@ -0,0 +1,169 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/avalanchego/database"
+
+	"github.com/zsmartex/coreth/core/types"
+)
+
+var metricsPrefix = []byte("metrics")
+
+// counterSnapshotter persists the values of long-window counters across
+// restarts. It writes the registered counters to its database periodically
+// and on shutdown, and restores them as offsets when the database is opened,
+// so that the exported values remain monotonic.
+//
+// Counters may be registered before the database is opened, in which case
+// they are restored when it is.
+//
+// A nil [counterSnapshotter], when the persistence is disabled, registers
+// counters that are not persisted.
+type counterSnapshotter struct {
+	lock     sync.Mutex
+	db       database.Database
+	counters map[string]metrics.Counter
+}
+
+func newCounterSnapshotter() *counterSnapshotter {
+	return &counterSnapshotter{counters: make(map[string]metrics.Counter)}
+}
+
+// register returns a counter named [name], restored from the database if it
+// is open.
+func (s *counterSnapshotter) register(name string) metrics.Counter {
+	counter := metrics.NewRegisteredCounter(name, nil)
+	if s == nil {
+		return counter
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.counters[name] = counter
+	if s.db != nil {
+		s.restore(name, counter)
+	}
+	return counter
+}
+
+// open restores the registered counters from [db], which holds the counters
+// from then on.
+func (s *counterSnapshotter) open(db database.Database) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.db = db
+	for name, counter := range s.counters {
+		s.restore(name, counter)
+	}
+}
+
+// restore adds the persisted value of [name] to [counter]. Assumes [lock] is
+// held.
+func (s *counterSnapshotter) restore(name string, counter metrics.Counter) {
+	value, err := database.GetUInt64(s.db, []byte(name))
+	switch {
+	case err == database.ErrNotFound:
+	case err != nil:
+		log.Warn("Failed to restore counter", "name", name, "err", err)
+	default:
+		counter.Inc(int64(value))
+	}
+}
+
+// write persists the values of the registered counters.
+func (s *counterSnapshotter) write() error {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.db == nil {
+		return nil
+	}
+	batch := s.db.NewBatch()
+	for name, counter := range s.counters {
+		if err := database.PutUInt64(batch, []byte(name), uint64(counter.Count())); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// start writes the registered counters every [frequency] until [vm] shuts
+// down, and a final time at shutdown.
+func (s *counterSnapshotter) start(vm *VM, frequency time.Duration) {
+	if s == nil {
+		return
+	}
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(func() {
+		defer vm.shutdownWg.Done()
+
+		ticker := time.NewTicker(frequency)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.write(); err != nil {
+					log.Warn("Failed to persist counters", "err", err)
+				}
+			case <-vm.shutdownChan:
+				if err := s.write(); err != nil {
+					log.Warn("Failed to persist counters", "err", err)
+				}
+				return
+			}
+		}
+	})
+}
+
+// blockCounters are the long-window counters of the accepted blocks.
+type blockCounters struct {
+	txs        metrics.Counter // EVM transactions
+	atomicOps  metrics.Counter // Shared memory operations applied
+	feesBurned metrics.Counter // Fees of the EVM transactions, in nAVAX
+}
+
+func newBlockCounters(s *counterSnapshotter) *blockCounters {
+	return &blockCounters{
+		txs:        s.register("vm/accepted/txs"),
+		atomicOps:  s.register("vm/accepted/atomic/ops"),
+		feesBurned: s.register("vm/accepted/fees/burned"),
+	}
+}
+
+// accepted counts the transactions of [block] and the fees they paid, given
+// their [receipts].
+func (c *blockCounters) accepted(block *types.Block, receipts types.Receipts) {
+	txs := block.Transactions()
+	c.txs.Inc(int64(len(txs)))
+	if len(receipts) != len(txs) {
+		return
+	}
+	var (
+		baseFee = block.BaseFee()
+		fees    = new(big.Int)
+	)
+	for i, tx := range txs {
+		gasPrice := tx.GasPrice()
+		if baseFee != nil {
+			gasPrice = new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
+		}
+		fees.Add(fees, new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipts[i].GasUsed)))
+	}
+	c.feesBurned.Inc(new(big.Int).Div(fees, x2cRate).Int64())
+}
@@ -0,0 +1,127 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestCounterSnapshotter(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	db := memdb.New()
+	if err := database.PutUInt64(db, []byte("test/before"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.PutUInt64(db, []byte("test/after"), 20); err != nil {
+		t.Fatal(err)
+	}
+
+	// Counters registered before the database is opened are restored when it
+	// is, and those registered after it immediately
+	s := newCounterSnapshotter()
+	before := s.register("test/before")
+	before.Inc(1)
+	s.open(db)
+	after := s.register("test/after")
+	fresh := s.register("test/fresh")
+	if before.Count() != 11 || after.Count() != 20 || fresh.Count() != 0 {
+		t.Fatalf("Expected counters 11, 20 and 0, found %d, %d and %d", before.Count(), after.Count(), fresh.Count())
+	}
+
+	fresh.Inc(5)
+	if err := s.write(); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newCounterSnapshotter()
+	restarted.open(db)
+	for name, expected := range map[string]int64{"test/before": 11, "test/after": 20, "test/fresh": 5} {
+		if count := restarted.register(name).Count(); count != expected {
+			t.Fatalf("Expected %s to be restored to %d, found %d", name, expected, count)
+		}
+	}
+
+	// A nil snapshotter registers counters that are not persisted
+	var disabled *counterSnapshotter
+	disabled.open(db)
+	if counter := disabled.register("test/before"); counter.Count() != 0 {
+		t.Fatalf("Expected a counter that is not persisted, found %d", counter.Count())
+	}
+	if err := disabled.write(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockCountersRestart(t *testing.T) {
+	config := `{"metrics-persistence-enabled":true}`
+	issuer, vm, dbManager, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	sendTx := func(vm *VM, nonce uint64) {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sendTx(vm, 0)
+	buildAndAcceptBlock(t, issuer, vm)
+
+	counters := vm.blockCounters
+	if counters.txs.Count() != 1 || counters.atomicOps.Count() != 1 || counters.feesBurned.Count() != int64(params.TxGas)*gasPrice.Int64()/x2cRateInt64 {
+		t.Fatalf("Unexpected counters: %d txs, %d atomic ops and %d nAVAX burned", counters.txs.Count(), counters.atomicOps.Count(), counters.feesBurned.Count())
+	}
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The counters continue from their prior values after a restart
+	restartedVM := &VM{}
+	if err := restartedVM.Initialize(
+		NewContext(),
+		dbManager,
+		[]byte(genesisJSONApricotPhase5),
+		[]byte(""),
+		[]byte(config),
+		issuer,
+		[]*engCommon.Fx{},
+		nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := restartedVM.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	restarted := restartedVM.blockCounters
+	if restarted.txs.Count() != counters.txs.Count() || restarted.atomicOps.Count() != counters.atomicOps.Count() || restarted.feesBurned.Count() != counters.feesBurned.Count() {
+		t.Fatalf("Expected the counters to be restored, found %d txs, %d atomic ops and %d nAVAX burned", restarted.txs.Count(), restarted.atomicOps.Count(), restarted.feesBurned.Count())
+	}
+}
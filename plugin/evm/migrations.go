@@ -0,0 +1,326 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+const (
+	// migrationPolicyBlocking migrates the database before the VM starts, and
+	// migrationPolicyBackground while it runs if every pending migration
+	// leaves the database readable in the old format.
+	migrationPolicyBlocking   = "blocking"
+	migrationPolicyBackground = "background"
+
+	// migrationStepSize is the number of items visited by a migration step,
+	// whose writes are committed along with the progress of the migration.
+	migrationStepSize = 1024
+
+	// migrationThrottle is the pause between two steps of a migration running
+	// in the background, leaving room for block processing and API calls.
+	migrationThrottle = 10 * time.Millisecond
+)
+
+var (
+	// schemaVersionKey holds the version of the schema of the chain database,
+	// the number of migrations applied to it.
+	schemaVersionKey     = []byte("schema_version")
+	migrationProgressKey = []byte("migration_progress")
+
+	errSchemaTooNew = errors.New("database schema is newer than supported")
+
+	// migrations upgrade the chain database to the schema version of their
+	// index plus one, in order.
+	migrations = []migration{
+		{
+			name:       "tx-lookup-block-number",
+			background: true,
+			step:       migrateTxLookupEntries,
+		},
+	}
+)
+
+// migration rewrites the chain database from one encoding to the next, one
+// step at a time.
+type migration struct {
+	name string
+	// background tells whether the data not migrated yet is served while the
+	// migration runs.
+	background bool
+	// step migrates the items from [cursor], adding its writes to [batch],
+	// and returns the cursor of the next step, or nil once done, and the
+	// number of items migrated.
+	step func(db ethdb.Database, batch ethdb.Batch, cursor []byte) ([]byte, int, error)
+}
+
+// migrateTxLookupEntries rewrites the tx lookup entries storing a block hash
+// or a legacy RLP entry to the block number.
+func migrateTxLookupEntries(db ethdb.Database, batch ethdb.Batch, cursor []byte) ([]byte, int, error) {
+	return rawdb.MigrateLegacyTxLookupEntries(db, batch, cursor, migrationStepSize)
+}
+
+// migrationProgress is stored in the chain database with the writes of the
+// last step, so that an interrupted migration resumes after it.
+type migrationProgress struct {
+	// Version is the schema version the migration upgrades to.
+	Version  uint64 `json:"version"`
+	Cursor   []byte `json:"cursor"`
+	Migrated uint64 `json:"migrated"`
+}
+
+// migrator applies the pending migrations to the chain database.
+type migrator struct {
+	db         ethdb.Database
+	migrations []migration
+
+	// [lock] guards the fields below, which are only written by the
+	// goroutine running the migrations.
+	lock     sync.Mutex
+	version  uint64
+	progress *migrationProgress
+	running  bool
+	err      error
+}
+
+// newMigrator returns the migrator of [db], refusing a database with a schema
+// newer than [migrations]. A [fresh] database is marked as migrated.
+func newMigrator(db ethdb.Database, migrations []migration, fresh bool) (*migrator, error) {
+	m := &migrator{db: db, migrations: migrations}
+	latest := uint64(len(migrations))
+	has, err := db.Has(schemaVersionKey)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case has:
+		blob, err := db.Get(schemaVersionKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(blob) != 8 {
+			return nil, fmt.Errorf("invalid schema version %x", blob)
+		}
+		m.version = binary.BigEndian.Uint64(blob)
+	case fresh:
+		if err := writeSchemaVersion(db, latest); err != nil {
+			return nil, err
+		}
+		m.version = latest
+	}
+	if m.version > latest {
+		return nil, fmt.Errorf("%w: found version %d, supporting up to %d", errSchemaTooNew, m.version, latest)
+	}
+
+	has, err = db.Has(migrationProgressKey)
+	if err != nil || !has {
+		return m, err
+	}
+	blob, err := db.Get(migrationProgressKey)
+	if err != nil {
+		return nil, err
+	}
+	progress := new(migrationProgress)
+	if err := json.Unmarshal(blob, progress); err != nil {
+		return nil, err
+	}
+	// The progress of a migration applied since is stale
+	if progress.Version == m.version+1 {
+		m.progress = progress
+	}
+	return m, nil
+}
+
+func writeSchemaVersion(db ethdb.KeyValueWriter, version uint64) error {
+	blob := make([]byte, 8)
+	binary.BigEndian.PutUint64(blob, version)
+	return db.Put(schemaVersionKey, blob)
+}
+
+// pending returns the migrations not applied yet.
+func (m *migrator) pending() []migration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.migrations[m.version:]
+}
+
+// background returns whether the pending migrations may run while the VM
+// serves the data not migrated yet.
+func (m *migrator) background() bool {
+	for _, migration := range m.pending() {
+		if !migration.background {
+			return false
+		}
+	}
+	return true
+}
+
+// run applies the pending migrations, pausing for [throttle] between two
+// steps. It returns early without an error once [quit] is closed, leaving the
+// current migration to be resumed.
+func (m *migrator) run(quit <-chan struct{}, throttle time.Duration) error {
+	m.lock.Lock()
+	m.running = true
+	m.err = nil
+	m.lock.Unlock()
+
+	err := m.migrate(quit, throttle)
+
+	m.lock.Lock()
+	m.running = false
+	m.err = err
+	m.lock.Unlock()
+	return err
+}
+
+func (m *migrator) migrate(quit <-chan struct{}, throttle time.Duration) error {
+	for _, migration := range m.pending() {
+		m.lock.Lock()
+		progress := m.progress
+		if progress == nil || progress.Version != m.version+1 {
+			progress = &migrationProgress{Version: m.version + 1}
+		}
+		m.lock.Unlock()
+
+		start := time.Now()
+		log.Info("Migrating the chain database", "migration", migration.name, "version", progress.Version, "migrated", progress.Migrated)
+		for {
+			select {
+			case <-quit:
+				log.Info("Interrupted the migration of the chain database", "migration", migration.name, "migrated", progress.Migrated)
+				return nil
+			default:
+			}
+			if throttle > 0 {
+				select {
+				case <-quit:
+					continue
+				case <-time.After(throttle):
+				}
+			}
+
+			batch := m.db.NewBatch()
+			cursor, migrated, err := migration.step(m.db, batch, progress.Cursor)
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration.name, err)
+			}
+			next := &migrationProgress{Version: progress.Version, Cursor: cursor, Migrated: progress.Migrated + uint64(migrated)}
+			if cursor == nil {
+				err = writeSchemaVersion(batch, next.Version)
+				if err == nil {
+					err = batch.Delete(migrationProgressKey)
+				}
+			} else {
+				err = writeMigrationProgress(batch, next)
+			}
+			if err == nil {
+				err = batch.Write()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write the progress of migration %s: %w", migration.name, err)
+			}
+
+			m.lock.Lock()
+			progress = next
+			m.progress = next
+			if cursor == nil {
+				m.version = next.Version
+			}
+			m.lock.Unlock()
+			if cursor == nil {
+				break
+			}
+		}
+		log.Info("Migrated the chain database", "migration", migration.name, "version", progress.Version, "migrated", progress.Migrated, "elapsed", time.Since(start))
+	}
+	return nil
+}
+
+func writeMigrationProgress(db ethdb.KeyValueWriter, progress *migrationProgress) error {
+	blob, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return db.Put(migrationProgressKey, blob)
+}
+
+// migrationStatus is the status of a migration of the chain database.
+type migrationStatus struct {
+	name       string
+	version    uint64
+	background bool
+	// state is "done", "running", "pending" or "failed".
+	state    string
+	migrated uint64
+	err      error
+}
+
+// status returns the schema version of the database and the status of every
+// migration.
+func (m *migrator) status() (uint64, []migrationStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	statuses := make([]migrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status := migrationStatus{
+			name:       migration.name,
+			version:    uint64(i + 1),
+			background: migration.background,
+		}
+		switch {
+		case status.version <= m.version:
+			status.state = "done"
+		case status.version == m.version+1 && m.running:
+			status.state = "running"
+		case status.version == m.version+1 && m.err != nil:
+			status.state = "failed"
+			status.err = m.err
+		default:
+			status.state = "pending"
+		}
+		if m.progress != nil && m.progress.Version == status.version {
+			status.migrated = m.progress.Migrated
+		}
+		statuses[i] = status
+	}
+	return m.version, statuses
+}
+
+// startMigrations applies the pending migrations of the chain database per
+// [policy], either before returning or in the background until the VM shuts
+// down.
+func (vm *VM) startMigrations(policy string) error {
+	pending := len(vm.migrator.pending())
+	if pending == 0 {
+		return nil
+	}
+	if policy != migrationPolicyBackground || !vm.migrator.background() {
+		if policy == migrationPolicyBackground {
+			log.Warn("Migrating the chain database before starting, as a pending migration does not serve the old format")
+		}
+		return vm.migrator.run(nil, 0)
+	}
+
+	log.Info("Migrating the chain database in the background", "pending", pending)
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		if err := vm.migrator.run(vm.shutdownChan, migrationThrottle); err != nil {
+			log.Error("Failed to migrate the chain database", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,249 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/database/prefixdb"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+)
+
+// countingMigration returns a migration writing the items 0 to [items] - 1 in
+// steps of [stepSize], recording the cursor of each step in [cursors] and
+// calling [onStep] after each step, if set.
+func countingMigration(name string, items, stepSize uint64, cursors *[]uint64, onStep func(step int) error) migration {
+	return migration{
+		name:       name,
+		background: true,
+		step: func(db ethdb.Database, batch ethdb.Batch, cursor []byte) ([]byte, int, error) {
+			var from uint64
+			if cursor != nil {
+				from = binary.BigEndian.Uint64(cursor)
+			}
+			*cursors = append(*cursors, from)
+			if onStep != nil {
+				if err := onStep(len(*cursors)); err != nil {
+					return nil, 0, err
+				}
+			}
+			to := from + stepSize
+			if to > items {
+				to = items
+			}
+			for i := from; i < to; i++ {
+				if err := batch.Put([]byte(fmt.Sprintf("%s-%d", name, i)), nil); err != nil {
+					return nil, 0, err
+				}
+			}
+			if to == items {
+				return nil, int(to - from), nil
+			}
+			next := make([]byte, 8)
+			binary.BigEndian.PutUint64(next, to)
+			return next, int(to - from), nil
+		},
+	}
+}
+
+func TestMigratorResume(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+
+	// Interrupt the first migration after its second step, and fail it at
+	// its fourth
+	var cursors []uint64
+	quit := make(chan struct{})
+	errStep := errors.New("step failed")
+	testMigrations := []migration{
+		countingMigration("first", 10, 3, &cursors, func(step int) error {
+			switch step {
+			case 2:
+				close(quit)
+			case 4:
+				return errStep
+			}
+			return nil
+		}),
+		countingMigration("second", 2, 3, &cursors, nil),
+	}
+	m, err := newMigrator(db, testMigrations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.run(quit, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(cursors) != 2 {
+		t.Fatalf("Expected the migration to stop after 2 steps, found %d", len(cursors))
+	}
+
+	// The migration resumes after the last step committed
+	m, err = newMigrator(db, testMigrations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, statuses := m.status()
+	if version != 0 || statuses[0].state != "pending" || statuses[0].migrated != 6 {
+		t.Fatalf("Expected the first migration to be pending with 6 items migrated at version 0, found %+v at version %d", statuses[0], version)
+	}
+	if err := m.run(nil, 0); !errors.Is(err, errStep) {
+		t.Fatalf("Expected the migration to fail with %q, found %v", errStep, err)
+	}
+	if _, statuses = m.status(); statuses[0].state != "failed" || !errors.Is(statuses[0].err, errStep) {
+		t.Fatalf("Expected the first migration to fail, found %+v", statuses[0])
+	}
+	if err := m.run(nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every item is written, and only the failed step is run again
+	if expected := []uint64{0, 3, 6, 9, 9, 0}; fmt.Sprint(cursors) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the steps to start from %v, found %v", expected, cursors)
+	}
+	for name, items := range map[string]int{"first": 10, "second": 2} {
+		for i := 0; i < items; i++ {
+			if has, err := db.Has([]byte(fmt.Sprintf("%s-%d", name, i))); err != nil || !has {
+				t.Fatalf("Expected item %d of migration %s to be written, found %v (%v)", i, name, has, err)
+			}
+		}
+	}
+	version, statuses = m.status()
+	if version != 2 || statuses[0].state != "done" || statuses[1].state != "done" || statuses[1].migrated != 2 {
+		t.Fatalf("Expected both migrations to be done at version 2, found %+v at version %d", statuses, version)
+	}
+	if has, err := db.Has(migrationProgressKey); err != nil || has {
+		t.Fatalf("Expected the progress to be deleted, found %v (%v)", has, err)
+	}
+
+	// The migrations are not run again
+	m, err = newMigrator(db, testMigrations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := m.pending(); len(pending) != 0 {
+		t.Fatalf("Expected no pending migration, found %d", len(pending))
+	}
+}
+
+func TestMigratorSchemaVersion(t *testing.T) {
+	var cursors []uint64
+	testMigrations := []migration{countingMigration("only", 1, 1, &cursors, nil)}
+
+	// A fresh database has the latest schema
+	db := rawdb.NewMemoryDatabase()
+	m, err := newMigrator(db, testMigrations, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := m.pending(); len(pending) != 0 {
+		t.Fatalf("Expected a fresh database to have no pending migration, found %d", len(pending))
+	}
+
+	// A database with a newer schema is refused
+	if err := writeSchemaVersion(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newMigrator(db, testMigrations, false); !errors.Is(err, errSchemaTooNew) {
+		t.Fatalf("Expected a newer schema to be refused, found %v", err)
+	}
+}
+
+// TestTxLookupMigration migrates a tx lookup entry storing the block hash when
+// the VM restarts, and refuses to restart on a newer schema.
+func TestTxLookupMigration(t *testing.T) {
+	issuer, vm, dbManager, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	tx, err := types.SignTx(types.NewTransaction(0, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+		t.Fatal(err)
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	vm.chain.BlockChain().WaitAcceptedIndices(blk.Height())
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Downgrade the entry of the tx to the format of database v4-v5, under
+	// the tx lookup prefix of rawdb. The chain database is closed with the VM.
+	chaindb := Database{prefixdb.NewNested(ethDBPrefix, dbManager.Current().Database)}
+	lookupKey := append([]byte("l"), tx.Hash().Bytes()...)
+	if err := chaindb.Put(lookupKey, common.Hash(blk.ID()).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSchemaVersion(chaindb, 0); err != nil {
+		t.Fatal(err)
+	}
+	restart := func(config string) (*VM, error) {
+		restartedVM := &VM{}
+		return restartedVM, restartedVM.Initialize(
+			NewContext(),
+			dbManager,
+			[]byte(genesisJSONApricotPhase5),
+			[]byte(""),
+			[]byte(config),
+			issuer,
+			[]*engCommon.Fx{},
+			nil,
+		)
+	}
+	// The migration serves the old format, so it runs in the background
+	restartedVM, err := restart(`{"migration-policy":"background"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); len(restartedVM.migrator.pending()) != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("The migration did not complete")
+		}
+	}
+	if entry, err := restartedVM.chaindb.Get(lookupKey); err != nil || new(big.Int).SetBytes(entry).Uint64() != blk.Height() {
+		t.Fatalf("Expected the entry to store height %d, found %x (%v)", blk.Height(), entry, err)
+	}
+	if _, hash, number, _ := rawdb.ReadTransaction(restartedVM.chaindb, tx.Hash()); hash != common.Hash(blk.ID()) || number != blk.Height() {
+		t.Fatalf("Expected tx %s in block %d, found %x/%d", tx.Hash(), blk.Height(), hash, number)
+	}
+	reply := &MigrationStatusReply{}
+	if err := NewAdminService(restartedVM, "").MigrationStatus(nil, nil, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.SchemaVersion != reply.LatestVersion || len(reply.Migrations) != len(migrations) || reply.Migrations[0].State != "done" || reply.Migrations[0].Migrated != 1 {
+		t.Fatalf("Expected the tx lookup migration to be done with 1 entry migrated, found %+v", reply)
+	}
+
+	// A schema written by a newer version is refused
+	if err := writeSchemaVersion(restartedVM.chaindb, uint64(len(migrations))+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := restartedVM.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restart(""); !errors.Is(err, errSchemaTooNew) {
+		t.Fatalf("Expected the VM to refuse a newer schema, found %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/internal/ethapi"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestMulticall(t *testing.T) {
+	_, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, `{"rpc-gas-cap":200000}`, "", nil)
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-blockchain"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	var (
+		// Increments slot 0 and returns its new value
+		counter = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		// Returns the block number and timestamp
+		blockInfo = common.HexToAddress("0x1000000000000000000000000000000000000002")
+		// Reverts
+		reverter  = common.HexToAddress("0x1000000000000000000000000000000000000003")
+		overrides = map[common.Address]map[string]interface{}{
+			counter:   {"code": hexutil.Bytes(common.FromHex("0x6000546001018060005560005260206000f3"))},
+			blockInfo: {"code": hexutil.Bytes(common.FromHex("0x436000524260205260406000f3"))},
+			reverter:  {"code": hexutil.Bytes(common.FromHex("0x60006000fd"))},
+		}
+		gas   = hexutil.Uint64(50000)
+		calls = []ethapi.TransactionArgs{
+			{To: &counter, Gas: &gas},
+			{To: &counter, Gas: &gas},
+			{To: &blockInfo, Gas: &gas},
+			{To: &reverter, Gas: &gas},
+		}
+	)
+	var results []ethapi.MulticallResult
+	if err := client.Call(&results, "eth_multicall", calls, "latest", overrides); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("Expected %d results, found %d", len(calls), len(results))
+	}
+
+	// Compare against individual calls
+	for i, args := range calls[:3] {
+		var ret hexutil.Bytes
+		if err := client.Call(&ret, "eth_call", args, "latest", overrides); err != nil {
+			t.Fatal(err)
+		}
+		if results[i].Error != "" || !bytes.Equal(results[i].ReturnData, ret) || results[i].GasUsed == 0 {
+			t.Fatalf("Expected call %d to return %s, found %+v", i, ret, results[i])
+		}
+	}
+	// The state write of the first call is not seen by the second one
+	if one := common.BigToHash(common.Big1).Bytes(); !bytes.Equal(results[1].ReturnData, one) {
+		t.Fatalf("Expected the second call to return %x, found %x", one, results[1].ReturnData)
+	}
+	if !strings.HasPrefix(results[3].Error, "execution reverted") {
+		t.Fatalf("Expected the last call to revert, found %+v", results[3])
+	}
+
+	// The block context is the same for all calls of a batch
+	results = nil
+	if err := client.Call(&results, "eth_multicall", []ethapi.TransactionArgs{calls[2], calls[2]}, "pending", overrides); err != nil {
+		t.Fatal(err)
+	}
+	if len(results[0].ReturnData) != 64 || !bytes.Equal(results[0].ReturnData, results[1].ReturnData) {
+		t.Fatalf("Expected the same block context for all calls, found %x and %x", results[0].ReturnData, results[1].ReturnData)
+	}
+
+	// The calls share the gas cap
+	calls = []ethapi.TransactionArgs{{To: &counter}, {To: &counter}, {To: &counter}, {To: &counter}, {To: &counter}}
+	results = nil
+	if err := client.Call(&results, "eth_multicall", calls, "latest", overrides); err != nil {
+		t.Fatal(err)
+	}
+	gasUsed := uint64(0)
+	for _, result := range results {
+		gasUsed += uint64(result.GasUsed)
+	}
+	if results[3].Error != "" || results[4].Error == "" || gasUsed != vm.config.RPCGasCap {
+		t.Fatalf("Expected the calls to be bounded by the gas cap, found %+v", results)
+	}
+
+	// The number of calls is bounded
+	calls = make([]ethapi.TransactionArgs, 257)
+	if err := client.Call(&results, "eth_multicall", calls, "latest", overrides); err == nil {
+		t.Fatal("Expected too many calls to fail")
+	}
+}
@@ -0,0 +1,300 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+const (
+	// [nonceReservationSweepInterval] is how often the expired reservations
+	// are reclaimed.
+	nonceReservationSweepInterval = 10 * time.Second
+
+	// [nonceReservationMaxPerAddress] is the maximum number of reservations
+	// held at once for an address.
+	nonceReservationMaxPerAddress = 1024
+)
+
+var (
+	nonceReservationsPrefix = []byte("nonce_reservations")
+
+	errNonceNotReserved     = errors.New("nonce is not reserved")
+	errTooManyReservations  = fmt.Errorf("address holds the maximum of %d reserved nonces", nonceReservationMaxPerAddress)
+	errNonceReservationsOff = errors.New("nonce reservations are disabled")
+)
+
+// nonceReserver hands out the nonces of the senders sharing an account, so
+// that the transactions they submit through the node form a gapless sequence.
+// A reserved nonce is held until a transaction with it is submitted, it is
+// released, or its TTL expires, in which case it is handed out again.
+//
+// The reservations are written to [db] as they are made, so that they are kept
+// across restarts within their TTL.
+type nonceReserver struct {
+	lock sync.Mutex
+
+	db     database.Database
+	txPool *core.TxPool
+	chain  *core.BlockChain
+	signer types.Signer
+	ttl    time.Duration
+	clock  mockable.Clock
+
+	// [reservations] is the expiry of each reserved nonce of each address.
+	reservations map[common.Address]map[uint64]time.Time
+}
+
+// newNonceReserver returns a reserver of the nonces of the accounts of [vm],
+// restoring the reservations held in [db].
+func (vm *VM) newNonceReserver(db database.Database) (*nonceReserver, error) {
+	r := &nonceReserver{
+		db:           db,
+		txPool:       vm.chain.GetTxPool(),
+		chain:        vm.chain.BlockChain(),
+		signer:       types.LatestSigner(vm.chainConfig),
+		ttl:          vm.config.NonceReservationTTL.Duration,
+		reservations: make(map[common.Address]map[uint64]time.Time),
+	}
+	if err := r.restore(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func nonceReservationKey(addr common.Address, nonce uint64) []byte {
+	key := make([]byte, common.AddressLength+8)
+	copy(key, addr[:])
+	binary.BigEndian.PutUint64(key[common.AddressLength:], nonce)
+	return key
+}
+
+// restore loads the reservations from the database. The expired reservations
+// are reclaimed by the next sweep.
+func (r *nonceReserver) restore() error {
+	it := r.db.NewIterator()
+	defer it.Release()
+
+	restored := 0
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.AddressLength+8 || len(it.Value()) != 8 {
+			return fmt.Errorf("malformed nonce reservation %x", key)
+		}
+		addr := common.BytesToAddress(key[:common.AddressLength])
+		nonce := binary.BigEndian.Uint64(key[common.AddressLength:])
+		expiry := time.Unix(0, int64(binary.BigEndian.Uint64(it.Value())))
+		if r.reservations[addr] == nil {
+			r.reservations[addr] = make(map[uint64]time.Time)
+		}
+		r.reservations[addr][nonce] = expiry
+		restored++
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if restored > 0 {
+		log.Info("Restored nonce reservations", "reservations", restored)
+	}
+	return nil
+}
+
+// start consumes the reservations of the transactions added to the tx pool and
+// reclaims the expired ones every [nonceReservationSweepInterval], until
+// [shutdownChan] is closed.
+func (r *nonceReserver) start(vm *VM) {
+	txsCh := make(chan core.NewTxsEvent, 16)
+	sub := r.txPool.SubscribeNewTxsEvent(txsCh)
+
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(func() {
+		defer vm.shutdownWg.Done()
+		defer sub.Unsubscribe()
+
+		ticker := time.NewTicker(nonceReservationSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev := <-txsCh:
+				r.consume(ev.Txs)
+			case <-ticker.C:
+				r.sweep()
+			case <-vm.shutdownChan:
+				return
+			}
+		}
+	})
+}
+
+// reserve returns the lowest nonce of [addr] that is not used by an accepted
+// transaction, a transaction in the tx pool or another reservation, and
+// reserves it for the TTL.
+func (r *nonceReserver) reserve(addr common.Address) (uint64, error) {
+	// The nonces in use are read while holding [lock], so that a nonce
+	// consumed by a concurrent submission is not handed out again
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	base, err := r.nextNonce(addr)
+	if err != nil {
+		return 0, err
+	}
+	pending, queued := r.txPool.ContentFrom(addr)
+	pooled := make(map[uint64]struct{}, len(pending)+len(queued))
+	for _, txs := range []types.Transactions{pending, queued} {
+		for _, tx := range txs {
+			pooled[tx.Nonce()] = struct{}{}
+		}
+	}
+
+	// The reservations below the next nonce or of pooled txs are consumed
+	now := r.clock.Time()
+	reserved := r.reservations[addr]
+	for nonce, expiry := range reserved {
+		if _, ok := pooled[nonce]; ok || nonce < base || now.After(expiry) {
+			if err := r.remove(addr, nonce); err != nil {
+				return 0, err
+			}
+		}
+	}
+	reserved = r.reservations[addr]
+	if len(reserved) >= nonceReservationMaxPerAddress {
+		return 0, errTooManyReservations
+	}
+
+	nonce := base
+	for {
+		_, isPooled := pooled[nonce]
+		_, isReserved := reserved[nonce]
+		if !isPooled && !isReserved {
+			break
+		}
+		nonce++
+	}
+	expiry := now.Add(r.ttl)
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(expiry.UnixNano()))
+	if err := r.db.Put(nonceReservationKey(addr, nonce), value); err != nil {
+		return 0, err
+	}
+	if reserved == nil {
+		reserved = make(map[uint64]time.Time)
+		r.reservations[addr] = reserved
+	}
+	reserved[nonce] = expiry
+	return nonce, nil
+}
+
+// nextNonce returns the maximum of the nonce of [addr] in the last accepted
+// state and its pending nonce in the tx pool.
+func (r *nonceReserver) nextNonce(addr common.Address) (uint64, error) {
+	statedb, err := r.chain.StateAt(r.chain.LastAcceptedBlock().Root())
+	if err != nil {
+		return 0, err
+	}
+	nonce := statedb.GetNonce(addr)
+	if pending := r.txPool.Nonce(addr); pending > nonce {
+		nonce = pending
+	}
+	return nonce, nil
+}
+
+// release frees the reservation of [nonce] of [addr].
+func (r *nonceReserver) release(addr common.Address, nonce uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.reservations[addr][nonce]; !ok {
+		return errNonceNotReserved
+	}
+	return r.remove(addr, nonce)
+}
+
+// consume removes the reservations of the nonces of [txs].
+func (r *nonceReserver) consume(txs []*types.Transaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, tx := range txs {
+		from, err := types.Sender(r.signer, tx)
+		if err != nil {
+			continue
+		}
+		if _, ok := r.reservations[from][tx.Nonce()]; !ok {
+			continue
+		}
+		if err := r.remove(from, tx.Nonce()); err != nil {
+			log.Warn("Failed to remove consumed nonce reservation", "address", from, "nonce", tx.Nonce(), "err", err)
+		}
+	}
+}
+
+// sweep reclaims the expired reservations.
+func (r *nonceReserver) sweep() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock.Time()
+	for addr, reserved := range r.reservations {
+		for nonce, expiry := range reserved {
+			if !now.After(expiry) {
+				continue
+			}
+			if err := r.remove(addr, nonce); err != nil {
+				log.Warn("Failed to remove expired nonce reservation", "address", addr, "nonce", nonce, "err", err)
+				return
+			}
+			log.Debug("Reclaimed expired nonce reservation", "address", addr, "nonce", nonce)
+		}
+	}
+}
+
+// remove deletes the reservation of [nonce] of [addr]. Assumes [lock] is held.
+func (r *nonceReserver) remove(addr common.Address, nonce uint64) error {
+	if err := r.db.Delete(nonceReservationKey(addr, nonce)); err != nil {
+		return err
+	}
+	delete(r.reservations[addr], nonce)
+	if len(r.reservations[addr]) == 0 {
+		delete(r.reservations, addr)
+	}
+	return nil
+}
+
+// NonceReservationAPI serves the nonce reservations in the eth namespace.
+type NonceReservationAPI struct{ vm *VM }
+
+// ReserveNonce returns the next unreserved nonce of [address] and reserves it
+// until a transaction with it is submitted, it is released, or it expires.
+func (api *NonceReservationAPI) ReserveNonce(ctx context.Context, address common.Address) (hexutil.Uint64, error) {
+	if api.vm.nonceReserver == nil {
+		return 0, errNonceReservationsOff
+	}
+	nonce, err := api.vm.nonceReserver.reserve(address)
+	return hexutil.Uint64(nonce), err
+}
+
+// ReleaseNonce frees the reservation of [nonce] of [address], so that it is
+// handed out again.
+func (api *NonceReservationAPI) ReleaseNonce(ctx context.Context, address common.Address, nonce hexutil.Uint64) error {
+	if api.vm.nonceReserver == nil {
+		return errNonceReservationsOff
+	}
+	return api.vm.nonceReserver.release(address, uint64(nonce))
+}
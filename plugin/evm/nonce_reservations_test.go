@@ -0,0 +1,188 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestNonceReservationsConcurrent(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, `{"nonce-reservations-enabled":true}`, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+
+	// Three senders share the account, each releasing one of its
+	// reservations as if it failed to build the transaction
+	const (
+		reservers         = 3
+		txsPerReserver    = 5
+		releasedIteration = 2
+	)
+	var (
+		signer   = types.NewEIP155Signer(vm.chainID)
+		gasPrice = new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+		lock     sync.Mutex
+		sent     []uint64
+		wg       sync.WaitGroup
+		errs     = make(chan error, reservers)
+	)
+	for i := 0; i < reservers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < txsPerReserver+1; j++ {
+				var nonce hexutil.Uint64
+				if err := client.Call(&nonce, "eth_reserveNonce", testEthAddrs[0]); err != nil {
+					errs <- err
+					return
+				}
+				if j == releasedIteration {
+					if err := client.Call(nil, "eth_releaseNonce", testEthAddrs[0], nonce); err != nil {
+						errs <- err
+						return
+					}
+					continue
+				}
+				tx, err := types.SignTx(types.NewTransaction(uint64(nonce), testEthAddrs[1], common.Big1, params.TxGas, gasPrice, nil), signer, testKeys[0].ToECDSA())
+				if err != nil {
+					errs <- err
+					return
+				}
+				raw, err := tx.MarshalBinary()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := client.Call(nil, "eth_sendRawTransaction", hexutil.Bytes(raw)); err != nil {
+					errs <- err
+					return
+				}
+				lock.Lock()
+				sent = append(sent, uint64(nonce))
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// The submitted nonces form a gapless sequence without collisions
+	sort.Slice(sent, func(i, j int) bool { return sent[i] < sent[j] })
+	for i, nonce := range sent {
+		if nonce != uint64(i) {
+			t.Fatalf("Expected nonce %d at index %d of the submitted nonces, found %v", i, i, sent)
+		}
+	}
+	total := uint64(reservers * txsPerReserver)
+	if uint64(len(sent)) != total {
+		t.Fatalf("Expected %d submitted txs, found %d", total, len(sent))
+	}
+
+	// All of them are accepted, and the next reservation follows them
+	buildAndAcceptBlock(t, issuer, vm)
+	statedb, err := vm.chain.BlockChain().StateAt(vm.chain.LastAcceptedBlock().Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce := statedb.GetNonce(testEthAddrs[0]); nonce != total {
+		t.Fatalf("Expected the accepted nonce to be %d, found %d", total, nonce)
+	}
+	var next hexutil.Uint64
+	if err := client.Call(&next, "eth_reserveNonce", testEthAddrs[0]); err != nil || uint64(next) != total {
+		t.Fatalf("Expected the next reservation to be %d, found %d (%v)", total, next, err)
+	}
+}
+
+func TestNonceReservationsRestart(t *testing.T) {
+	config := `{"nonce-reservations-enabled":true,"nonce-reservation-ttl":"1m"}`
+	issuer, vm, dbManager, _, _ := GenesisVM(t, true, genesisJSONApricotPhase5, config, "")
+	addr := testEthAddrs[1]
+	for expected := uint64(0); expected < 3; expected++ {
+		if nonce, err := vm.nonceReserver.reserve(addr); err != nil || nonce != expected {
+			t.Fatalf("Expected to reserve nonce %d, found %d (%v)", expected, nonce, err)
+		}
+	}
+	if err := vm.nonceReserver.release(addr, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.nonceReserver.release(addr, 1); !errors.Is(err, errNonceNotReserved) {
+		t.Fatalf("Expected a released nonce to no longer be reserved, found %v", err)
+	}
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reservations are kept across the restart
+	restartedVM := &VM{}
+	if err := restartedVM.Initialize(
+		NewContext(),
+		dbManager,
+		[]byte(genesisJSONApricotPhase5),
+		[]byte(""),
+		[]byte(config),
+		issuer,
+		[]*engCommon.Fx{},
+		nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := restartedVM.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	reserver := restartedVM.nonceReserver
+	for _, expected := range []uint64{1, 3} {
+		if nonce, err := reserver.reserve(addr); err != nil || nonce != expected {
+			t.Fatalf("Expected to reserve nonce %d after the restart, found %d (%v)", expected, nonce, err)
+		}
+	}
+
+	// The expired reservations are reclaimed
+	reserver.clock.Set(time.Now().Add(2 * time.Minute))
+	reserver.sweep()
+	if len(reserver.reservations) != 0 {
+		t.Fatalf("Expected the expired reservations to be reclaimed, found %v", reserver.reservations)
+	}
+	if nonce, err := reserver.reserve(addr); err != nil || nonce != 0 {
+		t.Fatalf("Expected to reserve nonce 0 once expired, found %d (%v)", nonce, err)
+	}
+}
@@ -0,0 +1,112 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/internal/ethapi"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestPendingTransactionOutlook(t *testing.T) {
+	importAmount := uint64(500000000)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase3, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+		testShortIDAddrs[1]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[i], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		buildAndAcceptBlock(t, issuer, vm)
+	}
+
+	signer := types.NewEIP155Signer(vm.chainID)
+	send := func(key int, nonce uint64, gasPrice *big.Int) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], common.Big1, params.TxGas, gasPrice, nil), signer, testKeys[key].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	var (
+		next      = send(0, 0, big.NewInt(params.LaunchMinGasPrice))
+		pricedOut = send(1, 0, big.NewInt(params.ApricotPhase3MinBaseFee+1))
+		gapped    = send(0, 2, big.NewInt(params.LaunchMinGasPrice))
+	)
+
+	// Build the tentative block, without accepting it
+	<-issuer
+	blk, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+	outlook := func(tx *types.Transaction) *ethapi.PendingTransactionOutlook {
+		var outlook *ethapi.PendingTransactionOutlook
+		if err := client.Call(&outlook, "eth_getPendingTransactionOutlook", tx.Hash()); err != nil {
+			t.Fatal(err)
+		}
+		if outlook == nil {
+			t.Fatalf("Expected an outlook for tx %s", tx.Hash())
+		}
+		return outlook
+	}
+
+	included := outlook(next)
+	if !included.Executable || included.NoncePosition != 0 || !included.CoversBaseFee || !included.CoversForecastBaseFee ||
+		included.Ahead == nil || *included.Ahead != 0 || included.TipPercentile != 100 ||
+		!included.InTentativeBlock || included.TentativeBlockNumber.ToInt().Uint64() != blk.Height() {
+		t.Fatalf("Expected tx %s to be included in the next block, found %+v", next.Hash(), included)
+	}
+
+	priced := outlook(pricedOut)
+	if !priced.Executable || priced.CoversBaseFee || priced.Ahead != nil || priced.TipPercentile != 0 || priced.InTentativeBlock {
+		t.Fatalf("Expected tx %s to be priced out, found %+v", pricedOut.Hash(), priced)
+	}
+	if priced.BaseFee.ToInt().Cmp(pricedOut.GasFeeCap()) <= 0 {
+		t.Fatalf("Expected the base fee %d to exceed the fee cap %d", priced.BaseFee.ToInt(), pricedOut.GasFeeCap())
+	}
+
+	blocked := outlook(gapped)
+	if blocked.Executable || blocked.NoncePosition != 1 || !blocked.CoversBaseFee || blocked.Ahead != nil || blocked.InTentativeBlock {
+		t.Fatalf("Expected tx %s to be blocked by a nonce gap, found %+v", gapped.Hash(), blocked)
+	}
+
+	// Transactions out of the pool have no outlook
+	var missing *ethapi.PendingTransactionOutlook
+	if err := client.Call(&missing, "eth_getPendingTransactionOutlook", common.Hash{1}); err != nil {
+		t.Fatal(err)
+	}
+	if missing != nil {
+		t.Fatalf("Expected no outlook for a missing tx, found %+v", missing)
+	}
+}
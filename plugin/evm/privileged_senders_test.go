@@ -0,0 +1,133 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/vms/components/chain"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// gasBurnerAddr holds a contract looping until it runs out of gas, so that a
+// call to it uses all of its gas limit.
+var gasBurnerAddr = common.HexToAddress("0x0200000000000000000000000000000000000000")
+
+func TestPrivilegedSenderBlockGas(t *testing.T) {
+	tests := map[string]struct {
+		config   string
+		included bool
+	}{
+		"reserved gas": {
+			config:   fmt.Sprintf(`{"privileged-senders":["%s"],"privileged-tx-pool-slots":1,"privileged-block-gas":%d}`, testEthAddrs[0].Hex(), params.TxGas),
+			included: true,
+		},
+		"no reservation": {config: `{}`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			testPrivilegedSenderBlockGas(t, test.config, test.included)
+		})
+	}
+}
+
+func testPrivilegedSenderBlockGas(t *testing.T, config string, included bool) {
+	balance := new(big.Int).Lsh(common.Big1, 100)
+	genesis := &core.Genesis{
+		Difficulty: common.Big0,
+		GasLimit:   params.ApricotPhase1GasLimit,
+		Config: &params.ChainConfig{
+			ChainID:                     params.AvalancheLocalChainID,
+			ApricotPhase1BlockTimestamp: big.NewInt(0),
+			ApricotPhase2BlockTimestamp: big.NewInt(0),
+			ApricotPhase3BlockTimestamp: big.NewInt(0),
+			ApricotPhase4BlockTimestamp: big.NewInt(0),
+		},
+		Alloc: core.GenesisAlloc{
+			testEthAddrs[0]: {Balance: balance},
+			testEthAddrs[1]: {Balance: balance},
+			gasBurnerAddr:   {Balance: common.Big0, Code: common.FromHex("0x5b600056")},
+		},
+	}
+	genesisJSON, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, vm, _, _, _ := GenesisVM(t, true, string(genesisJSON), config, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	signer := types.NewEIP155Signer(vm.chainID)
+
+	// Spam burning more than the gas of a block with a higher tip
+	spamGas := params.ApricotPhase1GasLimit / 4
+	spamPrice := new(big.Int).Mul(initialBaseFee, big.NewInt(10))
+	spam := make([]*types.Transaction, 5)
+	for i := range spam {
+		tx, err := types.SignTx(types.NewTransaction(uint64(i), gasBurnerAddr, common.Big0, spamGas, spamPrice, nil), signer, testKeys[1].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		spam[i] = tx
+	}
+	for i, err := range vm.chain.AddRemoteTxsSync(spam) {
+		if err != nil {
+			t.Fatalf("Failed to add spam tx %d: %s", i, err)
+		}
+	}
+	tx, err := types.SignTx(types.NewTransaction(0, testEthAddrs[2], common.Big1, params.TxGas, initialBaseFee, nil), signer, testKeys[0].ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+		t.Fatal(err)
+	}
+
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	ethBlock := blk.(*chain.BlockWrapper).Block.(*Block).ethBlock
+	if ethBlock.Transaction(tx.Hash()) != nil != included {
+		t.Fatalf("Expected the inclusion of the lower-tip tx to be %t, found %d txs using %d gas", included, len(ethBlock.Transactions()), ethBlock.GasUsed())
+	}
+	if included && ethBlock.Transactions()[0].Hash() != tx.Hash() {
+		t.Fatal("Expected the privileged tx to be committed first")
+	}
+	// The spam fills the rest of the block
+	if txs := len(ethBlock.Transactions()); txs != 4 {
+		t.Fatalf("Expected 4 txs, found %d", txs)
+	}
+}
+
+func TestAdminSetPrivilegedSenders(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase4, fmt.Sprintf(`{"privileged-senders":["%s"]}`, testEthAddrs[0].Hex()), "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	txPool := vm.chain.GetTxPool()
+	if privileged := txPool.Privileged(); len(privileged) != 1 || privileged[0] != testEthAddrs[0] {
+		t.Fatalf("Expected the configured privileged sender, found %v", privileged)
+	}
+
+	admin := NewAdminService(vm, "")
+	reply := api.SuccessResponse{}
+	args := &SetPrivilegedSendersArgs{Addresses: []common.Address{testEthAddrs[1]}}
+	if err := admin.SetPrivilegedSenders(&http.Request{}, args, &reply); err != nil || !reply.Success {
+		t.Fatalf("Failed to set the privileged senders: %v", err)
+	}
+	if privileged := txPool.Privileged(); len(privileged) != 1 || privileged[0] != testEthAddrs[1] {
+		t.Fatalf("Expected the new privileged sender, found %v", privileged)
+	}
+}
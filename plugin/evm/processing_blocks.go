@@ -0,0 +1,228 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// [rejectedBlocksHistory] is the number of recently rejected blocks reported
+// by debug_processingBlocks.
+const rejectedBlocksHistory = 64
+
+// processingBlock is a verified block that is not decided yet.
+type processingBlock struct {
+	hash           common.Hash
+	height         uint64
+	parent         common.Hash
+	received       time.Time
+	verifyDuration time.Duration
+}
+
+// rejectedBlock is a recently rejected block.
+type rejectedBlock struct {
+	hash     common.Hash
+	height   uint64
+	rejected time.Time
+	reason   string
+}
+
+// processingBlocks tracks the blocks verified by the VM until they are accepted
+// or rejected, the switches of the preference between competing blocks and the
+// recently rejected blocks. It is updated by the consensus engine calls and
+// read by the debug API, each under [lock].
+type processingBlocks struct {
+	lock sync.Mutex
+
+	blocks    map[common.Hash]*processingBlock
+	preferred common.Hash
+	// [rejected] is a ring of the last [rejectedBlocksHistory] rejected
+	// blocks, the oldest at [next] once it is full.
+	rejected []rejectedBlock
+	next     int
+
+	switches        uint64
+	switchesCounter metrics.Counter
+}
+
+func newProcessingBlocks() *processingBlocks {
+	return &processingBlocks{
+		blocks:          make(map[common.Hash]*processingBlock),
+		switchesCounter: metrics.NewRegisteredCounter("chain/preference/switches", nil),
+	}
+}
+
+// verified records [b], received at [received], as processing once its first
+// verification succeeds after [verifyDuration].
+func (p *processingBlocks) verified(b *Block, received time.Time, verifyDuration time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := b.ethBlock.Hash()
+	if _, ok := p.blocks[hash]; ok {
+		return
+	}
+	p.blocks[hash] = &processingBlock{
+		hash:           hash,
+		height:         b.Height(),
+		parent:         b.ethBlock.ParentHash(),
+		received:       received,
+		verifyDuration: verifyDuration,
+	}
+}
+
+// setPreference records the preference for [hash], counting a switch if the
+// previously preferred block is processing and not an ancestor of [hash].
+func (p *processingBlocks) setPreference(hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	previous, ok := p.blocks[p.preferred]
+	p.preferred = hash
+	if !ok || previous.hash == hash {
+		return
+	}
+	for blk := p.blocks[hash]; blk != nil && blk.height > previous.height; blk = p.blocks[blk.parent] {
+		if blk.parent == previous.hash {
+			return
+		}
+	}
+	p.switches++
+	p.switchesCounter.Inc(1)
+}
+
+// accepted drops the accepted block [hash] at [height], and any processing
+// block at or below [height], which is rejected by the consensus engine.
+func (p *processingBlocks) accepted(hash common.Hash, height uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.blocks, hash)
+	for h, blk := range p.blocks {
+		if blk.height <= height {
+			delete(p.blocks, h)
+		}
+	}
+}
+
+// rejectedBlock drops the rejected block [hash] at [height] and records it
+// with [reason] in the recently rejected blocks.
+func (p *processingBlocks) rejectedBlock(hash common.Hash, height uint64, reason string, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.blocks, hash)
+	rejected := rejectedBlock{hash: hash, height: height, rejected: now, reason: reason}
+	if len(p.rejected) < rejectedBlocksHistory {
+		p.rejected = append(p.rejected, rejected)
+		return
+	}
+	p.rejected[p.next] = rejected
+	p.next = (p.next + 1) % rejectedBlocksHistory
+}
+
+// ProcessingBlock is a block verified by the VM that is not decided yet.
+type ProcessingBlock struct {
+	Hash           common.Hash    `json:"hash"`
+	Height         hexutil.Uint64 `json:"height"`
+	ParentHash     common.Hash    `json:"parentHash"`
+	Received       time.Time      `json:"received"`
+	VerifyDuration string         `json:"verifyDuration"`
+	Preferred      bool           `json:"preferred"`
+}
+
+// RejectedBlock is a block recently rejected by the VM.
+type RejectedBlock struct {
+	Hash     common.Hash    `json:"hash"`
+	Height   hexutil.Uint64 `json:"height"`
+	Rejected time.Time      `json:"rejected"`
+	Reason   string         `json:"reason"`
+}
+
+// ProcessingBlocksReply is the processing set of the VM.
+type ProcessingBlocksReply struct {
+	// Blocks are ordered by height, then hash
+	Blocks             []ProcessingBlock `json:"blocks"`
+	PreferenceSwitches hexutil.Uint64    `json:"preferenceSwitches"`
+	// Rejected are ordered from the most recently rejected
+	Rejected []RejectedBlock `json:"rejected"`
+}
+
+// processing returns the processing set, the number of preference switches
+// and the recently rejected blocks.
+func (p *processingBlocks) processing() *ProcessingBlocksReply {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// The preferred blocks are the preferred block and its processing
+	// ancestors
+	preferred := make(map[common.Hash]bool)
+	for blk := p.blocks[p.preferred]; blk != nil; blk = p.blocks[blk.parent] {
+		preferred[blk.hash] = true
+	}
+	reply := &ProcessingBlocksReply{
+		Blocks:             make([]ProcessingBlock, 0, len(p.blocks)),
+		PreferenceSwitches: hexutil.Uint64(p.switches),
+		Rejected:           make([]RejectedBlock, 0, len(p.rejected)),
+	}
+	for _, blk := range p.blocks {
+		reply.Blocks = append(reply.Blocks, ProcessingBlock{
+			Hash:           blk.hash,
+			Height:         hexutil.Uint64(blk.height),
+			ParentHash:     blk.parent,
+			Received:       blk.received,
+			VerifyDuration: blk.verifyDuration.String(),
+			Preferred:      preferred[blk.hash],
+		})
+	}
+	sort.Slice(reply.Blocks, func(i, j int) bool {
+		if reply.Blocks[i].Height != reply.Blocks[j].Height {
+			return reply.Blocks[i].Height < reply.Blocks[j].Height
+		}
+		return reply.Blocks[i].Hash.Hex() < reply.Blocks[j].Hash.Hex()
+	})
+	for i := range p.rejected {
+		// Walk the ring backwards from the most recently rejected block
+		blk := p.rejected[(p.next-1-i+2*len(p.rejected))%len(p.rejected)]
+		reply.Rejected = append(reply.Rejected, RejectedBlock{
+			Hash:     blk.hash,
+			Height:   hexutil.Uint64(blk.height),
+			Rejected: blk.rejected,
+			Reason:   blk.reason,
+		})
+	}
+	return reply
+}
+
+// rejectReason returns why the consensus engine rejects [b].
+func (vm *VM) rejectReason(b *Block) string {
+	lastAccepted := vm.chain.LastAcceptedBlock()
+	if lastAccepted.NumberU64() < b.Height() {
+		return "ancestor rejected"
+	}
+	conflict := vm.chain.GetBlockByNumber(b.Height())
+	if conflict == nil {
+		return "conflicting block accepted"
+	}
+	return fmt.Sprintf("conflicting block %s accepted", conflict.Hash())
+}
+
+// ProcessingBlocksAPI serves the processing set of the VM in the debug
+// namespace.
+type ProcessingBlocksAPI struct{ vm *VM }
+
+// ProcessingBlocks returns the verified blocks that are neither accepted nor
+// rejected yet, the number of switches of the preference between competing
+// blocks and the recently rejected blocks.
+func (api *ProcessingBlocksAPI) ProcessingBlocks(ctx context.Context) *ProcessingBlocksReply {
+	return api.vm.processingBlocks.processing()
+}
@@ -0,0 +1,127 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow/consensus/snowman"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestProcessingBlocks(t *testing.T) {
+	importAmount := uint64(1000000000)
+	utxos := map[ids.ShortID]uint64{testShortIDAddrs[0]: importAmount}
+	issuer1, vm1, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase0, `{"eth-apis":["private-debug"]}`, "", utxos)
+	issuer2, vm2, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase0, "", "", utxos)
+	defer func() {
+		if err := vm1.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm2.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handlers, err := vm1.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+	processing := func() *ProcessingBlocksReply {
+		reply := &ProcessingBlocksReply{}
+		if err := client.Call(reply, "debug_processingBlocks"); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	// Each VM builds a child of the genesis importing the UTXO to a different
+	// address, so that the children compete at the same height
+	buildChild := func(issuer chan engCommon.Message, vm *VM, to common.Address) snowman.Block {
+		importTx, err := vm.newImportTx(vm.ctx.XChainID, to, initialBaseFee, testKeys[:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		<-issuer
+		blk, err := vm.BuildBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blk
+	}
+	blkA := buildChild(issuer1, vm1, testEthAddrs[0])
+	blkB, err := vm1.ParseBlock(buildChild(issuer2, vm2, testEthAddrs[1]).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blkA.ID() == blkB.ID() || blkA.Parent() != blkB.Parent() {
+		t.Fatal("Expected two different children of the genesis")
+	}
+
+	if err := blkA.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1.SetPreference(blkA.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := blkB.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both children are processing, the first one preferred
+	reply := processing()
+	if len(reply.Blocks) != 2 {
+		t.Fatalf("Expected 2 processing blocks, found %d", len(reply.Blocks))
+	}
+	for _, blk := range reply.Blocks {
+		if uint64(blk.Height) != 1 || blk.ParentHash != common.Hash(blkA.Parent()) || blk.Received.IsZero() || blk.VerifyDuration == "" {
+			t.Fatalf("Expected a verified child of the genesis, found %+v", blk)
+		}
+		if preferred := blk.Hash == common.Hash(blkA.ID()); blk.Preferred != preferred {
+			t.Fatalf("Expected block %s to be preferred: %t, found %t", blk.Hash, preferred, blk.Preferred)
+		}
+	}
+	if reply.PreferenceSwitches != 0 {
+		t.Fatalf("Expected no preference switch, found %d", reply.PreferenceSwitches)
+	}
+
+	// Switching the preference to the sibling and back is counted twice
+	for _, blk := range []snowman.Block{blkB, blkA} {
+		if err := vm1.SetPreference(blk.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reply := processing(); reply.PreferenceSwitches != 2 {
+		t.Fatalf("Expected 2 preference switches, found %d", reply.PreferenceSwitches)
+	}
+
+	// Once decided, neither child is processing and the rejected one is
+	// reported with the accepted block it conflicted with
+	if err := blkA.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if err := blkB.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	reply = processing()
+	if len(reply.Blocks) != 0 {
+		t.Fatalf("Expected no processing block, found %+v", reply.Blocks)
+	}
+	if len(reply.Rejected) != 1 || reply.Rejected[0].Hash != common.Hash(blkB.ID()) || uint64(reply.Rejected[0].Height) != 1 {
+		t.Fatalf("Expected block %s to be rejected, found %+v", blkB.ID(), reply.Rejected)
+	}
+	if reason := reply.Rejected[0].Reason; !strings.Contains(reason, common.Hash(blkA.ID()).Hex()) {
+		t.Fatalf("Expected the rejection to name the accepted block %s, found %q", common.Hash(blkA.ID()), reason)
+	}
+}
@@ -0,0 +1,166 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/utils"
+)
+
+// rpcSyncingErrorCode is the JSON-RPC error code of the calls rejected while
+// the node is syncing, the "resource unavailable" code of EIP-1474.
+const rpcSyncingErrorCode = -32002
+
+// rpcReadinessExemptMethods are the methods served while the node is syncing.
+var rpcReadinessExemptMethods = map[string]bool{
+	"eth_chainId":        true,
+	"eth_syncing":        true,
+	"web3_clientVersion": true,
+	"net_version":        true,
+	"admin_health":       true,
+}
+
+// SyncProgress is the progress of the node towards serving RPC calls, returned
+// in the data field of the "node syncing" error.
+type SyncProgress struct {
+	Bootstrapped  bool           `json:"bootstrapped"`
+	Warming       bool           `json:"warming"`
+	CurrentHeight hexutil.Uint64 `json:"currentHeight"`
+	NetworkHeight hexutil.Uint64 `json:"networkHeight"`
+	MaxHeightLag  hexutil.Uint64 `json:"maxHeightLag"`
+}
+
+// syncingError is the error of the RPC calls rejected while the node is
+// syncing.
+type syncingError struct {
+	progress SyncProgress
+}
+
+func (e *syncingError) Error() string          { return "node syncing" }
+func (e *syncingError) ErrorCode() int         { return rpcSyncingErrorCode }
+func (e *syncingError) ErrorData() interface{} { return e.progress }
+
+// rpcReadiness gates the RPC calls until the node is ready to serve them,
+// which is once the chain is bootstrapped, the caches are warmed up and the last
+// accepted block is at most [maxHeightLag] blocks behind the highest block seen
+// from the network.
+// Readiness is evaluated on each call, so that it flips as soon as both
+// conditions hold, and again if the node falls behind.
+//
+// While bootstrapping, the height of the network is the highest block parsed.
+// Once bootstrapped, it is the highest block verified, so that blocks of peers
+// claiming a height far ahead of the network cannot keep the node unready.
+//
+// All methods are no-ops on a nil [rpcReadiness], when gating is disabled.
+type rpcReadiness struct {
+	maxHeightLag uint64
+
+	bootstrapped   utils.AtomicBool
+	warming        utils.AtomicBool
+	acceptedHeight uint64 // accessed atomically
+	networkHeight  uint64 // accessed atomically
+	ready          utils.AtomicBool
+}
+
+// newRPCReadiness returns the readiness of a node whose last accepted block is
+// at [acceptedHeight].
+func newRPCReadiness(maxHeightLag uint64, acceptedHeight uint64) *rpcReadiness {
+	return &rpcReadiness{
+		maxHeightLag:   maxHeightLag,
+		acceptedHeight: acceptedHeight,
+		networkHeight:  acceptedHeight,
+	}
+}
+
+// setBootstrapped records whether the chain is bootstrapped.
+func (r *rpcReadiness) setBootstrapped(bootstrapped bool) {
+	if r == nil {
+		return
+	}
+	if bootstrapped && !r.bootstrapped.GetValue() {
+		// Blocks parsed while bootstrapping may be invalid
+		atomic.StoreUint64(&r.networkHeight, atomic.LoadUint64(&r.acceptedHeight))
+	}
+	r.bootstrapped.SetValue(bootstrapped)
+}
+
+// setWarming records whether the caches are being warmed up.
+func (r *rpcReadiness) setWarming(warming bool) {
+	if r == nil {
+		return
+	}
+	r.warming.SetValue(warming)
+}
+
+// parsed records a block at [height] parsed from the network.
+func (r *rpcReadiness) parsed(height uint64) {
+	if r == nil || r.bootstrapped.GetValue() {
+		return
+	}
+	r.observe(height)
+}
+
+// verified records a block at [height] that passed verification.
+func (r *rpcReadiness) verified(height uint64) {
+	if r == nil {
+		return
+	}
+	r.observe(height)
+}
+
+// accepted records the block accepted at [height].
+func (r *rpcReadiness) accepted(height uint64) {
+	if r == nil {
+		return
+	}
+	atomic.StoreUint64(&r.acceptedHeight, height)
+	r.observe(height)
+}
+
+func (r *rpcReadiness) observe(height uint64) {
+	for {
+		networkHeight := atomic.LoadUint64(&r.networkHeight)
+		if height <= networkHeight || atomic.CompareAndSwapUint64(&r.networkHeight, networkHeight, height) {
+			return
+		}
+	}
+}
+
+// progress returns the progress of the node towards readiness.
+func (r *rpcReadiness) progress() SyncProgress {
+	return SyncProgress{
+		Bootstrapped:  r.bootstrapped.GetValue(),
+		Warming:       r.warming.GetValue(),
+		CurrentHeight: hexutil.Uint64(atomic.LoadUint64(&r.acceptedHeight)),
+		NetworkHeight: hexutil.Uint64(atomic.LoadUint64(&r.networkHeight)),
+		MaxHeightLag:  hexutil.Uint64(r.maxHeightLag),
+	}
+}
+
+// gate returns a "node syncing" error for the calls of [method] while the node
+// is not ready, unless [method] is exempt.
+func (r *rpcReadiness) gate(method string) error {
+	if r == nil || rpcReadinessExemptMethods[method] {
+		return nil
+	}
+	progress := r.progress()
+	lagging := progress.NetworkHeight > progress.CurrentHeight && uint64(progress.NetworkHeight-progress.CurrentHeight) > r.maxHeightLag
+	ready := progress.Bootstrapped && !progress.Warming && !lagging
+	if wasReady := r.ready.GetValue(); ready != wasReady {
+		r.ready.SetValue(ready)
+		if ready {
+			log.Info("node ready to serve RPC calls", "height", progress.CurrentHeight)
+		} else {
+			log.Info("node not ready to serve RPC calls", "bootstrapped", progress.Bootstrapped, "height", progress.CurrentHeight, "networkHeight", progress.NetworkHeight)
+		}
+	}
+	if !ready {
+		return &syncingError{progress: progress}
+	}
+	return nil
+}
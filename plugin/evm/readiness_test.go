@@ -0,0 +1,135 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestRPCReadiness(t *testing.T) {
+	config := `{"rpc-readiness-gating-enabled":true,"rpc-readiness-max-height-lag":0}`
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, false, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := vm.SetState(snow.Bootstrapping); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+
+	// syncing returns the progress of the "node syncing" error of a gated call
+	syncing := func() map[string]interface{} {
+		var blockNumber hexutil.Uint64
+		err := client.Call(&blockNumber, "eth_blockNumber")
+		var rpcErr rpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != rpcSyncingErrorCode {
+			t.Fatalf("Expected a node syncing error, found %v", err)
+		}
+		var dataErr rpc.DataError
+		if !errors.As(err, &dataErr) {
+			t.Fatalf("Expected the progress in the node syncing error")
+		}
+		return dataErr.ErrorData().(map[string]interface{})
+	}
+	ready := func() {
+		var blockNumber hexutil.Uint64
+		if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+			t.Fatalf("Expected the node to be ready, found %v", err)
+		}
+	}
+
+	// Gated while bootstrapping, apart from the exempt methods
+	vm.readiness.parsed(100)
+	if progress := syncing(); progress["bootstrapped"] != false || progress["networkHeight"] != "0x64" {
+		t.Fatalf("Unexpected progress %v", progress)
+	}
+	for _, method := range []string{"net_version", "web3_clientVersion"} {
+		var version string
+		if err := client.Call(&version, method); err != nil {
+			t.Fatalf("Expected %s to be exempt, found %v", method, err)
+		}
+	}
+
+	// Ready once bootstrapped, as blocks parsed while bootstrapping are not
+	// trusted
+	if err := vm.SetState(snow.NormalOp); err != nil {
+		t.Fatal(err)
+	}
+	ready()
+
+	// Gated while the caches are warmed up
+	vm.readiness.setWarming(true)
+	if progress := syncing(); progress["warming"] != true {
+		t.Fatalf("Unexpected progress %v", progress)
+	}
+	vm.readiness.setWarming(false)
+	ready()
+
+	// Gated again while a verified block is not accepted, and ready once it is
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	<-issuer
+	blk, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if progress := syncing(); progress["bootstrapped"] != true || progress["currentHeight"] != "0x0" || progress["networkHeight"] != "0x1" {
+		t.Fatalf("Unexpected progress %v", progress)
+	}
+	if err := vm.SetPreference(blk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	ready()
+}
+
+func TestRPCReadinessDisabled(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, false, genesisJSONApricotPhase5, "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := vm.SetState(snow.Bootstrapping); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+
+	var blockNumber hexutil.Uint64
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+		t.Fatalf("Expected best-effort responses while bootstrapping, found %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+const (
+	// receiptRepairReexec is the maximum number of blocks re-executed to
+	// regenerate the parent state of a block whose state was pruned.
+	receiptRepairReexec = 8192
+
+	// receiptRepairThrottle is the pause between two blocks replayed by a
+	// receipt repair job, leaving room for block processing and API calls.
+	receiptRepairThrottle = 10 * time.Millisecond
+
+	// receiptRepairCommitInterval is the number of blocks checked between two
+	// writes of the repaired receipts and of the job progress.
+	receiptRepairCommitInterval = 64
+)
+
+var (
+	receiptRepairKey = []byte("receipt_repair")
+
+	errReceiptRepairRunning = errors.New("a receipt repair job is already running")
+)
+
+// receiptRepairProgress is stored in the chain database, along with the
+// receipts it rewrote, so that an interrupted job can be resumed.
+type receiptRepairProgress struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+	// Next is the next height whose receipts must be checked.
+	Next     uint64   `json:"next"`
+	Checked  uint64   `json:"checked"`
+	Repaired []uint64 `json:"repaired"`
+	Done     bool     `json:"done"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// readReceiptRepairProgress returns the progress of the last receipt repair
+// job, or nil if no job was ever started.
+func readReceiptRepairProgress(db ethdb.KeyValueReader) (*receiptRepairProgress, error) {
+	has, err := db.Has(receiptRepairKey)
+	if err != nil || !has {
+		return nil, err
+	}
+	blob, err := db.Get(receiptRepairKey)
+	if err != nil {
+		return nil, err
+	}
+	progress := new(receiptRepairProgress)
+	if err := json.Unmarshal(blob, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+func writeReceiptRepairProgress(db ethdb.KeyValueWriter, progress *receiptRepairProgress) error {
+	blob, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return db.Put(receiptRepairKey, blob)
+}
+
+// startReceiptRepair starts a background job re-deriving the receipts of the
+// accepted blocks in [from, to] and rewriting the stored receipts that do not
+// match. If an interrupted job over the same range exists, it is resumed.
+func (vm *VM) startReceiptRepair(from, to uint64) (*receiptRepairProgress, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid receipt repair range [%d, %d]", from, to)
+	}
+	if lastAccepted := vm.chain.LastAcceptedBlock().NumberU64(); to > lastAccepted {
+		return nil, fmt.Errorf("cannot repair receipts above the last accepted height %d", lastAccepted)
+	}
+
+	vm.receiptRepairLock.Lock()
+	defer vm.receiptRepairLock.Unlock()
+	if vm.receiptRepairRunning {
+		return nil, errReceiptRepairRunning
+	}
+	progress, err := readReceiptRepairProgress(vm.chaindb)
+	if err != nil {
+		return nil, err
+	}
+	if progress == nil || progress.From != from || progress.To != to || progress.Done {
+		progress = &receiptRepairProgress{From: from, To: to, Next: from}
+		// The genesis block has no receipts
+		if progress.Next == 0 {
+			progress.Next = 1
+		}
+	} else {
+		log.Info("Resuming receipt repair", "from", from, "to", to, "next", progress.Next)
+	}
+	progress.Error = ""
+
+	vm.receiptRepairRunning = true
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		err := vm.repairReceipts(progress)
+		if err != nil {
+			log.Error("Receipt repair failed", "next", progress.Next, "err", err)
+			progress.Error = err.Error()
+			if err := writeReceiptRepairProgress(vm.chaindb, progress); err != nil {
+				log.Error("Failed to write receipt repair progress", "err", err)
+			}
+		}
+
+		vm.receiptRepairLock.Lock()
+		vm.receiptRepairRunning = false
+		vm.receiptRepairLock.Unlock()
+	}()
+	return progress, nil
+}
+
+// receiptRepairStatus returns the progress of the last receipt repair job and
+// whether it is still running. The progress of a running job is only updated
+// every [receiptRepairCommitInterval] blocks.
+func (vm *VM) receiptRepairStatus() (*receiptRepairProgress, bool, error) {
+	vm.receiptRepairLock.Lock()
+	defer vm.receiptRepairLock.Unlock()
+
+	progress, err := readReceiptRepairProgress(vm.chaindb)
+	return progress, vm.receiptRepairRunning, err
+}
+
+// repairReceipts checks the receipts of the blocks from [progress.Next] up to
+// [progress.To], updating [progress] as it goes. It returns early without an
+// error if the VM shuts down, leaving the job to be resumed.
+func (vm *VM) repairReceipts(progress *receiptRepairProgress) error {
+	var (
+		bc      = vm.chain.BlockChain()
+		batch   = vm.chaindb.NewBatch()
+		evicted []*types.Block
+		start   = time.Now()
+	)
+	commit := func() error {
+		if err := writeReceiptRepairProgress(batch, progress); err != nil {
+			return err
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		for _, block := range evicted {
+			bc.EvictReceipts(block.Hash())
+		}
+		batch.Reset()
+		evicted = evicted[:0]
+		return nil
+	}
+
+	for progress.Next <= progress.To {
+		select {
+		case <-vm.shutdownChan:
+			log.Info("Interrupted receipt repair", "next", progress.Next, "to", progress.To)
+			return commit()
+		case <-time.After(receiptRepairThrottle):
+		}
+
+		// Only heights up to the last accepted block, checked when the job is
+		// started, are ever repaired.
+		block := bc.GetBlockByNumber(progress.Next)
+		if block == nil {
+			return fmt.Errorf("missing accepted block at height %d", progress.Next)
+		}
+		receipts, repaired, err := vm.deriveBlockReceipts(block)
+		if err != nil {
+			return err
+		}
+		progress.Checked++
+		if repaired {
+			log.Info("Repairing receipts", "height", block.NumberU64(), "hash", block.Hash())
+			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+			progress.Repaired = append(progress.Repaired, block.NumberU64())
+			evicted = append(evicted, block)
+		}
+		progress.Next++
+		if progress.Checked%receiptRepairCommitInterval == 0 || batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	progress.Done = true
+	log.Info("Completed receipt repair", "from", progress.From, "to", progress.To, "checked", progress.Checked, "repaired", len(progress.Repaired), "elapsed", time.Since(start))
+	return commit()
+}
+
+// deriveBlockReceipts replays [block] on top of the state of its parent and
+// returns the derived receipts, along with whether they differ from the
+// receipts stored for [block].
+func (vm *VM) deriveBlockReceipts(block *types.Block) (types.Receipts, bool, error) {
+	bc := vm.chain.BlockChain()
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, false, fmt.Errorf("missing parent of block %d", block.NumberU64())
+	}
+	statedb, err := vm.chain.APIBackend().StateAtBlock(context.Background(), parent, receiptRepairReexec, nil, true, false)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get state of block %d: %w", parent.NumberU64(), err)
+	}
+	receipts, _, _, err := bc.Processor().Process(block, parent.Header(), statedb, *bc.GetVMConfig())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to replay block %d: %w", block.NumberU64(), err)
+	}
+
+	// Receipts stored under an older encoding are rewritten as well.
+	storageReceipts := make([]*types.ReceiptForStorage, len(receipts))
+	for i, receipt := range receipts {
+		storageReceipts[i] = (*types.ReceiptForStorage)(receipt)
+	}
+	derived, err := rlp.EncodeToBytes(storageReceipts)
+	if err != nil {
+		return nil, false, err
+	}
+	stored := rawdb.ReadReceiptsRLP(vm.chaindb, block.Hash(), block.NumberU64())
+	return receipts, !bytes.Equal(derived, stored), nil
+}
@@ -0,0 +1,156 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// waitReceiptRepair waits for the receipt repair job of [vm] to stop and
+// returns its progress.
+func waitReceiptRepair(t *testing.T, vm *VM) *receiptRepairProgress {
+	for i := 0; i < 500; i++ {
+		progress, running, err := vm.receiptRepairStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !running {
+			return progress
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("receipt repair did not complete")
+	return nil
+}
+
+func TestRepairReceipts(t *testing.T) {
+	importAmount := uint64(500000000)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	sendEthTxs(t, vm,
+		types.NewContractCreation(0, common.Big0, 100_000, gasPrice, snapshotInitCode),
+		types.NewTransaction(1, testEthAddrs[1], common.Big1, 21_000, gasPrice, nil),
+	)
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	sendEthTxs(t, vm, types.NewTransaction(2, testEthAddrs[1], common.Big1, 21_000, gasPrice, nil))
+	buildAndAcceptBlock(t, issuer, vm)
+
+	// Store receipts deriving to the wrong gas used and status, and make sure
+	// the corrupted receipts are cached.
+	bc := vm.chain.BlockChain()
+	hash, height := common.Hash(blk.ID()), blk.Height()
+	expected := rawdb.ReadReceipts(vm.chaindb, hash, height, vm.chainConfig)
+	if len(expected) != 2 {
+		t.Fatalf("Expected 2 receipts, found %d", len(expected))
+	}
+	corrupted := rawdb.ReadRawReceipts(vm.chaindb, hash, height)
+	corrupted[1].CumulativeGasUsed++
+	corrupted[1].Status = types.ReceiptStatusFailed
+	rawdb.WriteReceipts(vm.chaindb, hash, height, corrupted)
+	bc.EvictReceipts(hash)
+	if receipts := bc.GetReceiptsByHash(hash); receipts[1].GasUsed == expected[1].GasUsed {
+		t.Fatal("Expected corrupted receipts to derive a different gas used")
+	}
+
+	if _, err := vm.startReceiptRepair(0, 4); err == nil {
+		t.Fatal("Expected repair above the last accepted height to fail")
+	}
+	if _, err := vm.startReceiptRepair(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	progress := waitReceiptRepair(t, vm)
+	if !progress.Done || progress.Error != "" {
+		t.Fatalf("Expected repair to complete, found %+v", progress)
+	}
+	if progress.Checked != 3 || len(progress.Repaired) != 1 || progress.Repaired[0] != height {
+		t.Fatalf("Expected 3 blocks checked and block %d repaired, found %+v", height, progress)
+	}
+
+	receipts := bc.GetReceiptsByHash(hash)
+	for i, receipt := range receipts {
+		if receipt.Status != expected[i].Status || receipt.CumulativeGasUsed != expected[i].CumulativeGasUsed || receipt.GasUsed != expected[i].GasUsed {
+			t.Fatalf("Receipt %d was not repaired: expected %+v, found %+v", i, expected[i], receipt)
+		}
+	}
+
+	// A completed job over the same range starts over and finds nothing to
+	// repair.
+	if _, err := vm.startReceiptRepair(0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if progress := waitReceiptRepair(t, vm); !progress.Done || len(progress.Repaired) != 0 {
+		t.Fatalf("Expected nothing left to repair, found %+v", progress)
+	}
+}
+
+func TestRepairReceiptsResume(t *testing.T) {
+	importAmount := uint64(500000000)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	sendEthTxs(t, vm, types.NewTransaction(0, testEthAddrs[1], common.Big1, 21_000, big.NewInt(params.LaunchMinGasPrice), nil))
+	blk := buildAndAcceptBlock(t, issuer, vm)
+
+	// Persist the progress of an interrupted job that already repaired block 1
+	if err := writeReceiptRepairProgress(vm.chaindb, &receiptRepairProgress{
+		From:     1,
+		To:       2,
+		Next:     2,
+		Checked:  1,
+		Repaired: []uint64{1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := rawdb.ReadRawReceipts(vm.chaindb, common.Hash(blk.ID()), blk.Height())
+	corrupted[0].CumulativeGasUsed++
+	rawdb.WriteReceipts(vm.chaindb, common.Hash(blk.ID()), blk.Height(), corrupted)
+
+	if _, err := vm.startReceiptRepair(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	progress := waitReceiptRepair(t, vm)
+	if !progress.Done || progress.Checked != 2 || len(progress.Repaired) != 2 || progress.Repaired[1] != blk.Height() {
+		t.Fatalf("Expected resumed job to repair block %d, found %+v", blk.Height(), progress)
+	}
+}
@@ -0,0 +1,264 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// Package replayer replays ranges of blocks of the chain without a VM, to be
+// driven by differential harnesses comparing releases on the same blocks.
+package replayer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow"
+
+	"github.com/zsmartex/coreth/consensus"
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/core/vm"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/trie"
+)
+
+var errReplayGenesis = errors.New("cannot replay the genesis block")
+
+// Config configures a Replayer.
+type Config struct {
+	// ChainConfig is the configuration of the chain of the replayed blocks.
+	ChainConfig *params.ChainConfig
+	// AVAXAssetID is the asset the atomic txs transfer to the native balances.
+	AVAXAssetID ids.ID
+	// OnDivergence, if set, is called for the first block of a range whose
+	// post-state root differs from the root of its header, with the accounts
+	// of the post-state the block created or modified, in the order of the
+	// hashes of their addresses, to be compared with those of another version.
+	OnDivergence func(result ReplayResult, accounts []state.DumpAccount)
+}
+
+// ReplayResult is the outcome of the replay of a block.
+type ReplayResult struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	// Root is the post-state root, which may differ from the root of the
+	// header of the block if the replay diverged.
+	Root         common.Hash `json:"root"`
+	ReceiptsRoot common.Hash `json:"receiptsRoot"`
+	GasUsed      uint64      `json:"gasUsed"`
+	// AtomicOpsDigest is the hash of the shared memory operations of the
+	// atomic txs of the block, see evm.AtomicOpsDigest.
+	AtomicOpsDigest common.Hash `json:"atomicOpsDigest"`
+}
+
+// Replayer processes blocks with the state transition of this version,
+// reporting the outcome of each block.
+type Replayer struct {
+	config Config
+
+	// beforeCommit, if set, is called with the state of each block once it is
+	// processed, before its root is computed (for tests)
+	beforeCommit func(block *types.Block, statedb *state.StateDB)
+}
+
+// New returns a Replayer of the blocks of the chain with [config].
+func New(config Config) *Replayer {
+	return &Replayer{config: config}
+}
+
+// ReplayRange processes [blocks], ordered from child to child, on top of the
+// state of the parent of the first block in [db], and returns the result of
+// each block. The parent of the first block must be in [db], along with its
+// state and the headers of its ancestors read by the blocks. The tries of the
+// states produced are kept in memory rather than written to [db], so that the
+// same range can be replayed repeatedly.
+//
+// Returns the results of the blocks replayed until an error occurs.
+func (r *Replayer) ReplayRange(db ethdb.Database, blocks []*types.Block) ([]ReplayResult, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	first := blocks[0]
+	if first.NumberU64() == 0 {
+		return nil, errReplayGenesis
+	}
+	parent := rawdb.ReadHeader(db, first.ParentHash(), first.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %s of block %d not found", first.ParentHash(), first.NumberU64())
+	}
+
+	var (
+		config    = r.config.ChainConfig
+		ctx       = &snow.Context{AVAXAssetID: r.config.AVAXAssetID}
+		atomicTxs []*evm.Tx // Atomic txs of the block being processed
+		engine    = dummy.NewDummyEngine(&dummy.ConsensusCallbacks{
+			OnExtraStateChange: func(block *types.Block, statedb *state.StateDB) (*big.Int, *big.Int, error) {
+				txs, err := evm.ExtractBlockAtomicTxs(config, block)
+				if err != nil {
+					return nil, nil, err
+				}
+				atomicTxs = txs
+				return evm.ApplyAtomicTxs(config, ctx, block.Header(), txs, statedb)
+			},
+		})
+		chain     = newReplayChain(db, config, engine, parent)
+		processor = core.NewStateProcessor(config, chain, engine)
+		stateDB   = state.NewDatabaseWithConfig(db, &trie.Config{Preimages: true})
+		results   = make([]ReplayResult, 0, len(blocks))
+		// The blocks are processed on top of the replayed states, which differ
+		// from those of their headers once the replay diverged
+		parentRoot = parent.Root
+		diverged   bool
+	)
+	for _, block := range blocks {
+		if block.ParentHash() != parent.Hash() {
+			return results, fmt.Errorf("block %d (%s) is not a child of %s", block.NumberU64(), block.Hash(), parent.Hash())
+		}
+		statedb, err := state.New(parentRoot, stateDB, nil)
+		if err != nil {
+			return results, fmt.Errorf("failed to open the state of block %d: %w", parent.Number, err)
+		}
+		atomicTxs = nil
+		receipts, _, gasUsed, err := processor.Process(block, parent, statedb, vm.Config{})
+		if err != nil {
+			return results, fmt.Errorf("failed to process block %d (%s): %w", block.NumberU64(), block.Hash(), err)
+		}
+		if r.beforeCommit != nil {
+			r.beforeCommit(block, statedb)
+		}
+		root, err := statedb.Commit(config.IsEIP158(block.Number()))
+		if err != nil {
+			return results, fmt.Errorf("failed to commit the state of block %d: %w", block.NumberU64(), err)
+		}
+		digest, err := evm.AtomicOpsDigest(atomicTxs)
+		if err != nil {
+			return results, fmt.Errorf("failed to digest the atomic ops of block %d: %w", block.NumberU64(), err)
+		}
+		result := ReplayResult{
+			Number:          block.NumberU64(),
+			Hash:            block.Hash(),
+			Root:            root,
+			ReceiptsRoot:    types.DeriveSha(receipts, trie.NewStackTrie(nil)),
+			GasUsed:         gasUsed,
+			AtomicOpsDigest: digest,
+		}
+		results = append(results, result)
+
+		if root != block.Root() && !diverged && r.config.OnDivergence != nil {
+			diverged = true
+			accounts, err := modifiedAccounts(stateDB, parentRoot, root)
+			if err != nil {
+				return results, fmt.Errorf("failed to dump the accounts of block %d: %w", block.NumberU64(), err)
+			}
+			r.config.OnDivergence(result, accounts)
+		}
+		chain.add(block.Header())
+		parent, parentRoot = block.Header(), root
+	}
+	return results, nil
+}
+
+// modifiedAccounts returns the accounts of the state with [root] that are not
+// in the state with [parentRoot].
+func modifiedAccounts(db state.Database, parentRoot, root common.Hash) ([]state.DumpAccount, error) {
+	parentTrie, err := db.OpenTrie(parentRoot)
+	if err != nil {
+		return nil, err
+	}
+	postTrie, err := db.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	diff, _ := trie.NewDifferenceIterator(parentTrie.NodeIterator(nil), postTrie.NodeIterator(nil))
+	it := trie.NewIterator(diff)
+	var accounts []state.DumpAccount
+	for it.Next() {
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(it.Value, &account); err != nil {
+			return nil, err
+		}
+		dumped := state.DumpAccount{
+			Balance:     account.Balance.String(),
+			Nonce:       account.Nonce,
+			Root:        account.Root[:],
+			CodeHash:    account.CodeHash,
+			IsMultiCoin: account.IsMultiCoin,
+		}
+		if preimage := postTrie.GetKey(it.Key); preimage != nil {
+			address := common.BytesToAddress(preimage)
+			dumped.Address = &address
+		} else {
+			dumped.SecureKey = it.Key
+		}
+		accounts = append(accounts, dumped)
+	}
+	return accounts, it.Err
+}
+
+// replayChain serves the headers of the replayed blocks and of their
+// ancestors in the database to the state processor.
+type replayChain struct {
+	db       ethdb.Database
+	config   *params.ChainConfig
+	engine   consensus.Engine
+	headers  map[common.Hash]*types.Header
+	byNumber map[uint64]*types.Header
+	current  *types.Header
+}
+
+func newReplayChain(db ethdb.Database, config *params.ChainConfig, engine consensus.Engine, parent *types.Header) *replayChain {
+	chain := &replayChain{
+		db:       db,
+		config:   config,
+		engine:   engine,
+		headers:  make(map[common.Hash]*types.Header),
+		byNumber: make(map[uint64]*types.Header),
+	}
+	chain.add(parent)
+	return chain
+}
+
+func (c *replayChain) add(header *types.Header) {
+	c.headers[header.Hash()] = header
+	c.byNumber[header.Number.Uint64()] = header
+	c.current = header
+}
+
+func (c *replayChain) Engine() consensus.Engine     { return c.engine }
+func (c *replayChain) Config() *params.ChainConfig  { return c.config }
+func (c *replayChain) CurrentHeader() *types.Header { return c.current }
+
+func (c *replayChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := c.headers[hash]; ok {
+		return header
+	}
+	return rawdb.ReadHeader(c.db, hash, number)
+}
+
+func (c *replayChain) GetHeaderByNumber(number uint64) *types.Header {
+	if header, ok := c.byNumber[number]; ok {
+		return header
+	}
+	hash := rawdb.ReadCanonicalHash(c.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(c.db, hash, number)
+}
+
+func (c *replayChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	if header, ok := c.headers[hash]; ok {
+		return header
+	}
+	number := rawdb.ReadHeaderNumber(c.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadHeader(c.db, hash, *number)
+}
@@ -0,0 +1,193 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package replayer
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/avalanchego/vms/secp256k1fx"
+
+	"github.com/zsmartex/coreth/consensus/dummy"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/state"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+)
+
+var (
+	testKey, _     = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr       = crypto.PubkeyToAddress(testKey.PublicKey)
+	testAVAXAsset  = ids.ID{0xaa}
+	testAtomicNum  = uint64(3)
+	testRangeLen   = 8
+	testRecipients = []common.Address{{0x01}, {0x02}, {0x03}}
+)
+
+// generateRange returns a database holding the genesis of a chain and a range
+// of blocks on top of it, transferring funds and importing funds with an
+// atomic tx at height [testAtomicNum].
+func generateRange(t *testing.T) (ethdb.Database, []*types.Block) {
+	config := params.TestChainConfig
+	genesis := &core.Genesis{
+		Config: config,
+		Alloc:  core.GenesisAlloc{testAddr: {Balance: new(big.Int).Mul(big.NewInt(params.Ether), big.NewInt(1000))}},
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesisBlock := genesis.MustCommit(db)
+
+	atomicTx := &evm.Tx{UnsignedAtomicTx: &evm.UnsignedImportTx{
+		NetworkID:    1,
+		BlockchainID: ids.ID{0x01},
+		SourceChain:  ids.ID{0x02},
+		ImportedInputs: []*avax.TransferableInput{{
+			UTXOID: avax.UTXOID{TxID: ids.ID{0x03}},
+			Asset:  avax.Asset{ID: testAVAXAsset},
+			In:     &secp256k1fx.TransferInput{Amt: 1_000_000_000, Input: secp256k1fx.Input{SigIndices: []uint32{0}}},
+		}},
+		Outs: []evm.EVMOutput{{Address: testRecipients[0], Amount: 500_000_000, AssetID: testAVAXAsset}},
+	}}
+	if err := atomicTx.Sign(evm.Codec, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &snow.Context{AVAXAssetID: testAVAXAsset}
+	engine := dummy.NewDummyEngine(&dummy.ConsensusCallbacks{
+		OnFinalizeAndAssemble: func(header *types.Header, statedb *state.StateDB, txs []*types.Transaction) ([]byte, *big.Int, *big.Int, error) {
+			if header.Number.Uint64() != testAtomicNum {
+				return nil, nil, nil, nil
+			}
+			atomicTxs := []*evm.Tx{atomicTx}
+			contribution, gasUsed, err := evm.ApplyAtomicTxs(config, ctx, header, atomicTxs, statedb)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			extData, _, err := evm.EncodeBlockAtomicTxs(config, header.Time, atomicTxs)
+			return extData, contribution, gasUsed, err
+		},
+	})
+
+	genDB := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(genDB)
+	signer := types.LatestSigner(config)
+	blocks, _, err := core.GenerateChain(config, genesisBlock, engine, genDB, testRangeLen, 10, func(i int, gen *core.BlockGen) {
+		to := testRecipients[i%len(testRecipients)]
+		tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(testAddr), to, big.NewInt(int64(i+1)), params.TxGas, gen.BaseFee(), nil), signer, testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.AddTx(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, blocks
+}
+
+func TestReplayRangeStable(t *testing.T) {
+	db, blocks := generateRange(t)
+	replayer := New(Config{
+		ChainConfig: params.TestChainConfig,
+		AVAXAssetID: testAVAXAsset,
+		OnDivergence: func(result ReplayResult, accounts []state.DumpAccount) {
+			t.Fatalf("Unexpected divergence at block %d", result.Number)
+		},
+	})
+	results, err := replayer.ReplayRange(db, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(blocks) {
+		t.Fatalf("Expected %d results, found %d", len(blocks), len(results))
+	}
+	emptyDigest, err := evm.AtomicOpsDigest(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		block := blocks[i]
+		if result.Number != block.NumberU64() || result.Hash != block.Hash() {
+			t.Fatalf("Expected the result of block %d, found that of block %d", block.NumberU64(), result.Number)
+		}
+		if result.Root != block.Root() || result.ReceiptsRoot != block.ReceiptHash() || result.GasUsed != block.GasUsed() {
+			t.Fatalf("Expected the result of block %d to match its header, found %+v", block.NumberU64(), result)
+		}
+		if atomic := result.Number == testAtomicNum; atomic == (result.AtomicOpsDigest == emptyDigest) {
+			t.Fatalf("Unexpected atomic ops digest %s of block %d", result.AtomicOpsDigest, result.Number)
+		}
+	}
+
+	// Replays of the range, in full or from its middle, are identical
+	replayed, err := replayer.ReplayRange(db, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, replayed) {
+		t.Fatal("Expected the replays of the range to be identical")
+	}
+	if _, err := replayer.ReplayRange(db, blocks[1:]); err == nil {
+		t.Fatal("Expected the replay of a range without its parent in the database to fail")
+	}
+	if _, err := replayer.ReplayRange(db, []*types.Block{blocks[0], blocks[2]}); err == nil {
+		t.Fatal("Expected the replay of a range with a gap to fail")
+	}
+}
+
+func TestReplayRangeDivergence(t *testing.T) {
+	db, blocks := generateRange(t)
+	tampered := common.Address{0xff}
+	var (
+		divergences int
+		diverged    ReplayResult
+		accounts    []state.DumpAccount
+	)
+	replayer := New(Config{
+		ChainConfig: params.TestChainConfig,
+		AVAXAssetID: testAVAXAsset,
+		OnDivergence: func(result ReplayResult, modified []state.DumpAccount) {
+			divergences++
+			diverged, accounts = result, modified
+		},
+	})
+	// Introduce a divergence in the state transition of block 5
+	replayer.beforeCommit = func(block *types.Block, statedb *state.StateDB) {
+		if block.NumberU64() == 5 {
+			statedb.AddBalance(tampered, big.NewInt(1))
+		}
+	}
+	results, err := replayer.ReplayRange(db, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if (result.Number >= 5) != (result.Root != blocks[result.Number-1].Root()) {
+			t.Fatalf("Unexpected root %s of block %d", result.Root, result.Number)
+		}
+	}
+	if divergences != 1 || diverged.Number != 5 {
+		t.Fatalf("Expected a single divergence at block 5, found %d at block %d", divergences, diverged.Number)
+	}
+	// The dump holds the tampered account, along with the sender, recipient and
+	// coinbase of the block
+	found := false
+	for _, account := range accounts {
+		if account.Address == nil {
+			t.Fatalf("Expected the address of account %x to be known", account.SecureKey)
+		}
+		if *account.Address == tampered {
+			found = account.Balance == "1"
+		}
+	}
+	if !found || len(accounts) != 4 {
+		t.Fatalf("Expected the tampered account among the 4 modified ones, found %+v", accounts)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/zsmartex/avalanchego/utils/crypto"
 	"github.com/zsmartex/avalanchego/utils/formatting"
 	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/params"
 )
 
@@ -91,6 +92,84 @@ func (service *AvaxAPI) Version(r *http.Request, args *struct{}, reply *VersionR
 	return nil
 }
 
+// GetChainInfoReply gathers facts about the chain otherwise spread across
+// several APIs. Fields are only ever added, never renamed or removed.
+type GetChainInfoReply struct {
+	Version         string      `json:"version"`
+	CodecVersion    json.Uint16 `json:"codecVersion"`
+	NetworkID       json.Uint32 `json:"networkID"`    // Avalanche network ID
+	EthNetworkID    json.Uint64 `json:"ethNetworkID"` // As returned by net_version
+	EthChainID      json.Uint64 `json:"ethChainID"`   // As returned by eth_chainId
+	SubnetID        ids.ID      `json:"subnetID"`
+	BlockchainID    ids.ID      `json:"blockchainID"`
+	BlockchainAlias string      `json:"blockchainAlias"`
+	GenesisHash     common.Hash `json:"genesisHash"`
+
+	LastAcceptedHeight json.Uint64  `json:"lastAcceptedHeight"`
+	LastAcceptedHash   common.Hash  `json:"lastAcceptedHash"`
+	ActiveForks        []string     `json:"activeForks"` // Enabled at the last accepted block
+	RPCGasCap          json.Uint64  `json:"rpcGasCap"`
+	RPCTxFeeCap        json.Float64 `json:"rpcTxFeeCap"` // In AVAX
+}
+
+// GetChainInfo returns the identity, progress and configuration of the chain
+func (service *AvaxAPI) GetChainInfo(r *http.Request, args *struct{}, reply *GetChainInfoReply) error {
+	vm := service.vm
+	alias, err := vm.ctx.BCLookup.PrimaryAlias(vm.ctx.ChainID)
+	if err != nil {
+		return fmt.Errorf("failed to get primary alias for chain due to %w", err)
+	}
+	backend := vm.chain.APIBackend()
+	lastAccepted := vm.chain.LastAcceptedBlock()
+	rules := vm.chainConfig.AvalancheRules(lastAccepted.Number(), new(big.Int).SetUint64(lastAccepted.Time()))
+
+	reply.Version = Version
+	reply.CodecVersion = json.Uint16(codecVersion)
+	reply.NetworkID = json.Uint32(vm.ctx.NetworkID)
+	reply.EthNetworkID = json.Uint64(vm.networkID)
+	reply.EthChainID = json.Uint64(vm.chainConfig.ChainID.Uint64())
+	reply.SubnetID = vm.ctx.SubnetID
+	reply.BlockchainID = vm.ctx.ChainID
+	reply.BlockchainAlias = alias
+	reply.GenesisHash = vm.chain.GetGenesisBlock().Hash()
+	reply.LastAcceptedHeight = json.Uint64(lastAccepted.NumberU64())
+	reply.LastAcceptedHash = lastAccepted.Hash()
+	reply.ActiveForks = activeForks(rules)
+	reply.RPCGasCap = json.Uint64(backend.RPCGasCap())
+	reply.RPCTxFeeCap = json.Float64(backend.RPCTxFeeCap())
+	return nil
+}
+
+// activeForks returns the names of the forks enabled by [rules], in
+// activation order.
+func activeForks(rules params.Rules) []string {
+	forks := []struct {
+		name    string
+		enabled bool
+	}{
+		{"homestead", rules.IsHomestead},
+		{"eip150", rules.IsEIP150},
+		{"eip155", rules.IsEIP155},
+		{"eip158", rules.IsEIP158},
+		{"byzantium", rules.IsByzantium},
+		{"constantinople", rules.IsConstantinople},
+		{"petersburg", rules.IsPetersburg},
+		{"istanbul", rules.IsIstanbul},
+		{"apricotPhase1", rules.IsApricotPhase1},
+		{"apricotPhase2", rules.IsApricotPhase2},
+		{"apricotPhase3", rules.IsApricotPhase3},
+		{"apricotPhase4", rules.IsApricotPhase4},
+		{"apricotPhase5", rules.IsApricotPhase5},
+	}
+	active := make([]string, 0, len(forks))
+	for _, fork := range forks {
+		if fork.enabled {
+			active = append(active, fork.name)
+		}
+	}
+	return active
+}
+
 // ExportKeyArgs are arguments for ExportKey
 type ExportKeyArgs struct {
 	api.UserPass
@@ -251,6 +330,9 @@ func (service *AvaxAPI) Import(_ *http.Request, args *ImportArgs, response *api.
 	}
 
 	response.TxID = tx.ID()
+	if err := service.vm.checkTxPressure(); err != nil {
+		return err
+	}
 	return service.vm.issueTx(tx, true /*=local*/)
 }
 
@@ -267,6 +349,10 @@ type ExportAVAXArgs struct {
 	// ID of the address that will receive the AVAX. This address includes the
 	// chainID, which is used to determine what the destination chain is.
 	To string `json:"to"`
+
+	// Token overriding the export policy of the node, if the destination is
+	// not allowlisted and the amount exceeds its thresholds
+	OverrideToken string `json:"overrideToken"`
 }
 
 // ExportAVAX exports AVAX from the C-Chain to the X-Chain
@@ -287,7 +373,7 @@ type ExportArgs struct {
 
 // Export exports an asset from the C-Chain to the X-Chain
 // It must be imported on the X-Chain to complete the transfer
-func (service *AvaxAPI) Export(_ *http.Request, args *ExportArgs, response *api.JSONTxID) error {
+func (service *AvaxAPI) Export(_ *http.Request, args *ExportArgs, response *api.JSONTxID) (err error) {
 	log.Info("EVM: Export called")
 
 	assetID, err := service.parseAssetID(args.AssetID)
@@ -311,6 +397,21 @@ func (service *AvaxAPI) Export(_ *http.Request, args *ExportArgs, response *api.
 	}
 	defer db.Close()
 
+	if policy := service.vm.exportPolicy; policy != nil {
+		var record *exportRecord
+		record, err = policy.authorize(assetID, uint64(args.Amount), exportDestination{chainID: chainID, to: to}, args.OverrideToken)
+		if err != nil {
+			return err
+		}
+		// The export is no longer counted towards the rolling threshold if
+		// it is not issued
+		defer func() {
+			if err != nil {
+				policy.cancel(record)
+			}
+		}()
+	}
+
 	user := user{
 		secpFactory: &service.vm.secpFactory,
 		db:          db,
@@ -345,6 +446,9 @@ func (service *AvaxAPI) Export(_ *http.Request, args *ExportArgs, response *api.
 	}
 
 	response.TxID = tx.ID()
+	if err := service.vm.checkTxPressure(); err != nil {
+		return err
+	}
 	return service.vm.issueTx(tx, true /*=local*/)
 }
 
@@ -445,9 +549,40 @@ func (service *AvaxAPI) IssueTx(r *http.Request, args *api.FormattedTx, response
 	}
 
 	response.TxID = tx.ID()
+	if err := service.vm.checkTxPressure(); err != nil {
+		return err
+	}
 	return service.vm.issueTx(tx, true /*=local*/)
 }
 
+// DryRunAtomicTx verifies a signed atomic tx as it would be verified in a block
+// built on the last accepted block, without issuing it to the mempool, and
+// reports the first check it fails, its fee and the UTXOs it consumes and
+// produces.
+func (service *AvaxAPI) DryRunAtomicTx(r *http.Request, args *api.FormattedTx, reply *DryRunAtomicTxReply) error {
+	log.Info("EVM: DryRunAtomicTx called")
+
+	txBytes, err := formatting.Decode(args.Encoding, args.Tx)
+	if err != nil {
+		return fmt.Errorf("problem decoding transaction: %w", err)
+	}
+
+	tx := &Tx{}
+	if _, err := service.vm.codec.Unmarshal(txBytes, tx); err != nil {
+		return fmt.Errorf("problem parsing transaction: %w", err)
+	}
+	if err := tx.Sign(service.vm.codec, nil); err != nil {
+		return fmt.Errorf("problem initializing transaction: %w", err)
+	}
+
+	report, err := service.vm.dryRunAtomicTx(tx)
+	if err != nil {
+		return err
+	}
+	*reply = *report
+	return nil
+}
+
 // GetAtomicTxStatusReply defines the GetAtomicTxStatus replies returned from the API
 type GetAtomicTxStatusReply struct {
 	Status      Status       `json:"status"`
@@ -506,3 +641,162 @@ func (service *AvaxAPI) GetAtomicTx(r *http.Request, args *api.GetTxArgs, reply
 	}
 	return nil
 }
+
+// GetAtomicTxProofReply defines the GetAtomicTxProof replies returned from the API
+type GetAtomicTxProofReply struct {
+	Header *types.Header  `json:"header"`
+	Proof  *AtomicTxProof `json:"proof"`
+}
+
+// GetAtomicTxProof returns the header of the block the specified transaction
+// was accepted in, and a proof of its inclusion that can be checked against
+// the header with VerifyAtomicTxProof
+func (service *AvaxAPI) GetAtomicTxProof(r *http.Request, args *api.JSONTxID, reply *GetAtomicTxProofReply) error {
+	log.Info("EVM: GetAtomicTxProof called", "txID", args.TxID)
+
+	if args.TxID == ids.Empty {
+		return errNilTxID
+	}
+
+	proof, header, err := service.vm.getAtomicTxProof(args.TxID)
+	if err != nil {
+		return err
+	}
+	reply.Header = header
+	reply.Proof = proof
+	return nil
+}
+
+// GetAtomicTrieProofArgs are the arguments to GetAtomicTrieProof
+type GetAtomicTrieProofArgs struct {
+	Height json.Uint64 `json:"height"`
+	// Key in the atomic trie, the big endian height followed by the
+	// blockchainID of the atomic operations
+	Key hexutil.Bytes `json:"key"`
+}
+
+// GetAtomicTrieProof returns the atomic trie root committed at or before the
+// specified accepted height, and a proof of the value of the specified key in
+// it that can be checked against the root with VerifyAtomicTrieProof
+func (service *AvaxAPI) GetAtomicTrieProof(r *http.Request, args *GetAtomicTrieProofArgs, reply *AtomicTrieProof) error {
+	log.Info("EVM: GetAtomicTrieProof called", "height", args.Height, "key", args.Key)
+
+	proof, err := service.vm.getAtomicTrieProof(uint64(args.Height), args.Key)
+	if err != nil {
+		return err
+	}
+	*reply = *proof
+	return nil
+}
+
+// GetFullBalanceArgs are the arguments to GetFullBalance
+type GetFullBalanceArgs struct {
+	// EVM address of the account, in hex
+	Address string `json:"address"`
+	// Address owning the account's atomic UTXOs, in bech32. It is derived
+	// from the same key as [Address] but can't be computed from it.
+	UTXOAddress string `json:"utxoAddress"`
+}
+
+// GetFullBalanceReply defines the GetFullBalance replies returned from the API
+type GetFullBalanceReply struct {
+	BlockHeight json.Uint64   `json:"blockHeight"`
+	BlockHash   common.Hash   `json:"blockHash"`
+	EVM         BalanceAmount `json:"evm"`
+	UTXOs       BalanceAmount `json:"utxos"`
+	Pending     BalanceAmount `json:"pending"`
+	Total       BalanceAmount `json:"total"`
+}
+
+// GetFullBalance returns the AVAX of an account at the last accepted block:
+// its EVM balance, its atomic UTXOs awaiting import from the X and P chains
+// and the amounts locked in its atomic txs in the mempool, along with their
+// total
+func (service *AvaxAPI) GetFullBalance(r *http.Request, args *GetFullBalanceArgs, reply *GetFullBalanceReply) error {
+	log.Info("EVM: GetFullBalance called", "address", args.Address, "utxoAddress", args.UTXOAddress)
+
+	if !common.IsHexAddress(args.Address) {
+		return fmt.Errorf("invalid EVM address %q", args.Address)
+	}
+	utxoAddr, err := service.vm.ParseLocalAddress(args.UTXOAddress)
+	if err != nil {
+		return fmt.Errorf("couldn't parse address %q: %w", args.UTXOAddress, err)
+	}
+
+	balance, err := service.vm.getFullBalance(common.HexToAddress(args.Address), utxoAddr)
+	if err != nil {
+		return err
+	}
+	reply.BlockHeight = json.Uint64(balance.BlockHeight)
+	reply.BlockHash = balance.BlockHash
+	for _, component := range []struct {
+		amount *BalanceAmount
+		wei    *big.Int
+	}{
+		{&reply.EVM, balance.EVM},
+		{&reply.UTXOs, balance.UTXOs},
+		{&reply.Pending, balance.Pending},
+		{&reply.Total, balance.Total()},
+	} {
+		if *component.amount, err = newBalanceAmount(component.wei); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type GetSupplyDeltaArgs struct {
+	FromHeight json.Uint64 `json:"fromHeight"`
+	ToHeight   json.Uint64 `json:"toHeight"`
+}
+
+// SupplyTotals are amounts of nAVAX moved by atomic txs
+type SupplyTotals struct {
+	Imported json.Uint64 `json:"imported"`
+	Exported json.Uint64 `json:"exported"`
+	Burned   json.Uint64 `json:"burned"`
+}
+
+func newSupplyTotals(t supplyTotals) SupplyTotals {
+	return SupplyTotals{
+		Imported: json.Uint64(t.Imported),
+		Exported: json.Uint64(t.Exported),
+		Burned:   json.Uint64(t.Burned),
+	}
+}
+
+// GetSupplyDeltaReply defines the GetSupplyDelta replies returned from the API
+type GetSupplyDeltaReply struct {
+	FromHeight json.Uint64 `json:"fromHeight"`
+	ToHeight   json.Uint64 `json:"toHeight"`
+	// Delta is moved by the blocks after FromHeight up to ToHeight
+	Delta SupplyTotals `json:"delta"`
+	// FromCumulative and ToCumulative are counted from the block at
+	// CountedFrom, 0 unless the supply delta index awaits a backfill
+	FromCumulative SupplyTotals `json:"fromCumulative"`
+	ToCumulative   SupplyTotals `json:"toCumulative"`
+	CountedFrom    json.Uint64  `json:"countedFrom"`
+}
+
+// GetSupplyDelta returns the AVAX imported from shared memory, exported to it
+// and burned as fees by the atomic txs of the blocks accepted after
+// [FromHeight] up to [ToHeight], along with the cumulative totals at both
+// heights
+func (service *AvaxAPI) GetSupplyDelta(r *http.Request, args *GetSupplyDeltaArgs, reply *GetSupplyDeltaReply) error {
+	log.Info("EVM: GetSupplyDelta called", "fromHeight", args.FromHeight, "toHeight", args.ToHeight)
+
+	if service.vm.supplyIndex == nil {
+		return errSupplyDeltaOff
+	}
+	delta, err := service.vm.supplyIndex.supplyDelta(uint64(args.FromHeight), uint64(args.ToHeight))
+	if err != nil {
+		return err
+	}
+	reply.FromHeight = json.Uint64(delta.FromHeight)
+	reply.ToHeight = json.Uint64(delta.ToHeight)
+	reply.Delta = newSupplyTotals(delta.Delta)
+	reply.FromCumulative = newSupplyTotals(delta.FromTotals)
+	reply.ToCumulative = newSupplyTotals(delta.ToTotals)
+	reply.CountedFrom = json.Uint64(delta.CountedFrom)
+	return nil
+}
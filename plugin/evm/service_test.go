@@ -0,0 +1,107 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestGetChainInfo(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 500000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm)
+
+	service := &AvaxAPI{vm}
+	info := &GetChainInfoReply{}
+	if err := service.GetChainInfo(nil, nil, info); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare against the individual endpoints
+	version := &VersionReply{}
+	if err := service.Version(nil, nil, version); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version.Version {
+		t.Fatalf("Expected version %q, found %q", version.Version, info.Version)
+	}
+	front, err := (&SnowmanAPI{vm}).GetAcceptedFront(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LastAcceptedHash != front.Hash || uint64(info.LastAcceptedHeight) != front.Number.Uint64() || info.LastAcceptedHash != common.Hash(blk.ID()) {
+		t.Fatalf("Expected last accepted block %s at %d, found %s at %d", front.Hash, front.Number, info.LastAcceptedHash, info.LastAcceptedHeight)
+	}
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"public-eth", "internal-public-eth", "internal-public-blockchain", "net"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	var chainID hexutil.Big
+	if err := client.Call(&chainID, "eth_chainId"); err != nil {
+		t.Fatal(err)
+	}
+	if (*big.Int)(&chainID).Uint64() != uint64(info.EthChainID) {
+		t.Fatalf("Expected chain ID %d, found %d", (*big.Int)(&chainID), info.EthChainID)
+	}
+	var netVersion string
+	if err := client.Call(&netVersion, "net_version"); err != nil {
+		t.Fatal(err)
+	}
+	if netVersion != strconv.FormatUint(uint64(info.EthNetworkID), 10) {
+		t.Fatalf("Expected network ID %s, found %d", netVersion, info.EthNetworkID)
+	}
+	var blockNumber hexutil.Uint64
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(blockNumber) != uint64(info.LastAcceptedHeight) {
+		t.Fatalf("Expected height %d, found %d", blockNumber, info.LastAcceptedHeight)
+	}
+	var genesis struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := client.Call(&genesis, "eth_getBlockByNumber", "0x0", false); err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Hash != info.GenesisHash {
+		t.Fatalf("Expected genesis hash %s, found %s", genesis.Hash, info.GenesisHash)
+	}
+
+	if uint32(info.NetworkID) != vm.ctx.NetworkID || info.SubnetID != vm.ctx.SubnetID || info.BlockchainID != vm.ctx.ChainID {
+		t.Fatalf("Unexpected snow context in %+v", info)
+	}
+	if info.CodecVersion != 0 || uint64(info.RPCGasCap) != vm.config.RPCGasCap || float64(info.RPCTxFeeCap) != vm.config.RPCTxFeeCap {
+		t.Fatalf("Unexpected codec version or caps in %+v", info)
+	}
+	if forks := info.ActiveForks; len(forks) == 0 || forks[len(forks)-1] != "apricotPhase5" {
+		t.Fatalf("Expected forks up to apricotPhase5 to be active, found %v", forks)
+	}
+}
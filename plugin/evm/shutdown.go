@@ -0,0 +1,134 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/avalanchego/utils"
+)
+
+var (
+	errDraining          = errors.New("node draining ahead of shutdown")
+	errShutdownCancelled = errors.New("shutdown cancelled")
+)
+
+// drainingError is the error of the subscriptions refused while the node is
+// draining, with the "resource unavailable" code of EIP-1474 as the calls
+// rejected while syncing.
+type drainingError struct{}
+
+func (e *drainingError) Error() string  { return errDraining.Error() }
+func (e *drainingError) ErrorCode() int { return rpcSyncingErrorCode }
+
+// shutdownDrain coordinates the drain of the node ahead of a restart. While
+// draining, the node reports itself unhealthy so that load balancers stop
+// routing traffic to it, does not initiate the building of blocks and refuses
+// new subscriptions, while the calls and subscriptions in flight are served.
+type shutdownDrain struct {
+	// [pause] is called with whether block building is paused on each
+	// transition, with [lock] held
+	pause func(paused bool)
+
+	lock sync.Mutex
+	// [draining] is written with [lock] held, and read without it so that
+	// the health checks never wait on a transition
+	draining utils.AtomicBool
+	deadline time.Time
+	// [cancelled] is closed when the drain is cancelled
+	cancelled chan struct{}
+
+	drainingGauge    metrics.Gauge
+	preparedCounter  metrics.Counter
+	cancelledCounter metrics.Counter
+}
+
+func newShutdownDrain(pause func(paused bool)) *shutdownDrain {
+	return &shutdownDrain{
+		pause:            pause,
+		drainingGauge:    metrics.NewRegisteredGauge("shutdown/draining", nil),
+		preparedCounter:  metrics.NewRegisteredCounter("shutdown/prepared", nil),
+		cancelledCounter: metrics.NewRegisteredCounter("shutdown/cancelled", nil),
+	}
+}
+
+// isDraining returns whether the node is draining, false on a nil
+// [shutdownDrain].
+func (d *shutdownDrain) isDraining() bool {
+	if d == nil {
+		return false
+	}
+	return d.draining.GetValue()
+}
+
+// prepare starts draining the node for [duration], unless it is already
+// draining, and returns the deadline of the drain along with a channel closed
+// if it is cancelled. A drain in progress is not extended.
+func (d *shutdownDrain) prepare(duration time.Duration) (time.Time, <-chan struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.draining.GetValue() {
+		d.draining.SetValue(true)
+		d.deadline = time.Now().Add(duration)
+		d.cancelled = make(chan struct{})
+		d.pause(true)
+		d.drainingGauge.Update(1)
+		d.preparedCounter.Inc(1)
+		log.Info("Draining ahead of shutdown", "deadline", d.deadline)
+	}
+	return d.deadline, d.cancelled
+}
+
+// cancel ends the drain of the node, if any.
+func (d *shutdownDrain) cancel() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.draining.GetValue() {
+		return
+	}
+	d.draining.SetValue(false)
+	close(d.cancelled)
+	d.pause(false)
+	d.drainingGauge.Update(0)
+	d.cancelledCounter.Inc(1)
+	log.Info("Cancelled the drain ahead of shutdown")
+}
+
+// prepareShutdown drains the node for [duration] and waits for the deadline
+// of the drain, after which the node can be stopped. Returns
+// errShutdownCancelled if the drain is cancelled first.
+func (vm *VM) prepareShutdown(ctx context.Context, duration time.Duration) error {
+	deadline, cancelled := vm.shutdownDrain.prepare(duration)
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-cancelled:
+		return errShutdownCancelled
+	case <-vm.shutdownChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rpcGate rejects the calls of [method] while the node is syncing, and new
+// subscriptions while it is draining.
+func (vm *VM) rpcGate(method string) error {
+	if strings.HasSuffix(method, "_subscribe") && vm.shutdownDrain.isDraining() {
+		return &drainingError{}
+	}
+	return vm.readiness.gate(method)
+}
@@ -0,0 +1,224 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+)
+
+const (
+	shutdownStageHead     = "head"
+	shutdownStageSnapshot = "snapshot"
+	shutdownStageIndices  = "indices"
+	shutdownStageMetrics  = "metrics"
+)
+
+// shutdownBarrierKey holds the outcome of the last shutdown, written once its
+// stages are flushed and deleted at startup, so that a missing barrier marks
+// an unclean shutdown.
+var shutdownBarrierKey = []byte("shutdown_barrier")
+
+// shutdownBarrier records the stages flushed by a shutdown and the ones that
+// failed or timed out, which are repaired at startup.
+type shutdownBarrier struct {
+	Flushed   []string `json:"flushed"`
+	Unflushed []string `json:"unflushed"`
+}
+
+// shutdownStage is data of the accepted blocks held in memory or written
+// lazily, flushed at shutdown.
+type shutdownStage struct {
+	name    string
+	timeout time.Duration
+	flush   func() error
+	// repair restores the data of the stage at startup, up to the last
+	// accepted block, if it was not flushed.
+	repair func(lastAccepted *types.Block) error
+}
+
+// shutdownStages returns the stages flushed at shutdown, in priority order.
+func (vm *VM) shutdownStages() []shutdownStage {
+	bc := vm.chain.BlockChain()
+	return []shutdownStage{
+		{
+			name:    shutdownStageHead,
+			timeout: 5 * time.Second,
+			// The last accepted block is committed with its atomic txs, and
+			// may be replaced by an imported snapshot, so only the writes left
+			// pending are committed
+			flush: vm.db.Commit,
+			// The head of the chain may be a processing block, which is
+			// rewound to the last accepted block
+			repair: func(lastAccepted *types.Block) error {
+				if rawdb.ReadHeadBlockHash(vm.chaindb) == lastAccepted.Hash() {
+					return nil
+				}
+				log.Info("Rewinding the head of the chain to the last accepted block", "number", lastAccepted.Number(), "hash", lastAccepted.Hash())
+				return bc.SetPreference(lastAccepted)
+			},
+		},
+		{
+			name:    shutdownStageSnapshot,
+			timeout: 10 * time.Second,
+			// The diff layers of the accepted blocks are flushed when they are
+			// accepted, so only the progress of the generator is left
+			flush: func() error {
+				if snaps := bc.Snapshots(); snaps != nil {
+					snaps.AbortGeneration()
+				}
+				return nil
+			},
+			// A generator whose progress was lost resumes from the last one
+			// journalled, but a disk layer left off the last accepted block
+			// is regenerated
+			repair: func(lastAccepted *types.Block) error {
+				snaps := bc.Snapshots()
+				if snaps == nil || snaps.DiskRoot() == lastAccepted.Root() {
+					return nil
+				}
+				log.Warn("Regenerating the snapshot off the last accepted block", "diskRoot", snaps.DiskRoot(), "root", lastAccepted.Root())
+				snaps.Rebuild(lastAccepted.Hash(), lastAccepted.Root())
+				return nil
+			},
+		},
+		{
+			name:    shutdownStageIndices,
+			timeout: 30 * time.Second,
+			flush:   bc.StopAcceptedIndices,
+			// The indices queued at shutdown are written from the stored tip
+			// of their writer when the chain loads
+			repair: func(lastAccepted *types.Block) error {
+				if tip := bc.AcceptedIndicesTip(); tip.Hash() != lastAccepted.Hash() {
+					return fmt.Errorf("accepted indices written up to %d, below the last accepted block %d", tip.NumberU64(), lastAccepted.NumberU64())
+				}
+				return nil
+			},
+		},
+		{
+			name:    shutdownStageMetrics,
+			timeout: 2 * time.Second,
+			flush:   vm.counterSnapshotter.write,
+			// The increments since the last periodic write are not recorded
+			repair: func(*types.Block) error {
+				if vm.counterSnapshotter != nil {
+					log.Warn("Counters resume from their last periodic write, as the last shutdown did not persist them")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// flushShutdownBarrier flushes the stages of [vm] in priority order, each for
+// up to its timeout, and records those that were not flushed in the shutdown
+// barrier.
+func (vm *VM) flushShutdownBarrier() {
+	barrier := &shutdownBarrier{}
+	for _, stage := range vm.shutdownStages() {
+		start := time.Now()
+		if err := vm.flushShutdownStage(stage); err != nil {
+			log.Error("Failed to flush at shutdown, repairing it at startup", "stage", stage.name, "elapsed", time.Since(start), "err", err)
+			barrier.Unflushed = append(barrier.Unflushed, stage.name)
+			continue
+		}
+		log.Info("Flushed at shutdown", "stage", stage.name, "elapsed", time.Since(start))
+		barrier.Flushed = append(barrier.Flushed, stage.name)
+	}
+
+	blob, err := json.Marshal(barrier)
+	if err == nil {
+		err = vm.chaindb.Put(shutdownBarrierKey, blob)
+	}
+	if err != nil {
+		log.Error("Failed to write the shutdown barrier, repairing every stage at startup", "err", err)
+		return
+	}
+	log.Info("Wrote the shutdown barrier", "flushed", barrier.Flushed, "unflushed", barrier.Unflushed)
+}
+
+// flushShutdownStage flushes [stage], returning an error if it fails or
+// times out. A stage that times out keeps flushing in the background.
+func (vm *VM) flushShutdownStage(stage shutdownStage) error {
+	if vm.shutdownHook != nil {
+		if err := vm.shutdownHook(stage.name); err != nil {
+			return err
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- stage.flush() }()
+
+	timer := time.NewTimer(stage.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s", stage.timeout)
+	}
+}
+
+// readShutdownBarrier returns the shutdown barrier stored in [db], or nil if
+// there is none.
+func readShutdownBarrier(db ethdb.KeyValueReader) (*shutdownBarrier, error) {
+	has, err := db.Has(shutdownBarrierKey)
+	if err != nil || !has {
+		return nil, err
+	}
+	blob, err := db.Get(shutdownBarrierKey)
+	if err != nil {
+		return nil, err
+	}
+	barrier := new(shutdownBarrier)
+	if err := json.Unmarshal(blob, barrier); err != nil {
+		return nil, fmt.Errorf("invalid shutdown barrier: %w", err)
+	}
+	return barrier, nil
+}
+
+// repairShutdownBarrier repairs the stages that the last shutdown did not
+// flush, or every stage if it was unclean, and deletes the barrier. Nothing
+// is repaired on a [fresh] database.
+func (vm *VM) repairShutdownBarrier(fresh bool) error {
+	barrier, err := readShutdownBarrier(vm.chaindb)
+	if err != nil {
+		return err
+	}
+	stages := vm.shutdownStages()
+	unflushed := make(map[string]bool)
+	switch {
+	case fresh:
+	case barrier == nil:
+		log.Warn("No shutdown barrier found, repairing every stage of the last shutdown")
+		for _, stage := range stages {
+			unflushed[stage.name] = true
+		}
+	default:
+		for _, name := range barrier.Unflushed {
+			unflushed[name] = true
+		}
+	}
+
+	lastAccepted := vm.chain.LastAcceptedBlock()
+	for _, stage := range stages {
+		if !unflushed[stage.name] {
+			continue
+		}
+		if err := stage.repair(lastAccepted); err != nil {
+			return fmt.Errorf("failed to repair the %s stage of the last shutdown: %w", stage.name, err)
+		}
+		log.Info("Repaired the stage not flushed at the last shutdown", "stage", stage.name, "lastAccepted", lastAccepted.NumberU64())
+	}
+	if barrier == nil {
+		return nil
+	}
+	return vm.chaindb.Delete(shutdownBarrierKey)
+}
@@ -0,0 +1,182 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/database/manager"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/database/prefixdb"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// copyDBManager returns a copy of the current database of [dbManager], the
+// image left by a crash at the time of the copy.
+func copyDBManager(t *testing.T, dbManager manager.Manager) manager.Manager {
+	current := dbManager.Current()
+	db := memdb.New()
+	it := current.Database.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if err := db.Put(it.Key(), it.Value()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := manager.NewManagerFromDBs([]*manager.VersionedDatabase{{Database: db, Version: current.Version}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return copied
+}
+
+// TestShutdownBarrier interrupts the shutdown of a VM whose accepted indices
+// are not written yet after each stage, or fails one of its stages, and checks
+// that the restarted VM serves every accepted block.
+func TestShutdownBarrier(t *testing.T) {
+	tests := []struct {
+		name string
+		// crashBefore is the stage before which the database is copied, as
+		// left by a crash
+		crashBefore string
+		fail        string
+		unflushed   []string
+	}{
+		{name: "clean"},
+		{name: "crash after head", crashBefore: shutdownStageSnapshot},
+		{name: "crash after snapshot", crashBefore: shutdownStageIndices},
+		{name: "crash after indices", crashBefore: shutdownStageMetrics},
+		{name: "failed indices", fail: shutdownStageIndices, unflushed: []string{shutdownStageIndices}},
+		{name: "failed metrics", fail: shutdownStageMetrics, unflushed: []string{shutdownStageMetrics}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := `{"metrics-persistence-enabled":true}`
+			issuer, vm, dbManager, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+				testShortIDAddrs[0]: 50000000000,
+			})
+			importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+				t.Fatal(err)
+			}
+
+			// Stall the writer of the accepted indices on the import block,
+			// leaving the indices of the transfers queued
+			sub := vm.chain.BlockChain().SubscribeChainAcceptedEvent(make(chan core.ChainEvent))
+			vm.clock.Set(time.Now().Add(-time.Minute))
+			buildAndAcceptBlock(t, issuer, vm)
+			gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+			var txs []*types.Transaction
+			for nonce := uint64(0); nonce < 3; nonce++ {
+				tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+					t.Fatal(err)
+				}
+				vm.clock.Set(vm.clock.Time().Add(2 * time.Second))
+				buildAndAcceptBlock(t, issuer, vm)
+				txs = append(txs, tx)
+			}
+			lastAccepted := vm.chain.LastAcceptedBlock()
+
+			restartManager := dbManager
+			errInjected := errors.New("injected failure")
+			vm.shutdownHook = func(stage string) error {
+				if stage == test.crashBefore {
+					restartManager = copyDBManager(t, dbManager)
+				}
+				if stage == shutdownStageIndices {
+					sub.Unsubscribe()
+				}
+				if stage == test.fail {
+					return errInjected
+				}
+				return nil
+			}
+			if err := vm.Shutdown(); err != nil {
+				t.Fatal(err)
+			}
+			chaindb := Database{prefixdb.NewNested(ethDBPrefix, restartManager.Current().Database)}
+			barrier, err := readShutdownBarrier(chaindb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case test.crashBefore != "":
+				if barrier != nil {
+					t.Fatalf("Expected no shutdown barrier after a crash, found %+v", barrier)
+				}
+				if test.crashBefore != shutdownStageMetrics {
+					for _, tx := range txs {
+						if rawdb.ReadTxLookupEntry(chaindb, tx.Hash()) != nil {
+							t.Fatalf("Expected the lookup of tx %s not to be written before the crash", tx.Hash())
+						}
+					}
+				}
+			case barrier == nil || fmt.Sprint(barrier.Unflushed) != fmt.Sprint(test.unflushed) || len(barrier.Flushed)+len(barrier.Unflushed) != 4:
+				t.Fatalf("Expected a shutdown barrier with the stages %v unflushed, found %+v", test.unflushed, barrier)
+			}
+
+			restartedVM := &VM{}
+			if err := restartedVM.Initialize(
+				NewContext(),
+				restartManager,
+				[]byte(genesisJSONApricotPhase5),
+				[]byte(""),
+				[]byte(config),
+				issuer,
+				[]*engCommon.Fx{},
+				nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := restartedVM.Shutdown(); err != nil {
+					t.Fatal(err)
+				}
+			}()
+
+			// The restarted VM resumes from the last accepted block, with the
+			// indices and snapshot of every accepted block
+			if restarted := restartedVM.chain.LastAcceptedBlock(); restarted.Hash() != lastAccepted.Hash() {
+				t.Fatalf("Expected to resume from block %d, found %d", lastAccepted.NumberU64(), restarted.NumberU64())
+			}
+			for i, tx := range txs {
+				if _, hash, number, _ := rawdb.ReadTransaction(restartedVM.chaindb, tx.Hash()); hash == (common.Hash{}) || number != uint64(i+2) {
+					t.Fatalf("Expected tx %s in block %d, found %x/%d", tx.Hash(), i+2, hash, number)
+				}
+			}
+			if snaps := restartedVM.chain.BlockChain().Snapshots(); snaps.DiskRoot() != lastAccepted.Root() {
+				t.Fatalf("Expected the snapshot at root %s, found %s", lastAccepted.Root(), snaps.DiskRoot())
+			}
+			if barrier, err := readShutdownBarrier(restartedVM.chaindb); err != nil || barrier != nil {
+				t.Fatalf("Expected the shutdown barrier to be deleted at startup, found %+v (%v)", barrier, err)
+			}
+			if test.fail == "" && test.crashBefore == "" {
+				if count := restartedVM.blockCounters.txs.Count(); count != int64(len(txs)) {
+					t.Fatalf("Expected the counters to be restored to %d txs, found %d", len(txs), count)
+				}
+			}
+		})
+	}
+}
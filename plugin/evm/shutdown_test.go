@@ -0,0 +1,164 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/vms/components/chain"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestPrepareShutdown(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handlers[ethRPCEndpoint].Handler.(*rpc.Server))
+	defer client.Close()
+	subscribe := func() (*rpc.ClientSubscription, error) {
+		return client.EthSubscribe(context.Background(), make(chan *types.Header, 16), "newHeads")
+	}
+	existing, err := subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer existing.Unsubscribe()
+
+	// The lock of the chain is held as when the admin API is served, and
+	// released while the node drains
+	admin := NewAdminService(vm, "")
+	prepared := make(chan error, 1)
+	go func() {
+		reply := &api.SuccessResponse{}
+		prepared <- admin.PrepareShutdown(&http.Request{}, &PrepareShutdownArgs{DrainSeconds: json.Uint64(60)}, reply)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); !vm.shutdownDrain.isDraining(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the node to be draining")
+		}
+	}
+
+	// Draining is reported by the health check and the metrics, and repeated
+	// calls leave the drain unchanged
+	if _, err := vm.HealthCheck(); !errors.Is(err, errDraining) {
+		t.Fatalf("Expected the node to be reported draining, found %v", err)
+	}
+	drainDeadline := vm.shutdownDrain.deadline
+	if deadline, _ := vm.shutdownDrain.prepare(time.Hour); deadline != drainDeadline {
+		t.Fatalf("Expected the drain to keep its deadline %s, found %s", drainDeadline, deadline)
+	}
+	if draining, count := vm.shutdownDrain.drainingGauge.Value(), vm.shutdownDrain.preparedCounter.Count(); draining != 1 || count != 1 {
+		t.Fatalf("Expected a single drain in progress, found gauge %d and count %d", draining, count)
+	}
+
+	// New subscriptions are refused, while the existing one keeps running
+	_, err = subscribe()
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != rpcSyncingErrorCode {
+		t.Fatalf("Expected the subscription to be refused, found %v", err)
+	}
+	select {
+	case err := <-existing.Err():
+		t.Fatalf("Expected the existing subscription to keep running, found %v", err)
+	default:
+	}
+
+	// No block build is initiated
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-issuer:
+		t.Fatal("Expected no block build while draining")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// Cancelling the drain restores normal operation
+	for i := 0; i < 2; i++ {
+		if err := admin.CancelShutdown(&http.Request{}, &struct{}{}, &api.SuccessResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-prepared; !errors.Is(err, errShutdownCancelled) {
+		t.Fatalf("Expected the shutdown to be cancelled, found %v", err)
+	}
+	if draining, count := vm.shutdownDrain.drainingGauge.Value(), vm.shutdownDrain.cancelledCounter.Count(); draining != 0 || count != 1 {
+		t.Fatalf("Expected a single cancelled drain, found gauge %d and count %d", draining, count)
+	}
+	if _, err := vm.HealthCheck(); err != nil {
+		t.Fatalf("Expected a healthy node, found %v", err)
+	}
+	newSub, err := subscribe()
+	if err != nil {
+		t.Fatalf("Expected the subscription to be accepted, found %v", err)
+	}
+	newSub.Unsubscribe()
+
+	// The pending tx is built into a block once builds resume
+	select {
+	case <-issuer:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a block build once the drain is cancelled")
+	}
+	blk, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomicTxs := blk.(*chain.BlockWrapper).Block.(*Block).atomicTxs; len(atomicTxs) != 1 || atomicTxs[0].ID() != importTx.ID() {
+		t.Fatal("Expected the pending tx in the block")
+	}
+}
+
+func TestPrepareShutdownDeadline(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase4, "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// The call returns at the deadline, leaving the node draining until it is
+	// stopped
+	start := time.Now()
+	if err := vm.prepareShutdown(context.Background(), 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("Expected the call to return at the deadline, returned after %s", elapsed)
+	}
+	if !vm.shutdownDrain.isDraining() {
+		t.Fatal("Expected the node to keep draining after the deadline")
+	}
+	// Calls past the deadline return immediately
+	if err := vm.prepareShutdown(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	vm.shutdownDrain.cancel()
+	if vm.shutdownDrain.isDraining() {
+		t.Fatal("Expected the drain to be cancelled")
+	}
+}
@@ -0,0 +1,302 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+)
+
+const (
+	stallDiagnosticsPrefix = "stall-"
+	stallDiagnosticsSuffix = ".json"
+
+	// [slowCallThreshold] is the duration above which a consensus call is
+	// recorded in the slow log of the stall detector.
+	slowCallThreshold = time.Second
+	// [slowCallsHistory] is the number of slow consensus calls kept.
+	slowCallsHistory = 32
+)
+
+// Consensus calls whose last time is reported by the stall diagnostics.
+const (
+	consensusCallBuild         = "buildBlock"
+	consensusCallVerify        = "verify"
+	consensusCallSetPreference = "setPreference"
+	consensusCallAccept        = "accept"
+	consensusCallReject        = "reject"
+)
+
+var errChainStalled = errors.New("chain stalled")
+
+// SlowCall is a consensus call slower than [slowCallThreshold].
+type SlowCall struct {
+	Call     string    `json:"call"`
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+}
+
+// StallMempool summarizes the mempools when a stall is detected.
+type StallMempool struct {
+	AtomicTxs  int `json:"atomicTxs"`
+	PendingTxs int `json:"pendingTxs"`
+	QueuedTxs  int `json:"queuedTxs"`
+}
+
+// StallDiagnostics is the bundle captured when the acceptance of blocks
+// stalls.
+type StallDiagnostics struct {
+	Time               time.Time              `json:"time"`
+	LastAccepted       time.Time              `json:"lastAccepted"`
+	LastAcceptedHeight uint64                 `json:"lastAcceptedHeight"`
+	Peers              int                    `json:"peers"`
+	ConsensusCalls     map[string]time.Time   `json:"consensusCalls"`
+	Processing         *ProcessingBlocksReply `json:"processing"`
+	Mempool            StallMempool           `json:"mempool"`
+	// SlowCalls are ordered from the most recent
+	SlowCalls           []SlowCall `json:"slowCalls"`
+	Goroutines          string     `json:"goroutines"`
+	GoroutinesTruncated bool       `json:"goroutinesTruncated"`
+}
+
+// stallDetector detects that no block was accepted for [threshold] while peers
+// are connected and the mempools hold transactions. On the transition to
+// stalled, it captures a bundle of diagnostics to [dir], keeping the last
+// [maxFiles], reports the chain unhealthy and marks the stall metrics, until
+// a block is accepted. The goroutine dump of a bundle is truncated to
+// [maxGoroutineBytes].
+type stallDetector struct {
+	vm    *VM
+	clock *mockable.Clock
+
+	threshold         time.Duration
+	dir               string
+	maxFiles          int
+	maxGoroutineBytes int
+
+	lock         sync.Mutex
+	lastAccepted time.Time
+	calls        map[string]time.Time
+	// [slow] is a ring of the last [slowCallsHistory] slow calls, the oldest
+	// at [next] once it is full
+	slow    []SlowCall
+	next    int
+	stalled bool
+
+	stalledGauge  metrics.Gauge
+	stallsCounter metrics.Counter
+}
+
+func (vm *VM) newStallDetector() *stallDetector {
+	return &stallDetector{
+		vm:                vm,
+		clock:             &vm.clock,
+		threshold:         vm.config.StallThreshold.Duration,
+		dir:               vm.config.StallDiagnosticsDir,
+		maxFiles:          vm.config.StallDiagnosticsMaxFiles,
+		maxGoroutineBytes: vm.config.StallDiagnosticsMaxGoroutineBytes,
+		lastAccepted:      vm.clock.Time(),
+		calls:             make(map[string]time.Time),
+		stalledGauge:      metrics.NewRegisteredGauge("chain/stall/stalled", nil),
+		stallsCounter:     metrics.NewRegisteredCounter("chain/stall/detected", nil),
+	}
+}
+
+// start checks for a stall every quarter of the threshold, until
+// [shutdownChan] is closed.
+func (d *stallDetector) start(vm *VM) {
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(func() {
+		defer vm.shutdownWg.Done()
+
+		ticker := time.NewTicker(d.threshold / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.check()
+			case <-vm.shutdownChan:
+				return
+			}
+		}
+	})
+}
+
+// called records the consensus call [call] started at [start], in the slow
+// log if it took longer than [slowCallThreshold].
+func (d *stallDetector) called(call string, start time.Time) {
+	if d == nil {
+		return
+	}
+	now := d.clock.Time()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.calls[call] = now
+	if duration := now.Sub(start); duration >= slowCallThreshold {
+		slow := SlowCall{Call: call, Start: start, Duration: duration.String()}
+		if len(d.slow) < slowCallsHistory {
+			d.slow = append(d.slow, slow)
+			return
+		}
+		d.slow[d.next] = slow
+		d.next = (d.next + 1) % slowCallsHistory
+	}
+}
+
+// accepted records the acceptance of a block, ending a stall.
+func (d *stallDetector) accepted() {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.lastAccepted = d.clock.Time()
+	if d.stalled {
+		d.stalled = false
+		d.stalledGauge.Update(0)
+		log.Info("Chain stall recovered", "height", d.vm.chain.LastAcceptedBlock().NumberU64())
+	}
+}
+
+// stallErr returns an error if the chain is stalled.
+func (d *stallDetector) stallErr() error {
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.stalled {
+		return nil
+	}
+	return fmt.Errorf("%w: no block accepted since %s", errChainStalled, d.lastAccepted.UTC().Format(time.RFC3339))
+}
+
+// check detects a stall, capturing its diagnostics on the transition to
+// stalled.
+func (d *stallDetector) check() {
+	d.lock.Lock()
+	now := d.clock.Time()
+	// The acceptance of blocks is not expected before the chain is bootstrapped
+	if !d.vm.health.bootstrapped.GetValue() {
+		d.lastAccepted = now
+		d.lock.Unlock()
+		return
+	}
+	if d.stalled || now.Sub(d.lastAccepted) < d.threshold {
+		d.lock.Unlock()
+		return
+	}
+	peers := int(d.vm.Network.Size())
+	pending, queued := d.vm.chain.GetTxPool().Stats()
+	mempool := StallMempool{AtomicTxs: d.vm.mempool.Len(), PendingTxs: pending, QueuedTxs: queued}
+	if peers == 0 || mempool.AtomicTxs+mempool.PendingTxs+mempool.QueuedTxs == 0 {
+		d.lock.Unlock()
+		return
+	}
+	d.stalled = true
+	d.stalledGauge.Update(1)
+	d.stallsCounter.Inc(1)
+	// The state of the detector is copied, so that the consensus calls do not
+	// wait on the capture
+	diagnostics := &StallDiagnostics{
+		Time:           now.UTC(),
+		LastAccepted:   d.lastAccepted.UTC(),
+		Peers:          peers,
+		ConsensusCalls: make(map[string]time.Time, len(d.calls)),
+		Mempool:        mempool,
+		SlowCalls:      make([]SlowCall, 0, len(d.slow)),
+	}
+	for call, at := range d.calls {
+		diagnostics.ConsensusCalls[call] = at.UTC()
+	}
+	for i := range d.slow {
+		diagnostics.SlowCalls = append(diagnostics.SlowCalls, d.slow[(d.next-1-i+2*len(d.slow))%len(d.slow)])
+	}
+	d.lock.Unlock()
+
+	log.Error("Chain stalled", "lastAccepted", diagnostics.LastAccepted, "peers", peers, "atomicTxs", mempool.AtomicTxs, "pendingTxs", pending, "queuedTxs", queued)
+	if d.dir == "" {
+		return
+	}
+	if err := d.capture(diagnostics); err != nil {
+		log.Error("Failed to write the stall diagnostics", "dir", d.dir, "err", err)
+	}
+}
+
+// capture completes [diagnostics] and writes them to [d.dir], removing the
+// oldest bundles in excess of [d.maxFiles].
+func (d *stallDetector) capture(diagnostics *StallDiagnostics) error {
+	diagnostics.LastAcceptedHeight = d.vm.chain.LastAcceptedBlock().NumberU64()
+	diagnostics.Processing = d.vm.processingBlocks.processing()
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return err
+	}
+	diagnostics.Goroutines = goroutines.String()
+	if d.maxGoroutineBytes > 0 && len(diagnostics.Goroutines) > d.maxGoroutineBytes {
+		diagnostics.Goroutines = diagnostics.Goroutines[:d.maxGoroutineBytes]
+		diagnostics.GoroutinesTruncated = true
+	}
+	blob, err := json.MarshalIndent(diagnostics, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return err
+	}
+	// Names sort in the order the bundles were written
+	path := filepath.Join(d.dir, fmt.Sprintf("%s%019d%s", stallDiagnosticsPrefix, diagnostics.Time.UnixNano(), stallDiagnosticsSuffix))
+	if err := os.WriteFile(path, blob, 0o644); err != nil {
+		return err
+	}
+	log.Warn("Wrote the stall diagnostics", "path", path)
+
+	paths, err := stallDiagnosticsPaths(d.dir)
+	if err != nil {
+		return err
+	}
+	for d.maxFiles > 0 && len(paths) > d.maxFiles {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
+
+// stallDiagnosticsPaths returns the paths of the stall diagnostics in [dir],
+// from the oldest.
+func stallDiagnosticsPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, stallDiagnosticsPrefix) && strings.HasSuffix(name, stallDiagnosticsSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
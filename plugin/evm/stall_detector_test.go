@@ -0,0 +1,87 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/version"
+)
+
+// TestStallDetector checks that a stall is only detected once peers are
+// connected and the mempool holds txs, that a single bundle of diagnostics is
+// captured per stall and that the chain is healthy again once a block is
+// accepted.
+func TestStallDetector(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisJSON, err := fundAddressByGenesis([]common.Address{crypto.PubkeyToAddress(key.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	configJSON := fmt.Sprintf(`{"stall-threshold": "1h", "stall-diagnostics-dir": %q}`, dir)
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSON, configJSON, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	detector := vm.stallDetector
+	vm.clock.Set(detector.lastAccepted.Add(2 * time.Hour))
+
+	// Without peers nor pending txs, an idle chain is not stalled
+	detector.check()
+	if err := detector.stallErr(); err != nil {
+		t.Fatalf("Expected an idle chain not to be stalled, found %s", err)
+	}
+	if err := vm.Network.Connected(ids.GenerateTestShortID(), version.NewDefaultApplication("corethtest", 1, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	detector.check()
+	if err := detector.stallErr(); err != nil {
+		t.Fatalf("Expected a chain without pending txs not to be stalled, found %s", err)
+	}
+
+	vm.chain.GetTxPool().SetGasPrice(common.Big1)
+	vm.chain.GetTxPool().SetMinFee(common.Big0)
+	for _, err := range vm.chain.GetTxPool().AddRemotesSync(getValidEthTxs(key, 1, common.Big1)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		detector.check()
+	}
+	if _, err := vm.HealthCheck(); !errors.Is(err, errChainStalled) {
+		t.Fatalf("Expected the stalled chain to be unhealthy, found %v", err)
+	}
+	if stalled := detector.stalledGauge.Value(); stalled != 1 {
+		t.Fatalf("Expected the stalled gauge to be 1, found %d", stalled)
+	}
+	paths, err := stallDiagnosticsPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("Expected a single bundle of diagnostics per stall, found %d", len(paths))
+	}
+
+	detector.accepted()
+	if _, err := vm.HealthCheck(); err != nil {
+		t.Fatalf("Expected the chain to be healthy once a block is accepted, found %s", err)
+	}
+	if stalled := detector.stalledGauge.Value(); stalled != 0 {
+		t.Fatalf("Expected the stalled gauge to be 0, found %d", stalled)
+	}
+}
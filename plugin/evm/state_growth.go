@@ -0,0 +1,376 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+
+	"github.com/zsmartex/coreth/core/state"
+)
+
+// [stateGrowthMaxTopN] is the maximum number of contracts reported by a call
+// to debug_getStateGrowth.
+const stateGrowthMaxTopN = 1000
+
+var (
+	// Prefixes of the state growth index in [vm.db]
+	stateGrowthPrefix     = []byte("state_growth")
+	stateGrowthMetaPrefix = []byte("state_growth_meta")
+
+	// [stateGrowthEpochKey] holds the number of heights of an epoch,
+	// [stateGrowthFromKey] the first height of the accepted blocks indexed
+	// without a gap and still retained, and [stateGrowthLastKey] the last one.
+	stateGrowthEpochKey = []byte("epoch")
+	stateGrowthFromKey  = []byte("from")
+	stateGrowthLastKey  = []byte("last")
+
+	errStateGrowthOff      = errors.New("state growth index is disabled")
+	errStateGrowthNotFound = errors.New("no accepted block is indexed")
+)
+
+const (
+	stateGrowthKeyLen   = wrappers.LongLen + common.AddressLength
+	stateGrowthEntryLen = 3 * wrappers.LongLen
+)
+
+// stateGrowthKey is the key of the growth of [addr] in [epoch]. The keys are
+// ordered by epoch, so that the epochs are read and pruned in ranges.
+func stateGrowthKey(epoch uint64, addr common.Address) []byte {
+	key := make([]byte, stateGrowthKeyLen)
+	binary.BigEndian.PutUint64(key, epoch)
+	copy(key[wrappers.LongLen:], addr[:])
+	return key
+}
+
+func stateGrowthBytes(g state.StorageGrowth) []byte {
+	b := make([]byte, stateGrowthEntryLen)
+	binary.BigEndian.PutUint64(b, g.SlotsCreated)
+	binary.BigEndian.PutUint64(b[wrappers.LongLen:], g.SlotsDeleted)
+	binary.BigEndian.PutUint64(b[2*wrappers.LongLen:], g.CodeBytes)
+	return b
+}
+
+func parseStateGrowth(b []byte) (state.StorageGrowth, error) {
+	if len(b) != stateGrowthEntryLen {
+		return state.StorageGrowth{}, fmt.Errorf("state growth must be %d bytes, found %d", stateGrowthEntryLen, len(b))
+	}
+	return state.StorageGrowth{
+		SlotsCreated: binary.BigEndian.Uint64(b),
+		SlotsDeleted: binary.BigEndian.Uint64(b[wrappers.LongLen:]),
+		CodeBytes:    binary.BigEndian.Uint64(b[2*wrappers.LongLen:]),
+	}, nil
+}
+
+func addStateGrowth(g, other state.StorageGrowth) state.StorageGrowth {
+	return state.StorageGrowth{
+		SlotsCreated: g.SlotsCreated + other.SlotsCreated,
+		SlotsDeleted: g.SlotsDeleted + other.SlotsDeleted,
+		CodeBytes:    g.CodeBytes + other.CodeBytes,
+	}
+}
+
+// stateGrowthIndex records the storage slots created and deleted, and the code
+// deployed, by each account of the accepted blocks, summed by epochs of
+// [epochBlocks] heights. The growth of a block is taken from the changes
+// written by the state commit of its processing, rather than from a walk of
+// its tries, and the storage of destructed contracts is not counted.
+//
+// The index is written to [vm.db] on Accept, so that it is committed with the
+// accepted blocks. It covers the blocks accepted while it is enabled, from the
+// height reported as [stateGrowthFromKey]. If [epochsRetained] is positive,
+// the epochs before the last [epochsRetained] ones are pruned as new epochs
+// start.
+type stateGrowthIndex struct {
+	lock sync.RWMutex
+
+	db     database.Database
+	metaDB database.Database
+
+	epochBlocks    uint64
+	epochsRetained uint64
+
+	from, last uint64
+	// [fromStored] is false until [from] is written with the first indexed
+	// block.
+	fromStored bool
+}
+
+// newStateGrowthIndex returns the state growth index held in [db] and
+// [metaDB], or a new one indexing the blocks accepted after [lastAccepted]. If
+// blocks were accepted while the index was disabled, or the epochs were
+// resized, the index is restarted from the block after [lastAccepted].
+func newStateGrowthIndex(db, metaDB database.Database, epochBlocks, epochsRetained, lastAccepted uint64) (*stateGrowthIndex, error) {
+	idx := &stateGrowthIndex{
+		db:             db,
+		metaDB:         metaDB,
+		epochBlocks:    epochBlocks,
+		epochsRetained: epochsRetained,
+		from:           lastAccepted + 1,
+		last:           lastAccepted,
+	}
+	storedEpochBlocks, err := database.GetUInt64(metaDB, stateGrowthEpochKey)
+	if err == database.ErrNotFound {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	last, err := database.GetUInt64(metaDB, stateGrowthLastKey)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case storedEpochBlocks != epochBlocks:
+		log.Warn("State growth index epochs were resized, restarting from the last accepted block", "stored", storedEpochBlocks, "configured", epochBlocks)
+		return idx, idx.clear()
+	case last != lastAccepted:
+		log.Warn("State growth index has a gap, restarting from the last accepted block", "lastIndexed", last, "lastAccepted", lastAccepted)
+		return idx, idx.clear()
+	}
+	from, err := database.GetUInt64(metaDB, stateGrowthFromKey)
+	if err != nil {
+		return nil, err
+	}
+	idx.from, idx.fromStored = from, true
+	return idx, nil
+}
+
+// clear deletes the entries of the index, so that it is written again from
+// [idx.from].
+func (idx *stateGrowthIndex) clear() error {
+	for _, db := range []database.Database{idx.db, idx.metaDB} {
+		if err := deleteKeys(db, nil); err != nil {
+			return err
+		}
+	}
+	idx.fromStored = false
+	return nil
+}
+
+// deleteKeys deletes the keys of [db] below [end], or every key if [end] is
+// nil. The keys are deleted once read, as [db] may not be modified while it
+// is iterated.
+func deleteKeys(db database.Database, end []byte) error {
+	var keys [][]byte
+	it := db.NewIterator()
+	for it.Next() && (end == nil || bytes.Compare(it.Key(), end) < 0) {
+		keys = append(keys, common.CopyBytes(it.Key()))
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := db.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index adds the [growth] of the accounts of the block accepted at [height] to
+// its epoch. If the growth of the block is not [known], the index is restarted
+// from the next height, as its epoch would be incomplete.
+func (idx *stateGrowthIndex) index(height uint64, growth map[common.Address]state.StorageGrowth, known bool) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	if !known {
+		log.Warn("State growth of the accepted block is unknown, restarting the state growth index", "height", height)
+		idx.from = height + 1
+		if err := idx.clear(); err != nil {
+			return err
+		}
+		idx.last = height
+		return database.PutUInt64(idx.metaDB, stateGrowthLastKey, height)
+	}
+
+	epoch := height / idx.epochBlocks
+	for addr, g := range growth {
+		key := stateGrowthKey(epoch, addr)
+		if b, err := idx.db.Get(key); err == nil {
+			stored, err := parseStateGrowth(b)
+			if err != nil {
+				return err
+			}
+			g = addStateGrowth(stored, g)
+		} else if err != database.ErrNotFound {
+			return err
+		}
+		if err := idx.db.Put(key, stateGrowthBytes(g)); err != nil {
+			return err
+		}
+	}
+	if !idx.fromStored {
+		if err := database.PutUInt64(idx.metaDB, stateGrowthEpochKey, idx.epochBlocks); err != nil {
+			return err
+		}
+		if err := database.PutUInt64(idx.metaDB, stateGrowthFromKey, idx.from); err != nil {
+			return err
+		}
+		idx.fromStored = true
+	}
+	if err := idx.prune(epoch); err != nil {
+		return err
+	}
+	idx.last = height
+	return database.PutUInt64(idx.metaDB, stateGrowthLastKey, height)
+}
+
+// prune deletes the epochs before the last [idx.epochsRetained] ones up to
+// [epoch], if they are not retained forever.
+func (idx *stateGrowthIndex) prune(epoch uint64) error {
+	if idx.epochsRetained == 0 || epoch < idx.epochsRetained {
+		return nil
+	}
+	retainedFrom := (epoch - idx.epochsRetained + 1) * idx.epochBlocks
+	if idx.from >= retainedFrom {
+		return nil
+	}
+	if err := deleteKeys(idx.db, heightKey(retainedFrom/idx.epochBlocks)); err != nil {
+		return err
+	}
+	idx.from = retainedFrom
+	return database.PutUInt64(idx.metaDB, stateGrowthFromKey, retainedFrom)
+}
+
+// StateGrowth is the state added and removed by a contract, or by every
+// account.
+type StateGrowth struct {
+	SlotsCreated hexutil.Uint64 `json:"slotsCreated"`
+	SlotsDeleted hexutil.Uint64 `json:"slotsDeleted"`
+	NetSlots     *hexutil.Big   `json:"netSlots"` // Created minus deleted, which may be negative
+	CodeBytes    hexutil.Uint64 `json:"codeBytes"`
+}
+
+func newStateGrowth(g state.StorageGrowth) StateGrowth {
+	net := new(big.Int).SetUint64(g.SlotsCreated)
+	net.Sub(net, new(big.Int).SetUint64(g.SlotsDeleted))
+	return StateGrowth{
+		SlotsCreated: hexutil.Uint64(g.SlotsCreated),
+		SlotsDeleted: hexutil.Uint64(g.SlotsDeleted),
+		NetSlots:     (*hexutil.Big)(net),
+		CodeBytes:    hexutil.Uint64(g.CodeBytes),
+	}
+}
+
+// ContractStateGrowth is the state growth of a contract.
+type ContractStateGrowth struct {
+	Address common.Address `json:"address"`
+	StateGrowth
+}
+
+// StateGrowthReport is the state growth of the contracts growing the state the
+// most over a range of heights.
+type StateGrowthReport struct {
+	// FromHeight and ToHeight are the heights covered by the report, the
+	// range requested widened to whole epochs and narrowed to the heights
+	// indexed
+	FromHeight hexutil.Uint64 `json:"fromHeight"`
+	ToHeight   hexutil.Uint64 `json:"toHeight"`
+	// Totals is the growth of every account
+	Totals    StateGrowth           `json:"totals"`
+	Contracts []ContractStateGrowth `json:"contracts"` // Ordered by net slots added, then address
+}
+
+// report returns the growth of the [topN] accounts adding the most slots in
+// the epochs of the heights [from] to [to].
+func (idx *stateGrowthIndex) report(from, to uint64, topN int) (*StateGrowthReport, error) {
+	if from > to {
+		return nil, fmt.Errorf("fromHeight %d is above toHeight %d", from, to)
+	}
+	if topN <= 0 || topN > stateGrowthMaxTopN {
+		topN = stateGrowthMaxTopN
+	}
+
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	if idx.last < idx.from {
+		return nil, errStateGrowthNotFound
+	}
+	if to < idx.from || from > idx.last {
+		return nil, fmt.Errorf("heights %d to %d are not indexed, the index covers heights %d to %d", from, to, idx.from, idx.last)
+	}
+	fromEpoch, toEpoch := from/idx.epochBlocks, to/idx.epochBlocks
+	report := &StateGrowthReport{
+		FromHeight: hexutil.Uint64(fromEpoch * idx.epochBlocks),
+		ToHeight:   hexutil.Uint64((toEpoch+1)*idx.epochBlocks - 1),
+	}
+	if uint64(report.FromHeight) < idx.from {
+		report.FromHeight = hexutil.Uint64(idx.from)
+	}
+	if uint64(report.ToHeight) > idx.last {
+		report.ToHeight = hexutil.Uint64(idx.last)
+	}
+
+	var (
+		growth = make(map[common.Address]state.StorageGrowth)
+		totals state.StorageGrowth
+	)
+	it := idx.db.NewIteratorWithStart(heightKey(fromEpoch))
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != stateGrowthKeyLen {
+			return nil, fmt.Errorf("malformed state growth key %x", key)
+		}
+		if binary.BigEndian.Uint64(key) > toEpoch {
+			break
+		}
+		g, err := parseStateGrowth(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		addr := common.BytesToAddress(key[wrappers.LongLen:])
+		growth[addr] = addStateGrowth(growth[addr], g)
+		totals = addStateGrowth(totals, g)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	report.Totals = newStateGrowth(totals)
+	report.Contracts = make([]ContractStateGrowth, 0, len(growth))
+	for addr, g := range growth {
+		report.Contracts = append(report.Contracts, ContractStateGrowth{Address: addr, StateGrowth: newStateGrowth(g)})
+	}
+	sort.Slice(report.Contracts, func(i, j int) bool {
+		if c := report.Contracts[i].NetSlots.ToInt().Cmp(report.Contracts[j].NetSlots.ToInt()); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(report.Contracts[i].Address[:], report.Contracts[j].Address[:]) < 0
+	})
+	if len(report.Contracts) > topN {
+		report.Contracts = report.Contracts[:topN]
+	}
+	return report, nil
+}
+
+// StateGrowthAPI serves the state growth index in the debug namespace.
+type StateGrowthAPI struct{ vm *VM }
+
+// GetStateGrowth returns the [topN] contracts adding the most storage slots in
+// the epochs of the accepted heights [fromHeight] to [toHeight], with the
+// growth of every account.
+func (api *StateGrowthAPI) GetStateGrowth(fromHeight, toHeight hexutil.Uint64, topN int) (*StateGrowthReport, error) {
+	if api.vm.stateGrowthIndex == nil {
+		return nil, errStateGrowthOff
+	}
+	return api.vm.stateGrowthIndex.report(uint64(fromHeight), uint64(toHeight), topN)
+}
@@ -0,0 +1,106 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// fillerInitCode deploys a 32 byte contract storing the value of the calldata
+// (start, count, value) in the count slots from start.
+var fillerInitCode = common.FromHex("0x6020600c60003960206000f3" +
+	"604035602035600035" + "5b8115601e57828155600101906001900390600956" + "5b00")
+
+func TestStateGrowthIndex(t *testing.T) {
+	tvm := testutils.NewTestVM(t, `{"state-growth-index-enabled":true,"state-growth-epoch-blocks":2,"state-growth-epochs-retained":2}`, testutils.GenesisJSON(params.TestApricotPhase2Config))
+	client := tvm.Client()
+	keys, owners := newKeys(t, 1)
+
+	tvm.FundAddress(owners[0], 10_000_000_000)
+	tvm.BuildAndAccept(t)
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	tvm.SendTx(t, types.NewContractCreation(0, common.Big0, 100_000, gasPrice, fillerInitCode), keys[0])
+	tvm.SendTx(t, types.NewContractCreation(1, common.Big0, 100_000, gasPrice, fillerInitCode), keys[0])
+	tvm.BuildAndAccept(t)
+	heavy, light := ethcrypto.CreateAddress(owners[0], 0), ethcrypto.CreateAddress(owners[0], 1)
+
+	nonce := uint64(2)
+	fill := func(contract common.Address, start, count, value int64) {
+		var data []byte
+		for _, word := range []int64{start, count, value} {
+			data = append(data, common.LeftPadBytes(big.NewInt(word).Bytes(), 32)...)
+		}
+		tvm.SendTx(t, types.NewTransaction(nonce, contract, common.Big0, 1_000_000, gasPrice, data), keys[0])
+		nonce++
+	}
+	// Block 3 fills both contracts, block 4 clears part of the heavy one and
+	// block 5 fills it further
+	fill(heavy, 0, 30, 1)
+	fill(light, 0, 5, 1)
+	tvm.BuildAndAccept(t)
+	fill(heavy, 0, 10, 0)
+	fill(light, 5, 3, 1)
+	// Rewrites of existing slots do not grow the state
+	fill(heavy, 20, 10, 2)
+	tvm.BuildAndAccept(t)
+	fill(heavy, 30, 10, 1)
+	tvm.BuildAndAccept(t)
+
+	type growth struct {
+		created, deleted uint64
+		net              int64
+		code             uint64
+	}
+	check := func(name string, found evm.StateGrowth, expected growth) {
+		if uint64(found.SlotsCreated) != expected.created || uint64(found.SlotsDeleted) != expected.deleted ||
+			found.NetSlots.ToInt().Int64() != expected.net || uint64(found.CodeBytes) != expected.code {
+			t.Fatalf("Expected the growth of %s to be %+v, found %+v (net %d)", name, expected, found, found.NetSlots.ToInt())
+		}
+	}
+	getStateGrowth := func(from, to uint64, topN int) (*evm.StateGrowthReport, error) {
+		var report *evm.StateGrowthReport
+		err := client.Call(&report, "debug_getStateGrowth", hexutil.Uint64(from), hexutil.Uint64(to), topN)
+		return report, err
+	}
+
+	// Epoch 0 is pruned as epoch 2 starts, so that the index starts at 2
+	report, err := getStateGrowth(0, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FromHeight != 2 || report.ToHeight != 5 || len(report.Contracts) != 1 || report.Contracts[0].Address != heavy {
+		t.Fatalf("Expected contract %s to top the report of heights 2 to 5, found %+v", heavy.Hex(), report)
+	}
+	check("the heavy contract", report.Contracts[0].StateGrowth, growth{created: 40, deleted: 10, net: 30, code: 32})
+	check("every account", report.Totals, growth{created: 48, deleted: 10, net: 38, code: 64})
+
+	// The range is widened to the epoch of heights 4 and 5, where the deleted
+	// slots of the heavy contract offset its new ones
+	report, err = getStateGrowth(4, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FromHeight != 4 || report.ToHeight != 5 || len(report.Contracts) != 2 || report.Contracts[0].Address != light || report.Contracts[1].Address != heavy {
+		t.Fatalf("Expected contracts %s and %s in the report of heights 4 to 5, found %+v", light.Hex(), heavy.Hex(), report)
+	}
+	check("the light contract", report.Contracts[0].StateGrowth, growth{created: 3, net: 3})
+	check("the heavy contract", report.Contracts[1].StateGrowth, growth{created: 10, deleted: 10})
+
+	if _, err := getStateGrowth(0, 1, 0); err == nil {
+		t.Fatal("Expected the report of pruned heights to fail")
+	}
+	if _, err := getStateGrowth(5, 4, 0); err == nil {
+		t.Fatal("Expected the report of a reversed range to fail")
+	}
+}
@@ -0,0 +1,793 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/perms"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/ethdb"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/trie"
+)
+
+const (
+	stateSnapshotVersion      = 1
+	stateSnapshotManifestFile = "manifest.json"
+	stateSnapshotProgressFile = "progress.json"
+
+	// stateSnapshotHeaders is the number of headers up to and including the
+	// exported block that are included in a snapshot, enough to serve the
+	// BLOCKHASH opcode for the blocks built on top of it.
+	stateSnapshotHeaders = 256
+
+	// stateSnapshotChunkAccounts is the number of accounts written to each
+	// state section. Export resumes from the last completed section.
+	stateSnapshotChunkAccounts = 10_000
+
+	// stateSnapshotApplyBatch is the number of heights of atomic operations
+	// read from the atomic repository at a time while applying them to
+	// shared memory during import.
+	stateSnapshotApplyBatch = 1024
+)
+
+// Kinds of entries stored in state snapshot sections
+const (
+	snapshotEntryTrieNode uint8 = iota
+	snapshotEntryCode
+	snapshotEntryHeader
+	snapshotEntryBlock
+	snapshotEntryAtomicTrieNode
+	snapshotEntryAtomicTxs
+)
+
+var (
+	stateSnapshotImportKey = []byte("state_snapshot_import")
+	emptyCodeHash          = crypto.Keccak256Hash(nil)
+
+	errSnapshotImportAfterBootstrap = errors.New("state snapshots can only be imported before normal operation")
+	errSnapshotImportNotFresh       = errors.New("state snapshots can only be imported into a node at genesis")
+)
+
+// stateSnapshotManifest describes the contents of a state snapshot archive.
+type stateSnapshotManifest struct {
+	Version     uint64      `json:"version"`
+	NetworkID   uint64      `json:"networkID"`
+	GenesisHash common.Hash `json:"genesisHash"`
+	Height      uint64      `json:"height"`
+	BlockHash   common.Hash `json:"blockHash"`
+	StateRoot   common.Hash `json:"stateRoot"`
+	// AtomicHeight and AtomicRoot are the last atomic trie commit at or below
+	// [Height]. AtomicRoot is empty if the atomic trie was never committed.
+	AtomicHeight uint64                 `json:"atomicHeight"`
+	AtomicRoot   common.Hash            `json:"atomicRoot"`
+	Sections     []stateSnapshotSection `json:"sections"`
+}
+
+// stateSnapshotSection is a single file of RLP encoded entries in a state
+// snapshot archive, along with the keccak256 hash of its contents.
+type stateSnapshotSection struct {
+	File    string      `json:"file"`
+	Hash    common.Hash `json:"hash"`
+	Entries uint64      `json:"entries"`
+}
+
+// stateSnapshotEntry is a single key value pair of a section. The key of a
+// block is its hash, the key of atomic txs is their height, and the key of
+// every other kind is the keccak256 hash of the value.
+type stateSnapshotEntry struct {
+	Kind  uint8
+	Key   []byte
+	Value []byte
+}
+
+// stateSnapshotExportProgress is persisted next to the sections of an
+// archive while it is being exported, so that an interrupted export can be
+// resumed.
+type stateSnapshotExportProgress struct {
+	Manifest    stateSnapshotManifest `json:"manifest"`
+	StateCursor hexutil.Bytes         `json:"stateCursor"`
+	StateDone   bool                  `json:"stateDone"`
+}
+
+func (p *stateSnapshotExportProgress) hasSection(file string) bool {
+	for _, section := range p.Manifest.Sections {
+		if section.File == file {
+			return true
+		}
+	}
+	return false
+}
+
+// stateSnapshotImportProgress is stored in the database while a snapshot is
+// being imported, so that an interrupted import can be resumed.
+type stateSnapshotImportProgress struct {
+	ManifestHash common.Hash `json:"manifestHash"`
+	Sections     int         `json:"sections"`
+	// AppliedHeight is the next height whose atomic operations must be
+	// applied to shared memory.
+	AppliedHeight uint64 `json:"appliedHeight"`
+}
+
+// stateSnapshotWriter writes the entries of a single section.
+type stateSnapshotWriter struct {
+	w       io.Writer
+	entries uint64
+}
+
+func (w *stateSnapshotWriter) write(kind uint8, key, value []byte) error {
+	w.entries++
+	return rlp.Encode(w.w, &stateSnapshotEntry{Kind: kind, Key: key, Value: value})
+}
+
+// writeSnapshotSection writes the entries produced by [fn] to [file] in
+// [dir]. The section is written to a temporary file that is only moved into
+// place once it is complete.
+func writeSnapshotSection(dir, file string, fn func(w *stateSnapshotWriter) error) (stateSnapshotSection, error) {
+	path := filepath.Join(dir, file)
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perms.ReadWrite)
+	if err != nil {
+		return stateSnapshotSection{}, err
+	}
+	defer f.Close()
+
+	var (
+		hasher = crypto.NewKeccakState()
+		buf    = bufio.NewWriter(io.MultiWriter(f, hasher))
+		w      = &stateSnapshotWriter{w: buf}
+	)
+	if err := fn(w); err != nil {
+		return stateSnapshotSection{}, err
+	}
+	if err := buf.Flush(); err != nil {
+		return stateSnapshotSection{}, err
+	}
+	if err := f.Sync(); err != nil {
+		return stateSnapshotSection{}, err
+	}
+	if err := f.Close(); err != nil {
+		return stateSnapshotSection{}, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return stateSnapshotSection{}, err
+	}
+	section := stateSnapshotSection{File: file, Entries: w.entries}
+	hasher.Read(section.Hash[:])
+	return section, nil
+}
+
+// writeSnapshotJSON atomically replaces [file] in [dir] with the JSON
+// encoding of [v].
+func writeSnapshotJSON(dir, file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path+".tmp", b, perms.ReadWrite); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readSnapshotJSON decodes [file] in [dir] into [v] and returns false if the
+// file does not exist.
+func readSnapshotJSON(dir, file string, v interface{}) (bool, error) {
+	b, err := os.ReadFile(filepath.Join(dir, file))
+	switch {
+	case os.IsNotExist(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return true, nil
+}
+
+// exportStateSnapshot writes a state snapshot of the accepted block at
+// [height] to [dir]. If [dir] contains a partial export of the same block,
+// the export resumes from the last completed section.
+func (vm *VM) exportStateSnapshot(dir string, height uint64) (*stateSnapshotManifest, error) {
+	bc := vm.chain.BlockChain()
+	if lastAccepted := vm.chain.LastAcceptedBlock().NumberU64(); height > lastAccepted {
+		return nil, fmt.Errorf("height %d is above the last accepted height %d", height, lastAccepted)
+	}
+	block := bc.GetBlockByNumber(height)
+	if block == nil {
+		return nil, fmt.Errorf("no accepted block at height %d", height)
+	}
+	if !bc.HasState(block.Root()) {
+		return nil, fmt.Errorf("state of block %s at height %d is not available", block.Hash(), height)
+	}
+	if err := os.MkdirAll(dir, perms.ReadWriteExecute); err != nil {
+		return nil, err
+	}
+
+	var manifest stateSnapshotManifest
+	switch found, err := readSnapshotJSON(dir, stateSnapshotManifestFile, &manifest); {
+	case err != nil:
+		return nil, err
+	case found && manifest.BlockHash == block.Hash():
+		log.Info("state snapshot already exported", "dir", dir, "height", height)
+		return &manifest, nil
+	case found:
+		return nil, fmt.Errorf("%s already contains a snapshot of block %s", dir, manifest.BlockHash)
+	}
+
+	var progress stateSnapshotExportProgress
+	switch found, err := readSnapshotJSON(dir, stateSnapshotProgressFile, &progress); {
+	case err != nil:
+		return nil, err
+	case found && progress.Manifest.BlockHash != block.Hash():
+		return nil, fmt.Errorf("%s contains a partial snapshot of block %s", dir, progress.Manifest.BlockHash)
+	case found:
+		log.Info("resuming state snapshot export", "dir", dir, "height", height, "sections", len(progress.Manifest.Sections))
+	default:
+		atomicHeight := nearestCommitHeight(height, commitHeightInterval)
+		atomicRoot, err := vm.atomicTrie.Root(atomicHeight)
+		if err != nil {
+			return nil, err
+		}
+		progress.Manifest = stateSnapshotManifest{
+			Version:      stateSnapshotVersion,
+			NetworkID:    vm.networkID,
+			GenesisHash:  vm.genesisHash,
+			Height:       height,
+			BlockHash:    block.Hash(),
+			StateRoot:    block.Root(),
+			AtomicHeight: atomicHeight,
+			AtomicRoot:   atomicRoot,
+		}
+	}
+
+	start := time.Now()
+	addSection := func(file string, fn func(w *stateSnapshotWriter) error) error {
+		section, err := writeSnapshotSection(dir, file, fn)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		progress.Manifest.Sections = append(progress.Manifest.Sections, section)
+		return writeSnapshotJSON(dir, stateSnapshotProgressFile, &progress)
+	}
+
+	if file := "chain.rlp"; !progress.hasSection(file) {
+		if err := addSection(file, func(w *stateSnapshotWriter) error {
+			return vm.exportSnapshotChain(w, block)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for chunk := 0; !progress.StateDone; chunk++ {
+		file := fmt.Sprintf("state-%05d.rlp", chunk)
+		if progress.hasSection(file) {
+			continue
+		}
+		var (
+			cursor []byte
+			done   bool
+		)
+		section, err := writeSnapshotSection(dir, file, func(w *stateSnapshotWriter) (err error) {
+			cursor, done, err = vm.exportSnapshotState(w, block.Root(), progress.StateCursor)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		progress.Manifest.Sections = append(progress.Manifest.Sections, section)
+		progress.StateCursor, progress.StateDone = cursor, done
+		if err := writeSnapshotJSON(dir, stateSnapshotProgressFile, &progress); err != nil {
+			return nil, err
+		}
+		log.Info("exported state snapshot section", "file", file, "entries", section.Entries)
+	}
+	if file := "atomic-trie.rlp"; !progress.hasSection(file) {
+		if err := addSection(file, func(w *stateSnapshotWriter) error {
+			return vm.exportSnapshotTrie(w, snapshotEntryAtomicTrieNode, vm.atomicTrie.TrieDB(), progress.Manifest.AtomicRoot)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if file := "atomic-txs.rlp"; !progress.hasSection(file) {
+		if err := addSection(file, func(w *stateSnapshotWriter) error {
+			return vm.exportSnapshotAtomicTxs(w, height)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeSnapshotJSON(dir, stateSnapshotManifestFile, &progress.Manifest); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(dir, stateSnapshotProgressFile)); err != nil {
+		return nil, err
+	}
+	log.Info("exported state snapshot", "dir", dir, "height", height, "hash", block.Hash(), "sections", len(progress.Manifest.Sections), "time", time.Since(start))
+	return &progress.Manifest, nil
+}
+
+// exportSnapshotChain writes the headers of the [stateSnapshotHeaders] blocks
+// up to and including [block], followed by [block] itself.
+func (vm *VM) exportSnapshotChain(w *stateSnapshotWriter, block *types.Block) error {
+	bc := vm.chain.BlockChain()
+	first := uint64(1)
+	if block.NumberU64() >= stateSnapshotHeaders {
+		first = block.NumberU64() - stateSnapshotHeaders + 1
+	}
+	for number := first; number <= block.NumberU64(); number++ {
+		header := bc.GetHeaderByNumber(number)
+		if header == nil {
+			return fmt.Errorf("missing canonical header at height %d", number)
+		}
+		blob, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			return err
+		}
+		if err := w.write(snapshotEntryHeader, header.Hash().Bytes(), blob); err != nil {
+			return err
+		}
+	}
+	blob, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	return w.write(snapshotEntryBlock, block.Hash().Bytes(), blob)
+}
+
+// exportSnapshotState writes the state trie nodes, storage trie nodes and
+// contract code of up to [stateSnapshotChunkAccounts] accounts following
+// [cursor] in the state trie at [root]. It returns the key of the last
+// account written, and whether all accounts have been written.
+func (vm *VM) exportSnapshotState(w *stateSnapshotWriter, root common.Hash, cursor []byte) ([]byte, bool, error) {
+	triedb := vm.chain.BlockChain().StateCache().TrieDB()
+	accTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return nil, false, err
+	}
+	accounts := 0
+	it := accTrie.NodeIterator(cursor)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			blob, err := triedb.Node(hash)
+			if err != nil {
+				return nil, false, err
+			}
+			if err := w.write(snapshotEntryTrieNode, hash.Bytes(), blob); err != nil {
+				return nil, false, err
+			}
+		}
+		if !it.Leaf() || (cursor != nil && bytes.Compare(it.LeafKey(), cursor) <= 0) {
+			continue
+		}
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return nil, false, err
+		}
+		if acc.Root != types.EmptyRootHash {
+			if err := vm.exportSnapshotTrie(w, snapshotEntryTrieNode, triedb, acc.Root); err != nil {
+				return nil, false, err
+			}
+		}
+		if codeHash := common.BytesToHash(acc.CodeHash); codeHash != emptyCodeHash {
+			code := rawdb.ReadCode(vm.chaindb, codeHash)
+			if len(code) == 0 {
+				return nil, false, fmt.Errorf("missing code %s", codeHash)
+			}
+			if err := w.write(snapshotEntryCode, codeHash.Bytes(), code); err != nil {
+				return nil, false, err
+			}
+		}
+		if accounts++; accounts == stateSnapshotChunkAccounts {
+			return common.CopyBytes(it.LeafKey()), false, it.Error()
+		}
+	}
+	return nil, true, it.Error()
+}
+
+// exportSnapshotTrie writes every node of the trie at [root] in [triedb] as
+// an entry of [kind]. Nothing is written for the empty trie.
+func (vm *VM) exportSnapshotTrie(w *stateSnapshotWriter, kind uint8, triedb *trie.Database, root common.Hash) error {
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return nil
+	}
+	t, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it := t.NodeIterator(nil)
+	for it.Next(true) {
+		hash := it.Hash()
+		if hash == (common.Hash{}) {
+			continue
+		}
+		blob, err := triedb.Node(hash)
+		if err != nil {
+			return err
+		}
+		if err := w.write(kind, hash.Bytes(), blob); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// exportSnapshotAtomicTxs writes the atomic transactions of every height up
+// to and including [height] from the atomic repository.
+func (vm *VM) exportSnapshotAtomicTxs(w *stateSnapshotWriter, height uint64) error {
+	iter := vm.atomicTxRepository.IterateByHeight(nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if binary.BigEndian.Uint64(iter.Key()) > height {
+			break
+		}
+		if err := w.write(snapshotEntryAtomicTxs, common.CopyBytes(iter.Key()), common.CopyBytes(iter.Value())); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// importStateSnapshot loads the state snapshot in [dir] into a node that has
+// not accepted any block past genesis yet. Every section and entry is
+// verified against the manifest before it is written. The imported block is
+// marked as last accepted and becomes the starting point of the chain the
+// next time the VM is initialized. If the import is interrupted, calling
+// importStateSnapshot again resumes from the last completed section.
+func (vm *VM) importStateSnapshot(dir string) (*stateSnapshotManifest, error) {
+	if vm.bootstrapped {
+		return nil, errSnapshotImportAfterBootstrap
+	}
+	if vm.chain.LastAcceptedBlock().NumberU64() != 0 {
+		return nil, errSnapshotImportNotFresh
+	}
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, stateSnapshotManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest stateSnapshotManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if err := vm.verifySnapshotManifest(&manifest); err != nil {
+		return nil, err
+	}
+
+	progress := stateSnapshotImportProgress{ManifestHash: crypto.Keccak256Hash(manifestBytes)}
+	switch progressBytes, err := vm.db.Get(stateSnapshotImportKey); err {
+	case database.ErrNotFound:
+	case nil:
+		var existing stateSnapshotImportProgress
+		if err := json.Unmarshal(progressBytes, &existing); err != nil {
+			return nil, err
+		}
+		if existing.ManifestHash != progress.ManifestHash {
+			return nil, fmt.Errorf("a different state snapshot (manifest %s) is partially imported", existing.ManifestHash)
+		}
+		progress = existing
+		log.Info("resuming state snapshot import", "dir", dir, "height", manifest.Height, "sections", progress.Sections)
+	default:
+		return nil, err
+	}
+	putProgress := func() error {
+		b, err := json.Marshal(&progress)
+		if err != nil {
+			return err
+		}
+		return vm.db.Put(stateSnapshotImportKey, b)
+	}
+
+	start := time.Now()
+	importer := &stateSnapshotImporter{vm: vm, manifest: &manifest}
+	for ; progress.Sections < len(manifest.Sections); progress.Sections++ {
+		section := manifest.Sections[progress.Sections]
+		if err := importer.importSection(filepath.Join(dir, section.File), section); err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", section.File, err)
+		}
+		if err := putProgress(); err != nil {
+			return nil, err
+		}
+		if err := vm.db.Commit(); err != nil {
+			return nil, err
+		}
+		log.Info("imported state snapshot section", "file", section.File, "entries", section.Entries)
+	}
+
+	bc := vm.chain.BlockChain()
+	block := bc.GetBlockByHash(manifest.BlockHash)
+	switch {
+	case block == nil:
+		return nil, fmt.Errorf("state snapshot does not contain block %s", manifest.BlockHash)
+	case !bc.HasState(manifest.StateRoot):
+		return nil, fmt.Errorf("state snapshot does not contain state root %s", manifest.StateRoot)
+	}
+	if manifest.AtomicRoot != (common.Hash{}) {
+		if _, err := trie.New(manifest.AtomicRoot, vm.atomicTrie.TrieDB()); err != nil {
+			return nil, fmt.Errorf("state snapshot does not contain atomic root %s: %w", manifest.AtomicRoot, err)
+		}
+		if err := vm.atomicTrie.UpdateLastCommitted(manifest.AtomicRoot, manifest.AtomicHeight); err != nil {
+			return nil, err
+		}
+	}
+	// Ensure the atomic repository covers every height up to the snapshot,
+	// so the atomic trie can be caught up when the VM is next initialized.
+	if err := vm.atomicTxRepository.Write(manifest.Height, nil); err != nil {
+		return nil, err
+	}
+	if err := vm.applySnapshotAtomicOps(&progress, manifest.Height, putProgress); err != nil {
+		return nil, fmt.Errorf("failed to apply atomic operations: %w", err)
+	}
+
+	// Mark the snapshot block as the head of the chain
+	batch := vm.chaindb.NewBatch()
+	rawdb.WriteHeadHeaderHash(batch, manifest.BlockHash)
+	rawdb.WriteHeadBlockHash(batch, manifest.BlockHash)
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	if err := vm.acceptedBlockDB.Put(lastAcceptedKey, manifest.BlockHash[:]); err != nil {
+		return nil, err
+	}
+	if err := vm.db.Delete(stateSnapshotImportKey); err != nil {
+		return nil, err
+	}
+	if err := vm.db.Commit(); err != nil {
+		return nil, err
+	}
+	log.Info("imported state snapshot, restart the node to continue from it", "dir", dir, "height", manifest.Height, "hash", manifest.BlockHash, "time", time.Since(start))
+	return &manifest, nil
+}
+
+// verifySnapshotManifest checks that [manifest] describes a snapshot of this
+// chain that this version of the VM is able to import.
+func (vm *VM) verifySnapshotManifest(manifest *stateSnapshotManifest) error {
+	switch {
+	case manifest.Version != stateSnapshotVersion:
+		return fmt.Errorf("unsupported state snapshot version %d", manifest.Version)
+	case manifest.NetworkID != vm.networkID:
+		return fmt.Errorf("state snapshot network ID %d does not match %d", manifest.NetworkID, vm.networkID)
+	case manifest.GenesisHash != vm.genesisHash:
+		return fmt.Errorf("state snapshot genesis %s does not match %s", manifest.GenesisHash, vm.genesisHash)
+	case manifest.Height == 0:
+		return errors.New("state snapshot of the genesis block")
+	case len(manifest.Sections) == 0:
+		return errors.New("state snapshot has no sections")
+	}
+	for _, section := range manifest.Sections {
+		if section.File != filepath.Base(section.File) || section.File == stateSnapshotManifestFile {
+			return fmt.Errorf("invalid section file name %q", section.File)
+		}
+	}
+	return nil
+}
+
+// applySnapshotAtomicOps applies the atomic operations of the imported
+// atomic transactions to shared memory, in height order, starting at
+// [progress.AppliedHeight]. The progress is committed atomically with each
+// shared memory update.
+func (vm *VM) applySnapshotAtomicOps(progress *stateSnapshotImportProgress, height uint64, putProgress func() error) error {
+	bonusBlocks := make(map[uint64]ids.ID)
+	if vm.chainID.Cmp(params.AvalancheMainnetChainID) == 0 {
+		bonusBlocks = bonusBlockMainnetHeights
+	}
+	for progress.AppliedHeight <= height {
+		// Read a batch of heights before applying any of them, since the
+		// repository iterator must not be held across commits.
+		heightBytes := make([]byte, wrappers.LongLen)
+		binary.BigEndian.PutUint64(heightBytes, progress.AppliedHeight)
+		iter := vm.atomicTxRepository.IterateByHeight(heightBytes)
+		var (
+			heights []uint64
+			values  [][]byte
+		)
+		for len(heights) < stateSnapshotApplyBatch && iter.Next() {
+			heights = append(heights, binary.BigEndian.Uint64(iter.Key()))
+			values = append(values, common.CopyBytes(iter.Value()))
+		}
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		}
+
+		for i, txHeight := range heights {
+			if txHeight > height {
+				return nil
+			}
+			if _, skip := bonusBlocks[txHeight]; skip {
+				continue
+			}
+			txs, err := ExtractAtomicTxs(values[i], true, vm.codec)
+			if err != nil {
+				return err
+			}
+			ops, err := mergeAtomicOps(txs)
+			if err != nil {
+				return err
+			}
+			progress.AppliedHeight = txHeight + 1
+			if err := putProgress(); err != nil {
+				return err
+			}
+			batch, err := vm.db.CommitBatch()
+			if err != nil {
+				return err
+			}
+			if err := vm.ctx.SharedMemory.Apply(ops, batch); err != nil {
+				return err
+			}
+		}
+		if len(heights) < stateSnapshotApplyBatch {
+			return nil
+		}
+	}
+	return nil
+}
+
+// stateSnapshotImporter verifies and writes the entries of the sections of a
+// single snapshot.
+type stateSnapshotImporter struct {
+	vm       *VM
+	manifest *stateSnapshotManifest
+
+	// lastHeader is the most recently imported header, used to check that
+	// the headers of a snapshot form a chain.
+	lastHeader *types.Header
+}
+
+// importSection verifies the hash of the section file at [path] against
+// [section] before verifying and writing each of its entries.
+func (i *stateSnapshotImporter) importSection(path string, section stateSnapshotSection) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := crypto.NewKeccakState()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	var hash common.Hash
+	hasher.Read(hash[:])
+	if hash != section.Hash {
+		return fmt.Errorf("section hash %s does not match manifest hash %s", hash, section.Hash)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		batch   = i.vm.chaindb.NewBatch()
+		stream  = rlp.NewStream(bufio.NewReader(f), math.MaxUint64)
+		entries uint64
+	)
+	for {
+		var entry stateSnapshotEntry
+		if err := stream.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := i.importEntry(batch, &entry); err != nil {
+			return fmt.Errorf("invalid entry %d: %w", entries, err)
+		}
+		entries++
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if entries != section.Entries {
+		return fmt.Errorf("found %d entries, manifest specifies %d", entries, section.Entries)
+	}
+	return batch.Write()
+}
+
+// importEntry verifies [entry] and writes it to [batch], or directly to the
+// VM database for the atomic entries.
+func (i *stateSnapshotImporter) importEntry(batch ethdb.Batch, entry *stateSnapshotEntry) error {
+	switch entry.Kind {
+	case snapshotEntryAtomicTxs:
+	case snapshotEntryBlock:
+		if len(entry.Key) != common.HashLength {
+			return fmt.Errorf("invalid key length %d", len(entry.Key))
+		}
+	default:
+		if len(entry.Key) != common.HashLength {
+			return fmt.Errorf("invalid key length %d", len(entry.Key))
+		}
+		if hash := crypto.Keccak256(entry.Value); !bytes.Equal(hash, entry.Key) {
+			return fmt.Errorf("value hash %x does not match key %x", hash, entry.Key)
+		}
+	}
+	key := common.BytesToHash(entry.Key)
+
+	switch entry.Kind {
+	case snapshotEntryTrieNode:
+		rawdb.WriteTrieNode(batch, key, entry.Value)
+	case snapshotEntryCode:
+		rawdb.WriteCode(batch, key, entry.Value)
+	case snapshotEntryHeader:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(entry.Value, header); err != nil {
+			return err
+		}
+		number := header.Number.Uint64()
+		if number > i.manifest.Height {
+			return fmt.Errorf("header %s at height %d is above the snapshot height", key, number)
+		}
+		if i.lastHeader != nil && (header.ParentHash != i.lastHeader.Hash() || number != i.lastHeader.Number.Uint64()+1) {
+			return fmt.Errorf("header %s at height %d does not extend %s", key, number, i.lastHeader.Hash())
+		}
+		i.lastHeader = header
+		rawdb.WriteHeader(batch, header)
+		rawdb.WriteCanonicalHash(batch, key, number)
+	case snapshotEntryBlock:
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(entry.Value, block); err != nil {
+			return err
+		}
+		switch {
+		case block.Hash() != key:
+			return fmt.Errorf("block hash %s does not match key %s", block.Hash(), key)
+		case key != i.manifest.BlockHash:
+			return fmt.Errorf("block %s does not match snapshot block %s", key, i.manifest.BlockHash)
+		case block.NumberU64() != i.manifest.Height:
+			return fmt.Errorf("block height %d does not match snapshot height %d", block.NumberU64(), i.manifest.Height)
+		case block.Root() != i.manifest.StateRoot:
+			return fmt.Errorf("block root %s does not match snapshot root %s", block.Root(), i.manifest.StateRoot)
+		case types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)) != block.TxHash():
+			return fmt.Errorf("block %s has an invalid transaction root", key)
+		case types.CalcUncleHash(block.Uncles()) != block.UncleHash():
+			return fmt.Errorf("block %s has an invalid uncle hash", key)
+		}
+		rawdb.WriteBlock(batch, block)
+		rawdb.WriteCanonicalHash(batch, key, block.NumberU64())
+	case snapshotEntryAtomicTrieNode:
+		return i.vm.atomicTrie.TrieDB().DiskDB().Put(entry.Key, entry.Value)
+	case snapshotEntryAtomicTxs:
+		if len(entry.Key) != wrappers.LongLen {
+			return fmt.Errorf("invalid atomic height length %d", len(entry.Key))
+		}
+		height := binary.BigEndian.Uint64(entry.Key)
+		if height > i.manifest.Height {
+			return fmt.Errorf("atomic txs at height %d are above the snapshot height", height)
+		}
+		txs, err := ExtractAtomicTxs(entry.Value, true, i.vm.codec)
+		if err != nil {
+			return err
+		}
+		if _, bonus := bonusBlockMainnetHeights[height]; bonus && i.vm.chainID.Cmp(params.AvalancheMainnetChainID) == 0 {
+			return i.vm.atomicTxRepository.WriteBonus(height, txs)
+		}
+		return i.vm.atomicTxRepository.Write(height, txs)
+	default:
+		return fmt.Errorf("unknown entry kind %d", entry.Kind)
+	}
+	return nil
+}
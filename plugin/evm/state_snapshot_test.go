@@ -0,0 +1,329 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow/choices"
+	"github.com/zsmartex/avalanchego/snow/consensus/snowman"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+// snapshotInitCode stores 1 in the first storage slot of the created
+// contract and deploys a contract consisting of a single STOP.
+var snapshotInitCode = common.FromHex("600160005560016000f3")
+
+// buildAndAcceptBlock builds, verifies and accepts a block on [vm] and waits
+// for the tx pool to be reset to it.
+func buildAndAcceptBlock(t *testing.T, issuer chan engCommon.Message, vm *VM) snowman.Block {
+	newTxPoolHeadChan := make(chan core.NewTxPoolReorgEvent, 1)
+	sub := vm.chain.GetTxPool().SubscribeNewReorgEvent(newTxPoolHeadChan)
+	defer sub.Unsubscribe()
+
+	<-issuer
+
+	blk, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SetPreference(blk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	for newHead := range newTxPoolHeadChan {
+		if newHead.Head.Hash() == common.Hash(blk.ID()) {
+			break
+		}
+	}
+	return blk
+}
+
+// sendEthTxs signs [txs] with the key of testEthAddrs[0] and adds them to
+// the tx pool of [vm].
+func sendEthTxs(t *testing.T, vm *VM, txs ...*types.Transaction) {
+	signer := types.NewEIP155Signer(vm.chainID)
+	for i, tx := range txs {
+		signedTx, err := types.SignTx(tx, signer, testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = signedTx
+	}
+	for i, err := range vm.chain.AddRemoteTxsSync(txs) {
+		if err != nil {
+			t.Fatalf("Failed to add tx at index %d: %s", i, err)
+		}
+	}
+}
+
+func TestStateSnapshotRoundTrip(t *testing.T) {
+	importAmount := uint64(500000000)
+	issuer1, vm1, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm1.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Accept an import, a contract with storage and code, and an export
+	importTx, err := vm1.newImportTx(vm1.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer1, vm1)
+
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	sendEthTxs(t, vm1, types.NewContractCreation(0, common.Big0, 100_000, gasPrice, snapshotInitCode))
+	buildAndAcceptBlock(t, issuer1, vm1)
+	contract := ethcrypto.CreateAddress(testEthAddrs[0], 0)
+
+	exportTx, err := vm1.newExportTx(vm1.ctx.AVAXAssetID, importAmount/10, vm1.ctx.XChainID, testShortIDAddrs[1], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1.issueTx(exportTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	exportBlk := buildAndAcceptBlock(t, issuer1, vm1)
+
+	dir := filepath.Join(t.TempDir(), "snapshot")
+	manifest, err := vm1.exportStateSnapshot(dir, exportBlk.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.BlockHash != common.Hash(exportBlk.ID()) {
+		t.Fatalf("Expected snapshot of block %s, found %s", exportBlk.ID(), manifest.BlockHash)
+	}
+	// Exporting a completed snapshot again is a no-op
+	if again, err := vm1.exportStateSnapshot(dir, exportBlk.Height()); err != nil || again.Sections[0].Hash != manifest.Sections[0].Hash {
+		t.Fatalf("Expected repeated export to return the existing manifest, found err: %v", err)
+	}
+
+	// Import the snapshot into a fresh node, and restart it from the snapshot
+	_, vm2, dbManager2, sharedMemory2, _ := GenesisVM(t, false, genesisJSONApricotPhase2, "", "")
+	if _, err := vm2.importStateSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm2.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext()
+	ctx.SharedMemory = vm2.ctx.SharedMemory
+	issuer3 := make(chan engCommon.Message, 1)
+	vm3 := &VM{}
+	if err := vm3.Initialize(
+		ctx,
+		dbManager2,
+		BuildGenesisTest(t, genesisJSONApricotPhase2),
+		[]byte(""),
+		[]byte(""),
+		issuer3,
+		[]*engCommon.Fx{},
+		nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := vm3.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	lastAcceptedID, err := vm3.LastAccepted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastAcceptedID != exportBlk.ID() {
+		t.Fatalf("Expected last accepted block to be %s, found %s", exportBlk.ID(), lastAcceptedID)
+	}
+	state, err := vm3.chain.BlockChain().State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := state.GetState(contract, common.Hash{}); value != common.BigToHash(common.Big1) {
+		t.Fatalf("Expected contract storage to be imported, found %s", value)
+	}
+	if code := state.GetCode(contract); len(code) != 1 {
+		t.Fatalf("Expected contract code to be imported, found %x", code)
+	}
+	if _, status, height, err := vm3.getAtomicTx(importTx.ID()); err != nil || status != Accepted || height != 1 {
+		t.Fatalf("Expected import tx to be accepted at height 1, found status %s at height %d: %v", status, height, err)
+	}
+
+	// The exported UTXO must have been applied to shared memory
+	exportedUTXOID := avax.UTXOID{TxID: exportTx.ID(), OutputIndex: 0}
+	exportedInputID := exportedUTXOID.InputID()
+	xChainSharedMemory := sharedMemory2.NewSharedMemory(vm3.ctx.XChainID)
+	if _, err := xChainSharedMemory.Get(vm3.ctx.ChainID, [][]byte{exportedInputID[:]}); err != nil {
+		t.Fatalf("Expected exported UTXO in shared memory: %s", err)
+	}
+
+	// The sibling accepts the next canonical block built by the original node
+	sendEthTxs(t, vm1, types.NewTransaction(2, contract, common.Big1, 100_000, gasPrice, nil))
+	nextBlk := buildAndAcceptBlock(t, issuer1, vm1)
+
+	siblingBlk, err := vm3.ParseBlock(nextBlk.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := siblingBlk.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm3.SetPreference(siblingBlk.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := siblingBlk.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if status := siblingBlk.Status(); status != choices.Accepted {
+		t.Fatalf("Expected status of accepted block to be %s, but found %s", choices.Accepted, status)
+	}
+	if root := vm3.chain.LastAcceptedBlock().Root(); root != vm1.chain.LastAcceptedBlock().Root() {
+		t.Fatalf("Expected state root %s, found %s", vm1.chain.LastAcceptedBlock().Root(), root)
+	}
+}
+
+func TestStateSnapshotExportResume(t *testing.T) {
+	importAmount := uint64(50000000)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm)
+
+	dir := t.TempDir()
+	manifest, err := vm.exportStateSnapshot(dir, blk.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate an export interrupted after the first section was written
+	progress := stateSnapshotExportProgress{Manifest: *manifest}
+	progress.Manifest.Sections = manifest.Sections[:1]
+	if err := writeSnapshotJSON(dir, stateSnapshotProgressFile, &progress); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, stateSnapshotManifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range manifest.Sections[1:] {
+		if err := os.Remove(filepath.Join(dir, section.File)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resumed, err := vm.exportStateSnapshot(dir, blk.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.Sections) != len(manifest.Sections) {
+		t.Fatalf("Expected %d sections, found %d", len(manifest.Sections), len(resumed.Sections))
+	}
+	for i, section := range resumed.Sections {
+		if section != manifest.Sections[i] {
+			t.Fatalf("Expected section %d to be %+v, found %+v", i, manifest.Sections[i], section)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, stateSnapshotProgressFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected progress file to be removed, found err: %v", err)
+	}
+}
+
+func TestStateSnapshotImportVerifiesHashes(t *testing.T) {
+	importAmount := uint64(50000000)
+	issuer, vm1, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	defer func() {
+		if err := vm1.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm1.newImportTx(vm1.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	blk := buildAndAcceptBlock(t, issuer, vm1)
+
+	dir := t.TempDir()
+	manifest, err := vm1.exportStateSnapshot(dir, blk.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt a single byte of a state section
+	var stateFile string
+	for _, section := range manifest.Sections {
+		if strings.HasPrefix(section.File, "state-") {
+			stateFile = filepath.Join(dir, section.File)
+			break
+		}
+	}
+	contents, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents[len(contents)-1] ^= 0xff
+	if err := os.WriteFile(stateFile, contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, vm2, _, _, _ := GenesisVM(t, false, genesisJSONApricotPhase2, "", "")
+	defer func() {
+		if err := vm2.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if _, err := vm2.importStateSnapshot(dir); err == nil {
+		t.Fatal("Expected import of corrupted snapshot to fail")
+	}
+	if _, err := vm2.acceptedBlockDB.Get(lastAcceptedKey); err == nil {
+		t.Fatal("Expected last accepted block not to be updated by a failed import")
+	}
+
+	// A node in normal operation refuses to import a snapshot
+	if _, err := vm1.importStateSnapshot(dir); err != errSnapshotImportAfterBootstrap {
+		t.Fatalf("Expected %s, found %v", errSnapshotImportAfterBootstrap, err)
+	}
+}
@@ -6,9 +6,16 @@ package evm
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/zsmartex/avalanchego/utils/formatting"
+	avalancheJSON "github.com/zsmartex/avalanchego/utils/json"
 	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/params"
 )
 
 // StaticService defines the static API services exposed by the evm
@@ -36,3 +43,123 @@ func (*StaticService) BuildGenesis(_ context.Context, args *core.Genesis) (*Buil
 		Encoding: formatting.Hex,
 	}, nil
 }
+
+// GenesisService is the static API of the genesis, served by the "evm" service
+// at [staticGenesisEndpoint], to validate and encode the genesis of a chain
+// without running it.
+type GenesisService struct{}
+
+// BuildGenesisArgs are the arguments to BuildGenesis
+type BuildGenesisArgs struct {
+	Genesis json.RawMessage `json:"genesis"`
+}
+
+// DecodeGenesisArgs are the arguments to DecodeGenesis
+type DecodeGenesisArgs struct {
+	Bytes    string              `json:"bytes"`
+	Encoding formatting.Encoding `json:"encoding"`
+}
+
+// GenesisUpgrade is the activation timestamp of a network upgrade.
+type GenesisUpgrade struct {
+	Name      string               `json:"name"`
+	Timestamp avalancheJSON.Uint64 `json:"timestamp"`
+}
+
+// GenesisConfigSummary summarizes the chain config of a genesis.
+type GenesisConfigSummary struct {
+	ChainID *big.Int `json:"chainId"`
+	// Network is the network whose canonical config the chain runs with in
+	// place of the config of its genesis, or "custom"
+	Network  string               `json:"network"`
+	Upgrades []GenesisUpgrade     `json:"upgrades"`
+	GasLimit avalancheJSON.Uint64 `json:"gasLimit"`
+	BaseFee  *big.Int             `json:"baseFee,omitempty"` // nil if the genesis block has no base fee
+	Accounts avalancheJSON.Uint32 `json:"accounts"`
+}
+
+// GenesisReply is the reply from BuildGenesis and DecodeGenesis
+type GenesisReply struct {
+	// Bytes are the genesis bytes the VM is initialized with
+	Bytes       string               `json:"bytes"`
+	Encoding    formatting.Encoding  `json:"encoding"`
+	Genesis     json.RawMessage      `json:"genesis"`
+	GenesisHash common.Hash          `json:"genesisHash"`
+	Config      GenesisConfigSummary `json:"config"`
+}
+
+// BuildGenesis validates the JSON genesis [args.Genesis] and returns its
+// genesis bytes, with the hash of its genesis block and a summary of its chain
+// config as the VM initialized with the bytes runs them.
+func (*GenesisService) BuildGenesis(_ *http.Request, args *BuildGenesisArgs, reply *GenesisReply) error {
+	return genesisReply(args.Genesis, reply)
+}
+
+// DecodeGenesis validates the genesis bytes [args.Bytes] and returns the JSON
+// genesis they encode, with the hash of its genesis block and a summary of its
+// chain config as the VM initialized with the bytes runs them.
+func (*GenesisService) DecodeGenesis(_ *http.Request, args *DecodeGenesisArgs, reply *GenesisReply) error {
+	genesisBytes, err := formatting.Decode(args.Encoding, args.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to decode genesis bytes: %w", err)
+	}
+	return genesisReply(genesisBytes, reply)
+}
+
+// genesisReply sets [reply] to the genesis of the JSON [genesisBytes], with
+// the canonical config of its chain ID if any, so that the bytes of the reply
+// are the same as the bytes they are decoded from once encoded.
+func genesisReply(genesisBytes []byte, reply *GenesisReply) error {
+	g, err := parseGenesisStrict(genesisBytes)
+	if err != nil {
+		return err
+	}
+	canonicalBytes, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	reply.Bytes, err = formatting.EncodeWithChecksum(formatting.Hex, canonicalBytes)
+	if err != nil {
+		return err
+	}
+	reply.Encoding = formatting.Hex
+	reply.Genesis = canonicalBytes
+
+	block := g.ToBlock(nil)
+	reply.GenesisHash = block.Hash()
+	network, _ := canonicalChainConfig(g.Config.ChainID)
+	reply.Config = GenesisConfigSummary{
+		ChainID:  g.Config.ChainID,
+		Network:  network,
+		Upgrades: genesisUpgrades(g.Config),
+		GasLimit: avalancheJSON.Uint64(block.GasLimit()),
+		BaseFee:  block.BaseFee(),
+		Accounts: avalancheJSON.Uint32(len(g.Alloc)),
+	}
+	return nil
+}
+
+// genesisUpgrades returns the network upgrades scheduled by [config], in order
+// of activation.
+func genesisUpgrades(config *params.ChainConfig) []GenesisUpgrade {
+	upgrades := make([]GenesisUpgrade, 0, 8)
+	for _, upgrade := range []struct {
+		name      string
+		timestamp *big.Int
+	}{
+		{"apricotPhase1", config.ApricotPhase1BlockTimestamp},
+		{"apricotPhase2", config.ApricotPhase2BlockTimestamp},
+		{"apricotPhase3", config.ApricotPhase3BlockTimestamp},
+		{"apricotPhase4", config.ApricotPhase4BlockTimestamp},
+		{"apricotPhase5", config.ApricotPhase5BlockTimestamp},
+		{"initCodeLimit", config.InitCodeLimitBlockTimestamp},
+		{"atomicOpsLimit", config.AtomicOpsLimitBlockTimestamp},
+		{"dynamicFeeOnly", config.DynamicFeeOnlyBlockTimestamp},
+	} {
+		if upgrade.timestamp != nil {
+			upgrades = append(upgrades, GenesisUpgrade{Name: upgrade.name, Timestamp: avalancheJSON.Uint64(upgrade.timestamp.Uint64())})
+		}
+	}
+	sort.SliceStable(upgrades, func(i, j int) bool { return upgrades[i].Timestamp < upgrades[j].Timestamp })
+	return upgrades
+}
@@ -0,0 +1,259 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zsmartex/avalanchego/utils/formatting"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/params"
+)
+
+// buildGenesisV1 returns the reply of evm.buildGenesis for [genesisJSON],
+// served by the static handlers of the VM.
+func buildGenesisV1(t *testing.T, genesisJSON []byte) (*GenesisReply, error) {
+	t.Helper()
+	handlers, err := (&VM{}).CreateStaticHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "evm.buildGenesis",
+		"params":  BuildGenesisArgs{Genesis: genesisJSON},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, staticGenesisEndpoint, bytes.NewReader(request))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handlers[staticGenesisEndpoint].Handler.ServeHTTP(w, req)
+
+	var response struct {
+		Result *GenesisReply `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != nil {
+		return nil, errors.New(response.Error.Message)
+	}
+	return response.Result, nil
+}
+
+// The genesis bytes and hash of the static API are the ones the VM is
+// initialized with.
+func TestGenesisServiceMatchesInitialize(t *testing.T) {
+	for name, genesisJSON := range map[string]string{
+		"apricotPhase0": genesisJSONApricotPhase0,
+		"apricotPhase1": genesisJSONApricotPhase1,
+		"apricotPhase2": genesisJSONApricotPhase2,
+		"apricotPhase3": genesisJSONApricotPhase3,
+		"apricotPhase4": genesisJSONApricotPhase4,
+		"apricotPhase5": genesisJSONApricotPhase5,
+	} {
+		t.Run(name, func(t *testing.T) {
+			reply, err := buildGenesisV1(t, []byte(genesisJSON))
+			if err != nil {
+				t.Fatal(err)
+			}
+			genesisBytes, err := formatting.Decode(reply.Encoding, reply.Bytes)
+			assert.NoError(t, err)
+			assert.Equal(t, BuildGenesisTest(t, genesisJSON), genesisBytes)
+			assert.JSONEq(t, string(genesisBytes), string(reply.Genesis))
+			assert.Equal(t, "custom", reply.Config.Network)
+			assert.EqualValues(t, 43111, reply.Config.ChainID.Int64())
+			assert.EqualValues(t, 1, reply.Config.Accounts)
+
+			_, vm, _, _, _ := GenesisVM(t, false, genesisJSON, "", "")
+			defer func() {
+				if err := vm.Shutdown(); err != nil {
+					t.Fatal(err)
+				}
+			}()
+			assert.Equal(t, vm.genesisHash, reply.GenesisHash)
+			genesisBlock := vm.chain.GetGenesisBlock()
+			assert.EqualValues(t, genesisBlock.GasLimit(), reply.Config.GasLimit)
+			assert.Equal(t, genesisBlock.BaseFee(), reply.Config.BaseFee)
+		})
+	}
+}
+
+func TestGenesisServiceRoundTrip(t *testing.T) {
+	service := &GenesisService{}
+	built := new(GenesisReply)
+	assert.NoError(t, service.BuildGenesis(nil, &BuildGenesisArgs{Genesis: json.RawMessage(genesisJSONApricotPhase5)}, built))
+	upgrades := make([]string, len(built.Config.Upgrades))
+	for i, upgrade := range built.Config.Upgrades {
+		upgrades[i] = upgrade.Name
+	}
+	assert.Equal(t, []string{"apricotPhase1", "apricotPhase2", "apricotPhase3", "apricotPhase4", "apricotPhase5"}, upgrades)
+	assert.EqualValues(t, params.ApricotPhase3InitialBaseFee, built.Config.BaseFee.Int64())
+
+	decoded := new(GenesisReply)
+	assert.NoError(t, service.DecodeGenesis(nil, &DecodeGenesisArgs{Bytes: built.Bytes, Encoding: built.Encoding}, decoded))
+	assert.Equal(t, built, decoded)
+
+	rebuilt := new(GenesisReply)
+	assert.NoError(t, service.BuildGenesis(nil, &BuildGenesisArgs{Genesis: decoded.Genesis}, rebuilt))
+	assert.Equal(t, built, rebuilt)
+
+	// The chain of the mainnet chain ID runs with the mainnet config
+	mainnet := mutateGenesis(t, genesisJSONApricotPhase0, func(g map[string]interface{}) {
+		g["config"].(map[string]interface{})["chainId"] = params.AvalancheMainnetChainID.Uint64()
+	})
+	assert.NoError(t, service.BuildGenesis(nil, &BuildGenesisArgs{Genesis: mainnet}, built))
+	assert.Equal(t, "mainnet", built.Config.Network)
+	g := new(core.Genesis)
+	assert.NoError(t, json.Unmarshal(built.Genesis, g))
+	assert.Equal(t, params.AvalancheMainnetChainConfig, g.Config)
+	assert.Equal(t, g.ToBlock(nil).Hash(), built.GenesisHash)
+}
+
+// mutateGenesis returns the JSON genesis [genesisJSON] modified by [mutate].
+func mutateGenesis(t *testing.T, genesisJSON string, mutate func(g map[string]interface{})) []byte {
+	t.Helper()
+	var g map[string]interface{}
+	if err := json.Unmarshal([]byte(genesisJSON), &g); err != nil {
+		t.Fatal(err)
+	}
+	mutate(g)
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGenesisServiceInvalidGenesis(t *testing.T) {
+	const account = "0100000000000000000000000000000000000000"
+	withAccount := func(fields map[string]interface{}) func(g map[string]interface{}) {
+		return func(g map[string]interface{}) {
+			g["alloc"] = map[string]interface{}{account: fields}
+		}
+	}
+	withConfig := func(field string, value interface{}) func(g map[string]interface{}) {
+		return func(g map[string]interface{}) {
+			g["config"].(map[string]interface{})[field] = value
+		}
+	}
+	for name, test := range map[string]struct {
+		genesisJSON []byte
+		err         string
+	}{
+		"not an object": {
+			genesisJSON: []byte(`"genesis"`),
+			err:         "invalid genesis",
+		},
+		"unknown field": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { g["chainId"] = 1 }),
+			err:         `genesis field "chainId": unknown`,
+		},
+		"missing config": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { delete(g, "config") }),
+			err:         `genesis field "config": missing`,
+		},
+		"missing chain ID": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) {
+				delete(g["config"].(map[string]interface{}), "chainId")
+			}),
+			err: `genesis field "config.chainId": missing`,
+		},
+		"missing alloc": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { delete(g, "alloc") }),
+			err:         `genesis field "alloc": missing`,
+		},
+		"invalid alloc address": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) {
+				g["alloc"] = map[string]interface{}{"0x01zz": map[string]interface{}{"balance": "0x1"}}
+			}),
+			err: `genesis field "alloc.0x01zz": invalid address`,
+		},
+		"duplicate alloc address": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) {
+				g["alloc"] = map[string]interface{}{
+					account:        map[string]interface{}{"balance": "0x1"},
+					"0x" + account: map[string]interface{}{"balance": "0x2"},
+				}
+			}),
+			err: `duplicate of`,
+		},
+		"alloc missing balance": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, withAccount(map[string]interface{}{"nonce": "0x1"})),
+			err:         `genesis field "alloc.` + account + `": missing required field 'balance'`,
+		},
+		"alloc negative balance": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, withAccount(map[string]interface{}{"balance": "-1"})),
+			err:         `genesis field "alloc.` + account + `.balance": negative`,
+		},
+		"alloc unknown field": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, withAccount(map[string]interface{}{"balance": "0x1", "balances": "0x1"})),
+			err:         `genesis field "alloc.` + account + `.balances": unknown`,
+		},
+		"base fee before apricot phase 3": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase2, func(g map[string]interface{}) { g["baseFeePerGas"] = "0x1" }),
+			err:         `genesis field "baseFeePerGas": set but apricotPhase3BlockTimestamp is not active`,
+		},
+		"base fee below the minimum": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { g["baseFeePerGas"] = "0x1" }),
+			err:         `genesis field "baseFeePerGas": 1 below the minimum base fee`,
+		},
+		"base fee above the maximum": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase3, func(g map[string]interface{}) { g["baseFeePerGas"] = "0x10000000000000000" }),
+			err:         `above the maximum base fee`,
+		},
+		"dynamic fees required before apricot phase 3": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase2, withConfig("dynamicFeeOnlyBlockTimestamp", 0)),
+			err:         `genesis field "config": unsupported fork ordering: dynamicFeeOnlyBlockTimestamp`,
+		},
+		"apricot phase 4 without apricot phase 3": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase2, withConfig("apricotPhase4BlockTimestamp", 0)),
+			err:         `genesis field "config": unsupported fork ordering`,
+		},
+		"invalid gas limit schedule": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, withConfig("gasLimitSchedule", []interface{}{map[string]interface{}{"gasLimit": 8_000_000}})),
+			err:         `gas limit schedule entry 0 has no timestamp`,
+		},
+		"non-zero number": {
+			genesisJSON: mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { g["number"] = "0x1" }),
+			err:         `genesis field "number": 1, expected 0`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := buildGenesisV1(t, test.genesisJSON)
+			if err == nil {
+				t.Fatal("Expected the genesis to be rejected")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Expected an error containing %q, found %q", test.err, err)
+			}
+		})
+	}
+
+	// The bytes to decode must be valid
+	service := &GenesisService{}
+	err := service.DecodeGenesis(nil, &DecodeGenesisArgs{Bytes: "0x1234", Encoding: formatting.Hex}, new(GenesisReply))
+	if err == nil || !strings.Contains(err.Error(), "failed to decode genesis bytes") {
+		t.Fatalf("Expected the invalid bytes to be rejected, found %v", err)
+	}
+	genesisBytes, err := formatting.EncodeWithChecksum(formatting.Hex, mutateGenesis(t, genesisJSONApricotPhase5, func(g map[string]interface{}) { delete(g, "alloc") }))
+	assert.NoError(t, err)
+	err = service.DecodeGenesis(nil, &DecodeGenesisArgs{Bytes: genesisBytes, Encoding: formatting.Hex}, new(GenesisReply))
+	if err == nil || !strings.Contains(err.Error(), `genesis field "alloc": missing`) {
+		t.Fatalf("Expected the decoded genesis to be validated, found %v", err)
+	}
+}
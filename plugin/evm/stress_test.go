@@ -0,0 +1,474 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow/consensus/snowman"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/units"
+	"github.com/zsmartex/avalanchego/vms/components/chain"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// Environment variables configuring TestVMStress, so that longer runs than the
+// default CI-sized one can be made without changing the test.
+const (
+	stressDurationEnv = "CORETH_STRESS_DURATION" // how long the VM is loaded, e.g. 10m
+	stressSeedEnv     = "CORETH_STRESS_SEED"     // seed of the randomized scheduling
+	stressStallEnv    = "CORETH_STRESS_STALL"    // time without progress dumping the goroutines
+)
+
+var (
+	defaultStressDuration = 2 * time.Second
+	defaultStressStall    = time.Minute
+)
+
+// stressLoggerInitCode deploys a contract emitting an empty log on every call.
+var stressLoggerInitCode = common.FromHex("0x6006600c60003960066000f360006000a000")
+
+// stressServer serves the handlers of [vm] over HTTP, taking the lock of the
+// context of [vm] as requested by each handler, as the API server of the node
+// does.
+func stressServer(t *testing.T, vm *VM) *httptest.Server {
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	for endpoint, handler := range handlers {
+		handler := handler
+		var h http.Handler = handler.Handler
+		switch handler.LockOptions {
+		case engCommon.WriteLock:
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				vm.ctx.Lock.Lock()
+				defer vm.ctx.Lock.Unlock()
+				handler.Handler.ServeHTTP(w, r)
+			})
+		case engCommon.ReadLock:
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				vm.ctx.Lock.RLock()
+				defer vm.ctx.Lock.RUnlock()
+				handler.Handler.ServeHTTP(w, r)
+			})
+		}
+		mux.Handle("/ext/bc/C"+endpoint, h)
+	}
+	return httptest.NewServer(mux)
+}
+
+// stressWatchdog dumps the stacks of all goroutines and panics if no
+// progress is reported for [stall].
+type stressWatchdog struct {
+	progress uint64
+	stall    time.Duration
+	done     chan struct{}
+}
+
+func newStressWatchdog(stall time.Duration) *stressWatchdog {
+	w := &stressWatchdog{stall: stall, done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+func (w *stressWatchdog) tick() { atomic.AddUint64(&w.progress, 1) }
+
+func (w *stressWatchdog) stop() { close(w.done) }
+
+func (w *stressWatchdog) run() {
+	ticker := time.NewTicker(w.stall / 10)
+	defer ticker.Stop()
+	last, lastChange := atomic.LoadUint64(&w.progress), time.Now()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			if progress := atomic.LoadUint64(&w.progress); progress != last {
+				last, lastChange = progress, now
+				continue
+			}
+			if now.Sub(lastChange) < w.stall {
+				continue
+			}
+			_ = pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+			panic(fmt.Sprintf("stress harness made no progress for %s", w.stall))
+		}
+	}
+}
+
+// stressEngine drives the block lifecycle of a VM as the consensus engine
+// does: it builds blocks on the preferred block, verifies them, moves the
+// preference across the processing blocks and decides the children of the
+// last accepted block, rejecting their competitors and descendants. Every
+// call is made holding the lock of the context of the VM.
+type stressEngine struct {
+	vm   *VM
+	rand *rand.Rand
+
+	lastAccepted snowman.Block
+	processing   map[ids.ID]snowman.Block
+
+	built, accepted, rejected int
+	atomicTxs, ethTxs         int // accepted
+}
+
+func (e *stressEngine) step() error {
+	e.vm.ctx.Lock.Lock()
+	defer e.vm.ctx.Lock.Unlock()
+
+	if len(e.processing) < 8 && e.rand.Intn(3) != 0 {
+		return e.build()
+	}
+	return e.decide()
+}
+
+// build builds a block on the preferred block and may prefer it.
+func (e *stressEngine) build() error {
+	blk, err := e.vm.BuildBlock()
+	if err != nil {
+		return nil // nothing to build
+	}
+	if _, ok := e.processing[blk.ID()]; ok {
+		return nil
+	}
+	if err := blk.Verify(); err != nil {
+		return fmt.Errorf("built block %s failed verification: %w", blk.ID(), err)
+	}
+	e.processing[blk.ID()] = blk
+	e.built++
+	if e.rand.Intn(2) == 0 {
+		return e.vm.SetPreference(blk.ID())
+	}
+	return e.prefer()
+}
+
+// prefer sets the preference to a random processing block, or to the last
+// accepted block.
+func (e *stressEngine) prefer() error {
+	preferred := e.lastAccepted.ID()
+	if n := e.rand.Intn(len(e.processing) + 1); n < len(e.processing) {
+		preferred = e.sorted()[n].ID()
+	}
+	return e.vm.SetPreference(preferred)
+}
+
+// sorted returns the processing blocks by height, then ID.
+func (e *stressEngine) sorted() []snowman.Block {
+	blks := make([]snowman.Block, 0, len(e.processing))
+	for _, blk := range e.processing {
+		blks = append(blks, blk)
+	}
+	sort.Slice(blks, func(i, j int) bool {
+		if blks[i].Height() != blks[j].Height() {
+			return blks[i].Height() < blks[j].Height()
+		}
+		return blks[i].ID().Hex() < blks[j].ID().Hex()
+	})
+	return blks
+}
+
+// branch returns the child of the last accepted block that [blk] descends
+// from.
+func (e *stressEngine) branch(blk snowman.Block) ids.ID {
+	for blk.Parent() != e.lastAccepted.ID() {
+		blk = e.processing[blk.Parent()]
+	}
+	return blk.ID()
+}
+
+// decide accepts a random child of the last accepted block and rejects the
+// blocks that do not descend from it.
+func (e *stressEngine) decide() error {
+	var children []snowman.Block
+	for _, blk := range e.sorted() {
+		if blk.Parent() == e.lastAccepted.ID() {
+			children = append(children, blk)
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	accepted := children[e.rand.Intn(len(children))]
+	if err := e.vm.SetPreference(accepted.ID()); err != nil {
+		return err
+	}
+	if err := accepted.Accept(); err != nil {
+		return fmt.Errorf("failed to accept %s: %w", accepted.ID(), err)
+	}
+	var rejected []snowman.Block
+	for _, blk := range e.sorted() {
+		if blk.ID() != accepted.ID() && e.branch(blk) != accepted.ID() {
+			rejected = append(rejected, blk)
+		}
+	}
+	delete(e.processing, accepted.ID())
+	e.lastAccepted = accepted
+	e.accepted++
+	blk := accepted.(*chain.BlockWrapper).Block.(*Block)
+	e.atomicTxs += len(blk.atomicTxs)
+	e.ethTxs += len(blk.ethBlock.Transactions())
+	for _, blk := range rejected {
+		if err := blk.Reject(); err != nil {
+			return fmt.Errorf("failed to reject %s: %w", blk.ID(), err)
+		}
+		delete(e.processing, blk.ID())
+		e.rejected++
+	}
+	return e.prefer()
+}
+
+// TestVMStress loads a VM with concurrent block building, verification and
+// decisions on competing blocks, eth and atomic tx issuance, and RPC queries
+// against the moving heads of the chain, before shutting it down while the
+// RPC queries are in flight. The run is randomized by [stressSeedEnv], lasts
+// [stressDurationEnv], and dumps the goroutines if it stalls for
+// [stressStallEnv].
+func TestVMStress(t *testing.T) {
+	duration, stall := defaultStressDuration, defaultStressStall
+	if env := os.Getenv(stressDurationEnv); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			t.Fatalf("invalid %s: %v", stressDurationEnv, err)
+		}
+		duration = d
+	}
+	if env := os.Getenv(stressStallEnv); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			t.Fatalf("invalid %s: %v", stressStallEnv, err)
+		}
+		stall = d
+	}
+	seed := time.Now().UnixNano()
+	if env := os.Getenv(stressSeedEnv); env != "" {
+		s, err := strconv.ParseInt(env, 10, 64)
+		if err != nil {
+			t.Fatalf("invalid %s: %v", stressSeedEnv, err)
+		}
+		seed = s
+	}
+	t.Logf("stress run of %s with %s=%d", duration, stressSeedEnv, seed)
+	seeds := rand.New(rand.NewSource(seed))
+
+	importAmount := 1000 * units.Avax
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+		testShortIDAddrs[1]: importAmount,
+	})
+	// Fund the eth txs and deploy the contract emitting their logs
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+	gasPrice := new(big.Int).Mul(initialBaseFee, big.NewInt(50))
+	signer := types.NewLondonSigner(vm.chainID)
+	deployTx, err := types.SignTx(types.NewContractCreation(0, common.Big0, 100000, gasPrice, stressLoggerInitCode), signer, testKeys[0].ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendEthTxs(t, vm, deployTx)
+	lastAccepted := buildAndAcceptBlock(t, issuer, vm)
+	logger := ethcrypto.CreateAddress(testEthAddrs[0], 0)
+
+	// The engine calls are made under the lock of the context of the VM,
+	// held by the setup of the VM until now
+	vm.ctx.Lock.Unlock()
+	go func() {
+		for range issuer {
+		}
+	}()
+	server := stressServer(t, vm)
+	defer server.Close()
+	ethClient, err := rpc.DialHTTP(server.URL + "/ext/bc/C" + ethRPCEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ethClient.Close()
+	avaxClient := NewClient(server.URL, "C")
+
+	watchdog := newStressWatchdog(stall)
+	defer watchdog.stop()
+	var (
+		// [ctx] stops the workers issuing txs and driving the engine, and
+		// [readCtx] the RPC readers, once the VM is shut down
+		ctx, cancel         = context.WithCancel(context.Background())
+		readCtx, cancelRead = context.WithCancel(context.Background())
+		wg, readWg          sync.WaitGroup
+		errs                = make(chan error, 16)
+	)
+	defer cancel()
+	defer cancelRead()
+	// randomPause yields to the scheduler for a random duration, so that the
+	// interleaving of the workers varies across runs
+	randomPause := func(r *rand.Rand) {
+		if r.Intn(4) == 0 {
+			runtime.Gosched()
+			return
+		}
+		time.Sleep(time.Duration(r.Intn(2000)) * time.Microsecond)
+	}
+	worker := func(wg *sync.WaitGroup, ctx context.Context, name string, step func(r *rand.Rand) error) {
+		r := rand.New(rand.NewSource(seeds.Int63()))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := step(r); err != nil {
+					errs <- fmt.Errorf("%s: %w", name, err)
+					return
+				}
+				watchdog.tick()
+				randomPause(r)
+			}
+		}()
+	}
+
+	engine := &stressEngine{
+		vm:           vm,
+		rand:         rand.New(rand.NewSource(seeds.Int63())),
+		lastAccepted: lastAccepted,
+		processing:   make(map[ids.ID]snowman.Block),
+	}
+	worker(&wg, ctx, "engine", func(*rand.Rand) error { return engine.step() })
+
+	// Eth txs calling the logger, with the nonce of the pending state. The
+	// txs lost to rejected blocks are replaced by later ones.
+	worker(&wg, ctx, "eth txs", func(r *rand.Rand) error {
+		var nonce hexutil.Uint64
+		if err := ethClient.CallContext(ctx, &nonce, "eth_getTransactionCount", testEthAddrs[0], "pending"); err != nil {
+			return nil
+		}
+		tx, err := types.SignTx(types.NewTransaction(uint64(nonce), logger, common.Big0, 50000, gasPrice, nil), signer, testKeys[0].ToECDSA())
+		if err != nil {
+			return err
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		_ = ethClient.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Bytes(raw))
+		return nil
+	})
+
+	// Atomic txs, importing the UTXO of the second key then exporting from
+	// its balance, issued through the avax API
+	worker(&wg, ctx, "atomic txs", func(r *rand.Rand) error {
+		vm.ctx.Lock.Lock()
+		tx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[1], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[1]})
+		if err != nil {
+			tx, err = vm.newExportTx(vm.ctx.AVAXAssetID, stressExportAmount(r), vm.ctx.XChainID, testShortIDAddrs[1], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[1]})
+		}
+		vm.ctx.Lock.Unlock()
+		if err == nil {
+			_, _ = avaxClient.IssueTx(ctx, tx.Bytes())
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	// RPC readers against the moving heads of the chain
+	for _, tag := range []string{"latest", "pending"} {
+		tag := tag
+		worker(&readWg, readCtx, "eth_call "+tag, func(r *rand.Rand) error {
+			_ = ethClient.CallContext(readCtx, nil, "eth_call", map[string]interface{}{"from": testEthAddrs[0], "to": logger}, tag)
+			_ = ethClient.CallContext(readCtx, nil, "eth_getBalance", testEthAddrs[r.Intn(2)], tag)
+			return nil
+		})
+	}
+	worker(&readWg, readCtx, "eth_getLogs", func(r *rand.Rand) error {
+		var head hexutil.Uint64
+		if err := ethClient.CallContext(readCtx, &head, "eth_blockNumber"); err != nil {
+			return nil
+		}
+		from := uint64(0)
+		if span := uint64(r.Intn(16)); uint64(head) > span {
+			from = uint64(head) - span
+		}
+		var logs []types.Log
+		_ = ethClient.CallContext(readCtx, &logs, "eth_getLogs", map[string]interface{}{
+			"fromBlock": hexutil.Uint64(from),
+			"toBlock":   "latest",
+			"address":   logger,
+		})
+		return nil
+	})
+	worker(&readWg, readCtx, "eth_getBlockByNumber", func(r *rand.Rand) error {
+		var block map[string]interface{}
+		_ = ethClient.CallContext(readCtx, &block, "eth_getBlockByNumber", "latest", true)
+		return nil
+	})
+	utxoAddr, err := vm.FormatLocalAddress(testShortIDAddrs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker(&readWg, readCtx, "avax.getUTXOs", func(r *rand.Rand) error {
+		_, _, _ = avaxClient.GetAtomicUTXOs(readCtx, []string{utxoAddr}, vm.ctx.XChainID.String(), 10, "", "")
+		return nil
+	})
+
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(duration):
+	}
+	cancel()
+	wg.Wait()
+
+	// The engine decided every block it accepted
+	vm.ctx.Lock.Lock()
+	if lastAcceptedID, err := vm.LastAccepted(); err != nil || lastAcceptedID != engine.lastAccepted.ID() {
+		t.Fatalf("expected the last accepted block to be %s, found %s (%v)", engine.lastAccepted.ID(), lastAcceptedID, err)
+	}
+	if height := vm.chain.LastAcceptedBlock().NumberU64(); height != engine.lastAccepted.Height() {
+		t.Fatalf("expected the last accepted height to be %d, found %d", engine.lastAccepted.Height(), height)
+	}
+	t.Logf("built %d blocks, accepted %d with %d eth and %d atomic txs, and rejected %d", engine.built, engine.accepted, engine.ethTxs, engine.atomicTxs, engine.rejected)
+
+	// The VM is shut down, as the node does, while the RPC readers are in
+	// flight
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	vm.ctx.Lock.Unlock()
+	cancelRead()
+	readWg.Wait()
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+}
+
+// stressExportAmount returns a random amount exported by the stress test.
+func stressExportAmount(r *rand.Rand) uint64 {
+	return uint64(1+r.Intn(10)) * units.MilliAvax
+}
@@ -0,0 +1,89 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/units"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+	"github.com/zsmartex/coreth/plugin/evm/testutils"
+)
+
+// TestSubmissionAuditExcludesGossip submits a tx over RPC and gossips another
+// one, and checks that only the submission is recorded. Txs are only gossiped
+// as of Apricot Phase 4.
+func TestSubmissionAuditExcludesGossip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.log")
+	tvm := testutils.NewTestVM(t, fmt.Sprintf(`{"submission-audit-enabled": true, "submission-audit-file": %q}`, path), "")
+	key, err := (&crypto.FactorySECP256K1R{}).NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := key.(*crypto.PrivateKeySECP256K1R)
+	tvm.FundAddress(evm.GetEthAddress(sender), units.Avax)
+	tvm.BuildAndAccept(t)
+
+	gasPrice := big.NewInt(params.LaunchMinGasPrice)
+	submitted := tvm.SendTx(t, types.NewTransaction(0, common.Address{1}, common.Big1, params.TxGas, gasPrice, nil), sender)
+
+	gossiped, err := types.SignTx(types.NewTransaction(1, common.Address{1}, common.Big1, params.TxGas, gasPrice, nil), tvm.Signer(), sender.ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err := rlp.EncodeToBytes([]*types.Transaction{gossiped})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := message.BuildCodec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gossip, err := message.BuildMessage(codec, &message.EthTxs{Txs: txs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tvm.VM.AppGossip(ids.GenerateTestShortID(), gossip); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		var nonce hexutil.Uint64
+		if err := tvm.Client().Call(&nonce, "eth_getTransactionCount", evm.GetEthAddress(sender), "pending"); err != nil {
+			t.Fatal(err)
+		}
+		if nonce > 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Gossiped tx %s did not become executable", gossiped.Hash())
+		}
+	}
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(blob), []byte{'\n'})
+	if len(lines) != 1 || !bytes.Contains(lines[0], []byte(submitted.Hash().Hex())) {
+		t.Fatalf("Expected a single record of the submission of %s, found %q", submitted.Hash(), blob)
+	}
+	if bytes.Contains(blob, []byte(gossiped.Hash().Hex())) {
+		t.Fatalf("Expected no record of the gossiped tx %s", gossiped.Hash())
+	}
+}
@@ -0,0 +1,507 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/zsmartex/avalanchego/database"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/math"
+	"github.com/zsmartex/avalanchego/utils/wrappers"
+)
+
+// supplyBackfillCommitInterval is the number of heights backfilled between
+// two writes of the backfilled totals and of the job progress.
+const supplyBackfillCommitInterval = 1024
+
+var (
+	// Prefixes of the supply delta index in [vm.db]
+	supplyDeltaPrefix     = []byte("supply_delta")
+	supplyDeltaMetaPrefix = []byte("supply_delta_meta")
+
+	// [supplyDeltaBaseKey] holds the last accepted height when the index was
+	// enabled, [supplyDeltaLastKey] the last indexed height and
+	// [supplyDeltaBackfillKey] the progress of the backfill of the heights up
+	// to the base.
+	supplyDeltaBaseKey     = []byte("base")
+	supplyDeltaLastKey     = []byte("last")
+	supplyDeltaBackfillKey = []byte("backfill")
+
+	errSupplyDeltaOff             = errors.New("supply delta index is disabled")
+	errSupplyBackfillRunning      = errors.New("a supply delta backfill job is already running")
+	errSupplyBackfillNotNeeded    = errors.New("the supply delta index covers every accepted block")
+	errSupplyDeltaCrossesBackfill = errors.New("range starts below the supply delta index base and must be backfilled first")
+)
+
+// supplyTotals are amounts of nAVAX moved by atomic txs. [Imported] is the
+// AVAX consumed from shared memory by import txs and [Exported] the AVAX put
+// into shared memory by export txs. [Burned] is the AVAX paid as fees by both,
+// so that the C-Chain supply grows by Imported-Exported-Burned.
+type supplyTotals struct {
+	Imported uint64 `json:"imported"`
+	Exported uint64 `json:"exported"`
+	Burned   uint64 `json:"burned"`
+}
+
+const supplyTotalsLen = 3 * wrappers.LongLen
+
+func (t supplyTotals) add(other supplyTotals) (supplyTotals, error) {
+	var err error
+	if t.Imported, err = math.Add64(t.Imported, other.Imported); err != nil {
+		return supplyTotals{}, err
+	}
+	if t.Exported, err = math.Add64(t.Exported, other.Exported); err != nil {
+		return supplyTotals{}, err
+	}
+	t.Burned, err = math.Add64(t.Burned, other.Burned)
+	return t, err
+}
+
+func (t supplyTotals) sub(other supplyTotals) (supplyTotals, error) {
+	var err error
+	if t.Imported, err = math.Sub64(t.Imported, other.Imported); err != nil {
+		return supplyTotals{}, err
+	}
+	if t.Exported, err = math.Sub64(t.Exported, other.Exported); err != nil {
+		return supplyTotals{}, err
+	}
+	t.Burned, err = math.Sub64(t.Burned, other.Burned)
+	return t, err
+}
+
+func (t supplyTotals) bytes() []byte {
+	b := make([]byte, supplyTotalsLen)
+	binary.BigEndian.PutUint64(b, t.Imported)
+	binary.BigEndian.PutUint64(b[wrappers.LongLen:], t.Exported)
+	binary.BigEndian.PutUint64(b[2*wrappers.LongLen:], t.Burned)
+	return b
+}
+
+func parseSupplyTotals(b []byte) (supplyTotals, error) {
+	if len(b) != supplyTotalsLen {
+		return supplyTotals{}, fmt.Errorf("supply totals must be %d bytes, found %d", supplyTotalsLen, len(b))
+	}
+	return supplyTotals{
+		Imported: binary.BigEndian.Uint64(b),
+		Exported: binary.BigEndian.Uint64(b[wrappers.LongLen:]),
+		Burned:   binary.BigEndian.Uint64(b[2*wrappers.LongLen:]),
+	}, nil
+}
+
+// atomicSupplyDelta returns the amounts of [avaxAssetID] moved by [txs].
+func atomicSupplyDelta(txs []*Tx, avaxAssetID ids.ID) (supplyTotals, error) {
+	var delta supplyTotals
+	for _, tx := range txs {
+		var moved supplyTotals
+		switch utx := tx.UnsignedAtomicTx.(type) {
+		case *UnsignedImportTx:
+			for _, in := range utx.ImportedInputs {
+				if in.AssetID() != avaxAssetID {
+					continue
+				}
+				amount, err := math.Add64(moved.Imported, in.Input().Amount())
+				if err != nil {
+					return supplyTotals{}, err
+				}
+				moved.Imported = amount
+			}
+		case *UnsignedExportTx:
+			for _, out := range utx.ExportedOutputs {
+				if out.AssetID() != avaxAssetID {
+					continue
+				}
+				amount, err := math.Add64(moved.Exported, out.Output().Amount())
+				if err != nil {
+					return supplyTotals{}, err
+				}
+				moved.Exported = amount
+			}
+		}
+		burned, err := tx.Burned(avaxAssetID)
+		if err != nil {
+			return supplyTotals{}, err
+		}
+		moved.Burned = burned
+		if delta, err = delta.add(moved); err != nil {
+			return supplyTotals{}, err
+		}
+	}
+	return delta, nil
+}
+
+func heightKey(height uint64) []byte {
+	key := make([]byte, wrappers.LongLen)
+	binary.BigEndian.PutUint64(key, height)
+	return key
+}
+
+// supplyBackfillProgress is the progress of the backfill of the heights up
+// to the base of the index, stored so that an interrupted job can be resumed.
+type supplyBackfillProgress struct {
+	// Next is the next height to backfill, and Totals the cumulative totals
+	// at the height before it.
+	Next   uint64       `json:"next"`
+	Totals supplyTotals `json:"totals"`
+	Done   bool         `json:"done"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// supplyIndex holds, for every accepted height, the cumulative amounts of AVAX
+// moved by the atomic txs of the blocks up to it.
+//
+// The totals of the blocks accepted while the index is enabled are written to
+// [vm.db] on Accept, counted from the last accepted height when it was enabled,
+// the base. The totals of the heights up to the base are written by the
+// backfill job, which also yields the totals at the base, so that the totals
+// above it can be counted from genesis. Bonus blocks are skipped, as their
+// atomic txs are not applied to shared memory.
+type supplyIndex struct {
+	lock sync.RWMutex
+
+	db     database.Database
+	metaDB database.Database
+	// The backfill job writes to [backfillDB] and [backfillMetaDB], the same
+	// entries as [db] and [metaDB] outside of [vm.db], so that its writes are
+	// never aborted with a failed Accept.
+	backfillDB     database.Database
+	backfillMetaDB database.Database
+
+	avaxAssetID  ids.ID
+	bonusHeights map[uint64]ids.ID
+
+	base       uint64
+	last       uint64
+	lastTotals supplyTotals // relative to [base]
+
+	// [backfill] is the committed progress of the backfill job, nil if it
+	// was never started.
+	backfill        *supplyBackfillProgress
+	backfillRunning bool
+}
+
+// newSupplyIndex returns the supply index held in the databases, or a new one
+// based at [lastAccepted]. If blocks were accepted while the index was
+// disabled, the index is rebased at [lastAccepted] and must be backfilled
+// again.
+func newSupplyIndex(db, metaDB, backfillDB, backfillMetaDB database.Database, avaxAssetID ids.ID, bonusHeights map[uint64]ids.ID, lastAccepted uint64) (*supplyIndex, error) {
+	idx := &supplyIndex{
+		db:             db,
+		metaDB:         metaDB,
+		backfillDB:     backfillDB,
+		backfillMetaDB: backfillMetaDB,
+		avaxAssetID:    avaxAssetID,
+		bonusHeights:   bonusHeights,
+		base:           lastAccepted,
+		last:           lastAccepted,
+	}
+	base, err := database.GetUInt64(metaDB, supplyDeltaBaseKey)
+	switch err {
+	case database.ErrNotFound:
+		return idx, idx.writeBase()
+	case nil:
+	default:
+		return nil, err
+	}
+	last, err := database.GetUInt64(metaDB, supplyDeltaLastKey)
+	if err != nil {
+		return nil, err
+	}
+	if last != lastAccepted {
+		log.Warn("Supply delta index has a gap, rebasing it at the last accepted block", "lastIndexed", last, "lastAccepted", lastAccepted)
+		if err := backfillMetaDB.Delete(supplyDeltaBackfillKey); err != nil {
+			return nil, err
+		}
+		return idx, idx.writeBase()
+	}
+	idx.base, idx.last = base, last
+	if last > base {
+		if idx.lastTotals, err = idx.stored(last); err != nil {
+			return nil, err
+		}
+	}
+	idx.backfill, err = readSupplyBackfillProgress(backfillMetaDB)
+	return idx, err
+}
+
+func (idx *supplyIndex) writeBase() error {
+	if err := database.PutUInt64(idx.metaDB, supplyDeltaBaseKey, idx.base); err != nil {
+		return err
+	}
+	return database.PutUInt64(idx.metaDB, supplyDeltaLastKey, idx.last)
+}
+
+func readSupplyBackfillProgress(db database.KeyValueReader) (*supplyBackfillProgress, error) {
+	blob, err := db.Get(supplyDeltaBackfillKey)
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress := new(supplyBackfillProgress)
+	if err := json.Unmarshal(blob, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+func writeSupplyBackfillProgress(db database.KeyValueWriter, progress *supplyBackfillProgress) error {
+	blob, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return db.Put(supplyDeltaBackfillKey, blob)
+}
+
+// stored returns the totals stored at [height].
+func (idx *supplyIndex) stored(height uint64) (supplyTotals, error) {
+	value, err := idx.db.Get(heightKey(height))
+	if err != nil {
+		return supplyTotals{}, fmt.Errorf("failed to read the supply totals at height %d: %w", height, err)
+	}
+	return parseSupplyTotals(value)
+}
+
+// backfilled returns whether the heights up to the base are backfilled, and
+// if so the totals at the base. Assumes the lock is held.
+func (idx *supplyIndex) backfilled() (supplyTotals, bool) {
+	if idx.base == 0 {
+		return supplyTotals{}, true
+	}
+	if idx.backfill == nil || !idx.backfill.Done {
+		return supplyTotals{}, false
+	}
+	return idx.backfill.Totals, true
+}
+
+// index records the atomic txs of the block accepted at [height].
+func (idx *supplyIndex) index(height uint64, txs []*Tx, isBonus bool) error {
+	var delta supplyTotals
+	if !isBonus {
+		var err error
+		if delta, err = atomicSupplyDelta(txs, idx.avaxAssetID); err != nil {
+			return err
+		}
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	totals, err := idx.lastTotals.add(delta)
+	if err != nil {
+		return err
+	}
+	if err := idx.db.Put(heightKey(height), totals.bytes()); err != nil {
+		return err
+	}
+	if err := database.PutUInt64(idx.metaDB, supplyDeltaLastKey, height); err != nil {
+		return err
+	}
+	idx.last, idx.lastTotals = height, totals
+	return nil
+}
+
+// cumulative returns the totals at [height], and whether they are counted
+// from genesis rather than from the base. Assumes the lock is held.
+func (idx *supplyIndex) cumulative(height uint64) (supplyTotals, bool, error) {
+	baseTotals, backfilled := idx.backfilled()
+	switch {
+	case height == 0:
+		return supplyTotals{}, true, nil
+	case height < idx.base:
+		if !backfilled && (idx.backfill == nil || height >= idx.backfill.Next) {
+			return supplyTotals{}, false, errSupplyDeltaCrossesBackfill
+		}
+		totals, err := idx.stored(height)
+		return totals, true, err
+	case height == idx.base:
+		return baseTotals, backfilled, nil
+	default:
+		totals, err := idx.stored(height)
+		if err != nil || !backfilled {
+			return totals, false, err
+		}
+		totals, err = totals.add(baseTotals)
+		return totals, true, err
+	}
+}
+
+// SupplyDelta is the AVAX moved by the atomic txs of the blocks accepted after
+// FromHeight up to ToHeight, in nAVAX.
+type SupplyDelta struct {
+	FromHeight uint64
+	ToHeight   uint64
+	Delta      supplyTotals
+	// FromTotals and ToTotals are the cumulative totals at the endpoints,
+	// counted from the block at CountedFrom.
+	FromTotals  supplyTotals
+	ToTotals    supplyTotals
+	CountedFrom uint64
+}
+
+// supplyDelta returns the AVAX moved by the atomic txs of the blocks in
+// (from, to].
+func (idx *supplyIndex) supplyDelta(from, to uint64) (*SupplyDelta, error) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	if from > to || to > idx.last {
+		return nil, fmt.Errorf("invalid supply delta range [%d, %d], the last indexed height is %d", from, to, idx.last)
+	}
+	fromTotals, fromGenesis, err := idx.cumulative(from)
+	if err != nil {
+		return nil, err
+	}
+	toTotals, toGenesis, err := idx.cumulative(to)
+	if err != nil {
+		return nil, err
+	}
+	if fromGenesis != toGenesis {
+		return nil, errSupplyDeltaCrossesBackfill
+	}
+	delta, err := toTotals.sub(fromTotals)
+	if err != nil {
+		return nil, err
+	}
+	result := &SupplyDelta{
+		FromHeight: from,
+		ToHeight:   to,
+		Delta:      delta,
+		FromTotals: fromTotals,
+		ToTotals:   toTotals,
+	}
+	if !toGenesis {
+		result.CountedFrom = idx.base
+	}
+	return result, nil
+}
+
+// startSupplyBackfill starts a background job writing the totals of the heights
+// up to the base of the supply index, from the accepted atomic txs. If an
+// interrupted job exists, it is resumed.
+func (vm *VM) startSupplyBackfill() (*supplyBackfillProgress, error) {
+	idx := vm.supplyIndex
+	if idx == nil {
+		return nil, errSupplyDeltaOff
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if idx.backfillRunning {
+		return nil, errSupplyBackfillRunning
+	}
+	if _, backfilled := idx.backfilled(); backfilled {
+		return nil, errSupplyBackfillNotNeeded
+	}
+	progress := &supplyBackfillProgress{Next: 1}
+	if idx.backfill != nil {
+		*progress = *idx.backfill
+		log.Info("Resuming supply delta backfill", "base", idx.base, "next", progress.Next)
+	}
+	progress.Error = ""
+
+	idx.backfillRunning = true
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+
+		err := vm.backfillSupply(idx, progress)
+		if err != nil {
+			log.Error("Supply delta backfill failed", "next", progress.Next, "err", err)
+			progress.Error = err.Error()
+			if err := writeSupplyBackfillProgress(idx.backfillMetaDB, progress); err != nil {
+				log.Error("Failed to write supply delta backfill progress", "err", err)
+			}
+		}
+
+		idx.lock.Lock()
+		idx.backfillRunning = false
+		idx.lock.Unlock()
+	}()
+	return progress, nil
+}
+
+// supplyBackfillStatus returns the progress of the supply delta backfill, the
+// base it backfills up to and whether it is running.
+func (vm *VM) supplyBackfillStatus() (*supplyBackfillProgress, uint64, bool, error) {
+	idx := vm.supplyIndex
+	if idx == nil {
+		return nil, 0, false, errSupplyDeltaOff
+	}
+
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	progress, err := readSupplyBackfillProgress(idx.backfillMetaDB)
+	return progress, idx.base, idx.backfillRunning, err
+}
+
+// backfillSupply writes the totals of the heights from [progress.Next] up to
+// the base of [idx], updating [progress] as it goes. It returns early without
+// an error if the VM shuts down, leaving the job to be resumed.
+func (vm *VM) backfillSupply(idx *supplyIndex, progress *supplyBackfillProgress) error {
+	var (
+		batch = idx.backfillDB.NewBatch()
+		start = time.Now()
+		// The base only changes at startup, while no job runs
+		base = idx.base
+	)
+	commit := func() error {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		if err := writeSupplyBackfillProgress(idx.backfillMetaDB, progress); err != nil {
+			return err
+		}
+		committed := *progress
+		idx.lock.Lock()
+		idx.backfill = &committed
+		idx.lock.Unlock()
+		return nil
+	}
+
+	for progress.Next <= base {
+		select {
+		case <-vm.shutdownChan:
+			log.Info("Interrupted supply delta backfill", "next", progress.Next, "base", base)
+			return commit()
+		default:
+		}
+
+		if _, isBonus := idx.bonusHeights[progress.Next]; !isBonus {
+			txs, err := vm.atomicTxRepository.GetByHeight(progress.Next)
+			if err != nil && err != database.ErrNotFound {
+				return err
+			}
+			delta, err := atomicSupplyDelta(txs, idx.avaxAssetID)
+			if err != nil {
+				return err
+			}
+			if progress.Totals, err = progress.Totals.add(delta); err != nil {
+				return err
+			}
+		}
+		if err := batch.Put(heightKey(progress.Next), progress.Totals.bytes()); err != nil {
+			return err
+		}
+		progress.Next++
+		if progress.Next%supplyBackfillCommitInterval == 0 {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	progress.Done = true
+	log.Info("Completed supply delta backfill", "base", base, "totals", progress.Totals, "elapsed", time.Since(start))
+	return commit()
+}
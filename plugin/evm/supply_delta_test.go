@@ -0,0 +1,171 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/json"
+)
+
+// waitSupplyBackfill waits for the supply delta backfill of [vm] to stop and
+// returns its progress.
+func waitSupplyBackfill(t *testing.T, vm *VM) *supplyBackfillProgress {
+	for i := 0; i < 500; i++ {
+		progress, _, running, err := vm.supplyBackfillStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !running {
+			return progress
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("supply delta backfill did not complete")
+	return nil
+}
+
+func TestSupplyDelta(t *testing.T) {
+	importAmount := uint64(5000000000)
+	issuer, vm, dbManager, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase2, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+		testShortIDAddrs[1]: importAmount,
+	})
+
+	// Import the UTXOs of both keys before the index is enabled
+	var blocks []supplyTotals
+	for i := 0; i < 2; i++ {
+		importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[i], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		buildAndAcceptBlock(t, issuer, vm)
+		imported := importTx.UnsignedAtomicTx.(*UnsignedImportTx)
+		blocks = append(blocks, supplyTotals{Imported: importAmount, Burned: importAmount - imported.Outs[0].Amount})
+	}
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The context is kept for the exports to reach its shared memory
+	ctx := NewContext()
+	ctx.SharedMemory = vm.ctx.SharedMemory
+	config := `{"supply-delta-index-enabled":true}`
+	vm = &VM{}
+	if err := vm.Initialize(
+		ctx,
+		dbManager,
+		[]byte(genesisJSONApricotPhase2),
+		[]byte(""),
+		[]byte(config),
+		issuer,
+		[]*engCommon.Fx{},
+		nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := vm.SetState(snow.Bootstrapping); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SetState(snow.NormalOp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Export part of the imported AVAX of both keys
+	for i, exportAmount := range []uint64{1000000000, 2500000000} {
+		exportTx, err := vm.newExportTx(vm.ctx.AVAXAssetID, exportAmount, vm.ctx.XChainID, testShortIDAddrs[i], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.issueTx(exportTx, true /*=local*/); err != nil {
+			t.Fatal(err)
+		}
+		buildAndAcceptBlock(t, issuer, vm)
+		exported := exportTx.UnsignedAtomicTx.(*UnsignedExportTx)
+		blocks = append(blocks, supplyTotals{Exported: exportAmount, Burned: exported.Ins[0].Amount - exportAmount})
+	}
+	// cumulative returns the totals of the blocks up to [height]
+	cumulative := func(height uint64) SupplyTotals {
+		var totals supplyTotals
+		for _, block := range blocks[:height] {
+			totals.Imported += block.Imported
+			totals.Exported += block.Exported
+			totals.Burned += block.Burned
+		}
+		return newSupplyTotals(totals)
+	}
+
+	service := &AvaxAPI{vm}
+	getSupplyDelta := func(from, to uint64) (*GetSupplyDeltaReply, error) {
+		reply := &GetSupplyDeltaReply{}
+		err := service.GetSupplyDelta(nil, &GetSupplyDeltaArgs{FromHeight: json.Uint64(from), ToHeight: json.Uint64(to)}, reply)
+		return reply, err
+	}
+
+	// Before the backfill, the totals are counted from the base at height 2
+	reply, err := getSupplyDelta(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDelta := SupplyTotals{Exported: cumulative(4).Exported, Burned: cumulative(4).Burned - cumulative(2).Burned}
+	if reply.Delta != expectedDelta || reply.CountedFrom != 2 || reply.FromCumulative != (SupplyTotals{}) || reply.ToCumulative != expectedDelta {
+		t.Fatalf("Expected a delta of %+v counted from height 2, found %+v", expectedDelta, reply)
+	}
+	if _, err := getSupplyDelta(1, 4); err != errSupplyDeltaCrossesBackfill {
+		t.Fatalf("Expected the range below the base to fail with %q, found %v", errSupplyDeltaCrossesBackfill, err)
+	}
+	if _, err := getSupplyDelta(3, 5); err == nil {
+		t.Fatal("Expected a range above the last accepted height to fail")
+	}
+
+	// A partially completed backfill is resumed
+	if err := writeSupplyBackfillProgress(vm.supplyIndex.backfillMetaDB, &supplyBackfillProgress{Next: 2, Totals: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.supplyIndex.backfillDB.Put(heightKey(1), blocks[0].bytes()); err != nil {
+		t.Fatal(err)
+	}
+	vm.supplyIndex.backfill, err = readSupplyBackfillProgress(vm.supplyIndex.backfillMetaDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.startSupplyBackfill(); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := blocks[0].add(blocks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress := waitSupplyBackfill(t, vm); !progress.Done || progress.Error != "" || progress.Totals != imported {
+		t.Fatalf("Expected the backfill to complete with the totals of the imports, found %+v", progress)
+	}
+	if _, err := vm.startSupplyBackfill(); err != errSupplyBackfillNotNeeded {
+		t.Fatalf("Expected a second backfill to fail with %q, found %v", errSupplyBackfillNotNeeded, err)
+	}
+
+	for _, test := range []struct{ from, to uint64 }{{0, 4}, {1, 3}, {2, 4}, {3, 3}} {
+		reply, err := getSupplyDelta(test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, to := cumulative(test.from), cumulative(test.to)
+		expectedDelta := SupplyTotals{Imported: to.Imported - from.Imported, Exported: to.Exported - from.Exported, Burned: to.Burned - from.Burned}
+		if reply.Delta != expectedDelta || reply.CountedFrom != 0 || reply.FromCumulative != from || reply.ToCumulative != to {
+			t.Fatalf("Expected a delta of %+v over (%d, %d], from %+v to %+v, found %+v", expectedDelta, test.from, test.to, from, to, reply)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// Package testutils runs a single C-Chain VM in process for the golden path
+// tests of features built on top of it: funding addresses through atomic
+// imports, building and accepting blocks and calling its RPC APIs.
+//
+// A [TestVM] is an [embed.Chain] driven by its test. Every [TestVM] owns its
+// databases, shared memory, keys and clock, and is shut down when its test
+// completes, so that tests using it may run in parallel.
+package testutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/chains/atomic"
+	"github.com/zsmartex/avalanchego/database/memdb"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/snow/consensus/snowman"
+	"github.com/zsmartex/avalanchego/utils/constants"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/formatting"
+	"github.com/zsmartex/avalanchego/utils/logging"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+	"github.com/zsmartex/avalanchego/vms/components/avax"
+	"github.com/zsmartex/avalanchego/vms/secp256k1fx"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+	"github.com/zsmartex/coreth/plugin/evm/embed"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+const (
+	// ChainID is the EVM chain ID of the genesis returned by [GenesisJSON].
+	ChainID = 43111
+
+	// BlockInterval is how far [TestVM.BuildAndAccept] advances the clock
+	// before building a block, so that blocks are produced at the rate
+	// targeted by the chain and do not pay a block gas cost.
+	BlockInterval = 2 * time.Second
+
+	// StartTime is the time the clock of a [TestVM] starts at.
+	StartTime = 1_600_000_000
+
+	// buildTimeout is how long [TestVM.BuildAndAccept] waits for the VM to
+	// request a block to be built.
+	buildTimeout = 10 * time.Second
+
+	// x2cRate is the number of wei per nAVAX.
+	x2cRate = 1_000_000_000
+)
+
+var (
+	cChainID    = embed.DefaultChainID
+	xChainID    = embed.DefaultXChainID
+	avaxAssetID = embed.DefaultAVAXAssetID
+
+	errNoBlockRequested = errors.New("the VM did not request a block to be built")
+)
+
+// GenesisJSON returns a genesis with the chain ID [ChainID], the rules of
+// [config] and no allocations.
+func GenesisJSON(config *params.ChainConfig) string {
+	chainConfig := *config
+	chainConfig.ChainID = big.NewInt(ChainID)
+	configJSON, err := json.Marshal(&chainConfig)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf(`{"config":%s,"nonce":"0x0","timestamp":"0x0","extraData":"0x00","gasLimit":"0x5f5e100","difficulty":"0x0","alloc":{}}`, configJSON)
+}
+
+// TestVM is a bootstrapped VM with its engine side played by the test.
+type TestVM struct {
+	// VM is the VM under test.
+	VM *evm.VM
+
+	t            *testing.T
+	chain        *embed.Chain
+	chainConfig  *params.ChainConfig
+	sharedMemory *atomic.Memory
+	clock        mockable.Clock
+
+	// fundKey owns the UTXOs imported by [FundAddress], which are numbered
+	// by [fundedUTXOs].
+	fundKey     *crypto.PrivateKeySECP256K1R
+	fundedUTXOs uint64
+}
+
+// NewTestVM returns a bootstrapped VM with the config [configJSON] and the
+// genesis [genesisJSON], or the genesis of the latest rules if it is empty.
+// The VM is shut down when [t] completes.
+func NewTestVM(t *testing.T, configJSON, genesisJSON string) *TestVM {
+	t.Helper()
+
+	if genesisJSON == "" {
+		genesisJSON = GenesisJSON(params.TestApricotPhase5Config)
+	}
+	genesis := &core.Genesis{}
+	if err := json.Unmarshal([]byte(genesisJSON), genesis); err != nil {
+		t.Fatalf("Failed to parse genesis: %s", err)
+	}
+	genesisReply, err := (&evm.StaticService{}).BuildGenesis(nil, genesis)
+	if err != nil {
+		t.Fatalf("Failed to build genesis: %s", err)
+	}
+	genesisBytes, err := formatting.Decode(genesisReply.Encoding, genesisReply.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to decode genesis: %s", err)
+	}
+
+	sharedMemory := &atomic.Memory{}
+	if err := sharedMemory.Initialize(logging.NoLog{}, memdb.New()); err != nil {
+		t.Fatal(err)
+	}
+	fundKey, err := (&crypto.FactorySECP256K1R{}).NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tvm := &TestVM{
+		t:            t,
+		chainConfig:  genesis.Config,
+		sharedMemory: sharedMemory,
+		fundKey:      fundKey.(*crypto.PrivateKeySECP256K1R),
+	}
+	tvm.clock.Set(time.Unix(StartTime, 0))
+	if tvm.chain, err = embed.New(embed.Config{
+		Database:     memdb.New(),
+		Genesis:      genesisBytes,
+		ConfigJSON:   []byte(configJSON),
+		Clock:        &tvm.clock,
+		SharedMemory: sharedMemory.NewSharedMemory(cChainID),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := tvm.chain.Shutdown(); err != nil {
+			t.Errorf("Failed to shut down the VM: %s", err)
+		}
+	})
+	tvm.VM = tvm.chain.VM()
+	return tvm
+}
+
+// Client returns a client attached to the eth RPC API of the VM.
+func (tvm *TestVM) Client() *rpc.Client { return tvm.chain.Client() }
+
+// ChainID returns the EVM chain ID of the VM.
+func (tvm *TestVM) ChainID() *big.Int { return tvm.chainConfig.ChainID }
+
+// Signer returns the signer of the latest rules of the VM.
+func (tvm *TestVM) Signer() types.Signer { return types.LatestSignerForChainID(tvm.ChainID()) }
+
+// Time returns the time of the clock of the VM.
+func (tvm *TestVM) Time() time.Time { return tvm.clock.Time() }
+
+// SetTime sets the clock of the VM, which only moves when set or advanced.
+func (tvm *TestVM) SetTime(now time.Time) { tvm.clock.Set(now) }
+
+// AdvanceTime moves the clock of the VM forward by [d].
+func (tvm *TestVM) AdvanceTime(d time.Duration) { tvm.SetTime(tvm.Time().Add(d)) }
+
+// FundAddress issues an import of [amount] nAVAX to [addr] from a UTXO it
+// puts in shared memory, which is accepted with the next block built. The
+// UTXO also covers the highest fee the import could be charged.
+func (tvm *TestVM) FundAddress(addr common.Address, amount uint64) {
+	tvm.t.Helper()
+
+	tvm.fundedUTXOs++
+	utxoID := avax.UTXOID{TxID: ids.Empty.Prefix(tvm.fundedUTXOs)}
+	tx, err := tvm.importTx(utxoID, addr, amount, 0)
+	if err != nil {
+		tvm.t.Fatal(err)
+	}
+	fee, err := tvm.maxImportFee(tx)
+	if err != nil {
+		tvm.t.Fatal(err)
+	}
+	if tx, err = tvm.importTx(utxoID, addr, amount, fee); err != nil {
+		tvm.t.Fatal(err)
+	}
+
+	utxo := &avax.UTXO{
+		UTXOID: utxoID,
+		Asset:  avax.Asset{ID: avaxAssetID},
+		Out: &secp256k1fx.TransferOutput{
+			Amt: amount + fee,
+			OutputOwners: secp256k1fx.OutputOwners{
+				Threshold: 1,
+				Addrs:     []ids.ShortID{tvm.fundKey.PublicKey().Address()},
+			},
+		},
+	}
+	utxoBytes, err := evm.Codec.Marshal(0, utxo)
+	if err != nil {
+		tvm.t.Fatal(err)
+	}
+	inputID := utxo.InputID()
+	if err := tvm.sharedMemory.NewSharedMemory(xChainID).Apply(map[ids.ID]*atomic.Requests{cChainID: {PutRequests: []*atomic.Element{{
+		Key:    inputID[:],
+		Value:  utxoBytes,
+		Traits: [][]byte{tvm.fundKey.PublicKey().Address().Bytes()},
+	}}}}); err != nil {
+		tvm.t.Fatalf("Failed to add the UTXO to shared memory: %s", err)
+	}
+
+	if err := tvm.chain.SubmitAtomicTx(tx); err != nil {
+		tvm.t.Fatalf("Failed to issue the import of %d nAVAX to %s: %s", amount, addr.Hex(), err)
+	}
+}
+
+// importTx returns the signed import of [amount] nAVAX to [addr], paying
+// [fee], from the UTXO [utxoID] of the fund key.
+func (tvm *TestVM) importTx(utxoID avax.UTXOID, addr common.Address, amount, fee uint64) (*evm.Tx, error) {
+	tx := &evm.Tx{UnsignedAtomicTx: &evm.UnsignedImportTx{
+		NetworkID:    constants.UnitTestID,
+		BlockchainID: cChainID,
+		SourceChain:  xChainID,
+		ImportedInputs: []*avax.TransferableInput{{
+			UTXOID: utxoID,
+			Asset:  avax.Asset{ID: avaxAssetID},
+			In: &secp256k1fx.TransferInput{
+				Amt:   amount + fee,
+				Input: secp256k1fx.Input{SigIndices: []uint32{0}},
+			},
+		}},
+		Outs: []evm.EVMOutput{{Address: addr, Amount: amount, AssetID: avaxAssetID}},
+	}}
+	if err := tx.Sign(evm.Codec, [][]*crypto.PrivateKeySECP256K1R{{tvm.fundKey}}); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// maxImportFee returns the fee of [tx] in the next block at the highest base
+// fee of its rules, in nAVAX. The fee is the highest of the rules at the time
+// [tx] is issued and at the time of the next block, [BlockInterval] later, as
+// both verify it. The size of [tx] does not depend on its fee.
+func (tvm *TestVM) maxImportFee(tx *evm.Tx) (uint64, error) {
+	lastAccepted, err := tvm.VM.LastAccepted()
+	if err != nil {
+		return 0, err
+	}
+	blk, err := tvm.VM.GetBlock(lastAccepted)
+	if err != nil {
+		return 0, err
+	}
+	var maxFee uint64
+	for _, timestamp := range []time.Time{tvm.Time(), tvm.Time().Add(BlockInterval)} {
+		rules := tvm.chainConfig.AvalancheRules(new(big.Int).SetUint64(blk.Height()+1), big.NewInt(timestamp.Unix()))
+		fee, err := maxImportFeeAt(tx, rules)
+		if err != nil {
+			return 0, err
+		}
+		if fee > maxFee {
+			maxFee = fee
+		}
+	}
+	return maxFee, nil
+}
+
+// maxImportFeeAt returns the fee of [tx] at the highest base fee of [rules],
+// in nAVAX.
+func maxImportFeeAt(tx *evm.Tx, rules params.Rules) (uint64, error) {
+	var maxBaseFee int64
+	switch {
+	case rules.IsApricotPhase4:
+		maxBaseFee = params.ApricotPhase4MaxBaseFee
+	case rules.IsApricotPhase3:
+		maxBaseFee = params.ApricotPhase3MaxBaseFee
+	case rules.IsApricotPhase2:
+		return params.AvalancheAtomicTxFee, nil
+	default:
+		return 0, nil
+	}
+	gasUsed, err := tx.GasUsed(rules.IsApricotPhase5)
+	if err != nil {
+		return 0, err
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), big.NewInt(maxBaseFee))
+	fee.Add(fee, big.NewInt(x2cRate-1))
+	return fee.Div(fee, big.NewInt(x2cRate)).Uint64(), nil
+}
+
+// BuildAndAccept waits for the VM to request a block, advances the clock by
+// [BlockInterval], and builds, verifies, prefers and accepts the block. It
+// returns once the tx pool is reset to the accepted block.
+func (tvm *TestVM) BuildAndAccept(t *testing.T) snowman.Block {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	defer cancel()
+	if err := tvm.chain.WaitForBuildRequest(ctx); err != nil {
+		t.Fatal(errNoBlockRequested)
+	}
+	tvm.AdvanceTime(BlockInterval)
+	blk, err := tvm.chain.BuildBlock()
+	if err != nil {
+		t.Fatalf("Failed to build a block: %s", err)
+	}
+	if err := tvm.chain.VerifyBlock(blk); err != nil {
+		t.Fatalf("Failed to verify block %s: %s", blk.ID(), err)
+	}
+	if err := tvm.chain.AcceptBlock(blk); err != nil {
+		t.Fatal(err)
+	}
+	return blk
+}
+
+// SendTx signs [tx] with [key] and submits it through the RPC API. It
+// returns once the tx is executable in the tx pool, so that the next block
+// built includes it if it pays enough.
+func (tvm *TestVM) SendTx(t *testing.T, tx *types.Transaction, key *crypto.PrivateKeySECP256K1R) *types.Transaction {
+	t.Helper()
+
+	signed, err := types.SignTx(tx, tvm.Signer(), key.ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash common.Hash
+	if err := tvm.Client().Call(&hash, "eth_sendRawTransaction", hexutil.Bytes(raw)); err != nil {
+		t.Fatalf("Failed to send tx %s: %s", signed.Hash(), err)
+	}
+	from, err := types.Sender(tvm.Signer(), signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(buildTimeout); ; time.Sleep(time.Millisecond) {
+		var nonce hexutil.Uint64
+		if err := tvm.Client().Call(&nonce, "eth_getTransactionCount", from, "pending"); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(nonce) > signed.Nonce() {
+			return signed
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Tx %s did not become executable", signed.Hash())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package testutils
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/units"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm"
+)
+
+// storerInitCode deploys a contract storing the first word of its calldata
+// in slot 0 and returning 42.
+var storerInitCode = common.FromHex("0x6010600c60003960106000f3" + "600035600055602a60005260206000f3")
+
+// TestDeployCallTrace funds an account, deploys a contract, calls it and
+// traces the call, under the rules with fixed and with dynamic fees.
+func TestDeployCallTrace(t *testing.T) {
+	for name, config := range map[string]*params.ChainConfig{
+		"apricotPhase2": params.TestApricotPhase2Config,
+		"apricotPhase5": params.TestApricotPhase5Config,
+	} {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tvm := NewTestVM(t, `{"eth-api-method-groups":["debug-tracer"]}`, GenesisJSON(config))
+			client := tvm.Client()
+			key, err := (&crypto.FactorySECP256K1R{}).NewPrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender := key.(*crypto.PrivateKeySECP256K1R)
+			addr := evm.GetEthAddress(sender)
+
+			tvm.FundAddress(addr, units.Avax)
+			funded := tvm.BuildAndAccept(t)
+			if !funded.Timestamp().Equal(tvm.Time()) {
+				t.Fatalf("Expected block %d at %s, found %s", funded.Height(), tvm.Time(), funded.Timestamp())
+			}
+			var balance hexutil.Big
+			if err := client.Call(&balance, "eth_getBalance", addr, "latest"); err != nil {
+				t.Fatal(err)
+			}
+			if expected := new(big.Int).Mul(new(big.Int).SetUint64(units.Avax), big.NewInt(x2cRate)); balance.ToInt().Cmp(expected) != 0 {
+				t.Fatalf("Expected a balance of %d, found %d", expected, balance.ToInt())
+			}
+
+			// Deploy the contract
+			gasPrice := big.NewInt(params.LaunchMinGasPrice)
+			deploy := tvm.SendTx(t, types.NewContractCreation(0, common.Big0, 100_000, gasPrice, storerInitCode), sender)
+			tvm.BuildAndAccept(t)
+			var receipt *types.Receipt
+			if err := client.Call(&receipt, "eth_getTransactionReceipt", deploy.Hash()); err != nil {
+				t.Fatal(err)
+			}
+			contract := ethcrypto.CreateAddress(addr, 0)
+			if receipt == nil || receipt.Status != types.ReceiptStatusSuccessful || receipt.ContractAddress != contract {
+				t.Fatalf("Expected the contract to be deployed at %s, found %+v", contract.Hex(), receipt)
+			}
+
+			// Call it without and with a transaction
+			data := common.LeftPadBytes([]byte{7}, 32)
+			var result hexutil.Bytes
+			if err := client.Call(&result, "eth_call", map[string]interface{}{
+				"from": addr,
+				"to":   contract,
+				"data": hexutil.Bytes(data),
+			}, "latest"); err != nil {
+				t.Fatal(err)
+			}
+			if new(big.Int).SetBytes(result).Int64() != 42 {
+				t.Fatalf("Expected the call to return 42, found %x", result)
+			}
+			call := tvm.SendTx(t, types.NewTransaction(1, contract, common.Big0, 50_000, gasPrice, data), sender)
+			tvm.BuildAndAccept(t)
+			var stored common.Hash
+			if err := client.Call(&stored, "eth_getStorageAt", contract, "0x0", "latest"); err != nil {
+				t.Fatal(err)
+			}
+			if stored != common.BytesToHash(data) {
+				t.Fatalf("Expected the call to store %x, found %x", data, stored)
+			}
+
+			// Trace the call
+			var trace struct {
+				Failed      bool   `json:"failed"`
+				ReturnValue string `json:"returnValue"`
+				StructLogs  []struct {
+					Op string `json:"op"`
+				} `json:"structLogs"`
+			}
+			if err := client.Call(&trace, "debug_traceTransaction", call.Hash()); err != nil {
+				t.Fatal(err)
+			}
+			if trace.Failed || trace.ReturnValue != common.Bytes2Hex(common.LeftPadBytes([]byte{42}, 32)) {
+				t.Fatalf("Expected the trace to return 42, found %+v", trace)
+			}
+			var stores int
+			for _, log := range trace.StructLogs {
+				if log.Op == "SSTORE" {
+					stores++
+				}
+			}
+			if stores != 1 {
+				t.Fatalf("Expected the trace to store once, found %d stores in %+v", stores, trace.StructLogs)
+			}
+		})
+	}
+}
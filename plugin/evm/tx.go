@@ -280,6 +280,32 @@ func calcBytesCost(len int) uint64 {
 	return uint64(len) * TxBytesGas
 }
 
+// AtomicOpsDigest returns the hash of the atomic operations of [txs], merged
+// and encoded as they are indexed in the atomic trie for the block holding
+// [txs], ordered by chain ID.
+func AtomicOpsDigest(txs []*Tx) (common.Hash, error) {
+	ops, err := mergeAtomicOps(txs)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	chainIDs := make([]ids.ID, 0, len(ops))
+	for chainID := range ops {
+		chainIDs = append(chainIDs, chainID)
+	}
+	sort.Slice(chainIDs, func(i, j int) bool { return bytes.Compare(chainIDs[i][:], chainIDs[j][:]) < 0 })
+	var buf []byte
+	for _, chainID := range chainIDs {
+		requestsBytes, err := Codec.Marshal(codecVersion, ops[chainID])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		buf = append(buf, chainID[:]...)
+		buf = append(buf, requestsBytes...)
+	}
+	digest := common.Hash(hashing.ComputeHash256Array(buf))
+	return digest, nil
+}
+
 // mergeAtomicOps merges atomic requests represented by [txs]
 // to the [output] map, depending on whether [chainID] is present in the map.
 func mergeAtomicOps(txs []*Tx) (map[ids.ID]*atomic.Requests, error) {
@@ -0,0 +1,121 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestTxPoolFeeHistogram(t *testing.T) {
+	issuer, vm, _, _, sender := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-transaction-pool", "internal-public-tx-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	// Submit an executable tx and one queued behind a nonce gap
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	for _, nonce := range []uint64{0, 2} {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hash common.Hash
+		if err := client.CallContext(context.Background(), &hash, "eth_sendRawTransaction", hexutil.Bytes(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type bucket struct {
+		From  *hexutil.Big   `json:"from"`
+		To    *hexutil.Big   `json:"to"`
+		Count hexutil.Uint   `json:"count"`
+		Gas   hexutil.Uint64 `json:"gas"`
+	}
+	type distribution struct {
+		EffectiveTip            []bucket       `json:"effectiveTip"`
+		MaxFee                  []bucket       `json:"maxFee"`
+		BelowBaseFee            bucket         `json:"belowBaseFee"`
+		EffectiveTipPercentiles []*hexutil.Big `json:"effectiveTipPercentiles"`
+		MaxFeePercentiles       []*hexutil.Big `json:"maxFeePercentiles"`
+	}
+	var histogram struct {
+		BaseFee *hexutil.Big `json:"baseFee"`
+		Pending distribution `json:"pending"`
+		Queued  distribution `json:"queued"`
+	}
+	feeHistogram := func() {
+		if err := client.Call(&histogram, "txpool_feeHistogram", []*hexutil.Big{(*hexutil.Big)(gasPrice)}); err != nil {
+			t.Fatal(err)
+		}
+		if histogram.BaseFee == nil {
+			t.Fatal("Expected the base fee of the pool")
+		}
+	}
+
+	// The tip paid at the base fee is below the gas price both txs are capped at
+	feeHistogram()
+	for name, d := range map[string]distribution{"pending": histogram.Pending, "queued": histogram.Queued} {
+		if len(d.EffectiveTip) != 2 || d.EffectiveTip[0].Count != 1 || d.EffectiveTip[0].Gas != hexutil.Uint64(params.TxGas) || d.EffectiveTip[1].Count != 0 {
+			t.Fatalf("Expected 1 %s tx in the first tip bucket, found %+v", name, d.EffectiveTip)
+		}
+		if len(d.MaxFee) != 2 || d.MaxFee[1].Count != 1 || d.MaxFee[1].From.ToInt().Cmp(gasPrice) != 0 || d.MaxFee[1].To != nil {
+			t.Fatalf("Expected 1 %s tx in the last fee cap bucket, found %+v", name, d.MaxFee)
+		}
+		if len(d.MaxFeePercentiles) != 5 || d.MaxFeePercentiles[2].ToInt().Cmp(gasPrice) != 0 {
+			t.Fatalf("Expected the %s fee cap percentiles at the gas price, found %v", name, d.MaxFeePercentiles)
+		}
+		if tip := new(big.Int).Add(d.EffectiveTipPercentiles[2].ToInt(), histogram.BaseFee.ToInt()); tip.Cmp(gasPrice) > 0 {
+			t.Fatalf("Expected the %s tip with the base fee to be at most the gas price, found %d", name, tip)
+		}
+	}
+
+	// Accepting the executable tx leaves only the queued one
+	buildAndAcceptBlock(t, issuer, vm)
+	feeHistogram()
+	if histogram.Pending.EffectiveTip[0].Count != 0 || histogram.Pending.MaxFee[1].Count != 0 || histogram.Pending.EffectiveTipPercentiles != nil {
+		t.Fatalf("Expected no pending tx, found %+v", histogram.Pending)
+	}
+	if histogram.Queued.EffectiveTip[0].Count != 1 || histogram.Queued.MaxFee[1].Count != 1 {
+		t.Fatalf("Expected the queued tx, found %+v", histogram.Queued)
+	}
+
+	if err := client.Call(&histogram, "txpool_feeHistogram", []*hexutil.Big{(*hexutil.Big)(gasPrice), (*hexutil.Big)(big.NewInt(1))}); err == nil {
+		t.Fatal("Expected the decreasing bucket bounds to be rejected")
+	}
+}
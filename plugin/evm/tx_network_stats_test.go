@@ -0,0 +1,126 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/plugin/evm/message"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestTxNetworkStats(t *testing.T) {
+	issuer, vm, _, _, sender := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, `{"tx-network-stats-enabled":true}`, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	connectGossipPeer(t, vm)
+	sender.CantSendAppGossipSpecific = false
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-transaction-pool", "internal-public-tx-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	signedTx := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	// Submit a tx over RPC and two via gossip, one of them twice
+	b, err := signedTx(0).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash common.Hash
+	if err := client.CallContext(context.Background(), &hash, "eth_sendRawTransaction", hexutil.Bytes(b)); err != nil {
+		t.Fatal(err)
+	}
+	for _, txs := range [][]*types.Transaction{{signedTx(1), signedTx(2)}, {signedTx(2)}} {
+		txBytes, err := rlp.EncodeToBytes(txs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgBytes, err := message.BuildMessage(vm.networkCodec, &message.EthTxs{Txs: txBytes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.AppGossip(ids.GenerateTestShortID(), msgBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	networkStats := func() map[string]interface{} {
+		var stats map[string]interface{}
+		if err := client.Call(&stats, "txpool_networkStats"); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+	for _, window := range []string{"lastMinute", "lastHour"} {
+		stats := networkStats()[window].(map[string]interface{})
+		if stats["rpc"] != "0x1" || stats["gossip"] != "0x2" || stats["included"] != "0x0" {
+			t.Fatalf("Expected 1 tx seen via RPC and 2 via gossip in %s, found %v", window, stats)
+		}
+	}
+
+	buildAndAcceptBlock(t, issuer, vm)
+	for _, window := range []string{"lastMinute", "lastHour"} {
+		stats := networkStats()[window].(map[string]interface{})
+		if stats["included"] != "0x3" {
+			t.Fatalf("Expected the 3 txs to be included in %s, found %v", window, stats)
+		}
+		if _, ok := stats["avgInclusionLatencyMs"]; !ok {
+			t.Fatalf("Expected the inclusion latency in %s, found %v", window, stats)
+		}
+	}
+}
+
+func TestTxNetworkStatsDisabled(t *testing.T) {
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase5, "", "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-tx-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	var stats map[string]interface{}
+	if err := client.Call(&stats, "txpool_networkStats"); err == nil {
+		t.Fatal("Expected txpool_networkStats to fail when network stats are disabled")
+	}
+}
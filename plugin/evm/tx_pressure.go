@@ -0,0 +1,88 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zsmartex/coreth/core"
+)
+
+// txPressureRetryAfter is the backoff suggested to the clients whose
+// transactions are rejected under pressure, giving the block builder time to
+// include pending transactions and free capacity.
+var txPressureRetryAfter = maxBlockTime
+
+// txPressure is the fraction of the capacity in use of each of the sources of
+// pressure on transaction admission.
+type txPressure struct {
+	// EthTxPool is the fraction of the slots of the eth txpool in use
+	EthTxPool float64
+	// AtomicMempool is the fraction of the atomic mempool in use
+	AtomicMempool float64
+	// BuildBacklog is the fraction of the executable slots of the eth txpool
+	// used by transactions awaiting a block
+	BuildBacklog float64
+}
+
+// max returns the highest pressure of [p].
+func (p txPressure) max() float64 {
+	max := p.EthTxPool
+	if p.AtomicMempool > max {
+		max = p.AtomicMempool
+	}
+	if p.BuildBacklog > max {
+		max = p.BuildBacklog
+	}
+	return max
+}
+
+// txPressure returns the current pressure on transaction admission.
+func (vm *VM) txPressure() txPressure {
+	ethTxPool, buildBacklog := vm.chain.GetTxPool().Occupancy()
+	return txPressure{
+		EthTxPool:     ethTxPool,
+		AtomicMempool: float64(vm.mempool.Len()) / float64(vm.mempool.maxSize),
+		BuildBacklog:  buildBacklog,
+	}
+}
+
+// checkTxPressure returns a core.TxPoolPressureError if the pressure on
+// transaction admission reached the configured threshold, so that the
+// transactions submitted over RPC are rejected with a retryable error instead
+// of being added to a pool that would drop them or evict others.
+//
+// Transactions submitted over RPC are local, and keep their priority
+// admission, if local transactions are enabled.
+func (vm *VM) checkTxPressure() error {
+	threshold := vm.config.TxPressureThreshold
+	if threshold <= 0 || vm.config.LocalTxsEnabled {
+		return nil
+	}
+	if pressure := vm.txPressure().max(); pressure >= threshold {
+		return &core.TxPoolPressureError{
+			Pressure:   pressure,
+			Threshold:  threshold,
+			RetryAfter: txPressureRetryAfter,
+		}
+	}
+	return nil
+}
+
+// txPressureHealth returns the details of the pressure on transaction
+// admission, and an error if it reached the configured threshold, whether
+// or not local transactions are enabled.
+func (vm *VM) txPressureHealth() (map[string]string, error) {
+	pressure := vm.txPressure()
+	details := map[string]string{
+		"ethTxPool":     strconv.FormatFloat(pressure.EthTxPool, 'f', 4, 64),
+		"atomicMempool": strconv.FormatFloat(pressure.AtomicMempool, 'f', 4, 64),
+		"buildBacklog":  strconv.FormatFloat(pressure.BuildBacklog, 'f', 4, 64),
+	}
+	if threshold := vm.config.TxPressureThreshold; threshold > 0 && pressure.max() >= threshold {
+		return details, fmt.Errorf("%w: pressure %.4f above threshold %.4f", core.ErrTxPoolPressure, pressure.max(), threshold)
+	}
+	return details, nil
+}
@@ -0,0 +1,145 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/avalanchego/api"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/utils/crypto"
+	"github.com/zsmartex/avalanchego/utils/formatting"
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestTxPressure(t *testing.T) {
+	tests := map[string]struct {
+		config             string
+		degraded, rejected bool
+	}{
+		"remote txs rejected": {config: `{"tx-pressure-threshold":0.001}`, degraded: true, rejected: true},
+		"local txs admitted":  {config: `{"tx-pressure-threshold":0.001,"local-txs-enabled":true}`, degraded: true},
+		"check disabled":      {config: `{}`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			testTxPressure(t, test.config, test.degraded, test.rejected)
+		})
+	}
+}
+
+func testTxPressure(t *testing.T, config string, degraded, rejected bool) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	keys := []*crypto.PrivateKeySECP256K1R{testKeys[0]}
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	// Fill the pool past the threshold of 0.001 of its 5120 executable slots
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	signedTx := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	txs := make([]*types.Transaction, 10)
+	for i := range txs {
+		txs[i] = signedTx(uint64(i))
+	}
+	for i, err := range vm.chain.AddRemoteTxsSync(txs) {
+		if err != nil {
+			t.Fatalf("Failed to add tx at index %d: %s", i, err)
+		}
+	}
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-transaction-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+	sendTx := func(tx *types.Transaction) error {
+		b, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hash common.Hash
+		return client.CallContext(context.Background(), &hash, "eth_sendRawTransaction", hexutil.Bytes(b))
+	}
+	issueExportTx := func() error {
+		exportTx, err := vm.newExportTx(vm.ctx.AVAXAssetID, 1000000, vm.ctx.XChainID, testShortIDAddrs[0], initialBaseFee, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := formatting.EncodeWithChecksum(formatting.Hex, exportTx.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return (&AvaxAPI{vm}).IssueTx(nil, &api.FormattedTx{Tx: encoded, Encoding: formatting.Hex}, &api.JSONTxID{})
+	}
+
+	if _, err := vm.HealthCheck(); degraded != errors.Is(err, core.ErrTxPoolPressure) {
+		t.Fatalf("Expected the health check to report degraded %t, found %v", degraded, err)
+	}
+	sendErr := sendTx(signedTx(10))
+	if !rejected {
+		if sendErr != nil {
+			t.Fatalf("Expected the tx to be admitted, found %v", sendErr)
+		}
+		if err := issueExportTx(); err != nil {
+			t.Fatalf("Expected the atomic tx to be admitted, found %v", err)
+		}
+		return
+	}
+
+	var dataErr rpc.DataError
+	if !errors.As(sendErr, &dataErr) {
+		t.Fatalf("Expected an error with data, found %v", sendErr)
+	}
+	data := dataErr.ErrorData().(map[string]interface{})
+	if data["reason"] != "txPoolPressure" || data["retryAfter"] != "0x3" {
+		t.Fatalf("Expected a txPoolPressure rejection with a retry after 3 seconds, found %v", data)
+	}
+	if err := issueExportTx(); !errors.Is(err, core.ErrTxPoolPressure) {
+		t.Fatalf("Expected the atomic tx to fail with %v, found %v", core.ErrTxPoolPressure, err)
+	}
+	if vm.chain.GetTxPool().Has(signedTx(10).Hash()) {
+		t.Fatal("Expected the rejected tx not to be added to the pool")
+	}
+
+	// Accepting the pending txs frees capacity
+	buildAndAcceptBlock(t, issuer, vm)
+	if _, err := vm.HealthCheck(); err != nil {
+		t.Fatalf("Expected a healthy chain after the txs were accepted, found %v", err)
+	}
+	if err := issueExportTx(); err != nil {
+		t.Fatalf("Expected the atomic tx to be admitted after the txs were accepted, found %v", err)
+	}
+	if err := sendTx(signedTx(11)); err != nil {
+		t.Fatalf("Expected the tx to be admitted after the txs were accepted, found %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/avalanchego/version"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// TestTxPropagationReceipts submits a tx to a VM gossiping with another one,
+// and checks that the receipt of the tx counts the gossip of it back.
+func TestTxPropagationReceipts(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisJSON, err := fundAddressByGenesis([]common.Address{crypto.PubkeyToAddress(key.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, submitter, _, _, submitterSender := GenesisVM(t, true, genesisJSON, `{"tx-propagation-receipts-enabled":true}`, "")
+	_, peer, _, _, peerSender := GenesisVM(t, true, genesisJSON, "", "")
+	defer func() {
+		for _, vm := range []*VM{submitter, peer} {
+			if err := vm.Shutdown(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+	submitterID, peerID := ids.GenerateTestShortID(), ids.GenerateTestShortID()
+	for _, vm := range []*VM{submitter, peer} {
+		vm.chain.GetTxPool().SetGasPrice(common.Big1)
+		vm.chain.GetTxPool().SetMinFee(common.Big0)
+	}
+	if err := submitter.Network.Connected(peerID, version.NewDefaultApplication("corethtest", 1, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Network.Connected(submitterID, version.NewDefaultApplication("corethtest", 1, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	// Each VM delivers its gossip to the other one
+	submitterSender.CantSendAppGossipSpecific = false
+	submitterSender.SendAppGossipSpecificF = func(_ ids.ShortSet, msg []byte) error { return peer.AppGossip(submitterID, msg) }
+	peerSender.CantSendAppGossipSpecific = false
+	peerSender.SendAppGossipSpecificF = func(_ ids.ShortSet, msg []byte) error { return submitter.AppGossip(peerID, msg) }
+
+	handler := submitter.chain.NewRPCHandler(0)
+	if err := submitter.chain.AttachEthService(handler, []string{"internal-public-transaction-pool", "internal-public-tx-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	tx, err := types.SignTx(types.NewTransaction(0, common.Address{1}, common.Big1, params.TxGas, common.Big1, nil), types.NewEIP155Signer(submitter.chainID), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CallContext(context.Background(), nil, "eth_sendRawTransaction", hexutil.Bytes(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	var status map[string]interface{}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if err := client.Call(&status, "txpool_propagationStatus", tx.Hash()); err != nil {
+			t.Fatal(err)
+		}
+		if status != nil && status["peersSeenBack"] == "0x1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the tx to be gossiped back by the peer, found %v", status)
+		}
+	}
+	if status["peersGossiped"] != "0x1" || status["gossips"] == "0x0" {
+		t.Fatalf("Expected the tx to be gossiped to the peer, found %v", status)
+	}
+	for _, field := range []string{"firstGossipedMs", "lastGossipedMs", "firstSeenBackMs", "lastSeenBackMs"} {
+		if status[field] == nil {
+			t.Fatalf("Expected %s to be set, found %v", field, status)
+		}
+	}
+
+	// The peer does not track the propagation
+	peerHandler := peer.chain.NewRPCHandler(0)
+	if err := peer.chain.AttachEthService(peerHandler, []string{"internal-public-tx-pool"}); err != nil {
+		t.Fatal(err)
+	}
+	peerClient := rpc.DialInProc(peerHandler)
+	defer peerClient.Close()
+	if err := peerClient.Call(&status, "txpool_propagationStatus", tx.Hash()); err == nil {
+		t.Fatal("Expected txpool_propagationStatus to fail when propagation receipts are disabled")
+	}
+}
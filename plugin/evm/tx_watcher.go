@@ -0,0 +1,252 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/zsmartex/avalanchego/utils/json"
+	"github.com/zsmartex/avalanchego/utils/timer/mockable"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+const (
+	// [txWatchInterval] is how often the watched transactions are checked.
+	txWatchInterval = time.Second
+
+	// [txWatchMaxTxs] is the maximum number of watched transactions tracked.
+	// Transactions of the watched addresses beyond it are not tracked.
+	txWatchMaxTxs = 4096
+)
+
+// States of a watched transaction
+const (
+	watchedTxPending    = "pending"    // In the tx pool
+	watchedTxProcessing = "processing" // In a verified block
+	watchedTxStuck      = "stuck"      // Not included after the maximum age
+	watchedTxEvicted    = "evicted"    // Dropped from the tx pool without being included
+)
+
+// watchedTx is a transaction of a watched address tracked from its admission
+// in the tx pool to its acceptance.
+type watchedTx struct {
+	hash      common.Hash
+	from      common.Address
+	nonce     uint64
+	firstSeen time.Time
+	state     string
+	evicted   time.Time // Time the tx was found evicted
+}
+
+// alert returns whether [tx] is in an alert state.
+func (tx *watchedTx) alert() bool {
+	return tx.state == watchedTxStuck || tx.state == watchedTxEvicted
+}
+
+// txWatcher monitors the inclusion of the transactions of a set of watched
+// addresses, such as relayer accounts. It records histograms of the inclusion
+// latency of each address and raises an alert when a transaction exceeds the
+// maximum age without being accepted or is evicted from the tx pool.
+//
+// Evicted transactions are reported for [maxAge] after their eviction.
+type txWatcher struct {
+	lock sync.Mutex
+
+	txPool *core.TxPool
+	maxAge time.Duration
+	clock  mockable.Clock
+
+	txs map[common.Hash]*watchedTx
+	// [processing] is the number of verified blocks including each tx.
+	processing map[common.Hash]int
+
+	latency      map[common.Address]metrics.Histogram
+	alertsGauge  metrics.Gauge
+	stuckMeter   metrics.Meter
+	evictedMeter metrics.Meter
+}
+
+// newTxWatcher returns a watcher of the transactions of [vm] sent by the
+// addresses in the configuration of [vm].
+func (vm *VM) newTxWatcher() *txWatcher {
+	w := &txWatcher{
+		txPool:       vm.chain.GetTxPool(),
+		maxAge:       vm.config.TxWatchMaxAge.Duration,
+		txs:          make(map[common.Hash]*watchedTx),
+		processing:   make(map[common.Hash]int),
+		latency:      make(map[common.Address]metrics.Histogram),
+		alertsGauge:  metrics.NewRegisteredGauge("txwatch/alerts", nil),
+		stuckMeter:   metrics.NewRegisteredMeter("txwatch/stuck", nil),
+		evictedMeter: metrics.NewRegisteredMeter("txwatch/evicted", nil),
+	}
+	for _, addr := range vm.config.TxWatchAddresses {
+		w.latency[addr] = metrics.NewRegisteredHistogram("txwatch/"+addr.Hex()+"/latency", nil, metrics.NewExpDecaySample(1028, 0.015))
+	}
+	return w
+}
+
+// start checks the watched transactions every [txWatchInterval] and tracks
+// their inclusion in blocks until [shutdownChan] is closed.
+func (w *txWatcher) start(vm *VM) {
+	includedCh := make(chan core.IncludedTxsEvent, 16)
+	sub := vm.chain.BlockChain().SubscribeIncludedTransactionEvent(includedCh)
+
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(func() {
+		defer vm.shutdownWg.Done()
+		defer sub.Unsubscribe()
+
+		ticker := time.NewTicker(txWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// Handle the inclusions first, so that txs removed from the
+				// tx pool by a verified block are not found evicted
+				for drained := false; !drained; {
+					select {
+					case ev := <-includedCh:
+						w.included(ev)
+					default:
+						drained = true
+					}
+				}
+				w.check()
+			case ev := <-includedCh:
+				w.included(ev)
+			case <-vm.shutdownChan:
+				return
+			}
+		}
+	})
+}
+
+// check starts tracking the new transactions of the watched addresses in the
+// tx pool and updates the state of the tracked ones.
+func (w *txWatcher) check() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := w.clock.Time()
+	for addr := range w.latency {
+		pending, queued := w.txPool.ContentFrom(addr)
+		for _, txs := range []types.Transactions{pending, queued} {
+			for _, tx := range txs {
+				if _, ok := w.txs[tx.Hash()]; ok || len(w.txs) >= txWatchMaxTxs {
+					continue
+				}
+				w.txs[tx.Hash()] = &watchedTx{
+					hash:      tx.Hash(),
+					from:      addr,
+					nonce:     tx.Nonce(),
+					firstSeen: now,
+					state:     watchedTxPending,
+				}
+			}
+		}
+	}
+
+	alerts := 0
+	for hash, tx := range w.txs {
+		switch {
+		case tx.state == watchedTxEvicted:
+			if now.Sub(tx.evicted) > w.maxAge {
+				delete(w.txs, hash)
+				continue
+			}
+		case w.processing[hash] > 0:
+			tx.state = watchedTxProcessing
+		case !w.txPool.Has(hash):
+			tx.state, tx.evicted = watchedTxEvicted, now
+			w.evictedMeter.Mark(1)
+			log.Warn("Watched transaction evicted without inclusion", "tx", hash, "from", tx.from, "nonce", tx.nonce, "age", now.Sub(tx.firstSeen))
+		case now.Sub(tx.firstSeen) > w.maxAge:
+			if tx.state != watchedTxStuck {
+				w.stuckMeter.Mark(1)
+				log.Warn("Watched transaction not included", "tx", hash, "from", tx.from, "nonce", tx.nonce, "age", now.Sub(tx.firstSeen))
+			}
+			tx.state = watchedTxStuck
+		default:
+			tx.state = watchedTxPending
+		}
+		if tx.alert() {
+			alerts++
+		}
+	}
+	w.alertsGauge.Update(int64(alerts))
+}
+
+// included updates the tracked transactions included in the block of [ev].
+func (w *txWatcher) included(ev core.IncludedTxsEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := w.clock.Time()
+	for _, tx := range ev.Block.Transactions() {
+		hash := tx.Hash()
+		switch ev.Phase {
+		case core.TxVerified:
+			w.processing[hash]++
+		case core.TxRejected:
+			if w.processing[hash]--; w.processing[hash] <= 0 {
+				delete(w.processing, hash)
+			}
+		case core.TxAccepted:
+			delete(w.processing, hash)
+			watched, ok := w.txs[hash]
+			if !ok {
+				continue
+			}
+			if watched.alert() {
+				log.Info("Watched transaction accepted", "tx", hash, "from", watched.from, "nonce", watched.nonce, "age", now.Sub(watched.firstSeen))
+			}
+			w.latency[watched.from].Update(now.Sub(watched.firstSeen).Milliseconds())
+			delete(w.txs, hash)
+		}
+	}
+}
+
+// WatchedTransaction is the state of a watched transaction.
+type WatchedTransaction struct {
+	Hash      common.Hash    `json:"hash"`
+	From      common.Address `json:"from"`
+	Nonce     json.Uint64    `json:"nonce"`
+	FirstSeen time.Time      `json:"firstSeen"`
+	State     string         `json:"state"`
+	Alert     bool           `json:"alert"`
+}
+
+// watched returns the tracked transactions, ordered by sender and nonce.
+func (w *txWatcher) watched() []WatchedTransaction {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	txs := make([]WatchedTransaction, 0, len(w.txs))
+	for _, tx := range w.txs {
+		txs = append(txs, WatchedTransaction{
+			Hash:      tx.hash,
+			From:      tx.from,
+			Nonce:     json.Uint64(tx.nonce),
+			FirstSeen: tx.firstSeen,
+			State:     tx.state,
+			Alert:     tx.alert(),
+		})
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if c := bytes.Compare(txs[i].From[:], txs[j].From[:]); c != 0 {
+			return c < 0
+		}
+		return txs[i].Nonce < txs[j].Nonce
+	})
+	return txs
+}
@@ -0,0 +1,107 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestTxWatcher(t *testing.T) {
+	config := fmt.Sprintf(`{"tx-watch-addresses":[%q],"tx-watch-max-age":"10s"}`, testEthAddrs[0].Hex())
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, config, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	admin := &Admin{vm: vm}
+	watched := func() []WatchedTransaction {
+		reply := new(WatchedTransactionsReply)
+		if err := admin.WatchedTransactions(nil, nil, reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply.Transactions
+	}
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	sendTx := func(nonce uint64, gasPrice *big.Int) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.chain.GetTxPool().AddRemotesSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	tx := sendTx(0, gasPrice)
+	vm.txWatcher.check()
+	if txs := watched(); len(txs) != 1 || txs[0].Hash != tx.Hash() || txs[0].State != watchedTxPending || txs[0].Alert {
+		t.Fatalf("Expected the tx to be watched as pending, found %+v", txs)
+	}
+
+	// The tx is stuck once older than the maximum age
+	vm.txWatcher.clock.Set(time.Now().Add(11 * time.Second))
+	vm.txWatcher.check()
+	if txs := watched(); len(txs) != 1 || txs[0].State != watchedTxStuck || !txs[0].Alert {
+		t.Fatalf("Expected the tx to be stuck, found %+v", txs)
+	}
+	if alerts := vm.txWatcher.alertsGauge.Value(); alerts != 1 {
+		t.Fatalf("Expected 1 alert, found %d", alerts)
+	}
+
+	// Accepting the tx clears the alert and records its inclusion latency
+	buildAndAcceptBlock(t, issuer, vm)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(watched()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the accepted tx not to be watched, found %+v", watched())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	vm.txWatcher.check()
+	if alerts := vm.txWatcher.alertsGauge.Value(); alerts != 0 {
+		t.Fatalf("Expected no alert, found %d", alerts)
+	}
+	latency := vm.txWatcher.latency[testEthAddrs[0]]
+	if latency.Count() != 1 || latency.Max() < (10*time.Second).Milliseconds() {
+		t.Fatalf("Expected an inclusion latency above the maximum age, found %d samples up to %dms", latency.Count(), latency.Max())
+	}
+
+	// A tx replaced in the tx pool is evicted
+	replaced := sendTx(1, gasPrice)
+	vm.txWatcher.check()
+	replacement := sendTx(1, new(big.Int).Mul(gasPrice, common.Big2))
+	vm.txWatcher.check()
+	states := make(map[common.Hash]WatchedTransaction)
+	for _, tx := range watched() {
+		states[tx.Hash] = tx
+	}
+	if tx := states[replaced.Hash()]; tx.State != watchedTxEvicted || !tx.Alert {
+		t.Fatalf("Expected the replaced tx to be evicted, found %+v", tx)
+	}
+	if tx := states[replacement.Hash()]; tx.State != watchedTxPending || tx.Alert {
+		t.Fatalf("Expected the replacement tx to be pending, found %+v", tx)
+	}
+}
@@ -0,0 +1,143 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+// unixSocketEthAPIs are the Ethereum API services served in full over the
+// Unix domain socket. None of their methods modify the state of the node.
+var unixSocketEthAPIs = []string{
+	"internal-public-eth",
+	"internal-public-blockchain",
+	"internal-public-tx-pool",
+}
+
+// unixSocketEthAPIMethods are the read-only methods served over the Unix
+// domain socket of the Ethereum API services that also have write methods,
+// keyed by the name of the service that provides them.
+var unixSocketEthAPIMethods = map[string][]string{
+	"internal-public-transaction-pool": {
+		"getBlockTransactionCountByNumber",
+		"getBlockTransactionCountByHash",
+		"getTransactionByBlockNumberAndIndex",
+		"getTransactionByBlockHashAndIndex",
+		"getRawTransactionByBlockNumberAndIndex",
+		"getRawTransactionByBlockHashAndIndex",
+		"getTransactionCount",
+		"getTransactionByHash",
+		"getRawTransactionByHash",
+		"getTransactionReceipt",
+		"pendingTransactions",
+	},
+	"public-eth-filter": {
+		"getLogs",
+		"getLogsMulti",
+	},
+}
+
+// SocketAdminAPI is the admin service served over the Unix domain socket.
+type SocketAdminAPI struct {
+	vm *VM
+}
+
+// SocketHealthReply is the reply of admin_health
+type SocketHealthReply struct {
+	Healthy            bool           `json:"healthy"`
+	Error              string         `json:"error,omitempty"`
+	Details            interface{}    `json:"details,omitempty"`
+	LastAcceptedHash   common.Hash    `json:"lastAcceptedHash"`
+	LastAcceptedHeight hexutil.Uint64 `json:"lastAcceptedHeight"`
+}
+
+// Health returns the result of the health check of the VM, along with its
+// last accepted block.
+func (api *SocketAdminAPI) Health() *SocketHealthReply {
+	details, err := api.vm.HealthCheck()
+	lastAccepted := api.vm.chain.LastAcceptedBlock()
+	reply := &SocketHealthReply{
+		Healthy:            err == nil,
+		Details:            details,
+		LastAcceptedHash:   lastAccepted.Hash(),
+		LastAcceptedHeight: hexutil.Uint64(lastAccepted.NumberU64()),
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return reply
+}
+
+// unixSocketPath returns the path of the Unix domain socket of the chain in
+// [dir].
+func (vm *VM) unixSocketPath(dir string) (string, error) {
+	primaryAlias, err := vm.ctx.BCLookup.PrimaryAlias(vm.ctx.ChainID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get primary alias for chain due to %w", err)
+	}
+	return filepath.Join(dir, fmt.Sprintf("coreth_%s.sock", primaryAlias)), nil
+}
+
+// startUnixSocket serves the read-only APIs over a Unix domain socket in the
+// configured directory, if any, until the VM is shut down.
+func (vm *VM) startUnixSocket() error {
+	if vm.config.UnixSocketDir == "" {
+		return nil
+	}
+	perm, err := vm.config.UnixSocketFileMode()
+	if err != nil {
+		return err
+	}
+	path, err := vm.unixSocketPath(vm.config.UnixSocketDir)
+	if err != nil {
+		return err
+	}
+
+	handler := vm.chain.NewRPCHandler(vm.config.APIMaxDuration.Duration)
+	if err := vm.chain.AttachEthServiceMethods(handler, unixSocketEthAPIs, unixSocketEthAPIMethods); err != nil {
+		return err
+	}
+	if err := handler.RegisterName("admin", &SocketAdminAPI{vm}); err != nil {
+		return err
+	}
+	handler.SetGate(vm.rpcGate)
+	handler.SetStrictQuantities(vm.config.RPCStrictQuantities)
+	listener, err := rpc.ListenIPC(path, perm)
+	if err != nil {
+		handler.Stop()
+		return fmt.Errorf("failed to listen on unix socket %s: %w", path, err)
+	}
+	log.Info("Serving read-only APIs over unix socket", "path", path)
+
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		err := handler.ServeListenerWithDuration(
+			listener,
+			vm.config.APIMaxDuration.Duration,
+			vm.config.WSCPURefillRate.Duration,
+			vm.config.WSCPUMaxStored.Duration,
+		)
+		if !errors.Is(err, net.ErrClosed) {
+			log.Error("unix socket server failed", "path", path, "err", err)
+		}
+	}()
+	vm.shutdownWg.Add(1)
+	go func() {
+		defer vm.shutdownWg.Done()
+		<-vm.shutdownChan
+		// Closing the listener removes the socket
+		listener.Close()
+		handler.Stop()
+	}()
+	return nil
+}
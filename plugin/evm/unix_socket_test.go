@@ -0,0 +1,95 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	configJSON := fmt.Sprintf(`{"unix-socket-dir": %q, "unix-socket-permissions": "0660"}`, dir)
+
+	// Leave a stale socket behind, as a crashed process would
+	stalePath := dir + "/coreth_C.sock"
+	stale, err := net.Listen("unix", stalePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	_, vm, _, _, _ := GenesisVM(t, true, genesisJSONApricotPhase5, configJSON, "")
+	path, err := vm.unixSocketPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != stalePath {
+		t.Fatalf("expected socket at %s, found %s", stalePath, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o660 {
+		t.Fatalf("expected socket with permissions 0660, found mode %s", info.Mode())
+	}
+
+	client, err := rpc.DialIPC(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blockNumber hexutil.Uint64
+	if err := client.Call(&blockNumber, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+	var status map[string]hexutil.Uint
+	if err := client.Call(&status, "txpool_status"); err != nil {
+		t.Fatal(err)
+	}
+	var count hexutil.Uint64
+	if err := client.Call(&count, "eth_getTransactionCount", testEthAddrs[0], "latest"); err != nil {
+		t.Fatal(err)
+	}
+	var health SocketHealthReply
+	if err := client.Call(&health, "admin_health"); err != nil {
+		t.Fatal(err)
+	}
+	if !health.Healthy || health.LastAcceptedHash != vm.chain.LastAcceptedBlock().Hash() {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	// Write methods must not be exposed
+	for _, method := range []string{
+		"eth_sendRawTransaction",
+		"eth_sendTransaction",
+		"eth_signTransaction",
+		"eth_sign",
+		"eth_newFilter",
+		"personal_unlockAccount",
+		"debug_setHead",
+		"admin_startCPUProfiler",
+	} {
+		err := client.Call(nil, method)
+		if err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Fatalf("expected %s to not exist, found %v", method, err)
+		}
+	}
+	client.Close()
+
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed on shutdown, found %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	"github.com/zsmartex/coreth/core/rawdb"
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/eth"
+	"github.com/zsmartex/coreth/params"
+	"github.com/zsmartex/coreth/rpc"
+)
+
+func TestVerifyBlock(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	vm.clock.Set(time.Now().Add(-time.Minute))
+	buildAndAcceptBlock(t, issuer, vm)
+
+	// Accept enough blocks with a transfer for the state of the first ones to
+	// be pruned, spaced for their gas cost to be covered
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	var blocks []*types.Block
+	for nonce := uint64(0); nonce < 20; nonce++ {
+		tx, err := types.SignTx(types.NewTransaction(nonce, testEthAddrs[1], big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.chain.AddRemoteTxsSync([]*types.Transaction{tx})[0]; err != nil {
+			t.Fatal(err)
+		}
+		vm.clock.Set(vm.clock.Time().Add(2 * time.Second))
+		blk := buildAndAcceptBlock(t, issuer, vm)
+		blocks = append(blocks, vm.chain.GetBlockByHash(common.Hash(blk.ID())))
+	}
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"private-debug"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	verify := func(block *types.Block) (*eth.VerifyBlockResult, error) {
+		result := new(eth.VerifyBlockResult)
+		err := client.Call(result, "debug_verifyBlock", rpc.BlockNumberOrHashWithHash(block.Hash(), false))
+		return result, err
+	}
+
+	// The last accepted block replays to its stored data
+	last := blocks[len(blocks)-1]
+	result, err := verify(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != eth.VerifyBlockOK || result.Mismatch != nil || result.Hash != last.Hash() || uint64(result.Number) != last.NumberU64() {
+		t.Fatalf("Expected block %s at height %d to verify, found %+v", last.Hash(), last.NumberU64(), result)
+	}
+
+	// A tampered receipt is reported along with its tx
+	receipts := rawdb.ReadReceipts(vm.chaindb, last.Hash(), last.NumberU64(), vm.chainConfig)
+	receipts[0].CumulativeGasUsed++
+	rawdb.WriteReceipts(vm.chaindb, last.Hash(), last.NumberU64(), receipts)
+	result, err = verify(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatch := result.Mismatch
+	if result.Status != eth.VerifyBlockMismatch || mismatch == nil || mismatch.Field != "cumulativeGasUsed" {
+		t.Fatalf("Expected a mismatch of the cumulative gas used, found %+v", result)
+	}
+	if mismatch.TxIndex == nil || *mismatch.TxIndex != 0 || mismatch.TxHash == nil || *mismatch.TxHash != last.Transactions()[0].Hash() {
+		t.Fatalf("Expected the mismatch of tx %s at index 0, found %+v", last.Transactions()[0].Hash(), mismatch)
+	}
+	if mismatch.Replayed != "0x5208" || mismatch.Stored != "0x5209" {
+		t.Fatalf("Expected the replayed gas 0x5208 and stored gas 0x5209, found %v and %v", mismatch.Replayed, mismatch.Stored)
+	}
+
+	// A block whose parent state was pruned is refused
+	if _, err := verify(blocks[1]); err == nil || !strings.Contains(err.Error(), "required historical state unavailable") {
+		t.Fatalf("Expected the verification of block %d to require its pruned parent state, found %v", blocks[1].NumberU64(), err)
+	}
+}
@@ -0,0 +1,90 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// verifyCacheSize is the number of verified blocks kept by [verifyCache].
+// Blocks which are evicted are verified again.
+const verifyCacheSize = 1024
+
+// verifyCache records the processing blocks which passed verification, so
+// that the consensus engine calling Verify on a block again, e.g. across
+// preference changes, does not execute the block again. Executing a block that
+// passed verification again would also add a second reference to its state,
+// which is only released once when the block is rejected.
+//
+// Failed verifications are not recorded, as they may pass later: the UTXOs
+// imported by the block may not be exported yet, the node may not be
+// bootstrapped yet, or reading the state may fail transiently.
+//
+// Blocks are dropped when they are accepted or rejected, and blocks at or
+// below the last accepted height are dropped on accept.
+type verifyCache struct {
+	lock     sync.Mutex
+	verified *lru.Cache // Heights of the verified blocks, by hash
+
+	// [execute] runs the full verification of a block, writing its state.
+	execute func(b *Block) error
+}
+
+func newVerifyCache() *verifyCache {
+	verified, _ := lru.New(verifyCacheSize)
+	return &verifyCache{
+		verified: verified,
+		execute:  func(b *Block) error { return b.verify(true /*=writes*/) },
+	}
+}
+
+// verify verifies [b], unless it already passed verification.
+func (c *verifyCache) verify(b *Block) error {
+	hash := b.ethBlock.Hash()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.verified.Contains(hash) {
+		return nil
+	}
+	if err := c.execute(b); err != nil {
+		return err
+	}
+	c.verified.Add(hash, b.Height())
+	return nil
+}
+
+// remove drops the verified block [hash].
+func (c *verifyCache) remove(hash common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.verified.Remove(hash)
+}
+
+// accept drops the block [hash], accepted at [height], and the verified
+// blocks at or below [height].
+func (c *verifyCache) accept(hash common.Hash, height uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.verified.Remove(hash)
+	for _, key := range c.verified.Keys() {
+		if verifiedHeight, ok := c.verified.Peek(key); ok && verifiedHeight.(uint64) <= height {
+			c.verified.Remove(key)
+		}
+	}
+}
+
+// len returns the number of verified blocks recorded.
+func (c *verifyCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.verified.Len()
+}
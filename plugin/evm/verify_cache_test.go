@@ -0,0 +1,121 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zsmartex/avalanchego/ids"
+)
+
+func TestVerifyCache(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+		testShortIDAddrs[1]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Count the executions of the blocks verified
+	executions := make(map[ids.ID]int)
+	execute := vm.verifyCache.execute
+	vm.verifyCache.execute = func(b *Block) error {
+		executions[b.ID()]++
+		return execute(b)
+	}
+	snaps := vm.chain.BlockChain().Snapshots()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	<-issuer
+	blkA, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed verification is not recorded, as it may pass later
+	errTransient := errors.New("transient failure")
+	vm.verifyCache.execute = func(b *Block) error {
+		executions[b.ID()]++
+		return errTransient
+	}
+	if err := blkA.Verify(); !errors.Is(err, errTransient) {
+		t.Fatalf("Expected the verification to fail with %q, found %v", errTransient, err)
+	}
+	if size := vm.verifyCache.len(); size != 0 {
+		t.Fatalf("Expected no verified block after a failure, found %d", size)
+	}
+	vm.verifyCache.execute = func(b *Block) error {
+		executions[b.ID()]++
+		return execute(b)
+	}
+	for i := 0; i < 2; i++ {
+		if err := blkA.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if executions[blkA.ID()] != 2 {
+		t.Fatalf("Expected a single execution of the block verified twice after the failure, found %d", executions[blkA.ID()]-1)
+	}
+	if layers := snaps.NumBlockLayers(); layers != 2 {
+		t.Fatalf("Expected the snapshot layer of the verified block on the disk layer, found %d layers", layers)
+	}
+
+	// Rejecting the block drops its outcome and releases its state
+	if err := blkA.Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if size := vm.verifyCache.len(); size != 0 {
+		t.Fatalf("Expected no verified block after the block was rejected, found %d", size)
+	}
+	if layers := snaps.NumBlockLayers(); layers != 1 {
+		t.Fatalf("Expected only the disk layer after the block was rejected, found %d layers", layers)
+	}
+
+	// Verifying a block that is accepted
+	lastAccepted, err := vm.LastAccepted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.SetPreference(lastAccepted); err != nil {
+		t.Fatal(err)
+	}
+	importTx, err = vm.newImportTx(vm.ctx.XChainID, testEthAddrs[1], initialBaseFee, testKeys[1:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	blkB, err := vm.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := blkB.Verify(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if executions[blkB.ID()] != 1 {
+		t.Fatalf("Expected a single execution of the block verified twice, found %d", executions[blkB.ID()])
+	}
+	if err := vm.SetPreference(blkB.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := blkB.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	if size := vm.verifyCache.len(); size != 0 {
+		t.Fatalf("Expected no verified block after the block was accepted, found %d", size)
+	}
+}
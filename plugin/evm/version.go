@@ -5,6 +5,7 @@ package evm
 
 import (
 	"fmt"
+	"runtime"
 )
 
 var (
@@ -12,10 +13,34 @@ var (
 	GitCommit string
 	// Version is the version of Coreth
 	Version string = "v0.8.6"
+	// ForkName is the name of the fork of Coreth, set by the build script
+	ForkName string = "zsmartex"
+
+	// ClientVersion is the client version served by web3_clientVersion, with
+	// the fork name, the semantic version and the commit of the build
+	ClientVersion string
 )
 
 func init() {
+	ClientVersion = clientVersion(ForkName, Version, GitCommit)
 	if len(GitCommit) != 0 {
 		Version = fmt.Sprintf("%s@%s", Version, GitCommit)
 	}
 }
+
+// clientVersion returns the client version of the build of the fork
+// [forkName] at [version] and [commit], in the format of geth, e.g.
+// "coreth-zsmartex/v0.8.6-1a2b3c4d/linux-amd64/go1.17".
+func clientVersion(forkName, version, commit string) string {
+	name := "coreth"
+	if len(forkName) != 0 {
+		name = fmt.Sprintf("%s-%s", name, forkName)
+	}
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	if len(commit) != 0 {
+		version = fmt.Sprintf("%s-%s", version, commit)
+	}
+	return fmt.Sprintf("%s/%s/%s-%s/%s", name, version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
@@ -42,6 +42,7 @@ import (
 	_ "github.com/zsmartex/coreth/eth/tracers/native"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -118,6 +119,10 @@ const (
 	adminEndpoint  = "/admin"
 	ethRPCEndpoint = "/rpc"
 	ethWSEndpoint  = "/ws"
+
+	// staticGenesisEndpoint is the endpoint of version 1 of the static API of
+	// the genesis
+	staticGenesisEndpoint = "/v1/genesis"
 )
 
 var (
@@ -167,6 +172,7 @@ var (
 	errNilBlockGasCostApricotPhase4   = errors.New("nil blockGasCost is invalid after apricotPhase4")
 	errConflictingAtomicTx            = errors.New("conflicting atomic tx present")
 	errTooManyAtomicTx                = errors.New("too many atomic tx")
+	errTooManyAtomicOps               = errors.New("too many atomic operations")
 	errMissingAtomicTxs               = errors.New("cannot build a block with non-empty extra data and zero atomic transactions")
 )
 
@@ -202,6 +208,9 @@ type VM struct {
 	// block.
 	acceptedBlockDB database.Database
 
+	// [migrator] applies the pending migrations of the schema of [chaindb].
+	migrator *migrator
+
 	// [atomicTxRepository] maintains two indexes on accepted atomic txs.
 	// - txID to accepted atomic tx
 	// - block height to list of atomic txs accepted on block at that height
@@ -212,15 +221,89 @@ type VM struct {
 
 	builder *blockBuilder
 
+	// [shutdownDrain] coordinates the drain of the node ahead of a restart.
+	shutdownDrain *shutdownDrain
+
+	// [verifyCache] records the outcome of the verification of the
+	// processing blocks.
+	verifyCache *verifyCache
+
+	// [readiness] gates the RPC calls while the node is syncing, nil if
+	// gating is disabled.
+	readiness *rpcReadiness
+
+	// [rpcHandlers] are the eth RPC and websocket handlers, nil until they
+	// are created. Protected by [rpcHandlersLock].
+	rpcHandlersLock sync.Mutex
+	rpcHandlers     *rpcHandlers
+
+	// [txWatcher] monitors the inclusion of the txs of the watched
+	// addresses, nil if no address is watched.
+	txWatcher *txWatcher
+
+	// [nonceReserver] hands out the nonces reserved with eth_reserveNonce,
+	// nil if the reservations are disabled.
+	nonceReserver *nonceReserver
+
+	// [exportPolicy] guards the exports issued through the avax API, nil if
+	// the policy is disabled.
+	exportPolicy *exportPolicy
+
+	// [approvalIndex] indexes the Approval events of the accepted blocks,
+	// nil if the index is disabled.
+	approvalIndex *approvalIndex
+
+	// [supplyIndex] records the AVAX moved by the atomic txs of the accepted
+	// blocks, nil if the index is disabled.
+	supplyIndex *supplyIndex
+
+	// [stateGrowthIndex] records the storage slots and code added by the
+	// accounts of the accepted blocks, by epoch, if enabled.
+	stateGrowthIndex *stateGrowthIndex
+
+	// [health] serves the liveness and readiness of the VM over HTTP.
+	health *httpHealth
+
+	// [processingBlocks] tracks the verified blocks until they are decided.
+	processingBlocks *processingBlocks
+
+	// [stallDetector] detects the stalls of block acceptance, nil if the
+	// detection is disabled.
+	stallDetector *stallDetector
+
+	// [hotAccounts] counts the accounts of the accepted txs to warm their
+	// state at the next startup, nil if the warmup is disabled.
+	hotAccounts *hotAccounts
+
+	// [counterSnapshotter] persists the long-window counters across
+	// restarts, nil if the persistence is disabled.
+	counterSnapshotter *counterSnapshotter
+	blockCounters      *blockCounters
+
+	// [atomicOpsHistogram] records the number of shared memory operations
+	// applied by the accepted blocks including atomic txs.
+	atomicOpsHistogram metrics.Histogram
+
 	gossiper Gossiper
 
 	baseCodec codec.Registry
 	codec     codec.Manager
 	clock     mockable.Clock
 	mempool   *Mempool
+	// [atomicGossipDedup] drops the repeated gossip of the atomic txs
+	// recently discarded or accepted
+	atomicGossipDedup *atomicGossipDedup
 
 	shutdownChan chan struct{}
 	shutdownWg   sync.WaitGroup
+	// [shutdownHook] is called before each stage flushed at shutdown in tests,
+	// failing the stage if it returns an error.
+	shutdownHook func(stage string) error
+
+	// [receiptRepairRunning] is set while a receipt repair job runs in the
+	// background, see repairReceipts.
+	receiptRepairLock    sync.Mutex
+	receiptRepairRunning bool
 
 	fx          secp256k1fx.Fx
 	secpFactory crypto.FactorySECP256K1R
@@ -288,6 +371,9 @@ func (vm *VM) Initialize(
 			return fmt.Errorf("failed to unmarshal config %s: %w", string(configBytes), err)
 		}
 	}
+	if err := vm.config.Validate(); err != nil {
+		return err
+	}
 	if b, err := json.Marshal(vm.config); err == nil {
 		log.Info("Initializing Coreth VM", "Version", Version, "Config", string(b))
 	} else {
@@ -301,6 +387,12 @@ func (vm *VM) Initialize(
 
 	metrics.Enabled = vm.config.MetricsEnabled
 	metrics.EnabledExpensive = vm.config.MetricsExpensiveEnabled
+	vm.atomicOpsHistogram = metrics.NewRegisteredHistogram("atomic/ops", nil, metrics.NewExpDecaySample(1028, 0.015))
+	if vm.config.MetricsPersistenceEnabled {
+		vm.counterSnapshotter = newCounterSnapshotter()
+	}
+	vm.blockCounters = newBlockCounters(vm.counterSnapshotter)
+	vm.processingBlocks = newProcessingBlocks()
 
 	vm.shutdownChan = make(chan struct{}, 1)
 	vm.ctx = ctx
@@ -310,21 +402,19 @@ func (vm *VM) Initialize(
 	vm.chaindb = Database{prefixdb.NewNested(ethDBPrefix, baseDB)}
 	vm.db = versiondb.New(baseDB)
 	vm.acceptedBlockDB = prefixdb.New(acceptedPrefix, vm.db)
-	g := new(core.Genesis)
-	if err := json.Unmarshal(genesisBytes, g); err != nil {
+	// The counters are written outside of [vm.db], as they are not committed
+	// with the accepted blocks
+	vm.counterSnapshotter.open(prefixdb.New(metricsPrefix, baseDB))
+	// The chain config is set for the mainnet/fuji/local chain IDs
+	g, err := parseGenesis(genesisBytes)
+	if err != nil {
 		return err
 	}
-
-	// Set the chain config for mainnet/fuji chain IDs
 	switch {
 	case g.Config.ChainID.Cmp(params.AvalancheMainnetChainID) == 0:
-		g.Config = params.AvalancheMainnetChainConfig
 		phase0BlockValidator.extDataHashes = mainnetExtDataHashes
 	case g.Config.ChainID.Cmp(params.AvalancheFujiChainID) == 0:
-		g.Config = params.AvalancheFujiChainConfig
 		phase0BlockValidator.extDataHashes = fujiExtDataHashes
-	case g.Config.ChainID.Cmp(params.AvalancheLocalChainID) == 0:
-		g.Config = params.AvalancheLocalChainConfig
 	}
 
 	// Free the memory of the extDataHash map that is not used (i.e. if mainnet
@@ -351,13 +441,48 @@ func (vm *VM) Initialize(
 	ethConfig.RPCGasCap = vm.config.RPCGasCap
 	ethConfig.RPCEVMTimeout = vm.config.APIMaxDuration.Duration
 	ethConfig.RPCTxFeeCap = vm.config.RPCTxFeeCap
+	ethConfig.RPCFeeCapMultiple = vm.config.RPCFeeCapMultiple
+	ethConfig.RPCFeeGuardrailCap = vm.config.RPCFeeGuardrailCap
+	ethConfig.SubmissionAuditEnabled = vm.config.SubmissionAuditEnabled
+	ethConfig.SubmissionAuditFile = vm.config.SubmissionAuditFile
+	ethConfig.SubmissionAuditMaxFileSize = vm.config.SubmissionAuditMaxFileSize
+	ethConfig.SubmissionAuditMaxFiles = vm.config.SubmissionAuditMaxFiles
+	ethConfig.SubmissionAuditSampleRate = vm.config.SubmissionAuditSampleRate
+	ethConfig.RPCFullBlockTxLimit = vm.config.RPCFullBlockTxLimit
+	ethConfig.RPCFullBlockSizeLimit = vm.config.RPCFullBlockSizeLimit
+	ethConfig.TraceBlockWorkers = vm.config.TraceBlockWorkers
+	ethConfig.CallAtMaxStaleness = vm.config.CallAtMaxStaleness
+	ethConfig.TraceConcurrency = vm.config.TraceConcurrency
+	ethConfig.TraceThrottledConcurrency = vm.config.TraceThrottledConcurrency
+	ethConfig.TraceQueueLimit = vm.config.TraceQueueLimit
 	ethConfig.TxPool.NoLocals = !vm.config.LocalTxsEnabled
+	ethConfig.TxPool.TipFloorBase = vm.config.TxPoolTipFloorBase
+	ethConfig.TxPool.TipFloorPerByte = vm.config.TxPoolTipFloorPerByte
+	ethConfig.TxPool.InvariantCheckRate = vm.config.TxPoolInvariantCheckRate
+	ethConfig.TxPool.Privileged = vm.config.PrivilegedSenders
+	ethConfig.TxPool.PrivilegedSlots = vm.config.PrivilegedTxPoolSlots
+	ethConfig.Miner.PrivilegedGas = vm.config.PrivilegedBlockGas
+	ethConfig.Miner.AccessHintsSenders = vm.config.BuilderAccessHints
+	// Validated with the config
+	ethConfig.Miner.TxTieBreak, _ = vm.config.BuilderTxTieBreakPolicy()
 	ethConfig.AllowUnfinalizedQueries = vm.config.AllowUnfinalizedQueries
 	ethConfig.AllowUnprotectedTxs = vm.config.AllowUnprotectedTxs
 	ethConfig.Preimages = vm.config.Preimages
 	ethConfig.Pruning = vm.config.Pruning
 	ethConfig.SnapshotAsync = vm.config.SnapshotAsync
 	ethConfig.SnapshotVerify = vm.config.SnapshotVerify
+	ethConfig.HeaderCache = vm.config.HeaderCacheSize
+	ethConfig.BodyCache = vm.config.BodyCacheSize
+	ethConfig.ReceiptsCache = vm.config.ReceiptsCacheSize
+	ethConfig.BlockCache = vm.config.BlockCacheSize
+	ethConfig.AccountCache = vm.config.AccountCacheSize
+	ethConfig.StorageCommitWorkers = vm.config.StorageCommitWorkers
+	ethConfig.HotKeysWarmup = vm.config.HotKeysWarmup
+	ethConfig.HotKeysWarmupTimeout = vm.config.HotKeysWarmupTimeout.Duration
+	ethConfig.StorageGrowthTracking = vm.config.StateGrowthIndexEnabled
+	ethConfig.AcceptedIndicesQueueLimit = vm.config.AcceptedIndicesQueueLimit
+	ethConfig.ForensicDumpDir = vm.config.ForensicDumpDir
+	ethConfig.ForensicDumpMaxFiles = vm.config.ForensicDumpMaxFiles
 	ethConfig.OfflinePruning = vm.config.OfflinePruning
 	ethConfig.OfflinePruningBloomFilterSize = vm.config.OfflinePruningBloomFilterSize
 	ethConfig.OfflinePruningDataDirectory = vm.config.OfflinePruningDataDirectory
@@ -374,7 +499,7 @@ func (vm *VM) Initialize(
 	vm.secpFactory = crypto.FactorySECP256K1R{Cache: cache.LRU{Size: secpFactoryCacheSize}}
 
 	nodecfg := node.Config{
-		CorethVersion:         Version,
+		CorethVersion:         ClientVersion,
 		KeyStoreDir:           vm.config.KeystoreDirectory,
 		ExternalSigner:        vm.config.KeystoreExternalSigner,
 		InsecureUnlockAllowed: vm.config.KeystoreInsecureUnlockAllowed,
@@ -384,6 +509,7 @@ func (vm *VM) Initialize(
 
 	// TODO: read size from settings
 	vm.mempool = NewMempool(ctx.AVAXAssetID, defaultMempoolSize)
+	vm.atomicGossipDedup = newAtomicGossipDedup(&vm.clock, vm.config.AtomicGossipDiscardedRetention.Duration, vm.config.AtomicGossipAcceptedRetention.Duration)
 
 	// Attempt to load last accepted block to determine if it is necessary to
 	// initialize state with the genesis block.
@@ -400,11 +526,30 @@ func (vm *VM) Initialize(
 	default:
 		lastAcceptedHash = common.BytesToHash(lastAcceptedBytes)
 	}
+	// A database written by a newer version is refused before it is read
+	vm.migrator, err = newMigrator(vm.chaindb, migrations, lastAcceptedErr == database.ErrNotFound)
+	if err != nil {
+		return fmt.Errorf("failed to open the chain database: %w", err)
+	}
+	if err := vm.startMigrations(vm.config.MigrationPolicy); err != nil {
+		return fmt.Errorf("failed to migrate the chain database: %w", err)
+	}
 	ethChain, err := coreth.NewETHChain(&ethConfig, &nodecfg, vm.chaindb, vm.config.EthBackendSettings(), vm.createConsensusCallbacks(), lastAcceptedHash, &vm.clock)
 	if err != nil {
 		return err
 	}
 	vm.chain = ethChain
+	if err := vm.repairShutdownBarrier(lastAcceptedErr == database.ErrNotFound); err != nil {
+		return err
+	}
+	vm.verifyCache = newVerifyCache()
+	vm.chain.APIBackend().SetTxAdmission(func(*types.Transaction) error { return vm.checkTxPressure() })
+	if vm.config.TxNetworkStatsEnabled {
+		vm.chain.GetTxPool().SetNetworkStats(core.NewTxNetworkTracker(txNetworkStatsCapacity))
+	}
+	if vm.config.TxPropagationReceiptsEnabled {
+		vm.chain.GetTxPool().SetPropagation(core.NewTxPropagationTracker(txPropagationCapacity, vm.config.TxPropagationReceiptsTTL.Duration))
+	}
 	lastAccepted := vm.chain.LastAcceptedBlock()
 
 	vm.atomicTxRepository, err = NewAtomicTxRepository(vm.db, vm.codec, lastAccepted.NumberU64())
@@ -439,22 +584,97 @@ func (vm *VM) Initialize(
 
 	// initialize peer network
 	vm.Network = peer.NewNetwork(appSender, vm.networkCodec, ctx.NodeID, vm.config.MaxOutboundActiveRequests)
+	vm.Network.SetQuarantineConfig(peer.QuarantineConfig{
+		VersionLimit: vm.config.GossipQuarantineVersionLimit,
+		GarbageLimit: vm.config.GossipQuarantineGarbageLimit,
+		Window:       vm.config.GossipQuarantineWindow.Duration,
+		Duration:     vm.config.GossipQuarantineDuration.Duration,
+	})
 	vm.client = peer.NewClient(vm.Network)
+	if vm.config.RPCReadinessGatingEnabled {
+		vm.readiness = newRPCReadiness(vm.config.RPCReadinessMaxHeightLag, lastAccepted.NumberU64())
+	}
+	vm.Network.SetRequestHandler(newHeaderRequestHandler(vm.chain.BlockChain(), vm.networkCodec))
 	vm.initGossipHandling()
 
+	if len(vm.config.TxWatchAddresses) > 0 {
+		vm.txWatcher = vm.newTxWatcher()
+		vm.txWatcher.start(vm)
+	}
+	if vm.config.NonceReservationsEnabled {
+		// The reservations are written outside of [vm.db], as they are not
+		// committed with the accepted blocks
+		vm.nonceReserver, err = vm.newNonceReserver(prefixdb.New(nonceReservationsPrefix, baseDB))
+		if err != nil {
+			return fmt.Errorf("failed to restore nonce reservations: %w", err)
+		}
+		vm.nonceReserver.start(vm)
+	}
+	if vm.config.ExportPolicyEnabled {
+		// The allowlist is written outside of [vm.db], as it is not committed
+		// with the accepted blocks
+		vm.exportPolicy, err = vm.newExportPolicy(prefixdb.New(exportDestinationsPrefix, baseDB))
+		if err != nil {
+			return fmt.Errorf("failed to restore export destinations: %w", err)
+		}
+	}
+	if vm.config.ApprovalIndexEnabled {
+		vm.approvalIndex, err = newApprovalIndex(prefixdb.New(approvalIndexPrefix, vm.db), prefixdb.New(approvalIndexMetaPrefix, vm.db), lastAccepted.NumberU64())
+		if err != nil {
+			return fmt.Errorf("failed to open the approval index: %w", err)
+		}
+	}
+	if vm.config.SupplyDeltaIndexEnabled {
+		vm.supplyIndex, err = newSupplyIndex(
+			prefixdb.New(supplyDeltaPrefix, vm.db),
+			prefixdb.New(supplyDeltaMetaPrefix, vm.db),
+			// Nested, so that the keys match the ones written through [vm.db]
+			prefixdb.NewNested(supplyDeltaPrefix, baseDB),
+			prefixdb.NewNested(supplyDeltaMetaPrefix, baseDB),
+			vm.ctx.AVAXAssetID,
+			bonusBlockHeights,
+			lastAccepted.NumberU64(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to open the supply delta index: %w", err)
+		}
+	}
+	if vm.config.StateGrowthIndexEnabled {
+		vm.stateGrowthIndex, err = newStateGrowthIndex(
+			prefixdb.New(stateGrowthPrefix, vm.db),
+			prefixdb.New(stateGrowthMetaPrefix, vm.db),
+			vm.config.StateGrowthEpochBlocks,
+			vm.config.StateGrowthEpochsRetained,
+			lastAccepted.NumberU64(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to open the state growth index: %w", err)
+		}
+	}
+
 	// start goroutines to manage block building
 	//
 	// NOTE: gossip network must be initialized first otherwie ETH tx gossip will
 	// not work.
+	//
+	// The health is measured on the wall clock rather than [vm.clock], which
+	// tests may set while the block builder reads the health.
+	vm.health = newHTTPHealth(
+		vm.config.HealthMaxStall.Duration,
+		vm.config.HealthMaxHeadAge.Duration,
+		time.Now,
+		func() bool { return vm.shutdownDrain.isDraining() },
+		lastAccepted.Time(),
+	)
 	vm.builder = vm.NewBlockBuilder(toEngine)
+	vm.shutdownDrain = newShutdownDrain(vm.builder.setPaused)
 
 	vm.chain.Start()
 
 	vm.genesisHash = vm.chain.GetGenesisBlock().Hash()
 	log.Info(fmt.Sprintf("lastAccepted = %s", lastAccepted.Hash().Hex()))
 
-	isApricotPhase5 := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(lastAccepted.Time()))
-	atomicTxs, err := ExtractAtomicTxs(lastAccepted.ExtData(), isApricotPhase5, vm.codec)
+	atomicTxs, err := vm.extractAtomicTxs(lastAccepted)
 	if err != nil {
 		return err
 	}
@@ -472,6 +692,10 @@ func (vm *VM) Initialize(
 		return err
 	}
 
+	if vm.config.StallThreshold.Duration > 0 {
+		vm.stallDetector = vm.newStallDetector()
+		vm.stallDetector.start(vm)
+	}
 	vm.builder.awaitSubmittedTxs()
 	go vm.ctx.Log.RecoverAndPanic(vm.startContinuousProfiler)
 
@@ -501,7 +725,19 @@ func (vm *VM) Initialize(
 		return err
 	}
 
-	return vm.fx.Initialize(vm)
+	if err := vm.startUnixSocket(); err != nil {
+		return err
+	}
+
+	if err := vm.fx.Initialize(vm); err != nil {
+		return err
+	}
+	vm.counterSnapshotter.start(vm, vm.config.MetricsPersistenceFrequency.Duration)
+	if vm.config.WarmupEnabled {
+		vm.hotAccounts = newHotAccounts(vm.config.WarmupHotAccounts)
+		vm.startWarmup()
+	}
+	return nil
 }
 
 func (vm *VM) initChainState(lastAcceptedBlock *Block, metricsEnabled bool) error {
@@ -560,6 +796,13 @@ func (vm *VM) preBatchOnFinalizeAndAssemble(header *types.Header, state *state.S
 		// once.
 		snapshot := state.Snapshot()
 		rules := vm.chainConfig.AvalancheRules(header.Number, new(big.Int).SetUint64(header.Time))
+		if opsLimit := vm.chainConfig.AtomicOpsLimit(new(big.Int).SetUint64(header.Time)); opsLimit > 0 {
+			if ops, err := atomicOpsCount(tx); err != nil || ops > opsLimit {
+				// Discard the transaction from the mempool since it cannot fit in a block.
+				vm.mempool.DiscardCurrentTx(tx.ID())
+				continue
+			}
+		}
 		if err := vm.verifyTx(tx, header.ParentHash, header.BaseFee, state, rules); err != nil {
 			// Discard the transaction from the mempool on failed verification.
 			vm.mempool.DiscardCurrentTx(tx.ID())
@@ -567,7 +810,7 @@ func (vm *VM) preBatchOnFinalizeAndAssemble(header *types.Header, state *state.S
 			continue
 		}
 
-		atomicTxBytes, err := vm.codec.Marshal(codecVersion, tx)
+		atomicTxBytes, err := vm.encodeAtomicTxs(header.Time, []*Tx{tx})
 		if err != nil {
 			// Discard the transaction from the mempool and error if the transaction
 			// cannot be marshalled. This should never happen.
@@ -599,7 +842,9 @@ func (vm *VM) postBatchOnFinalizeAndAssemble(header *types.Header, state *state.
 		batchAtomicUTXOs  ids.Set
 		batchContribution *big.Int = new(big.Int).Set(common.Big0)
 		batchGasUsed      *big.Int = new(big.Int).Set(common.Big0)
-		rules                      = vm.chainConfig.AvalancheRules(header.Number, new(big.Int).SetUint64(header.Time))
+		batchAtomicOps    uint64
+		rules             = vm.chainConfig.AvalancheRules(header.Number, new(big.Int).SetUint64(header.Time))
+		atomicOpsLimit    = vm.chainConfig.AtomicOpsLimit(new(big.Int).SetUint64(header.Time))
 	)
 
 	for {
@@ -626,6 +871,18 @@ func (vm *VM) postBatchOnFinalizeAndAssemble(header *types.Header, state *state.
 			vm.mempool.CancelCurrentTx(tx.ID())
 			break
 		}
+		// ensure [txAtomicOps] + [batchAtomicOps] doesnt exceed the [atomicOpsLimit], if any
+		txAtomicOps, err := atomicOpsCount(tx)
+		if err != nil || (atomicOpsLimit > 0 && txAtomicOps > atomicOpsLimit) {
+			// Discard the transaction from the mempool since it cannot fit in a block.
+			vm.mempool.DiscardCurrentTx(tx.ID())
+			continue
+		}
+		if atomicOpsLimit > 0 && batchAtomicOps+txAtomicOps > atomicOpsLimit {
+			// Send [tx] back to the mempool's tx heap.
+			vm.mempool.CancelCurrentTx(tx.ID())
+			break
+		}
 
 		if batchAtomicUTXOs.Overlaps(tx.InputUTXOs()) {
 			// Discard the transaction from the mempool since it will fail verification
@@ -653,13 +910,14 @@ func (vm *VM) postBatchOnFinalizeAndAssemble(header *types.Header, state *state.
 		batchAtomicUTXOs.Union(tx.InputUTXOs())
 		// Add the [txGasUsed] to the [batchGasUsed] when the [tx] has passed verification
 		batchGasUsed.Add(batchGasUsed, txGasUsed)
+		batchAtomicOps += txAtomicOps
 		batchContribution.Add(batchContribution, txContribution)
 	}
 
 	// If there is a non-zero number of transactions, marshal them and return the byte slice
 	// for the block's extra data along with the contribution and gas used.
 	if len(batchAtomicTxs) > 0 {
-		atomicTxBytes, err := vm.codec.Marshal(codecVersion, batchAtomicTxs)
+		atomicTxBytes, err := vm.encodeAtomicTxs(header.Time, batchAtomicTxs)
 		if err != nil {
 			// If we fail to marshal the batch of atomic transactions for any reason,
 			// discard the entire set of current transactions.
@@ -689,31 +947,38 @@ func (vm *VM) onFinalizeAndAssemble(header *types.Header, state *state.StateDB,
 }
 
 func (vm *VM) onExtraStateChange(block *types.Block, state *state.StateDB) (*big.Int, *big.Int, error) {
+	txs, err := vm.extractAtomicTxs(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ApplyAtomicTxs(vm.chainConfig, vm.ctx, block.Header(), txs, state)
+}
+
+// ApplyAtomicTxs applies the state transfers of the atomic [txs] of the block
+// with [header] to [state], as the block is processed on the chain with
+// [config]. Returns the contribution of [txs] to the block fee and their gas
+// used, or nil if there are no txs.
+func ApplyAtomicTxs(config *params.ChainConfig, ctx *snow.Context, header *types.Header, txs []*Tx, state *state.StateDB) (*big.Int, *big.Int, error) {
 	var (
 		batchContribution *big.Int = big.NewInt(0)
 		batchGasUsed      *big.Int = big.NewInt(0)
-		timestamp                  = new(big.Int).SetUint64(block.Time())
-		isApricotPhase4            = vm.chainConfig.IsApricotPhase4(timestamp)
-		isApricotPhase5            = vm.chainConfig.IsApricotPhase5(timestamp)
+		timestamp                  = new(big.Int).SetUint64(header.Time)
+		isApricotPhase4            = config.IsApricotPhase4(timestamp)
+		isApricotPhase5            = config.IsApricotPhase5(timestamp)
 	)
 
-	txs, err := ExtractAtomicTxs(block.ExtData(), isApricotPhase5, vm.codec)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	// If there are no transactions, we can return early
 	if len(txs) == 0 {
 		return nil, nil, nil
 	}
 
 	for _, tx := range txs {
-		if err := tx.UnsignedAtomicTx.EVMStateTransfer(vm.ctx, state); err != nil {
+		if err := tx.UnsignedAtomicTx.EVMStateTransfer(ctx, state); err != nil {
 			return nil, nil, err
 		}
 		// If ApricotPhase4 is enabled, calculate the block fee contribution
 		if isApricotPhase4 {
-			contribution, gasUsed, err := tx.BlockFeeContribution(isApricotPhase5, vm.ctx.AVAXAssetID, block.BaseFee())
+			contribution, gasUsed, err := tx.BlockFeeContribution(isApricotPhase5, ctx.AVAXAssetID, header.BaseFee)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -724,10 +989,10 @@ func (vm *VM) onExtraStateChange(block *types.Block, state *state.StateDB) (*big
 
 		// If ApricotPhase5 is enabled, enforce that the atomic gas used does not exceed the
 		// atomic gas limit.
-		if vm.chainConfig.IsApricotPhase5(timestamp) {
+		if isApricotPhase5 {
 			// Ensure that [tx] does not push [block] above the atomic gas limit.
 			if batchGasUsed.Cmp(params.AtomicGasLimit) == 1 {
-				return nil, nil, fmt.Errorf("atomic gas used (%d) by block (%s), exceeds atomic gas limit (%d)", batchGasUsed, block.Hash().Hex(), params.AtomicGasLimit)
+				return nil, nil, fmt.Errorf("atomic gas used (%d) by block (%s), exceeds atomic gas limit (%d)", batchGasUsed, header.Hash().Hex(), params.AtomicGasLimit)
 			}
 		}
 	}
@@ -762,9 +1027,13 @@ func (vm *VM) SetState(state snow.State) error {
 	switch state {
 	case snow.Bootstrapping:
 		vm.bootstrapped = false
+		vm.readiness.setBootstrapped(false)
+		vm.health.setBootstrapped(false)
 		return vm.fx.Bootstrapping()
 	case snow.NormalOp:
 		vm.bootstrapped = true
+		vm.readiness.setBootstrapped(true)
+		vm.health.setBootstrapped(true)
 		return vm.fx.Bootstrapped()
 	default:
 		return snow.ErrUnknownState
@@ -778,13 +1047,16 @@ func (vm *VM) Shutdown() error {
 	}
 
 	close(vm.shutdownChan)
+	vm.flushShutdownBarrier()
 	vm.chain.Stop()
 	vm.shutdownWg.Wait()
-	return nil
+	return vm.saveHotAccounts()
 }
 
 // buildBlock builds a block to be wrapped by ChainState
 func (vm *VM) buildBlock() (snowman.Block, error) {
+	defer vm.stallDetector.called(consensusCallBuild, vm.clock.Time())
+
 	block, err := vm.chain.GenerateBlock()
 	vm.builder.handleGenerateBlock()
 	if err != nil {
@@ -792,8 +1064,10 @@ func (vm *VM) buildBlock() (snowman.Block, error) {
 		return nil, err
 	}
 
-	isApricotPhase5 := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(block.Time()))
-	atomicTxs, err := ExtractAtomicTxs(block.ExtData(), isApricotPhase5, vm.codec)
+	// Blocks are assembled with version 0 and must use the format active at
+	// their timestamp
+	block.SetVersion(vm.blockFormat(block.Time()).version)
+	atomicTxs, err := vm.extractAtomicTxs(block)
 	if err != nil {
 		vm.mempool.DiscardCurrentTxs()
 		return nil, err
@@ -804,6 +1078,7 @@ func (vm *VM) buildBlock() (snowman.Block, error) {
 		ethBlock:  block,
 		vm:        vm,
 		atomicTxs: atomicTxs,
+		received:  vm.clock.Time(),
 	}
 
 	// Verify is called on a non-wrapped block here, such that this
@@ -837,8 +1112,7 @@ func (vm *VM) parseBlock(b []byte) (snowman.Block, error) {
 		return nil, err
 	}
 
-	isApricotPhase5 := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(ethBlock.Time()))
-	atomicTxs, err := ExtractAtomicTxs(ethBlock.ExtData(), isApricotPhase5, vm.codec)
+	atomicTxs, err := vm.extractAtomicTxs(ethBlock)
 	if err != nil {
 		return nil, err
 	}
@@ -848,12 +1122,14 @@ func (vm *VM) parseBlock(b []byte) (snowman.Block, error) {
 		ethBlock:  ethBlock,
 		vm:        vm,
 		atomicTxs: atomicTxs,
+		received:  vm.clock.Time(),
 	}
 	// Performing syntactic verification in ParseBlock allows for
 	// short-circuiting bad blocks before they are processed by the VM.
 	if _, err := block.syntacticVerify(); err != nil {
 		return nil, fmt.Errorf("syntactic block verification failed: %w", err)
 	}
+	vm.readiness.parsed(block.Height())
 	return block, nil
 }
 
@@ -866,8 +1142,7 @@ func (vm *VM) getBlock(id ids.ID) (snowman.Block, error) {
 	if ethBlock == nil {
 		return nil, database.ErrNotFound
 	}
-	isApricotPhase5 := vm.chainConfig.IsApricotPhase5(new(big.Int).SetUint64(ethBlock.Time()))
-	atomicTxs, err := ExtractAtomicTxs(ethBlock.ExtData(), isApricotPhase5, vm.codec)
+	atomicTxs, err := vm.extractAtomicTxs(ethBlock)
 	if err != nil {
 		return nil, err
 	}
@@ -883,6 +1158,8 @@ func (vm *VM) getBlock(id ids.ID) (snowman.Block, error) {
 
 // SetPreference sets what the current tail of the chain is
 func (vm *VM) SetPreference(blkID ids.ID) error {
+	defer vm.stallDetector.called(consensusCallSetPreference, vm.clock.Time())
+
 	// Since each internal handler used by [vm.State] always returns a block
 	// with non-nil ethBlock value, GetBlockInternal should never return a
 	// (*Block) with a nil ethBlock value.
@@ -891,6 +1168,7 @@ func (vm *VM) SetPreference(blkID ids.ID) error {
 		return fmt.Errorf("failed to set preference to %s: %w", blkID, err)
 	}
 
+	vm.processingBlocks.setPreference(common.Hash(blkID))
 	return vm.chain.SetPreference(block.(*Block).ethBlock)
 }
 
@@ -939,11 +1217,13 @@ func newHandler(name string, service interface{}, lockOption ...commonEng.LockOp
 
 // CreateHandlers makes new http handlers that can handle API calls
 func (vm *VM) CreateHandlers() (map[string]*commonEng.HTTPHandler, error) {
-	handler := vm.chain.NewRPCHandler(vm.config.APIMaxDuration.Duration)
-	enabledAPIs := vm.config.EthAPIs()
-	if err := vm.chain.AttachEthService(handler, enabledAPIs); err != nil {
+	handlers, enabledAPIs, err := vm.newRPCHandlers(vm.config.handlerConfig())
+	if err != nil {
 		return nil, err
 	}
+	vm.rpcHandlersLock.Lock()
+	vm.rpcHandlers = handlers
+	vm.rpcHandlersLock.Unlock()
 
 	primaryAlias, err := vm.ctx.BCLookup.PrimaryAlias(vm.ctx.ChainID)
 	if err != nil {
@@ -966,26 +1246,22 @@ func (vm *VM) CreateHandlers() (map[string]*commonEng.HTTPHandler, error) {
 		enabledAPIs = append(enabledAPIs, "coreth-admin")
 	}
 
-	if vm.config.SnowmanAPIEnabled {
-		if err := handler.RegisterName("snowman", &SnowmanAPI{vm}); err != nil {
-			return nil, err
-		}
-		enabledAPIs = append(enabledAPIs, "snowman")
-	}
-
 	log.Info(fmt.Sprintf("Enabled APIs: %s", strings.Join(enabledAPIs, ", ")))
 	apis[ethRPCEndpoint] = &commonEng.HTTPHandler{
 		LockOptions: commonEng.NoLock,
-		Handler:     handler,
+		Handler:     handlers.server,
 	}
 	apis[ethWSEndpoint] = &commonEng.HTTPHandler{
 		LockOptions: commonEng.NoLock,
-		Handler: handler.WebsocketHandlerWithDuration(
-			[]string{"*"},
-			vm.config.APIMaxDuration.Duration,
-			vm.config.WSCPURefillRate.Duration,
-			vm.config.WSCPUMaxStored.Duration,
-		),
+		Handler:     handlers.ws,
+	}
+	apis[liveEndpoint] = &commonEng.HTTPHandler{
+		LockOptions: commonEng.NoLock,
+		Handler:     vm.health.liveHandler(),
+	}
+	apis[readyEndpoint] = &commonEng.HTTPHandler{
+		LockOptions: commonEng.NoLock,
+		Handler:     vm.health.readyHandler(),
 	}
 
 	return apis, nil
@@ -997,9 +1273,14 @@ func (vm *VM) CreateStaticHandlers() (map[string]*commonEng.HTTPHandler, error)
 	if err := handler.RegisterName("static", &StaticService{}); err != nil {
 		return nil, err
 	}
+	genesisHandler, err := newHandler("evm", &GenesisService{}, commonEng.NoLock)
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]*commonEng.HTTPHandler{
-		"/rpc": {LockOptions: commonEng.NoLock, Handler: handler},
+		"/rpc":                {LockOptions: commonEng.NoLock, Handler: handler},
+		staticGenesisEndpoint: genesisHandler,
 	}, nil
 }
 
@@ -1114,7 +1395,11 @@ func (vm *VM) issueTx(tx *Tx, local bool) error {
 	}
 
 	// add to mempool and possibly re-gossip
-	if err := vm.mempool.AddTx(tx); err != nil {
+	addTx := vm.mempool.AddTx
+	if local {
+		addTx = vm.mempool.AddLocalTx
+	}
+	if err := addTx(tx); err != nil {
 		if !local {
 			// unlike local txs, invalid remote txs are recorded as discarded
 			// so that they won't be requested again
@@ -1134,13 +1419,21 @@ func (vm *VM) issueTx(tx *Tx, local bool) error {
 
 // verifyTxAtTip verifies that [tx] is valid to be issued on top of the currently preferred block
 func (vm *VM) verifyTxAtTip(tx *Tx) error {
-	preferredBlock := vm.chain.CurrentBlock()
+	return vm.verifyTxAtTipFees(tx, true)
+}
+
+// verifyTxAtTipFees is like [verifyTxAtTip], but only verifies that [tx] pays
+// the dynamic fee if [checkFees].
+func (vm *VM) verifyTxAtTipFees(tx *Tx, checkFees bool) error {
+	// The rules are those of the preferred block read from the heads, rather
+	// than of a second read of the head, which may have changed in between
+	preferredBlock := vm.chain.BlockChain().Heads().Preferred
 	preferredState, err := vm.chain.BlockState(preferredBlock)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve block state at tip while verifying atomic tx: %w", err)
 	}
-	rules := vm.currentRules()
 	parentHeader := preferredBlock.Header()
+	rules := vm.chainConfig.AvalancheRules(parentHeader.Number, new(big.Int).SetUint64(parentHeader.Time))
 	var nextBaseFee *big.Int
 	timestamp := vm.clock.Time().Unix()
 	bigTimestamp := big.NewInt(timestamp)
@@ -1150,6 +1443,9 @@ func (vm *VM) verifyTxAtTip(tx *Tx) error {
 			// Return extremely detailed error since CalcBaseFee should never encounter an issue here
 			return fmt.Errorf("failed to calculate base fee with parent timestamp (%d), parent ExtraData: (0x%x), and current timestamp (%d): %w", parentHeader.Time, parentHeader.Extra, timestamp, err)
 		}
+		if !checkFees {
+			nextBaseFee = new(big.Int)
+		}
 	}
 
 	return vm.verifyTx(tx, parentHeader.Hash(), nextBaseFee, preferredState, rules)
@@ -1394,6 +1690,12 @@ func (vm *VM) GetCurrentNonce(address common.Address) (uint64, error) {
 	return state.GetNonce(address), nil
 }
 
+// SubscribeTxPoolReorgs registers [ch] to receive the heads the tx pool is
+// reset to, which follow the preferred and accepted blocks.
+func (vm *VM) SubscribeTxPoolReorgs(ch chan<- core.NewTxPoolReorgEvent) event.Subscription {
+	return vm.chain.GetTxPool().SubscribeNewReorgEvent(ch)
+}
+
 // currentRules returns the chain rules for the current block.
 func (vm *VM) currentRules() params.Rules {
 	header := vm.chain.APIBackend().CurrentHeader()
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/zsmartex/coreth/trie"
@@ -48,6 +49,7 @@ import (
 	"github.com/zsmartex/coreth/core"
 	"github.com/zsmartex/coreth/core/types"
 	"github.com/zsmartex/coreth/eth"
+	"github.com/zsmartex/coreth/eth/filters"
 	"github.com/zsmartex/coreth/params"
 	"github.com/zsmartex/coreth/rpc"
 
@@ -204,6 +206,8 @@ func GenesisVM(t *testing.T,
 	appSender := &engCommon.SenderTest{}
 	appSender.CantSendAppGossip = true
 	appSender.SendAppGossipF = func([]byte) error { return nil }
+	appSender.CantSendAppGossipSpecific = true
+	appSender.SendAppGossipSpecificF = func(ids.ShortSet, []byte) error { return nil }
 	if err := vm.Initialize(
 		ctx,
 		dbManager,
@@ -311,6 +315,77 @@ func TestVMNilConfig(t *testing.T) {
 	assert.NoError(t, vm.Shutdown())
 }
 
+func TestVMEthAPIMethodGroups(t *testing.T) {
+	configJSON := `{"eth-apis": [], "eth-api-method-groups": ["eth-filter", "debug-tracer"]}`
+	_, vm, _, _, _ := GenesisVM(t, false, genesisJSONApricotPhase0, configJSON, "")
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	handlers, err := vm.CreateHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, ok := handlers[ethRPCEndpoint].Handler.(*rpc.Server)
+	if !ok {
+		t.Fatalf("expected eth RPC handler to be *rpc.Server, but found %T", handlers[ethRPCEndpoint].Handler)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	isMethodNotFound := func(err error) bool {
+		var rpcErr rpc.Error
+		return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601
+	}
+
+	// Methods in the enabled groups must be callable.
+	var filterID string
+	if err := client.Call(&filterID, "eth_newBlockFilter"); err != nil {
+		t.Fatalf("expected eth_newBlockFilter to be enabled: %s", err)
+	}
+	var traces interface{}
+	if err := client.Call(&traces, "debug_traceBlockByNumber", "0x0"); isMethodNotFound(err) {
+		t.Fatalf("expected debug_traceBlockByNumber to be enabled: %s", err)
+	}
+
+	// Methods in sibling groups on the same namespaces must not be registered.
+	var logs interface{}
+	if err := client.Call(&logs, "eth_getLogs", map[string]interface{}{}); !isMethodNotFound(err) {
+		t.Fatalf("expected eth_getLogs to return method not found, but found: %v", err)
+	}
+	var rlpBytes interface{}
+	if err := client.Call(&rlpBytes, "debug_getHeaderRlp", 0); !isMethodNotFound(err) {
+		t.Fatalf("expected debug_getHeaderRlp to return method not found, but found: %v", err)
+	}
+	var balance interface{}
+	if err := client.Call(&balance, "eth_getBalance", common.Address{}, "latest"); !isMethodNotFound(err) {
+		t.Fatalf("expected eth_getBalance to return method not found, but found: %v", err)
+	}
+}
+
+func TestVMUnknownEthAPIMethodGroup(t *testing.T) {
+	vm := &VM{}
+	ctx, dbManager, genesisBytes, issuer, _ := setupGenesis(t, genesisJSONApricotPhase0)
+	err := vm.Initialize(
+		ctx,
+		dbManager,
+		genesisBytes,
+		[]byte(""),
+		[]byte(`{"eth-api-method-groups": ["debug-everything"]}`),
+		issuer,
+		[]*engCommon.Fx{},
+		nil,
+	)
+	if err == nil {
+		t.Fatal("expected initialization to fail with an unknown eth API method group")
+	}
+	if !strings.Contains(err.Error(), "debug-everything") {
+		t.Fatalf("expected error to name the unknown group, but found: %s", err)
+	}
+}
+
 func TestVMContinuosProfiler(t *testing.T) {
 	profilerDir := t.TempDir()
 	profilerFrequency := 500 * time.Millisecond
@@ -3020,6 +3095,8 @@ func TestConfigureLogLevel(t *testing.T) {
 			appSender := &engCommon.SenderTest{}
 			appSender.CantSendAppGossip = true
 			appSender.SendAppGossipF = func([]byte) error { return nil }
+			appSender.CantSendAppGossipSpecific = true
+			appSender.SendAppGossipSpecificF = func(ids.ShortSet, []byte) error { return nil }
 			err := vm.Initialize(
 				ctx,
 				dbManager,
@@ -3687,3 +3764,250 @@ func TestGetAtomicRepositoryRepairHeights(t *testing.T) {
 	testnetHeights := getAtomicRepositoryRepairHeights(params.AvalancheFujiChainID)
 	assert.Empty(t, testnetHeights)
 }
+
+// TestIncludedTransactionsEvents ensures that includedTransactions subscribers
+// are notified as blocks containing their transactions are verified, accepted
+// and rejected.
+//   A
+//  / \
+// B   C
+// B and C both contain txs[0]. C is accepted and B is rejected.
+func TestIncludedTransactionsEvents(t *testing.T) {
+	importAmount := uint64(1000000000)
+	issuer1, vm1, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase0, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+	issuer2, vm2, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase0, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: importAmount,
+	})
+
+	defer func() {
+		if err := vm1.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := vm2.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	newTxPoolHeadChan1 := make(chan core.NewTxPoolReorgEvent, 1)
+	vm1.chain.GetTxPool().SubscribeNewReorgEvent(newTxPoolHeadChan1)
+	newTxPoolHeadChan2 := make(chan core.NewTxPoolReorgEvent, 1)
+	vm2.chain.GetTxPool().SubscribeNewReorgEvent(newTxPoolHeadChan2)
+
+	key, err := accountKeystore.NewKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importTx, err := vm1.newImportTx(vm1.ctx.XChainID, key.Address, initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+
+	<-issuer1
+
+	vm1BlkA, err := vm1.BuildBlock()
+	if err != nil {
+		t.Fatalf("Failed to build block with import transaction: %s", err)
+	}
+	if err := vm1BlkA.Verify(); err != nil {
+		t.Fatalf("Block failed verification on VM1: %s", err)
+	}
+	if err := vm1.SetPreference(vm1BlkA.ID()); err != nil {
+		t.Fatal(err)
+	}
+	vm2BlkA, err := vm2.ParseBlock(vm1BlkA.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing block from vm2: %s", err)
+	}
+	if err := vm2BlkA.Verify(); err != nil {
+		t.Fatalf("Block failed verification on VM2: %s", err)
+	}
+	if err := vm2.SetPreference(vm2BlkA.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1BlkA.Accept(); err != nil {
+		t.Fatalf("VM1 failed to accept block: %s", err)
+	}
+	if err := vm2BlkA.Accept(); err != nil {
+		t.Fatalf("VM2 failed to accept block: %s", err)
+	}
+	<-newTxPoolHeadChan1
+	<-newTxPoolHeadChan2
+
+	txs := make([]*types.Transaction, 10)
+	for i := 0; i < 10; i++ {
+		tx := types.NewTransaction(uint64(i), key.Address, big.NewInt(10), 21000, big.NewInt(params.LaunchMinGasPrice), nil)
+		signedTx, err := types.SignTx(tx, types.NewEIP155Signer(vm1.chainID), key.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs[i] = signedTx
+	}
+
+	eventSystem := filters.NewEventSystem(vm1.chain.APIBackend(), true)
+	included := make(chan []*filters.IncludedTx, 16)
+	includedSub := eventSystem.SubscribeIncludedTxs(filters.IncludedTxsCriteria{Hashes: []common.Hash{txs[0].Hash()}}, included)
+	defer includedSub.Unsubscribe()
+
+	expectEvent := func(blockHash common.Hash, phase string) {
+		t.Helper()
+		select {
+		case events := <-included:
+			if len(events) != 1 {
+				t.Fatalf("expected 1 inclusion event, but found %d", len(events))
+			}
+			ev := events[0]
+			if ev.TxHash != txs[0].Hash() {
+				t.Fatalf("expected event for tx %s, but found %s", txs[0].Hash().Hex(), ev.TxHash.Hex())
+			}
+			if ev.BlockHash != blockHash {
+				t.Fatalf("expected event for block %s, but found %s", blockHash.Hex(), ev.BlockHash.Hex())
+			}
+			if uint64(ev.Height) != vm1BlkA.Height()+1 {
+				t.Fatalf("expected event at height %d, but found %d", vm1BlkA.Height()+1, ev.Height)
+			}
+			if ev.Phase != phase {
+				t.Fatalf("expected phase %q, but found %q", phase, ev.Phase)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q event for block %s", phase, blockHash.Hex())
+		}
+	}
+
+	errs := vm1.chain.AddRemoteTxsSync(txs)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to add transaction to VM1 at index %d: %s", i, err)
+		}
+	}
+
+	<-issuer1
+
+	vm1BlkB, err := vm1.BuildBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm1BlkB.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(common.Hash(vm1BlkB.ID()), "verified")
+	if err := vm1.SetPreference(vm1BlkB.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	errs = vm2.chain.AddRemoteTxsSync(txs[0:5])
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to add transaction to VM2 at index %d: %s", i, err)
+		}
+	}
+
+	<-issuer2
+
+	vm2BlkC, err := vm2.BuildBlock()
+	if err != nil {
+		t.Fatalf("Failed to build BlkC on VM2: %s", err)
+	}
+	vm1BlkC, err := vm1.ParseBlock(vm2BlkC.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing block from vm2: %s", err)
+	}
+	if err := vm1BlkC.Verify(); err != nil {
+		t.Fatalf("Block failed verification on VM1: %s", err)
+	}
+	expectEvent(common.Hash(vm1BlkC.ID()), "verified")
+
+	if err := vm1BlkC.Accept(); err != nil {
+		t.Fatalf("VM1 failed to accept block: %s", err)
+	}
+	expectEvent(common.Hash(vm1BlkC.ID()), "accepted")
+
+	if err := vm1BlkB.Reject(); err != nil {
+		t.Fatalf("VM1 failed to reject block: %s", err)
+	}
+	expectEvent(common.Hash(vm1BlkB.ID()), "rejected")
+
+	select {
+	case events := <-included:
+		t.Fatalf("unexpected inclusion events: %v", events)
+	default:
+	}
+}
+
+func TestInitCodeLimit(t *testing.T) {
+	maxInitCodeSize := uint64(60000) // above the EIP-3860 default
+	genesisJSON := strings.Replace(genesisJSONApricotPhase5,
+		`"apricotPhase5BlockTimestamp":0`,
+		fmt.Sprintf(`"apricotPhase5BlockTimestamp":0, "initCodeLimitBlockTimestamp":0, "maxInitCodeSize":%d`, maxInitCodeSize), 1)
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSON, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 500000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if got := vm.chainConfig.GetMaxInitCodeSize(); got != maxInitCodeSize {
+		t.Fatalf("Expected max init code size %d, found %d", maxInitCodeSize, got)
+	}
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, []*crypto.PrivateKeySECP256K1R{testKeys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	handler := vm.chain.NewRPCHandler(0)
+	if err := vm.chain.AttachEthService(handler, []string{"internal-public-blockchain"}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(handler)
+	defer client.Close()
+
+	estimateGas := func(size uint64) (hexutil.Uint64, error) {
+		var gas hexutil.Uint64
+		err := client.Call(&gas, "eth_estimateGas", map[string]interface{}{
+			"from": testEthAddrs[0],
+			"data": hexutil.Bytes(make([]byte, size)),
+		})
+		return gas, err
+	}
+	gas, err := estimateGas(maxInitCodeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedGas := params.TxGasContractCreation + params.TxDataZeroGas*maxInitCodeSize + params.InitCodeWordGas*maxInitCodeSize/32
+	if uint64(gas) != expectedGas {
+		t.Fatalf("Expected estimate of %d gas, found %d", expectedGas, gas)
+	}
+	if _, err := estimateGas(maxInitCodeSize + 1); err == nil || !strings.Contains(err.Error(), core.ErrMaxInitCodeSizeExceeded.Error()) {
+		t.Fatalf("Expected estimate to fail with %v, found %v", core.ErrMaxInitCodeSizeExceeded, err)
+	}
+
+	// The pool rejects what the estimate rejects, and what it admits is
+	// accepted in a block. The price covers the block gas cost.
+	gasPrice := big.NewInt(600 * params.GWei)
+	signer := types.LatestSigner(vm.chainConfig)
+	tooLarge, err := types.SignTx(types.NewContractCreation(0, common.Big0, 500_000, gasPrice, make([]byte, maxInitCodeSize+1)), signer, testKeys[0].ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.chain.GetTxPool().AddLocal(tooLarge); !errors.Is(err, core.ErrMaxInitCodeSizeExceeded) {
+		t.Fatalf("Expected pool to reject tx with %v, found %v", core.ErrMaxInitCodeSizeExceeded, err)
+	}
+	sendEthTxs(t, vm, types.NewContractCreation(0, common.Big0, uint64(gas), gasPrice, make([]byte, maxInitCodeSize)))
+	blk := buildAndAcceptBlock(t, issuer, vm)
+	receipts := vm.chain.GetReceiptsByHash(common.Hash(blk.ID()))
+	if len(receipts) != 1 || receipts[0].Status != types.ReceiptStatusSuccessful || receipts[0].GasUsed != uint64(gas) {
+		t.Fatalf("Expected successful deployment using %d gas, found %+v", gas, receipts)
+	}
+}
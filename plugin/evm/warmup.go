@@ -0,0 +1,257 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/zsmartex/avalanchego/database"
+
+	"github.com/zsmartex/coreth/core"
+	"github.com/zsmartex/coreth/core/types"
+)
+
+const (
+	// [hotAccountsTrackedFactor] bounds the number of accounts counted by
+	// [hotAccounts] to this multiple of the number of hot accounts.
+	hotAccountsTrackedFactor = 16
+
+	// [warmupLogInterval] is how often the progress of the warmup is logged.
+	warmupLogInterval = 8 * time.Second
+)
+
+var hotAccountsKey = []byte("hot_accounts")
+
+// hotAccounts counts the accounts sending and receiving the transactions of
+// the accepted blocks, to warm the state of the most frequent ones at the next
+// startup.
+//
+// All methods are no-ops on a nil [hotAccounts], when the warmup is disabled.
+type hotAccounts struct {
+	lock   sync.Mutex
+	limit  int
+	counts map[common.Address]uint64
+}
+
+func newHotAccounts(limit int) *hotAccounts {
+	return &hotAccounts{
+		limit:  limit,
+		counts: make(map[common.Address]uint64),
+	}
+}
+
+// record counts the senders and recipients of the transactions of [block].
+func (h *hotAccounts) record(block *types.Block, signer types.Signer) {
+	if h == nil || h.limit == 0 {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, tx := range block.Transactions() {
+		if from, err := types.Sender(signer, tx); err == nil {
+			h.counts[from]++
+		}
+		if to := tx.To(); to != nil {
+			h.counts[*to]++
+		}
+	}
+	if len(h.counts) > hotAccountsTrackedFactor*h.limit {
+		// Keep counting the most frequent accounts only
+		top := h.sorted()[:h.limit]
+		counts := make(map[common.Address]uint64, len(top))
+		for _, addr := range top {
+			counts[addr] = h.counts[addr]
+		}
+		h.counts = counts
+	}
+}
+
+// top returns the most frequent accounts, most frequent first.
+func (h *hotAccounts) top() []common.Address {
+	if h == nil {
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	accounts := h.sorted()
+	if len(accounts) > h.limit {
+		accounts = accounts[:h.limit]
+	}
+	return accounts
+}
+
+// sorted returns the counted accounts, most frequent first. Assumes [lock] is
+// held.
+func (h *hotAccounts) sorted() []common.Address {
+	accounts := make([]common.Address, 0, len(h.counts))
+	for addr := range h.counts {
+		accounts = append(accounts, addr)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if ci, cj := h.counts[accounts[i]], h.counts[accounts[j]]; ci != cj {
+			return ci > cj
+		}
+		return bytes.Compare(accounts[i][:], accounts[j][:]) < 0
+	})
+	return accounts
+}
+
+// readHotAccounts returns the hot accounts persisted in [db] by the last
+// session, if any.
+func readHotAccounts(db database.KeyValueReader) ([]common.Address, error) {
+	accountsBytes, err := db.Get(hotAccountsKey)
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var accounts []common.Address
+	if err := rlp.DecodeBytes(accountsBytes, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// writeHotAccounts persists [accounts] in [db] for the next session.
+func writeHotAccounts(db database.KeyValueWriter, accounts []common.Address) error {
+	accountsBytes, err := rlp.EncodeToBytes(accounts)
+	if err != nil {
+		return err
+	}
+	return db.Put(hotAccountsKey, accountsBytes)
+}
+
+// cacheWarmer warms the caches of a chain after a restart by reading its last
+// accepted blocks and the state of the hot accounts of the last session, until
+// its time budget is spent.
+type cacheWarmer struct {
+	chain  *core.BlockChain
+	budget time.Duration
+	stop   <-chan struct{}
+
+	blocksGauge   metrics.Gauge
+	accountsGauge metrics.Gauge
+	durationTimer metrics.Timer
+}
+
+func newCacheWarmer(chain *core.BlockChain, budget time.Duration, stop <-chan struct{}) *cacheWarmer {
+	return &cacheWarmer{
+		chain:         chain,
+		budget:        budget,
+		stop:          stop,
+		blocksGauge:   metrics.NewRegisteredGauge("warmup/blocks", nil),
+		accountsGauge: metrics.NewRegisteredGauge("warmup/accounts", nil),
+		durationTimer: metrics.NewRegisteredTimer("warmup/duration", nil),
+	}
+}
+
+// run reads the headers, bodies and receipts of the last [blocks] accepted
+// blocks, and then the state of [accounts] at the last accepted block. It
+// returns the number of blocks and accounts read before the time budget is
+// spent or [stop] is closed.
+func (w *cacheWarmer) run(blocks uint64, accounts []common.Address) (int, int) {
+	var (
+		start          = time.Now()
+		deadline       = start.Add(w.budget)
+		logged         = start
+		lastAccepted   = w.chain.LastAcceptedBlock()
+		warmedBlocks   int
+		warmedAccounts int
+	)
+	defer func() {
+		w.durationTimer.UpdateSince(start)
+		log.Info("Finished cache warmup", "blocks", warmedBlocks, "accounts", warmedAccounts, "elapsed", time.Since(start))
+	}()
+	done := func() bool {
+		select {
+		case <-w.stop:
+			return true
+		default:
+		}
+		if now := time.Now(); !now.Before(deadline) {
+			return true
+		} else if now.Sub(logged) > warmupLogInterval {
+			log.Info("Warming up caches", "blocks", warmedBlocks, "accounts", warmedAccounts, "elapsed", now.Sub(start))
+			logged = now
+		}
+		return false
+	}
+
+	log.Info("Starting cache warmup", "blocks", blocks, "accounts", len(accounts), "budget", w.budget)
+	for i := uint64(0); i < blocks && i <= lastAccepted.NumberU64(); i++ {
+		if done() {
+			return warmedBlocks, warmedAccounts
+		}
+		number := lastAccepted.NumberU64() - i
+		header := w.chain.GetHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		w.chain.GetBlock(header.Hash(), number)
+		w.chain.GetReceiptsByHash(header.Hash())
+		warmedBlocks++
+		w.blocksGauge.Update(int64(warmedBlocks))
+	}
+
+	if len(accounts) == 0 {
+		return warmedBlocks, warmedAccounts
+	}
+	state, err := w.chain.StateAt(lastAccepted.Root())
+	if err != nil {
+		log.Warn("Failed to warm up the state of the hot accounts", "err", err)
+		return warmedBlocks, warmedAccounts
+	}
+	for _, addr := range accounts {
+		if done() {
+			return warmedBlocks, warmedAccounts
+		}
+		state.GetBalance(addr)
+		state.GetCode(addr)
+		warmedAccounts++
+		w.accountsGauge.Update(int64(warmedAccounts))
+	}
+	return warmedBlocks, warmedAccounts
+}
+
+// startWarmup warms the caches of the chain in the background, holding the
+// RPC calls until it is done if they are gated by readiness.
+func (vm *VM) startWarmup() {
+	accounts, err := readHotAccounts(vm.db)
+	if err != nil {
+		log.Warn("Failed to read the hot accounts of the last session", "err", err)
+	}
+	warmer := newCacheWarmer(vm.chain.BlockChain(), vm.config.WarmupDuration.Duration, vm.shutdownChan)
+	vm.readiness.setWarming(true)
+	vm.shutdownWg.Add(1)
+	go vm.ctx.Log.RecoverAndPanic(func() {
+		defer vm.shutdownWg.Done()
+		defer vm.readiness.setWarming(false)
+
+		warmer.run(vm.config.WarmupBlocks, accounts)
+	})
+}
+
+// saveHotAccounts persists the hot accounts of this session for the warmup
+// of the next one, keeping those of the last session if none was counted.
+func (vm *VM) saveHotAccounts() error {
+	accounts := vm.hotAccounts.top()
+	if len(accounts) == 0 {
+		return nil
+	}
+	if err := writeHotAccounts(vm.db, accounts); err != nil {
+		return err
+	}
+	return vm.db.Commit()
+}
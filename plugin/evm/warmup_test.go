@@ -0,0 +1,141 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package evm
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zsmartex/avalanchego/ids"
+	engCommon "github.com/zsmartex/avalanchego/snow/engine/common"
+
+	"github.com/zsmartex/coreth/core/types"
+	"github.com/zsmartex/coreth/params"
+)
+
+func TestHotAccountsRestart(t *testing.T) {
+	issuer, vm, dbManager, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, `{"warmup-enabled":true}`, "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	// [testEthAddrs[0]] sends a tx to [testEthAddrs[1]] and one to [testEthAddrs[2]]
+	gasPrice := new(big.Int).Mul(big.NewInt(params.LaunchMinGasPrice), big.NewInt(10))
+	var txs []*types.Transaction
+	for nonce, to := range []common.Address{testEthAddrs[1], testEthAddrs[2]} {
+		tx, err := types.SignTx(types.NewTransaction(uint64(nonce), to, big.NewInt(1), params.TxGas, gasPrice, nil), types.NewEIP155Signer(vm.chainID), testKeys[0].ToECDSA())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	for _, err := range vm.chain.AddRemoteTxsSync(txs) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	expected := []common.Address{testEthAddrs[0], testEthAddrs[1], testEthAddrs[2]}
+	if bytes.Compare(testEthAddrs[2][:], testEthAddrs[1][:]) < 0 {
+		expected[1], expected[2] = expected[2], expected[1]
+	}
+	if accounts := vm.hotAccounts.top(); !reflect.DeepEqual(accounts, expected) {
+		t.Fatalf("Expected hot accounts %v, found %v", expected, accounts)
+	}
+	if err := vm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hot accounts are persisted for the next session
+	restartedVM := &VM{}
+	if err := restartedVM.Initialize(
+		NewContext(),
+		dbManager,
+		[]byte(genesisJSONApricotPhase5),
+		[]byte(""),
+		[]byte(`{"warmup-enabled":true}`),
+		issuer,
+		[]*engCommon.Fx{},
+		nil,
+	); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := readHotAccounts(restartedVM.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(accounts, expected) {
+		t.Fatalf("Expected persisted hot accounts %v, found %v", expected, accounts)
+	}
+
+	// A session without hot accounts keeps those of the last session
+	if err := restartedVM.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err := readHotAccounts(restartedVM.db); err != nil || !reflect.DeepEqual(accounts, expected) {
+		t.Fatalf("Expected persisted hot accounts %v, found %v (err: %v)", expected, accounts, err)
+	}
+}
+
+func TestCacheWarmerBudget(t *testing.T) {
+	issuer, vm, _, _, _ := GenesisVMWithUTXOs(t, true, genesisJSONApricotPhase5, "", "", map[ids.ShortID]uint64{
+		testShortIDAddrs[0]: 50000000000,
+	})
+	defer func() {
+		if err := vm.Shutdown(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	importTx, err := vm.newImportTx(vm.ctx.XChainID, testEthAddrs[0], initialBaseFee, testKeys[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.issueTx(importTx, true /*=local*/); err != nil {
+		t.Fatal(err)
+	}
+	buildAndAcceptBlock(t, issuer, vm)
+
+	chain := vm.chain.BlockChain()
+	accounts := make([]common.Address, 100000)
+	for i := range accounts {
+		accounts[i] = common.BigToAddress(big.NewInt(int64(i)))
+	}
+
+	// All the accepted blocks and the accounts are warmed within the budget
+	if blocks, warmed := newCacheWarmer(chain, time.Minute, nil).run(256, accounts[:100]); blocks != 2 || warmed != 100 {
+		t.Fatalf("Expected 2 blocks and 100 accounts to be warmed, found %d and %d", blocks, warmed)
+	}
+
+	// Nothing is warmed without budget or once stopped
+	if blocks, warmed := newCacheWarmer(chain, 0, nil).run(256, accounts); blocks != 0 || warmed != 0 {
+		t.Fatalf("Expected nothing to be warmed without budget, found %d blocks and %d accounts", blocks, warmed)
+	}
+	stop := make(chan struct{})
+	close(stop)
+	if blocks, warmed := newCacheWarmer(chain, time.Minute, stop).run(256, accounts); blocks != 0 || warmed != 0 {
+		t.Fatalf("Expected nothing to be warmed once stopped, found %d blocks and %d accounts", blocks, warmed)
+	}
+
+	// The warmup stops once its budget is spent
+	budget := 10 * time.Millisecond
+	start := time.Now()
+	_, warmed := newCacheWarmer(chain, budget, nil).run(256, accounts)
+	if elapsed := time.Since(start); warmed == len(accounts) || elapsed > budget+time.Second {
+		t.Fatalf("Expected the warmup to stop after %s, warmed %d accounts in %s", budget, warmed, elapsed)
+	}
+}
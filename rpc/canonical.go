@@ -0,0 +1,148 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// canonicalHeader and canonicalQueryParam opt a HTTP request into the
+	// canonical encoding of its responses.
+	canonicalHeader     = "X-Canonical-JSON"
+	canonicalQueryParam = "canonical"
+)
+
+// isCanonicalRequest returns true if [r] requests the canonical encoding of
+// its responses with a true [canonicalHeader] or [canonicalQueryParam].
+func isCanonicalRequest(r *http.Request) bool {
+	for _, value := range []string{r.Header.Get(canonicalHeader), r.URL.Query().Get(canonicalQueryParam)} {
+		if canonical, err := strconv.ParseBool(value); err == nil && canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// newCanonicalEncoder returns an encoder writing the canonical JSON encoding
+// of its values to [w].
+func newCanonicalEncoder(w io.Writer) func(v interface{}) error {
+	return func(v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		canonical, err := canonicalJSON(b)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(canonical)
+		return err
+	}
+}
+
+// canonicalJSON returns the canonical encoding of the JSON document [b], so
+// that documents holding the same values are byte-identical:
+//   - object keys are sorted by their bytes
+//   - 0x-prefixed hex strings are lowercase
+//   - there is no insignificant whitespace
+//
+// Only the presentation changes: numbers are written as they are found and
+// strings are only re-escaped.
+func canonicalJSON(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid content after the JSON value")
+	}
+	buf := new(bytes.Buffer)
+	if err := writeCanonical(buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		buf.WriteString(string(v))
+	case string:
+		return writeCanonicalString(buf, canonicalHex(v))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+	return nil
+}
+
+// writeCanonicalString writes [s] quoted, escaping only what JSON requires.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	// Drop the newline written by [Encode]
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// canonicalHex returns [s] lowercased if it is a 0x-prefixed hex string, and
+// [s] otherwise.
+func canonicalHex(s string) string {
+	if len(s) < 2 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return s
+	}
+	for _, c := range s[2:] {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') && !('A' <= c && c <= 'F') {
+			return s
+		}
+	}
+	return strings.ToLower(s)
+}
@@ -0,0 +1,54 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "sorted keys",
+			input:    `{"b": 1, "a": {"d": [true, null], "c": false}}`,
+			expected: `{"a":{"c":false,"d":[true,null]},"b":1}`,
+		},
+		{
+			name:     "lowercase hex",
+			input:    `["0xABcd", "0XFF", "0x", "0xABCG", "ABCD", {"0xAB": "0xCD"}]`,
+			expected: `["0xabcd","0xff","0x","0xABCG","ABCD",{"0xAB":"0xcd"}]`,
+		},
+		{
+			name:     "numbers unchanged",
+			input:    `[1.50, 1e3, -0, 123456789012345678901234567890]`,
+			expected: `[1.50,1e3,-0,123456789012345678901234567890]`,
+		},
+		{
+			name:     "strings re-escaped",
+			input:    `"<A>\n\"\\"`,
+			expected: `"<A>\n\"\\"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			canonical, err := canonicalJSON([]byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(canonical) != test.expected {
+				t.Fatalf("Expected %s, found %s", test.expected, canonical)
+			}
+		})
+	}
+
+	for _, input := range []string{``, `{"a":}`, `{} {}`} {
+		if _, err := canonicalJSON([]byte(input)); err == nil {
+			t.Fatalf("Expected %q to be rejected", input)
+		}
+	}
+}
@@ -194,8 +194,8 @@ func DialContext(ctx context.Context, rawurl string) (*Client, error) {
 		return DialWebsocket(ctx, rawurl, "")
 	//case "stdio":
 	//	return DialStdIO(ctx)
-	//case "":
-	//	return DialIPC(ctx, rawurl)
+	case "":
+		return DialIPC(ctx, rawurl)
 	default:
 		return nil, fmt.Errorf("no known transport for URL scheme %q", u.Scheme)
 	}
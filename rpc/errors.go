@@ -85,6 +85,16 @@ func (e *subscriptionNotFoundError) Error() string {
 	return fmt.Sprintf("no %q subscription in %s namespace", e.subscription, e.namespace)
 }
 
+// subscriptionRemovedError is sent to the clients of the subscriptions that are
+// no longer provided after the services of the server were replaced.
+type subscriptionRemovedError struct{ namespace, subscription string }
+
+func (e *subscriptionRemovedError) ErrorCode() int { return -32601 }
+
+func (e *subscriptionRemovedError) Error() string {
+	return fmt.Sprintf("%q subscription in %s namespace is no longer served", e.subscription, e.namespace)
+}
+
 // Invalid JSON was received by the server.
 type parseError struct{ message string }
 
@@ -146,6 +146,10 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
 		for _, msg := range calls {
 			if answer := h.handleCallMsg(cp, msg); answer != nil {
+				// The streamed results of a batch are buffered
+				if answer.stream != nil {
+					answer = answer.bufferStream()
+				}
 				answers = append(answers, answer)
 			}
 		}
@@ -156,6 +160,10 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		for _, n := range cp.notifiers {
 			n.activate()
 		}
+		if len(cp.notifiers) > 0 {
+			// The services may have been replaced while subscribing
+			h.terminateRemovedSubscriptions()
+		}
 	})
 }
 
@@ -168,14 +176,34 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 		answer := h.handleCallMsg(cp, msg)
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
-			h.conn.writeJSONSkipDeadline(cp.ctx, answer, h.deadlineContext > 0)
+			h.writeAnswer(cp, answer)
 		}
 		for _, n := range cp.notifiers {
 			n.activate()
 		}
+		if len(cp.notifiers) > 0 {
+			// The services may have been replaced while subscribing
+			h.terminateRemovedSubscriptions()
+		}
 	})
 }
 
+// writeAnswer writes the answer to a single call, streaming its result if
+// the connection supports it.
+func (h *handler) writeAnswer(cp *callProc, answer *jsonrpcMessage) {
+	if answer.stream == nil {
+		h.conn.writeJSONSkipDeadline(cp.ctx, answer, h.deadlineContext > 0)
+		return
+	}
+	if conn, ok := h.conn.(streamWriter); ok {
+		if err := conn.writeStream(answer); err != nil {
+			h.log.Warn("Failed to stream result", "reqid", idForLog{answer.ID}, "err", err)
+		}
+		return
+	}
+	h.conn.writeJSONSkipDeadline(cp.ctx, answer.bufferStream(), h.deadlineContext > 0)
+}
+
 // close cancels all requests except for inflightReq and waits for
 // call goroutines to shut down.
 func (h *handler) close(err error, inflightReq *requestOp) {
@@ -183,6 +211,7 @@ func (h *handler) close(err error, inflightReq *requestOp) {
 	h.callWG.Wait()
 	h.cancelRoot()
 	h.cancelServerSubscriptions(err)
+	h.reg.untrackHandler(h)
 }
 
 // addRequestOp registers a request operation.
@@ -229,8 +258,36 @@ func (h *handler) addSubscriptions(nn []*Notifier) {
 	for _, n := range nn {
 		if sub := n.takeSubscription(); sub != nil {
 			h.serverSubs[sub.ID] = sub
+			h.reg.trackHandler(h)
+		}
+	}
+}
+
+// terminateRemovedSubscriptions terminates the subscriptions that are no
+// longer provided by the services of the server. Their error channels receive
+// a subscriptionRemovedError, which is also sent to the client.
+func (h *handler) terminateRemovedSubscriptions() {
+	h.subLock.Lock()
+	var removed []*Subscription
+	for id, s := range h.serverSubs {
+		if h.reg.subscription(s.namespace, s.name) == nil {
+			removed = append(removed, s)
+			delete(h.serverSubs, id)
 		}
 	}
+	h.subLock.Unlock()
+
+	for _, s := range removed {
+		err := &subscriptionRemovedError{namespace: s.namespace, subscription: s.name}
+		params, _ := json.Marshal(&subscriptionResult{ID: string(s.ID), Error: errorMessage(err).Error})
+		h.conn.writeJSON(h.rootCtx, &jsonrpcMessage{
+			Version: vsn,
+			Method:  s.namespace + notificationMethodSuffix,
+			Params:  params,
+		})
+		s.err <- err
+		close(s.err)
+	}
 }
 
 // cancelServerSubscriptions removes all subscriptions and closes their error channels.
@@ -342,9 +399,17 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	sub := h.clientSubs[result.ID]
+	if sub == nil {
+		return
+	}
+	if result.Error != nil {
+		// The server terminated the subscription
+		delete(h.clientSubs, result.ID)
+		sub.close(result.Error)
+		return
 	}
+	sub.deliver(result.Result)
 }
 
 // handleResponse processes method call responses.
@@ -415,6 +480,11 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	if !msg.isUnsubscribe() {
+		if err := h.reg.checkGate(msg.Method); err != nil {
+			return msg.errorResponse(err)
+		}
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -422,12 +492,16 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if msg.isUnsubscribe() {
 		callb = h.unsubscribeCb
 	} else {
-		callb = h.reg.callback(msg.Method)
+		var release func()
+		callb, release = h.reg.acquireCallback(msg.Method)
+		if release != nil {
+			defer release()
+		}
 	}
 	if callb == nil {
 		return msg.errorResponse(&methodNotFoundError{method: msg.Method})
 	}
-	args, err := parsePositionalArguments(msg.Params, callb.argTypes)
+	args, err := parsePositionalArguments(msg.Params, callb.argTypes, h.reg.strictQuantities())
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
@@ -470,14 +544,14 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 
 	// Parse subscription name arg too, but remove it before calling the callback.
 	argTypes := append([]reflect.Type{stringType}, callb.argTypes...)
-	args, err := parsePositionalArguments(msg.Params, argTypes)
+	args, err := parsePositionalArguments(msg.Params, argTypes, h.reg.strictQuantities())
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 	args = args[1:]
 
 	// Install notifier in context so the subscription handler can find it.
-	n := &Notifier{h: h, namespace: namespace}
+	n := &Notifier{h: h, namespace: namespace, name: name}
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
@@ -490,6 +564,13 @@ func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *cal
 	if err != nil {
 		return msg.errorResponse(err)
 	}
+	if stream, ok := result.(StreamedResult); ok {
+		if stream == nil {
+			return msg.response(nil)
+		}
+		// The result is encoded when the response is written
+		return &jsonrpcMessage{Version: vsn, ID: msg.ID, stream: stream}
+	}
 	return msg.response(result)
 }
 
@@ -233,7 +233,19 @@ type httpServerConn struct {
 func newHTTPServerConn(r *http.Request, w http.ResponseWriter) ServerCodec {
 	body := io.LimitReader(r.Body, maxRequestContentLength)
 	conn := &httpServerConn{Reader: body, Writer: w, r: r}
-	return NewCodec(conn)
+	if isCanonicalRequest(r) {
+		dec := json.NewDecoder(conn)
+		dec.UseNumber()
+		return NewFuncCodec(conn, newCanonicalEncoder(conn), dec.Decode)
+	}
+	return &httpServerCodec{jsonCodec: NewCodec(conn).(*jsonCodec), conn: conn}
+}
+
+// httpServerCodec is the codec of a HTTP request whose streamed results are
+// written to the response incrementally.
+type httpServerCodec struct {
+	*jsonCodec
+	conn *httpServerConn
 }
 
 // Close does nothing and always returns nil.
@@ -247,6 +259,14 @@ func (t *httpServerConn) RemoteAddr() string {
 // SetWriteDeadline does nothing and always returns nil.
 func (t *httpServerConn) SetWriteDeadline(time.Time) error { return nil }
 
+// Flush sends the response written so far to the client, if the response
+// writer supports it.
+func (t *httpServerConn) Flush() {
+	if flusher, ok := t.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // ServeHTTP serves JSON-RPC requests over HTTP.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Permit dumb empty requests for remote health-checks (AWS)
@@ -265,6 +285,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	connInfo.HTTP.Host = r.Host
 	connInfo.HTTP.Origin = r.Header.Get("Origin")
 	connInfo.HTTP.UserAgent = r.Header.Get("User-Agent")
+	connInfo.HTTP.ForwardedFor = r.Header.Get("X-Forwarded-For")
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, peerInfoContextKey{}, connInfo)
 	// All checks passed, create a codec that reads directly from the request body
@@ -27,6 +27,7 @@
 package rpc
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -208,3 +209,83 @@ func TestHTTPPeerInfo(t *testing.T) {
 		t.Errorf("wrong HTTP.Origin %q", info.HTTP.UserAgent)
 	}
 }
+
+func TestHTTPCanonicalResponses(t *testing.T) {
+	newTestHTTPServer := func() *httptest.Server {
+		s := newTestServer()
+		t.Cleanup(s.Stop)
+		ts := httptest.NewServer(s)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	post := func(url string, header http.Header, body string) string {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		req.Header.Set("content-type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(respBody)
+	}
+
+	var (
+		servers = []*httptest.Server{newTestHTTPServer(), newTestHTTPServer()}
+		call    = `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["0xABcd",1,{"S":"0XFF"}]}`
+		batch   = `[` + call + `,{"jsonrpc":"2.0","id":2,"method":"test_returnError"}]`
+	)
+	tests := []struct {
+		name     string
+		query    string
+		header   http.Header
+		body     string
+		expected string
+	}{
+		{
+			name:     "header",
+			header:   http.Header{canonicalHeader: []string{"true"}},
+			body:     call,
+			expected: `{"id":1,"jsonrpc":"2.0","result":{"Args":{"S":"0xff"},"Int":1,"String":"0xabcd"}}`,
+		},
+		{
+			name:     "query parameter",
+			query:    "?" + canonicalQueryParam + "=1",
+			header:   http.Header{},
+			body:     call,
+			expected: `{"id":1,"jsonrpc":"2.0","result":{"Args":{"S":"0xff"},"Int":1,"String":"0xabcd"}}`,
+		},
+		{
+			name:   "batch",
+			header: http.Header{canonicalHeader: []string{"true"}},
+			body:   batch,
+			expected: `[{"id":1,"jsonrpc":"2.0","result":{"Args":{"S":"0xff"},"Int":1,"String":"0xabcd"}},` +
+				`{"error":{"code":444,"data":"testError data","message":"testError"},"id":2,"jsonrpc":"2.0"}]`,
+		},
+		{
+			name:     "disabled",
+			header:   http.Header{canonicalHeader: []string{"false"}},
+			body:     call,
+			expected: `{"jsonrpc":"2.0","id":1,"result":{"String":"0xABcd","Int":1,"Args":{"S":"0XFF"}}}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The responses are byte-identical across calls and servers
+			for i := 0; i < 3; i++ {
+				for _, ts := range servers {
+					if resp := post(ts.URL+test.query, test.header.Clone(), test.body); resp != test.expected {
+						t.Fatalf("Expected response %s, found %s", test.expected, resp)
+					}
+				}
+			}
+		})
+	}
+}
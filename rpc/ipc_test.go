@@ -0,0 +1,101 @@
+// (c) 2019-2020, Ava Labs, Inc.
+//
+// This file is a derived work, based on the go-ethereum library whose original
+// notices appear below.
+//
+// It is distributed under a license compatible with the licensing terms of the
+// original code from which it is derived.
+//
+// Much love to the original authors for their work.
+// **********
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPC(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "test.sock")
+	server := newTestServer()
+	defer server.Stop()
+
+	l, err := ListenIPC(endpoint, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeListener(l)
+
+	// The socket is in use, so it must not be replaced
+	if _, err := ListenIPC(endpoint, 0o600); !errors.Is(err, errIPCInUse) {
+		t.Fatalf("expected %v, found %v", errIPCInUse, err)
+	}
+	client, err := DialIPC(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if result.String != "hello" || result.Int != 10 || result.Args.S != "world" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	client.Close()
+	l.Close()
+	if _, err := os.Stat(endpoint); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed once closed, found %v", err)
+	}
+}
+
+func TestIPCStaleSocket(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "test.sock")
+	stale, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := ListenIPC(endpoint, 0o600)
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, found %v", err)
+	}
+	l.Close()
+}
+
+func TestIPCNotSocket(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "test.sock")
+	if err := os.WriteFile(endpoint, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenIPC(endpoint, 0o600); err == nil {
+		t.Fatal("expected a file that is not a socket to be left in place")
+	}
+	if _, err := os.Stat(endpoint); err != nil {
+		t.Fatal(err)
+	}
+}
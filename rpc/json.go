@@ -54,6 +54,7 @@ var null = json.RawMessage("null")
 type subscriptionResult struct {
 	ID     string          `json:"subscription"`
 	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonError      `json:"error,omitempty"` // set if the server terminated the subscription
 }
 
 // A value of this type can a JSON-RPC request, notification, successful response or
@@ -65,6 +66,8 @@ type jsonrpcMessage struct {
 	Params  json.RawMessage `json:"params,omitempty"`
 	Error   *jsonError      `json:"error,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
+
+	stream StreamedResult // Result of a response encoded when it is written
 }
 
 func (msg *jsonrpcMessage) isNotification() bool {
@@ -300,8 +303,10 @@ func isBatch(raw json.RawMessage) bool {
 
 // parsePositionalArguments tries to parse the given args to an array of values with the
 // given types. It returns the parsed values or an error when the args could not be
-// parsed. Missing optional arguments are returned as reflect.Zero values.
-func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]reflect.Value, error) {
+// parsed. Missing optional arguments are returned as reflect.Zero values. The
+// quantities of the args are canonicalized, or rejected if not canonical and
+// [strictQuantities].
+func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type, strictQuantities bool) ([]reflect.Value, error) {
 	dec := json.NewDecoder(bytes.NewReader(rawArgs))
 	var args []reflect.Value
 	tok, err := dec.Token()
@@ -313,7 +318,7 @@ func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]
 		return nil, err
 	case tok == json.Delim('['):
 		// Read argument array.
-		if args, err = parseArgumentArray(dec, types); err != nil {
+		if args, err = parseArgumentArray(dec, types, strictQuantities); err != nil {
 			return nil, err
 		}
 	default:
@@ -329,14 +334,22 @@ func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]
 	return args, nil
 }
 
-func parseArgumentArray(dec *json.Decoder, types []reflect.Type) ([]reflect.Value, error) {
+func parseArgumentArray(dec *json.Decoder, types []reflect.Type, strictQuantities bool) ([]reflect.Value, error) {
 	args := make([]reflect.Value, 0, len(types))
 	for i := 0; dec.More(); i++ {
 		if i >= len(types) {
 			return args, fmt.Errorf("too many arguments, want at most %d", len(types))
 		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return args, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
+		raw, err := canonicalizeQuantities(raw, types[i], strictQuantities)
+		if err != nil {
+			return args, fmt.Errorf("invalid argument %d: %v", i, err)
+		}
 		argval := reflect.New(types[i])
-		if err := dec.Decode(argval.Interface()); err != nil {
+		if err := json.Unmarshal(raw, argval.Interface()); err != nil {
 			return args, fmt.Errorf("invalid argument %d: %v", i, err)
 		}
 		if argval.IsNil() && types[i].Kind() != reflect.Ptr {
@@ -37,6 +37,8 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+
+	wsNotificationBufferExceededCounter = metrics.NewRegisteredCounter("rpc/ws/notification_buffer_exceeded", nil)
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -0,0 +1,249 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	blockNumberType       = reflect.TypeOf(BlockNumber(0))
+	blockNumberOrHashType = reflect.TypeOf(BlockNumberOrHash{})
+
+	// quantityTypes are the argument types holding a quantity, decoded from a
+	// 0x-prefixed hex string without leading zero digits.
+	quantityTypes = map[reflect.Type]bool{
+		reflect.TypeOf(hexutil.Uint64(0)): true,
+		reflect.TypeOf(hexutil.Uint(0)):   true,
+		reflect.TypeOf(hexutil.Big{}):     true,
+		blockNumberType:                   true,
+	}
+
+	// quantityHolders caches whether the values of a type may hold a
+	// quantity.
+	quantityHolders sync.Map // reflect.Type -> bool
+)
+
+// canonicalizeQuantities returns [raw], the JSON encoding of a value of type
+// [typ], with its quantities in the canonical 0x-prefixed hex form. If
+// [strict], the quantities with leading zero digits or in decimal are
+// rejected instead. The errors name the field of the quantity.
+func canonicalizeQuantities(raw json.RawMessage, typ reflect.Type, strict bool) (json.RawMessage, error) {
+	if !holdsQuantities(typ) {
+		return raw, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		// The error is reported by the decoding into [typ]
+		return raw, nil
+	}
+	value, changed, err := canonicalizeValue(value, typ, "", strict)
+	if err != nil || !changed {
+		return raw, err
+	}
+	return json.Marshal(value)
+}
+
+// holdsQuantities returns whether the values of [typ] may hold a quantity.
+func holdsQuantities(typ reflect.Type) bool {
+	if holds, ok := quantityHolders.Load(typ); ok {
+		return holds.(bool)
+	}
+	holds := holdsQuantitiesVisiting(typ, make(map[reflect.Type]bool))
+	quantityHolders.Store(typ, holds)
+	return holds
+}
+
+func holdsQuantitiesVisiting(typ reflect.Type, visiting map[reflect.Type]bool) bool {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if quantityTypes[typ] || typ == blockNumberOrHashType {
+		return true
+	}
+	if visiting[typ] {
+		return false
+	}
+	visiting[typ] = true
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return holdsQuantitiesVisiting(typ.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if field := typ.Field(i); field.IsExported() && holdsQuantitiesVisiting(field.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canonicalizeValue canonicalizes the quantities of [value], decoded from
+// JSON, to be decoded into [typ], at [path]. It returns whether [value]
+// changed.
+func canonicalizeValue(value interface{}, typ reflect.Type, path string, strict bool) (interface{}, bool, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if quantityTypes[typ] {
+		return canonicalizeQuantity(value, typ == blockNumberType, path, strict)
+	}
+	if typ == blockNumberOrHashType {
+		if s, ok := value.(string); ok && len(s) == 2+2*len(BlockNumberOrHash{}.BlockHash) {
+			// A block hash
+			return value, false, nil
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return canonicalizeQuantity(value, true, path, strict)
+		}
+	}
+
+	switch value := value.(type) {
+	case []interface{}:
+		if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+			return value, false, nil
+		}
+		var changed bool
+		for i, elem := range value {
+			canonical, elemChanged, err := canonicalizeValue(elem, typ.Elem(), fmt.Sprintf("%s[%d]", path, i), strict)
+			if err != nil {
+				return nil, false, err
+			}
+			value[i], changed = canonical, changed || elemChanged
+		}
+		return value, changed, nil
+	case map[string]interface{}:
+		var changed bool
+		for key, elem := range value {
+			var elemType reflect.Type
+			switch typ.Kind() {
+			case reflect.Map:
+				elemType = typ.Elem()
+			case reflect.Struct:
+				elemType = fieldType(typ, key)
+			}
+			if elemType == nil {
+				continue
+			}
+			elemPath := key
+			if path != "" {
+				elemPath = path + "." + key
+			}
+			canonical, elemChanged, err := canonicalizeValue(elem, elemType, elemPath, strict)
+			if err != nil {
+				return nil, false, err
+			}
+			value[key], changed = canonical, changed || elemChanged
+		}
+		return value, changed, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// fieldType returns the type of the field of the struct [typ] decoded from
+// the JSON [key], matched as encoding/json does, or nil if there is none.
+func fieldType(typ reflect.Type, key string) reflect.Type {
+	var folded reflect.Type
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			} else if field.Anonymous {
+				name = ""
+			}
+		} else if field.Anonymous {
+			name = ""
+		}
+		if name == "" {
+			// The fields of an embedded struct are promoted
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if promoted := fieldType(embedded, key); promoted != nil && folded == nil {
+					folded = promoted
+				}
+			}
+			continue
+		}
+		if name == key {
+			return field.Type
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = field.Type
+		}
+	}
+	return folded
+}
+
+// canonicalizeQuantity canonicalizes the quantity [value] at [path]. The
+// block tags are accepted if [blockNumber]. The values that are neither hex
+// nor decimal quantities are left to the decoding of their type to reject.
+func canonicalizeQuantity(value interface{}, blockNumber bool, path string, strict bool) (interface{}, bool, error) {
+	var form string
+	var digits string
+	switch value := value.(type) {
+	case string:
+		switch {
+		case blockNumber && (value == "earliest" || value == "latest" || value == "pending" || value == "accepted"):
+			return value, false, nil
+		case strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X"):
+			hex := value[2:]
+			if len(hex) <= 1 || hex[0] != '0' {
+				return value, false, nil
+			}
+			trimmed := strings.TrimLeft(hex, "0")
+			if trimmed == "" {
+				trimmed = "0"
+			}
+			if strict {
+				return nil, false, quantityError(path, value, "has leading zero digits")
+			}
+			return value[:2] + trimmed, true, nil
+		default:
+			form, digits = "decimal string", value
+		}
+	case json.Number:
+		form, digits = "JSON number", value.String()
+	default:
+		return value, false, nil
+	}
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok || n.Sign() < 0 {
+		return value, false, nil
+	}
+	if strict {
+		return nil, false, quantityError(path, value, fmt.Sprintf("is a %s, 0x-prefixed hex required", form))
+	}
+	return hexutil.EncodeBig(n), true, nil
+}
+
+// quantityError returns the error of the non-canonical quantity [value] at
+// [path].
+func quantityError(path string, value interface{}, reason string) error {
+	if path == "" {
+		return fmt.Errorf("quantity %q %s", fmt.Sprint(value), reason)
+	}
+	return fmt.Errorf("field %q: quantity %q %s", path, fmt.Sprint(value), reason)
+}
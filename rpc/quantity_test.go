@@ -0,0 +1,259 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestCanonicalizeQuantities(t *testing.T) {
+	type args struct {
+		Gas      *hexutil.Uint64 `json:"gas"`
+		Value    *hexutil.Big    `json:"value"`
+		Data     *hexutil.Bytes  `json:"data"`
+		Nonces   []hexutil.Uint  `json:"nonces"`
+		Ignored  string          `json:"ignored"`
+		Untagged *hexutil.Uint64
+	}
+	tests := []struct {
+		name        string
+		input       string
+		typ         reflect.Type
+		lenient     string
+		strictError string
+	}{
+		{
+			name:    "canonical",
+			input:   `{"gas":"0x10","value":"0x0","data":"0x0001","nonces":["0x1"],"ignored":"010"}`,
+			typ:     reflect.TypeOf(args{}),
+			lenient: `{"gas":"0x10","value":"0x0","data":"0x0001","nonces":["0x1"],"ignored":"010"}`,
+		},
+		{
+			name:        "leading zero digits",
+			input:       `{"gas":"0x0010"}`,
+			typ:         reflect.TypeOf(&args{}),
+			lenient:     `{"gas":"0x10"}`,
+			strictError: `field "gas": quantity "0x0010" has leading zero digits`,
+		},
+		{
+			name:        "zero with leading zero digits",
+			input:       `{"value":"0x00"}`,
+			typ:         reflect.TypeOf(args{}),
+			lenient:     `{"value":"0x0"}`,
+			strictError: `field "value": quantity "0x00" has leading zero digits`,
+		},
+		{
+			name:        "decimal string",
+			input:       `{"nonces":["0x1","21"]}`,
+			typ:         reflect.TypeOf(args{}),
+			lenient:     `{"nonces":["0x1","0x15"]}`,
+			strictError: `field "nonces[1]": quantity "21" is a decimal string`,
+		},
+		{
+			name:        "JSON number",
+			input:       `{"Gas":21000}`,
+			typ:         reflect.TypeOf(args{}),
+			lenient:     `{"Gas":"0x5208"}`,
+			strictError: `field "Gas": quantity "21000" is a JSON number`,
+		},
+		{
+			name:        "untagged field",
+			input:       `{"untagged":"0x01"}`,
+			typ:         reflect.TypeOf(args{}),
+			lenient:     `{"untagged":"0x1"}`,
+			strictError: `field "untagged"`,
+		},
+		{
+			name:        "block number",
+			input:       `"0x01"`,
+			typ:         reflect.TypeOf(BlockNumber(0)),
+			lenient:     `"0x1"`,
+			strictError: `quantity "0x01" has leading zero digits`,
+		},
+		{
+			name:    "block tag",
+			input:   `"accepted"`,
+			typ:     reflect.TypeOf(BlockNumberOrHash{}),
+			lenient: `"accepted"`,
+		},
+		{
+			name:    "block hash",
+			input:   `"0x0000000000000000000000000000000000000000000000000000000000000001"`,
+			typ:     reflect.TypeOf(BlockNumberOrHash{}),
+			lenient: `"0x0000000000000000000000000000000000000000000000000000000000000001"`,
+		},
+		{
+			name:        "block number or hash",
+			input:       `{"blockNumber":"16"}`,
+			typ:         reflect.TypeOf(BlockNumberOrHash{}),
+			lenient:     `{"blockNumber":"0x10"}`,
+			strictError: `field "blockNumber": quantity "16" is a decimal string`,
+		},
+		{
+			name:        "map",
+			input:       `{"a":"0x01"}`,
+			typ:         reflect.TypeOf(map[string]hexutil.Uint64{}),
+			lenient:     `{"a":"0x1"}`,
+			strictError: `field "a"`,
+		},
+		{
+			name:    "invalid left to the unmarshalers",
+			input:   `{"gas":"0xzz","value":"-1","nonces":[1.5]}`,
+			typ:     reflect.TypeOf(args{}),
+			lenient: `{"gas":"0xzz","value":"-1","nonces":[1.5]}`,
+		},
+		{
+			name:    "no quantities",
+			input:   `"0x01"`,
+			typ:     reflect.TypeOf(""),
+			lenient: `"0x01"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lenient, err := canonicalizeQuantities([]byte(test.input), test.typ, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(lenient) != test.lenient {
+				t.Fatalf("Expected %s to be canonicalized to %s, found %s", test.input, test.lenient, lenient)
+			}
+
+			strict, err := canonicalizeQuantities([]byte(test.input), test.typ, true)
+			if test.strictError == "" {
+				if err != nil || string(strict) != test.input {
+					t.Fatalf("Expected %s to be accepted unchanged, found %s (%v)", test.input, strict, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.strictError) {
+				t.Fatalf("Expected %s to be rejected with %q, found %v", test.input, test.strictError, err)
+			}
+		})
+	}
+}
+
+// quantityService has methods of the argument shapes of the eth API, which
+// return their decoded arguments.
+type quantityService struct{}
+
+type quantityCallArgs struct {
+	From  *common.Address `json:"from"`
+	To    *common.Address `json:"to"`
+	Gas   *hexutil.Uint64 `json:"gas"`
+	Value *hexutil.Big    `json:"value"`
+}
+
+func (s *quantityService) GetBlockByNumber(number BlockNumber, fullTx bool) []interface{} {
+	return []interface{}{number, fullTx}
+}
+
+func (s *quantityService) GetBalance(address common.Address, blockNrOrHash BlockNumberOrHash) []interface{} {
+	return []interface{}{address, blockNrOrHash}
+}
+
+func (s *quantityService) EstimateGas(args quantityCallArgs) quantityCallArgs {
+	return args
+}
+
+func (s *quantityService) Call(args quantityCallArgs, blockNrOrHash BlockNumberOrHash) []interface{} {
+	return []interface{}{args, blockNrOrHash}
+}
+
+// TestQuantityConformance calls methods with quantities with leading zero
+// digits and in decimal, and checks that they are canonicalized by default,
+// with the results of the canonical quantities, and rejected with an invalid
+// params error naming the field in strict mode.
+func TestQuantityConformance(t *testing.T) {
+	address := common.Address{1}.Hex()
+	calls := []struct {
+		method      string
+		canonical   string
+		malformed   []string
+		strictError string
+	}{
+		{
+			method:      "test_getBlockByNumber",
+			canonical:   `["0x1", false]`,
+			malformed:   []string{`["0x01", false]`, `["1", false]`, `[1, false]`},
+			strictError: "invalid argument 0: quantity",
+		},
+		{
+			method:      "test_getBalance",
+			canonical:   fmt.Sprintf(`["%s", "0x1"]`, address),
+			malformed:   []string{fmt.Sprintf(`["%s", "0x0001"]`, address), fmt.Sprintf(`["%s", {"blockNumber": "1"}]`, address)},
+			strictError: "invalid argument 1:",
+		},
+		{
+			method:      "test_estimateGas",
+			canonical:   fmt.Sprintf(`[{"from": "%s", "to": "%s", "value": "0x10", "gas": "0x5208"}]`, address, address),
+			malformed:   []string{fmt.Sprintf(`[{"from": "%s", "to": "%s", "value": "16", "gas": 21000}]`, address, address)},
+			strictError: `invalid argument 0: field "`,
+		},
+		{
+			method:      "test_call",
+			canonical:   fmt.Sprintf(`[{"from": "%s", "to": "%s", "value": "0x10"}, "0x1"]`, address, address),
+			malformed:   []string{fmt.Sprintf(`[{"from": "%s", "to": "%s", "value": "0x0010"}, "0x1"]`, address, address)},
+			strictError: `invalid argument 0: field "value": quantity "0x0010" has leading zero digits`,
+		},
+	}
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			server := NewServer(0)
+			defer server.Stop()
+			server.SetStrictQuantities(strict)
+			if err := server.RegisterName("test", new(quantityService)); err != nil {
+				t.Fatal(err)
+			}
+			client := DialInProc(server)
+			defer client.Close()
+
+			// call calls [method] with the JSON array [params] as its arguments
+			call := func(result *json.RawMessage, method, params string) error {
+				var args []json.RawMessage
+				if err := json.Unmarshal([]byte(params), &args); err != nil {
+					t.Fatal(err)
+				}
+				var argValues []interface{}
+				for _, arg := range args {
+					argValues = append(argValues, arg)
+				}
+				return client.Call(result, method, argValues...)
+			}
+
+			for _, test := range calls {
+				var expected json.RawMessage
+				if err := call(&expected, test.method, test.canonical); err != nil {
+					t.Fatalf("%s(%s) failed: %s", test.method, test.canonical, err)
+				}
+				for _, params := range test.malformed {
+					var got json.RawMessage
+					err := call(&got, test.method, params)
+					if !strict {
+						if err != nil {
+							t.Fatalf("Expected %s(%s) to be canonicalized, found %s", test.method, params, err)
+						}
+						if string(got) != string(expected) {
+							t.Fatalf("Expected %s(%s) to return %s, found %s", test.method, params, expected, got)
+						}
+						continue
+					}
+					var rpcErr Error
+					if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32602 || !strings.Contains(err.Error(), test.strictError) {
+						t.Fatalf("Expected %s(%s) to be rejected with %q, found %v", test.method, params, test.strictError, err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -57,7 +57,7 @@ type Server struct {
 	idgen           func() ID
 	run             int32
 	codecs          mapset.Set
-	maximumDuration time.Duration
+	maximumDuration int64 // time.Duration, accessed atomically
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -70,7 +70,7 @@ func NewServer(maximumDuration time.Duration) *Server {
 		idgen:           randomIDGenerator(),
 		codecs:          mapset.NewSet(),
 		run:             1,
-		maximumDuration: maximumDuration,
+		maximumDuration: int64(maximumDuration),
 	}
 	// Register the default service providing meta information about the RPC service such
 	// as the services and methods it offers.
@@ -87,6 +87,74 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// RegisterNameWithFilter is like RegisterName, but only exposes the methods and
+// subscriptions of [receiver] for which [allowed] returns true. The names passed
+// to [allowed] are the method names as seen by clients without the namespace,
+// e.g. "getLogs" for eth_getLogs.
+func (s *Server) RegisterNameWithFilter(name string, receiver interface{}, allowed func(method string) bool) error {
+	return s.services.registerNameWithFilter(name, receiver, allowed)
+}
+
+// SetGate sets [gate] to be called with the full method name, e.g.
+// "eth_getLogs", before each method call and subscription. If [gate] returns an
+// error, the call fails with it without being executed. Unsubscriptions are
+// never gated.
+func (s *Server) SetGate(gate func(method string) error) {
+	s.services.setGate(gate)
+}
+
+// SetStrictQuantities sets whether the quantities of the method arguments
+// that are not canonical 0x-prefixed hex, with leading zero digits or in
+// decimal, are rejected. By default, they are canonicalized.
+func (s *Server) SetStrictQuantities(strict bool) {
+	s.services.setStrictQuantities(strict)
+}
+
+// SetMaximumDuration sets the maximum duration of the incoming HTTP requests,
+// as passed to [NewServer], for the requests received from then on.
+func (s *Server) SetMaximumDuration(maximumDuration time.Duration) {
+	atomic.StoreInt64(&s.maximumDuration, int64(maximumDuration))
+}
+
+// ReplaceServices atomically replaces the services of the server, except for
+// its own [MetadataApi] service, with those registered to [src], which should
+// not be served itself. Calls received from then on are served by the new
+// services, while the subscriptions that are no longer provided are
+// terminated with an error sent to their clients.
+//
+// ReplaceServices waits for the calls in flight on the replaced services to
+// complete, or returns ctx.Err() if [ctx] is done first, in which case they
+// still complete in the background.
+func (s *Server) ReplaceServices(ctx context.Context, src *Server) error {
+	src.services.mu.Lock()
+	services := make(map[string]service, len(src.services.services))
+	for name, svc := range src.services.services {
+		services[name] = svc
+	}
+	src.services.mu.Unlock()
+
+	s.services.mu.Lock()
+	services[MetadataApi] = s.services.services[MetadataApi]
+	s.services.mu.Unlock()
+
+	calls, handlers := s.services.replace(services)
+	for _, h := range handlers {
+		h.terminateRemovedSubscriptions()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		calls.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
@@ -119,7 +187,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 	}
 
 	h := newHandler(ctx, codec, s.idgen, &s.services)
-	h.deadlineContext = s.maximumDuration
+	h.deadlineContext = time.Duration(atomic.LoadInt64(&s.maximumDuration))
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
@@ -189,6 +257,9 @@ type PeerInfo struct {
 		UserAgent string
 		Origin    string
 		Host      string
+		// ForwardedFor is the X-Forwarded-For header set by the proxies
+		// between the client and the server.
+		ForwardedFor string
 	}
 }
 
@@ -28,6 +28,8 @@ package rpc
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net"
@@ -60,6 +62,132 @@ func TestServerRegisterName(t *testing.T) {
 	}
 }
 
+func TestServerRegisterNameWithFilter(t *testing.T) {
+	server := NewServer(0)
+	service := new(testService)
+
+	allowed := map[string]bool{"echo": true, "subscription": true}
+	if err := server.RegisterNameWithFilter("test", service, func(method string) bool { return allowed[method] }); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	svc, ok := server.services.services["test"]
+	if !ok {
+		t.Fatalf("Expected service test to be registered")
+	}
+	if len(svc.callbacks) != 1 || svc.callbacks["echo"] == nil {
+		t.Errorf("Expected only the echo callback to be registered, got %v", svc.callbacks)
+	}
+	if len(svc.subscriptions) != 1 || svc.subscriptions["subscription"] == nil {
+		t.Errorf("Expected only the subscription callback to be registered, got %v", svc.subscriptions)
+	}
+
+	if err := server.RegisterNameWithFilter("none", service, func(string) bool { return false }); err == nil {
+		t.Fatal("Expected registering a service with no allowed methods to fail")
+	}
+}
+
+func TestServerGate(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var gated []string
+	server.SetGate(func(method string) error {
+		if method == "test_echo" {
+			return nil
+		}
+		gated = append(gated, method)
+		return errors.New("gated")
+	})
+	var echo echoResult
+	if err := client.Call(&echo, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	var rets string
+	if err := client.Call(&rets, "test_rets"); err == nil || err.Error() != "gated" {
+		t.Fatalf("Expected the gated call to fail, got %v", err)
+	}
+	if len(gated) != 1 || gated[0] != "test_rets" {
+		t.Fatalf("Expected the gate to be called with test_rets, got %v", gated)
+	}
+
+	server.SetGate(nil)
+	if err := client.Call(&rets, "test_rets"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerReplaceServices(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	notifications := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", notifications, "someSubscription", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slept := make(chan error, 1)
+	go func() { slept <- client.Call(nil, "test_sleep", 300*time.Millisecond) }()
+	time.Sleep(100 * time.Millisecond)
+
+	// Only the test service is served from then on, once the call in flight
+	// is completed
+	replacement := NewServer(0)
+	if err := replacement.RegisterName("test", new(testService)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := server.ReplaceServices(context.Background(), replacement); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("Expected to wait for the call in flight, returned after %v", elapsed)
+	}
+	if err := <-slept; err != nil {
+		t.Fatalf("Expected the call in flight to complete, got %v", err)
+	}
+	select {
+	case err := <-sub.Err():
+		if err == nil || !strings.Contains(err.Error(), "no longer served") {
+			t.Fatalf("Expected the subscription to be terminated, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the subscription to be terminated")
+	}
+
+	var echo int
+	if err := client.Call(&echo, "nftest_echo", 1); err == nil {
+		t.Fatal("Expected the calls of the removed service to fail")
+	}
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	var modules map[string]string
+	if err := client.Call(&modules, "rpc_modules"); err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 2 || modules["test"] == "" || modules[MetadataApi] == "" {
+		t.Fatalf("Unexpected modules %v", modules)
+	}
+
+	// Waiting for the calls in flight is bounded by the context
+	go func() { slept <- client.Call(nil, "test_sleep", 300*time.Millisecond) }()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.ReplaceServices(ctx, replacement); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := <-slept; err != nil {
+		t.Fatalf("Expected the call in flight to complete, got %v", err)
+	}
+}
+
 func TestServer(t *testing.T) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
@@ -49,6 +49,10 @@ var (
 type serviceRegistry struct {
 	mu       sync.Mutex
 	services map[string]service
+	gate     func(method string) error // checks the calls before they are executed
+	strict   bool                      // rejects the non-canonical quantities
+	calls    *sync.WaitGroup           // calls in flight on the current services
+	handlers map[*handler]struct{}     // handlers holding server subscriptions
 }
 
 // service represents a registered object.
@@ -69,11 +73,24 @@ type callback struct {
 }
 
 func (r *serviceRegistry) registerName(name string, rcvr interface{}) error {
+	return r.registerNameWithFilter(name, rcvr, nil)
+}
+
+// registerNameWithFilter registers the methods and subscriptions of [rcvr] for
+// which [allowed] returns true. If [allowed] is nil, all of them are registered.
+func (r *serviceRegistry) registerNameWithFilter(name string, rcvr interface{}, allowed func(method string) bool) error {
 	rcvrVal := reflect.ValueOf(rcvr)
 	if name == "" {
 		return fmt.Errorf("no service name for type %s", rcvrVal.Type().String())
 	}
 	callbacks := suitableCallbacks(rcvrVal)
+	if allowed != nil {
+		for method := range callbacks {
+			if !allowed(method) {
+				delete(callbacks, method)
+			}
+		}
+	}
 	if len(callbacks) == 0 {
 		return fmt.Errorf("service %T doesn't have any suitable methods/subscriptions to expose", rcvr)
 	}
@@ -113,6 +130,96 @@ func (r *serviceRegistry) callback(method string) *callback {
 	return r.services[elem[0]].callbacks[elem[1]]
 }
 
+// acquireCallback returns the callback corresponding to the given RPC method
+// name, like [callback], and the function to call once the call is completed,
+// which is tracked as in flight on the current services until then.
+func (r *serviceRegistry) acquireCallback(method string) (*callback, func()) {
+	elem := strings.SplitN(method, serviceMethodSeparator, 2)
+	if len(elem) != 2 {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb := r.services[elem[0]].callbacks[elem[1]]
+	if cb == nil {
+		return nil, nil
+	}
+	if r.calls == nil {
+		r.calls = new(sync.WaitGroup)
+	}
+	r.calls.Add(1)
+	return cb, r.calls.Done
+}
+
+// replace replaces the services of the registry with [services]. Returns the
+// calls in flight on the replaced services and the handlers holding server
+// subscriptions.
+func (r *serviceRegistry) replace(services map[string]service) (*sync.WaitGroup, []*handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.services = services
+	calls := r.calls
+	if calls == nil {
+		calls = new(sync.WaitGroup)
+	}
+	r.calls = new(sync.WaitGroup)
+	handlers := make([]*handler, 0, len(r.handlers))
+	for h := range r.handlers {
+		handlers = append(handlers, h)
+	}
+	return calls, handlers
+}
+
+// trackHandler records that [h] holds server subscriptions.
+func (r *serviceRegistry) trackHandler(h *handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.handlers == nil {
+		r.handlers = make(map[*handler]struct{})
+	}
+	r.handlers[h] = struct{}{}
+}
+
+// untrackHandler records that [h] is closed.
+func (r *serviceRegistry) untrackHandler(h *handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.handlers, h)
+}
+
+// setGate sets the function checking the calls before they are executed.
+func (r *serviceRegistry) setGate(gate func(method string) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gate = gate
+}
+
+// checkGate returns the error of the gate for a call of [method], if any.
+func (r *serviceRegistry) checkGate(method string) error {
+	r.mu.Lock()
+	gate := r.gate
+	r.mu.Unlock()
+	if gate == nil {
+		return nil
+	}
+	return gate(method)
+}
+
+// setStrictQuantities sets whether the non-canonical quantities are rejected.
+func (r *serviceRegistry) setStrictQuantities(strict bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strict = strict
+}
+
+// strictQuantities returns whether the non-canonical quantities are rejected.
+func (r *serviceRegistry) strictQuantities() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.strict
+}
+
 // subscription returns a subscription callback in the given service.
 func (r *serviceRegistry) subscription(service, name string) *callback {
 	r.mu.Lock()
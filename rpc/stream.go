@@ -0,0 +1,290 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is the size of the encoding of a streamed result that is
+// buffered before being written to the connection. A result failing before
+// this size is reached is answered with an error response.
+const streamChunkSize = 256 * 1024
+
+var (
+	errStreamIncomplete = errors.New("streamed result is incomplete")
+	errStreamMisuse     = errors.New("invalid use of the stream encoder")
+)
+
+// StreamedResult is the result of a method that is encoded incrementally into
+// the response while it is produced, instead of being held in memory until it
+// is complete, for the results too large to be buffered.
+//
+// The function is called once by the server with an encoder it must write
+// exactly one JSON value with. The results of single HTTP requests are written
+// to the response in chunks of the encoding as it grows, and the results of
+// batches and of the other transports are buffered. If the function fails
+// once part of the result was written, the response is terminated without
+// completing its JSON document, so that the client sees it is invalid.
+type StreamedResult func(enc *StreamEncoder) error
+
+// StreamEncoder writes the JSON encoding of a StreamedResult. Arrays and
+// objects are written by opening them, writing their elements, or their keys
+// each followed by a value, and closing them. Values are written with the
+// JSON encoding of Go values.
+type StreamEncoder struct {
+	w      io.Writer
+	scopes []streamScope // Open arrays and objects, innermost last
+	done   bool          // Whether the top-level value was written
+	err    error         // First error, after which nothing is written
+}
+
+type streamScope struct {
+	object  bool // Whether the scope is an object rather than an array
+	started bool // Whether the scope has an element
+	keyed   bool // Whether the key of the next value of an object was written
+}
+
+func newStreamEncoder(w io.Writer) *StreamEncoder {
+	return &StreamEncoder{w: w}
+}
+
+// BeginArray opens an array, as the next value.
+func (e *StreamEncoder) BeginArray() error {
+	if err := e.beginValue(); err != nil {
+		return err
+	}
+	e.scopes = append(e.scopes, streamScope{})
+	return e.write([]byte{'['})
+}
+
+// EndArray closes the innermost array.
+func (e *StreamEncoder) EndArray() error {
+	return e.end(false, ']')
+}
+
+// BeginObject opens an object, as the next value.
+func (e *StreamEncoder) BeginObject() error {
+	if err := e.beginValue(); err != nil {
+		return err
+	}
+	e.scopes = append(e.scopes, streamScope{object: true})
+	return e.write([]byte{'{'})
+}
+
+// EndObject closes the innermost object.
+func (e *StreamEncoder) EndObject() error {
+	return e.end(true, '}')
+}
+
+// Key writes the key of the next value of the innermost object.
+func (e *StreamEncoder) Key(key string) error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.scopes) == 0 {
+		return e.fail(errStreamMisuse)
+	}
+	scope := &e.scopes[len(e.scopes)-1]
+	if !scope.object || scope.keyed {
+		return e.fail(errStreamMisuse)
+	}
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return e.fail(err)
+	}
+	if scope.started {
+		if err := e.write([]byte{','}); err != nil {
+			return err
+		}
+	}
+	scope.started, scope.keyed = true, true
+	if err := e.write(encoded); err != nil {
+		return err
+	}
+	return e.write([]byte{':'})
+}
+
+// Value writes the JSON encoding of [v] as the next value.
+func (e *StreamEncoder) Value(v interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return e.fail(err)
+	}
+	if err := e.beginValue(); err != nil {
+		return err
+	}
+	return e.write(encoded)
+}
+
+// beginValue writes the separator preceding the next value, failing if no
+// value is expected.
+func (e *StreamEncoder) beginValue() error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.scopes) == 0 {
+		if e.done {
+			return e.fail(errStreamMisuse)
+		}
+		e.done = true
+		return nil
+	}
+	scope := &e.scopes[len(e.scopes)-1]
+	if scope.object {
+		if !scope.keyed {
+			return e.fail(errStreamMisuse)
+		}
+		scope.keyed = false
+		return nil
+	}
+	started := scope.started
+	scope.started = true
+	if started {
+		return e.write([]byte{','})
+	}
+	return nil
+}
+
+func (e *StreamEncoder) end(object bool, delim byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.scopes) == 0 {
+		return e.fail(errStreamMisuse)
+	}
+	if scope := e.scopes[len(e.scopes)-1]; scope.object != object || scope.keyed {
+		return e.fail(errStreamMisuse)
+	}
+	e.scopes = e.scopes[:len(e.scopes)-1]
+	return e.write([]byte{delim})
+}
+
+// finish returns an error if the top-level value is incomplete.
+func (e *StreamEncoder) finish() error {
+	if e.err != nil {
+		return e.err
+	}
+	if !e.done || len(e.scopes) > 0 {
+		return e.fail(errStreamIncomplete)
+	}
+	return nil
+}
+
+func (e *StreamEncoder) write(b []byte) error {
+	if _, err := e.w.Write(b); err != nil {
+		return e.fail(err)
+	}
+	return nil
+}
+
+func (e *StreamEncoder) fail(err error) error {
+	e.err = err
+	return err
+}
+
+// EncodeStream returns the JSON encoding of the result of [stream], buffered
+// in memory as when it is not written to a response incrementally.
+func EncodeStream(stream StreamedResult) (json.RawMessage, error) {
+	if stream == nil {
+		return json.RawMessage("null"), nil
+	}
+	buf := new(bytes.Buffer)
+	enc := newStreamEncoder(buf)
+	if err := stream(enc); err != nil {
+		return nil, err
+	}
+	if err := enc.finish(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// streamConn is a connection a response can be written to incrementally.
+type streamConn interface {
+	io.Writer
+	// Flush sends the data written so far to the peer.
+	Flush()
+}
+
+// streamBuffer buffers the writes to a streamConn up to streamChunkSize.
+type streamBuffer struct {
+	conn    streamConn
+	buf     bytes.Buffer
+	flushed bool // Whether part of the writes was sent to the connection
+}
+
+func (b *streamBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+func (b *streamBuffer) Write(p []byte) (int, error) {
+	b.buf.Write(p)
+	if b.buf.Len() >= streamChunkSize {
+		if err := b.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (b *streamBuffer) flush() error {
+	b.flushed = true
+	if _, err := b.conn.Write(b.buf.Bytes()); err != nil {
+		return err
+	}
+	b.buf.Reset()
+	b.conn.Flush()
+	return nil
+}
+
+// streamWriter is implemented by the connections the streamed results of
+// single calls are written to incrementally.
+type streamWriter interface {
+	writeStream(msg *jsonrpcMessage) error
+}
+
+// writeStream writes the response [msg] holding a streamed result to the
+// connection as it is encoded. If the result fails before streamChunkSize is
+// reached, an error response is written instead. If it fails later, the
+// response is left incomplete and the error is returned.
+func (c *httpServerCodec) writeStream(msg *jsonrpcMessage) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	buf := &streamBuffer{conn: c.conn}
+	buf.WriteString(`{"jsonrpc":"` + vsn + `","id":`)
+	buf.Write(msg.ID)
+	buf.WriteString(`,"result":`)
+	enc := newStreamEncoder(buf)
+	err := msg.stream(enc)
+	if err == nil {
+		err = enc.finish()
+	}
+	if err != nil {
+		if !buf.flushed {
+			return c.encode(msg.errorResponse(err))
+		}
+		return fmt.Errorf("streamed result terminated: %w", err)
+	}
+	buf.WriteString("}\n")
+	return buf.flush()
+}
+
+// bufferStream returns the response [msg] holding a streamed result with the
+// result encoded in memory, or an error response if it fails.
+func (msg *jsonrpcMessage) bufferStream() *jsonrpcMessage {
+	result, err := EncodeStream(msg.stream)
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: result}
+}
@@ -0,0 +1,183 @@
+// (c) 2021, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package rpc
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type streamService struct{}
+
+type streamElement struct {
+	Index int    `json:"index"`
+	Data  string `json:"data"`
+}
+
+// Elements streams [n] elements of [size] bytes of data, failing when the
+// element [failAt] is reached unless it is negative.
+func (s *streamService) Elements(n, size, failAt int) StreamedResult {
+	return func(enc *StreamEncoder) error {
+		if err := enc.BeginObject(); err != nil {
+			return err
+		}
+		if err := enc.Key("elements"); err != nil {
+			return err
+		}
+		if err := enc.BeginArray(); err != nil {
+			return err
+		}
+		data := strings.Repeat("a", size)
+		for i := 0; i < n; i++ {
+			if i == failAt {
+				return errors.New("element unavailable")
+			}
+			if err := enc.Value(streamElement{Index: i, Data: data}); err != nil {
+				return err
+			}
+		}
+		if err := enc.EndArray(); err != nil {
+			return err
+		}
+		if err := enc.Key("count"); err != nil {
+			return err
+		}
+		if err := enc.Value(n); err != nil {
+			return err
+		}
+		return enc.EndObject()
+	}
+}
+
+type streamElements struct {
+	Elements []streamElement `json:"elements"`
+	Count    int             `json:"count"`
+}
+
+func TestStreamEncoder(t *testing.T) {
+	encoded, err := EncodeStream(func(enc *StreamEncoder) error {
+		steps := []func() error{
+			enc.BeginObject,
+			func() error { return enc.Key("a") },
+			enc.BeginArray,
+			func() error { return enc.Value(1) },
+			enc.BeginObject,
+			enc.EndObject,
+			enc.BeginArray,
+			enc.EndArray,
+			func() error { return enc.Value("x") },
+			enc.EndArray,
+			func() error { return enc.Key("b") },
+			func() error { return enc.Value(nil) },
+			enc.EndObject,
+		}
+		for _, step := range steps {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"a":[1,{},[],"x"],"b":null}`; string(encoded) != expected {
+		t.Fatalf("Expected %s, found %s", expected, encoded)
+	}
+
+	misuses := map[string]StreamedResult{
+		"value without key": func(enc *StreamEncoder) error {
+			enc.BeginObject()
+			return enc.Value(1)
+		},
+		"key in array": func(enc *StreamEncoder) error {
+			enc.BeginArray()
+			return enc.Key("a")
+		},
+		"mismatched end": func(enc *StreamEncoder) error {
+			enc.BeginArray()
+			return enc.EndObject()
+		},
+		"second value": func(enc *StreamEncoder) error {
+			enc.Value(1)
+			return enc.Value(2)
+		},
+		"unclosed array": func(enc *StreamEncoder) error {
+			return enc.BeginArray()
+		},
+		"no value": func(enc *StreamEncoder) error {
+			return nil
+		},
+	}
+	for name, stream := range misuses {
+		if _, err := EncodeStream(stream); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestHTTPStreamedResult(t *testing.T) {
+	server := NewServer(0)
+	defer server.Stop()
+	if err := server.RegisterName("stream", new(streamService)); err != nil {
+		t.Fatal(err)
+	}
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+	client, err := DialHTTP(httpsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	inproc := DialInProc(server)
+	defer inproc.Close()
+
+	// A result spanning several chunks is the same as its buffered encoding
+	n, size := 4*streamChunkSize/1024, 1024
+	var streamed, buffered streamElements
+	if err := client.Call(&streamed, "stream_elements", n, size, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := inproc.Call(&buffered, "stream_elements", n, size, -1); err != nil {
+		t.Fatal(err)
+	}
+	if streamed.Count != n || len(streamed.Elements) != n {
+		t.Fatalf("Expected %d elements, found %d", n, len(streamed.Elements))
+	}
+	if !reflect.DeepEqual(streamed, buffered) {
+		t.Fatal("Expected the streamed result to equal the buffered one")
+	}
+
+	// A result failing before its first chunk is answered with an error
+	err = client.Call(&streamed, "stream_elements", n, size, 1)
+	var rpcErr Error
+	if !errors.As(err, &rpcErr) || !strings.Contains(err.Error(), "element unavailable") {
+		t.Fatalf("Expected an error response, found %v", err)
+	}
+
+	// A result failing after its first chunk terminates the response, which
+	// is invalid
+	err = client.Call(&streamed, "stream_elements", n, size, n-1)
+	if err == nil || errors.As(err, &rpcErr) {
+		t.Fatalf("Expected an incomplete response, found %v", err)
+	}
+
+	// The results of batches are buffered, failing with error responses
+	batch := []BatchElem{
+		{Method: "stream_elements", Args: []interface{}{n, size, -1}, Result: new(streamElements)},
+		{Method: "stream_elements", Args: []interface{}{n, size, n - 1}, Result: new(streamElements)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil || !reflect.DeepEqual(*batch[0].Result.(*streamElements), buffered) {
+		t.Fatalf("Expected the buffered result in a batch, found error %v", batch[0].Error)
+	}
+	if !errors.As(batch[1].Error, &rpcErr) {
+		t.Fatalf("Expected an error response in a batch, found %v", batch[1].Error)
+	}
+}
@@ -103,6 +103,7 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 type Notifier struct {
 	h         *handler
 	namespace string
+	name      string
 
 	mu           sync.Mutex
 	sub          *Subscription
@@ -124,7 +125,7 @@ func (n *Notifier) CreateSubscription() *Subscription {
 	} else if n.callReturned {
 		panic("can't create subscription after subscribe call has returned")
 	}
-	n.sub = &Subscription{ID: n.h.idgen(), namespace: n.namespace, err: make(chan error, 1)}
+	n.sub = &Subscription{ID: n.h.idgen(), namespace: n.namespace, name: n.name, err: make(chan error, 1)}
 	return n.sub
 }
 
@@ -184,12 +185,16 @@ func (n *Notifier) activate() error {
 
 func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
-	ctx := context.Background()
-	return n.h.conn.writeJSON(ctx, &jsonrpcMessage{
+	msg := &jsonrpcMessage{
 		Version: vsn,
 		Method:  n.namespace + notificationMethodSuffix,
 		Params:  params,
-	})
+	}
+	if w, ok := n.h.conn.(notificationWriter); ok {
+		return w.writeNotification(msg)
+	}
+	ctx := context.Background()
+	return n.h.conn.writeJSON(ctx, msg)
 }
 
 // A Subscription is created by a notifier and tied to that notifier. The client can use
@@ -197,6 +202,7 @@ func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 type Subscription struct {
 	ID        ID
 	namespace string
+	name      string
 	err       chan error // closed on unsubscribe
 }
 
@@ -210,6 +210,32 @@ func (s *notificationTestService) HangSubscription(ctx context.Context, val int)
 	return subscription, nil
 }
 
+// burstService sends bursts of notifications of [size] bytes, reporting the
+// error stopping each burst on [stopped].
+type burstService struct {
+	size    int
+	stopped chan error
+}
+
+func (s *burstService) Burst(ctx context.Context, n int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	payload := strings.Repeat("x", s.size)
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := notifier.Notify(subscription.ID, payload); err != nil {
+				s.stopped <- err
+				return
+			}
+		}
+		s.stopped <- nil
+	}()
+	return subscription, nil
+}
+
 // largeRespService generates arbitrary-size JSON responses.
 type largeRespService struct {
 	length int
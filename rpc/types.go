@@ -69,17 +69,25 @@ type jsonWriter interface {
 	remoteAddr() string
 }
 
+// notificationWriter is implemented by the connections that account for the
+// notifications of subscriptions apart from the other messages.
+type notificationWriter interface {
+	writeNotification(*jsonrpcMessage) error
+}
+
 type BlockNumber int64
 
 const (
-	AcceptedBlockNumber = BlockNumber(-3)
-	PendingBlockNumber  = BlockNumber(-2)
-	LatestBlockNumber   = BlockNumber(-1)
-	EarliestBlockNumber = BlockNumber(0)
+	FinalizedBlockNumber = BlockNumber(-5)
+	SafeBlockNumber      = BlockNumber(-4)
+	AcceptedBlockNumber  = BlockNumber(-3)
+	PendingBlockNumber   = BlockNumber(-2)
+	LatestBlockNumber    = BlockNumber(-1)
+	EarliestBlockNumber  = BlockNumber(0)
 )
 
 // UnmarshalJSON parses the given JSON fragment into a BlockNumber. It supports:
-// - "latest", "earliest" or "pending" as string arguments
+// - "latest", "earliest", "pending", "accepted", "safe" or "finalized" as string arguments
 // - the block number
 // Returned errors:
 // - an invalid block number error when the given argument isn't a known strings
@@ -103,6 +111,12 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	case "accepted":
 		*bn = AcceptedBlockNumber
 		return nil
+	case "safe":
+		*bn = SafeBlockNumber
+		return nil
+	case "finalized":
+		*bn = FinalizedBlockNumber
+		return nil
 	}
 
 	blckNum, err := hexutil.DecodeUint64(input)
@@ -117,7 +131,7 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 }
 
 // MarshalText implements encoding.TextMarshaler. It marshals:
-// - "latest", "earliest" or "pending" as strings
+// - "latest", "earliest", "pending", "accepted", "safe" or "finalized" as strings
 // - other numbers as hex
 func (bn BlockNumber) MarshalText() ([]byte, error) {
 	switch bn {
@@ -129,6 +143,10 @@ func (bn BlockNumber) MarshalText() ([]byte, error) {
 		return []byte("pending"), nil
 	case AcceptedBlockNumber:
 		return []byte("accepted"), nil
+	case SafeBlockNumber:
+		return []byte("safe"), nil
+	case FinalizedBlockNumber:
+		return []byte("finalized"), nil
 	default:
 		return hexutil.Uint64(bn).MarshalText()
 	}
@@ -138,9 +156,10 @@ func (bn BlockNumber) Int64() int64 {
 	return (int64)(bn)
 }
 
-// IsAccepted returns true if this blockNumber should be treated as a request for the last accepted block
+// IsAccepted returns true if this blockNumber should be treated as a request for the last accepted block.
+// Accepted blocks are final, so the safe and finalized blocks are the last accepted block.
 func (bn BlockNumber) IsAccepted() bool {
-	return bn < EarliestBlockNumber && bn >= AcceptedBlockNumber
+	return bn < EarliestBlockNumber && bn >= FinalizedBlockNumber
 }
 
 type BlockNumberOrHash struct {
@@ -184,6 +203,14 @@ func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
 		bn := AcceptedBlockNumber
 		bnh.BlockNumber = &bn
 		return nil
+	case "safe":
+		bn := SafeBlockNumber
+		bnh.BlockNumber = &bn
+		return nil
+	case "finalized":
+		bn := FinalizedBlockNumber
+		bnh.BlockNumber = &bn
+		return nil
 	default:
 		if len(input) == 66 {
 			hash := common.Hash{}
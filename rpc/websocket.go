@@ -29,6 +29,8 @@ package rpc
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -49,19 +51,37 @@ const (
 	wsPingWriteTimeout = 5 * time.Second
 	wsPongTimeout      = 30 * time.Second
 	wsMessageSizeLimit = 15 * 1024 * 1024
+
+	// CloseNotificationBufferExceeded is the code of the close frame sent to
+	// the websocket clients whose pending notifications exceed the ceiling of
+	// the server.
+	CloseNotificationBufferExceeded = 4008
 )
 
-var wsBufferPool = new(sync.Pool)
+var (
+	wsBufferPool = new(sync.Pool)
+
+	errNotificationBufferExceeded = errors.New("websocket notification buffer exceeded")
+)
 
 // WebsocketHandler returns a handler that serves JSON-RPC to WebSocket connections.
 //
 // allowedOrigins should be a comma-separated list of allowed origin URLs.
 // To allow connections with any origin, pass "*".
 func (s *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
-	return s.WebsocketHandlerWithDuration(allowedOrigins, 0, 0, 0)
+	return s.WebsocketHandlerWithDuration(allowedOrigins, 0, 0, 0, 0)
 }
 
-func (s *Server) WebsocketHandlerWithDuration(allowedOrigins []string, apiMaxDuration, refillRate, maxStored time.Duration) http.Handler {
+// WebsocketHandlerWithDuration returns a handler that serves JSON-RPC to
+// WebSocket connections with the limits of the calls of [ServeCodec].
+//
+// If [maxPendingNotificationBytes] is positive, the notifications of the
+// subscriptions of each connection are queued and written to it in the
+// background. The connection is closed with the code
+// [CloseNotificationBufferExceeded] once the notifications pending to be
+// written to it would exceed [maxPendingNotificationBytes], so that slow
+// clients cannot grow the memory of the server.
+func (s *Server) WebsocketHandlerWithDuration(allowedOrigins []string, apiMaxDuration, refillRate, maxStored time.Duration, maxPendingNotificationBytes int) http.Handler {
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  wsReadBuffer,
 		WriteBufferSize: wsWriteBuffer,
@@ -74,7 +94,7 @@ func (s *Server) WebsocketHandlerWithDuration(allowedOrigins []string, apiMaxDur
 			log.Debug("WebSocket upgrade failed", "err", err)
 			return
 		}
-		codec := newWebsocketCodec(conn, r.Host, r.Header)
+		codec := newWebsocketCodec(conn, r.Host, r.Header, maxPendingNotificationBytes)
 		s.ServeCodec(codec, 0, apiMaxDuration, refillRate, maxStored)
 	})
 }
@@ -211,7 +231,7 @@ func DialWebsocketWithDialer(ctx context.Context, endpoint, origin string, diale
 			}
 			return nil, hErr
 		}
-		return newWebsocketCodec(conn, endpoint, header), nil
+		return newWebsocketCodec(conn, endpoint, header, 0), nil
 	})
 }
 
@@ -253,9 +273,24 @@ type websocketCodec struct {
 
 	wg        sync.WaitGroup
 	pingReset chan struct{}
+
+	notifications *wsNotificationQueue // nil if the notifications are written synchronously
+}
+
+// wsNotificationQueue holds the notifications of the subscriptions of a
+// connection until they are written. The bytes pending to be written include
+// the notification being written.
+type wsNotificationQueue struct {
+	maxPendingBytes int
+	wake            chan struct{} // signaled when a notification is queued or the ceiling is exceeded
+
+	lock         sync.Mutex
+	pending      [][]byte
+	pendingBytes int
+	exceeded     bool
 }
 
-func newWebsocketCodec(conn *websocket.Conn, host string, req http.Header) ServerCodec {
+func newWebsocketCodec(conn *websocket.Conn, host string, req http.Header, maxPendingNotificationBytes int) ServerCodec {
 	conn.SetReadLimit(wsMessageSizeLimit)
 	conn.SetPongHandler(func(appData string) error {
 		conn.SetReadDeadline(time.Time{})
@@ -274,9 +309,18 @@ func newWebsocketCodec(conn *websocket.Conn, host string, req http.Header) Serve
 	wc.info.HTTP.Host = host
 	wc.info.HTTP.Origin = req.Get("Origin")
 	wc.info.HTTP.UserAgent = req.Get("User-Agent")
+	wc.info.HTTP.ForwardedFor = req.Get("X-Forwarded-For")
 	// Start pinger.
 	wc.wg.Add(1)
 	go wc.pingLoop()
+	if maxPendingNotificationBytes > 0 {
+		wc.notifications = &wsNotificationQueue{
+			maxPendingBytes: maxPendingNotificationBytes,
+			wake:            make(chan struct{}, 1),
+		}
+		wc.wg.Add(1)
+		go wc.notificationLoop()
+	}
 	return wc
 }
 
@@ -305,6 +349,112 @@ func (wc *websocketCodec) writeJSONSkipDeadline(ctx context.Context, v interface
 	return err
 }
 
+// writeNotification queues [msg] to be written by [notificationLoop], or
+// writes it if the notifications are not queued. Fails without queueing [msg]
+// once the pending notifications would exceed their ceiling, in which case
+// the connection is closed.
+func (wc *websocketCodec) writeNotification(msg *jsonrpcMessage) error {
+	q := wc.notifications
+	if q == nil {
+		return wc.writeJSON(context.Background(), msg)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	q.lock.Lock()
+	if q.exceeded {
+		q.lock.Unlock()
+		return errNotificationBufferExceeded
+	}
+	exceeded := q.pendingBytes+len(b) > q.maxPendingBytes
+	if exceeded {
+		// The queued notifications are dropped, as the connection is closed
+		q.exceeded = true
+		q.pending = nil
+	} else {
+		q.pending = append(q.pending, b)
+		q.pendingBytes += len(b)
+	}
+	q.lock.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	if exceeded {
+		wsNotificationBufferExceededCounter.Inc(1)
+		log.Warn("Closing websocket connection with too many pending notifications", "conn", wc.remoteAddr(), "maxBytes", q.maxPendingBytes)
+		return errNotificationBufferExceeded
+	}
+	return nil
+}
+
+// nextNotification returns the next notification to write, or nil if there
+// is none. Returns true if the pending notifications exceeded their ceiling.
+func (q *wsNotificationQueue) nextNotification() ([]byte, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.exceeded || len(q.pending) == 0 {
+		return nil, q.exceeded
+	}
+	b := q.pending[0]
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+	return b, false
+}
+
+// written records that the notification [b] is no longer pending.
+func (q *wsNotificationQueue) written(b []byte) {
+	q.lock.Lock()
+	q.pendingBytes -= len(b)
+	q.lock.Unlock()
+}
+
+// notificationLoop writes the queued notifications, and closes the connection
+// with the code [CloseNotificationBufferExceeded] once their ceiling is
+// exceeded.
+func (wc *websocketCodec) notificationLoop() {
+	defer wc.wg.Done()
+
+	q := wc.notifications
+	for {
+		select {
+		case <-wc.closed():
+			return
+		case <-q.wake:
+		}
+		for {
+			b, exceeded := q.nextNotification()
+			if exceeded {
+				closeMsg := websocket.FormatCloseMessage(CloseNotificationBufferExceeded, errNotificationBufferExceeded.Error())
+				wc.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(wsPingWriteTimeout))
+				wc.jsonCodec.close()
+				return
+			}
+			if b == nil {
+				break
+			}
+			wc.jsonCodec.encMu.Lock()
+			wc.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
+			err := wc.conn.WriteMessage(websocket.TextMessage, b)
+			wc.jsonCodec.encMu.Unlock()
+			q.written(b)
+			if err != nil {
+				wc.jsonCodec.close()
+				return
+			}
+			// Notify pingLoop to delay the next idle ping.
+			select {
+			case wc.pingReset <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
 // pingLoop sends periodic ping frames when the connection is idle.
 func (wc *websocketCodec) pingLoop() {
 	var timer = time.NewTimer(wsPingInterval)
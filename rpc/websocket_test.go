@@ -33,6 +33,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -237,6 +238,100 @@ func TestClientWebsocketLargeMessage(t *testing.T) {
 	}
 }
 
+// This checks that the notifications pending to be written to a websocket
+// connection are bounded, and that a client not reading them is disconnected
+// once they exceed the ceiling.
+func TestWebsocketNotificationBuffer(t *testing.T) {
+	const (
+		maxPendingBytes = 256 * 1024
+		payloadSize     = 4 * 1024
+	)
+	var (
+		srv     = NewServer(0)
+		service = &burstService{size: payloadSize, stopped: make(chan error, 1)}
+		httpsrv = httptest.NewServer(srv.WebsocketHandlerWithDuration([]string{"*"}, 0, 0, 0, maxPendingBytes))
+		wsURL   = "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+	)
+	defer srv.Stop()
+	defer httpsrv.Close()
+	if err := srv.RegisterName("burst", service); err != nil {
+		t.Fatal(err)
+	}
+	dial := func(n int) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "burst_subscribe", "params": []interface{}{"burst", n}}); err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// A client receives all the notifications of a burst within the ceiling
+	conn := dial(50)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for i := 0; i < 51; i++ { // including the response to the subscription
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatalf("Failed to read message %d: %s", i, err)
+		}
+	}
+	if err := <-service.stopped; err != nil {
+		t.Fatal(err)
+	}
+
+	// A client that stops reading is disconnected at the ceiling, rather than
+	// buffering the 64 MiB of the burst
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	conn = dial(16 * 1024)
+	defer conn.Close()
+	var (
+		peak uint64
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+			select {
+			case <-service.stopped:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("The burst did not stop")
+	}
+	if growth := int64(peak) - int64(before.HeapAlloc); growth > 32*1024*1024 {
+		t.Fatalf("Expected the heap to stay bounded, found a growth of %d bytes", growth)
+	}
+
+	// The client reads the notifications written before the ceiling, then the
+	// close frame
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseNotificationBufferExceeded {
+			t.Fatalf("Expected to be closed with code %d, found %v", CloseNotificationBufferExceeded, err)
+		}
+		break
+	}
+}
+
 // FLAKY
 // func TestClientWebsocketSevered(t *testing.T) {
 // 	t.Parallel()
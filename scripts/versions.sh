@@ -2,5 +2,6 @@
 
 # Set up the versions to be used
 coreth_version=${CORETH_VERSION:-'v0.8.6-rc.2'}
+coreth_fork_name=${CORETH_FORK_NAME:-'zsmartex'}
 # Don't export them as they're used in the context of other calls
 avalanche_version=${AVALANCHE_VERSION:-'v1.7.7'}